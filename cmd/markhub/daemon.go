@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/daemon"
+)
+
+// runStart launches `markhub serve` with the remaining arguments in the background.
+func runStart() {
+	args := os.Args[2:]
+	// Parse the flags the child will see so the pidfile records the real port and log file
+	os.Args = append([]string{os.Args[0]}, args...)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ConfigFromStdin() {
+		log.Fatalf("--config - cannot be used with start: the background process has no stdin")
+	}
+	if err := cfg.ValidateExposure(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	pid, err := daemon.Start(daemon.Options{
+		Args:    append([]string{"serve"}, args...),
+		PidFile: config.GetPidFilePath(),
+		LogFile: cfg.GetLogPath(),
+		Addr:    cfg.LocalAddr(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("MarkHub started in background (pid %d)\n", pid)
+	fmt.Printf("  URL:  http://%s\n", cfg.LocalAddr())
+	fmt.Printf("  Logs: %s\n", cfg.GetLogPath())
+}
+
+// runStop stops the background server via SIGTERM.
+func runStop() {
+	pid, err := daemon.Stop(config.GetPidFilePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("MarkHub stopped (pid %d)\n", pid)
+}
+
+// runStatus reports whether the background server is running and healthy.
+func runStatus() {
+	info, err := daemon.Status(config.GetPidFilePath())
+	if err != nil {
+		fmt.Println(err)
+		if errors.Is(err, daemon.ErrNotRunning) {
+			os.Exit(3)
+		}
+		os.Exit(1)
+	}
+	health := "healthy"
+	if !info.Healthy {
+		health = "not responding"
+	}
+	fmt.Printf("MarkHub is running (pid %d, http://%s, %s)\n", info.PID, info.Addr, health)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/handler"
+)
+
+const exportUsageMessage = "usage: markhub export docset [--config file] --folder alias --out name.docset"
+
+// runExport writes a folder in a format for other tools. `markhub export docset` writes a Dash/Zeal
+// docset, reporting progress on stderr.
+func runExport() {
+	if len(os.Args) < 3 || os.Args[2] != "docset" {
+		exportFail(exitUsage, exportUsageMessage)
+	}
+	folder := flag.String("folder", "", "Alias of the folder to export")
+	out := flag.String("out", "", "Directory of the docset bundle to write, e.g. Docs.docset")
+
+	os.Args = append([]string{os.Args[0]}, os.Args[3:]...)
+	cfg, err := config.Load()
+	if err != nil {
+		exportFail(exitUsage, "failed to load config: %v", err)
+	}
+	if flag.NArg() > 0 || *folder == "" || *out == "" {
+		exportFail(exitUsage, exportUsageMessage)
+	}
+	styles, err := fs.Sub(webFS, "web/css")
+	if err != nil {
+		exportFail(exitRenderFailed, "failed to load stylesheets: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	tree := handler.NewTreeHandler(cfg)
+	export := handler.NewExportHandler(cfg, tree, handler.NewFileHandler(cfg))
+	start := time.Now()
+	report, err := export.WriteDocset(ctx, *folder, *out, styles, printProgress("export"))
+	if ctx.Err() != nil {
+		exportFail(exitRenderFailed, "interrupted after %d document(s)", report.Rendered+report.Failed)
+	}
+	if err != nil {
+		exportFail(exitRenderFailed, "failed to write %s: %v", *out, err)
+	}
+	fmt.Fprintf(os.Stderr, "markhub export: wrote %d document(s) to %s in %v\n", report.Rendered, *out,
+		time.Since(start).Round(time.Millisecond))
+	if report.Failed > 0 {
+		exportFail(exitRenderFailed, "%d document(s) failed to render", report.Failed)
+	}
+}
+
+func exportFail(code int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "markhub export: "+format+"\n", args...)
+	os.Exit(code)
+}
@@ -2,16 +2,29 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/crash"
 	"github.com/CageChen/markhub/internal/handler"
+	"github.com/CageChen/markhub/internal/router"
+	"github.com/CageChen/markhub/internal/update"
 	"github.com/CageChen/markhub/internal/watcher"
 	"github.com/gin-gonic/gin"
 )
@@ -26,101 +39,372 @@ var (
 	date    = "unknown"
 )
 
+// shutdownTimeout bounds how long in-flight requests may take once a stop signal arrives
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "start":
+			runStart()
+			return
+		case "stop":
+			runStop()
+			return
+		case "status":
+			runStatus()
+			return
+		case "render":
+			runRender()
+			return
+		case "update":
+			runUpdate()
+			return
+		case "warm":
+			runWarm()
+			return
+		case "export":
+			runExport()
+			return
+		}
+	}
+	if exe, err := os.Executable(); err == nil {
+		// Windows leaves the binary a previous update replaced next to the new one
+		update.RemoveStale(exe)
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	// A bare file argument (`markhub ./notes.md`) previews that file
+	if flag.NArg() > 0 {
+		openPath, err := cfg.PreviewFile(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("Cannot preview %s: %v", flag.Arg(0), err)
+		}
+		cfg.OpenPath = openPath
+		cfg.Open = true
+	}
+	if err := cfg.ValidateExposure(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if cfg.LogFile != "" {
+		logFile, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		defer func() { _ = logFile.Close() }()
+		log.SetOutput(logFile)
+	}
+
+	crash.SetDefault(crash.New(config.GetCrashLogPath(), crash.DefaultKeep))
 
 	log.Printf("MarkHub %s (commit: %s, built: %s)", version, commit, date)
-	log.Printf("Config file: %s", cfg.GetConfigFilePath())
-	log.Printf("Serving %d folder(s):", len(cfg.Folders))
-	for i, f := range cfg.Folders {
-		if f.GitRef != "" {
+	if cfg.ConfigFromStdin() {
+		log.Printf("Config file: stdin (read-only: ephemeral session, changes are not saved)")
+	} else if cfg.Ephemeral {
+		log.Printf("Config file: %s (read-only: ephemeral session, changes are not saved)", cfg.GetConfigFilePath())
+	} else {
+		log.Printf("Config file: %s", cfg.GetConfigFilePath())
+	}
+	folders := cfg.FoldersSnapshot()
+	log.Printf("Serving %d folder(s):", len(folders))
+	for i, f := range folders {
+		if f.Temporary {
+			log.Printf("  [%d] %s -> %s (temporary)", i, f.Alias, f.Path)
+		} else if f.GitRef != "" {
 			log.Printf("  [%d] %s -> %s (git ref: %s)", i, f.Alias, f.Path, f.GitRef)
 		} else {
 			log.Printf("  [%d] %s -> %s", i, f.Alias, f.Path)
 		}
 	}
-	log.Printf("Server starting at: http://localhost:%d", cfg.Port)
-
+	if cfg.FolderLimitExceeded() {
+		log.Printf("Warning: %d folder(s) configured, more than max_folders (%d); "+
+			"no more can be added until some are removed", len(folders), cfg.GetMaxFolders())
+	}
+	for _, overlap := range cfg.FolderOverlaps() {
+		if cfg.OverlappingFolders == config.OverlappingFoldersHide {
+			log.Printf("Warning: %v; hiding it from the tree", overlap)
+		} else {
+			log.Printf("Warning: %v; its documents appear twice", overlap)
+		}
+	}
 	// Create handlers
 	treeHandler := handler.NewTreeHandler(cfg)
 	fileHandler := handler.NewFileHandler(cfg)
 	wsHandler := handler.NewWSHandler()
+	fileHandler.OnSave(wsHandler.SuppressEcho)
+	fileHandler.OnTreeChange(func(string) { treeHandler.Invalidate() })
+	fileHandler.OnTreeChange(wsHandler.TreeChanged)
+	wsHandler.SetRenderer(fileHandler.Render)
+	settingsHandler := handler.NewSettingsHandler(cfg, wsHandler)
+	lockHandler := handler.NewLockHandler(fileHandler, wsHandler)
+	fileHandler.SetLockConflict(lockHandler.Conflict)
+	lockHandler.Start()
+	defer lockHandler.Stop()
+	searchHandler := handler.NewSearchHandler(cfg, treeHandler)
+	if cfg.Search.IndexOnStart {
+		searchHandler.StartIndexing()
+	}
+	exportHandler := handler.NewExportHandler(cfg, treeHandler, fileHandler)
+	webhookHandler := handler.NewWebhookHandler(cfg)
+	webhookHandler.Start()
+	defer webhookHandler.Stop()
+	analyticsHandler := handler.NewAnalyticsHandler(cfg)
+	fileHandler.OnView(analyticsHandler.RecordView)
+	if len(cfg.Webhooks) > 0 && !cfg.Watch {
+		log.Printf("Warning: webhooks are configured but file watching is disabled; no changes will be posted")
+	}
+	if cfg.Prewarm {
+		go prewarm(exportHandler)
+	}
 
 	// Setup file watcher if enabled
 	if cfg.Watch {
-		w, err := watcher.New(cfg)
+		w, err := watcher.NewFromConfig(cfg)
 		if err != nil {
 			log.Printf("Warning: failed to create file watcher: %v", err)
 		} else {
+			w.OnChange(treeHandler.OnFileChange)
 			w.OnChange(wsHandler.OnFileChange)
+			w.OnChange(searchHandler.OnFileChange)
+			w.OnChange(fileHandler.OnFileChange)
+			w.OnChange(webhookHandler.OnFileChange)
 			if err := w.Start(); err != nil {
 				log.Printf("Warning: failed to start file watcher: %v", err)
 			}
 			defer func() { _ = w.Stop() }()
-			log.Printf("File watcher enabled")
+			if cfg.WatchMode == config.WatchModePoll {
+				log.Printf("File watcher enabled (polling)")
+			} else {
+				log.Printf("File watcher enabled")
+			}
 		}
 	}
 
-	// Setup Gin router
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.New()
-	r.Use(gin.Recovery())
-	r.Use(corsMiddleware())
-
-	// API routes
-	api := r.Group("/api")
-	{
-		// Tree and file APIs
-		api.GET("/tree", treeHandler.GetTree)
-		api.GET("/files/*path", fileHandler.GetFile)
-		api.GET("/raw/*path", fileHandler.GetRaw)
-		api.GET("/ws", wsHandler.HandleWS)
-
-		// Folder management APIs
-		api.GET("/folders", treeHandler.GetFolders)
-		api.POST("/folders", treeHandler.AddFolder)
-		api.PUT("/folders", treeHandler.UpdateFolder)
-		api.DELETE("/folders", treeHandler.RemoveFolder)
-		api.PUT("/exclude", treeHandler.UpdateGlobalExclude)
-		api.PUT("/repo-exclude", treeHandler.UpdateRepoExclude)
-	}
-
 	// Serve embedded static files
 	webContent, err := fs.Sub(webFS, "web")
 	if err != nil {
 		log.Fatalf("Failed to load web assets: %v", err)
 	}
-	r.NoRoute(gin.WrapH(http.FileServer(http.FS(webContent))))
+	if handler.WebAssetsMissing(webContent) {
+		log.Printf("WARNING: the web interface is missing from this build (cmd/markhub/web/index.html was not " +
+			"embedded); / shows a fallback page and only the API works. Rebuild with cmd/markhub/web populated.")
+	}
+
+	// Admin shutdown/restart requests are handed to the serve loop below
+	lifecycle := make(chan bool, 1)
+	adminHandler := handler.NewAdminHandler(func(restart bool) {
+		select {
+		case lifecycle <- restart:
+		default:
+		}
+	})
+	if cfg.ConfigFromStdin() {
+		// The re-executed process would find stdin already consumed
+		adminHandler.DisableRestart("cannot restart: config was read from stdin")
+	}
+
+	// Bind every listen address up front so a bad entry fails before anything is served
+	listeners, err := listenAll(cfg.ListenAddrs())
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	urls := make([]string, len(listeners))
+	for i, ln := range listeners {
+		urls[i] = listenerURL(ln)
+		log.Printf("Server starting at: %s", urls[i])
+	}
+	var lan []string
+	if cfg.Expose {
+		if cfg.AuthToken == "" {
+			log.Printf("WARNING: exposed on all interfaces WITHOUT authentication (--expose-insecure)")
+		}
+		lan = reachableURLs(listeners)
+		for _, u := range lan {
+			log.Printf("  LAN: %s", u)
+		}
+		// The QR code only helps when someone is looking at the terminal
+		if len(lan) > 0 && cfg.LogFile == "" && isTerminal(os.Stderr) {
+			if err := printQR(os.Stderr, lan[0]); err != nil {
+				log.Printf("Warning: cannot render QR code: %v", err)
+			}
+		}
+	}
+
+	// Setup Gin router
+	gin.SetMode(gin.ReleaseMode)
+	r := router.New(cfg, router.Handlers{
+		Tree:       treeHandler,
+		File:       fileHandler,
+		WS:         wsHandler,
+		Settings:   settingsHandler,
+		Search:     searchHandler,
+		Static:     handler.NewStaticHandler(cfg, webContent),
+		Admin:      adminHandler,
+		URLs:       handler.NewURLsHandler(lan),
+		Export:     exportHandler,
+		ImageProxy: handler.NewImageProxyHandler(cfg),
+		Locks:      lockHandler,
+		Webhooks:   webhookHandler,
+		Analytics:  analyticsHandler,
+	}, router.BuildInfo{Version: version, Commit: commit, Date: date})
 
 	// Open browser if requested
 	if cfg.Open {
-		go openBrowser(fmt.Sprintf("http://localhost:%d", cfg.Port))
+		go openBrowser(startURL(urls[0], cfg.OpenPath, fileHandler))
+	}
+
+	// Serve the same handler on every listener and shut down gracefully on SIGINT/SIGTERM
+	srv := &http.Server{
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      serverWriteTimeout(cfg.RequestTimeout),
+		IdleTimeout:       2 * time.Minute,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func() {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("%s: %w", ln.Addr(), err)
+			}
+		}()
 	}
 
-	// Start server
-	addr := fmt.Sprintf(":%d", cfg.Port)
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	restart := false
+	select {
+	case err := <-serveErr:
+		log.Printf("Server failed: %v", err)
+		_ = srv.Close()
+		os.Exit(1)
+	case <-ctx.Done():
+		log.Printf("Shutting down...")
+	case restart = <-lifecycle:
+		if restart {
+			log.Printf("Restart requested via API, shutting down...")
+		} else {
+			log.Printf("Shutdown requested via API, shutting down...")
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+	}
+	if err := analyticsHandler.Flush(); err != nil {
+		log.Printf("Warning: failed to save the view counts: %v", err)
+	}
+
+	if restart {
+		// Listeners are released by Shutdown, so the new process can bind the same addresses
+		log.Printf("Restarting...")
+		if err := reexec(); err != nil {
+			log.Printf("Restart failed: %v", err)
+			os.Exit(1)
+		}
 	}
 }
 
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+// serverWriteTimeout leaves room beyond the request deadline so handlers can still send
+// the 504; the WebSocket handler clears it on its hijacked connection.
+func serverWriteTimeout(requestTimeout time.Duration) time.Duration {
+	if requestTimeout <= 0 {
+		return 0
+	}
+	return requestTimeout + 10*time.Second
+}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
+// startURL returns the URL the browser opens on startup: the document at openPath when it
+// resolves, otherwise the root.
+func startURL(base, openPath string, files *handler.FileHandler) string {
+	openPath = strings.TrimPrefix(openPath, "/")
+	if openPath == "" {
+		return base
+	}
+	if err := files.CheckFile(context.Background(), openPath); err != nil {
+		log.Printf("Warning: cannot open %q (%v), opening the root instead", openPath, err)
+		return base
+	}
+	return base + "/#" + openPath
+}
+
+// listenAll opens a TCP listener for every address, closing the ones already
+// opened if any address fails.
+func listenAll(addrs []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// listenerURL returns the URL a local browser can use for the listener; wildcard binds show as localhost.
+func listenerURL(ln net.Listener) string {
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		return "http://" + ln.Addr().String()
+	}
+	host := addr.IP.String()
+	if addr.IP.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+// reachableURLs returns the URLs other devices can use: every LAN address for a listener
+// bound to all interfaces, and the listener's own address when it is bound to a
+// specific non-loopback IP. Loopback listeners contribute nothing.
+func reachableURLs(listeners []net.Listener) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, ln := range listeners {
+		addr, ok := ln.Addr().(*net.TCPAddr)
+		if !ok || addr.IP.IsLoopback() {
+			continue
+		}
+		candidates := []string{listenerURL(ln)}
+		if addr.IP.IsUnspecified() {
+			candidates = lanURLs(addr.Port)
+		}
+		for _, u := range candidates {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
 		}
+	}
+	return urls
+}
 
-		c.Next()
+// lanURLs returns an http URL for every non-loopback IPv4 interface address.
+func lanURLs(port int) []string {
+	var urls []string
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		urls = append(urls, fmt.Sprintf("http://%s:%d", ipNet.IP.String(), port))
 	}
+	return urls
 }
 
 func openBrowser(url string) {
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// printQR renders text as a QR code using Unicode half blocks, two modules per character
+// row. Light modules are drawn, which suits the usual dark terminal background.
+func printQR(w io.Writer, text string) error {
+	code, err := qrcode.New(text, qrcode.Low)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, code.ToSmallString(false))
+	return err
+}
+
+// isTerminal reports whether f is a character device such as an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/handler"
+)
+
+// Exit codes for `markhub render`
+const (
+	exitRenderFailed   = 1
+	exitUsage          = 2
+	exitNotFound       = 3
+	exitAccessDenied   = 4
+	renderUsageMessage = "usage: markhub render [--config file] [--format html|json] [--out file] [--inline-images] " +
+		"<alias/path | file>"
+)
+
+// runRender renders a single document through the server's pipeline and writes it to stdout or --out.
+func runRender() {
+	format := flag.String("format", "html", "Output format for render (html/json)")
+	out := flag.String("out", "", "Write render output to this file instead of stdout")
+	inlineImages := flag.Bool("inline-images", false, "Embed relative images as data URIs for standalone HTML")
+
+	os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	cfg, err := config.Load()
+	if err != nil {
+		renderFail(exitUsage, "failed to load config: %v", err)
+	}
+
+	// Allow flags after the positional path (`markhub render a.md --format json`)
+	args := flag.Args()
+	if len(args) == 0 {
+		renderFail(exitUsage, renderUsageMessage)
+	}
+	target := args[0]
+	if err := flag.CommandLine.Parse(args[1:]); err != nil || flag.NArg() > 0 {
+		renderFail(exitUsage, renderUsageMessage)
+	}
+	if *format != "html" && *format != "json" {
+		renderFail(exitUsage, "unsupported format %q (expected html or json)", *format)
+	}
+
+	// Accept filesystem paths as well as alias-prefixed paths
+	if _, err := os.Stat(target); err == nil {
+		if aliasPath, ok := cfg.AliasPathFor(target); ok {
+			target = aliasPath
+		}
+	}
+
+	opts := handler.RenderOptions{InlineImages: *inlineImages}
+	resp, err := handler.NewFileHandler(cfg).RenderWithOptions(context.Background(), target, opts)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			renderFail(exitNotFound, "file not found: %s", target)
+		case os.IsPermission(err):
+			renderFail(exitAccessDenied, "access denied: %s", target)
+		case errors.Is(err, handler.ErrIsDirectory), errors.Is(err, handler.ErrInvalidPath):
+			renderFail(exitUsage, "%s: %v", target, err)
+		default:
+			renderFail(exitRenderFailed, "%v", err)
+		}
+	}
+
+	// Warnings never fail the render; JSON output carries them in the response
+	if *format == "html" {
+		for _, w := range resp.Warnings {
+			fmt.Fprintf(os.Stderr, "markhub render: warning: %s\n", w)
+		}
+	}
+
+	var output []byte
+	if *format == "json" {
+		output, err = json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			renderFail(exitRenderFailed, "failed to encode JSON: %v", err)
+		}
+		output = append(output, '\n')
+	} else {
+		output = []byte(resp.HTML)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(output)
+	} else {
+		err = os.WriteFile(*out, output, 0644)
+	}
+	if err != nil {
+		renderFail(exitRenderFailed, "failed to write output: %v", err)
+	}
+}
+
+func renderFail(code int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "markhub render: "+format+"\n", args...)
+	os.Exit(code)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/update"
+)
+
+// updateTimeout bounds the whole check-download-install sequence
+const updateTimeout = 5 * time.Minute
+
+// runUpdate replaces this binary with the latest release, or with --check only reports
+// whether one is available. A running server keeps the old version until restarted.
+func runUpdate() {
+	check := flag.Bool("check", false, "Only report whether a newer release is available")
+	force := flag.Bool("force", false,
+		"Install the latest release even if it is not newer (or this is a development build)")
+
+	os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	cfg, err := config.Load()
+	if err != nil {
+		updateFail("failed to load config: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	u := update.New(cfg.UpdateURL)
+	rel, err := u.Latest(ctx)
+	if err != nil {
+		updateFail("cannot check for updates: %v", err)
+	}
+
+	newer, err := update.IsNewer(version, rel.Version())
+	switch {
+	case err != nil && !*force:
+		updateFail("%v; pass --force to install %s anyway", err, rel.Tag)
+	case err == nil && !newer && !*force:
+		fmt.Printf("MarkHub %s is up to date (latest: %s)\n", version, rel.Tag)
+		return
+	case *check:
+		fmt.Printf("MarkHub %s is available (current: %s); run `markhub update` to install it\n", rel.Tag, version)
+		return
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		// Replace the real file, not a symlink pointing at it
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		updateFail("cannot locate the running binary: %v", err)
+	}
+
+	fmt.Printf("Downloading MarkHub %s (%s/%s)...\n", rel.Tag, u.GOOS, u.GOARCH)
+	binary, err := u.Download(ctx, rel)
+	if err != nil {
+		updateFail("download failed, %s was not changed: %v", exe, err)
+	}
+	if err := update.Install(exe, binary); err != nil {
+		updateFail("install failed, %s was not changed: %v", exe, err)
+	}
+	fmt.Printf("Updated %s to %s; restart running servers to use it\n", exe, rel.Tag)
+}
+
+func updateFail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "markhub update: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/crash"
+	"github.com/CageChen/markhub/internal/handler"
+)
+
+// warmProgressEvery is how many documents `markhub warm` and `markhub export` render between progress lines
+const warmProgressEvery = 100
+
+const warmUsageMessage = "usage: markhub warm [--config file] [--out dir]"
+
+// runWarm renders every document of every folder, reporting progress on stderr. With --out it
+// writes a browsable static HTML site to the directory; without, it only checks that every
+// document renders, as the parse cache lives in the server (see --prewarm).
+func runWarm() {
+	out := flag.String("out", "", "Write a static HTML site of every folder to this directory")
+
+	os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+	cfg, err := config.Load()
+	if err != nil {
+		warmFail(exitUsage, "failed to load config: %v", err)
+	}
+	if flag.NArg() > 0 {
+		warmFail(exitUsage, warmUsageMessage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	tree := handler.NewTreeHandler(cfg)
+	export := handler.NewExportHandler(cfg, tree, handler.NewFileHandler(cfg))
+	start := time.Now()
+
+	var report handler.WarmReport
+	if *out == "" {
+		report = export.Warm(ctx, printProgress("warm"))
+	} else {
+		styles, err := fs.Sub(webFS, "web/css")
+		if err != nil {
+			warmFail(exitRenderFailed, "failed to load stylesheets: %v", err)
+		}
+		report, err = export.WriteSite(ctx, *out, styles, printProgress("warm"))
+		if err != nil {
+			warmFail(exitRenderFailed, "failed to write %s: %v", *out, err)
+		}
+	}
+	if ctx.Err() != nil {
+		warmFail(exitRenderFailed, "interrupted after %d document(s)", report.Rendered+report.Failed)
+	}
+
+	fmt.Fprintf(os.Stderr, "markhub warm: rendered %d document(s) in %v", report.Rendered,
+		time.Since(start).Round(time.Millisecond))
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, " to %s", *out)
+	}
+	fmt.Fprintln(os.Stderr)
+	if report.Failed > 0 {
+		warmFail(exitRenderFailed, "%d document(s) failed to render", report.Failed)
+	}
+}
+
+// printProgress returns a progress reporter printing failures and every warmProgressEvery
+// documents on stderr, for the markhub subcommand named command
+func printProgress(command string) func(handler.WarmProgress) {
+	return func(p handler.WarmProgress) {
+		switch {
+		case p.Err != nil && p.Total == 0:
+			fmt.Fprintf(os.Stderr, "markhub %s: folder %s: %v\n", command, p.Path, p.Err)
+		case p.Err != nil:
+			fmt.Fprintf(os.Stderr, "markhub %s: %s: %v\n", command, p.Path, p.Err)
+		case p.Done%warmProgressEvery == 0:
+			fmt.Fprintf(os.Stderr, "markhub %s: %d/%d\n", command, p.Done, p.Total)
+		}
+	}
+}
+
+func warmFail(code int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "markhub warm: "+format+"\n", args...)
+	os.Exit(code)
+}
+
+// prewarm fills the server's parse cache with every document (--prewarm)
+func prewarm(export *handler.ExportHandler) {
+	defer crash.Recover("prewarm")
+	start := time.Now()
+	report := export.Warm(context.Background(), func(p handler.WarmProgress) {
+		if p.Err != nil {
+			log.Printf("Warning: prewarm: %s: %v", p.Path, p.Err)
+		}
+	})
+	log.Printf("Prewarmed %d document(s) in %v (%d failed)",
+		report.Rendered, time.Since(start).Round(time.Millisecond), report.Failed)
+}
@@ -7,6 +7,8 @@ class MarkHub {
     constructor() {
         this.currentPath = null;
         this.ws = null;
+        // Sent as X-Client-ID with saves so the server does not echo our own changes back
+        this.clientId = Math.random().toString(36).slice(2) + Date.now().toString(36);
         this.reconnectAttempts = 0;
         this.maxReconnectAttempts = 5;
         this.folders = [];
@@ -19,6 +21,8 @@ class MarkHub {
 
     async init() {
         this.initTheme();
+        this.loadBranding();
+        this.loadCapabilities();
         this.initMermaid();
         this.initZenMode();
         this.bindEvents();
@@ -44,6 +48,67 @@ class MarkHub {
         this.renderMermaidBlocks();
     }
 
+    // ========================================
+    // Branding
+    // ========================================
+    async loadBranding() {
+        try {
+            const response = await fetch('/api/v1/branding');
+            if (!response.ok) return;
+            this.applyBranding(await response.json());
+        } catch (error) {
+            console.error('Failed to load branding:', error);
+        }
+    }
+
+    applyBranding(branding) {
+        if (branding.title) {
+            document.title = branding.title;
+        }
+        if (branding.accentColor) {
+            document.documentElement.style.setProperty('--accent-primary', branding.accentColor);
+        }
+        if (branding.faviconUrl) {
+            let icon = document.querySelector('link[rel="icon"]');
+            if (!icon) {
+                icon = document.createElement('link');
+                icon.rel = 'icon';
+                document.head.appendChild(icon);
+            }
+            icon.href = branding.faviconUrl;
+        }
+        const logo = document.querySelector('.sidebar-header .logo');
+        if (logo && branding.logoUrl) {
+            let img = logo.querySelector('img.logo-image');
+            if (!img) {
+                img = document.createElement('img');
+                img.className = 'logo-image';
+                img.alt = '';
+                img.width = 28;
+                img.height = 28;
+                const svg = logo.querySelector('svg');
+                if (svg) svg.replaceWith(img);
+                else logo.prepend(img);
+            }
+            img.src = branding.logoUrl;
+        }
+    }
+
+    // ========================================
+    // Capabilities
+    // ========================================
+    async loadCapabilities() {
+        try {
+            const response = await fetch('/api/v1/capabilities');
+            if (!response.ok) return;
+            this.capabilities = await response.json();
+            // Hide the controls of state-changing APIs the server would refuse
+            document.body.classList.toggle('read-only', !this.capabilities.write);
+        } catch (error) {
+            console.error('Failed to load capabilities:', error);
+        }
+    }
+
     // ========================================
     // Mermaid Diagrams
     // ========================================
@@ -63,18 +128,15 @@ class MarkHub {
         const container = document.getElementById('content');
         if (!container) return;
 
-        const codeBlocks = container.querySelectorAll('pre > code.language-mermaid');
-        if (codeBlocks.length === 0) return;
+        // The server wraps each diagram's source in <div class="mermaid"><pre>; drawn ones have no <pre>
+        const sources = container.querySelectorAll('div.mermaid > pre');
+        if (sources.length === 0) return;
 
         // Reset mermaid internal ID counter to avoid conflicts on re-render
         this.initMermaid();
 
-        codeBlocks.forEach((code, i) => {
-            const pre = code.parentElement;
-            const div = document.createElement('div');
-            div.className = 'mermaid';
-            div.textContent = code.textContent;
-            pre.replaceWith(div);
+        sources.forEach(pre => {
+            pre.parentElement.textContent = pre.textContent;
         });
 
         try {
@@ -125,6 +187,24 @@ class MarkHub {
             }
         });
 
+        // Folder list buttons are re-rendered often; one delegated listener handles them all
+        // (inline onclick handlers would be blocked by the Content-Security-Policy)
+        document.getElementById('folderList').addEventListener('click', (e) => {
+            const button = e.target.closest('[data-action]');
+            if (!button) return;
+            e.preventDefault();
+            const index = Number(button.dataset.index);
+            switch (button.dataset.action) {
+                case 'editFolder': this.editFolder(index); break;
+                case 'removeFolder': this.removeFolder(index); break;
+                case 'saveEditFolder': this.saveEditFolder(index); break;
+                case 'cancelEditFolder': this.cancelEditFolder(); break;
+                case 'editRepoExclude': this.editRepoExclude(button.dataset.repoPath); break;
+                case 'saveRepoExclude': this.saveRepoExclude(button.dataset.repoPath); break;
+                case 'cancelRepoExclude': this.cancelRepoExclude(); break;
+            }
+        });
+
         document.getElementById('addFolderBtn').addEventListener('click', () => {
             this.addFolder();
         });
@@ -133,6 +213,10 @@ class MarkHub {
             this.saveGlobalExclude();
         });
 
+        document.getElementById('restartServerBtn').addEventListener('click', () => {
+            this.restartServer();
+        });
+
         // Sidebar toggle (mobile)
         document.getElementById('sidebarToggle').addEventListener('click', () => {
             document.getElementById('sidebar').classList.toggle('open');
@@ -190,7 +274,7 @@ class MarkHub {
     // Folder Management Modal
     // ========================================
     async showFolderModal() {
-        await this.loadFolders();
+        await Promise.all([this.loadFolders(), this.loadLanUrls()]);
         this.renderFolderList();
         this.renderGlobalExclude();
         document.getElementById('folderModal').classList.add('visible');
@@ -209,18 +293,34 @@ class MarkHub {
 
     async loadFolders() {
         try {
-            const response = await fetch('/api/folders');
+            const response = await fetch('/api/v1/folders');
             if (response.ok) {
                 const data = await response.json();
                 this.folders = data.folders || [];
                 this.globalExclude = data.globalExclude || [];
                 this.repoExclude = data.repoExclude || {};
+                document.getElementById('ephemeralNotice').hidden = !data.ephemeral;
             }
         } catch (error) {
             console.error('Failed to load folders:', error);
         }
     }
 
+    async loadLanUrls() {
+        const section = document.getElementById('lanSection');
+        try {
+            const response = await fetch('/api/v1/urls');
+            const urls = response.ok ? (await response.json()).urls : [];
+            document.getElementById('lanUrls').innerHTML = urls
+                .map(url => `<li><a href="${this.escapeHtml(url)}" target="_blank" rel="noopener">${this.escapeHtml(url)}</a></li>`)
+                .join('');
+            section.hidden = urls.length === 0;
+        } catch (error) {
+            console.error('Failed to load LAN URLs:', error);
+            section.hidden = true;
+        }
+    }
+
     renderGlobalExclude() {
         const textarea = document.getElementById('globalExclude');
         textarea.value = (this.globalExclude || []).join('\n');
@@ -270,13 +370,12 @@ class MarkHub {
             html += `<div class="repo-group-path">${this.escapeHtml(repoPath)}</div>`;
 
             if (isEditingRepoExclude) {
-                const escapedPath = this.escapeHtml(repoPath).replace(/'/g, "\\'");
                 html += `<div class="folder-edit-form" data-repo-exclude-path="${this.escapeHtml(repoPath)}">`;
                 html += `<div class="form-group"><label>Repo Excludes <span class="label-hint">(comma-separated, applied to all refs)</span></label>`;
                 html += `<input type="text" id="editRepoExcludeInput" value="${this.escapeHtml(repoExcludes.join(', '))}" placeholder="e.g. vendor/*, docs/*"></div>`;
                 html += `<div class="folder-edit-actions">`;
-                html += `<button class="btn btn-primary btn-sm" onclick="markhub.saveRepoExclude('${escapedPath}')">Save</button>`;
-                html += `<button class="btn btn-secondary btn-sm" onclick="markhub.cancelRepoExclude()">Cancel</button>`;
+                html += `<button class="btn btn-primary btn-sm" data-action="saveRepoExclude" data-repo-path="${this.escapeHtml(repoPath)}">Save</button>`;
+                html += `<button class="btn btn-secondary btn-sm" data-action="cancelRepoExclude">Cancel</button>`;
                 html += `</div></div>`;
             } else {
                 const repoExcludeInfo = repoExcludes.length > 0
@@ -285,7 +384,7 @@ class MarkHub {
 
                 html += `<details class="repo-exclude-details">`;
                 html += `<summary class="repo-exclude-summary">Shared Repo Excludes (${repoExcludeCount})`;
-                html += `<button class="btn-edit-inline" title="Edit repo excludes" onclick="event.preventDefault(); markhub.editRepoExclude('${this.escapeHtml(repoPath).replace(/'/g, "\\'")}')">`;
+                html += `<button class="btn-edit-inline" title="Edit repo excludes" data-action="editRepoExclude" data-repo-path="${this.escapeHtml(repoPath)}">`;
                 html += `<svg viewBox="0 0 24 24" width="14" height="14" fill="currentColor"><path d="M3 17.25V21h3.75L17.81 9.94l-3.75-3.75L3 17.25zM20.71 7.04c.39-.39.39-1.02 0-1.41l-2.34-2.34c-.39-.39-1.02-.39-1.41 0l-1.83 1.83 3.75 3.75 1.83-1.83z"/></svg>`;
                 html += `</button>`;
                 html += `</summary>`;
@@ -315,12 +414,12 @@ class MarkHub {
                             ${excludeTags}
                         </div>
                         <div class="folder-actions">
-                            <button class="btn-edit" title="Edit" onclick="markhub.editFolder(${index})">
+                            <button class="btn-edit" title="Edit" data-action="editFolder" data-index="${index}">
                                 <svg viewBox="0 0 24 24" width="16" height="16" fill="currentColor">
                                     <path d="M3 17.25V21h3.75L17.81 9.94l-3.75-3.75L3 17.25zM20.71 7.04c.39-.39.39-1.02 0-1.41l-2.34-2.34c-.39-.39-1.02-.39-1.41 0l-1.83 1.83 3.75 3.75 1.83-1.83z"/>
                                 </svg>
                             </button>
-                            <button class="btn-delete" title="Remove folder" onclick="markhub.removeFolder(${index})">
+                            <button class="btn-delete" title="Remove folder" data-action="removeFolder" data-index="${index}">
                                 <svg viewBox="0 0 24 24" width="16" height="16" fill="currentColor">
                                     <path d="M6 19c0 1.1.9 2 2 2h8c1.1 0 2-.9 2-2V7H6v12zM19 4h-3.5l-1-1h-5l-1 1H5v2h14V4z"/>
                                 </svg>
@@ -355,12 +454,12 @@ class MarkHub {
                         ${excludeInfo}
                     </div>
                     <div class="folder-actions">
-                        <button class="btn-edit" title="Edit" onclick="markhub.editFolder(${index})">
+                        <button class="btn-edit" title="Edit" data-action="editFolder" data-index="${index}">
                             <svg viewBox="0 0 24 24" width="16" height="16" fill="currentColor">
                                 <path d="M3 17.25V21h3.75L17.81 9.94l-3.75-3.75L3 17.25zM20.71 7.04c.39-.39.39-1.02 0-1.41l-2.34-2.34c-.39-.39-1.02-.39-1.41 0l-1.83 1.83 3.75 3.75 1.83-1.83z"/>
                             </svg>
                         </button>
-                        <button class="btn-delete" title="Remove folder" onclick="markhub.removeFolder(${index})">
+                        <button class="btn-delete" title="Remove folder" data-action="removeFolder" data-index="${index}">
                             <svg viewBox="0 0 24 24" width="16" height="16" fill="currentColor">
                                 <path d="M6 19c0 1.1.9 2 2 2h8c1.1 0 2-.9 2-2V7H6v12zM19 4h-3.5l-1-1h-5l-1 1H5v2h14V4z"/>
                             </svg>
@@ -387,8 +486,8 @@ class MarkHub {
         html += `<div class="form-group"><label>Excludes <span class="label-hint">(comma-separated)</span></label>`;
         html += `<input type="text" id="editFolderExclude" value="${this.escapeHtml((folder.exclude || []).join(', '))}" placeholder="e.g. vendor/*, node_modules/*"></div>`;
         html += `<div class="folder-edit-actions">`;
-        html += `<button class="btn btn-primary btn-sm" onclick="markhub.saveEditFolder(${index})">Save</button>`;
-        html += `<button class="btn btn-secondary btn-sm" onclick="markhub.cancelEditFolder()">Cancel</button>`;
+        html += `<button class="btn btn-primary btn-sm" data-action="saveEditFolder" data-index="${index}">Save</button>`;
+        html += `<button class="btn btn-secondary btn-sm" data-action="cancelEditFolder">Cancel</button>`;
         html += `</div></div>`;
         return html;
     }
@@ -412,7 +511,7 @@ class MarkHub {
         }
 
         try {
-            const response = await fetch('/api/folders', {
+            const response = await fetch('/api/v1/folders', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ path, alias, git_ref, sub_path, exclude })
@@ -463,10 +562,10 @@ class MarkHub {
         const exclude = excludeStr ? excludeStr.split(',').map(s => s.trim()).filter(Boolean) : [];
 
         try {
-            const response = await fetch('/api/folders', {
+            const response = await fetch('/api/v1/folders', {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ index, alias, git_ref, sub_path, exclude })
+                body: JSON.stringify({ id: folder.id, alias, git_ref, sub_path, exclude })
             });
 
             const data = await response.json();
@@ -490,13 +589,15 @@ class MarkHub {
     }
 
     async removeFolder(index) {
+        const folder = this.folders[index];
+        if (!folder) return;
         if (!confirm('Remove this folder from MarkHub?')) return;
 
         try {
-            const response = await fetch('/api/folders', {
+            const response = await fetch('/api/v1/folders', {
                 method: 'DELETE',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ index })
+                body: JSON.stringify({ id: folder.id })
             });
 
             const data = await response.json();
@@ -513,12 +614,43 @@ class MarkHub {
         }
     }
 
+    async restartServer() {
+        if (!confirm('Restart the MarkHub server?')) return;
+
+        try {
+            const response = await fetch('/api/v1/admin/restart', { method: 'POST' });
+            if (!response.ok) {
+                const data = await response.json();
+                alert(data.error || 'Failed to restart server');
+                return;
+            }
+        } catch (error) {
+            console.error('Failed to restart server:', error);
+            return;
+        }
+
+        // Wait for the new process to come up, then reload to pick up any changes
+        for (let attempt = 0; attempt < 60; attempt++) {
+            await new Promise(resolve => setTimeout(resolve, 500));
+            try {
+                const health = await fetch('/api/v1/health', { cache: 'no-store' });
+                if (health.ok) {
+                    window.location.reload();
+                    return;
+                }
+            } catch (error) {
+                // Server is still restarting
+            }
+        }
+        alert('Server did not come back after restarting');
+    }
+
     async saveGlobalExclude() {
         const textarea = document.getElementById('globalExclude');
         const patterns = textarea.value.split('\n').map(s => s.trim()).filter(Boolean);
 
         try {
-            const response = await fetch('/api/exclude', {
+            const response = await fetch('/api/v1/exclude', {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ exclude: patterns })
@@ -549,7 +681,7 @@ class MarkHub {
         const exclude = excludeStr ? excludeStr.split(',').map(s => s.trim()).filter(Boolean) : [];
 
         try {
-            const response = await fetch('/api/repo-exclude', {
+            const response = await fetch('/api/v1/repo-exclude', {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ path: repoPath, exclude })
@@ -580,7 +712,7 @@ class MarkHub {
     // ========================================
     async loadFileTree() {
         try {
-            const response = await fetch('/api/tree');
+            const response = await fetch('/api/v1/tree');
             if (!response.ok) throw new Error('Failed to load file tree');
             const tree = await response.json();
             this.renderFileTree(tree);
@@ -615,11 +747,25 @@ class MarkHub {
                 const childrenContainer = item.querySelector('.tree-children');
                 node.children.forEach(child => this.renderFileTree(child, childrenContainer));
             }
+            if (node.emptyReason) {
+                const hint = document.createElement('div');
+                hint.className = 'tree-empty';
+                hint.textContent = this.emptyFolderHint(node.emptyReason);
+                item.querySelector('.tree-children').appendChild(hint);
+            }
         } else if (node.type === 'file') {
             container.appendChild(this.createTreeItem(node, false, false));
         }
     }
 
+    emptyFolderHint(reason) {
+        switch (reason) {
+            case 'all_excluded': return 'All documents are hidden by exclude patterns. Check the folder settings.';
+            case 'no_markdown': return 'No markdown files in this folder.';
+            default: return 'This folder is empty.';
+        }
+    }
+
     createTreeItem(node, isDir, isRootFolder = false) {
         const item = document.createElement('div');
         const isRepoGroup = node.isRepoGroup === true;
@@ -696,7 +842,7 @@ class MarkHub {
     // ========================================
     async loadFile(path, updateHistory = true) {
         try {
-            const response = await fetch(`/api/files/${encodeURIComponent(path)}`);
+            const response = await fetch(`/api/v1/files/${encodeURIComponent(path)}`);
             if (!response.ok) throw new Error('Failed to load file');
 
             const data = await response.json();
@@ -740,6 +886,38 @@ class MarkHub {
         const content = document.getElementById('content');
         content.innerHTML = `<div class="markdown-body">${data.html}</div>`;
         this.renderMermaidBlocks();
+        this.bindTasks(data);
+    }
+
+    // Task list checkboxes save their state unless the server is read-only. They are matched to
+    // data.tasks by position, so a document whose HTML has other checkboxes keeps them all disabled.
+    bindTasks(data) {
+        const boxes = document.querySelectorAll('#content .markdown-body li input[type="checkbox"]');
+        const tasks = data.tasks || [];
+        if (boxes.length !== tasks.length || (this.capabilities && !this.capabilities.write)) return;
+        const path = this.currentPath;
+        boxes.forEach((box, i) => {
+            box.disabled = false;
+            box.addEventListener('change', async () => {
+                try {
+                    const response = await fetch(`/api/v1/tasks/${encodeURIComponent(path)}`, {
+                        method: 'PATCH',
+                        headers: { 'Content-Type': 'application/json', 'X-Client-ID': this.clientId },
+                        body: JSON.stringify({
+                            sourceOffset: tasks[i].offset,
+                            checked: box.checked,
+                            ifMatch: data.etag,
+                        }),
+                    });
+                    if (!response.ok) throw new Error(`HTTP ${response.status}`);
+                    if (this.currentPath === path) this.renderContent(await response.json());
+                } catch (error) {
+                    console.error('Failed to save task:', error);
+                    this.showError('Failed to save the task; the document may have changed');
+                    this.loadFile(path, false);
+                }
+            });
+        });
     }
 
     renderBreadcrumb(path, folderId) {
@@ -747,8 +925,9 @@ class MarkHub {
         const parts = path.split('/');
 
         // Replace folder ID with alias if available
-        if (this.folders.length > 0 && folderId !== undefined && folderId < this.folders.length) {
-            parts[0] = this.folders[folderId].alias;
+        const folder = this.folders.find(f => f.id === folderId);
+        if (folder) {
+            parts[0] = folder.alias;
         }
 
         breadcrumb.innerHTML = parts.map((part, i) => {
@@ -830,7 +1009,7 @@ class MarkHub {
     // ========================================
     initWebSocket() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/api/ws`;
+        const wsUrl = `${protocol}//${window.location.host}/api/v1/ws?clientId=${encodeURIComponent(this.clientId)}`;
 
         try {
             this.ws = new WebSocket(wsUrl);
@@ -859,6 +1038,16 @@ class MarkHub {
     }
 
     handleWSMessage(message) {
+        if (message.type === 'settingsChanged') {
+            this.applyBranding(message.payload);
+            return;
+        }
+
+        if (message.type === 'treeChanged') {
+            this.loadFileTree();
+            return;
+        }
+
         if (message.type === 'fileChange') {
             const { event, path } = message.payload;
 
@@ -909,6 +1098,22 @@ class MarkHub {
         const hash = window.location.hash.slice(1);
         if (hash) {
             this.loadFile(hash, false);
+        } else {
+            this.loadHomeDoc();
+        }
+    }
+
+    // The configured home document replaces the welcome page; without one (204) it stays
+    async loadHomeDoc() {
+        try {
+            const response = await fetch('/api/v1/home-doc');
+            if (response.status !== 200) return;
+            const data = await response.json();
+            this.currentPath = data.path;
+            this.renderContent(data);
+            this.renderTOC(data.toc);
+        } catch (error) {
+            console.error('Failed to load the home document:', error);
         }
     }
 
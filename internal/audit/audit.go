@@ -0,0 +1,146 @@
+// Package audit records configuration-changing API calls and file writes to a durable JSON-lines log.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MaxSize is the size past which the log is rotated: it is renamed with a ".1" suffix, replacing
+// the previous rotation, so the log never takes more than about twice this much disk
+const MaxSize = 10 << 20
+
+// loggers holds the Logger of each path, so handlers auditing to the same file share its lock
+var (
+	loggersMu sync.Mutex
+	loggers   = map[string]*Logger{}
+)
+
+// Entry is a single audit record. Configuration changes carry the state before and after the
+// change; file writes carry the alias-prefixed path and the number of bytes written.
+type Entry struct {
+	Time      time.Time   `json:"time"`
+	Action    string      `json:"action"`
+	RequestID string      `json:"requestId,omitempty"`
+	ClientIP  string      `json:"clientIp,omitempty"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+	Path      string      `json:"path,omitempty"`
+	Bytes     int         `json:"bytes,omitempty"`
+}
+
+// Logger appends audit entries to a file. A nil or unconfigured Logger discards entries.
+type Logger struct {
+	path    string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+// New returns the Logger writing to path; an empty path disables auditing. Loggers are shared:
+// every call with the same path returns the same one.
+func New(path string) *Logger {
+	if path == "" {
+		return nil
+	}
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	if l, ok := loggers[path]; ok {
+		return l
+	}
+	l := &Logger{path: path, maxSize: MaxSize}
+	loggers[path] = l
+	return l
+}
+
+// Record appends an entry. Failures are logged as warnings and never returned,
+// so auditing can't block the request being audited.
+func (l *Logger) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Warning: failed to encode audit entry: %v", err)
+		return
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		log.Printf("Warning: failed to write audit log: %v", err)
+		return
+	}
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(data)) > l.maxSize {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			log.Printf("Warning: failed to rotate audit log: %v", err)
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Warning: failed to write audit log: %v", err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(data); err != nil {
+		log.Printf("Warning: failed to write audit log: %v", err)
+	}
+}
+
+// Recent returns the last limit entries, newest first, reading the rotated log too when the
+// current one holds fewer. Lines that do not decode are skipped. A nil Logger has no entries.
+func (l *Logger) Recent(limit int) ([]Entry, error) {
+	if l == nil || limit <= 0 {
+		return nil, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []Entry
+	for _, path := range []string{l.path, l.path + ".1"} {
+		older, err := readEntries(path)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(older) - 1; i >= 0 && len(entries) < limit; i-- {
+			entries = append(entries, older[i])
+		}
+		if len(entries) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// readEntries decodes the entries of the log file at path, oldest first; a missing file has none
+func readEntries(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxSize)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecord_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.log")
+	l := New(path)
+
+	l.Record(Entry{Action: "folder.add", ClientIP: "127.0.0.1", After: map[string]string{"alias": "docs"}})
+	l.Record(Entry{Action: "folder.remove", RequestID: "abc"})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var actions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		if e.Time.IsZero() {
+			t.Error("expected timestamp to be set")
+		}
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 2 || actions[0] != "folder.add" || actions[1] != "folder.remove" {
+		t.Errorf("unexpected actions %v", actions)
+	}
+}
+
+func TestRecord_Disabled(t *testing.T) {
+	l := New("")
+	if l != nil {
+		t.Fatal("expected nil logger for empty path")
+	}
+	// Must not panic
+	l.Record(Entry{Action: "folder.add"})
+}
+
+func TestRecord_UnwritablePathDoesNotPanic(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	New(filepath.Join(blocker, "audit.log")).Record(Entry{Action: "folder.add"})
+}
+
+func TestNew_SharesLoggerPerPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if New(path) != New(path) {
+		t.Error("expected one logger per path")
+	}
+}
+
+func TestRecent_SpansRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := New(path)
+	l.maxSize = 200
+
+	for _, action := range []string{"a", "b", "c", "d", "e"} {
+		l.Record(Entry{Action: action, Path: "docs/guide.md", Bytes: 12})
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected the log to be rotated: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > l.maxSize {
+		t.Fatalf("expected the current log to stay under the limit: %v", err)
+	}
+
+	entries, err := l.Recent(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 3 || actions[0] != "e" || actions[1] != "d" || actions[2] != "c" {
+		t.Errorf("expected the newest three entries first, got %v", actions)
+	}
+	if entries[0].Path != "docs/guide.md" || entries[0].Bytes != 12 {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+}
+
+func TestRecent_Empty(t *testing.T) {
+	entries, err := New(filepath.Join(t.TempDir(), "audit.log")).Recent(10)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries, got %v, %v", entries, err)
+	}
+	var disabled *Logger
+	if entries, err := disabled.Recent(10); err != nil || entries != nil {
+		t.Errorf("expected no entries from a disabled logger, got %v, %v", entries, err)
+	}
+}
@@ -2,23 +2,443 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
 	"gopkg.in/yaml.v3"
 )
 
 // Folder represents a folder with an alias for display
 type Folder struct {
+	// Stable identifier assigned when the folder is first configured; survives reordering and removals
+	ID      string   `yaml:"id,omitempty" json:"id"`
 	Path    string   `yaml:"path" json:"path"`
 	Alias   string   `yaml:"alias" json:"alias"`
 	GitRef  string   `yaml:"git_ref,omitempty" json:"git_ref,omitempty"`
 	SubPath string   `yaml:"sub_path,omitempty" json:"sub_path,omitempty"`
 	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// How raw HTML in this folder's markdown is rendered: "unsafe" (default), "sanitize" or "strip"
+	HTMLMode string `yaml:"html_mode,omitempty" json:"html_mode,omitempty"`
+	// Writable folders accept file writes through the API; git_ref folders never do, and neither does
+	// any folder when the server is read-only
+	Writable bool `yaml:"writable,omitempty" json:"writable"`
+	// AutoCommit commits every change made through the API when the folder is in a git working tree
+	AutoCommit bool `yaml:"auto_commit,omitempty" json:"auto_commit,omitempty"`
+	// Description is shown for the folder on the home page (GET /api/home); without it the first
+	// paragraph of the folder's root README is used
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+
+	// Temporary folders are added for a single session (e.g. `markhub ./notes.md`) and never saved
+	Temporary bool `yaml:"-" json:"temporary,omitempty"`
+}
+
+// CanWrite reports whether files in the folder may be saved through the API, leaving aside the
+// server's read_only
+func (f Folder) CanWrite() bool {
+	return f.GitRef == "" && f.Writable
+}
+
+// Branding customizes how an instance presents itself in the browser
+type Branding struct {
+	Title       string `yaml:"title,omitempty" json:"title,omitempty"`
+	AccentColor string `yaml:"accent_color,omitempty" json:"accent_color,omitempty"`
+	LogoPath    string `yaml:"logo_path,omitempty" json:"logo_path,omitempty"`
+	// FaviconPath is a local image served at /favicon.ico, or an http(s) URL
+	FaviconPath string `yaml:"favicon,omitempty" json:"favicon,omitempty"`
+}
+
+// SearchConfig bounds the cost of full-text search requests
+type SearchConfig struct {
+	// MaxResults is the hard cap on the results returned per page
+	MaxResults int `yaml:"max_results,omitempty" json:"max_results,omitempty"`
+	// TimeBudget is the soft limit after which scanning stops and partial results are returned
+	TimeBudget time.Duration `yaml:"time_budget,omitempty" json:"time_budget,omitempty"`
+	// Workers is the number of files scanned concurrently
+	Workers int `yaml:"workers,omitempty" json:"workers,omitempty"`
+	// Index keeps a trigram index of each folder under GetSearchIndexDir, so searches only read the
+	// files that may match. It is built on the first search and kept current from watcher events.
+	Index bool `yaml:"index,omitempty" json:"index,omitempty"`
+	// IndexOnStart builds the indexes when the server starts instead of on the first search
+	IndexOnStart bool `yaml:"index_on_start,omitempty" json:"index_on_start,omitempty"`
+	// CJKNgram is the length in characters of the n-grams that runs of Chinese, Japanese and Korean
+	// characters in a query are matched by; 0 means 2
+	CJKNgram int `yaml:"cjk_ngram,omitempty" json:"cjk_ngram,omitempty"`
+}
+
+// RenderConfig toggles optional rendering features of the web UI
+type RenderConfig struct {
+	// Mermaid draws ```mermaid code blocks as diagrams with the bundled mermaid library
+	Mermaid bool `yaml:"mermaid" json:"mermaid"`
+	// CodeLanguage decides how code fences without a language are highlighted: "plaintext" (the
+	// default) leaves them plain, "auto" lets Chroma guess, any other value names the language to assume
+	CodeLanguage string `yaml:"code_language,omitempty" json:"code_language,omitempty"`
+	// ExternalImages decides what happens to images from other hosts: "allow" (the default) loads
+	// them directly, "block" drops them and "proxy" serves them through the image proxy endpoint
+	ExternalImages string `yaml:"external_images,omitempty" json:"external_images,omitempty"`
+	// ImageHosts ("example.com", "*.example.com") still load directly when external images are
+	// blocked, and are the only hosts the proxy fetches from when set
+	ImageHosts []string `yaml:"image_hosts,omitempty" json:"image_hosts,omitempty"`
+	// ImageProxyMaxSize caps the size of a proxied image in bytes; 0 means 10 MiB
+	ImageProxyMaxSize int64 `yaml:"image_proxy_max_size,omitempty" json:"image_proxy_max_size,omitempty"`
+	// NormalizeWhitespace renders documents with line endings turned into "\n", zero-width spaces
+	// removed and no-break spaces made spaces. Raw content is still served byte for byte.
+	NormalizeWhitespace bool `yaml:"normalize_whitespace,omitempty" json:"normalize_whitespace,omitempty"`
+	// AnchorPrefix is put before the generated heading ids ("mh-" gives "mh-introduction"), the TOC
+	// anchors and the links to them, for embedding rendered HTML in another page. Empty means none.
+	AnchorPrefix string `yaml:"anchor_prefix,omitempty" json:"anchor_prefix,omitempty"`
+	// DisabledExtensions turns GitHub Flavored Markdown extensions off: "autolinks" (bare URLs
+	// become links), "tables", "strikethrough" and "task_lists". All are on by default.
+	DisabledExtensions []string `yaml:"disabled_extensions,omitempty" json:"disabled_extensions,omitempty"`
+	// Diagrams decides where the fences of DiagramCommands are drawn: "client" (the default) leaves
+	// mermaid to the web UI and math undrawn, "server" runs the commands and inlines the SVG they
+	// make, so that feeds, exports and printouts show the drawings too
+	Diagrams string `yaml:"diagrams,omitempty" json:"diagrams,omitempty"`
+	// DiagramCommands maps fence languages ("mermaid", "math") to the command drawing them as SVG:
+	// words separated by spaces, in which {file} stands for a temporary file holding the fence's
+	// content and {output}, when present, for the SVG file to write; otherwise SVG is read from stdout
+	DiagramCommands map[string]string `yaml:"diagram_commands,omitempty" json:"diagram_commands,omitempty"`
+	// DiagramTimeout caps the drawing of one fence; 0 means 10 seconds
+	DiagramTimeout time.Duration `yaml:"diagram_timeout,omitempty" json:"diagram_timeout,omitempty"`
+}
+
+// GitConfig sets up the commits made for folders with auto_commit
+type GitConfig struct {
+	// CommitMessage is the message template; {{action}} (edit, create, delete, move, restore, upload)
+	// and {{path}} (relative to the folder) are filled in. Empty means "markhub: {{action}} {{path}}".
+	CommitMessage string `yaml:"commit_message,omitempty" json:"commit_message,omitempty"`
+	// AuthorName and AuthorEmail identify the commits; empty means MarkHub <markhub@localhost>
+	AuthorName  string `yaml:"author_name,omitempty" json:"author_name,omitempty"`
+	AuthorEmail string `yaml:"author_email,omitempty" json:"author_email,omitempty"`
+}
+
+// Events a webhook can subscribe to
+const (
+	WebhookEventCreate = "create"
+	WebhookEventUpdate = "update"
+	WebhookEventRemove = "remove"
+)
+
+// Payload templates of a webhook
+const (
+	// WebhookTemplateGeneric posts the event as JSON, signed when a secret is set (the default)
+	WebhookTemplateGeneric = "generic"
+	// WebhookTemplateSlack posts a message for a Slack incoming webhook
+	WebhookTemplateSlack = "slack"
+)
+
+// Webhook posts the changes the file watcher reports in local folders to a URL
+type Webhook struct {
+	URL string `yaml:"url" json:"url"`
+	// Events are the changes posted; empty means all of them
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"`
+	// FolderIDs limits the webhook to these folders; empty means every folder
+	FolderIDs []string `yaml:"folder_ids,omitempty" json:"folder_ids,omitempty"`
+	// Secret signs generic payloads with an HMAC-SHA256 of the body
+	Secret   string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	Template string `yaml:"template,omitempty" json:"template,omitempty"`
+	// BaseURL starts the viewer links in payloads; empty means the server's local address
+	BaseURL string `yaml:"base_url,omitempty" json:"base_url,omitempty"`
+}
+
+// validate checks the URL, events and template of the webhook
+func (w Webhook) validate() error {
+	for _, v := range []string{w.URL, w.BaseURL} {
+		u, err := url.Parse(v)
+		if v != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			return fmt.Errorf("invalid URL %q (expected an http or https URL)", v)
+		}
+	}
+	if w.URL == "" {
+		return errors.New("url is required")
+	}
+	for _, event := range w.Events {
+		switch event {
+		case WebhookEventCreate, WebhookEventUpdate, WebhookEventRemove:
+		default:
+			return fmt.Errorf("invalid event %q (expected %q, %q or %q)",
+				event, WebhookEventCreate, WebhookEventUpdate, WebhookEventRemove)
+		}
+	}
+	switch w.Template {
+	case "", WebhookTemplateGeneric, WebhookTemplateSlack:
+	default:
+		return fmt.Errorf("invalid template %q (expected %q or %q)",
+			w.Template, WebhookTemplateGeneric, WebhookTemplateSlack)
+	}
+	return nil
+}
+
+// ExcludeRule hides files from the tree by size or modification time. The conditions set in a
+// rule must all hold; a file matching any rule is hidden.
+type ExcludeRule struct {
+	// Pattern limits the rule to paths matching it, like a folder exclude; empty matches any file
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	// SizeGT matches files larger than this many bytes
+	SizeGT int64 `yaml:"size_gt,omitempty" json:"size_gt,omitempty"`
+	// ModifiedBefore and ModifiedAfter match files last modified before or after a date
+	// ("2024-01-31" or RFC 3339) or an age ("720h", "90d") counted back from now
+	ModifiedBefore string `yaml:"modified_before,omitempty" json:"modified_before,omitempty"`
+	ModifiedAfter  string `yaml:"modified_after,omitempty" json:"modified_after,omitempty"`
+}
+
+// validate checks that the rule has a condition and that its times parse
+func (r ExcludeRule) validate() error {
+	if r.SizeGT <= 0 && r.ModifiedBefore == "" && r.ModifiedAfter == "" {
+		return errors.New("needs size_gt, modified_before or modified_after")
+	}
+	for _, v := range []string{r.ModifiedBefore, r.ModifiedAfter} {
+		if _, err := ruleTime(v, time.Now()); v != "" && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches reports whether a file at relPath (relative to its folder) with the given size and
+// modification time meets every condition of the rule
+func (r ExcludeRule) matches(relPath string, size int64, modTime, now time.Time) bool {
+	if r.Pattern != "" && !matchesExclude(relPath, r.Pattern) {
+		return false
+	}
+	if r.SizeGT > 0 && size <= r.SizeGT {
+		return false
+	}
+	if r.ModifiedBefore != "" {
+		before, err := ruleTime(r.ModifiedBefore, now)
+		if err != nil || !modTime.Before(before) {
+			return false
+		}
+	}
+	if r.ModifiedAfter != "" {
+		after, err := ruleTime(r.ModifiedAfter, now)
+		if err != nil || !modTime.After(after) {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleTime parses an exclude rule time: a date, an RFC 3339 timestamp, or an age before now as a
+// Go duration or a number of days ("90d")
+func ruleTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected a date, an RFC 3339 timestamp or an age such as 90d)", v)
+}
+
+// AssetsConfig controls images uploaded next to documents through the API
+type AssetsConfig struct {
+	// Dir is the subdirectory of the document's directory uploads are written to; empty means "assets"
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// MaxSize caps an uploaded image in bytes; 0 means 10 MiB
+	MaxSize int64 `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	// StripMetadata removes EXIF metadata (camera, GPS location) from uploaded JPEG and PNG images
+	StripMetadata bool `yaml:"strip_metadata,omitempty" json:"strip_metadata,omitempty"`
+	// VariantCacheSize caps in bytes the resized images (GET /assets/...?w=) kept under
+	// GetAssetCacheDir, the least recently used going first; 0 means 256 MiB, -1 keeps none
+	VariantCacheSize int64 `yaml:"variant_cache_size,omitempty" json:"variant_cache_size,omitempty"`
+}
+
+// BookConfig controls book mode, which renders a chain of documents as one page (GET /book)
+type BookConfig struct {
+	// OrderFile names a file which, found in the start document's directory, lists the chapters
+	// as links in reading order; otherwise chapters follow the "next" key of their front matter
+	OrderFile string `yaml:"order_file,omitempty" json:"order_file,omitempty"`
+	// MaxDocuments caps the chapters of a book; 0 means 100
+	MaxDocuments int `yaml:"max_documents,omitempty" json:"max_documents,omitempty"`
+}
+
+// AnalyticsConfig controls the per-document view counters (GET /analytics/...). Only counts per
+// document and day are kept, never who viewed a document.
+type AnalyticsConfig struct {
+	// Enabled counts the documents rendered through GET /files
+	Enabled bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// RetentionDays bounds how many days of counts are kept; 0 means 90
+	RetentionDays int `yaml:"retention_days,omitempty" json:"retention_days,omitempty"`
+	// File stores the counts; empty means analytics.json next to the config file, or memory only
+	// for sessions that do not save their config
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+// LintConfig tunes the markdown lint (GET /lint/...) and the orphan report
+type LintConfig struct {
+	// DisabledRules names the rules not checked, out of markdown.LintRules ("single-h1",
+	// "broken-link"...). All are checked by default.
+	DisabledRules []string `yaml:"disabled_rules,omitempty" json:"disabled_rules,omitempty"`
+	// EntryPoints are file name patterns ("README.*"), matched case-insensitively, of documents
+	// the orphan report (GET /lint-report/orphans) does not expect links to; empty means README.* and index.*
+	EntryPoints []string `yaml:"entry_points,omitempty" json:"entry_points,omitempty"`
+	// Commands maps tool names to the command lines of external linters run by GET /lint-run/...:
+	// words separated by spaces, in which {file} stands for a temporary copy of the document, such
+	// as "vale --output JSON {file}"
+	Commands map[string]string `yaml:"commands,omitempty" json:"commands,omitempty"`
+	// CommandTimeout caps a run of one of the commands; 0 means 20 seconds
+	CommandTimeout time.Duration `yaml:"command_timeout,omitempty" json:"command_timeout,omitempty"`
+}
+
+// CacheConfig sets the Cache-Control header of responses by content category. An unset category
+// keeps the default: "no-cache" for html, no header for the others; "none" sends no header.
+// Content-addressed URLs are always cached as immutable.
+type CacheConfig struct {
+	// HTML covers rendered documents: the web interface page, GET /files and GET /print
+	HTML string `yaml:"html,omitempty" json:"html,omitempty"`
+	// Raw covers files served by GET /raw
+	Raw string `yaml:"raw,omitempty" json:"raw,omitempty"`
+	// Asset covers the scripts, images and fonts of the web interface
+	Asset string `yaml:"asset,omitempty" json:"asset,omitempty"`
+	// CSS covers the stylesheets of the web interface
+	CSS string `yaml:"css,omitempty" json:"css,omitempty"`
+}
+
+// Cache-Control directives cache.* may use, and whether they take a number of seconds
+var cacheDirectives = map[string]bool{
+	"public": false, "private": false, "no-cache": false, "no-store": false, "no-transform": false,
+	"must-revalidate": false, "proxy-revalidate": false, "must-understand": false, "immutable": false,
+	"max-age": true, "s-maxage": true, "stale-while-revalidate": true, "stale-if-error": true,
+}
+
+// HTMLControl returns the Cache-Control value of rendered documents, "" for none
+func (c CacheConfig) HTMLControl() string { return cacheControl(c.HTML, "no-cache") }
+
+// RawControl returns the Cache-Control value of raw files, "" for none
+func (c CacheConfig) RawControl() string { return cacheControl(c.Raw, "") }
+
+// AssetControl returns the Cache-Control value of web interface assets, "" for none
+func (c CacheConfig) AssetControl() string { return cacheControl(c.Asset, "") }
+
+// CSSControl returns the Cache-Control value of web interface stylesheets, "" for none
+func (c CacheConfig) CSSControl() string { return cacheControl(c.CSS, "") }
+
+// cacheControl returns the configured value, or def when unset
+func cacheControl(value, def string) string {
+	switch value {
+	case "":
+		return def
+	case "none":
+		return ""
+	}
+	return value
+}
+
+// validate checks that every category holds "none" or comma-separated known directives
+func (c CacheConfig) validate() error {
+	for _, category := range []struct{ name, value string }{
+		{"html", c.HTML}, {"raw", c.Raw}, {"asset", c.Asset}, {"css", c.CSS},
+	} {
+		if category.value == "" || category.value == "none" {
+			continue
+		}
+		for _, directive := range strings.Split(category.value, ",") {
+			name, arg, hasArg := strings.Cut(strings.TrimSpace(directive), "=")
+			name = strings.ToLower(name)
+			seconds, known := cacheDirectives[name]
+			switch {
+			case !known:
+				return fmt.Errorf("cache.%s: unknown directive %q", category.name, name)
+			case !seconds && hasArg:
+				return fmt.Errorf("cache.%s: directive %q takes no value", category.name, name)
+			case seconds:
+				if n, err := strconv.Atoi(arg); err != nil || n < 0 {
+					return fmt.Errorf("cache.%s: invalid %s %q (expected seconds)", category.name, name, arg)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PandocConfig sets up the conversion of documents by pandoc (GET /export/pandoc)
+type PandocConfig struct {
+	// Path is the pandoc binary, looked up in PATH when it holds no slash; empty means "pandoc"
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Formats lists the output formats offered, out of PandocFormats; empty means docx and odt
+	Formats []string `yaml:"formats,omitempty" json:"formats,omitempty"`
+	// Timeout caps a conversion; 0 means 1 minute
+	Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// MaxOutputSize caps a converted document in bytes; 0 means 50 MiB
+	MaxOutputSize int64 `yaml:"max_output_size,omitempty" json:"max_output_size,omitempty"`
 }
 
+// PandocFormat is an output format pandoc.formats may offer
+type PandocFormat struct {
+	Extension   string
+	ContentType string
+}
+
+// PandocFormats are the output formats pandoc.formats may list, by pandoc writer name
+var PandocFormats = map[string]PandocFormat{
+	"docx": {".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	"odt":  {".odt", "application/vnd.oasis.opendocument.text"},
+	"epub": {".epub", "application/epub+zip"},
+	"rtf":  {".rtf", "application/rtf"},
+}
+
+// SecurityConfig tunes the security headers sent with every response
+type SecurityConfig struct {
+	// CSP replaces the Content-Security-Policy assembled from the enabled features
+	CSP string `yaml:"csp,omitempty" json:"csp,omitempty"`
+}
+
+// Supported folder html_mode values.
+const (
+	HTMLModeUnsafe   = "unsafe"
+	HTMLModeSanitize = "sanitize"
+	HTMLModeStrip    = "strip"
+)
+
+// Supported render.external_images values.
+const (
+	ExternalImagesAllow = "allow"
+	ExternalImagesBlock = "block"
+	ExternalImagesProxy = "proxy"
+)
+
+// Supported render.diagrams values.
+const (
+	DiagramsClient = "client"
+	DiagramsServer = "server"
+)
+
+// Supported overlapping_folders values.
+const (
+	OverlappingFoldersWarn   = "warn"
+	OverlappingFoldersReject = "reject"
+	OverlappingFoldersHide   = "hide"
+)
+
+// Supported watch modes.
+const (
+	WatchModeFSNotify = "fsnotify"
+	WatchModePoll     = "poll"
+)
+
 // Config holds all configuration options for MarkHub
 type Config struct {
 	// Legacy single path (for backward compatibility)
@@ -30,17 +450,128 @@ type Config struct {
 	Port       int      `yaml:"port"`
 	Theme      string   `yaml:"theme"`
 	Watch      bool     `yaml:"watch"`
-	Open       bool     `yaml:"open"`
+	Open       bool     `yaml:"-"`
 	Extensions []string `yaml:"extensions"`
 	Exclude    []string `yaml:"exclude"`
 
+	// Files without an extension treated as markdown, by name, matched case-insensitively
+	// (e.g. CHANGELOG, LICENSE)
+	ExtensionlessFiles []string `yaml:"extensionless_files,omitempty"`
+
+	// Files hidden from the tree by size or age, in addition to the Exclude patterns
+	ExcludeRules []ExcludeRule `yaml:"exclude_rules,omitempty"`
+
+	// Directories with more entries are cut short in the tree, their node marked truncated; 0 uses
+	// DefaultMaxDirEntries, a negative value disables the limit
+	MaxDirEntries int `yaml:"max_dir_entries,omitempty"`
+
+	// Caps the folders AddFolder accepts, guarding against runaway additions through the API; 0 uses
+	// DefaultMaxFolders, a negative value disables the limit
+	MaxFolders int `yaml:"max_folders,omitempty"`
+
+	// What to do about local folders whose roots overlap, such as /repo and /repo/docs:
+	// "warn" (default), "reject" them, or "hide" the nested one from the tree
+	OverlappingFolders string `yaml:"overlapping_folders,omitempty"`
+
+	// Alias-prefixed document opened in the browser on startup instead of the root. Like Open it
+	// comes from the command line only and is never saved.
+	OpenPath string `yaml:"-"`
+
+	// Render every document into the parse cache in the background on startup (--prewarm); command
+	// line only
+	Prewarm bool `yaml:"-"`
+
+	// Explicit listen addresses (host:port); when set they replace the port/--expose binding
+	Listen []string `yaml:"listen,omitempty"`
+
+	// Reverse proxies (IPs or CIDRs) whose X-Forwarded-For/-Proto/-Host headers are trusted
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+
+	// Deadline for a single API request (WebSocket excluded); 0 disables it
+	RequestTimeout time.Duration `yaml:"request_timeout,omitempty"`
+
+	// Caps the body of an API request in bytes; 0 means 1 MiB. File writes are capped by
+	// MaxWriteBody instead, and image uploads by assets.max_size.
+	MaxRequestBody int64 `yaml:"max_request_body,omitempty"`
+	// Caps the body of a file write in bytes; 0 means 10 MiB
+	MaxWriteBody int64 `yaml:"max_write_body,omitempty"`
+
+	// Watch mode: "fsnotify" (default) or "poll" for filesystems without inotify support
+	WatchMode    string        `yaml:"watch_mode,omitempty"`
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
+
+	Branding Branding `yaml:"branding,omitempty"`
+
+	// Alias-prefixed markdown document shown at the app root (GET /api/home-doc), e.g.
+	// "Docs/index.md"; empty shows the folder list
+	HomeDocument string `yaml:"home_document,omitempty"`
+
+	Search SearchConfig `yaml:"search,omitempty"`
+
+	Render    RenderConfig    `yaml:"render"`
+	Assets    AssetsConfig    `yaml:"assets,omitempty"`
+	Book      BookConfig      `yaml:"book,omitempty"`
+	Pandoc    PandocConfig    `yaml:"pandoc,omitempty"`
+	Analytics AnalyticsConfig `yaml:"analytics,omitempty"`
+	Lint      LintConfig      `yaml:"lint,omitempty"`
+	Cache     CacheConfig     `yaml:"cache,omitempty"`
+	Security  SecurityConfig  `yaml:"security,omitempty"`
+	Git       GitConfig       `yaml:"git,omitempty"`
+
+	// Outbound webhooks posting file changes reported by the watcher
+	Webhooks []Webhook `yaml:"webhooks,omitempty"`
+
+	// Named skeletons for files created through the API (POST /api/files?template=<name>);
+	// {{title}}, {{date}} and {{time}} are filled in
+	Templates map[string]string `yaml:"templates,omitempty"`
+
+	// Audit log of configuration-changing API calls and file writes (JSON lines); empty uses
+	// GetAuditLogPath's default, "off" disables auditing
+	AuditLog string `yaml:"audit_log,omitempty"`
+
+	// Log file for server output (defaults to stderr; background mode uses GetLogPath)
+	LogFile string `yaml:"log_file,omitempty"`
+
+	// Releases endpoint checked by `markhub update` (GitHub releases API format); empty uses GitHub
+	UpdateURL string `yaml:"update_url,omitempty"`
+
+	// Token required from non-loopback clients (Authorization: Bearer, cookie, or ?token=)
+	AuthToken string `yaml:"auth_token,omitempty"`
+
+	// Network exposure is a launch-time decision (--expose), never persisted
+	Expose         bool `yaml:"-"`
+	ExposeInsecure bool `yaml:"-"`
+
+	// Ephemeral sessions (--no-save, or --path) keep config changes in memory only
+	Ephemeral bool `yaml:"-"`
+
+	// Read-only mode rejects every state-changing API call (folders, settings, admin)
+	ReadOnly bool `yaml:"read_only,omitempty"`
+
 	// Repo-level excludes keyed by absolute repo path
 	RepoExclude map[string][]string `yaml:"repo_exclude,omitempty" json:"repo_exclude,omitempty"`
 
 	// Internal: path to config file for saving
 	configPath string
+
+	// Internal: guards Folders, Exclude, RepoExclude and Branding, which the API changes while
+	// handlers and watchers read them. Mutations replace Folders rather than editing it in place.
+	mu sync.RWMutex
+
+	// Internal: auth_token from the config file, kept when AuthTokenEnv overrides it so Save never writes the env token
+	fileAuthToken    string
+	authTokenFromEnv bool
+
+	// Internal: --port was passed explicitly, which conflicts with a configured listen list
+	portFromFlag bool
 }
 
+// DefaultMaxDirEntries is the max_dir_entries used when it is not set
+const DefaultMaxDirEntries = 50000
+
+// DefaultMaxFolders is the max_folders used when it is not set
+const DefaultMaxFolders = 1000
+
 // DefaultConfig returns a configuration with default values
 func DefaultConfig() *Config {
 	return &Config{
@@ -51,6 +582,13 @@ func DefaultConfig() *Config {
 		Open:       false,
 		Extensions: []string{".md", ".markdown"},
 		Exclude:    []string{"node_modules", ".git", ".svn"},
+		Search: SearchConfig{
+			MaxResults: 100,
+			TimeBudget: 2 * time.Second,
+			Workers:    8,
+		},
+		RequestTimeout: 30 * time.Second,
+		Render:         RenderConfig{Mermaid: true},
 	}
 }
 
@@ -68,6 +606,73 @@ func GetConfigPath() string {
 	return filepath.Join(GetConfigDir(), "config.yaml")
 }
 
+// GetCacheDir returns the directory of data markhub can rebuild, such as search indexes
+func GetCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(GetConfigDir(), "cache")
+	}
+	return filepath.Join(dir, "markhub")
+}
+
+// GetSearchIndexDir returns the directory search indexes are saved to
+func GetSearchIndexDir() string {
+	return filepath.Join(GetCacheDir(), "search")
+}
+
+// GetAssetCacheDir returns the directory resized images are kept in
+func GetAssetCacheDir() string {
+	return filepath.Join(GetCacheDir(), "assets")
+}
+
+// GetPidFilePath returns the pidfile used by background mode
+func GetPidFilePath() string {
+	return filepath.Join(GetConfigDir(), "markhub.pid")
+}
+
+// GetCrashLogPath returns the file holding the most recent recovered panics
+func GetCrashLogPath() string {
+	return filepath.Join(GetConfigDir(), "crash.log")
+}
+
+// GetLogPath returns the configured log file, or the default one under the config dir
+func (c *Config) GetLogPath() string {
+	if c.LogFile != "" {
+		return c.LogFile
+	}
+	return filepath.Join(GetConfigDir(), "markhub.log")
+}
+
+// AuditLogOff is the audit_log value that disables auditing
+const AuditLogOff = "off"
+
+// GetAuditLogPath returns the configured audit log, or audit.log next to the config file. It is
+// empty, disabling auditing, when audit_log is "off" and for sessions that do not save their config.
+func (c *Config) GetAuditLogPath() string {
+	switch {
+	case c.AuditLog == AuditLogOff:
+		return ""
+	case c.AuditLog != "":
+		return c.AuditLog
+	case c.Ephemeral || c.configPath == "" || c.ConfigFromStdin():
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.configPath), "audit.log")
+}
+
+// GetAnalyticsPath returns the file the view counters are stored in: analytics.file, or
+// analytics.json next to the config file. It is empty, keeping the counts in memory only, for
+// sessions that do not save their config.
+func (c *Config) GetAnalyticsPath() string {
+	switch {
+	case c.Analytics.File != "":
+		return c.Analytics.File
+	case c.Ephemeral || c.configPath == "" || c.ConfigFromStdin():
+		return ""
+	}
+	return filepath.Join(filepath.Dir(c.configPath), "analytics.json")
+}
+
 // Load loads configuration from file and command line flags
 func Load() (*Config, error) {
 	cfg := DefaultConfig()
@@ -84,7 +689,13 @@ func Load() (*Config, error) {
 	theme := flag.String("theme", "", "Default theme (light/dark)")
 	watch := flag.Bool("watch", true, "Enable file watching")
 	open := flag.Bool("open", false, "Open browser on startup")
-	configFile := flag.String("config", "", "Configuration file path")
+	openPath := flag.String("open-path", "", "Open browser on startup at this document (alias/path, implies --open)")
+	noSave := flag.Bool("no-save", false, "Never write config changes to disk (implied by --path)")
+	readOnly := flag.Bool("read-only", false, "Reject all state-changing API requests")
+	configFile := flag.String("config", "", "Configuration file path (- reads YAML from stdin)")
+	expose := flag.Bool("expose", false, "Listen on all interfaces (0.0.0.0) instead of localhost only")
+	exposeInsecure := flag.Bool("expose-insecure", false, "Allow --expose without auth_token configured")
+	prewarm := flag.Bool("prewarm", false, "Render every document into the cache in the background on startup")
 
 	flag.StringVar(path, "p", "", "Markdown files root directory (shorthand)")
 
@@ -114,20 +725,39 @@ func Load() (*Config, error) {
 			return nil, err
 		}
 		cfg.configPath = cfgPath
+		// There is no file to write changes back to
+		if cfgPath == StdinConfigPath {
+			cfg.Ephemeral = true
+		}
 	} else {
 		// Set default config path for saving
 		cfg.configPath = GetConfigPath()
 	}
 
+	if token := os.Getenv(AuthTokenEnv); token != "" {
+		cfg.fileAuthToken = cfg.AuthToken
+		cfg.AuthToken = token
+		cfg.authTokenFromEnv = true
+	}
+
 	// Command line flags override config file (only if explicitly set)
 	cliPathProvided := *path != ""
 	if cliPathProvided {
 		cfg.Path = *path
 		// CLI --path overrides saved folders - use CLI path exclusively
 		cfg.Folders = nil
+		// Saving would replace the persisted folder list with this one-off preview
+		cfg.Ephemeral = true
+	}
+	if *noSave {
+		cfg.Ephemeral = true
+	}
+	if *readOnly {
+		cfg.ReadOnly = true
 	}
 	if *port != 0 {
 		cfg.Port = *port
+		cfg.portFromFlag = true
 	}
 	if *theme != "" {
 		cfg.Theme = *theme
@@ -135,6 +765,134 @@ func Load() (*Config, error) {
 	// Bool flags - use command line value (they have explicit defaults)
 	cfg.Watch = *watch
 	cfg.Open = *open
+	if *openPath != "" {
+		cfg.OpenPath = *openPath
+		cfg.Open = true
+	}
+	if *expose {
+		cfg.Expose = true
+	}
+	cfg.Prewarm = *prewarm
+	if *exposeInsecure {
+		cfg.ExposeInsecure = true
+	}
+
+	for _, addr := range cfg.Listen {
+		if err := validateListenAddr(addr); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := cfg.TrustedProxyNets(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.OverlappingFolders {
+	case "", OverlappingFoldersWarn, OverlappingFoldersHide:
+	case OverlappingFoldersReject:
+		if overlaps := folderOverlaps(cfg.Folders); len(overlaps) > 0 {
+			return nil, fmt.Errorf("%w (overlapping_folders is %q)", overlaps[0], OverlappingFoldersReject)
+		}
+	default:
+		return nil, fmt.Errorf("invalid overlapping_folders %q (expected %q, %q or %q)", cfg.OverlappingFolders,
+			OverlappingFoldersWarn, OverlappingFoldersReject, OverlappingFoldersHide)
+	}
+
+	switch cfg.WatchMode {
+	case "", WatchModeFSNotify, WatchModePoll:
+	default:
+		return nil, fmt.Errorf("invalid watch_mode %q (expected %q or %q)", cfg.WatchMode, WatchModeFSNotify, WatchModePoll)
+	}
+
+	if err := markdown.ValidateCodeLanguage(cfg.Render.CodeLanguage); err != nil {
+		return nil, fmt.Errorf("render: %w", err)
+	}
+	if err := markdown.ValidateExtensions(cfg.Render.DisabledExtensions); err != nil {
+		return nil, fmt.Errorf("render.disabled_extensions: %w", err)
+	}
+	if !validAnchorPrefix(cfg.Render.AnchorPrefix) {
+		return nil, fmt.Errorf("invalid render.anchor_prefix %q (expected a letter, then letters, digits, - or _)",
+			cfg.Render.AnchorPrefix)
+	}
+	for i, rule := range cfg.ExcludeRules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("exclude_rules[%d]: %w", i, err)
+		}
+	}
+	for i, webhook := range cfg.Webhooks {
+		if err := webhook.validate(); err != nil {
+			return nil, fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+	}
+	if !validAssetsDir(cfg.Assets.Dir) {
+		return nil, fmt.Errorf("invalid assets.dir %q (expected a relative directory such as \"assets\")",
+			cfg.Assets.Dir)
+	}
+	if cfg.Assets.VariantCacheSize < -1 {
+		return nil, fmt.Errorf("invalid assets.variant_cache_size %d (expected -1 or more)", cfg.Assets.VariantCacheSize)
+	}
+	if cfg.Analytics.RetentionDays < 0 {
+		return nil, fmt.Errorf("invalid analytics.retention_days %d (expected 0 or more)", cfg.Analytics.RetentionDays)
+	}
+	if err := markdown.ValidateLintRules(cfg.Lint.DisabledRules); err != nil {
+		return nil, fmt.Errorf("lint.disabled_rules: %w", err)
+	}
+	for name, command := range cfg.Lint.Commands {
+		words := strings.Fields(command)
+		if name == "" || len(words) < 2 || strings.Contains(words[0], "{file}") ||
+			!strings.Contains(command, "{file}") {
+			return nil, fmt.Errorf("invalid lint.commands entry %q: %q (expected a program and arguments "+
+				"holding {file})", name, command)
+		}
+	}
+	if cfg.Lint.CommandTimeout < 0 {
+		return nil, fmt.Errorf("invalid lint.command_timeout %s (expected 0 or more)", cfg.Lint.CommandTimeout)
+	}
+	for _, pattern := range cfg.Lint.EntryPoints {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid lint.entry_points pattern %q: %w", pattern, err)
+		}
+	}
+	if err := cfg.Cache.validate(); err != nil {
+		return nil, err
+	}
+	for _, format := range cfg.Pandoc.Formats {
+		if _, ok := PandocFormats[format]; !ok {
+			return nil, fmt.Errorf("invalid pandoc.formats entry %q (expected docx, epub, odt or rtf)", format)
+		}
+	}
+	switch cfg.Render.ExternalImages {
+	case "", ExternalImagesAllow, ExternalImagesBlock, ExternalImagesProxy:
+	default:
+		return nil, fmt.Errorf("invalid render.external_images %q (expected %q, %q or %q)",
+			cfg.Render.ExternalImages, ExternalImagesAllow, ExternalImagesBlock, ExternalImagesProxy)
+	}
+	switch cfg.Render.Diagrams {
+	case "", DiagramsClient, DiagramsServer:
+	default:
+		return nil, fmt.Errorf("invalid render.diagrams %q (expected %q or %q)", cfg.Render.Diagrams,
+			DiagramsClient, DiagramsServer)
+	}
+	for lang, command := range cfg.Render.DiagramCommands {
+		words := strings.Fields(command)
+		if lang == "" || len(words) < 2 || strings.Contains(words[0], "{file}") ||
+			!strings.Contains(command, "{file}") {
+			return nil, fmt.Errorf("invalid render.diagram_commands entry %q: %q (expected a program and "+
+				"arguments holding {file})", lang, command)
+		}
+	}
+	if cfg.Render.DiagramTimeout < 0 {
+		return nil, fmt.Errorf("invalid render.diagram_timeout %s (expected 0 or more)", cfg.Render.DiagramTimeout)
+	}
+
+	for _, f := range cfg.Folders {
+		switch f.HTMLMode {
+		case "", HTMLModeUnsafe, HTMLModeSanitize, HTMLModeStrip:
+		default:
+			return nil, fmt.Errorf("folder %q: invalid html_mode %q (expected %q, %q or %q)",
+				f.Path, f.HTMLMode, HTMLModeUnsafe, HTMLModeSanitize, HTMLModeStrip)
+		}
+	}
 
 	// Migrate legacy path to folders if needed
 	cfg.migrateLegacyPath()
@@ -142,6 +900,153 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// AuthTokenEnv names the environment variable that overrides auth_token without writing it to the config file
+const AuthTokenEnv = "MARKHUB_AUTH_TOKEN"
+
+// ErrInsecureExpose is returned by ValidateExposure when the server would be
+// reachable from the network without any authentication configured.
+var ErrInsecureExpose = errors.New(
+	"refusing to expose MarkHub on the network without auth_token; " +
+		"set auth_token in the config file or " + AuthTokenEnv + ", or pass --expose-insecure")
+
+// ValidateExposure checks that the network binding settings are consistent and safe.
+func (c *Config) ValidateExposure() error {
+	if c.ExposeInsecure && !c.Expose {
+		return fmt.Errorf("--expose-insecure requires --expose")
+	}
+	if c.Expose && c.AuthToken == "" && !c.ExposeInsecure {
+		return ErrInsecureExpose
+	}
+	if len(c.Listen) == 0 {
+		return nil
+	}
+	// listen replaces the port/--expose binding, so flags that only affect that binding would be ignored
+	if c.portFromFlag {
+		return fmt.Errorf("--port has no effect when listen addresses are configured; change the listen entries instead")
+	}
+	exposed := false
+	for _, addr := range c.Listen {
+		host, _, _ := net.SplitHostPort(addr)
+		if !isLoopbackHost(host) {
+			if !c.Expose {
+				return fmt.Errorf("listen address %s is reachable from the network; pass --expose to allow it", addr)
+			}
+			exposed = true
+		}
+	}
+	if c.Expose && !exposed {
+		return fmt.Errorf("--expose has no effect: every configured listen address is loopback")
+	}
+	return nil
+}
+
+// ListenHost returns the host the server binds to: all interfaces when exposed, loopback otherwise.
+func (c *Config) ListenHost() string {
+	if c.Expose {
+		return "0.0.0.0"
+	}
+	return "127.0.0.1"
+}
+
+// ListenAddr returns the host:port address the server binds to.
+func (c *Config) ListenAddr() string {
+	return fmt.Sprintf("%s:%d", c.ListenHost(), c.Port)
+}
+
+// ListenAddrs returns every address the server binds to: the listen list when
+// configured, otherwise the single ListenAddr.
+func (c *Config) ListenAddrs() []string {
+	if len(c.Listen) > 0 {
+		return c.Listen
+	}
+	return []string{c.ListenAddr()}
+}
+
+// LocalAddr returns an address local clients (health probes, the browser) can reach the server on.
+// Wildcard hosts are mapped to the matching loopback address.
+func (c *Config) LocalAddr() string {
+	addr := c.ListenAddrs()[0]
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case host == "" || (ip != nil && ip.Equal(net.IPv4zero)):
+		host = "127.0.0.1"
+	case ip != nil && ip.IsUnspecified():
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// TrustedProxyNets parses trusted_proxies; a bare IP trusts that single address
+func (c *Config) TrustedProxyNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, entry := range c.TrustedProxies {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted_proxies entry %q (expected an IP or CIDR)", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted_proxies entry %q (expected an IP or CIDR)", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// validAssetsDir reports whether dir is empty or a clean relative slash path inside the document's directory
+func validAssetsDir(dir string) bool {
+	if dir == "" {
+		return true
+	}
+	return !path.IsAbs(dir) && path.Clean(dir) == dir && dir != "." && dir != ".." && !strings.HasPrefix(dir, "../") &&
+		!strings.Contains(dir, `\`)
+}
+
+// validAnchorPrefix reports whether prefix is empty or a letter followed by letters, digits, "-"
+// and "_", which keeps the ids it starts valid in HTML, URL fragments and CSS selectors
+func validAnchorPrefix(prefix string) bool {
+	for i, r := range prefix {
+		letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !letter && (i == 0 || !(r >= '0' && r <= '9' || r == '-' || r == '_')) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateListenAddr checks that addr is a host:port pair with a numeric port
+func validateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid listen address %q: bad port %q", addr, port)
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host only accepts connections from this machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // migrateLegacyPath converts single Path to Folders if Folders is empty
 func (c *Config) migrateLegacyPath() {
 	if len(c.Folders) == 0 && c.Path != "" {
@@ -166,18 +1071,120 @@ func (c *Config) migrateLegacyPath() {
 			c.Folders[i].Alias = filepath.Base(c.Folders[i].Path)
 		}
 	}
+
+	c.assignFolderIDs()
+}
+
+// folderIDLength is the number of hex characters kept from the folder hash
+const folderIDLength = 12
+
+// NewFolderID derives a folder ID from its absolute path, git ref and sub-path
+func NewFolderID(absPath, gitRef, subPath string) string {
+	sum := sha256.Sum256([]byte(absPath + "\x00" + gitRef + "\x00" + subPath))
+	return hex.EncodeToString(sum[:])[:folderIDLength]
 }
 
+// assignFolderIDs gives every folder without an ID a new one, keeping IDs unique.
+// Existing IDs are never changed, so they stay valid after the folder is edited.
+func (c *Config) assignFolderIDs() {
+	seen := make(map[string]bool, len(c.Folders))
+	for i := range c.Folders {
+		f := &c.Folders[i]
+		if f.ID == "" || seen[f.ID] {
+			f.ID = uniqueName(NewFolderID(f.Path, f.GitRef, f.SubPath), seen)
+		}
+		seen[f.ID] = true
+	}
+}
+
+// uniqueName appends a numeric suffix to name until it is not in seen
+func uniqueName(name string, seen map[string]bool) string {
+	candidate := name
+	for n := 2; seen[candidate]; n++ {
+		candidate = fmt.Sprintf("%s-%d", name, n)
+	}
+	return candidate
+}
+
+// FoldersSnapshot returns a copy of the configured folders that stays valid while the API adds,
+// updates or removes folders
+func (c *Config) FoldersSnapshot() []Folder {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Folder(nil), c.Folders...)
+}
+
+// FolderByID returns the folder with the given ID
+func (c *Config) FolderByID(id string) (Folder, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if i := c.folderIndexByID(id); i >= 0 {
+		return c.Folders[i], true
+	}
+	return Folder{}, false
+}
+
+// FolderIndexByID returns the index of the folder with the given ID, or -1
+func (c *Config) FolderIndexByID(id string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.folderIndexByID(id)
+}
+
+func (c *Config) folderIndexByID(id string) int {
+	for i, f := range c.Folders {
+		if f.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// StdinConfigPath is the --config value that reads the configuration from standard input
+const StdinConfigPath = "-"
+
+// ConfigFromStdin reports whether the configuration was read from standard input
+func (c *Config) ConfigFromStdin() bool {
+	return c.configPath == StdinConfigPath
+}
+
+// loadFromFile reads the config at path. YAML anchors and aliases work as usual, and a value
+// tagged "!include file.yaml" is replaced by the contents of that file, resolved relative to the
+// including file (the working directory for stdin).
 func (c *Config) loadFromFile(path string) error {
-	data, err := os.ReadFile(path)
+	var data []byte
+	var err error
+	var chain []string
+	dir := "."
+	if path == StdinConfigPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+		if abs, absErr := filepath.Abs(path); absErr == nil {
+			chain = []string{abs}
+			dir = filepath.Dir(abs)
+		}
+	}
 	if err != nil {
 		return err
 	}
-	return yaml.Unmarshal(data, c)
+	root, err := parseYAML(data, dir, chain)
+	if err != nil || root == nil {
+		return err
+	}
+	return root.Decode(c)
 }
 
-// Save saves the current configuration to the config file
+// Save saves the current configuration to the config file.
+// In ephemeral mode, or when the config came from stdin, it is a no-op and changes live only in memory.
 func (c *Config) Save() error {
+	if c.Ephemeral || c.ConfigFromStdin() {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	// Ensure config directory exists
 	configDir := filepath.Dir(c.configPath)
 	if err := os.MkdirAll(configDir, 0755); err != nil {
@@ -186,23 +1193,83 @@ func (c *Config) Save() error {
 
 	// Create a copy without internal fields for saving
 	saveConfig := struct {
-		Folders     []Folder            `yaml:"folders,omitempty"`
-		Port        int                 `yaml:"port"`
-		Theme       string              `yaml:"theme"`
-		Watch       bool                `yaml:"watch"`
-		Open        bool                `yaml:"open"`
-		Extensions  []string            `yaml:"extensions"`
-		Exclude     []string            `yaml:"exclude"`
-		RepoExclude map[string][]string `yaml:"repo_exclude,omitempty"`
+		Folders        []Folder            `yaml:"folders,omitempty"`
+		Port           int                 `yaml:"port"`
+		Listen         []string            `yaml:"listen,omitempty"`
+		TrustedProxies []string            `yaml:"trusted_proxies,omitempty"`
+		RequestTimeout time.Duration       `yaml:"request_timeout,omitempty"`
+		MaxRequestBody int64               `yaml:"max_request_body,omitempty"`
+		MaxWriteBody   int64               `yaml:"max_write_body,omitempty"`
+		Theme          string              `yaml:"theme"`
+		Watch          bool                `yaml:"watch"`
+		WatchMode      string              `yaml:"watch_mode,omitempty"`
+		PollInterval   time.Duration       `yaml:"poll_interval,omitempty"`
+		Extensions     []string            `yaml:"extensions"`
+		Extensionless  []string            `yaml:"extensionless_files,omitempty"`
+		Exclude        []string            `yaml:"exclude"`
+		ExcludeRules   []ExcludeRule       `yaml:"exclude_rules,omitempty"`
+		MaxDirEntries  int                 `yaml:"max_dir_entries,omitempty"`
+		MaxFolders     int                 `yaml:"max_folders,omitempty"`
+		Overlapping    string              `yaml:"overlapping_folders,omitempty"`
+		RepoExclude    map[string][]string `yaml:"repo_exclude,omitempty"`
+		Branding       Branding            `yaml:"branding,omitempty"`
+		HomeDocument   string              `yaml:"home_document,omitempty"`
+		Search         SearchConfig        `yaml:"search,omitempty"`
+		Render         RenderConfig        `yaml:"render"`
+		Assets         AssetsConfig        `yaml:"assets,omitempty"`
+		Book           BookConfig          `yaml:"book,omitempty"`
+		Pandoc         PandocConfig        `yaml:"pandoc,omitempty"`
+		Analytics      AnalyticsConfig     `yaml:"analytics,omitempty"`
+		Lint           LintConfig          `yaml:"lint,omitempty"`
+		Cache          CacheConfig         `yaml:"cache,omitempty"`
+		Security       SecurityConfig      `yaml:"security,omitempty"`
+		Git            GitConfig           `yaml:"git,omitempty"`
+		Webhooks       []Webhook           `yaml:"webhooks,omitempty"`
+		Templates      map[string]string   `yaml:"templates,omitempty"`
+		AuditLog       string              `yaml:"audit_log,omitempty"`
+		LogFile        string              `yaml:"log_file,omitempty"`
+		UpdateURL      string              `yaml:"update_url,omitempty"`
+		AuthToken      string              `yaml:"auth_token,omitempty"`
+		ReadOnly       bool                `yaml:"read_only,omitempty"`
 	}{
-		Folders:     c.Folders,
-		Port:        c.Port,
-		Theme:       c.Theme,
-		Watch:       c.Watch,
-		Open:        c.Open,
-		Extensions:  c.Extensions,
-		Exclude:     c.Exclude,
-		RepoExclude: c.RepoExclude,
+		Folders:        c.persistentFolders(),
+		Port:           c.Port,
+		Listen:         c.Listen,
+		TrustedProxies: c.TrustedProxies,
+		RequestTimeout: c.RequestTimeout,
+		MaxRequestBody: c.MaxRequestBody,
+		MaxWriteBody:   c.MaxWriteBody,
+		Theme:          c.Theme,
+		Watch:          c.Watch,
+		WatchMode:      c.WatchMode,
+		PollInterval:   c.PollInterval,
+		Extensions:     c.Extensions,
+		Extensionless:  c.ExtensionlessFiles,
+		Exclude:        c.Exclude,
+		ExcludeRules:   c.ExcludeRules,
+		MaxDirEntries:  c.MaxDirEntries,
+		MaxFolders:     c.MaxFolders,
+		Overlapping:    c.OverlappingFolders,
+		RepoExclude:    c.RepoExclude,
+		Branding:       c.Branding,
+		HomeDocument:   c.HomeDocument,
+		Search:         c.Search,
+		Render:         c.Render,
+		Assets:         c.Assets,
+		Book:           c.Book,
+		Pandoc:         c.Pandoc,
+		Analytics:      c.Analytics,
+		Lint:           c.Lint,
+		Cache:          c.Cache,
+		Security:       c.Security,
+		Git:            c.Git,
+		Webhooks:       c.Webhooks,
+		Templates:      c.Templates,
+		AuditLog:       c.AuditLog,
+		LogFile:        c.LogFile,
+		UpdateURL:      c.UpdateURL,
+		AuthToken:      c.savedAuthToken(),
+		ReadOnly:       c.ReadOnly,
 	}
 
 	data, err := yaml.Marshal(saveConfig)
@@ -213,6 +1280,75 @@ func (c *Config) Save() error {
 	return os.WriteFile(c.configPath, data, 0644)
 }
 
+// ErrFolderExists is returned by AddFolder when the same path, git_ref and sub_path is already configured
+var ErrFolderExists = errors.New("folder already configured")
+
+// ErrFolderOverlap is returned by AddFolder, with overlapping_folders set to "reject", when the new
+// folder's root lies inside another local folder's, or contains one
+var ErrFolderOverlap = errors.New("folder overlaps another folder")
+
+// FolderOverlap is a local folder whose root, its path joined with its sub_path, lies inside the
+// root of another, or is the same as that of an earlier one
+type FolderOverlap struct {
+	Inner Folder
+	Outer Folder
+}
+
+func (o FolderOverlap) Error() string {
+	return fmt.Sprintf("folder %q (%s) lies inside folder %q (%s)", o.Inner.Alias, o.Inner.root(), o.Outer.Alias,
+		o.Outer.root())
+}
+
+// Unwrap makes an overlap match ErrFolderOverlap
+func (o FolderOverlap) Unwrap() error { return ErrFolderOverlap }
+
+// root returns the directory the folder shows
+func (f Folder) root() string {
+	return filepath.Join(f.Path, filepath.FromSlash(f.SubPath))
+}
+
+// folderOverlaps returns the overlapping pairs of the local folders; git_ref folders are read from
+// the object database and never overlap
+func folderOverlaps(folders []Folder) []FolderOverlap {
+	var overlaps []FolderOverlap
+	for i, inner := range folders {
+		for j, outer := range folders {
+			if i == j || inner.GitRef != "" || outer.GitRef != "" {
+				continue
+			}
+			rel, err := filepath.Rel(outer.root(), inner.root())
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) ||
+				(rel == "." && j > i) {
+				continue
+			}
+			overlaps = append(overlaps, FolderOverlap{Inner: inner, Outer: outer})
+		}
+	}
+	return overlaps
+}
+
+// FolderOverlaps returns the local folders whose roots lie inside, or are, the root of another
+func (c *Config) FolderOverlaps() []FolderOverlap {
+	return folderOverlaps(c.FoldersSnapshot())
+}
+
+// FolderHidden reports whether the folder with the given ID is left out of the tree because it
+// lies inside another and overlapping_folders is "hide"
+func (c *Config) FolderHidden(id string) bool {
+	if c.OverlappingFolders != OverlappingFoldersHide {
+		return false
+	}
+	for _, overlap := range c.FolderOverlaps() {
+		if overlap.Inner.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrTooManyFolders is returned by AddFolder when max_folders folders are already configured
+var ErrTooManyFolders = errors.New("too many folders configured")
+
 // AddFolder adds a new folder with the given path, alias, git_ref, subPath and excludes
 func (c *Config) AddFolder(path, alias, gitRef, subPath string, exclude []string) error {
 	absPath, err := filepath.Abs(path)
@@ -220,12 +1356,18 @@ func (c *Config) AddFolder(path, alias, gitRef, subPath string, exclude []string
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	// Check if folder already exists (same path AND same git_ref AND same sub_path)
 	for _, f := range c.Folders {
 		if f.Path == absPath && f.GitRef == gitRef && f.SubPath == subPath {
-			return nil // Already exists
+			return ErrFolderExists
 		}
 	}
+	if limit := c.GetMaxFolders(); limit > 0 && len(c.persistentFolders()) >= limit {
+		return fmt.Errorf("%w (max_folders is %d)", ErrTooManyFolders, limit)
+	}
 
 	if alias == "" {
 		alias = filepath.Base(absPath)
@@ -234,76 +1376,278 @@ func (c *Config) AddFolder(path, alias, gitRef, subPath string, exclude []string
 		}
 	}
 
-	c.Folders = append(c.Folders, Folder{
+	seen := make(map[string]bool, len(c.Folders))
+	for _, f := range c.Folders {
+		seen[f.ID] = true
+	}
+
+	added := Folder{
+		ID:      uniqueName(NewFolderID(absPath, gitRef, subPath), seen),
 		Path:    absPath,
 		Alias:   alias,
 		GitRef:  gitRef,
 		SubPath: subPath,
 		Exclude: exclude,
-	})
+	}
+	folders := append(c.Folders[:len(c.Folders):len(c.Folders)], added)
+	if c.OverlappingFolders == OverlappingFoldersReject {
+		for _, overlap := range folderOverlaps(folders) {
+			if overlap.Inner.ID == added.ID || overlap.Outer.ID == added.ID {
+				return overlap
+			}
+		}
+	}
+	c.Folders = folders
 
 	return nil
 }
 
+// AliasPathFor maps a filesystem path to the alias-prefixed path used by the API
+// (e.g. "/home/me/docs/a.md" -> "docs/a.md") using the first local folder containing it.
+func (c *Config) AliasPathFor(fsPath string) (string, bool) {
+	absPath, err := filepath.Abs(fsPath)
+	if err != nil {
+		return "", false
+	}
+	for _, f := range c.FoldersSnapshot() {
+		if f.GitRef != "" {
+			continue
+		}
+		rel, err := filepath.Rel(f.Path, absPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return f.Alias + "/" + filepath.ToSlash(rel), true
+	}
+	return "", false
+}
+
+// PreviewFile returns the alias-prefixed path for a markdown file given on the command line.
+// A file outside every configured folder gets a temporary folder for its parent directory.
+func (c *Config) PreviewFile(fsPath string) (string, error) {
+	absPath, err := filepath.Abs(fsPath)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory (use --path to serve a folder)", fsPath)
+	}
+	if !c.IsMarkdownFile(absPath) {
+		return "", fmt.Errorf("%s is not a markdown file", fsPath)
+	}
+	if aliasPath, ok := c.AliasPathFor(absPath); ok {
+		return aliasPath, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir := filepath.Dir(absPath)
+	aliases := make(map[string]bool, len(c.Folders))
+	ids := make(map[string]bool, len(c.Folders))
+	for _, f := range c.Folders {
+		aliases[f.Alias] = true
+		ids[f.ID] = true
+	}
+	alias := uniqueName(filepath.Base(dir), aliases)
+	c.Folders = append(c.Folders[:len(c.Folders):len(c.Folders)], Folder{
+		ID:        uniqueName(NewFolderID(dir, "", ""), ids),
+		Path:      dir,
+		Alias:     alias,
+		Temporary: true,
+	})
+	return alias + "/" + filepath.Base(absPath), nil
+}
+
+// savedAuthToken returns the auth_token to write back, ignoring a token supplied via AuthTokenEnv
+func (c *Config) savedAuthToken() string {
+	if c.authTokenFromEnv {
+		return c.fileAuthToken
+	}
+	return c.AuthToken
+}
+
+// persistentFolders returns the folders that belong in the config file
+func (c *Config) persistentFolders() []Folder {
+	folders := make([]Folder, 0, len(c.Folders))
+	for _, f := range c.Folders {
+		if !f.Temporary {
+			folders = append(folders, f)
+		}
+	}
+	return folders
+}
+
 // IsFolderExcluded checks if a relative path should be excluded by folder-level excludes
 func (c *Config) IsFolderExcluded(relPath string, folderExcludes []string) bool {
-	if len(folderExcludes) == 0 {
-		return false
-	}
+	_, excluded := c.FolderExcludeMatch(relPath, folderExcludes)
+	return excluded
+}
+
+// FolderExcludeMatch returns the first of folderExcludes that excludes the relative path
+func (c *Config) FolderExcludeMatch(relPath string, folderExcludes []string) (string, bool) {
 	for _, pattern := range folderExcludes {
-		if matched, _ := filepath.Match(pattern, relPath); matched {
-			return true
-		}
-		base := filepath.Base(relPath)
-		if matched, _ := filepath.Match(pattern, base); matched {
-			return true
+		if matchesExclude(relPath, pattern) {
+			return pattern, true
 		}
-		clean := filepath.Clean(pattern)
-		if relPath == clean || strings.HasPrefix(relPath, clean+string(filepath.Separator)) {
-			return true
+	}
+	return "", false
+}
+
+// matchesExclude reports whether a folder-relative path matches an exclude pattern: as a whole,
+// by its base name, or by lying under the pattern as a directory
+func matchesExclude(relPath, pattern string) bool {
+	if matched, _ := filepath.Match(pattern, relPath); matched {
+		return true
+	}
+	base := filepath.Base(relPath)
+	if matched, _ := filepath.Match(pattern, base); matched {
+		return true
+	}
+	clean := filepath.Clean(pattern)
+	return relPath == clean || strings.HasPrefix(relPath, clean+string(filepath.Separator))
+}
+
+// IsExcludedByRule reports whether exclude_rules hide a file at relPath (relative to its folder)
+// with the given size and modification time
+func (c *Config) IsExcludedByRule(relPath string, size int64, modTime time.Time) bool {
+	_, excluded := c.ExcludeRuleMatch(relPath, size, modTime)
+	return excluded
+}
+
+// ExcludeRuleMatch returns the index in exclude_rules of the first rule hiding a file at relPath
+// with the given size and modification time
+func (c *Config) ExcludeRuleMatch(relPath string, size int64, modTime time.Time) (int, bool) {
+	now := time.Now()
+	for i, rule := range c.ExcludeRules {
+		if rule.matches(relPath, size, modTime, now) {
+			return i, true
 		}
 	}
-	return false
+	return -1, false
+}
+
+// RemoveFolderByID removes the folder with the given ID, returning it and whether it existed
+func (c *Config) RemoveFolderByID(id string) (Folder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.folderIndexByID(id)
+	if i < 0 {
+		return Folder{}, false
+	}
+	removed := c.Folders[i]
+	folders := make([]Folder, 0, len(c.Folders)-1)
+	folders = append(folders, c.Folders[:i]...)
+	c.Folders = append(folders, c.Folders[i+1:]...)
+	return removed, true
+}
+
+// UpdateFolderByID updates the fields of the folder with the given ID, returning its
+// previous value and whether it existed. The folder keeps its ID.
+func (c *Config) UpdateFolderByID(id, alias, gitRef, subPath string, exclude []string) (Folder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.folderIndexByID(id)
+	if i < 0 {
+		return Folder{}, false
+	}
+	before := c.Folders[i]
+	folders := append([]Folder(nil), c.Folders...)
+	folders[i].Alias = alias
+	folders[i].GitRef = gitRef
+	folders[i].SubPath = subPath
+	folders[i].Exclude = exclude
+	c.Folders = folders
+	return before, true
 }
 
-// RemoveFolderByIndex removes a folder by its index
-func (c *Config) RemoveFolderByIndex(index int) {
-	if index < 0 || index >= len(c.Folders) {
-		return
+// SetFolderWritable sets the writable flag of the folder with the given ID, reporting whether it exists
+func (c *Config) SetFolderWritable(id string, writable bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.folderIndexByID(id)
+	if i < 0 {
+		return false
 	}
-	c.Folders = append(c.Folders[:index], c.Folders[index+1:]...)
+	folders := append([]Folder(nil), c.Folders...)
+	folders[i].Writable = writable
+	c.Folders = folders
+	return true
 }
 
-// UpdateFolderByIndex updates a folder's fields by index
-func (c *Config) UpdateFolderByIndex(index int, alias, gitRef, subPath string, exclude []string) {
-	if index < 0 || index >= len(c.Folders) {
-		return
+// SetFolderDescription sets the description of the folder with the given ID, reporting whether it exists
+func (c *Config) SetFolderDescription(id, description string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.folderIndexByID(id)
+	if i < 0 {
+		return false
 	}
-	c.Folders[index].Alias = alias
-	c.Folders[index].GitRef = gitRef
-	c.Folders[index].SubPath = subPath
-	c.Folders[index].Exclude = exclude
+	folders := append([]Folder(nil), c.Folders...)
+	folders[i].Description = description
+	c.Folders = folders
+	return true
+}
+
+// SetBranding replaces the branding settings
+func (c *Config) SetBranding(b Branding) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Branding = b
 }
 
 // SetGlobalExclude sets the global exclude patterns
 func (c *Config) SetGlobalExclude(patterns []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.Exclude = patterns
 }
 
-// SetRepoExclude sets the exclude patterns for a specific repo path
+// SetRepoExclude sets the exclude patterns for a specific repo path. The map is replaced
+// rather than edited so snapshots handed out earlier stay unchanged.
 func (c *Config) SetRepoExclude(repoPath string, patterns []string) {
-	if c.RepoExclude == nil {
-		c.RepoExclude = make(map[string][]string)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	repoExclude := make(map[string][]string, len(c.RepoExclude)+1)
+	for path, existing := range c.RepoExclude {
+		repoExclude[path] = existing
 	}
 	if len(patterns) == 0 {
-		delete(c.RepoExclude, repoPath)
+		delete(repoExclude, repoPath)
 	} else {
-		c.RepoExclude[repoPath] = patterns
+		repoExclude[repoPath] = patterns
 	}
+	c.RepoExclude = repoExclude
+}
+
+// RepoExcludeSnapshot returns the repo-level excludes; callers must not modify the map
+func (c *Config) RepoExcludeSnapshot() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.RepoExclude
+}
+
+// GlobalExclude returns the global exclude patterns
+func (c *Config) GlobalExclude() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Exclude
+}
+
+// GetBranding returns the branding settings
+func (c *Config) GetBranding() Branding {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Branding
 }
 
 // GetRepoExclude returns the exclude patterns for a specific repo path
 func (c *Config) GetRepoExclude(repoPath string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if c.RepoExclude == nil {
 		return nil
 	}
@@ -315,20 +1659,76 @@ func (c *Config) GetConfigFilePath() string {
 	return c.configPath
 }
 
+// TrashDir is the directory at a folder's root that deleted files are moved to; it is always excluded
+const TrashDir = mfs.TrashDir
+
 // IsExcluded checks if a path should be excluded
 func (c *Config) IsExcluded(path string) bool {
+	_, excluded := c.GlobalExcludeMatch(path)
+	return excluded
+}
+
+// GlobalExcludeMatch returns the global exclude pattern matching the base name of path, or
+// TrashDir for the trash directory, which is always excluded
+func (c *Config) GlobalExcludeMatch(path string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	base := filepath.Base(path)
+	if base == TrashDir {
+		return TrashDir, true
+	}
 	for _, exclude := range c.Exclude {
 		if matched, _ := filepath.Match(exclude, base); matched {
-			return true
+			return exclude, true
 		}
 	}
-	return false
+	return "", false
 }
 
-// IsMarkdownFile checks if a file has a markdown extension
+// GetMaxDirEntries returns how many entries of a directory the tree reads, or 0 for no limit
+func (c *Config) GetMaxDirEntries() int {
+	switch {
+	case c.MaxDirEntries < 0:
+		return 0
+	case c.MaxDirEntries == 0:
+		return DefaultMaxDirEntries
+	}
+	return c.MaxDirEntries
+}
+
+// GetMaxFolders returns how many folders AddFolder accepts, or 0 for no limit
+func (c *Config) GetMaxFolders() int {
+	switch {
+	case c.MaxFolders < 0:
+		return 0
+	case c.MaxFolders == 0:
+		return DefaultMaxFolders
+	}
+	return c.MaxFolders
+}
+
+// FolderLimitExceeded reports whether the configured folders already exceed max_folders. Load keeps
+// them all, so callers should warn that no more can be added.
+func (c *Config) FolderLimitExceeded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	limit := c.GetMaxFolders()
+	return limit > 0 && len(c.persistentFolders()) > limit
+}
+
+// IsMarkdownFile checks if a file has a markdown extension, or no extension and a name listed
+// in ExtensionlessFiles
 func (c *Config) IsMarkdownFile(path string) bool {
 	ext := filepath.Ext(path)
+	if ext == "" {
+		name := filepath.Base(path)
+		for _, n := range c.ExtensionlessFiles {
+			if strings.EqualFold(name, n) {
+				return true
+			}
+		}
+		return false
+	}
 	for _, e := range c.Extensions {
 		if ext == e {
 			return true
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -55,6 +60,157 @@ func TestAddFolder(t *testing.T) {
 	}
 }
 
+func TestAddFolderMaxFolders(t *testing.T) {
+	root := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Folders = []Folder{{Path: filepath.Join(root, "tmp"), Alias: "tmp", Temporary: true}}
+	cfg.MaxFolders = 2
+
+	// Temporary folders do not count against the limit
+	for _, name := range []string{"a", "b"} {
+		if err := cfg.AddFolder(filepath.Join(root, name), name, "", "", nil); err != nil {
+			t.Fatalf("AddFolder failed: %v", err)
+		}
+	}
+	if cfg.FolderLimitExceeded() {
+		t.Error("expected a config at the limit not to exceed it")
+	}
+	err := cfg.AddFolder(filepath.Join(root, "c"), "c", "", "", nil)
+	if !errors.Is(err, ErrTooManyFolders) || len(cfg.Folders) != 3 {
+		t.Fatalf("expected ErrTooManyFolders, got %v with %d folders", err, len(cfg.Folders))
+	}
+
+	// A config loaded over the limit is kept whole
+	cfg.MaxFolders = 1
+	if !cfg.FolderLimitExceeded() {
+		t.Error("expected two folders to exceed max_folders 1")
+	}
+	cfg.MaxFolders = -1
+	if err := cfg.AddFolder(filepath.Join(root, "c"), "c", "", "", nil); err != nil || cfg.FolderLimitExceeded() {
+		t.Errorf("expected no limit with max_folders -1, got %v", err)
+	}
+}
+
+func TestFolderOverlaps(t *testing.T) {
+	root := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Folders = []Folder{
+		{ID: "repo", Path: root, Alias: "repo"},
+		{ID: "docs", Path: filepath.Join(root, "docs"), Alias: "docs"},
+		{ID: "sub", Path: root, Alias: "sub", SubPath: "docs/guide"},
+		{ID: "ref", Path: root, Alias: "ref", GitRef: "main"},
+		{ID: "sibling", Path: root + "-other", Alias: "sibling"},
+	}
+
+	var pairs []string
+	for _, overlap := range cfg.FolderOverlaps() {
+		if !errors.Is(overlap, ErrFolderOverlap) {
+			t.Errorf("expected %v to match ErrFolderOverlap", overlap)
+		}
+		pairs = append(pairs, overlap.Inner.ID+" in "+overlap.Outer.ID)
+	}
+	if want := []string{"docs in repo", "sub in repo", "sub in docs"}; !slices.Equal(pairs, want) {
+		t.Errorf("expected overlaps %v, got %v", want, pairs)
+	}
+
+	if cfg.FolderHidden("docs") {
+		t.Error("expected no folder hidden outside hide mode")
+	}
+	cfg.OverlappingFolders = OverlappingFoldersHide
+	if !cfg.FolderHidden("docs") || !cfg.FolderHidden("sub") || cfg.FolderHidden("repo") {
+		t.Error("expected the nested folders, and only those, to be hidden")
+	}
+}
+
+func TestAddFolderRejectsOverlap(t *testing.T) {
+	root := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Folders = nil
+	cfg.OverlappingFolders = OverlappingFoldersReject
+	if err := cfg.AddFolder(filepath.Join(root, "docs"), "docs", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both a parent and a child of an existing folder are rejected
+	for _, path := range []string{root, filepath.Join(root, "docs", "guide")} {
+		if err := cfg.AddFolder(path, "other", "", "", nil); !errors.Is(err, ErrFolderOverlap) {
+			t.Errorf("%s: expected ErrFolderOverlap, got %v", path, err)
+		}
+	}
+	if len(cfg.Folders) != 1 {
+		t.Fatalf("expected rejected folders not to be added, got %+v", cfg.Folders)
+	}
+	if err := cfg.AddFolder(filepath.Join(root, "notes"), "notes", "", "", nil); err != nil {
+		t.Errorf("expected a sibling folder to be added, got %v", err)
+	}
+}
+
+func TestFolderIDsAreStable(t *testing.T) {
+	root := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Folders = nil
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := cfg.AddFolder(filepath.Join(root, name), name, "", "", nil); err != nil {
+			t.Fatalf("AddFolder failed: %v", err)
+		}
+	}
+	idB, idC := cfg.Folders[1].ID, cfg.Folders[2].ID
+	if idB == "" || idB == idC || cfg.Folders[0].ID == idB {
+		t.Fatalf("expected distinct non-empty IDs, got %+v", cfg.Folders)
+	}
+
+	// Removing a folder must not change which folder an ID refers to
+	if removed, ok := cfg.RemoveFolderByID(cfg.Folders[0].ID); !ok || removed.Alias != "a" {
+		t.Fatalf("RemoveFolderByID removed %+v, ok=%v", removed, ok)
+	}
+	if i := cfg.FolderIndexByID(idC); i < 0 || cfg.Folders[i].Alias != "c" {
+		t.Errorf("ID %s no longer resolves to folder c after removal", idC)
+	}
+
+	// Editing keeps the original ID even though the hash inputs changed
+	before, ok := cfg.UpdateFolderByID(idB, "b2", "main", "docs", nil)
+	if !ok || before.Alias != "b" {
+		t.Fatalf("UpdateFolderByID returned %+v, ok=%v", before, ok)
+	}
+	cfg.assignFolderIDs()
+	if i := cfg.FolderIndexByID(idB); i < 0 || cfg.Folders[i].Alias != "b2" {
+		t.Errorf("expected ID %s to survive an update", idB)
+	}
+
+	if cfg.FolderIndexByID("missing") != -1 {
+		t.Error("expected -1 for an unknown ID")
+	}
+	if _, ok := cfg.RemoveFolderByID("missing"); ok {
+		t.Error("expected RemoveFolderByID to report a missing ID")
+	}
+	if _, ok := cfg.UpdateFolderByID("missing", "x", "", "", nil); ok {
+		t.Error("expected UpdateFolderByID to report a missing ID")
+	}
+}
+
+func TestAssignFolderIDs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Folders = []Folder{
+		{Path: "/srv/docs", Alias: "docs"},
+		{Path: "/srv/docs", Alias: "docs copy"},
+		{ID: "custom", Path: "/srv/notes", Alias: "notes"},
+	}
+	cfg.migrateLegacyPath()
+
+	absDocs, _ := filepath.Abs("/srv/docs")
+	want := NewFolderID(absDocs, "", "")
+	if got := cfg.Folders[0].ID; got != want {
+		t.Errorf("expected derived ID %s, got %s", want, got)
+	}
+	if got := cfg.Folders[1].ID; got != want+"-2" {
+		t.Errorf("expected duplicate to get suffix, got %s", got)
+	}
+	if got := cfg.Folders[2].ID; got != "custom" {
+		t.Errorf("expected configured ID to be kept, got %s", got)
+	}
+}
+
 func TestIsExcluded(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Exclude = []string{".git", "node_modules"}
@@ -70,6 +226,108 @@ func TestIsExcluded(t *testing.T) {
 	}
 }
 
+func TestIsExcludedByRule(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ExcludeRules = []ExcludeRule{
+		{SizeGT: 1000},
+		{Pattern: "archive", ModifiedBefore: "30d"},
+		{Pattern: "*.gen.md", ModifiedAfter: "2024-01-01", ModifiedBefore: "2024-02-01"},
+	}
+	now := time.Now()
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		path    string
+		size    int64
+		modTime time.Time
+		want    bool
+	}{
+		{"big.md", 2000, now, true},
+		{"small.md", 1000, now, false},
+		{"archive/old.md", 10, now.AddDate(0, 0, -31), true},
+		{"archive/recent.md", 10, now.AddDate(0, 0, -29), false},
+		{"notes/old.md", 10, now.AddDate(0, 0, -31), false},
+		{"api/ref.gen.md", 10, jan, true},
+		{"api/ref.gen.md", 10, jan.AddDate(0, 1, 0), false},
+	}
+	for _, tt := range tests {
+		if got := cfg.IsExcludedByRule(tt.path, tt.size, tt.modTime); got != tt.want {
+			t.Errorf("%s (%d bytes, %s): expected %v, got %v", tt.path, tt.size, tt.modTime, tt.want, got)
+		}
+	}
+
+	for _, rule := range []ExcludeRule{{Pattern: "*.md"}, {ModifiedBefore: "last week"}, {ModifiedAfter: "-3d"}} {
+		if err := rule.validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestIsMarkdownFile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ExtensionlessFiles = []string{"CHANGELOG", "License"}
+	for path, want := range map[string]bool{
+		"docs/guide.md":      true,
+		"notes.markdown":     true,
+		"main.go":            false,
+		"CHANGELOG":          true,
+		"repo/LICENSE":       true,
+		"repo/license":       true,
+		"Makefile":           false,
+		"CHANGELOG.txt":      false,
+		"v1.2/CHANGELOG":     true,
+		"changelog/NOTICE":   false,
+		"/abs/dir/Changelog": true,
+	} {
+		if got := cfg.IsMarkdownFile(path); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestEphemeralSaveWritesNothing(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := DefaultConfig()
+	cfg.configPath = tmpFile
+	cfg.Ephemeral = true
+
+	if err := cfg.AddFolder(t.TempDir(), "preview", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Errorf("expected no config file in ephemeral mode, stat err = %v", err)
+	}
+	if len(cfg.Folders) != 1 {
+		t.Errorf("expected the folder to stay in memory, got %d folders", len(cfg.Folders))
+	}
+}
+
+func TestGetAuditLogPath(t *testing.T) {
+	dir := t.TempDir()
+	cfg := DefaultConfig()
+	if got := cfg.GetAuditLogPath(); got != "" {
+		t.Errorf("expected no audit log without a config file, got %q", got)
+	}
+	cfg.configPath = filepath.Join(dir, "config.yaml")
+	if got, want := cfg.GetAuditLogPath(), filepath.Join(dir, "audit.log"); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	cfg.Ephemeral = true
+	if got := cfg.GetAuditLogPath(); got != "" {
+		t.Errorf("expected no audit log for an ephemeral session, got %q", got)
+	}
+	cfg.AuditLog = "/var/log/markhub/audit.log"
+	if got := cfg.GetAuditLogPath(); got != cfg.AuditLog {
+		t.Errorf("expected the configured audit log, got %q", got)
+	}
+	cfg.AuditLog = AuditLogOff
+	if got := cfg.GetAuditLogPath(); got != "" {
+		t.Errorf("expected audit_log: off to disable auditing, got %q", got)
+	}
+}
+
 func TestSaveAndLoad(t *testing.T) {
 	tmpFile := filepath.Join(t.TempDir(), "config.yaml")
 	cfg := DefaultConfig()
@@ -96,3 +354,424 @@ func TestSaveAndLoad(t *testing.T) {
 		t.Errorf("folder loading failed")
 	}
 }
+
+func TestValidateExposure(t *testing.T) {
+	tests := []struct {
+		name     string
+		expose   bool
+		insecure bool
+		token    string
+		wantErr  bool
+		wantHost string
+	}{
+		{"default loopback", false, false, "", false, "127.0.0.1"},
+		{"loopback with token", false, false, "secret", false, "127.0.0.1"},
+		{"expose without auth", true, false, "", true, "0.0.0.0"},
+		{"expose with auth", true, false, "secret", false, "0.0.0.0"},
+		{"expose insecure", true, true, "", false, "0.0.0.0"},
+		{"expose insecure with auth", true, true, "secret", false, "0.0.0.0"},
+		{"insecure without expose", false, true, "", true, "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Expose = tt.expose
+			cfg.ExposeInsecure = tt.insecure
+			cfg.AuthToken = tt.token
+
+			err := cfg.ValidateExposure()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateExposure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := cfg.ListenHost(); got != tt.wantHost {
+				t.Errorf("ListenHost() = %s, want %s", got, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestListenAddrs(t *testing.T) {
+	tests := []struct {
+		name      string
+		listen    []string
+		expose    bool
+		wantAddrs []string
+		wantLocal string
+		wantErr   bool
+	}{
+		{"default single address", nil, false, []string{"127.0.0.1:8080"}, "127.0.0.1:8080", false},
+		{"dual stack loopback", []string{"127.0.0.1:8080", "[::1]:8080"}, false,
+			[]string{"127.0.0.1:8080", "[::1]:8080"}, "127.0.0.1:8080", false},
+		{"ipv6 first", []string{"[::1]:9000"}, false, []string{"[::1]:9000"}, "[::1]:9000", false},
+		{"localhost name", []string{"localhost:9000"}, false, []string{"localhost:9000"}, "localhost:9000", false},
+		{"wildcard requires expose", []string{"0.0.0.0:8080"}, false, []string{"0.0.0.0:8080"}, "127.0.0.1:8080", true},
+		{"wildcard with expose", []string{"0.0.0.0:8080"}, true, []string{"0.0.0.0:8080"}, "127.0.0.1:8080", false},
+		{"ipv6 wildcard with expose", []string{"[::]:8080"}, true, []string{"[::]:8080"}, "[::1]:8080", false},
+		{"empty host with expose", []string{":8080"}, true, []string{":8080"}, "127.0.0.1:8080", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Listen = tt.listen
+			cfg.Expose = tt.expose
+			cfg.AuthToken = "secret"
+
+			if err := cfg.ValidateExposure(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateExposure() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := cfg.ListenAddrs(); strings.Join(got, ",") != strings.Join(tt.wantAddrs, ",") {
+				t.Errorf("ListenAddrs() = %v, want %v", got, tt.wantAddrs)
+			}
+			if got := cfg.LocalAddr(); got != tt.wantLocal {
+				t.Errorf("LocalAddr() = %s, want %s", got, tt.wantLocal)
+			}
+		})
+	}
+}
+
+func TestListenRejectsIgnoredFlags(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Listen = []string{"127.0.0.1:9000"}
+	cfg.portFromFlag = true
+	if err := cfg.ValidateExposure(); err == nil {
+		t.Error("expected an explicit --port to be rejected alongside listen")
+	}
+
+	cfg = DefaultConfig()
+	cfg.Listen = []string{"127.0.0.1:9000", "[::1]:9000"}
+	cfg.Expose = true
+	cfg.AuthToken = "secret"
+	if err := cfg.ValidateExposure(); err == nil {
+		t.Error("expected --expose to be rejected when every listen address is loopback")
+	}
+}
+
+func TestValidateListenAddr(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:8080", "[::1]:8080", ":0", "localhost:65535"} {
+		if err := validateListenAddr(addr); err != nil {
+			t.Errorf("validateListenAddr(%q) = %v, want nil", addr, err)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1", "::1:8080", "localhost:http", "localhost:70000"} {
+		if err := validateListenAddr(addr); err == nil {
+			t.Errorf("validateListenAddr(%q) = nil, want error", addr)
+		}
+	}
+}
+
+func TestValidAnchorPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "mh-", "doc_1-"} {
+		if !validAnchorPrefix(prefix) {
+			t.Errorf("validAnchorPrefix(%q) = false, want true", prefix)
+		}
+	}
+	for _, prefix := range []string{"1-", "-mh", "mh ", "mh#", "é-"} {
+		if validAnchorPrefix(prefix) {
+			t.Errorf("validAnchorPrefix(%q) = true, want false", prefix)
+		}
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	for _, w := range []Webhook{
+		{URL: "https://hooks.example.com/x"},
+		{URL: "http://127.0.0.1:9000", Events: []string{"create", "remove"}, Template: "slack"},
+	} {
+		if err := w.validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", w, err)
+		}
+	}
+	for _, w := range []Webhook{
+		{},
+		{URL: "hooks.example.com/x"},
+		{URL: "ftp://example.com"},
+		{URL: "https://example.com", BaseURL: "/docs"},
+		{URL: "https://example.com", Events: []string{"rename"}},
+		{URL: "https://example.com", Template: "teams"},
+	} {
+		if err := w.validate(); err == nil {
+			t.Errorf("%+v: expected an error", w)
+		}
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	var defaults CacheConfig
+	if defaults.HTMLControl() != "no-cache" || defaults.RawControl() != "" || defaults.AssetControl() != "" ||
+		defaults.CSSControl() != "" {
+		t.Errorf("unexpected defaults %q %q %q %q", defaults.HTMLControl(), defaults.RawControl(),
+			defaults.AssetControl(), defaults.CSSControl())
+	}
+	c := CacheConfig{HTML: "none", Asset: "public, max-age=86400, immutable"}
+	if c.HTMLControl() != "" || c.AssetControl() != "public, max-age=86400, immutable" {
+		t.Errorf("unexpected values %q %q", c.HTMLControl(), c.AssetControl())
+	}
+
+	for _, c := range []CacheConfig{
+		{},
+		{HTML: "none", Raw: "no-store"},
+		{Asset: "public, max-age=86400, stale-while-revalidate=60", CSS: "Private,MAX-AGE=0"},
+	} {
+		if err := c.validate(); err != nil {
+			t.Errorf("%+v: unexpected error %v", c, err)
+		}
+	}
+	for _, c := range []CacheConfig{
+		{HTML: "forever"},
+		{Raw: "max-age"},
+		{Asset: "max-age=-1"},
+		{CSS: "max-age=1d"},
+		{HTML: "no-cache=1"},
+		{Raw: "public,"},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
+
+func TestAliasPathFor(t *testing.T) {
+	root := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.Folders = []Folder{
+		{Path: filepath.Join(root, "repo"), Alias: "repo (main)", GitRef: "main"},
+		{Path: filepath.Join(root, "docs"), Alias: "docs"},
+	}
+
+	got, ok := cfg.AliasPathFor(filepath.Join(root, "docs", "guide", "intro.md"))
+	if !ok || got != "docs/guide/intro.md" {
+		t.Errorf("expected docs/guide/intro.md, got %q (ok=%v)", got, ok)
+	}
+	if _, ok := cfg.AliasPathFor(filepath.Join(root, "repo", "README.md")); ok {
+		t.Error("expected git_ref folders to be skipped")
+	}
+	if _, ok := cfg.AliasPathFor(filepath.Join(root, "other.md")); ok {
+		t.Error("expected path outside all folders not to resolve")
+	}
+}
+
+func TestPreviewFile(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"docs", "notes"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "today.md"), []byte("# Today\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpFile := filepath.Join(root, "config.yaml")
+	cfg := DefaultConfig()
+	cfg.configPath = tmpFile
+	cfg.Folders = []Folder{
+		{ID: "docs", Path: filepath.Join(root, "docs"), Alias: "docs"},
+		{ID: "other", Path: filepath.Join(root, "elsewhere"), Alias: "notes"},
+	}
+
+	got, err := cfg.PreviewFile(filepath.Join(root, "docs", "today.md"))
+	if err != nil || got != "docs/today.md" {
+		t.Fatalf("expected docs/today.md from the existing folder, got %q (%v)", got, err)
+	}
+	if len(cfg.Folders) != 2 {
+		t.Fatalf("expected no folder to be added, got %d", len(cfg.Folders))
+	}
+
+	got, err = cfg.PreviewFile(filepath.Join(root, "notes", "today.md"))
+	if err != nil || got != "notes-2/today.md" {
+		t.Fatalf("expected notes-2/today.md from a temporary folder, got %q (%v)", got, err)
+	}
+	if f := cfg.Folders[2]; !f.Temporary || f.Path != filepath.Join(root, "notes") {
+		t.Errorf("expected a temporary folder for the parent directory, got %+v", f)
+	}
+
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved := &Config{}
+	if err := saved.loadFromFile(tmpFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Folders) != 2 {
+		t.Errorf("expected temporary folders not to be saved, got %d folders", len(saved.Folders))
+	}
+
+	for _, bad := range []string{filepath.Join(root, "docs"), filepath.Join(root, "missing.md"), tmpFile} {
+		if _, err := cfg.PreviewFile(bad); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestLoadFromStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString("port: 9191\nfolders:\n  - path: /srv/docs\n    alias: docs\n"); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	cfg := DefaultConfig()
+	if err := cfg.loadFromFile(StdinConfigPath); err != nil {
+		t.Fatalf("loadFromFile(-) failed: %v", err)
+	}
+	if cfg.Port != 9191 || len(cfg.Folders) != 1 || cfg.Folders[0].Alias != "docs" {
+		t.Errorf("unexpected config from stdin: port=%d folders=%+v", cfg.Port, cfg.Folders)
+	}
+
+	// Save must never create a file named "-", with or without --no-save
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+	cfg.configPath = StdinConfigPath
+	for _, ephemeral := range []bool{false, true} {
+		cfg.Ephemeral = ephemeral
+		if err := cfg.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, StdinConfigPath)); !os.IsNotExist(err) {
+			t.Errorf("expected no config file to be written (ephemeral=%v), stat err = %v", ephemeral, err)
+		}
+	}
+}
+
+func TestSaveLeavesOutLaunchOptions(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := DefaultConfig()
+	cfg.configPath = tmpFile
+	cfg.Open = true
+	cfg.OpenPath = "docs/today.md"
+
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "open") {
+		t.Errorf("expected --open and --open-path not to be saved, got:\n%s", data)
+	}
+}
+
+func TestSaveKeepsEnvAuthTokenOutOfFile(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := DefaultConfig()
+	cfg.configPath = tmpFile
+	cfg.fileAuthToken = "from-file"
+	cfg.AuthToken = "from-env"
+	cfg.authTokenFromEnv = true
+
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved := &Config{}
+	if err := saved.loadFromFile(tmpFile); err != nil {
+		t.Fatal(err)
+	}
+	if saved.AuthToken != "from-file" {
+		t.Errorf("expected the file token to be saved, got %q", saved.AuthToken)
+	}
+}
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadFromFileAnchorsAndIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"config.yaml": `port: 9292
+shared: &drafts ["drafts/**", "tmp/**"]
+folders:
+  - path: /srv/a
+    alias: a
+    exclude: *drafts
+  - path: /srv/b
+    alias: b
+    exclude: !include excludes/common.yaml
+  - <<: !include folders/c.yaml
+    alias: c
+`,
+		"excludes/common.yaml": "!include vendor.yaml\n",
+		"excludes/vendor.yaml": "[vendor/**, node_modules/**]\n",
+		"folders/c.yaml":       "path: /srv/c\nalias: overridden\nexclude: [archive/**]\n",
+	})
+
+	cfg := DefaultConfig()
+	if err := cfg.loadFromFile(filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("loadFromFile failed: %v", err)
+	}
+	if cfg.Port != 9292 || len(cfg.Folders) != 3 {
+		t.Fatalf("unexpected config: port=%d folders=%+v", cfg.Port, cfg.Folders)
+	}
+	if got := strings.Join(cfg.Folders[0].Exclude, ","); got != "drafts/**,tmp/**" {
+		t.Errorf("expected the anchored excludes, got %q", got)
+	}
+	// Nested includes resolve relative to the including file
+	if got := strings.Join(cfg.Folders[1].Exclude, ","); got != "vendor/**,node_modules/**" {
+		t.Errorf("expected the included excludes, got %q", got)
+	}
+	c := cfg.Folders[2]
+	if c.Path != "/srv/c" || c.Alias != "c" || len(c.Exclude) != 1 {
+		t.Errorf("expected the merged include with a local alias, got %+v", c)
+	}
+}
+
+func TestLoadFromFileIncludeErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"cycle.yaml":   "exclude: !include a.yaml\n",
+		"a.yaml":       "!include b.yaml\n",
+		"b.yaml":       "!include a.yaml\n",
+		"self.yaml":    "exclude: !include self.yaml\n",
+		"missing.yaml": "exclude: !include nope.yaml\n",
+	})
+
+	for _, name := range []string{"cycle.yaml", "self.yaml"} {
+		err := DefaultConfig().loadFromFile(filepath.Join(dir, name))
+		if !errors.Is(err, ErrIncludeCycle) {
+			t.Errorf("%s: expected an include cycle error, got %v", name, err)
+		}
+	}
+	if err := DefaultConfig().loadFromFile(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected a missing include to fail")
+	}
+}
+
+func TestTrustedProxyNets(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TrustedProxies = []string{"127.0.0.1", "10.0.0.0/8", "::1"}
+	nets, err := cfg.TrustedProxyNets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 3 || nets[0].String() != "127.0.0.1/32" || nets[2].String() != "::1/128" {
+		t.Errorf("unexpected nets %v", nets)
+	}
+
+	for _, bad := range []string{"localhost", "10.0.0.0/33", ""} {
+		cfg.TrustedProxies = []string{bad}
+		if _, err := cfg.TrustedProxyNets(); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeTag marks a scalar whose value is the path of a YAML file to splice in its place
+const includeTag = "!include"
+
+// ErrIncludeCycle is returned when config files include each other
+var ErrIncludeCycle = errors.New("config include cycle")
+
+// parseYAML parses a config document and resolves its !include tags. Relative include paths are
+// resolved against dir, the directory of the file being parsed. An empty document yields nil.
+func parseYAML(data []byte, dir string, chain []string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if err := resolveIncludes(root, dir, chain); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// resolveIncludes replaces every "!include path" scalar below node with the root of that file.
+// chain holds the absolute paths of the files currently being included, to detect cycles.
+func resolveIncludes(node *yaml.Node, dir string, chain []string) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == includeTag {
+		included, err := loadInclude(node.Value, dir, chain)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		if included == nil {
+			// An empty file includes null
+			*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Line: node.Line, Column: node.Column}
+			return nil
+		}
+		// Replaced in place, so aliases of an anchored !include see the included value
+		*node = *included
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := resolveIncludes(child, dir, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadInclude reads and parses the file an !include refers to
+func loadInclude(name, dir string, chain []string) (*yaml.Node, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("!include needs a file path")
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range chain {
+		if p == path {
+			return nil, fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(chain, path), " -> "))
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("!include %s: %w", name, err)
+	}
+	root, err := parseYAML(data, filepath.Dir(path), append(chain, path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return root, nil
+}
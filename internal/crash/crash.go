@@ -0,0 +1,179 @@
+// Package crash is the sink for recovered panics: each one is logged with its stack, counted
+// and kept in a crash log holding the most recent reports.
+package crash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultKeep is how many reports the crash log holds
+const DefaultKeep = 20
+
+// Report is a single recovered panic
+type Report struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	RequestID string    `json:"requestId,omitempty"`
+	Value     string    `json:"value"`
+	Stack     string    `json:"stack"`
+}
+
+// Reporter logs and counts panics and keeps the last reports in a JSON-lines file
+type Reporter struct {
+	path  string
+	keep  int
+	mu    sync.Mutex
+	count atomic.Int64
+}
+
+// New creates a Reporter keeping the last keep reports in path; an empty path only logs and counts
+func New(path string, keep int) *Reporter {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	return &Reporter{path: path, keep: keep}
+}
+
+// Count returns the number of panics reported so far
+func (r *Reporter) Count() int64 {
+	return r.count.Load()
+}
+
+// Record reports a panic recovered from source. A nil stack is replaced by the caller's.
+// Failures to write the crash log are logged as warnings and never returned.
+func (r *Reporter) Record(source, requestID string, value any, stack []byte) {
+	if stack == nil {
+		stack = debug.Stack()
+	}
+	r.count.Add(1)
+	if requestID != "" {
+		log.Printf("PANIC in %s (request %s): %v\n%s", source, requestID, value, stack)
+	} else {
+		log.Printf("PANIC in %s: %v\n%s", source, value, stack)
+	}
+	if r.path == "" {
+		return
+	}
+	rep := Report{
+		Time:      time.Now().UTC(),
+		Source:    source,
+		RequestID: requestID,
+		Value:     fmt.Sprint(value),
+		Stack:     string(stack),
+	}
+	if err := r.append(rep); err != nil {
+		log.Printf("Warning: failed to write crash log: %v", err)
+	}
+}
+
+// append adds rep to the crash log and drops all but the last r.keep reports
+func (r *Reporter) append(rep Report) error {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lines, err := readLines(r.path)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, data)
+	if len(lines) > r.keep {
+		lines = lines[len(lines)-r.keep:]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, append(bytes.Join(lines, []byte("\n")), '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// Reports returns the reports in the crash log, oldest first
+func (r *Reporter) Reports() ([]Report, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines, err := readLines(r.path)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(lines))
+	for _, line := range lines {
+		var rep Report
+		if json.Unmarshal(line, &rep) == nil {
+			reports = append(reports, rep)
+		}
+	}
+	return reports, nil
+}
+
+func readLines(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, bytes.Clone(scanner.Bytes()))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+var std atomic.Pointer[Reporter]
+
+func init() {
+	std.Store(New("", DefaultKeep))
+}
+
+// SetDefault replaces the Reporter used by Recover and the package-level functions
+func SetDefault(r *Reporter) {
+	std.Store(r)
+}
+
+// Default returns the Reporter used by Recover and the package-level functions
+func Default() *Reporter {
+	return std.Load()
+}
+
+// Record reports a panic to the default Reporter
+func Record(source, requestID string, value any, stack []byte) {
+	Default().Record(source, requestID, value, stack)
+}
+
+// Count returns the number of panics the default Reporter has seen
+func Count() int64 {
+	return Default().Count()
+}
+
+// Recover reports a panic in the calling goroutine to the default Reporter and stops it from
+// crashing the process. It must be deferred directly:
+//
+//	defer crash.Recover("watcher")
+func Recover(source string) {
+	if v := recover(); v != nil {
+		Default().Record(source, "", v, debug.Stack())
+	}
+}
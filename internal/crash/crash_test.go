@@ -0,0 +1,55 @@
+package crash
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecord_KeepsLastReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "crash.log")
+	r := New(path, 3)
+
+	for i := 0; i < 5; i++ {
+		r.Record("test", fmt.Sprintf("req%d", i), fmt.Sprintf("boom %d", i), nil)
+	}
+
+	if r.Count() != 5 {
+		t.Errorf("expected 5 panics counted, got %d", r.Count())
+	}
+	reports, err := r.Reports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("expected the log trimmed to 3 reports, got %d", len(reports))
+	}
+	for i, rep := range reports {
+		if rep.Value != fmt.Sprintf("boom %d", i+2) || rep.RequestID != fmt.Sprintf("req%d", i+2) {
+			t.Errorf("unexpected report %d: %+v", i, rep)
+		}
+		if rep.Source != "test" || rep.Time.IsZero() || !strings.Contains(rep.Stack, "goroutine") {
+			t.Errorf("incomplete report %d: %+v", i, rep)
+		}
+	}
+}
+
+func TestRecover_StopsPanic(t *testing.T) {
+	prev := Default()
+	r := New("", 0)
+	SetDefault(r)
+	defer SetDefault(prev)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer Recover("goroutine")
+		panic("boom")
+	}()
+	<-done
+
+	if r.Count() != 1 {
+		t.Errorf("expected the panic to be counted, got %d", r.Count())
+	}
+}
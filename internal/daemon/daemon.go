@@ -0,0 +1,176 @@
+// Package daemon runs MarkHub in the background and manages it through a pidfile.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotRunning is returned when no live MarkHub process is recorded in the pidfile.
+var ErrNotRunning = errors.New("markhub is not running")
+
+// startupGrace is how long Start waits for the child to crash before declaring success.
+const startupGrace = time.Second
+
+// stopTimeout bounds how long Stop waits for the process to exit after SIGTERM.
+const stopTimeout = 15 * time.Second
+
+// Options configures a background server launch.
+type Options struct {
+	// Args are passed to the re-executed binary (e.g. "serve", "--path", ".").
+	Args []string
+	// PidFile is where the child's PID and health address are recorded.
+	PidFile string
+	// LogFile receives the child's stdout and stderr.
+	LogFile string
+	// Addr is the loopback host:port used for health checks.
+	Addr string
+}
+
+// Info describes a running (or stale) daemon as recorded in the pidfile.
+type Info struct {
+	PID     int
+	Addr    string
+	Healthy bool
+}
+
+// Start re-executes the current binary detached from the terminal and writes the pidfile.
+func Start(opts Options) (int, error) {
+	if err := checkSupported(); err != nil {
+		return 0, err
+	}
+	if info, err := readPidFile(opts.PidFile); err == nil {
+		if processAlive(info.PID) {
+			return 0, fmt.Errorf("markhub is already running (pid %d)", info.PID)
+		}
+		_ = os.Remove(opts.PidFile)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("locate executable: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.LogFile), 0755); err != nil {
+		return 0, err
+	}
+	logFile, err := os.OpenFile(opts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("open log file: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	cmd := exec.Command(exe, opts.Args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Stdin = nil
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("start background process: %w", err)
+	}
+
+	// Report immediate startup failures (bad config, port in use) instead of a dead pidfile
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return 0, fmt.Errorf("markhub exited during startup (%v); see %s", err, opts.LogFile)
+	case <-time.After(startupGrace):
+	}
+
+	if err := writePidFile(opts.PidFile, cmd.Process.Pid, opts.Addr); err != nil {
+		return 0, err
+	}
+	return cmd.Process.Pid, nil
+}
+
+// Stop sends SIGTERM to the recorded process and waits for it to exit.
+func Stop(pidFile string) (int, error) {
+	if err := checkSupported(); err != nil {
+		return 0, err
+	}
+	info, err := readPidFile(pidFile)
+	if err != nil {
+		return 0, ErrNotRunning
+	}
+	if !processAlive(info.PID) {
+		_ = os.Remove(pidFile)
+		return 0, fmt.Errorf("%w (removed stale pidfile for pid %d)", ErrNotRunning, info.PID)
+	}
+	if err := terminate(info.PID); err != nil {
+		return 0, fmt.Errorf("signal pid %d: %w", info.PID, err)
+	}
+
+	deadline := time.Now().Add(stopTimeout)
+	for processAlive(info.PID) {
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("pid %d did not exit within %s", info.PID, stopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	_ = os.Remove(pidFile)
+	return info.PID, nil
+}
+
+// Status reports the recorded process and whether its health endpoint responds.
+// A pidfile pointing at a dead process is removed and reported as ErrNotRunning.
+func Status(pidFile string) (Info, error) {
+	if err := checkSupported(); err != nil {
+		return Info{}, err
+	}
+	info, err := readPidFile(pidFile)
+	if err != nil {
+		return Info{}, ErrNotRunning
+	}
+	if !processAlive(info.PID) {
+		_ = os.Remove(pidFile)
+		return Info{}, fmt.Errorf("%w (removed stale pidfile for pid %d)", ErrNotRunning, info.PID)
+	}
+	info.Healthy = checkHealth(info.Addr)
+	return info, nil
+}
+
+func checkHealth(addr string) bool {
+	if addr == "" {
+		return false
+	}
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get("http://" + addr + "/api/health")
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// writePidFile records "<pid>\n<addr>\n".
+func writePidFile(path string, pid int, addr string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(fmt.Sprintf("%d\n%s\n", pid, addr)), 0644)
+}
+
+func readPidFile(path string) (Info, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Info{}, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil || pid <= 0 {
+		return Info{}, fmt.Errorf("invalid pidfile %s", path)
+	}
+	info := Info{PID: pid}
+	if len(lines) > 1 {
+		info.Addr = strings.TrimSpace(lines[1])
+	}
+	return info, nil
+}
@@ -0,0 +1,54 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatus_StalePidFile(t *testing.T) {
+	// Run and reap a short-lived process so its PID is known to be gone
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run helper process: %v", err)
+	}
+	pidFile := filepath.Join(t.TempDir(), "markhub.pid")
+	if err := writePidFile(pidFile, cmd.Process.Pid, "127.0.0.1:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Status(pidFile); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning, got %v", err)
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Error("expected stale pidfile to be removed")
+	}
+}
+
+func TestStatus_Running(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "markhub.pid")
+	if err := writePidFile(pidFile, os.Getpid(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Status(pidFile)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if info.PID != os.Getpid() {
+		t.Errorf("expected pid %d, got %d", os.Getpid(), info.PID)
+	}
+	if info.Healthy {
+		t.Error("expected unhealthy without a health address")
+	}
+}
+
+func TestStop_NoPidFile(t *testing.T) {
+	if _, err := Stop(filepath.Join(t.TempDir(), "missing.pid")); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("expected ErrNotRunning, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// checkSupported reports whether background mode works on this platform.
+func checkSupported() error {
+	return nil
+}
+
+// detach starts the child in its own session so it survives the parent terminal closing.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// terminate asks the process to shut down gracefully.
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
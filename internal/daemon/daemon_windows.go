@@ -0,0 +1,24 @@
+//go:build windows
+
+package daemon
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// checkSupported explains how to run MarkHub in the background on Windows.
+func checkSupported() error {
+	return errors.New(
+		"background mode is not supported on Windows; run `markhub serve` under a service wrapper such as NSSM instead")
+}
+
+func detach(_ *exec.Cmd) {}
+
+func processAlive(_ int) bool {
+	return false
+}
+
+func terminate(_ int) error {
+	return checkSupported()
+}
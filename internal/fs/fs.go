@@ -24,3 +24,78 @@ type FileSystem interface {
 	Stat(path string) (FileInfo, error)
 	ReadDir(path string) ([]DirEntry, error)
 }
+
+// limitedDirReader is implemented by file systems that can stop reading a directory early.
+type limitedDirReader interface {
+	readDirLimit(path string, n int) ([]DirEntry, bool, error)
+}
+
+// ReadDirLimit lists at most n children of the directory at path, and reports whether there were
+// more. Which children are kept is unspecified: LocalFS stops reading the directory once it has
+// n+1 entries, so a huge directory costs no more than a small one.
+func ReadDirLimit(fsys FileSystem, path string, n int) ([]DirEntry, bool, error) {
+	if l, ok := fsys.(limitedDirReader); ok {
+		return l.readDirLimit(path, n)
+	}
+	entries, err := fsys.ReadDir(path)
+	if err != nil || len(entries) <= n {
+		return entries, false, err
+	}
+	return entries[:n], true, nil
+}
+
+// WriteOptions controls how WritableFS.WriteFile writes a file.
+type WriteOptions struct {
+	// Exclusive fails with an error satisfying os.IsExist when the file already exists, instead of
+	// replacing it
+	Exclusive bool
+	// Parents creates missing parent directories
+	Parents bool
+}
+
+// WritableFS is a FileSystem that can also change files. Only LocalFS implements it: git refs are
+// read-only, and ReadOnlyFS hides it for folders not configured writable.
+type WritableFS interface {
+	FileSystem
+	// WriteFile writes a file atomically, so readers see the old or the new content and never part
+	// of it; a replaced file keeps its permissions
+	WriteFile(path string, data []byte, opts WriteOptions) error
+	// Mkdir fails with an error satisfying os.IsExist when path already exists
+	Mkdir(path string, parents bool) error
+	// Rename moves a file or directory, failing with an error satisfying os.IsExist when newPath
+	// already exists. With parents, missing parent directories of newPath are created.
+	Rename(oldPath, newPath string, parents bool) error
+	// Remove deletes a file or a directory with everything below it. With toTrash it is moved into
+	// the trash instead, and the trash ID is returned.
+	Remove(path string, toTrash bool) (string, error)
+}
+
+// ReadOnlyFS wraps a FileSystem and exposes only its read methods, so a type assertion to
+// WritableFS fails even when the wrapped one is writable.
+type ReadOnlyFS struct {
+	fs FileSystem
+}
+
+// NewReadOnlyFS returns fs with its write methods hidden.
+func NewReadOnlyFS(fs FileSystem) ReadOnlyFS {
+	return ReadOnlyFS{fs: fs}
+}
+
+// ReadFile reads the file at path from the wrapped FileSystem.
+func (r ReadOnlyFS) ReadFile(path string) ([]byte, error) {
+	return r.fs.ReadFile(path)
+}
+
+// Stat returns metadata from the wrapped FileSystem.
+func (r ReadOnlyFS) Stat(path string) (FileInfo, error) {
+	return r.fs.Stat(path)
+}
+
+// ReadDir lists a directory of the wrapped FileSystem.
+func (r ReadOnlyFS) ReadDir(path string) ([]DirEntry, error) {
+	return r.fs.ReadDir(path)
+}
+
+func (r ReadOnlyFS) readDirLimit(path string, n int) ([]DirEntry, bool, error) {
+	return ReadDirLimit(r.fs, path, n)
+}
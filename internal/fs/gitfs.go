@@ -1,7 +1,10 @@
 package fs
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strconv"
@@ -13,17 +16,30 @@ import (
 type GitFS struct {
 	repoPath string
 	ref      string
+	ctx      context.Context
 }
 
 // NewGitFS creates a GitFS that reads files from the given ref in the repository at repoPath.
 func NewGitFS(repoPath, ref string) *GitFS {
-	return &GitFS{repoPath: repoPath, ref: ref}
+	return &GitFS{repoPath: repoPath, ref: ref, ctx: context.Background()}
 }
 
-func (g *GitFS) git(args ...string) (string, error) {
-	cmd := exec.Command("git", append([]string{"-C", g.repoPath}, args...)...)
+// WithContext returns a copy of g whose git commands are killed when ctx is done.
+func (g *GitFS) WithContext(ctx context.Context) *GitFS {
+	c := *g
+	c.ctx = ctx
+	return &c
+}
+
+// command builds a git command against the repository, bound to the GitFS context.
+func (g *GitFS) command(args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(g.ctx, "git", append([]string{"-C", g.repoPath}, args...)...)
 	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-	out, err := cmd.Output()
+	return cmd
+}
+
+func (g *GitFS) git(args ...string) (string, error) {
+	out, err := g.command(args...).Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
@@ -33,15 +49,49 @@ func (g *GitFS) git(args ...string) (string, error) {
 	return string(out), nil
 }
 
+// Commit returns the hash of the commit the ref currently points to.
+func (g *GitFS) Commit() (string, error) {
+	out, err := g.git("rev-parse", "--verify", g.ref+"^{commit}")
+	return strings.TrimSpace(out), err
+}
+
+// Refs are the branches and tags of a repository.
+type Refs struct {
+	Branches []string `json:"branches"`
+	Tags     []string `json:"tags"`
+	// Head is the branch checked out, or the commit hash when HEAD is detached; empty before the first commit
+	Head string `json:"head,omitempty"`
+}
+
+// Refs lists the local branches and the tags of the repository, sorted by name, and its HEAD.
+func (g *GitFS) Refs() (Refs, error) {
+	out, err := g.git("for-each-ref", "--format=%(refname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return Refs{}, err
+	}
+	refs := Refs{Branches: []string{}, Tags: []string{}}
+	for _, name := range strings.Fields(out) {
+		if branch, ok := strings.CutPrefix(name, "refs/heads/"); ok {
+			refs.Branches = append(refs.Branches, branch)
+		} else if tag, ok := strings.CutPrefix(name, "refs/tags/"); ok {
+			refs.Tags = append(refs.Tags, tag)
+		}
+	}
+	if head, err := g.git("symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		refs.Head = strings.TrimSpace(head)
+	} else if head, err := g.git("rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		refs.Head = strings.TrimSpace(head)
+	}
+	return refs, g.ctx.Err()
+}
+
 // ReadFile reads the contents of the file at the given path from the git ref.
 func (g *GitFS) ReadFile(path string) ([]byte, error) {
 	objPath := path
 	if objPath == "" || objPath == "." {
 		return nil, fmt.Errorf("cannot read directory as file")
 	}
-	cmd := exec.Command("git", "-C", g.repoPath, "show", g.ref+":"+objPath)
-	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-	out, err := cmd.Output()
+	out, err := g.command("show", g.ref+":"+objPath).Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			stderr := strings.TrimSpace(string(exitErr.Stderr))
@@ -194,6 +244,54 @@ func (g *GitFS) ReadDir(path string) ([]DirEntry, error) {
 	return entries, nil
 }
 
+// Archive writes the tree of the ref under subPath ("" for the whole tree) to w as a "tar" or
+// "zip" archive made by git archive, with prefix prepended to every entry. Entries for which
+// exclude returns true are left out, with everything under them; the tree is listed once to
+// find them, and exclude may be nil to keep every entry. The archive is streamed, so w may have
+// received part of it when an error is returned.
+func (g *GitFS) Archive(w io.Writer, format, prefix, subPath string, exclude func(path string, isDir bool) bool) error {
+	pathspec := subPath
+	if pathspec == "" {
+		pathspec = "."
+	}
+	args := []string{"archive", "--format=" + format, "--prefix=" + prefix, g.ref, "--", pathspec}
+	if exclude != nil {
+		out, err := g.git("ls-tree", "-r", "-t", "-z", g.ref, "--", pathspec)
+		if err != nil {
+			return err
+		}
+		excludedDir := ""
+		for _, line := range strings.Split(out, "\x00") {
+			// Format: "<mode> <type> <hash>\t<path>"; -t lists each tree before its entries
+			meta, path, ok := strings.Cut(line, "\t")
+			if !ok || path == subPath {
+				continue
+			}
+			if excludedDir != "" && strings.HasPrefix(path, excludedDir) {
+				continue
+			}
+			isDir := strings.Contains(meta, " tree ")
+			if exclude(path, isDir) {
+				args = append(args, ":(exclude,literal)"+path)
+				if isDir {
+					excludedDir = path + "/"
+				}
+			}
+		}
+	}
+	cmd := g.command(args...)
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git archive: %s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
 func (g *GitFS) getModTime(path string) time.Time {
 	var args []string
 	if path == "." || path == "" {
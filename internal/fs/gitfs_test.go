@@ -1,9 +1,14 @@
 package fs
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -139,3 +144,173 @@ func TestGitFS_ReadFile_NotExist(t *testing.T) {
 		t.Error("expected error for nonexistent file")
 	}
 }
+
+func TestGitFS_WithContext_Canceled(t *testing.T) {
+	dir := setupTestRepo(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g := NewGitFS(dir, "HEAD").WithContext(ctx)
+
+	if _, err := g.ReadFile("README.md"); err == nil {
+		t.Error("expected ReadFile to fail with a canceled context")
+	}
+	if _, err := g.ReadDir(""); err == nil {
+		t.Error("expected ReadDir to fail with a canceled context")
+	}
+
+	// The original GitFS is unaffected
+	if _, err := NewGitFS(dir, "HEAD").ReadFile("README.md"); err != nil {
+		t.Errorf("ReadFile without context failed: %v", err)
+	}
+}
+
+func TestGitFS_Commit(t *testing.T) {
+	dir := setupTestRepo(t)
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := NewGitFS(dir, "HEAD").Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := string(out[:len(out)-1]); commit != want {
+		t.Errorf("expected %s, got %s", want, commit)
+	}
+	if _, err := NewGitFS(dir, "no-such-branch").Commit(); err == nil {
+		t.Error("expected an error for a missing ref")
+	}
+}
+
+func TestGitFS_Refs(t *testing.T) {
+	dir := setupTestRepo(t)
+	for _, args := range [][]string{{"checkout", "-q", "-b", "feature"}, {"tag", "v1.0"}} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	refs, err := NewGitFS(dir, "HEAD").Refs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs.Branches) != 2 || refs.Branches[0] != "feature" || len(refs.Tags) != 1 || refs.Tags[0] != "v1.0" ||
+		refs.Head != "feature" {
+		t.Errorf("unexpected refs %+v", refs)
+	}
+
+	if out, err := exec.Command("git", "-C", dir, "checkout", "-q", "--detach").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout failed: %v\n%s", err, out)
+	}
+	commit, _ := NewGitFS(dir, "HEAD").Commit()
+	if refs, err := NewGitFS(dir, "HEAD").Refs(); err != nil || refs.Head != commit {
+		t.Errorf("expected the detached HEAD %s, got %+v (%v)", commit, refs, err)
+	}
+	if _, err := NewGitFS(t.TempDir(), "HEAD").Refs(); err == nil {
+		t.Error("expected an error outside a repository")
+	}
+}
+
+func TestGitFS_Blame(t *testing.T) {
+	dir := setupTestRepo(t)
+	first, err := NewGitFS(dir, "HEAD").Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	guide := filepath.Join(dir, "docs", "guide.md")
+	if err := os.WriteFile(guide, []byte("# Guide\n\nHello there.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "-C", dir, "-c", "user.name=Editor", "-c", "user.email=editor@test.com",
+		"commit", "-q", "-am", "edit guide")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit failed: %v\n%s", err, out)
+	}
+	second, err := NewGitFS(dir, "HEAD").Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blame, err := NewGitFS(dir, "HEAD").Blame("docs/guide.md")
+	if err != nil {
+		t.Fatalf("Blame failed: %v", err)
+	}
+	want := []BlameLine{{1, first}, {2, first}, {3, second}}
+	if len(blame.Lines) != len(want) {
+		t.Fatalf("expected %d lines, got %+v", len(want), blame.Lines)
+	}
+	for i, line := range want {
+		if blame.Lines[i] != line {
+			t.Errorf("line %d: expected %+v, got %+v", i+1, line, blame.Lines[i])
+		}
+	}
+	if c := blame.Commits[second]; c.AuthorName != "Editor" || c.AuthorEmail != "editor@test.com" ||
+		c.Subject != "edit guide" || c.Date.IsZero() {
+		t.Errorf("unexpected commit %+v", c)
+	}
+	if c := blame.Commits[first]; c.AuthorName != "Test" || c.Subject != "initial commit" {
+		t.Errorf("unexpected commit %+v", c)
+	}
+
+	// The ref's version is blamed, not the working tree's
+	old, err := NewGitFS(dir, first).Blame("docs/guide.md")
+	if err != nil || len(old.Commits) != 1 || old.Lines[2].Hash != first {
+		t.Errorf("expected the first commit alone at %s, got %+v (%v)", first, old, err)
+	}
+
+	if _, err := NewGitFS(dir, "HEAD").Blame("missing.md"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestGitFS_Archive(t *testing.T) {
+	dir := setupTestRepo(t)
+	g := NewGitFS(dir, "HEAD")
+	entries := func(subPath string, exclude func(string, bool) bool) []string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := g.Archive(&buf, "tar", "export/", subPath, exclude); err != nil {
+			t.Fatalf("Archive failed: %v", err)
+		}
+		var names []string
+		tr := tar.NewReader(&buf)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return names
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Typeflag != tar.TypeXGlobalHeader {
+				names = append(names, hdr.Name)
+			}
+		}
+	}
+
+	if got := entries("", nil); !slices.Equal(got, []string{"export/", "export/README.md", "export/docs/",
+		"export/docs/guide.md"}) {
+		t.Errorf("unexpected entries %v", got)
+	}
+	if got := entries("docs", nil); !slices.Equal(got, []string{"export/", "export/docs/", "export/docs/guide.md"}) {
+		t.Errorf("unexpected entries under docs %v", got)
+	}
+	var seen []string
+	excludeDocs := func(path string, isDir bool) bool {
+		seen = append(seen, path)
+		return isDir && path == "docs"
+	}
+	if got := entries("", excludeDocs); !slices.Equal(got, []string{"export/", "export/README.md"}) {
+		t.Errorf("unexpected entries without docs %v", got)
+	}
+	if !slices.Equal(seen, []string{"README.md", "docs"}) {
+		t.Errorf("expected nothing under an excluded directory to be checked, got %v", seen)
+	}
+
+	zip := &bytes.Buffer{}
+	if err := g.Archive(zip, "zip", "", "", nil); err != nil || !bytes.HasPrefix(zip.Bytes(), []byte("PK")) {
+		t.Errorf("expected a zip archive (%v)", err)
+	}
+	if err := NewGitFS(dir, "no-such-branch").Archive(io.Discard, "tar", "", "", nil); err == nil {
+		t.Error("expected an error for a missing ref")
+	}
+}
@@ -1,8 +1,11 @@
 package fs
 
 import (
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // LocalFS implements FileSystem using the local filesystem.
@@ -56,3 +59,126 @@ func (l *LocalFS) ReadDir(path string) ([]DirEntry, error) {
 	}
 	return result, nil
 }
+
+func (l *LocalFS) readDirLimit(path string, n int) ([]DirEntry, bool, error) {
+	f, err := os.Open(l.abs(path))
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = f.Close() }()
+	// Unlike os.ReadDir, File.ReadDir neither reads the whole directory nor sorts it
+	entries, err := f.ReadDir(n + 1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	truncated := len(entries) > n
+	if truncated {
+		entries = entries[:n]
+	}
+	result := make([]DirEntry, len(entries))
+	for i, e := range entries {
+		result[i] = DirEntry{
+			Name:  e.Name(),
+			IsDir: e.IsDir(),
+		}
+	}
+	return result, truncated, nil
+}
+
+// WriteFile writes the file at the given path relative to the root. Data goes to a temporary file
+// in the same directory that is then renamed over the original, keeping its permissions, or with
+// opts.Exclusive hard-linked into place, which fails if the file exists. New files are created with
+// mode 0644.
+func (l *LocalFS) WriteFile(path string, data []byte, opts WriteOptions) error {
+	target := l.abs(path)
+	if opts.Parents {
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+	}
+	perm := os.FileMode(0o644)
+	if opts.Exclusive {
+		// Checked again by the link; this saves writing the temporary file
+		if _, err := os.Lstat(target); err == nil {
+			return &os.PathError{Op: "create", Path: target, Err: os.ErrExist}
+		}
+	} else if info, err := os.Stat(target); err == nil {
+		perm = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+	if err := writeAndClose(tmp, data, perm); err != nil {
+		return err
+	}
+	if opts.Exclusive {
+		return os.Link(tmpName, target)
+	}
+	return os.Rename(tmpName, target)
+}
+
+// Mkdir creates the directory at the given path relative to the root, failing if it exists.
+// With parents, missing parent directories are created too.
+func (l *LocalFS) Mkdir(path string, parents bool) error {
+	target := l.abs(path)
+	if parents {
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+	}
+	return os.Mkdir(target, 0o755)
+}
+
+// Rename moves the file or directory at oldPath to newPath, both relative to the root, failing if
+// newPath exists. With parents, missing parent directories of newPath are created.
+func (l *LocalFS) Rename(oldPath, newPath string, parents bool) error {
+	source, target := l.abs(oldPath), l.abs(newPath)
+	if _, err := os.Lstat(target); err == nil {
+		return &os.LinkError{Op: "rename", Old: source, New: target, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if parents {
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+	}
+	return os.Rename(source, target)
+}
+
+// Remove deletes the file or directory at the given path relative to the root, with everything
+// below it. With toTrash it is moved into the folder's trash instead and the trash ID is returned.
+func (l *LocalFS) Remove(path string, toTrash bool) (string, error) {
+	target := l.abs(path)
+	info, err := os.Lstat(target)
+	if err != nil {
+		// RemoveAll succeeds for a missing path; keep reporting it
+		return "", err
+	}
+	if toTrash {
+		return l.moveToTrash(path, info.IsDir(), time.Now())
+	}
+	return "", os.RemoveAll(target)
+}
+
+func writeAndClose(f *os.File, data []byte, perm os.FileMode) error {
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
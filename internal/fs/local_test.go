@@ -0,0 +1,125 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalFSWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLocalFS(dir)
+	target := filepath.Join(dir, "doc.md")
+	if err := os.WriteFile(target, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.WriteFile("doc.md", []byte("new"), WriteOptions{}); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want the original 0600 kept", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("content = %q, want %q", data, "new")
+	}
+
+	if err := l.WriteFile("doc.md", []byte("other"), WriteOptions{Exclusive: true}); !os.IsExist(err) {
+		t.Errorf("exclusive write over an existing file: err = %v, want os.IsExist", err)
+	}
+	if err := l.WriteFile("a/b/new.md", []byte("x"), WriteOptions{Exclusive: true}); !os.IsNotExist(err) {
+		t.Errorf("write without parents: err = %v, want os.IsNotExist", err)
+	}
+	if err := l.WriteFile("a/b/new.md", []byte("x"), WriteOptions{Exclusive: true, Parents: true}); err != nil {
+		t.Errorf("write with parents: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "doc.md" && e.Name() != "a" {
+			t.Errorf("left behind %s", e.Name())
+		}
+	}
+}
+
+func TestLocalFSRemove(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLocalFS(dir)
+	for _, p := range []string{"docs/a.md", "docs/b.md", "gone/c.md"} {
+		if err := l.WriteFile(p, []byte("# Doc\n"), WriteOptions{Parents: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id, err := l.Remove("docs/a.md", true)
+	if err != nil {
+		t.Fatalf("Remove to trash: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, TrashFilesDir, id)); err != nil {
+		t.Errorf("trashed file missing: %v", err)
+	}
+	info, err := ReadTrashInfo(l, id)
+	if err != nil {
+		t.Fatalf("ReadTrashInfo: %v", err)
+	}
+	if info.Path != "docs/a.md" || info.IsDir {
+		t.Errorf("trash info = %+v", info)
+	}
+
+	if id, err := l.Remove("gone", false); err != nil || id != "" {
+		t.Errorf("Remove directory = %q, %v", id, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone")); !os.IsNotExist(err) {
+		t.Errorf("directory still there: %v", err)
+	}
+	if _, err := l.Remove("missing.md", false); !os.IsNotExist(err) {
+		t.Errorf("Remove missing: err = %v, want os.IsNotExist", err)
+	}
+}
+
+func TestReadOnlyFSHidesWrites(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "doc.md"), []byte("# Doc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var fs FileSystem = NewReadOnlyFS(NewLocalFS(dir))
+	if _, ok := fs.(WritableFS); ok {
+		t.Error("ReadOnlyFS implements WritableFS")
+	}
+	if data, err := fs.ReadFile("doc.md"); err != nil || string(data) != "# Doc\n" {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	var _ WritableFS = NewLocalFS(dir)
+	if _, ok := FileSystem(NewGitFS(dir, "HEAD")).(WritableFS); ok {
+		t.Error("GitFS implements WritableFS")
+	}
+}
+
+func TestReadDirLimit(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fsys := range []FileSystem{NewLocalFS(dir), NewReadOnlyFS(NewLocalFS(dir))} {
+		entries, truncated, err := ReadDirLimit(fsys, "", 2)
+		if err != nil || !truncated || len(entries) != 2 {
+			t.Errorf("%T: got %d entries, truncated %v, err %v; want 2, true", fsys, len(entries), truncated, err)
+		}
+		entries, truncated, err = ReadDirLimit(fsys, "", 3)
+		if err != nil || truncated || len(entries) != 3 {
+			t.Errorf("%T: got %d entries, truncated %v, err %v; want 3, false", fsys, len(entries), truncated, err)
+		}
+	}
+	if _, _, err := ReadDirLimit(NewLocalFS(dir), "missing", 2); !os.IsNotExist(err) {
+		t.Errorf("missing directory: err = %v, want os.IsNotExist", err)
+	}
+}
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashDir is the directory at a folder's root that LocalFS.Remove moves entries into.
+const TrashDir = ".markhub-trash"
+
+// Layout of a folder's trash: deleted entries are moved to files/<id>, and info/<id>.json records
+// where they came from.
+var (
+	TrashFilesDir = path.Join(TrashDir, "files")
+	TrashInfoDir  = path.Join(TrashDir, "info")
+)
+
+// trashIDFormat timestamps trash IDs; the deleted entry's name follows it
+const trashIDFormat = "20060102T150405.000000000Z"
+
+// TrashInfo is the record kept for a trashed entry.
+type TrashInfo struct {
+	Path      string    `json:"path"` // relative to the folder root
+	IsDir     bool      `json:"isDir"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// moveToTrash moves rel into the trash and returns its trash ID. The info record is created first
+// and exclusively, which reserves the ID.
+func (l *LocalFS) moveToTrash(rel string, isDir bool, now time.Time) (string, error) {
+	record, err := json.Marshal(TrashInfo{Path: rel, IsDir: isDir, DeletedAt: now.UTC()})
+	if err != nil {
+		return "", err
+	}
+	base := now.UTC().Format(trashIDFormat) + "-" + path.Base(rel)
+	id := base
+	for n := 2; ; n++ {
+		err = l.WriteFile(path.Join(TrashInfoDir, id+".json"), record, WriteOptions{Exclusive: true, Parents: true})
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		id = base + "-" + strconv.Itoa(n)
+	}
+	if err := l.Rename(rel, path.Join(TrashFilesDir, id), true); err != nil {
+		_ = os.Remove(l.abs(path.Join(TrashInfoDir, id+".json")))
+		return "", err
+	}
+	return id, nil
+}
+
+// ReadTrashInfo reads and checks the record of the trash entry id.
+func ReadTrashInfo(fs FileSystem, id string) (TrashInfo, error) {
+	var info TrashInfo
+	data, err := fs.ReadFile(path.Join(TrashInfoDir, id+".json"))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+	if info.Path == "" || path.Clean(info.Path) != info.Path || path.IsAbs(info.Path) ||
+		info.Path == ".." || strings.HasPrefix(info.Path, "../") {
+		return info, errors.New("invalid trash record")
+	}
+	return info, nil
+}
@@ -0,0 +1,169 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/timestamp"
+)
+
+// Commit is an entry of a file's git history.
+type Commit struct {
+	Hash        string         `json:"hash"`
+	AuthorName  string         `json:"authorName"`
+	AuthorEmail string         `json:"authorEmail"`
+	Date        timestamp.Time `json:"date"`
+	Subject     string         `json:"subject"`
+}
+
+// Log returns the latest commits of the ref that changed path, newest first, at most limit of them.
+func (g *GitFS) Log(path string, limit int) ([]Commit, error) {
+	out, err := g.git("log", "-n", strconv.Itoa(limit), "--format=%H%x00%an%x00%ae%x00%aI%x00%s", g.ref, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	commits := []Commit{}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		fields := strings.SplitN(line, "\x00", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[3])
+		commits = append(commits, Commit{
+			Hash:        fields[0],
+			AuthorName:  fields[1],
+			AuthorEmail: fields[2],
+			Date:        timestamp.New(date),
+			Subject:     fields[4],
+		})
+	}
+	return commits, nil
+}
+
+// ErrBinaryFile is returned by Blame for files holding binary content.
+var ErrBinaryFile = errors.New("binary file")
+
+// BlameLine attributes a line of a file, numbered from 1, to the commit that last changed it.
+type BlameLine struct {
+	Line int    `json:"line"`
+	Hash string `json:"hash"`
+}
+
+// Blame is the line-by-line history of a file. Commits holds each commit the lines name once.
+type Blame struct {
+	Lines   []BlameLine       `json:"lines"`
+	Commits map[string]Commit `json:"commits"`
+}
+
+// Blame attributes every line of the file at path in the ref to the commit that last changed it.
+func (g *GitFS) Blame(path string) (*Blame, error) {
+	out, err := g.git("blame", "--porcelain", g.ref, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	blame := &Blame{Lines: []BlameLine{}, Commits: map[string]Commit{}}
+	// Each line is a header "<hash> <orig-line> <final-line> [<group-size>]", then the commit's
+	// details the first time the commit appears, then the content behind a tab
+	var current Commit
+	var line int
+	for _, text := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if content, ok := strings.CutPrefix(text, "\t"); ok {
+			if strings.IndexByte(content, 0) >= 0 {
+				return nil, ErrBinaryFile
+			}
+			if _, seen := blame.Commits[current.Hash]; !seen {
+				blame.Commits[current.Hash] = current
+			}
+			blame.Lines = append(blame.Lines, BlameLine{Line: line, Hash: current.Hash})
+			continue
+		}
+		key, value, _ := strings.Cut(text, " ")
+		switch key {
+		case "author":
+			current.AuthorName = value
+		case "author-mail":
+			current.AuthorEmail = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.Date = timestamp.New(time.Unix(sec, 0))
+			}
+		case "summary":
+			current.Subject = value
+		default:
+			fields := strings.Fields(text)
+			if len(fields) >= 3 && len(key) >= 40 {
+				current = blame.Commits[key]
+				current.Hash = key
+				line, _ = strconv.Atoi(fields[2])
+			}
+		}
+	}
+	return blame, nil
+}
+
+// WorkTree commits changes made in a directory of a git working tree.
+type WorkTree struct {
+	git *GitFS
+	dir string
+}
+
+// NewWorkTree returns a WorkTree for the directory dir, which may lie anywhere inside the working tree.
+func NewWorkTree(dir string) *WorkTree {
+	return &WorkTree{git: NewGitFS(dir, "HEAD"), dir: dir}
+}
+
+// WithContext returns a copy of w whose git commands are killed when ctx is done.
+func (w *WorkTree) WithContext(ctx context.Context) *WorkTree {
+	c := *w
+	c.git = w.git.WithContext(ctx)
+	return &c
+}
+
+// IsRepo reports whether the directory lies in a git working tree.
+func (w *WorkTree) IsRepo() bool {
+	out, err := w.git.git("rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// Commit stages the changes to paths (relative to the directory; additions, edits and deletions)
+// and commits them alone, leaving anything else the index holds for the next commit. It returns
+// the new commit's hash, or "" without committing when paths have no changes.
+func (w *WorkTree) Commit(paths []string, message, authorName, authorEmail string) (string, error) {
+	// A path that is gone and was never tracked has nothing to commit, and git add rejects it
+	var stage []string
+	for _, p := range paths {
+		if _, err := os.Lstat(filepath.Join(w.dir, filepath.FromSlash(p))); err == nil {
+			stage = append(stage, p)
+		} else if out, _ := w.git.git("ls-files", "--", p); out != "" {
+			stage = append(stage, p)
+		}
+	}
+	if len(stage) == 0 {
+		return "", nil
+	}
+	if _, err := w.git.git(append([]string{"add", "-A", "--"}, stage...)...); err != nil {
+		return "", err
+	}
+	// Without --no-renames a rename would list only its new path, and the commit miss the deletion
+	diff := []string{"diff", "--cached", "--no-renames", "--name-only", "-z", "--relative", "--"}
+	out, err := w.git.git(append(diff, stage...)...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "", nil
+	}
+	changed := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	args := []string{"-c", "user.name=" + authorName, "-c", "user.email=" + authorEmail,
+		"commit", "--quiet", "-m", message, "--"}
+	if _, err := w.git.git(append(args, changed...)...); err != nil {
+		return "", err
+	}
+	out, err = w.git.git("rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
@@ -0,0 +1,87 @@
+// Package fuzzy implements editor-style fuzzy matching for quick-open file pickers.
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Scoring weights, loosely modeled on fzf/VS Code quick-open heuristics.
+const (
+	scoreMatch        = 16
+	bonusConsecutive  = 32
+	bonusBoundary     = 30
+	bonusFirstChar    = 20
+	bonusBasename     = 20
+	penaltyGapStart   = 3
+	penaltyGapExtend  = 1
+	penaltyLengthUnit = 1
+)
+
+// Match reports whether every rune of pattern appears in target in order
+// (case-insensitively), returning a score (higher is better) and the byte
+// offsets in target of the matched runes.
+func Match(pattern, target string) (score int, positions []int, ok bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return 0, nil, false
+	}
+	pRunes := []rune(strings.ToLower(pattern))
+
+	baseStart := strings.LastIndexByte(target, '/') + 1
+
+	pi := 0
+	prevMatched := false
+	prevRune := rune(0)
+	gap := 0
+	for i, r := range target {
+		if pi == len(pRunes) {
+			break
+		}
+		if unicode.ToLower(r) == pRunes[pi] {
+			score += scoreMatch
+			if i == 0 {
+				score += bonusFirstChar
+			}
+			if prevMatched {
+				score += bonusConsecutive
+			} else if isBoundary(prevRune, r) {
+				score += bonusBoundary
+			}
+			if i >= baseStart {
+				score += bonusBasename
+			}
+			if gap > 0 {
+				score -= penaltyGapStart + gap*penaltyGapExtend
+			}
+			positions = append(positions, i)
+			pi++
+			prevMatched = true
+			gap = 0
+		} else {
+			prevMatched = false
+			if pi > 0 {
+				gap++
+			}
+		}
+		prevRune = r
+	}
+
+	if pi < len(pRunes) {
+		return 0, nil, false
+	}
+
+	// Prefer shorter candidates when everything else is equal
+	score -= utf8.RuneCountInString(target) * penaltyLengthUnit / 4
+	return score, positions, true
+}
+
+// isBoundary reports whether cur starts a new word: after a separator or at a camelCase hump.
+func isBoundary(prev, cur rune) bool {
+	switch prev {
+	case 0, '/', '-', '_', '.', ' ':
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(cur)
+}
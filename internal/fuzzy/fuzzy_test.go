@@ -0,0 +1,51 @@
+package fuzzy
+
+import "testing"
+
+func TestMatch_Subsequence(t *testing.T) {
+	if _, _, ok := Match("gst", "docs/getting-started.md"); !ok {
+		t.Error("expected subsequence match")
+	}
+	if _, _, ok := Match("xyz", "docs/getting-started.md"); ok {
+		t.Error("expected no match")
+	}
+	if _, _, ok := Match("", "docs/readme.md"); ok {
+		t.Error("expected empty pattern not to match")
+	}
+}
+
+func TestMatch_Positions(t *testing.T) {
+	_, positions, ok := Match("RM", "docs/README.md")
+	if !ok {
+		t.Fatal("expected match")
+	}
+	if len(positions) != 2 || positions[0] != 5 || positions[1] != 9 {
+		t.Errorf("unexpected positions %v", positions)
+	}
+}
+
+func TestMatch_Ranking(t *testing.T) {
+	tests := []struct {
+		pattern string
+		better  string
+		worse   string
+	}{
+		// Basename hits beat directory hits
+		{"guide", "notes/guide.md", "guide/notes.md"},
+		// Consecutive runs beat scattered letters
+		{"read", "docs/readme.md", "docs/r-e-a-d.md"},
+		// Word-boundary initials beat mid-word letters
+		{"gs", "docs/getting-started.md", "docs/bugs.md"},
+	}
+
+	for _, tt := range tests {
+		better, _, ok1 := Match(tt.pattern, tt.better)
+		worse, _, ok2 := Match(tt.pattern, tt.worse)
+		if !ok1 || !ok2 {
+			t.Fatalf("%q: expected both candidates to match", tt.pattern)
+		}
+		if better <= worse {
+			t.Errorf("%q: expected %s (%d) to outrank %s (%d)", tt.pattern, tt.better, better, tt.worse, worse)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles server lifecycle requests (shutdown and restart)
+type AdminHandler struct {
+	stop func(restart bool)
+	once sync.Once
+
+	// restartBlocked explains why this process cannot be re-executed; empty when it can
+	restartBlocked string
+}
+
+// NewAdminHandler creates an admin handler. stop is called at most once, after the
+// response has been written; the caller performs the graceful shutdown (and re-exec).
+func NewAdminHandler(stop func(restart bool)) *AdminHandler {
+	return &AdminHandler{stop: stop}
+}
+
+// DisableRestart makes Restart fail with 409 and the given reason
+func (h *AdminHandler) DisableRestart(reason string) {
+	h.restartBlocked = reason
+}
+
+// Shutdown gracefully stops the server
+func (h *AdminHandler) Shutdown(c *gin.Context) {
+	h.respondAndStop(c, false, "server shutting down")
+}
+
+// Restart gracefully stops the server and starts it again with the same arguments
+func (h *AdminHandler) Restart(c *gin.Context) {
+	if h.restartBlocked != "" {
+		writeError(c, CodeRestartUnavailable, h.restartBlocked)
+		return
+	}
+	h.respondAndStop(c, true, "server restarting")
+}
+
+func (h *AdminHandler) respondAndStop(c *gin.Context, restart bool, message string) {
+	writeJSON(c, http.StatusAccepted, gin.H{
+		"message": message,
+	})
+	// Push the response out before the shutdown starts closing connections
+	c.Writer.Flush()
+	h.once.Do(func() {
+		if h.stop != nil {
+			h.stop(restart)
+		}
+	})
+}
+
+// ReadOnlyGuard rejects state-changing requests when the server runs in read-only mode
+func ReadOnlyGuard(readOnly bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readOnly {
+			abortError(c, CodeReadOnly, "server is in read-only mode")
+			return
+		}
+		c.Next()
+	}
+}
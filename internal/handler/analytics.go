@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/audit"
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultAnalyticsRetention is the days of counts kept when analytics.retention_days is unset
+	defaultAnalyticsRetention = 90
+	// Defaults and cap of GET /analytics/top
+	defaultAnalyticsTopDays = 30
+	defaultAnalyticsTop     = 20
+	maxAnalyticsTop         = 100
+	// analyticsSaveDelay batches the views counted before the counts are written out
+	analyticsSaveDelay = time.Minute
+	// analyticsDay formats the day buckets, in UTC
+	analyticsDay = "2006-01-02"
+	// analyticsFormatVersion is bumped when the file layout changes; other versions are ignored
+	analyticsFormatVersion = 1
+)
+
+// analyticsFile is the stored form of the counts
+type analyticsFile struct {
+	Version int `json:"version"`
+	// Views counts the views of each alias-prefixed document by day
+	Views map[string]map[string]int `json:"views"`
+}
+
+// DocumentViews is a document's view count over a period
+type DocumentViews struct {
+	Path  string `json:"path"`
+	Views int    `json:"views"`
+}
+
+// AnalyticsTop is the response of GET /analytics/top
+type AnalyticsTop struct {
+	Days      int             `json:"days"`
+	Documents []DocumentViews `json:"documents"`
+}
+
+// DayViews is the view count of one day (YYYY-MM-DD, UTC)
+type DayViews struct {
+	Date  string `json:"date"`
+	Views int    `json:"views"`
+}
+
+// DocumentAnalytics is the response of GET /analytics/{path}: one bucket per day, oldest first
+type DocumentAnalytics struct {
+	Path  string     `json:"path"`
+	Total int        `json:"total"`
+	Days  []DayViews `json:"days"`
+}
+
+// AnalyticsHandler counts how often each document is viewed, per day, when analytics.enabled
+// is set. Counts are kept in memory and written to GetAnalyticsPath a minute after a view and
+// on Flush; days past the retention are dropped.
+type AnalyticsHandler struct {
+	cfg   *config.Config
+	audit *audit.Logger
+	path  string
+	now   func() time.Time
+	mu    sync.Mutex
+	views map[string]map[string]int
+	timer *time.Timer
+}
+
+// NewAnalyticsHandler creates an analytics handler, loading the counts saved by earlier runs
+func NewAnalyticsHandler(cfg *config.Config) *AnalyticsHandler {
+	h := &AnalyticsHandler{
+		cfg:   cfg,
+		audit: audit.New(cfg.GetAuditLogPath()),
+		path:  cfg.GetAnalyticsPath(),
+		now:   time.Now,
+		views: map[string]map[string]int{},
+	}
+	if cfg.Analytics.Enabled && h.path != "" {
+		if err := h.load(); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to read the view counts from %s: %v", h.path, err)
+		}
+	}
+	return h
+}
+
+func (h *AnalyticsHandler) load() error {
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return err
+	}
+	var file analyticsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if file.Version != analyticsFormatVersion {
+		return fmt.Errorf("unsupported format version %d", file.Version)
+	}
+	if file.Views != nil {
+		h.views = file.Views
+	}
+	h.prune()
+	return nil
+}
+
+// retention returns the days of counts kept
+func (h *AnalyticsHandler) retention() int {
+	if days := h.cfg.Analytics.RetentionDays; days > 0 {
+		return days
+	}
+	return defaultAnalyticsRetention
+}
+
+// since returns the first day, formatted, of the period of the given number of days up to today
+func (h *AnalyticsHandler) since(days int) string {
+	return h.now().UTC().AddDate(0, 0, 1-days).Format(analyticsDay)
+}
+
+// prune drops the days past the retention. h.mu must be held, or h not yet shared.
+func (h *AnalyticsHandler) prune() {
+	first := h.since(h.retention())
+	for path, days := range h.views {
+		for day := range days {
+			if day < first {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(h.views, path)
+		}
+	}
+}
+
+// RecordView counts a view of the alias-prefixed document path today. It is a no-op unless
+// analytics.enabled is set; FileHandler calls it through OnView.
+func (h *AnalyticsHandler) RecordView(path string) {
+	if !h.cfg.Analytics.Enabled {
+		return
+	}
+	day := h.now().UTC().Format(analyticsDay)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.views[path] == nil {
+		h.views[path] = map[string]int{}
+	}
+	h.views[path][day]++
+	if h.timer == nil && h.path != "" {
+		h.timer = time.AfterFunc(analyticsSaveDelay, func() {
+			if err := h.Flush(); err != nil {
+				log.Printf("Warning: failed to save the view counts: %v", err)
+			}
+		})
+	}
+}
+
+// Flush writes the counts out now, if any were recorded since they last were. Call it on shutdown.
+func (h *AnalyticsHandler) Flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.timer == nil {
+		return nil
+	}
+	h.timer.Stop()
+	h.timer = nil
+	h.prune()
+	return h.save()
+}
+
+// save writes the counts to h.path atomically. h.mu must be held.
+func (h *AnalyticsHandler) save() error {
+	data, err := json.Marshal(analyticsFile{Version: analyticsFormatVersion, Views: h.views})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".analytics-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), h.path)
+}
+
+// enabled answers with analytics_disabled and returns false unless analytics.enabled is set
+func (h *AnalyticsHandler) enabled(c *gin.Context) bool {
+	if !h.cfg.Analytics.Enabled {
+		writeError(c, CodeAnalyticsDisabled, "view counting is disabled (analytics.enabled)")
+		return false
+	}
+	return true
+}
+
+// daysParam reads ?days=, between 1 and the retention, defaulting to def
+func (h *AnalyticsHandler) daysParam(c *gin.Context, def int) (int, bool) {
+	days := min(def, h.retention())
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > h.retention() {
+			writeError(c, CodeInvalidRequest, fmt.Sprintf("days must be between 1 and %d", h.retention()))
+			return 0, false
+		}
+		days = n
+	}
+	return days, true
+}
+
+// GetAnalytics serves GET /analytics/{path}, dispatching /analytics/top to GetTop: gin cannot
+// register a route next to the catch-all, and no document path lacks an alias
+func (h *AnalyticsHandler) GetAnalytics(c *gin.Context) {
+	if c.Param("path") == "/top" {
+		h.GetTop(c)
+		return
+	}
+	h.GetDocument(c)
+}
+
+// GetTop returns the most viewed documents of the last ?days=30, most viewed first, at most
+// ?limit=20 of them
+func (h *AnalyticsHandler) GetTop(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	days, ok := h.daysParam(c, defaultAnalyticsTopDays)
+	if !ok {
+		return
+	}
+	limit := defaultAnalyticsTop
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAnalyticsTop {
+			writeError(c, CodeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxAnalyticsTop))
+			return
+		}
+		limit = n
+	}
+
+	first := h.since(days)
+	top := AnalyticsTop{Days: days, Documents: []DocumentViews{}}
+	h.mu.Lock()
+	for path, counts := range h.views {
+		doc := DocumentViews{Path: path}
+		for day, n := range counts {
+			if day >= first {
+				doc.Views += n
+			}
+		}
+		if doc.Views > 0 {
+			top.Documents = append(top.Documents, doc)
+		}
+	}
+	h.mu.Unlock()
+	sort.Slice(top.Documents, func(i, j int) bool {
+		a, b := top.Documents[i], top.Documents[j]
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		return a.Path < b.Path
+	})
+	if len(top.Documents) > limit {
+		top.Documents = top.Documents[:limit]
+	}
+	writeJSON(c, http.StatusOK, top)
+}
+
+// GetDocument returns the daily view counts of the document at path over the last ?days= (the
+// whole retention by default), days without views included
+func (h *AnalyticsHandler) GetDocument(c *gin.Context) {
+	if !h.enabled(c) {
+		return
+	}
+	docPath := strings.TrimPrefix(c.Param("path"), "/")
+	if docPath == "" || strings.Contains(docPath, "..") {
+		writeError(c, CodeInvalidPath, "invalid path")
+		return
+	}
+	days, ok := h.daysParam(c, h.retention())
+	if !ok {
+		return
+	}
+
+	resp := DocumentAnalytics{Path: docPath, Days: make([]DayViews, 0, days)}
+	today := h.now().UTC()
+	h.mu.Lock()
+	counts := h.views[docPath]
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format(analyticsDay)
+		resp.Days = append(resp.Days, DayViews{Date: day, Views: counts[day]})
+		resp.Total += counts[day]
+	}
+	h.mu.Unlock()
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// Purge deletes every count, in memory and on disk. It works with analytics disabled too, to
+// remove the counts of an earlier run.
+func (h *AnalyticsHandler) Purge(c *gin.Context) {
+	h.mu.Lock()
+	h.views = map[string]map[string]int{}
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	var err error
+	if h.path != "" {
+		err = os.Remove(h.path)
+	}
+	h.mu.Unlock()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to delete the view counts: %v", err))
+		return
+	}
+	recordAudit(h.audit, c, "analytics.purge", nil, nil)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAnalytics(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "runbook.md"), "# Runbook\n")
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Analytics = config.AnalyticsConfig{Enabled: true, RetentionDays: 10,
+		File: filepath.Join(t.TempDir(), "analytics.json")}
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	newHandler := func() *AnalyticsHandler {
+		h := NewAnalyticsHandler(cfg)
+		h.now = func() time.Time { return now }
+		return h
+	}
+	h := newHandler()
+	files := NewFileHandler(cfg)
+	files.OnView(h.RecordView)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/files/*path", files.GetFile)
+	r.GET("/analytics/*path", h.GetAnalytics)
+	r.DELETE("/analytics", h.Purge)
+	do := func(method, target string, v any) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		if v != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatalf("%s: %v: %s", target, err, w.Body.String())
+			}
+		}
+		return w.Code
+	}
+
+	for _, path := range []string{"runbook.md", "runbook.md", "guide.md", "missing.md"} {
+		do(http.MethodGet, "/files/docs/"+path, nil)
+	}
+	// An old view, counted by the document's history but not by the top of the last 3 days
+	h.views["docs/guide.md"]["2026-03-05"] = 5
+
+	var top AnalyticsTop
+	if code := do(http.MethodGet, "/analytics/top?days=3", &top); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	want := []DocumentViews{{"docs/runbook.md", 2}, {"docs/guide.md", 1}}
+	if top.Days != 3 || len(top.Documents) != 2 || top.Documents[0] != want[0] || top.Documents[1] != want[1] {
+		t.Errorf("unexpected top %+v", top)
+	}
+	if do(http.MethodGet, "/analytics/top", &top); top.Documents[0] != (DocumentViews{"docs/guide.md", 6}) {
+		t.Errorf("expected the guide first over the default period, got %+v", top)
+	}
+
+	var doc DocumentAnalytics
+	do(http.MethodGet, "/analytics/docs/guide.md?days=7", &doc)
+	if doc.Total != 6 || len(doc.Days) != 7 || doc.Days[0] != (DayViews{"2026-03-04", 0}) ||
+		doc.Days[1] != (DayViews{"2026-03-05", 5}) || doc.Days[6] != (DayViews{"2026-03-10", 1}) {
+		t.Errorf("unexpected document analytics %+v", doc)
+	}
+	if code := do(http.MethodGet, "/analytics/docs/guide.md?days=11", nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days past the retention, got %d", code)
+	}
+
+	// Saved counts are read back, without the days past the retention
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	now = now.AddDate(0, 0, 6)
+	// The constructor loads with the real clock, so read the file again with the stubbed one
+	reloaded := newHandler()
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.views["docs/guide.md"]) != 1 || reloaded.views["docs/runbook.md"]["2026-03-10"] != 2 {
+		t.Errorf("unexpected reloaded counts %v", reloaded.views)
+	}
+
+	if code := do(http.MethodDelete, "/analytics", nil); code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if _, err := os.Stat(cfg.Analytics.File); !os.IsNotExist(err) || len(h.views) != 0 {
+		t.Errorf("expected the counts purged, got %v and %v", err, h.views)
+	}
+
+	cfg.Analytics.Enabled = false
+	do(http.MethodGet, "/files/docs/runbook.md", nil)
+	if code := do(http.MethodGet, "/analytics/top", nil); code != http.StatusConflict || len(h.views) != 0 {
+		t.Errorf("expected 409 and no counting when disabled, got %d and %v", code, h.views)
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode is a stable, machine-readable error identifier. Clients branch on the code; the
+// message is for humans and may change.
+type ErrorCode string
+
+// Error codes returned by the API. Each one must be listed in errorStatus and in the Error
+// schema of openapi.json.
+const (
+	CodeInvalidRequest      ErrorCode = "invalid_request"
+	CodeInvalidPath         ErrorCode = "invalid_path"
+	CodePathTraversal       ErrorCode = "path_traversal"
+	CodeAccessDenied        ErrorCode = "access_denied"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeFolderNotFound      ErrorCode = "folder_not_found"
+	CodeFolderUnreadable    ErrorCode = "folder_unreadable"
+	CodeFolderExists        ErrorCode = "folder_exists"
+	CodeTooManyFolders      ErrorCode = "too_many_folders"
+	CodeFolderOverlap       ErrorCode = "folder_overlap"
+	CodeGitRefNotFound      ErrorCode = "git_ref_not_found"
+	CodeNotGitRepo          ErrorCode = "not_git_repo"
+	CodeIsDirectory         ErrorCode = "is_directory"
+	CodeNotMarkdown         ErrorCode = "not_markdown"
+	CodeInvalidFrontMatter  ErrorCode = "invalid_front_matter"
+	CodeFolderReadOnly      ErrorCode = "folder_read_only"
+	CodeReadOnly            ErrorCode = "read_only"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeWriteAuthRequired   ErrorCode = "write_auth_required"
+	CodeCrossSite           ErrorCode = "cross_site"
+	CodeConflict            ErrorCode = "conflict"
+	CodeLockConflict        ErrorCode = "lock_conflict"
+	CodeIfMatchRequired     ErrorCode = "if_match_required"
+	CodeAlreadyExists       ErrorCode = "already_exists"
+	CodePathExcluded        ErrorCode = "path_excluded"
+	CodeRestartUnavailable  ErrorCode = "restart_unavailable"
+	CodeSearchIndexDisabled ErrorCode = "search_index_disabled"
+	CodeAnalyticsDisabled   ErrorCode = "analytics_disabled"
+	CodeTooLarge            ErrorCode = "too_large"
+	CodeUnsupportedType     ErrorCode = "unsupported_type"
+	CodeTimeout             ErrorCode = "timeout"
+	CodeHostNotAllowed      ErrorCode = "host_not_allowed"
+	CodeUpstreamFailed      ErrorCode = "upstream_failed"
+	CodePandocUnavailable   ErrorCode = "pandoc_unavailable"
+	CodeConfigSaveFailed    ErrorCode = "config_save_failed"
+	CodeInternal            ErrorCode = "internal"
+	CodeInternalPanic       ErrorCode = "internal_panic"
+)
+
+// errorStatus maps every error code to its HTTP status
+var errorStatus = map[ErrorCode]int{
+	CodeInvalidRequest:      http.StatusBadRequest,
+	CodeInvalidPath:         http.StatusBadRequest,
+	CodePathTraversal:       http.StatusForbidden,
+	CodeAccessDenied:        http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeFolderNotFound:      http.StatusNotFound,
+	CodeFolderUnreadable:    http.StatusNotFound,
+	CodeFolderExists:        http.StatusConflict,
+	CodeTooManyFolders:      http.StatusConflict,
+	CodeFolderOverlap:       http.StatusConflict,
+	CodeGitRefNotFound:      http.StatusBadRequest,
+	CodeNotGitRepo:          http.StatusNotFound,
+	CodeIsDirectory:         http.StatusBadRequest,
+	CodeNotMarkdown:         http.StatusBadRequest,
+	CodeInvalidFrontMatter:  http.StatusUnprocessableEntity,
+	CodeFolderReadOnly:      http.StatusMethodNotAllowed,
+	CodeReadOnly:            http.StatusForbidden,
+	CodeUnauthorized:        http.StatusUnauthorized,
+	CodeWriteAuthRequired:   http.StatusForbidden,
+	CodeCrossSite:           http.StatusForbidden,
+	CodeConflict:            http.StatusConflict,
+	CodeLockConflict:        http.StatusConflict,
+	CodeIfMatchRequired:     http.StatusPreconditionRequired,
+	CodeAlreadyExists:       http.StatusConflict,
+	CodePathExcluded:        http.StatusForbidden,
+	CodeRestartUnavailable:  http.StatusConflict,
+	CodeSearchIndexDisabled: http.StatusConflict,
+	CodeAnalyticsDisabled:   http.StatusConflict,
+	CodeTooLarge:            http.StatusRequestEntityTooLarge,
+	CodeUnsupportedType:     http.StatusUnsupportedMediaType,
+	CodeTimeout:             http.StatusGatewayTimeout,
+	CodeHostNotAllowed:      http.StatusForbidden,
+	CodeUpstreamFailed:      http.StatusBadGateway,
+	CodePandocUnavailable:   http.StatusNotImplemented,
+	CodeConfigSaveFailed:    http.StatusInternalServerError,
+	CodeInternal:            http.StatusInternalServerError,
+	CodeInternalPanic:       http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status sent with code
+func (code ErrorCode) Status() int {
+	if status, ok := errorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// APIError is the body of every error response. Message keeps the "error" key older clients read.
+type APIError struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"error"`
+	Details   any       `json:"details,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+func newAPIError(c *gin.Context, code ErrorCode, message string, details any) APIError {
+	return APIError{Code: code, Message: message, Details: details, RequestID: RequestID(c)}
+}
+
+// writeError responds with code's status and an APIError
+func writeError(c *gin.Context, code ErrorCode, message string) {
+	code, message = bodyTooLarge(c, code, message)
+	writeJSON(c, code.Status(), newAPIError(c, code, message, nil))
+}
+
+// writeErrorDetails is writeError with structured details, e.g. the current state on a conflict
+func writeErrorDetails(c *gin.Context, code ErrorCode, message string, details any) {
+	code, message = bodyTooLarge(c, code, message)
+	writeJSON(c, code.Status(), newAPIError(c, code, message, details))
+}
+
+// abortError is writeError for middleware: the rest of the chain is skipped
+func abortError(c *gin.Context, code ErrorCode, message string) {
+	c.AbortWithStatusJSON(code.Status(), newAPIError(c, code, message, nil))
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// declaredErrorCodes parses apierror.go for every ErrorCode constant, so a code added there
+// without a status or an OpenAPI entry fails the tests below
+func declaredErrorCodes(t *testing.T) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "apierror.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var codes []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if ident, ok := vs.Type.(*ast.Ident); !ok || ident.Name != "ErrorCode" {
+				continue
+			}
+			for i := range vs.Names {
+				var value string
+				_ = json.Unmarshal([]byte(vs.Values[i].(*ast.BasicLit).Value), &value)
+				codes = append(codes, value)
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func TestErrorCodesHaveStatus(t *testing.T) {
+	codes := declaredErrorCodes(t)
+	if len(codes) != len(errorStatus) {
+		t.Errorf("declared %d codes but errorStatus maps %d", len(codes), len(errorStatus))
+	}
+	for _, code := range codes {
+		if _, ok := errorStatus[ErrorCode(code)]; !ok {
+			t.Errorf("error code %q has no HTTP status in errorStatus", code)
+		}
+	}
+}
+
+func TestErrorCodesDocumented(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas struct {
+				Error struct {
+					Properties struct {
+						Code struct {
+							Enum []string `json:"enum"`
+						} `json:"code"`
+					} `json:"properties"`
+				} `json:"Error"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(OpenAPISpec(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	documented := append([]string(nil), spec.Components.Schemas.Error.Properties.Code.Enum...)
+	sort.Strings(documented)
+
+	codes := declaredErrorCodes(t)
+	if len(documented) != len(codes) {
+		t.Fatalf("openapi.json documents codes %v, apierror.go declares %v", documented, codes)
+	}
+	for i := range codes {
+		if documented[i] != codes[i] {
+			t.Fatalf("openapi.json documents codes %v, apierror.go declares %v", documented, codes)
+		}
+	}
+}
+
+func TestWriteErrorBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.GET("/missing", func(c *gin.Context) { writeError(c, CodeFolderNotFound, "folder not found") })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	r.ServeHTTP(w, req)
+
+	var body APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := APIError{Code: CodeFolderNotFound, Message: "folder not found", RequestID: "req-1"}
+	if w.Code != http.StatusNotFound || body != want {
+		t.Errorf("expected 404 %+v, got %d %+v", want, w.Code, body)
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// archiveContentTypes are the formats of GET /export/archive and their content types
+var archiveContentTypes = map[string]string{
+	"tar": "application/x-tar",
+	"zip": "application/zip",
+}
+
+// GetArchive streams the committed tree of a git_ref folder, or of the directory at path in it,
+// as a ?format=tar (default) or zip archive made by one git archive process. The ref is pinned
+// to its commit first, which names the file. Entries the tree hides by the global, repo or
+// folder exclude patterns are left out; other files, such as images, are kept.
+func (h *ExportHandler) GetArchive(c *gin.Context) {
+	format := c.DefaultQuery("format", "tar")
+	contentType, ok := archiveContentTypes[format]
+	if !ok {
+		writeError(c, CodeInvalidRequest, fmt.Sprintf("unsupported format %q (expected tar or zip)", format))
+		return
+	}
+	if strings.Contains(c.Param("path"), "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	ctx := c.Request.Context()
+	fs, dir, folder, err := h.files.resolvePath(ctx, c.Param("path"))
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	gitFS, ok := fs.(*mfs.GitFS)
+	if !ok {
+		writeError(c, CodeInvalidRequest, "only git_ref folders can be exported as an archive")
+		return
+	}
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		dir = strings.Trim(folder.SubPath, "/")
+	}
+	if dir != "" {
+		info, err := gitFS.Stat(dir)
+		if err == nil && !info.IsDir {
+			writeError(c, CodeInvalidRequest, "path must name a directory")
+			return
+		}
+		if err != nil || h.tree.traceExclude(folder, dir, &info).Excluded {
+			writeError(c, CodeNotFound, "directory not found")
+			return
+		}
+	}
+	commit, err := gitFS.Commit()
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to resolve git_ref %s: %v", folder.GitRef, err))
+		return
+	}
+
+	name := folder.Alias
+	if dir != "" && dir != strings.Trim(folder.SubPath, "/") {
+		name += "-" + path.Base(dir)
+	}
+	name += "-" + commit[:min(12, len(commit))]
+	excludes := h.tree.effectiveExcludes(folder)
+	exclude := func(entry string, _ bool) bool {
+		return h.tree.entryExcluded(entry, excludes)
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": name + "." + format}))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	err = mfs.NewGitFS(folder.Path, commit).WithContext(ctx).Archive(c.Writer, format, name+"/", dir, exclude)
+	if err == nil || requestDone(c) {
+		return
+	}
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		c.Writer.Header().Del("Content-Type")
+		writeError(c, CodeInternal, fmt.Sprintf("failed to archive the folder: %v", err))
+		return
+	}
+	// Cut the connection rather than end a truncated archive as if it were whole
+	log.Printf("Warning: archive of %s failed mid-stream: %v", c.Param("path"), err)
+	panic(http.ErrAbortHandler)
+}
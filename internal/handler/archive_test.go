@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetArchive(t *testing.T) {
+	repo := t.TempDir()
+	writeDoc(t, filepath.Join(repo, "README.md"), "# Home\n")
+	writeDoc(t, filepath.Join(repo, "guide", "setup.md"), "# Setup\n")
+	writeDoc(t, filepath.Join(repo, "guide", "logo.png"), "png")
+	writeDoc(t, filepath.Join(repo, "drafts", "wip.md"), "# WIP\n")
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "initial")
+	commit := runGit(t, repo, "rev-parse", "--short=12", "HEAD")
+	// Uncommitted changes are not part of the archive
+	writeDoc(t, filepath.Join(repo, "guide", "new.md"), "# New\n")
+
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "release", Path: repo, Alias: "release", GitRef: "HEAD", Exclude: []string{"drafts"}},
+		{ID: "work", Path: repo, Alias: "work"},
+	}
+	tree := NewTreeHandler(cfg)
+	h := NewExportHandler(cfg, tree, NewFileHandler(cfg))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/export/archive/*path", h.GetArchive)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	tarEntries := func(body []byte) []string {
+		t.Helper()
+		var names []string
+		tr := tar.NewReader(bytes.NewReader(body))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return names
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				names = append(names, hdr.Name)
+			}
+		}
+	}
+
+	w := get("/export/archive/release")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-tar" ||
+		w.Header().Get("Content-Disposition") != `attachment; filename=release-`+commit+`.tar` {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	prefix := "release-" + commit + "/"
+	want := []string{prefix + "README.md", prefix + "guide/logo.png", prefix + "guide/setup.md"}
+	if got := tarEntries(w.Body.Bytes()); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	w = get("/export/archive/release/guide?format=zip")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f.Name)
+		}
+	}
+	prefix = "release-guide-" + commit + "/"
+	if want := []string{prefix + "guide/logo.png", prefix + "guide/setup.md"}; !slices.Equal(files, want) {
+		t.Errorf("expected %v, got %v", want, files)
+	}
+
+	for target, code := range map[string]int{
+		"/export/archive/release?format=7z":        http.StatusBadRequest,
+		"/export/archive/work":                     http.StatusBadRequest,
+		"/export/archive/release/README.md":        http.StatusBadRequest,
+		"/export/archive/release/drafts":           http.StatusNotFound,
+		"/export/archive/release/missing":          http.StatusNotFound,
+		"/export/archive/nowhere":                  http.StatusNotFound,
+		"/export/archive/release/guide/../drafts/": http.StatusForbidden,
+	} {
+		if w := get(target); w.Code != code {
+			t.Errorf("%s: expected %d, got %d: %s", target, code, w.Code, w.Body.String())
+		}
+	}
+}
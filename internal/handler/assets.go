@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAssetsDir is where uploads go when assets.dir is unset
+const defaultAssetsDir = "assets"
+
+// defaultMaxAssetSize caps uploads when assets.max_size is unset
+const defaultMaxAssetSize = 10 << 20
+
+// maxMultipartOverhead is allowed on top of the size cap for the multipart headers and boundaries
+const maxMultipartOverhead = 64 << 10
+
+// maxAssetNameTries bounds the search for a free file name
+const maxAssetNameTries = 10000
+
+// assetTypes are the image types accepted for upload, by sniffed content type, with the extension
+// given to the file. SVG is left out: it can carry script and would be served from this origin.
+var assetTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// assetNameRe matches the runs of characters replaced in a ?name= prefix
+var assetNameRe = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// AssetUpload is the result of an image upload
+type AssetUpload struct {
+	Path string `json:"path"` // alias-prefixed
+	Size int    `json:"size"`
+	// Markdown is the image reference to insert, relative to the document
+	Markdown string `json:"markdown"`
+}
+
+// UploadAsset stores an image, sent raw or as the "file" field of a multipart form, in the assets
+// directory next to the document (or in the directory) named by the path, as
+// screenshot-<date>-<n>.<ext>; ?name= replaces "screenshot". It returns the markdown referencing it.
+func (h *FileHandler) UploadAsset(c *gin.Context) {
+	target := strings.Trim(c.Param("path"), "/")
+	docDir := target
+	if h.cfg.IsMarkdownFile(target) {
+		docDir = path.Dir(target)
+	}
+	maxSize := h.cfg.Assets.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxAssetSize
+	}
+	data, ok := readAsset(c, maxSize)
+	if !ok {
+		return
+	}
+	mimeType := http.DetectContentType(data)
+	ext, ok := assetTypes[mimeType]
+	if !ok {
+		writeError(c, CodeUnsupportedType, "not a PNG, JPEG, GIF or WebP image")
+		return
+	}
+	if h.cfg.Assets.StripMetadata {
+		data = stripImageMetadata(mimeType, data)
+	}
+
+	assetsDir := h.cfg.Assets.Dir
+	if assetsDir == "" {
+		assetsDir = defaultAssetsDir
+	}
+	prefix := strings.TrimSuffix(c.Query("name"), path.Ext(c.Query("name")))
+	prefix = strings.Trim(assetNameRe.ReplaceAllString(prefix, "-"), "-")
+	if prefix == "" || len(prefix) > 64 {
+		prefix = "screenshot"
+	}
+	base := prefix + "-" + time.Now().Format("2006-01-02") + "-"
+	name := func(n int) string { return fmt.Sprintf("%s%d%s", base, n, ext) }
+
+	// The first candidate stands in for all of them: they share the directory and extension
+	wfs, relativePath, folder, ok := h.prepareTarget(c, path.Join(docDir, assetsDir, name(1)))
+	if !ok {
+		return
+	}
+	docRel := strings.TrimSuffix(strings.TrimSuffix(path.Dir(relativePath), assetsDir), "/")
+	if info, err := wfs.Stat(docRel); err != nil || !info.IsDir {
+		writeError(c, CodeNotFound, "directory not found")
+		return
+	}
+
+	opts := mfs.WriteOptions{Exclusive: true, Parents: true}
+	h.writeMu.Lock()
+	var err error
+	n := 1
+	for ; n <= maxAssetNameTries; n++ {
+		err = wfs.WriteFile(path.Join(path.Dir(relativePath), name(n)), data, opts)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	h.writeMu.Unlock()
+	if err != nil {
+		writeCreateError(c, err, "asset")
+		return
+	}
+	assetPath := path.Join(docDir, assetsDir, name(n))
+	h.notifyTreeChange(assetPath)
+	h.autoCommit(c, folder, "upload", path.Join(path.Dir(relativePath), name(n)))
+	recordWrite(h.audit, c, "file.upload", assetPath, len(data))
+
+	link := path.Join(assetsDir, name(n))
+	if strings.ContainsAny(link, " \t") {
+		link = "<" + link + ">"
+	}
+	writeJSON(c, http.StatusCreated, AssetUpload{Path: assetPath, Size: len(data), Markdown: "![](" + link + ")"})
+}
+
+// readAsset reads an upload of at most maxSize bytes from the "file" field of a multipart body or
+// from the raw body. On failure it has already sent the error response and returns false.
+func readAsset(c *gin.Context, maxSize int64) ([]byte, bool) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+maxMultipartOverhead)
+	var r io.Reader = body
+	if mediaType, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil &&
+		mediaType == "multipart/form-data" {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				writeAssetReadError(c, err, maxSize)
+				return nil, false
+			}
+			if part.FormName() == "file" {
+				r = part
+				break
+			}
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		writeAssetReadError(c, err, maxSize)
+		return nil, false
+	}
+	if int64(len(data)) > maxSize {
+		writeAssetReadError(c, &http.MaxBytesError{Limit: maxSize}, maxSize)
+		return nil, false
+	}
+	if len(data) == 0 {
+		writeError(c, CodeInvalidRequest, "empty upload")
+		return nil, false
+	}
+	return data, true
+}
+
+// writeAssetReadError maps an error reading an upload to a response
+func writeAssetReadError(c *gin.Context, err error, maxSize int64) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(c, CodeTooLarge, fmt.Sprintf("image larger than %d bytes", maxSize))
+	case errors.Is(err, io.EOF):
+		writeError(c, CodeInvalidRequest, `multipart upload has no "file" field`)
+	default:
+		writeError(c, CodeInvalidRequest, "failed to read upload")
+	}
+}
+
+// rawContentType is the type GetRaw serves a file as: uploaded image types as themselves, so the
+// assets display, anything else as markdown
+func rawContentType(p string) string {
+	ext := strings.ToLower(path.Ext(p))
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+	for mimeType, e := range assetTypes {
+		if e == ext {
+			return mimeType
+		}
+	}
+	return "text/markdown; charset=utf-8"
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testPNG is the signature and IHDR chunk of a PNG, enough for content sniffing
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00" +
+	"\x90wS\xde")
+
+// assetRoutes registers the routes of the asset tests
+func assetRoutes(r *gin.Engine, h *FileHandler) {
+	r.POST("/assets/*path", h.UploadAsset)
+	r.GET("/raw/*path", h.GetRaw)
+}
+
+// assetDocs are the documents of the asset tests
+var assetDocs = map[string]string{"guide/setup.md": "# Setup\n"}
+
+func upload(
+	t *testing.T, r http.Handler, target, contentType string, body []byte,
+) (*httptest.ResponseRecorder, AssetUpload) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp AssetUpload
+	if w.Code == http.StatusCreated {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, resp
+}
+
+func TestUploadAsset(t *testing.T) {
+	r, _, dir := newFileRouter(t, assetDocs, assetRoutes)
+	date := time.Now().Format("2006-01-02")
+
+	w, first := upload(t, r, "/assets/docs/guide/setup.md", "image/png", testPNG)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	name := "screenshot-" + date + "-1.png"
+	if first.Path != "docs/guide/assets/"+name || first.Markdown != "![](assets/"+name+")" ||
+		first.Size != len(testPNG) {
+		t.Errorf("unexpected upload %+v", first)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "guide", "assets", name)); !bytes.Equal(data, testPNG) {
+		t.Errorf("unexpected stored image %q", data)
+	}
+
+	// The asset is served right away, as an image
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/raw/"+first.Path, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected the image served as image/png, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// A second upload gets the next free name; a multipart upload to the directory works alike
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "clipboard.png")
+	_, _ = part.Write(testPNG)
+	_ = mw.Close()
+	w, second := upload(t, r, "/assets/docs/guide", mw.FormDataContentType(), body.Bytes())
+	if w.Code != http.StatusCreated || second.Path != "docs/guide/assets/screenshot-"+date+"-2.png" {
+		t.Errorf("expected the next free name, got %d %+v: %s", w.Code, second, w.Body.String())
+	}
+
+	w, named := upload(t, r, "/assets/docs/guide/setup.md?name=My+Diagram!.png", "image/png", testPNG)
+	if w.Code != http.StatusCreated || named.Markdown != "![](assets/My-Diagram-"+date+"-1.png)" {
+		t.Errorf("expected a sanitized name prefix, got %+v", named)
+	}
+}
+
+func TestUploadAssetRejects(t *testing.T) {
+	r, h, _ := newFileRouter(t, assetDocs, assetRoutes)
+	h.cfg.Assets.MaxSize = 64
+
+	cases := []struct {
+		target string
+		body   []byte
+		status int
+	}{
+		{"/assets/docs/guide/setup.md", []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`),
+			http.StatusUnsupportedMediaType},
+		{"/assets/docs/guide/setup.md", append(append([]byte{}, testPNG...), make([]byte, 64)...),
+			http.StatusRequestEntityTooLarge},
+		{"/assets/docs/guide/setup.md", nil, http.StatusBadRequest},
+		{"/assets/docs/missing/doc.md", testPNG, http.StatusNotFound},
+		{"/assets/frozen/guide/setup.md", testPNG, http.StatusMethodNotAllowed},
+	}
+	for _, tc := range cases {
+		if w, _ := upload(t, r, tc.target, "image/png", tc.body); w.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d: %s", tc.target, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStripImageMetadata(t *testing.T) {
+	app0 := []byte("\xff\xe0\x00\x06JFIF")
+	exif := []byte("\xff\xe1\x00\x0cExif\x00\x00GPS!")
+	scan := []byte("\xff\xda\x00\x02\x01\x02\x03\xff\xd9")
+	jpeg := bytes.Join([][]byte{[]byte("\xff\xd8"), app0, exif, scan}, nil)
+	want := bytes.Join([][]byte{[]byte("\xff\xd8"), app0, scan}, nil)
+	if got := stripImageMetadata("image/jpeg", jpeg); !bytes.Equal(got, want) {
+		t.Errorf("expected the APP1 segment dropped, got %q", got)
+	}
+
+	text := []byte("\x00\x00\x00\x04tEXtGPS!\x00\x00\x00\x00")
+	iend := []byte("\x00\x00\x00\x00IEND\xaeB`\x82")
+	png := bytes.Join([][]byte{testPNG, text, iend}, nil)
+	if got := stripImageMetadata("image/png", png); !bytes.Equal(got, bytes.Join([][]byte{testPNG, iend}, nil)) {
+		t.Errorf("expected the tEXt chunk dropped, got %q", got)
+	}
+
+	truncated := jpeg[:len(jpeg)-len(scan)-3]
+	if got := stripImageMetadata("image/jpeg", truncated); !bytes.Equal(got, truncated) {
+		t.Error("expected an unparseable image returned unchanged")
+	}
+	if gif := []byte("GIF89a"); !bytes.Equal(stripImageMetadata("image/gif", gif), gif) {
+		t.Error("expected other types unchanged")
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CageChen/markhub/internal/audit"
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of GET /audit
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditLog is the most recent entries of the audit log, newest first
+type AuditLog struct {
+	// Enabled is false when auditing is off (audit_log: off, or a session that saves no config)
+	Enabled bool          `json:"enabled"`
+	Entries []audit.Entry `json:"entries"`
+}
+
+// recordAudit appends a config-change entry tagged with the request's ID and client IP.
+// The IP is the TCP peer; forwarding headers are client-controlled and would let callers forge it.
+func recordAudit(l *audit.Logger, c *gin.Context, action string, before, after interface{}) {
+	l.Record(audit.Entry{
+		Action:    action,
+		RequestID: RequestID(c),
+		ClientIP:  ClientIP(c),
+		Before:    before,
+		After:     after,
+	})
+}
+
+// recordWrite appends a file-write entry for the alias-prefixed path, tagged like recordAudit's
+func recordWrite(l *audit.Logger, c *gin.Context, action, path string, bytes int) {
+	l.Record(audit.Entry{
+		Action:    action,
+		RequestID: RequestID(c),
+		ClientIP:  ClientIP(c),
+		Path:      path,
+		Bytes:     bytes,
+	})
+}
+
+// GetAudit returns the most recent audit entries, up to ?limit=
+func (h *SettingsHandler) GetAudit(c *gin.Context) {
+	limit := defaultAuditLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(c, CodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+	entries, err := h.audit.Recent(limit)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to read audit log: %v", err))
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	writeJSON(c, http.StatusOK, AuditLog{Enabled: h.audit != nil, Entries: entries})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/audit"
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecordAuditIgnoresForwardedFor(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	logger := audit.New(logPath)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/change", func(c *gin.Context) {
+		recordAudit(logger, c, "test.change", nil, "after")
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/change", nil)
+	req.RemoteAddr = "192.0.2.10:51000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.99")
+	req.Header.Set("X-Real-IP", "203.0.113.98")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry audit.Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.ClientIP != "192.0.2.10" {
+		t.Errorf("expected the TCP peer address, got %q", entry.ClientIP)
+	}
+}
+
+func TestWritesAreAudited(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs", Writable: true}}
+
+	gin.SetMode(gin.TestMode)
+	files := NewFileHandler(cfg)
+	r := gin.New()
+	r.POST("/files/*path", files.PostFile)
+	r.DELETE("/files/*path", files.DeleteFile)
+	r.GET("/audit", NewSettingsHandler(cfg, nil).GetAudit)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	if w := serve(http.MethodPost, "/files/docs/new.md", "# New\n"); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodDelete, "/files/docs/new.md", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := serve(http.MethodGet, "/audit", "")
+	var log AuditLog
+	if err := json.Unmarshal(w.Body.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if !log.Enabled || len(log.Entries) != 2 {
+		t.Fatalf("expected two entries, got %+v", log)
+	}
+	del, create := log.Entries[0], log.Entries[1]
+	if del.Action != "file.delete" || del.Path != "docs/new.md" {
+		t.Errorf("unexpected newest entry %+v", del)
+	}
+	if create.Action != "file.create" || create.Path != "docs/new.md" || create.Bytes != len("# New\n") {
+		t.Errorf("unexpected oldest entry %+v", create)
+	}
+
+	if w := serve(http.MethodGet, "/audit?limit=1", ""); !strings.Contains(w.Body.String(), "file.delete") ||
+		strings.Contains(w.Body.String(), "file.create") {
+		t.Errorf("expected only the newest entry, got %s", w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/audit?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for limit=0, got %d", w.Code)
+	}
+}
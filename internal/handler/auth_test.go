@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testToken  = "s3cret"
+	remoteAddr = "192.0.2.10:51000"
+	localAddr  = "127.0.0.1:51000"
+)
+
+func newAuthRouter(authToken string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := config.DefaultConfig()
+	cfg.AuthToken = authToken
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	authed := r.Group("", AuthMiddleware(cfg))
+	authed.GET("/read", ok)
+	authed.POST("/write", RequireWriteAuth(cfg), ok)
+	return r
+}
+
+func authRequest(r http.Handler, method, path, addr string, mutate func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = addr
+	if mutate != nil {
+		mutate(req)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthMiddlewareTokenSources(t *testing.T) {
+	r := newAuthRouter(testToken)
+
+	tests := []struct {
+		name   string
+		path   string
+		mutate func(*http.Request)
+		want   int
+	}{
+		{"no token", "/read", nil, http.StatusUnauthorized},
+		{"wrong bearer", "/read", func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer nope")
+		}, http.StatusUnauthorized},
+		{"bearer", "/read", func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}, http.StatusNoContent},
+		{"cookie", "/read", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: authCookieName, Value: testToken})
+		}, http.StatusNoContent},
+		{"query", "/read?token=" + testToken, nil, http.StatusNoContent},
+		{"wrong query", "/read?token=nope", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := authRequest(r, http.MethodGet, tt.path, remoteAddr, tt.mutate); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareQueryTokenSetsCookie(t *testing.T) {
+	r := newAuthRouter(testToken)
+
+	w := authRequest(r, http.MethodGet, "/read?token="+testToken, remoteAddr, nil)
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == authCookieName {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != testToken || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected an HttpOnly, SameSite=Strict token cookie, got %+v", cookie)
+	}
+
+	w = authRequest(r, http.MethodGet, "/read", remoteAddr, nil)
+	if got := w.Result().Cookies(); len(got) != 0 {
+		t.Errorf("expected no cookie without a query token, got %v", got)
+	}
+}
+
+func TestAuthMiddlewareAllowsLoopbackAndUnsetToken(t *testing.T) {
+	w := authRequest(newAuthRouter(testToken), http.MethodGet, "/read", localAddr, nil)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("loopback: expected 204, got %d", w.Code)
+	}
+	if w := authRequest(newAuthRouter(""), http.MethodGet, "/read", remoteAddr, nil); w.Code != http.StatusNoContent {
+		t.Errorf("no auth_token: expected 204, got %d", w.Code)
+	}
+}
+
+func TestRequireWriteAuth(t *testing.T) {
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+testToken) }
+
+	tests := []struct {
+		name      string
+		authToken string
+		addr      string
+		mutate    func(*http.Request)
+		want      int
+	}{
+		{"loopback", testToken, localAddr, nil, http.StatusNoContent},
+		{"remote with token", testToken, remoteAddr, bearer, http.StatusNoContent},
+		{"remote without token", testToken, remoteAddr, nil, http.StatusUnauthorized},
+		// --expose-insecure lets remote clients read but never write
+		{"insecure remote", "", remoteAddr, nil, http.StatusForbidden},
+		{"insecure remote with bearer", "", remoteAddr, bearer, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := authRequest(newAuthRouter(tt.authToken), http.MethodPost, "/write", tt.addr, tt.mutate)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+func TestRejectCrossSite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/write", RejectCrossSite(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	header := func(key, value string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set(key, value) }
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*http.Request)
+		want   int
+	}{
+		{"no browser headers", nil, http.StatusNoContent},
+		{"same origin fetch", header("Sec-Fetch-Site", "same-origin"), http.StatusNoContent},
+		{"typed into the address bar", header("Sec-Fetch-Site", "none"), http.StatusNoContent},
+		{"cross-site fetch", header("Sec-Fetch-Site", "cross-site"), http.StatusForbidden},
+		{"same-site fetch", header("Sec-Fetch-Site", "same-site"), http.StatusForbidden},
+		{"matching origin", header("Origin", "http://example.com"), http.StatusNoContent},
+		{"foreign origin", header("Origin", "https://evil.example"), http.StatusForbidden},
+		{"opaque origin", header("Origin", "null"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		// httptest requests are addressed to example.com
+		if w := authRequest(r, http.MethodPost, "/write", localAddr, tt.mutate); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
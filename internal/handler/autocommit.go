@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// Headers reporting the outcome of an auto_commit: the new commit's hash, or why committing failed
+const (
+	AutoCommitHeader      = "X-Auto-Commit"
+	AutoCommitErrorHeader = "X-Auto-Commit-Error"
+)
+
+// Defaults for git settings left empty
+const (
+	defaultCommitMessage = "markhub: {{action}} {{path}}"
+	defaultAuthorName    = "MarkHub"
+	defaultAuthorEmail   = "markhub@localhost"
+)
+
+// autoCommitTimeout bounds the git commands of one auto-commit. They do not use the request
+// context: a write that succeeded should not have its commit killed half-way.
+const autoCommitTimeout = 30 * time.Second
+
+// Limits of GET /git/log
+const (
+	defaultGitLogLimit = 50
+	maxGitLogLimit     = 500
+)
+
+// GitLog is the history of a file
+type GitLog struct {
+	Path    string       `json:"path"`
+	Commits []mfs.Commit `json:"commits"`
+}
+
+// autoCommit commits the changes to paths (relative to folder's root; the first names the change
+// in the message) when the folder has auto_commit and lies in a git working tree, and reports the
+// outcome in the AutoCommitHeader or AutoCommitErrorHeader response header. A failed commit leaves
+// the change in place.
+func (h *FileHandler) autoCommit(c *gin.Context, folder config.Folder, action string, paths ...string) {
+	if !folder.AutoCommit || len(paths) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), autoCommitTimeout)
+	defer cancel()
+	wt := mfs.NewWorkTree(folder.Path).WithContext(ctx)
+	if !wt.IsRepo() {
+		return
+	}
+
+	git := h.cfg.Git
+	message := git.CommitMessage
+	if message == "" {
+		message = defaultCommitMessage
+	}
+	message = strings.NewReplacer("{{action}}", action, "{{path}}", paths[0]).Replace(message)
+	name, email := git.AuthorName, git.AuthorEmail
+	if name == "" {
+		name = defaultAuthorName
+	}
+	if email == "" {
+		email = defaultAuthorEmail
+	}
+
+	h.commitMu.Lock()
+	hash, err := wt.Commit(paths, message, name, email)
+	h.commitMu.Unlock()
+	if err != nil {
+		log.Printf("Auto-commit of %s in %s failed: %v", paths[0], folder.Path, err)
+		// Header values cannot span lines
+		c.Header(AutoCommitErrorHeader, strings.Join(strings.Fields(err.Error()), " "))
+		return
+	}
+	if hash != "" {
+		c.Header(AutoCommitHeader, hash)
+	}
+}
+
+// GetGitLog returns the commits that changed a file or directory, newest first: from HEAD for local
+// folders, from the folder's ref for git_ref folders. ?limit= caps them (50 by default, at most 500).
+func (h *FileHandler) GetGitLog(c *gin.Context) {
+	filePath := c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	limit := defaultGitLogLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(c, CodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxGitLogLimit)
+	}
+	_, relativePath, folder, err := h.resolvePath(c.Request.Context(), filePath)
+	if err != nil {
+		writeError(c, CodeNotFound, "folder not found")
+		return
+	}
+	ref, ok := historyRef(c, folder)
+	if !ok {
+		return
+	}
+	if relativePath == "" {
+		relativePath = "."
+	}
+	commits, err := mfs.NewGitFS(folder.Path, ref).WithContext(c.Request.Context()).Log(relativePath, limit)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to read history: %v", err))
+		return
+	}
+	writeJSON(c, http.StatusOK, GitLog{Path: strings.TrimPrefix(filePath, "/"), Commits: commits})
+}
+
+// historyRef returns the ref whose history a folder's files have: the folder's git_ref, or HEAD for
+// a local folder in a git working tree. It writes CodeNotGitRepo and returns false otherwise.
+func historyRef(c *gin.Context, folder config.Folder) (string, bool) {
+	if folder.GitRef != "" {
+		return folder.GitRef, true
+	}
+	if !mfs.NewWorkTree(folder.Path).WithContext(c.Request.Context()).IsRepo() {
+		writeError(c, CodeNotGitRepo, "folder is not in a git repository")
+		return "", false
+	}
+	return "HEAD", true
+}
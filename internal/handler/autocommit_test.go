@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runGit runs git in dir and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@test.com"},
+		args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func newAutoCommitRouter(t *testing.T, repo bool) (*gin.Engine, string) {
+	t.Helper()
+	docs := map[string]string{"README.md": "# Home\n\n[Setup](guide/setup.md)\n", "guide/setup.md": "# Setup\n"}
+	r, h, dir := newFileRouter(t, docs, func(r *gin.Engine, h *FileHandler) {
+		r.PUT("/raw/*path", h.PutRaw)
+		r.POST("/files/*path", h.PostFile)
+		r.DELETE("/files/*path", h.DeleteFile)
+		r.GET("/git/log/*path", h.GetGitLog)
+		r.GET("/blame/*path", h.GetBlame)
+	})
+	h.cfg.Folders[0].AutoCommit = true
+	if repo {
+		runGit(t, dir, "init", "-q")
+		runGit(t, dir, "add", ".")
+		runGit(t, dir, "commit", "-q", "-m", "initial")
+	}
+	return r, dir
+}
+
+func TestAutoCommit(t *testing.T) {
+	r, dir := newAutoCommitRouter(t, true)
+
+	w := putRaw(r, "/raw/docs/README.md", "", "# Home\n\nEdited. [Setup](guide/setup.md)\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body.String())
+	}
+	hash := w.Header().Get(AutoCommitHeader)
+	if hash == "" || hash != runGit(t, dir, "rev-parse", "HEAD") {
+		t.Errorf("%s = %q, want the new HEAD", AutoCommitHeader, hash)
+	}
+	got := runGit(t, dir, "log", "-1", "--format=%an <%ae> %s")
+	if got != "MarkHub <markhub@localhost> markhub: edit README.md" {
+		t.Errorf("commit = %q", got)
+	}
+
+	// Something the user staged stays out of the commits
+	writeDoc(t, filepath.Join(dir, "staged.md"), "# Staged\n")
+	runGit(t, dir, "add", "staged.md")
+
+	_, report := postMove(t, r, "", "docs/guide/setup.md", "docs/guide/install.md")
+	if len(report.Updated) != 1 {
+		t.Fatalf("move updated %+v, want README.md", report.Updated)
+	}
+	files := runGit(t, dir, "show", "--no-renames", "--name-only", "--format=%s", "HEAD")
+	if files != "markhub: move guide/setup.md\n\nREADME.md\nguide/install.md\nguide/setup.md" {
+		t.Errorf("move commit:\n%s", files)
+	}
+	if staged := runGit(t, dir, "diff", "--cached", "--name-only"); staged != "staged.md" {
+		t.Errorf("staged after the move = %q, want staged.md", staged)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/files/docs/guide/install.md", nil))
+	if w.Code != http.StatusOK || w.Header().Get(AutoCommitHeader) == "" {
+		t.Fatalf("delete: %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git/log/docs/README.md", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("log: %d %s", w.Code, w.Body.String())
+	}
+	var history GitLog
+	if err := json.Unmarshal(w.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, c := range history.Commits {
+		subjects = append(subjects, c.Subject)
+	}
+	if got := strings.Join(subjects, ", "); got != "markhub: move guide/setup.md, markhub: edit README.md, initial" {
+		t.Errorf("README.md history = %s", got)
+	}
+}
+
+func TestAutoCommitFailureKeepsChange(t *testing.T) {
+	r, dir := newAutoCommitRouter(t, true)
+	hook := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho rejected >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := putRaw(r, "/raw/docs/README.md", "", "# Kept\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body.String())
+	}
+	if msg := w.Header().Get(AutoCommitErrorHeader); !strings.Contains(msg, "rejected") {
+		t.Errorf("%s = %q, want the hook's message", AutoCommitErrorHeader, msg)
+	}
+	if got := readDoc(t, filepath.Join(dir, "README.md")); got != "# Kept\n" {
+		t.Errorf("README.md = %q, want the saved content", got)
+	}
+}
+
+func TestAutoCommitOutsideRepo(t *testing.T) {
+	r, _ := newAutoCommitRouter(t, false)
+
+	w := putRaw(r, "/raw/docs/README.md", "", "# Home\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(AutoCommitHeader) != "" || w.Header().Get(AutoCommitErrorHeader) != "" {
+		t.Errorf("outside a repo the save should not commit: %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/git/log/docs/README.md", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), string(CodeNotGitRepo)) {
+		t.Errorf("log outside a repo: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGetBlame(t *testing.T) {
+	r, dir := newAutoCommitRouter(t, true)
+	initial := runGit(t, dir, "rev-parse", "HEAD")
+	if w := putRaw(r, "/raw/docs/README.md", "", "# Home\n\nAdded.\n"); w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body.String())
+	}
+	edit := runGit(t, dir, "rev-parse", "HEAD")
+	// Uncommitted edits are not blamed
+	writeDoc(t, filepath.Join(dir, "README.md"), "# Home\n\nAdded.\n\nUnsaved.\n")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/blame/docs/README.md", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("blame: %d %s", w.Code, w.Body.String())
+	}
+	var blame BlameResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &blame); err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, line := range blame.Lines {
+		subjects = append(subjects, blame.Commits[line.Hash].Subject)
+	}
+	if got := strings.Join(subjects, ", "); got != "initial, initial, markhub: edit README.md" {
+		t.Errorf("README.md blame = %s", got)
+	}
+	if blame.Ref != "HEAD" || blame.Lines[0].Hash != initial || blame.Lines[2].Hash != edit {
+		t.Errorf("unexpected blame %+v", blame)
+	}
+
+	writeDoc(t, filepath.Join(dir, "data.md"), "a\x00b\n")
+	writeDoc(t, filepath.Join(dir, "large.md"), strings.Repeat("x", maxBlameSize+1))
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "more")
+	for path, want := range map[string]int{
+		"/blame/docs/data.md":    http.StatusUnsupportedMediaType,
+		"/blame/docs/large.md":   http.StatusRequestEntityTooLarge,
+		"/blame/docs/guide":      http.StatusBadRequest,
+		"/blame/docs/missing.md": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d %s", path, want, w.Code, w.Body.String())
+		}
+	}
+}
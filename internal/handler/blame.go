@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBlameSize caps the files GET /blame attributes; git blame's cost grows with size and history
+const maxBlameSize = 1 << 20
+
+// BlameResponse attributes each line of a file to the commit that last changed it
+type BlameResponse struct {
+	Path string `json:"path"`
+	// Ref is the folder's git_ref, or HEAD for a local folder
+	Ref     string                `json:"ref"`
+	Lines   []mfs.BlameLine       `json:"lines"`
+	Commits map[string]mfs.Commit `json:"commits"`
+}
+
+// GetBlame returns git blame for a file: from the folder's ref for git_ref folders, from HEAD for
+// local folders, so uncommitted edits are not attributed
+func (h *FileHandler) GetBlame(c *gin.Context) {
+	filePath := c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	_, relativePath, folder, err := h.resolvePath(c.Request.Context(), filePath)
+	if err != nil {
+		writeError(c, CodeNotFound, "folder not found")
+		return
+	}
+	ref, ok := historyRef(c, folder)
+	if !ok {
+		return
+	}
+	git := mfs.NewGitFS(folder.Path, ref).WithContext(c.Request.Context())
+	info, err := git.Stat(relativePath)
+	if err != nil {
+		writeError(c, CodeNotFound, "file not found")
+		return
+	}
+	if info.IsDir {
+		writeError(c, CodeIsDirectory, "cannot blame a directory")
+		return
+	}
+	if info.Size > maxBlameSize {
+		writeError(c, CodeTooLarge, fmt.Sprintf("file exceeds %d bytes", maxBlameSize))
+		return
+	}
+	blame, err := git.Blame(relativePath)
+	if err != nil {
+		if requestDone(c) {
+			return
+		}
+		if errors.Is(err, mfs.ErrBinaryFile) {
+			writeError(c, CodeUnsupportedType, "cannot blame a binary file")
+			return
+		}
+		writeError(c, CodeInternal, fmt.Sprintf("failed to blame: %v", err))
+		return
+	}
+	writeJSON(c, http.StatusOK, BlameResponse{
+		Path:    strings.TrimPrefix(filePath, "/"),
+		Ref:     ref,
+		Lines:   blame.Lines,
+		Commits: blame.Commits,
+	})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Body caps used when max_request_body and max_write_body are unset
+const (
+	defaultMaxRequestBody = 1 << 20
+	defaultMaxWriteBody   = 10 << 20
+)
+
+// Context keys of the body limit: the request's own body, which ExemptBodyLimit restores, and the
+// limit a read of the body ran into
+const (
+	unlimitedBodyKey = "markhub.unlimitedBody"
+	bodyTooLargeKey  = "markhub.bodyTooLarge"
+)
+
+// BodyLimitMiddleware caps request bodies at limit bytes, or defaultMaxRequestBody when limit is
+// not positive. A body declaring a larger Content-Length is refused with 413 right away; once a
+// handler reads past the limit, whichever error it reports for the failed read is sent as 413.
+func BodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	limit = maxRequestBody(limit)
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			abortError(c, CodeTooLarge, fmt.Sprintf("request body larger than %d bytes", limit))
+			return
+		}
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Set(unlimitedBodyKey, c.Request.Body)
+			limitBody(c, limit)
+		}
+		c.Next()
+	}
+}
+
+// ExemptBodyLimit lifts BodyLimitMiddleware's cap for routes whose handlers cap the body
+// themselves, such as file writes and image uploads
+func ExemptBodyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if body, ok := c.Get(unlimitedBodyKey); ok {
+			c.Request.Body = body.(io.ReadCloser)
+		}
+		c.Next()
+	}
+}
+
+// limitBody caps the rest of the request body at limit bytes
+func limitBody(c *gin.Context, limit int64) {
+	c.Request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit), c: c}
+}
+
+// limitedBody notes on the context when a read runs into the body limit, so that the error
+// response becomes a 413
+type limitedBody struct {
+	io.ReadCloser
+	c *gin.Context
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.c.Set(bodyTooLargeKey, tooLarge.Limit)
+	}
+	return n, err
+}
+
+// bodyTooLarge turns the error a handler reports for an unreadable body into a 413 when the body
+// ran into BodyLimitMiddleware's cap
+func bodyTooLarge(c *gin.Context, code ErrorCode, message string) (ErrorCode, string) {
+	if limit, ok := c.Get(bodyTooLargeKey); ok && code == CodeInvalidRequest {
+		return CodeTooLarge, fmt.Sprintf("request body larger than %d bytes", limit)
+	}
+	return code, message
+}
+
+// maxRequestBody returns the cap on the body of an API request
+func maxRequestBody(limit int64) int64 {
+	if limit <= 0 {
+		return defaultMaxRequestBody
+	}
+	return limit
+}
+
+// maxWriteBody returns the cap on the body of a file write
+func maxWriteBody(limit int64) int64 {
+	if limit <= 0 {
+		return defaultMaxWriteBody
+	}
+	return limit
+}
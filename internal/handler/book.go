@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBookMaxDocuments caps a book when book.max_documents is unset
+const defaultBookMaxDocuments = 100
+
+// How the chapters of a book were found, reported in BookResponse.Order
+const (
+	BookOrderFile = "order_file" // the links of book.order_file
+	BookOrderNext = "next"       // the "next" key of each chapter's front matter
+)
+
+// BookChapter is one document of a book, rendered in a section with the id Anchor. The anchors of
+// its headings start with Anchor too.
+type BookChapter struct {
+	Path   string             `json:"path"`
+	Title  string             `json:"title"`
+	Anchor string             `json:"anchor"`
+	TOC    []markdown.TOCItem `json:"toc"`
+}
+
+// BookResponse is a chain of documents rendered as one page, in reading order
+type BookResponse struct {
+	Start string `json:"start"`
+	// Order is BookOrderFile or BookOrderNext
+	Order    string        `json:"order"`
+	HTML     string        `json:"html"`
+	Chapters []BookChapter `json:"chapters"`
+	// Truncated is set when the book goes on past book.max_documents chapters
+	Truncated bool `json:"truncated"`
+	// Cycle is set when a "next" key leads back to an earlier chapter, where the book ends
+	Cycle    bool     `json:"cycle,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// GetBook renders the document named by ?start= and the chapters following it as one page. Links
+// between the chapters are rewritten to the chapters' anchors, so the reader scrolls instead of
+// leaving the page.
+func (h *FileHandler) GetBook(c *gin.Context) {
+	start := strings.Trim(c.Query("start"), "/")
+	if start == "" {
+		writeError(c, CodeInvalidRequest, "start is required")
+		return
+	}
+	if strings.Contains(start, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.CheckFile(ctx, start); err != nil {
+		if errors.Is(err, ErrNotMarkdown) {
+			writeError(c, CodeNotMarkdown, err.Error())
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	fs, relPath, folder, err := h.resolvePath(ctx, start)
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+
+	limit := h.cfg.Book.MaxDocuments
+	if limit <= 0 {
+		limit = defaultBookMaxDocuments
+	}
+	resp := &BookResponse{Start: start, Chapters: []BookChapter{}}
+	var chapters []string
+	chapters, resp.Order, resp.Truncated, resp.Cycle = h.bookChapters(fs, folder, relPath, limit)
+	if err := h.renderBook(ctx, fs, folder, chapters, resp); err != nil {
+		if requestDone(c) {
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// bookChapters returns the folder-relative paths of the chapters of the book starting at start, at
+// most limit of them. They are the documents book.order_file lists from start on when the file is
+// in start's directory and lists start, and otherwise the chain of "next" keys.
+func (h *FileHandler) bookChapters(
+	fs mfs.FileSystem, folder config.Folder, start string, limit int,
+) (chapters []string, order string, truncated, cycle bool) {
+	if listed, ok := h.orderFileChapters(fs, folder, start); ok {
+		if len(listed) > limit {
+			return listed[:limit], BookOrderFile, true, false
+		}
+		return listed, BookOrderFile, false, false
+	}
+	seen := map[string]bool{}
+	for current := start; current != ""; current = h.nextChapter(fs, current) {
+		if seen[current] {
+			return chapters, BookOrderNext, false, true
+		}
+		if len(chapters) == limit {
+			return chapters, BookOrderNext, true, false
+		}
+		seen[current] = true
+		chapters = append(chapters, current)
+	}
+	return chapters, BookOrderNext, false, false
+}
+
+// orderFileChapters returns the markdown files linked from book.order_file in start's directory,
+// in order and from start on; it returns false when there is no such file or it omits start
+func (h *FileHandler) orderFileChapters(fs mfs.FileSystem, folder config.Folder, start string) ([]string, bool) {
+	if h.cfg.Book.OrderFile == "" {
+		return nil, false
+	}
+	orderPath := path.Join(path.Dir(start), h.cfg.Book.OrderFile)
+	content, err := fs.ReadFile(orderPath)
+	if err != nil {
+		return nil, false
+	}
+	result, err := h.parserFor(folder).Parse(content)
+	if err != nil {
+		return nil, false
+	}
+	var listed []string
+	seen := map[string]bool{}
+	for _, link := range result.Links {
+		if link.Image {
+			continue
+		}
+		target, ok := h.chapterTarget(fs, orderPath, link.Dest)
+		if ok && !seen[target] {
+			seen[target] = true
+			listed = append(listed, target)
+		}
+	}
+	for i, chapter := range listed {
+		if chapter == start {
+			return listed[i:], true
+		}
+	}
+	return nil, false
+}
+
+// nextChapter returns the chapter the "next" key of docPath's front matter points to, or ""
+func (h *FileHandler) nextChapter(fs mfs.FileSystem, docPath string) string {
+	content, err := fs.ReadFile(docPath)
+	if err != nil {
+		return ""
+	}
+	front, _, err := markdown.ParseFrontMatter(content)
+	if err != nil {
+		return ""
+	}
+	next, _ := front["next"].(string)
+	target, ok := h.chapterTarget(fs, docPath, next)
+	if !ok {
+		return ""
+	}
+	return target
+}
+
+// chapterTarget resolves a relative link in the document at docPath to a markdown file of the
+// folder, ignoring its query and fragment
+func (h *FileHandler) chapterTarget(fs mfs.FileSystem, docPath, dest string) (string, bool) {
+	dest, _, _ = strings.Cut(dest, "#")
+	dest, _, _ = strings.Cut(dest, "?")
+	if dest == "" || strings.HasPrefix(dest, "/") || strings.Contains(dest, ":") {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(dest); err == nil {
+		dest = unescaped
+	}
+	target, ok := linkTarget(docPath, dest)
+	if !ok || !h.cfg.IsMarkdownFile(target) {
+		return "", false
+	}
+	if info, err := fs.Stat(target); err != nil || info.IsDir {
+		return "", false
+	}
+	return target, true
+}
+
+// renderBook renders the chapters into resp, each in its own section. Heading anchors are prefixed
+// with the chapter's anchor, and links to another chapter, or within the chapter, point into the
+// page.
+func (h *FileHandler) renderBook(
+	ctx context.Context, fs mfs.FileSystem, folder config.Folder, chapters []string, resp *BookResponse,
+) error {
+	anchors := make(map[string]string, len(chapters))
+	for i, chapter := range chapters {
+		anchors[chapter] = fmt.Sprintf("chapter-%d", i+1)
+	}
+	var buf strings.Builder
+	for _, chapter := range chapters {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := fs.ReadFile(chapter)
+		if err != nil {
+			return err
+		}
+		_, body, _ := markdown.ParseFrontMatter(content)
+		anchor := anchors[chapter]
+		body, _ = markdown.RewriteLinks(body, func(dest string) (string, bool) {
+			target, fragment, _ := strings.Cut(dest, "#")
+			if target != "" {
+				linked, ok := h.chapterTarget(fs, chapter, target)
+				if !ok || anchors[linked] == "" {
+					return "", false
+				}
+				if fragment == "" {
+					return "#" + anchors[linked], true
+				}
+				return "#" + anchors[linked] + "-" + fragment, true
+			}
+			return "#" + anchor + "-" + fragment, fragment != ""
+		})
+		result, err := h.parserFor(folder).ParseWithOptions(body, markdown.ParseOptions{
+			Resolve:       linkResolver(fs, chapter),
+			MaxImageSize:  largeImageSize,
+			ExternalImage: externalImagePolicy(h.cfg.Render),
+			AnchorPrefix:  anchor + "-",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to parse markdown: %w", err)
+		}
+
+		// The parser puts render.anchor_prefix before the ids and the links into the page alike
+		id := h.cfg.Render.AnchorPrefix + anchor
+		docPath := folder.Alias + "/" + chapter
+		fmt.Fprintf(&buf, "<section class=\"book-chapter\" id=\"%s\" data-path=\"%s\">\n%s</section>\n",
+			id, html.EscapeString(docPath), result.HTML)
+		resp.Chapters = append(resp.Chapters, BookChapter{
+			Path: docPath, Title: result.Title, Anchor: id, TOC: result.TOC,
+		})
+		for _, warning := range result.Warnings {
+			resp.Warnings = append(resp.Warnings, docPath+": "+warning)
+		}
+	}
+	resp.HTML = buf.String()
+	return nil
+}
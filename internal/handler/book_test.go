@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func getBook(t *testing.T, cfg *config.Config, start string) (int, BookResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/book", NewFileHandler(cfg).GetBook)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/book?start="+start, nil))
+	var resp BookResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, resp
+}
+
+func bookPaths(resp BookResponse) []string {
+	paths := make([]string, len(resp.Chapters))
+	for i, chapter := range resp.Chapters {
+		paths[i] = chapter.Path
+	}
+	return paths
+}
+
+func TestGetBookFollowsNext(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "intro.md"),
+		"---\nnext: guide/setup.md\n---\n# Intro\n\nSee [setup](guide/setup.md#install) and [below](#intro).\n")
+	writeDoc(t, filepath.Join(dir, "guide", "setup.md"), "+++\nnext = \"../end.md\"\n+++\n# Setup\n\n## Install\n")
+	writeDoc(t, filepath.Join(dir, "end.md"), "---\nnext: intro.md\n---\n# End\n\nBack to [the start](intro.md).\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	code, resp := getBook(t, cfg, "docs/intro.md")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if got := strings.Join(bookPaths(resp), ","); got != "docs/intro.md,docs/guide/setup.md,docs/end.md" {
+		t.Fatalf("unexpected chapters %s", got)
+	}
+	if resp.Order != BookOrderNext || !resp.Cycle || resp.Truncated {
+		t.Errorf("expected the cycle back to intro to end the book, got %+v", resp)
+	}
+	for _, want := range []string{
+		`<section class="book-chapter" id="chapter-2" data-path="docs/guide/setup.md">`,
+		`id="chapter-2-install"`,
+		`href="#chapter-2-install"`,
+		`href="#chapter-1-intro"`,
+		`href="#chapter-1"`,
+	} {
+		if !strings.Contains(resp.HTML, want) {
+			t.Errorf("expected %s in %s", want, resp.HTML)
+		}
+	}
+	if strings.Contains(resp.HTML, "next:") {
+		t.Errorf("expected the front matter to be left out, got %s", resp.HTML)
+	}
+	if resp.Chapters[1].TOC[1].Anchor != "chapter-2-install" {
+		t.Errorf("expected prefixed TOC anchors, got %+v", resp.Chapters[1].TOC)
+	}
+
+	// The ids and the links between chapters take render.anchor_prefix alike
+	cfg.Render.AnchorPrefix = "mh-"
+	_, prefixed := getBook(t, cfg, "docs/intro.md")
+	for _, want := range []string{`id="mh-chapter-2"`, `id="mh-chapter-2-install"`, `href="#mh-chapter-2-install"`} {
+		if !strings.Contains(prefixed.HTML, want) {
+			t.Errorf("expected %s in %s", want, prefixed.HTML)
+		}
+	}
+	if prefixed.Chapters[0].Anchor != "mh-chapter-1" {
+		t.Errorf("expected a prefixed chapter anchor, got %+v", prefixed.Chapters[0])
+	}
+	cfg.Render.AnchorPrefix = ""
+
+	cfg.Book.MaxDocuments = 2
+	if _, resp = getBook(t, cfg, "docs/intro.md"); len(resp.Chapters) != 2 || !resp.Truncated || resp.Cycle {
+		t.Errorf("expected two chapters and truncated, got %v truncated=%v", bookPaths(resp), resp.Truncated)
+	}
+
+	if code, _ = getBook(t, cfg, "docs/missing.md"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing start, got %d", code)
+	}
+	if code, _ = getBook(t, cfg, ""); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without start, got %d", code)
+	}
+}
+
+func TestGetBookOrderFile(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "SUMMARY.md"),
+		"# Handbook\n\n- [One](one.md)\n- [Two](two.md)\n- [Site](https://example.com)\n- [Three](three.md)\n")
+	for _, name := range []string{"one", "two", "three"} {
+		writeDoc(t, filepath.Join(dir, name+".md"), "---\nnext: one.md\n---\n# "+name+"\n")
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Book.OrderFile = "SUMMARY.md"
+
+	_, resp := getBook(t, cfg, "docs/two.md")
+	if got := strings.Join(bookPaths(resp), ","); got != "docs/two.md,docs/three.md" || resp.Order != BookOrderFile {
+		t.Errorf("expected the order file's chapters from two on, got %s by %s", got, resp.Order)
+	}
+	// A start the order file does not list follows its next key
+	_, resp = getBook(t, cfg, "docs/SUMMARY.md")
+	if len(resp.Chapters) != 1 || resp.Order != BookOrderNext {
+		t.Errorf("expected the summary alone, got %v by %s", bookPaths(resp), resp.Order)
+	}
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// Auth modes reported by the capabilities endpoint
+const (
+	// AuthModeNone means no auth_token is set: anyone who can reach the server may read, and only
+	// loopback clients may write
+	AuthModeNone = "none"
+	// AuthModeToken means non-loopback clients must send auth_token
+	AuthModeToken = "token"
+)
+
+// Capabilities are the optional features of this build and configuration. Fields are only ever
+// added, so clients can rely on the ones they know.
+type Capabilities struct {
+	APIVersion string `json:"apiVersion"`
+	// Auth is AuthModeNone or AuthModeToken
+	Auth string `json:"auth"`
+	// Search is full-text search (GET /search), fuzzy find (GET /find) and quick open (GET /quickopen)
+	Search bool `json:"search"`
+	// Write is editing files, folders and settings; false in read-only mode
+	Write bool `json:"write"`
+	// Uploads is POST /assets, which needs Write
+	Uploads bool `json:"uploads"`
+	// Trash is DELETE moving entries into a restorable trash
+	Trash bool `json:"trash"`
+	// ExportFormats names the export endpoints served ("manifest" is GET /export-manifest)
+	ExportFormats []string `json:"exportFormats"`
+	// Math is drawing ```math blocks, which only happens on the server (render.diagrams "server"
+	// with a render.diagram_commands entry for math)
+	Math bool `json:"math"`
+	// Mermaid is drawing ```mermaid blocks as diagrams in the web UI
+	Mermaid bool `json:"mermaid"`
+	// ExternalImages is the render.external_images policy: allow, block or proxy
+	ExternalImages string `json:"externalImages"`
+}
+
+// exportFormats are the export endpoints this build serves
+var exportFormats = []string{"manifest"}
+
+// GetCapabilities returns a handler reporting the Capabilities of cfg
+func GetCapabilities(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writeJSON(c, http.StatusOK, capabilities(cfg))
+	}
+}
+
+// capabilities derives the Capabilities of cfg
+func capabilities(cfg *config.Config) Capabilities {
+	auth := AuthModeNone
+	if cfg.AuthToken != "" {
+		auth = AuthModeToken
+	}
+	externalImages := cfg.Render.ExternalImages
+	if externalImages == "" {
+		externalImages = config.ExternalImagesAllow
+	}
+	return Capabilities{
+		APIVersion:     APIVersion,
+		Auth:           auth,
+		Search:         true,
+		Write:          !cfg.ReadOnly,
+		Uploads:        !cfg.ReadOnly,
+		Trash:          !cfg.ReadOnly,
+		ExportFormats:  exportFormats,
+		Math:           cfg.Render.Diagrams == config.DiagramsServer && cfg.Render.DiagramCommands[markdown.FenceMath] != "",
+		Mermaid:        cfg.Render.Mermaid,
+		ExternalImages: externalImages,
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name  string
+		setup func(cfg *config.Config)
+		want  Capabilities
+	}{
+		{"defaults", func(*config.Config) {}, Capabilities{
+			APIVersion: APIVersion, Auth: AuthModeNone, Search: true, Write: true, Uploads: true, Trash: true,
+			ExportFormats: []string{"manifest"}, Mermaid: true, ExternalImages: config.ExternalImagesAllow,
+		}},
+		{"read-only with token", func(cfg *config.Config) {
+			cfg.ReadOnly = true
+			cfg.AuthToken = "secret"
+			cfg.Render.Mermaid = false
+			cfg.Render.ExternalImages = config.ExternalImagesProxy
+		}, Capabilities{
+			APIVersion: APIVersion, Auth: AuthModeToken, Search: true,
+			ExportFormats: []string{"manifest"}, ExternalImages: config.ExternalImagesProxy,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			tt.setup(cfg)
+			r := gin.New()
+			r.GET("/capabilities", GetCapabilities(cfg))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			var got Capabilities
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("capabilities = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// immutableCacheControl lets shared caches keep a content-addressed response for a year: its URL
+// changes whenever the content does
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// contentHashLen is the length of the hex content hash that ETags quote and content-addressed
+// URLs start with
+const contentHashLen = 32
+
+// setCacheControl sets the Cache-Control header to value, a cache.* setting, unless it is empty
+func setCacheControl(c *gin.Context, value string) {
+	if value != "" {
+		c.Header("Cache-Control", value)
+	}
+}
+
+// contentHash returns the hex hash of file content that ETag quotes
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:contentHashLen/2])
+}
+
+// splitContentHash splits a content-addressed path, "{hash}/{alias}/{path}", into the hash and the
+// alias-prefixed path. A first segment naming a folder is an alias, never a hash.
+func (h *FileHandler) splitContentHash(filePath string) (hash, rest string, ok bool) {
+	hash, rest, found := strings.Cut(strings.TrimPrefix(filePath, "/"), "/")
+	if !found || len(hash) != contentHashLen || strings.Trim(hash, "0123456789abcdef") != "" {
+		return "", "", false
+	}
+	for _, f := range h.cfg.FoldersSnapshot() {
+		if f.Alias == hash {
+			return "", "", false
+		}
+	}
+	return hash, rest, true
+}
+
+// serveContentAddressed answers a request for the content-addressed path hash/rest whose current
+// content has the given ETag. When the hash is current it sets immutable cache headers and returns
+// true for the caller to write the response; otherwise it redirects to the current hash's URL.
+func serveContentAddressed(c *gin.Context, hash, rest, etag string) bool {
+	current := strings.Trim(etag, `"`)
+	if hash == current {
+		c.Header("Cache-Control", immutableCacheControl)
+		return true
+	}
+	// The route's prefix is what the path parameter leaves of the request path
+	prefix := strings.TrimSuffix(c.Request.URL.Path, c.Param("path"))
+	location := url.URL{Path: prefix + "/" + current + "/" + rest, RawQuery: c.Request.URL.RawQuery}
+	c.Header("Cache-Control", "no-cache")
+	c.Redirect(http.StatusFound, location.String())
+	return false
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateFile creates a markdown file from the request body or from the config template named by
+// ?template=. Missing parent directories are created with ?mkdirs=true; an existing file is a 409.
+func (h *FileHandler) CreateFile(c *gin.Context) {
+	filePath := strings.TrimPrefix(c.Param("path"), "/")
+	if !h.cfg.IsMarkdownFile(filePath) {
+		writeError(c, CodeNotMarkdown, ErrNotMarkdown.Error())
+		return
+	}
+	maxSize := maxWriteBody(h.cfg.MaxWriteBody)
+	content, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(c, CodeTooLarge, fmt.Sprintf("file larger than %d bytes", maxSize))
+			return
+		}
+		writeError(c, CodeInvalidRequest, "failed to read body")
+		return
+	}
+	if name := c.Query("template"); name != "" {
+		if len(content) > 0 {
+			writeError(c, CodeInvalidRequest, "send either a body or a template, not both")
+			return
+		}
+		tmpl, ok := h.cfg.Templates[name]
+		if !ok {
+			writeError(c, CodeInvalidRequest, "unknown template: "+name)
+			return
+		}
+		content = []byte(expandTemplate(tmpl, filePath, time.Now()))
+	}
+
+	wfs, relativePath, folder, ok := h.prepareTarget(c, filePath)
+	if !ok {
+		return
+	}
+	opts := mfs.WriteOptions{Exclusive: true, Parents: c.Query("mkdirs") == "true"}
+	h.writeMu.Lock()
+	err = wfs.WriteFile(relativePath, content, opts)
+	h.writeMu.Unlock()
+	if err != nil {
+		writeCreateError(c, err, "file")
+		return
+	}
+	h.notifyTreeChange(filePath)
+	h.autoCommit(c, folder, "create", relativePath)
+	recordWrite(h.audit, c, "file.create", filePath, len(content))
+
+	resp, err := h.Render(c.Request.Context(), filePath)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("file created but failed to render: %v", err))
+		return
+	}
+	c.Header("ETag", ETag(content))
+	writeJSON(c, http.StatusCreated, resp)
+}
+
+// CreateDir creates an empty directory; missing parents are created with ?mkdirs=true
+func (h *FileHandler) CreateDir(c *gin.Context) {
+	dirPath := strings.TrimSuffix(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	wfs, relativePath, _, ok := h.prepareTarget(c, dirPath)
+	if !ok {
+		return
+	}
+	h.writeMu.Lock()
+	err := wfs.Mkdir(relativePath, c.Query("mkdirs") == "true")
+	h.writeMu.Unlock()
+	if err != nil {
+		writeCreateError(c, err, "directory")
+		return
+	}
+	h.notifyTreeChange(dirPath)
+	recordWrite(h.audit, c, "dir.create", dirPath, 0)
+	writeJSON(c, http.StatusCreated, gin.H{"path": dirPath})
+}
+
+// prepareTarget validates the target of a create or delete request: it must lie in a writable
+// folder and be shown by the tree. On failure it has already sent the error response and returns false.
+func (h *FileHandler) prepareTarget(c *gin.Context, target string) (mfs.WritableFS, string, config.Folder, bool) {
+	if strings.Contains(target, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return nil, "", config.Folder{}, false
+	}
+	wfs, relativePath, folder, ok := h.resolveWritable(c, target)
+	if !ok {
+		return nil, "", config.Folder{}, false
+	}
+	if relativePath == "" || strings.HasSuffix(relativePath, "/") || strings.Contains(relativePath, "//") {
+		writeError(c, CodeInvalidPath, "a file or directory name is required")
+		return nil, "", config.Folder{}, false
+	}
+	if !h.visibleInTree(folder, relativePath) {
+		writeError(c, CodePathExcluded, "the tree does not show this path (excluded or outside sub_path)")
+		return nil, "", config.Folder{}, false
+	}
+	return wfs, relativePath, folder, true
+}
+
+// visibleInTree reports whether the tree of folder would show relativePath: it lies under the
+// folder's sub_path and no component below it is excluded globally, per repo or per folder
+func (h *FileHandler) visibleInTree(folder config.Folder, relativePath string) bool {
+	subPath := strings.Trim(folder.SubPath, "/")
+	start := 0
+	if subPath != "" {
+		if !strings.HasPrefix(relativePath, subPath+"/") {
+			return false
+		}
+		start = strings.Count(subPath, "/") + 1
+	}
+	excludes := append(append([]string{}, h.cfg.GetRepoExclude(folder.Path)...), folder.Exclude...)
+	parts := strings.Split(relativePath, "/")
+	for i := start; i < len(parts); i++ {
+		if h.cfg.IsExcluded(parts[i]) || h.cfg.IsFolderExcluded(strings.Join(parts[:i+1], "/"), excludes) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeCreateError maps an exclusive WriteFile or Mkdir error to a response
+func writeCreateError(c *gin.Context, err error, kind string) {
+	switch {
+	case os.IsExist(err):
+		writeError(c, CodeAlreadyExists, kind+" already exists")
+	case os.IsNotExist(err):
+		writeError(c, CodeNotFound, "parent directory does not exist (pass mkdirs=true to create it)")
+	case os.IsPermission(err):
+		writeError(c, CodeAccessDenied, "access denied")
+	default:
+		writeError(c, CodeInternal, fmt.Sprintf("failed to create %s: %v", kind, err))
+	}
+}
+
+// expandTemplate fills the {{title}}, {{date}} and {{time}} placeholders of a file template;
+// the title is the file name without its extension
+func expandTemplate(tmpl, filePath string, now time.Time) string {
+	name := path.Base(filePath)
+	title := strings.TrimSuffix(name, path.Ext(name))
+	return strings.NewReplacer(
+		"{{title}}", title,
+		"{{date}}", now.Format("2006-01-02"),
+		"{{time}}", now.Format("15:04"),
+	).Replace(tmpl)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createRoutes registers the routes of the create tests
+func createRoutes(r *gin.Engine, h *FileHandler) {
+	r.POST("/files/*path", h.CreateFile)
+	r.POST("/dirs/*path", h.CreateDir)
+}
+
+func postCreate(r http.Handler, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return w
+}
+
+func TestCreateFileNested(t *testing.T) {
+	r, h, dir := newFileRouter(t, map[string]string{"guide.md": "# Guide\n"}, createRoutes)
+	created := recordTreeChanges(h)
+
+	if w := postCreate(r, "/files/docs/notes/2024/today.md", "# Today\n"); w.Code != http.StatusNotFound {
+		t.Errorf("expected a missing parent to be a 404 without mkdirs, got %d", w.Code)
+	}
+	w := postCreate(r, "/files/docs/notes/2024/today.md?mkdirs=true", "# Today\n")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FileResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Path != "docs/notes/2024/today.md" || resp.Title != "Today" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes", "2024", "today.md")); string(data) != "# Today\n" {
+		t.Errorf("unexpected file content %q", data)
+	}
+
+	w = postCreate(r, "/dirs/docs/archive/old?mkdirs=true", "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for the directory, got %d: %s", w.Code, w.Body.String())
+	}
+	if info, err := os.Stat(filepath.Join(dir, "archive", "old")); err != nil || !info.IsDir() {
+		t.Errorf("expected the directory to exist, got %v", err)
+	}
+	if strings.Join(*created, ",") != "docs/notes/2024/today.md,docs/archive/old" {
+		t.Errorf("unexpected create notifications %v", *created)
+	}
+}
+
+func TestCreateFileFromTemplate(t *testing.T) {
+	r, h, dir := newFileRouter(t, nil, createRoutes)
+	h.cfg.Templates = map[string]string{"daily": "---\ndate: {{date}}\n---\n# {{title}}\n"}
+
+	if w := postCreate(r, "/files/docs/standup.md?template=daily", ""); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "standup.md"))
+	want := "---\ndate: " + time.Now().Format("2006-01-02") + "\n---\n# standup\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+	if w := postCreate(r, "/files/docs/other.md?template=nope", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown template to be rejected, got %d", w.Code)
+	}
+}
+
+func TestCreateRejects(t *testing.T) {
+	r, h, dir := newFileRouter(t, map[string]string{"guide.md": "# Guide\n"}, createRoutes)
+	h.cfg.Folders[0].Exclude = []string{"drafts/**"}
+	created := recordTreeChanges(h)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, target string
+		want         int
+		code         ErrorCode
+	}{
+		{"existing file", "/files/docs/guide.md", http.StatusConflict, CodeAlreadyExists},
+		{"existing dir", "/dirs/docs/sub", http.StatusConflict, CodeAlreadyExists},
+		{"folder root", "/dirs/docs", http.StatusBadRequest, CodeInvalidPath},
+		{"excluded target", "/files/docs/drafts/idea.md?mkdirs=true", http.StatusForbidden, CodePathExcluded},
+		{"globally excluded dir", "/dirs/docs/node_modules", http.StatusForbidden, CodePathExcluded},
+		{"not markdown", "/files/docs/notes.txt", http.StatusBadRequest, CodeNotMarkdown},
+		{"read-only folder", "/files/frozen/new.md", http.StatusMethodNotAllowed, CodeFolderReadOnly},
+		{"traversal", "/files/docs/../escape.md", http.StatusForbidden, CodePathTraversal},
+	}
+	for _, tt := range tests {
+		w := postCreate(r, tt.target, "# x\n")
+		var body APIError
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != tt.want || body.Code != tt.code {
+			t.Errorf("%s: expected %d %s, got %d %s", tt.name, tt.want, tt.code, w.Code, w.Body.String())
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "guide.md")); string(data) != "# Guide\n" {
+		t.Errorf("existing file was overwritten: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "drafts")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be created for an excluded path, stat err = %v", err)
+	}
+	if len(*created) != 0 {
+		t.Errorf("expected no create notifications, got %v", *created)
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+)
+
+// Bounds of the diagram commands of render.diagram_commands
+const (
+	defaultDiagramTimeout = 10 * time.Second
+	maxDiagramSize        = 4 << 20
+	maxDiagramCache       = 500
+)
+
+// diagramRenderer draws fences as SVG with the commands of render.diagram_commands, remembering
+// the drawings by language, command and content
+type diagramRenderer struct {
+	commands map[string]string
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+// newDiagramRenderer returns the renderer of cfg, or nil unless render.diagrams is "server" and
+// commands are configured
+func newDiagramRenderer(cfg *config.Config) *diagramRenderer {
+	if cfg.Render.Diagrams != config.DiagramsServer || len(cfg.Render.DiagramCommands) == 0 {
+		return nil
+	}
+	return &diagramRenderer{
+		commands: cfg.Render.DiagramCommands,
+		timeout:  cmp.Or(cfg.Render.DiagramTimeout, defaultDiagramTimeout),
+		cache:    map[string][]byte{},
+	}
+}
+
+// funcs returns a markdown.DiagramFunc for each configured language
+func (r *diagramRenderer) funcs() map[string]markdown.DiagramFunc {
+	if r == nil {
+		return nil
+	}
+	funcs := make(map[string]markdown.DiagramFunc, len(r.commands))
+	for lang := range r.commands {
+		funcs[lang] = func(source []byte) ([]byte, error) { return r.draw(lang, source) }
+	}
+	return funcs
+}
+
+// draw returns the drawing of source, a fence of lang, running its command unless cached
+func (r *diagramRenderer) draw(lang string, source []byte) ([]byte, error) {
+	command := r.commands[lang]
+	key := strings.Join([]string{lang, command, ETag(source)}, "\x00")
+	r.mu.Lock()
+	svg, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return svg, nil
+	}
+
+	svg, err := runDiagramCommand(command, lang, source, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= maxDiagramCache {
+		for k := range r.cache {
+			delete(r.cache, k)
+			break
+		}
+	}
+	r.cache[key] = svg
+	return svg, nil
+}
+
+// runDiagramCommand writes source to a temporary file, runs command on it and returns the SVG it
+// wrote to {output}, or to stdout, without the XML declaration or doctype before the <svg> element
+func runDiagramCommand(command, lang string, source []byte, timeout time.Duration) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "markhub-diagram-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file, output := filepath.Join(dir, "diagram."+lang), filepath.Join(dir, "diagram.svg")
+	if err := os.WriteFile(file, source, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write the diagram: %w", err)
+	}
+	words := strings.Fields(command)
+	toFile := strings.Contains(command, "{output}")
+	for i := range words {
+		words[i] = strings.NewReplacer("{file}", file, "{output}", output).Replace(words[i])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, max: maxDiagramSize, cancel: cancel}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, max: maxDiagramSize, cancel: cancel}
+	runErr := cmd.Run()
+	switch {
+	case stdout.Len() > maxDiagramSize:
+		return nil, fmt.Errorf("%s printed more than %d MiB", words[0], maxDiagramSize>>20)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, fmt.Errorf("%s timed out after %s", words[0], timeout)
+	case runErr != nil:
+		msg := strings.TrimSpace(strings.ReplaceAll(stderr.String(), dir+string(filepath.Separator), ""))
+		return nil, fmt.Errorf("%s failed: %v %s", words[0], runErr, msg)
+	}
+
+	svg := stdout.Bytes()
+	if toFile {
+		if info, err := os.Stat(output); err == nil && info.Size() > maxDiagramSize {
+			return nil, fmt.Errorf("%s wrote more than %d MiB", words[0], maxDiagramSize>>20)
+		}
+		if svg, err = os.ReadFile(output); err != nil {
+			return nil, fmt.Errorf("%s wrote no SVG", words[0])
+		}
+	}
+	svg = bytes.TrimSpace(svg)
+	start := bytes.Index(svg, []byte("<svg"))
+	if start < 0 || !bytes.HasSuffix(svg, []byte("</svg>")) {
+		return nil, fmt.Errorf("%s made no SVG", words[0])
+	}
+	return svg[start:], nil
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+)
+
+func TestServerDiagrams(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("diagram commands are shell scripts")
+	}
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"),
+		"# Guide\n\n```mermaid\ngraph TD\n```\n\n```math\nx^2\n```\n\n```dot\ndigraph {}\n```\n")
+	scripts := t.TempDir()
+	script := func(name, body string) string {
+		p := filepath.Join(scripts, name)
+		if err := os.WriteFile(p, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	runs := filepath.Join(scripts, "runs")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Render.Diagrams = config.DiagramsServer
+	cfg.Render.DiagramCommands = map[string]string{
+		// Like mermaid-cli, it writes the file named by -o
+		"mermaid": script("mmdc.sh", `echo run >> `+runs+`
+printf '<?xml version="1.0"?>\n<svg id="m"><text>%s</text></svg>\n' "$(cat "$2")" > "$4"
+`) + " -i {file} -o {output}",
+		"math": script("tex.sh", "printf '<svg id=\"t\"><text>%s</text></svg>' \"$(cat \"$1\")\"\n") + " {file}",
+		"dot":  script("dot.sh", "echo 'syntax error' >&2\nexit 1\n") + " {file}",
+	}
+	cfg.Render.DiagramTimeout = time.Second
+
+	render := func() string {
+		resp, err := NewFileHandler(cfg).Render(context.Background(), "docs/guide.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.HTML + strings.Join(resp.Warnings, "\n")
+	}
+	got := render()
+	for _, want := range []string{
+		`<div class="mermaid diagram" data-processed="true"><svg id="m"><text>graph TD</text></svg></div>`,
+		`<div class="math diagram" data-processed="true"><svg id="t"><text>x^2</text></svg></div>`,
+		`<div class="dot"><pre>digraph {}`,
+		"line 11: dot diagram not drawn:",
+		"syntax error",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %s", want, got)
+		}
+	}
+
+	// Without server rendering, mermaid is left to the web UI and the other fences stay code blocks
+	cfg.Render.Diagrams = config.DiagramsClient
+	got = render()
+	if !strings.Contains(got, `<div class="mermaid"><pre>graph TD`) || strings.Contains(got, "<svg") ||
+		strings.Contains(got, `<div class="math">`) {
+		t.Errorf("expected client-side fences in %s", got)
+	}
+	if data, err := os.ReadFile(runs); err != nil || strings.Count(string(data), "run") != 1 {
+		t.Errorf("expected one run, got %q %v", data, err)
+	}
+}
+
+func TestDiagramRendererCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("diagram commands are shell scripts")
+	}
+	scripts := t.TempDir()
+	runs := filepath.Join(scripts, "runs")
+	p := filepath.Join(scripts, "draw.sh")
+	if err := os.WriteFile(p, []byte("#!/bin/sh\necho run >> "+runs+"\necho '<svg></svg>'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	slow := filepath.Join(scripts, "slow.sh")
+	if err := os.WriteFile(slow, []byte("#!/bin/sh\nexec sleep 5\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Render.Diagrams = config.DiagramsServer
+	cfg.Render.DiagramCommands = map[string]string{"mermaid": p + " {file}", "slow": slow + " {file}"}
+	cfg.Render.DiagramTimeout = 100 * time.Millisecond
+	r := newDiagramRenderer(cfg)
+
+	for _, source := range []string{"graph TD", "graph TD", "graph LR"} {
+		if svg, err := r.draw("mermaid", []byte(source)); err != nil || string(svg) != "<svg></svg>" {
+			t.Fatalf("unexpected drawing %q %v", svg, err)
+		}
+	}
+	if data, err := os.ReadFile(runs); err != nil || strings.Count(string(data), "run") != 2 {
+		t.Errorf("expected two runs, got %q %v", data, err)
+	}
+	if _, err := r.draw("slow", []byte("x")); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	cfg.Render.Diagrams = ""
+	if newDiagramRenderer(cfg) != nil {
+		t.Error("expected no renderer without render.diagrams server")
+	}
+}
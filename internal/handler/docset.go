@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/sqlite"
+)
+
+// Dash entry types of the documents and of their headings in a docset's search index
+const (
+	docsetTypeGuide   = "Guide"
+	docsetTypeSection = "Section"
+)
+
+var docsetInfo = template.Must(template.New("Info.plist").Funcs(template.FuncMap{"xml": template.HTMLEscapeString}).
+	Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>{{xml .ID}}</string>
+	<key>CFBundleName</key>
+	<string>{{xml .Name}}</string>
+	<key>DocSetPlatformFamily</key>
+	<string>{{xml .ID}}</string>
+	<key>isDashDocset</key>
+	<true/>
+	<key>dashIndexFilePath</key>
+	<string>index.html</string>
+</dict>
+</plist>
+`))
+
+// WriteDocset renders the documents the tree shows of the folder with alias into a Dash/Zeal
+// docset bundle at dir: the static site pages of WriteSite under Contents/Resources/Documents,
+// an Info.plist, and a search index of the document titles (Guide entries) and their headings
+// (Section entries, at the rendered heading ids). Contents is regenerated from scratch. It reports
+// each document to progress and stops early when ctx is done.
+func (h *ExportHandler) WriteDocset(
+	ctx context.Context, alias, dir string, styles fs.FS, progress func(WarmProgress),
+) (WarmReport, error) {
+	var report WarmReport
+	var folder config.Folder
+	found := false
+	for _, f := range h.cfg.FoldersSnapshot() {
+		if f.Alias == alias {
+			folder, found = f, true
+			break
+		}
+	}
+	if !found {
+		return report, fmt.Errorf("no folder with alias %q", alias)
+	}
+	tree, err := h.tree.folderTree(ctx, folder)
+	if err != nil {
+		return report, err
+	}
+
+	contents := filepath.Join(dir, "Contents")
+	if err := os.RemoveAll(contents); err != nil {
+		return report, err
+	}
+	docs := filepath.Join(contents, "Resources", "Documents")
+	stylesheets, err := copyAssets(styles, filepath.Join(docs, siteAssetsDir))
+	if err != nil {
+		return report, err
+	}
+
+	paths := collectFiles(tree, nil)
+	copied := map[string]bool{}
+	index := siteFolder{Alias: folder.Alias}
+	var entries [][]any
+	seen := map[[3]string]bool{}
+	addEntry := func(name, kind, path string) {
+		// Dash expects the entries unique, as its usual schema indexes them
+		if key := [3]string{name, kind, path}; !seen[key] {
+			seen[key] = true
+			entries = append(entries, []any{nil, name, kind, path})
+		}
+	}
+	for _, node := range paths {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		title, toc, err := h.writePage(ctx, docs, node.Path, folder.Alias, stylesheets, copied)
+		if err != nil {
+			report.Failed++
+		} else {
+			report.Rendered++
+			page := pagePath(node.Path)
+			index.Pages = append(index.Pages, sitePageLink{Href: page, Title: title})
+			addEntry(title, docsetTypeGuide, page)
+			for _, item := range toc {
+				addEntry(item.Title, docsetTypeSection, page+"#"+item.Anchor)
+			}
+		}
+		progress(WarmProgress{Done: report.Rendered + report.Failed, Total: len(paths), Path: node.Path, Err: err})
+	}
+	if err := writeIndex(docs, folder.Alias, stylesheets, []siteFolder{index}); err != nil {
+		return report, err
+	}
+
+	var info bytes.Buffer
+	err = docsetInfo.Execute(&info, map[string]string{"ID": docsetID(folder.Alias), "Name": folder.Alias})
+	if err != nil {
+		return report, err
+	}
+	if err := os.WriteFile(filepath.Join(contents, "Info.plist"), info.Bytes(), 0644); err != nil {
+		return report, err
+	}
+	return report, sqlite.Write(filepath.Join(contents, "Resources", "docSet.dsidx"), sqlite.Table{
+		Name: "searchIndex",
+		SQL:  "CREATE TABLE searchIndex(id INTEGER PRIMARY KEY, name TEXT, type TEXT, path TEXT)",
+		Rows: entries,
+	})
+}
+
+// docsetID returns the bundle identifier and keyword of a folder's docset: its alias in lower
+// case, with runs of other characters than letters and digits turned into "-"
+func docsetID(alias string) string {
+	fields := strings.FieldsFunc(strings.ToLower(alias), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	if len(fields) == 0 {
+		return "markhub"
+	}
+	return strings.Join(fields, "-")
+}
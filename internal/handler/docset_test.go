@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriteDocset(t *testing.T) {
+	h, dir := newSiteExport(t)
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"), "# Intro\n\n## Getting started\n\n## Getting started\n")
+	h.cfg.Folders[0].Exclude = []string{"drafts"}
+	writeDoc(t, filepath.Join(dir, "drafts", "wip.md"), "# WIP\n")
+	h.cfg.Render.AnchorPrefix = "mh-"
+	h.files = NewFileHandler(h.cfg)
+
+	out := filepath.Join(t.TempDir(), "Docs.docset")
+	writeDoc(t, filepath.Join(out, "Contents", "Resources", "Documents", "stale.html"), "old")
+	styles := fstest.MapFS{"style.css": {Data: []byte("body{}")}}
+	report, err := h.WriteDocset(context.Background(), "docs", out, styles, func(WarmProgress) {})
+	if err != nil || report.Rendered != 2 || report.Failed != 0 {
+		t.Fatalf("unexpected report %+v, %v", report, err)
+	}
+
+	docs := filepath.Join(out, "Contents", "Resources", "Documents")
+	intro, err := os.ReadFile(filepath.Join(docs, "docs", "guide", "intro.html"))
+	if err != nil || !strings.Contains(string(intro), `id="mh-getting-started-1"`) {
+		t.Fatalf("expected the rendered page with prefixed ids, got %v:\n%s", err, intro)
+	}
+	for _, name := range []string{"index.html", "assets/style.css", "docs/logo.png"} {
+		if _, err := os.Stat(filepath.Join(docs, filepath.FromSlash(name))); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"stale.html", "docs/drafts/wip.html"} {
+		if _, err := os.Stat(filepath.Join(docs, filepath.FromSlash(name))); err == nil {
+			t.Errorf("expected no %s", name)
+		}
+	}
+	info, err := os.ReadFile(filepath.Join(out, "Contents", "Info.plist"))
+	if err != nil || !strings.Contains(string(info), "<key>CFBundleIdentifier</key>\n\t<string>docs</string>") {
+		t.Errorf("unexpected Info.plist %v:\n%s", err, info)
+	}
+
+	if _, err := h.WriteDocset(context.Background(), "missing", out, styles, func(WarmProgress) {}); err == nil {
+		t.Error("expected an error for an unknown folder")
+	}
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	index, err := exec.Command("sqlite3", filepath.Join(out, "Contents", "Resources", "docSet.dsidx"),
+		"SELECT name, type, path FROM searchIndex ORDER BY id").CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 failed: %v\n%s", err, index)
+	}
+	// Documents in tree order, each followed by its headings
+	want := "Intro|Guide|docs/guide/intro.html\n" +
+		"Intro|Section|docs/guide/intro.html#mh-intro\n" +
+		"Getting started|Section|docs/guide/intro.html#mh-getting-started\n" +
+		"Getting started|Section|docs/guide/intro.html#mh-getting-started-1\n" +
+		"Home|Guide|docs/README.html\n" +
+		"Home|Section|docs/README.html#mh-home\n"
+	if string(index) != want {
+		t.Errorf("expected the search index\n%s\ngot\n%s", want, index)
+	}
+}
+
+func TestDocsetID(t *testing.T) {
+	for alias, want := range map[string]string{"docs": "docs", "My Repo (main)": "my-repo-main", "日本": "markhub"} {
+		if got := docsetID(alias); got != want {
+			t.Errorf("%q: expected %q, got %q", alias, want, got)
+		}
+	}
+}
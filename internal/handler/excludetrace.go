@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons the tree hides a path, reported in ExcludeTrace.Reason
+const (
+	ExcludeReasonSubPath     = "sub_path"     // outside the folder's sub_path
+	ExcludeReasonGlobal      = "global"       // a global exclude matched a name (or it is the trash)
+	ExcludeReasonRepo        = "repo"         // a repo_exclude pattern of the folder's path matched
+	ExcludeReasonFolder      = "folder"       // one of the folder's own excludes matched
+	ExcludeReasonNotMarkdown = "not_markdown" // a file without a markdown extension
+	ExcludeReasonRule        = "rule"         // an exclude_rules entry matched the file's size or age
+)
+
+// ExcludeTrace explains whether the tree shows a path, and what hides it
+type ExcludeTrace struct {
+	Path     string `json:"path"`
+	FolderID string `json:"folderId"`
+	// Exists is false for a path that is not there; its patterns are still checked, but not the
+	// exclude_rules, which need the file's size and age
+	Exists   bool   `json:"exists"`
+	IsDir    bool   `json:"isDir"`
+	Excluded bool   `json:"excluded"`
+	Reason   string `json:"reason,omitempty"`
+	// Pattern is the exclude pattern that matched, and Component the folder-relative path it matched:
+	// the path itself or a directory above it
+	Pattern   string `json:"pattern,omitempty"`
+	Component string `json:"component,omitempty"`
+	// Rule is the exclude_rules entry that matched, at RuleIndex
+	Rule      *config.ExcludeRule `json:"rule,omitempty"`
+	RuleIndex *int                `json:"ruleIndex,omitempty"`
+}
+
+// traceExclude runs the checks buildTree applies to the folder-relative relPath, stopping at the
+// first that hides it. info is nil for a path that does not exist.
+func (h *TreeHandler) traceExclude(folder config.Folder, relPath string, info *mfs.FileInfo) ExcludeTrace {
+	trace := ExcludeTrace{Path: folder.Alias + "/" + relPath, FolderID: folder.ID, Exists: info != nil}
+	if info != nil {
+		trace.IsDir = info.IsDir
+	}
+	hide := func(reason, pattern, component string) ExcludeTrace {
+		trace.Excluded, trace.Reason, trace.Pattern, trace.Component = true, reason, pattern, component
+		return trace
+	}
+
+	start := 0
+	if folder.SubPath != "" {
+		if relPath != folder.SubPath && !strings.HasPrefix(relPath, folder.SubPath+"/") {
+			return hide(ExcludeReasonSubPath, "", "")
+		}
+		start = len(folder.SubPath) + 1
+	}
+	// Like buildTree, which never enters an excluded directory, the topmost match wins
+	repo := h.cfg.GetRepoExclude(folder.Path)
+	for i := start; i <= len(relPath); i++ {
+		if i < len(relPath) && relPath[i] != '/' {
+			continue
+		}
+		component := relPath[:i]
+		if pattern, ok := h.cfg.GlobalExcludeMatch(component); ok {
+			return hide(ExcludeReasonGlobal, pattern, component)
+		}
+		if pattern, ok := h.cfg.FolderExcludeMatch(component, repo); ok {
+			return hide(ExcludeReasonRepo, pattern, component)
+		}
+		if pattern, ok := h.cfg.FolderExcludeMatch(component, folder.Exclude); ok {
+			return hide(ExcludeReasonFolder, pattern, component)
+		}
+	}
+	if trace.IsDir {
+		return trace
+	}
+	if !h.cfg.IsMarkdownFile(relPath) {
+		return hide(ExcludeReasonNotMarkdown, "", "")
+	}
+	if info != nil {
+		if i, ok := h.cfg.ExcludeRuleMatch(relPath, info.Size, info.ModTime); ok {
+			rule := h.cfg.ExcludeRules[i]
+			trace.Rule, trace.RuleIndex = &rule, &i
+			return hide(ExcludeReasonRule, rule.Pattern, "")
+		}
+	}
+	return trace
+}
+
+// TraceExclude reports whether the tree shows ?path=<alias>/<path>, and which global, repo or
+// folder exclude pattern, or which exclude rule, hides it
+func (h *TreeHandler) TraceExclude(c *gin.Context) {
+	alias, relPath, _ := strings.Cut(strings.Trim(c.Query("path"), "/"), "/")
+	if alias == "" || relPath == "" {
+		writeError(c, CodeInvalidRequest, "path must name a file or directory as alias/path")
+		return
+	}
+	if strings.Contains(relPath, "..") {
+		writeError(c, CodePathTraversal, "path traversal not allowed")
+		return
+	}
+	var folder config.Folder
+	found := false
+	for _, f := range h.cfg.FoldersSnapshot() {
+		if f.Alias == alias {
+			folder, found = f, true
+			break
+		}
+	}
+	if !found {
+		writeError(c, CodeFolderNotFound, "folder not found")
+		return
+	}
+
+	var info *mfs.FileInfo
+	stat, err := fsForFolder(c.Request.Context(), folder).Stat(relPath)
+	switch {
+	case err == nil:
+		info = &stat
+	case !errors.Is(err, os.ErrNotExist):
+		writeError(c, CodeFolderUnreadable, "cannot stat path: "+err.Error())
+		return
+	}
+	writeJSON(c, http.StatusOK, h.traceExclude(folder, relPath, info))
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTraceExclude(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "docs", "guide.md"), "# Guide\n")
+	writeDoc(t, filepath.Join(dir, "docs", "vendor", "lib.md"), "# Lib\n")
+	writeDoc(t, filepath.Join(dir, "docs", "internal", "plan.md"), "# Plan\n")
+	writeDoc(t, filepath.Join(dir, "docs", "drafts", "wip.md"), "# WIP\n")
+	writeDoc(t, filepath.Join(dir, "docs", "dump.md"), strings.Repeat("x", 2048))
+	writeDoc(t, filepath.Join(dir, "docs", "notes.txt"), "notes\n")
+	writeDoc(t, filepath.Join(dir, "other", "x.md"), "# X\n")
+	cfg := config.DefaultConfig()
+	cfg.Exclude = append(cfg.Exclude, "vendor")
+	cfg.RepoExclude = map[string][]string{dir: {"docs/internal/**"}}
+	cfg.ExcludeRules = []config.ExcludeRule{{Pattern: "*.txt", SizeGT: 1 << 20}, {SizeGT: 1024}}
+	cfg.Folders = []config.Folder{
+		{ID: "repo", Path: dir, Alias: "repo", SubPath: "docs", Exclude: []string{"drafts"}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	r := gin.New()
+	r.GET("/debug/exclude-trace", tree.TraceExclude)
+	trace := func(path string) (int, ExcludeTrace) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/exclude-trace?path="+url.QueryEscape(path), nil))
+		var resp ExcludeTrace
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	for _, tt := range []struct {
+		path, reason, pattern, component string
+	}{
+		{"repo/docs/guide.md", "", "", ""},
+		{"repo/docs", "", "", ""},
+		{"repo/other/x.md", ExcludeReasonSubPath, "", ""},
+		{"repo/docs/vendor/lib.md", ExcludeReasonGlobal, "vendor", "docs/vendor"},
+		{"repo/docs/internal/plan.md", ExcludeReasonRepo, "docs/internal/**", "docs/internal/plan.md"},
+		{"repo/docs/drafts/wip.md", ExcludeReasonFolder, "drafts", "docs/drafts"},
+		{"repo/docs/notes.txt", ExcludeReasonNotMarkdown, "", ""},
+		{"repo/docs/.markhub-trash/old.md", ExcludeReasonGlobal, config.TrashDir, "docs/.markhub-trash"},
+	} {
+		code, got := trace(tt.path)
+		if code != http.StatusOK || got.Excluded != (tt.reason != "") || got.Reason != tt.reason ||
+			got.Pattern != tt.pattern || got.Component != tt.component {
+			t.Errorf("%s: expected %q %q %q, got %d %+v", tt.path, tt.reason, tt.pattern, tt.component, code, got)
+		}
+	}
+
+	// Rules need the file's size, so only existing files are checked against them
+	_, got := trace("repo/docs/dump.md")
+	if got.Reason != ExcludeReasonRule || got.RuleIndex == nil || *got.RuleIndex != 1 || got.Rule.SizeGT != 1024 ||
+		!got.Exists {
+		t.Errorf("expected the second rule to hide dump.md, got %+v", got)
+	}
+	if _, got := trace("repo/docs/missing.md"); got.Exists || got.Excluded {
+		t.Errorf("expected a missing file to pass, got %+v", got)
+	}
+
+	for path, want := range map[string]int{
+		"repo":             http.StatusBadRequest,
+		"missing/x.md":     http.StatusNotFound,
+		"repo/../etc/x.md": http.StatusForbidden,
+	} {
+		if code, _ := trace(path); code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, code)
+		}
+	}
+
+	// The trace agrees with the tree
+	root, err := tree.folderTree(context.Background(), cfg.Folders[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := collectFiles(root, nil)
+	if len(files) != 1 || files[0].Path != "repo/docs/guide.md" {
+		t.Errorf("expected the tree to show guide.md alone, got %d files", len(files))
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// ManifestLink is an outbound link or image of an exported document
+type ManifestLink struct {
+	markdown.Link
+	// Target is the alias-prefixed path a relative destination resolves to
+	Target string `json:"target,omitempty"`
+	// Broken marks a relative destination that is missing or outside the folder
+	Broken bool `json:"broken,omitempty"`
+}
+
+// ManifestDocument describes one markdown file of an exported folder
+type ManifestDocument struct {
+	Path    string             `json:"path"`
+	Title   string             `json:"title"`
+	TOC     []markdown.TOCItem `json:"toc"`
+	Links   []ManifestLink     `json:"links"`
+	ModTime timestamp.Time     `json:"modTime"`
+	// Error is set instead of the other fields when the file could not be read or parsed
+	Error string `json:"error,omitempty"`
+}
+
+// ExportManifest lists every document of a folder for static site generators
+type ExportManifest struct {
+	Alias     string             `json:"alias"`
+	FolderID  string             `json:"folderId"`
+	Documents []ManifestDocument `json:"documents"`
+}
+
+// ExportHandler serves whole-folder exports
+type ExportHandler struct {
+	cfg   *config.Config
+	tree  *TreeHandler
+	files *FileHandler
+}
+
+// NewExportHandler creates an export handler walking folders with tree and parsing with files
+func NewExportHandler(cfg *config.Config, tree *TreeHandler, files *FileHandler) *ExportHandler {
+	return &ExportHandler{cfg: cfg, tree: tree, files: files}
+}
+
+// GetManifest returns the path, title, TOC and outbound links of every document the tree shows
+// for the folder named by ?alias=, in tree order
+func (h *ExportHandler) GetManifest(c *gin.Context) {
+	alias := c.Query("alias")
+	if alias == "" {
+		writeError(c, CodeInvalidRequest, "alias is required")
+		return
+	}
+	var folder config.Folder
+	found := false
+	for _, f := range h.cfg.FoldersSnapshot() {
+		if f.Alias == alias {
+			folder, found = f, true
+			break
+		}
+	}
+	if !found {
+		writeError(c, CodeFolderNotFound, "folder not found")
+		return
+	}
+
+	ctx := c.Request.Context()
+	tree, err := h.tree.folderTree(ctx, folder)
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		writeError(c, CodeFolderUnreadable, "folder not readable: "+err.Error())
+		return
+	}
+
+	manifest := ExportManifest{Alias: folder.Alias, FolderID: folder.ID, Documents: []ManifestDocument{}}
+	for _, node := range collectFiles(tree, nil) {
+		if ctx.Err() != nil {
+			break
+		}
+		manifest.Documents = append(manifest.Documents, h.document(c, node.Path))
+	}
+	if requestDone(c) {
+		return
+	}
+	writeJSON(c, http.StatusOK, manifest)
+}
+
+// document parses one file into its manifest entry, resolving relative links against the folder
+func (h *ExportHandler) document(c *gin.Context, filePath string) ManifestDocument {
+	doc, err := h.files.parse(c.Request.Context(), filePath, RenderOptions{})
+	if err != nil {
+		return ManifestDocument{Path: filePath, Error: err.Error()}
+	}
+	links := make([]ManifestLink, 0, len(doc.result.Links))
+	for _, l := range doc.result.Links {
+		link := ManifestLink{Link: l}
+		if dest, ok := markdown.RelativeTarget(l.Dest); ok {
+			target, inside := linkTarget(doc.relativePath, dest)
+			if inside {
+				link.Target = doc.folder.Alias + "/" + target
+				_, statErr := doc.fs.Stat(target)
+				link.Broken = statErr != nil
+			} else {
+				link.Broken = true
+			}
+		}
+		links = append(links, link)
+	}
+	toc := doc.result.TOC
+	if toc == nil {
+		toc = []markdown.TOCItem{}
+	}
+	return ManifestDocument{
+		Path:    filePath,
+		Title:   doc.result.Title,
+		TOC:     toc,
+		Links:   links,
+		ModTime: timestamp.New(doc.info.ModTime),
+	}
+}
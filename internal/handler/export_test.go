@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "README.md"),
+		"# Home\n\n## Setup\n\nSee [guide](guide/intro.md#start), [gone](missing.md) and <https://example.com>.\n")
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"), "# Intro\n\n![logo](../logo.png) [up](../../etc/passwd)\n")
+	writeDoc(t, filepath.Join(dir, "drafts", "wip.md"), "# WIP\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs", Exclude: []string{"drafts/**"}}}
+
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	h := NewExportHandler(cfg, tree, NewFileHandler(cfg))
+	r := gin.New()
+	r.GET("/export-manifest", h.GetManifest)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export-manifest?alias=docs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Alias != "docs" || manifest.FolderID != "docs" || len(manifest.Documents) != 2 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	// Directories come first in tree order; excluded files are left out
+	intro, home := manifest.Documents[0], manifest.Documents[1]
+	if intro.Path != "docs/guide/intro.md" || home.Path != "docs/README.md" {
+		t.Fatalf("unexpected documents: %s, %s", intro.Path, home.Path)
+	}
+	if home.Title != "Home" || len(home.TOC) != 2 || home.TOC[1].Anchor != "setup" {
+		t.Errorf("unexpected title or TOC: %q %+v", home.Title, home.TOC)
+	}
+	want := []ManifestLink{
+		{Target: "docs/guide/intro.md"},
+		{Target: "docs/missing.md", Broken: true},
+		{},
+	}
+	if len(home.Links) != len(want) {
+		t.Fatalf("unexpected links: %+v", home.Links)
+	}
+	for i, l := range home.Links {
+		if l.Target != want[i].Target || l.Broken != want[i].Broken || l.Line != 5 {
+			t.Errorf("link %d: got %+v, want target %q broken %v", i, l, want[i].Target, want[i].Broken)
+		}
+	}
+	if home.Links[2].Dest != "https://example.com" {
+		t.Errorf("expected the autolink, got %+v", home.Links[2])
+	}
+	if len(intro.Links) != 2 {
+		t.Fatalf("unexpected intro links: %+v", intro.Links)
+	}
+	logo, up := intro.Links[0], intro.Links[1]
+	if !logo.Image || !logo.Broken || logo.Target != "docs/logo.png" || !up.Broken || up.Target != "" {
+		t.Errorf("unexpected intro links: %+v", intro.Links)
+	}
+
+	for target, want := range map[string]int{
+		"/export-manifest":            http.StatusBadRequest,
+		"/export-manifest?alias=nope": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, w.Code)
+		}
+	}
+}
@@ -2,15 +2,24 @@
 package handler
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/CageChen/markhub/internal/audit"
 	"github.com/CageChen/markhub/internal/config"
 	mfs "github.com/CageChen/markhub/internal/fs"
 	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/CageChen/markhub/internal/watcher"
 	"github.com/gin-gonic/gin"
 )
 
@@ -20,34 +29,103 @@ type FileResponse struct {
 	Title    string             `json:"title"`
 	HTML     string             `json:"html"`
 	TOC      []markdown.TOCItem `json:"toc"`
-	ModTime  time.Time          `json:"modTime"`
-	FolderID int                `json:"folderId"`
+	ModTime  timestamp.Time     `json:"modTime"`
+	FolderID string             `json:"folderId"`
+	Warnings []string           `json:"warnings,omitempty"`
+	// Tasks locates the task list items, for checking them with PATCH /tasks
+	Tasks []markdown.Task `json:"tasks,omitempty"`
+	// ETag is the strong entity tag of the markdown source, for If-Match when saving it
+	ETag string `json:"etag"`
+	// LockConflict is set on a save when another client holds the document's edit lock
+	LockConflict *EditLock `json:"lock_conflict,omitempty"`
+}
+
+// largeImageSize is the size above which a linked image is reported as a render warning
+const largeImageSize = 5 << 20
+
+// maxParseCache bounds how many parsed documents FileHandler keeps
+const maxParseCache = 20000
+
+// cachedParse is a parse result kept for as long as the document's content is unchanged
+type cachedParse struct {
+	etag   string
+	result *markdown.ParseResult
 }
 
 // FileHandler handles file content API requests
 type FileHandler struct {
-	cfg    *config.Config
-	parser *markdown.Parser
+	cfg          *config.Config
+	parsers      map[string]*markdown.Parser
+	audit        *audit.Logger
+	writeMu      sync.Mutex
+	commitMu     sync.Mutex
+	onSave       []func(path, clientID string)
+	lockConflict func(path, clientID string) *EditLock
+	onTreeChange []func(path string)
+	onView       []func(path string)
+
+	// parsed caches parse results by folder ID, html_mode and path; see parse
+	parsedMu sync.Mutex
+	parsed   map[string]cachedParse
+
+	// lintRuns caches the issues of external linters; see GetLintRun
+	lintRunsMu sync.Mutex
+	lintRuns   map[string][]markdown.LintIssue
+
+	// variants keeps resized images; see GetAsset
+	variants *variantCache
 }
 
 // NewFileHandler creates a new file handler
 func NewFileHandler(cfg *config.Config) *FileHandler {
+	fences := markdown.DefaultFences()
+	if !cfg.Render.Mermaid {
+		delete(fences, markdown.FenceMermaid)
+	}
+	diagrams := newDiagramRenderer(cfg).funcs()
+	parser := func(mode markdown.HTMLMode) *markdown.Parser {
+		return markdown.New(markdown.Options{
+			HTMLMode:           mode,
+			CodeLanguage:       cfg.Render.CodeLanguage,
+			Fences:             fences,
+			Diagrams:           diagrams,
+			Normalize:          cfg.Render.NormalizeWhitespace,
+			AnchorPrefix:       cfg.Render.AnchorPrefix,
+			DisabledExtensions: cfg.Render.DisabledExtensions,
+		})
+	}
 	return &FileHandler{
-		cfg:    cfg,
-		parser: markdown.NewParser(),
+		cfg:      cfg,
+		audit:    audit.New(cfg.GetAuditLogPath()),
+		parsed:   map[string]cachedParse{},
+		lintRuns: map[string][]markdown.LintIssue{},
+		variants: newVariantCache(config.GetAssetCacheDir(), cfg.Assets.VariantCacheSize),
+		parsers: map[string]*markdown.Parser{
+			config.HTMLModeUnsafe:   parser(markdown.HTMLUnsafe),
+			config.HTMLModeSanitize: parser(markdown.HTMLSanitize),
+			config.HTMLModeStrip:    parser(markdown.HTMLStrip),
+		},
 	}
 }
 
-// resolvePath resolves a file path to its folder ID and relative path.
+// parserFor returns the parser applying folder's html_mode
+func (h *FileHandler) parserFor(folder config.Folder) *markdown.Parser {
+	if p, ok := h.parsers[folder.HTMLMode]; ok {
+		return p
+	}
+	return h.parsers[config.HTMLModeUnsafe]
+}
+
+// resolvePath resolves a file path to its folder and relative path.
 // Path format: {alias}/{relativePath} e.g., "markhub/docs/README.md"
-func (h *FileHandler) resolvePath(filePath string) (mfs.FileSystem, string, int, error) {
+func (h *FileHandler) resolvePath(ctx context.Context, filePath string) (mfs.FileSystem, string, config.Folder, error) {
 	filePath = strings.TrimPrefix(filePath, "/")
 
 	if filePath == "" {
-		return nil, "", 0, os.ErrNotExist
+		return nil, "", config.Folder{}, os.ErrNotExist
 	}
 
-	var folderID int
+	var folder config.Folder
 	var relativePath string
 	found := false
 
@@ -58,146 +136,465 @@ func (h *FileHandler) resolvePath(filePath string) (mfs.FileSystem, string, int,
 	}
 
 	// Match by folder alias
-	for i, f := range h.cfg.Folders {
+	for _, f := range h.cfg.FoldersSnapshot() {
 		if f.Alias == prefix {
-			folderID = i
+			folder = f
 			found = true
 			break
 		}
 	}
 
 	if !found {
-		return nil, "", 0, os.ErrNotExist
+		return nil, "", config.Folder{}, os.ErrNotExist
 	}
 
-	folder := h.cfg.Folders[folderID]
-
 	// Security: prevent path traversal
 	if strings.Contains(relativePath, "..") {
-		return nil, "", 0, os.ErrPermission
+		return nil, "", config.Folder{}, os.ErrPermission
 	}
 
-	fs := fsForFolder(folder)
-	return fs, relativePath, folderID, nil
+	fs := fsForFolder(ctx, folder)
+	return fs, relativePath, folder, nil
 }
 
-// GetFile returns the rendered HTML for a markdown file
-func (h *FileHandler) GetFile(c *gin.Context) {
-	filePath := c.Param("path")
-	if filePath == "" {
-		filePath = c.Query("path")
+// Errors returned by Render besides os.ErrNotExist and os.ErrPermission
+var (
+	ErrIsDirectory = errors.New("path is a directory")
+	ErrInvalidPath = errors.New("invalid path")
+)
+
+// ErrNotMarkdown is returned by CheckFile for files the tree would not list
+var ErrNotMarkdown = errors.New("not a markdown file")
+
+// CheckFile reports whether an alias-prefixed path resolves to a markdown file, using the same rules as the file API
+func (h *FileHandler) CheckFile(ctx context.Context, filePath string) error {
+	if !h.cfg.IsMarkdownFile(filePath) {
+		return ErrNotMarkdown
+	}
+	fs, relativePath, _, err := h.resolvePath(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	info, err := fs.Stat(relativePath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return ErrIsDirectory
 	}
+	return nil
+}
+
+// RenderOptions tunes RenderWithOptions
+type RenderOptions struct {
+	// InlineImages embeds relative images as data URIs, up to maxInlineImages bytes per document,
+	// so the HTML needs no further requests (e.g. for git_ref folders or standalone exports)
+	InlineImages bool
+	// Sections wraps each top-level heading and the content up to the next one in
+	// <section data-anchor="...">, for scroll-sync and section navigation
+	Sections bool
+}
+
+// Render resolves an alias-prefixed path (e.g. "markhub/docs/README.md") and renders the markdown file.
+// Errors satisfy os.IsNotExist / os.IsPermission or match ErrIsDirectory / ErrInvalidPath where applicable.
+func (h *FileHandler) Render(ctx context.Context, filePath string) (*FileResponse, error) {
+	return h.RenderWithOptions(ctx, filePath, RenderOptions{})
+}
+
+// RenderWithOptions is Render with per-request options
+func (h *FileHandler) RenderWithOptions(
+	ctx context.Context, filePath string, opts RenderOptions,
+) (*FileResponse, error) {
+	doc, err := h.parse(ctx, filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &FileResponse{
+		Path:     strings.TrimPrefix(filePath, "/"),
+		Title:    doc.result.Title,
+		HTML:     doc.result.HTML,
+		TOC:      doc.result.TOC,
+		ModTime:  timestamp.New(doc.info.ModTime),
+		FolderID: doc.folder.ID,
+		Warnings: doc.result.Warnings,
+		Tasks:    doc.result.Tasks,
+		ETag:     doc.etag,
+	}, nil
+}
+
+// parsedFile is a markdown file read and parsed by FileHandler.parse
+type parsedFile struct {
+	result       *markdown.ParseResult
+	info         mfs.FileInfo
+	folder       config.Folder
+	fs           mfs.FileSystem
+	relativePath string
+	etag         string
+}
 
+// parse resolves and parses the markdown file at an alias-prefixed path; errors are those of Render
+func (h *FileHandler) parse(ctx context.Context, filePath string, opts RenderOptions) (*parsedFile, error) {
 	// Security: prevent path traversal
 	if strings.Contains(filePath, "..") {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "invalid path",
-		})
-		return
+		return nil, os.ErrPermission
 	}
 
-	fs, relativePath, folderID, err := h.resolvePath(filePath)
+	fs, relativePath, folder, err := h.resolvePath(ctx, filePath)
 	if err != nil {
-		status := http.StatusBadRequest
-		msg := err.Error()
-		if os.IsNotExist(err) {
-			status = http.StatusNotFound
-			msg = "file not found"
-		} else if os.IsPermission(err) {
-			status = http.StatusForbidden
-			msg = "access denied"
+		if !os.IsNotExist(err) && !os.IsPermission(err) {
+			err = fmt.Errorf("%w: %v", ErrInvalidPath, err)
 		}
-		c.JSON(status, gin.H{"error": msg})
-		return
+		return nil, err
 	}
 
 	// Check if file exists and is not a directory
 	info, err := fs.Stat(relativePath)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "file not found",
-		})
-		return
+		return nil, err
 	}
-
 	if info.IsDir {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "path is a directory",
-		})
-		return
+		return nil, ErrIsDirectory
 	}
 
 	// Read and parse the file
 	content, err := fs.ReadFile(relativePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "file not found",
-			})
-			return
+			return nil, os.ErrNotExist
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("failed to read file: %v", err),
-		})
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	etag := ETag(content)
+	parsed := &parsedFile{info: info, folder: folder, fs: fs, relativePath: relativePath, etag: etag}
+	// Documents with inlined images are too large to keep
+	cacheKey := folder.ID + "\x00" + folder.HTMLMode + "\x00" + strconv.FormatBool(opts.Sections) + "\x00" + relativePath
+	if !opts.InlineImages {
+		if result, ok := h.cachedParse(cacheKey, etag); ok {
+			parsed.result = result
+			return parsed, nil
+		}
+	}
+
+	parseOpts := markdown.ParseOptions{
+		Resolve:       linkResolver(fs, relativePath),
+		MaxImageSize:  largeImageSize,
+		ExternalImage: externalImagePolicy(h.cfg.Render),
+	}
+	if opts.InlineImages {
+		// The sanitizer drops SVG data URIs
+		parseOpts.InlineImage = imageInliner(fs, relativePath, folder.HTMLMode != config.HTMLModeSanitize)
+	}
+	result, err := h.parserFor(folder).WithSectionWrappers(opts.Sections).ParseWithOptions(content, parseOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse markdown: %w", err)
+	}
+	if !opts.InlineImages {
+		h.cacheParse(cacheKey, cachedParse{etag: etag, result: result})
+	}
+	parsed.result = result
+	return parsed, nil
+}
+
+// cachedParse returns the cached parse result of key if it was made from the content with etag
+func (h *FileHandler) cachedParse(key, etag string) (*markdown.ParseResult, bool) {
+	h.parsedMu.Lock()
+	defer h.parsedMu.Unlock()
+	cached, ok := h.parsed[key]
+	if !ok || cached.etag != etag {
+		return nil, false
+	}
+	return cached.result, true
+}
+
+// cacheParse keeps a parse result, making room by dropping an arbitrary one when the cache is full
+func (h *FileHandler) cacheParse(key string, entry cachedParse) {
+	h.parsedMu.Lock()
+	defer h.parsedMu.Unlock()
+	if _, ok := h.parsed[key]; !ok && len(h.parsed) >= maxParseCache {
+		for k := range h.parsed {
+			delete(h.parsed, k)
+			break
+		}
+	}
+	h.parsed[key] = entry
+}
+
+// InvalidateCache drops every cached parse result. Results are keyed by the document's content, but
+// their broken-link warnings depend on other files, so the cache is cleared when files are created,
+// moved or deleted through the API.
+func (h *FileHandler) InvalidateCache() {
+	h.parsedMu.Lock()
+	defer h.parsedMu.Unlock()
+	clear(h.parsed)
+}
+
+// OnFileChange clears the parse cache when a file appears or disappears outside the API, as that
+// may break or fix links; it is called by the file watcher
+func (h *FileHandler) OnFileChange(e watcher.Event) {
+	if e.Type != watcher.EventWrite {
+		h.InvalidateCache()
+	}
+}
+
+// linkResolver resolves link destinations relative to the document at docPath within fs;
+// targets outside the folder count as broken
+func linkResolver(fs mfs.FileSystem, docPath string) func(string) (int64, bool) {
+	return func(dest string) (int64, bool) {
+		target, ok := linkTarget(docPath, dest)
+		if !ok {
+			return 0, false
+		}
+		info, err := fs.Stat(target)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size, true
+	}
+}
+
+// maxInlineImages caps the bytes of images one document inlines as data URIs
+const maxInlineImages = 8 << 20
+
+// inlineImageTypes are the image types inlined, by extension; goldmark renders these data URIs
+var inlineImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+}
+
+// imageInliner returns a markdown.ParseOptions.InlineImage reading images relative to the document
+// at docPath from fs, until maxInlineImages bytes are used. Missing images are left alone, since
+// they are reported as broken anyway.
+func imageInliner(fs mfs.FileSystem, docPath string, svg bool) func(string) (string, error) {
+	budget := int64(maxInlineImages)
+	return func(dest string) (string, error) {
+		mimeType, ok := inlineImageTypes[strings.ToLower(path.Ext(dest))]
+		if !ok || (!svg && mimeType == "image/svg+xml") {
+			return "", errors.New("unsupported image type")
+		}
+		target, inside := linkTarget(docPath, dest)
+		if !inside {
+			return "", nil
+		}
+		info, err := fs.Stat(target)
+		if err != nil || info.IsDir {
+			return "", nil
+		}
+		if info.Size > budget {
+			return "", fmt.Errorf("more than %d MiB of images in the document", maxInlineImages>>20)
+		}
+		data, err := fs.ReadFile(target)
+		if err != nil {
+			return "", err
+		}
+		budget -= int64(len(data))
+		return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+	}
+}
+
+// linkTarget returns the folder-relative path a relative destination in the document at docPath
+// points to, or false when it leaves the folder
+func linkTarget(docPath, dest string) (string, bool) {
+	target := path.Join(path.Dir(docPath), dest)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return "", false
+	}
+	if target == "." {
+		target = ""
+	}
+	return target, true
+}
+
+// GetFile returns the rendered HTML for a markdown file. A path starting with the hash of the
+// file's content is content-addressed (see serveContentAddressed).
+func (h *FileHandler) GetFile(c *gin.Context) {
+	filePath := c.Param("path")
+	if filePath == "" {
+		filePath = c.Query("path")
+	}
+
+	// Security: prevent path traversal
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
 		return
 	}
+	hash, rest, addressed := h.splitContentHash(c.Param("path"))
+	if addressed {
+		filePath = rest
+	}
 
-	result, err := h.parser.Parse(content)
+	var opts RenderOptions
+	opts.InlineImages, _ = strconv.ParseBool(c.Query("inline_images"))
+	opts.Sections, _ = strconv.ParseBool(c.Query("sections"))
+	resp, err := h.RenderWithOptions(c.Request.Context(), filePath, opts)
+	if requestDone(c) {
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to parse markdown: " + err.Error(),
-		})
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
 		return
 	}
+	if addressed && !serveContentAddressed(c, hash, rest, resp.ETag) {
+		return
+	}
+	if !addressed {
+		setCacheControl(c, h.cfg.Cache.HTMLControl())
+	}
 
-	c.JSON(http.StatusOK, FileResponse{
-		Path:     strings.TrimPrefix(filePath, "/"),
-		Title:    result.Title,
-		HTML:     result.HTML,
-		TOC:      result.TOC,
-		ModTime:  info.ModTime,
-		FolderID: folderID,
-	})
+	for _, cb := range h.onView {
+		cb(resp.Path)
+	}
+	c.Header("ETag", resp.ETag)
+	writeJSON(c, http.StatusOK, resp)
 }
 
-// GetRaw returns the raw markdown content
+// renderErrorCode maps a Render error to an error code and message
+func renderErrorCode(err error) (ErrorCode, string) {
+	switch {
+	case os.IsNotExist(err):
+		return CodeNotFound, "file not found"
+	case os.IsPermission(err):
+		return CodeAccessDenied, "access denied"
+	case errors.Is(err, ErrIsDirectory):
+		return CodeIsDirectory, err.Error()
+	case errors.Is(err, ErrInvalidPath):
+		return CodeInvalidPath, err.Error()
+	default:
+		return CodeInternal, err.Error()
+	}
+}
+
+// RawResponse is the JSON form of GetRaw, for clients that need the source and its
+// modification time together (e.g. to detect conflicting edits before saving)
+type RawResponse struct {
+	Path    string         `json:"path"`
+	Content string         `json:"content"`
+	ModTime timestamp.Time `json:"modTime"`
+	Size    int64          `json:"size"`
+	ETag    string         `json:"etag"`
+	// LockConflict is set on a save when another client holds the document's edit lock
+	LockConflict *EditLock `json:"lock_conflict,omitempty"`
+}
+
+func rawResponse(filePath string, content []byte, modTime time.Time) RawResponse {
+	return RawResponse{
+		Path:    strings.TrimPrefix(filePath, "/"),
+		Content: string(content),
+		ModTime: timestamp.New(modTime),
+		Size:    int64(len(content)),
+		ETag:    ETag(content),
+	}
+}
+
+// wantsRawJSON reports whether GetRaw should answer with a RawResponse: for ?meta=1 or
+// when the Accept header prefers JSON over markdown
+func wantsRawJSON(c *gin.Context) bool {
+	if meta, err := strconv.ParseBool(c.Query("meta")); err == nil {
+		return meta
+	}
+	return c.NegotiateFormat("text/markdown", gin.MIMEJSON) == gin.MIMEJSON
+}
+
+// GetRaw returns the raw markdown content, or a RawResponse when JSON is requested. Uploaded
+// image types are served as images. Like GetFile it serves content-addressed paths.
 func (h *FileHandler) GetRaw(c *gin.Context) {
 	filePath := c.Param("path")
 
 	if strings.Contains(filePath, "..") {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "invalid path",
-		})
+		writeError(c, CodePathTraversal, "invalid path")
 		return
 	}
+	hash, rest, addressed := h.splitContentHash(filePath)
+	if addressed {
+		filePath = rest
+	}
 
-	fs, relativePath, _, err := h.resolvePath(filePath)
+	fs, relativePath, _, err := h.resolvePath(c.Request.Context(), filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "file not found",
-			})
+			writeError(c, CodeNotFound, "file not found")
 		} else {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "access denied",
-			})
+			writeError(c, CodeAccessDenied, "access denied")
 		}
 		return
 	}
 
-	content, err := fs.ReadFile(relativePath)
+	c.Header("Vary", "Accept")
+	asJSON := wantsRawJSON(c)
+	var info mfs.FileInfo
+	if asJSON {
+		info, err = fs.Stat(relativePath)
+		if err == nil && info.IsDir {
+			writeError(c, CodeIsDirectory, ErrIsDirectory.Error())
+			return
+		}
+	}
+	var content []byte
+	if err == nil {
+		content, err = fs.ReadFile(relativePath)
+	}
+	if requestDone(c) {
+		return
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "file not found",
-			})
+			writeError(c, CodeNotFound, "file not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("failed to read file: %v", err),
-		})
+		writeError(c, CodeInternal, fmt.Sprintf("failed to read file: %v", err))
+		return
+	}
+
+	if addressed && !serveContentAddressed(c, hash, rest, ETag(content)) {
 		return
 	}
+	if !addressed {
+		setCacheControl(c, h.cfg.Cache.RawControl())
+	}
+	c.Header("ETag", ETag(content))
+	if asJSON {
+		writeJSON(c, http.StatusOK, rawResponse(filePath, content, info.ModTime))
+		return
+	}
+	c.Data(http.StatusOK, rawContentType(filePath), content)
+}
 
-	c.Data(http.StatusOK, "text/markdown; charset=utf-8", content)
+// GetPlain returns a markdown file as plain text, for consumers that want its words rather than
+// HTML: the text of the document without markup or front matter, code blocks verbatim
+func (h *FileHandler) GetPlain(c *gin.Context) {
+	filePath := c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.CheckFile(ctx, filePath); err != nil {
+		if errors.Is(err, ErrNotMarkdown) {
+			writeError(c, CodeNotMarkdown, err.Error())
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	fs, relativePath, _, err := h.resolvePath(ctx, filePath)
+	var content []byte
+	if err == nil {
+		content, err = fs.ReadFile(relativePath)
+	}
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	c.Header("ETag", ETag(content))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(markdown.PlainText(content)))
 }
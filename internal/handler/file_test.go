@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetFileStatusCodes(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"), "# Intro\n")
+	writeDoc(t, filepath.Join(dir, "locked", "secret.md"), "# Secret\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/files/*path", NewFileHandler(cfg).GetFile)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/files/docs/guide/intro.md", http.StatusOK},
+		{"/files/docs/guide/missing.md", http.StatusNotFound},
+		{"/files/unknown/intro.md", http.StatusNotFound},
+		{"/files/docs/guide", http.StatusBadRequest},
+		{"/files/docs/guide/../../etc/passwd.md", http.StatusForbidden},
+	}
+	if os.Geteuid() != 0 {
+		// Permission errors from stat must not be reported as missing files
+		if err := os.Chmod(filepath.Join(dir, "locked"), 0o000); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = os.Chmod(filepath.Join(dir, "locked"), 0o755) }()
+		tests = append(tests, struct {
+			path string
+			want int
+		}{"/files/docs/locked/secret.md", http.StatusForbidden})
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = tt.path
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCheckFileRequiresMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "intro.md"), "# Intro\n")
+	writeDoc(t, filepath.Join(dir, "notes.txt"), "plain\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	h := NewFileHandler(cfg)
+
+	if err := h.CheckFile(context.Background(), "docs/intro.md"); err != nil {
+		t.Errorf("expected docs/intro.md to be accepted, got %v", err)
+	}
+	if err := h.CheckFile(context.Background(), "docs/notes.txt"); !errors.Is(err, ErrNotMarkdown) {
+		t.Errorf("expected ErrNotMarkdown for docs/notes.txt, got %v", err)
+	}
+}
+
+func TestRenderUsesFolderHTMLMode(t *testing.T) {
+	trusted, untrusted := t.TempDir(), t.TempDir()
+	const doc = "# Doc\n\n<script>alert(1)</script>\n"
+	writeDoc(t, filepath.Join(trusted, "doc.md"), doc)
+	writeDoc(t, filepath.Join(untrusted, "doc.md"), doc)
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "mine", Path: trusted, Alias: "mine"},
+		{ID: "theirs", Path: untrusted, Alias: "theirs", HTMLMode: config.HTMLModeSanitize},
+	}
+	h := NewFileHandler(cfg)
+
+	resp, err := h.Render(context.Background(), "mine/doc.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.HTML, "<script>") {
+		t.Errorf("expected the default folder to render raw HTML, got %s", resp.HTML)
+	}
+	resp, err = h.Render(context.Background(), "theirs/doc.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(resp.HTML, "script") {
+		t.Errorf("expected the sanitized folder to drop the script, got %s", resp.HTML)
+	}
+}
+
+func TestRenderWarnsAboutBrokenLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"),
+		"# Intro\n\n[setup](setup.md) [readme](../README.md) [gone](gone.md) [escape](../../outside.md)\n")
+	writeDoc(t, filepath.Join(dir, "guide", "setup.md"), "# Setup\n")
+	writeDoc(t, filepath.Join(dir, "README.md"), "# Readme\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	resp, err := NewFileHandler(cfg).Render(context.Background(), "docs/guide/intro.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `line 3: broken link "gone.md"` + "\n" + `line 3: broken link "../../outside.md"`
+	if got := strings.Join(resp.Warnings, "\n"); got != want {
+		t.Errorf("unexpected warnings:\n%s", got)
+	}
+}
+
+func TestGetFileInlinesImages(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"),
+		"# Intro\n\n![logo](../img/logo.png) ![chart](chart.svg) ![gone](gone.png) ![notes](notes.txt)\n"+
+			"![remote](https://example.com/a.png)\n")
+	writeDoc(t, filepath.Join(dir, "img", "logo.png"), "\x89PNG fake")
+	writeDoc(t, filepath.Join(dir, "guide", "chart.svg"), "<svg/>")
+	writeDoc(t, filepath.Join(dir, "guide", "notes.txt"), "text")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: dir, Alias: "docs"},
+		{ID: "safe", Path: dir, Alias: "safe", HTMLMode: config.HTMLModeSanitize},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/files/*path", NewFileHandler(cfg).GetFile)
+
+	get := func(target string) FileResponse {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", target, w.Code, w.Body.String())
+		}
+		var resp FileResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("/files/docs/guide/intro.md")
+	if strings.Contains(resp.HTML, "data:") {
+		t.Errorf("expected no data URIs without inline_images, got %s", resp.HTML)
+	}
+
+	resp = get("/files/docs/guide/intro.md?inline_images=1")
+	for _, want := range []string{
+		`src="data:image/png;base64,iVBORyBmYWtl"`,
+		`src="data:image/svg+xml;base64,PHN2Zy8+"`,
+		`src="gone.png"`,
+		`src="https://example.com/a.png"`,
+	} {
+		if !strings.Contains(resp.HTML, want) {
+			t.Errorf("expected %s in %s", want, resp.HTML)
+		}
+	}
+	want := `line 3: broken image "gone.png"` + "\n" + `line 3: image "notes.txt" not inlined: unsupported image type`
+	if got := strings.Join(resp.Warnings, "\n"); got != want {
+		t.Errorf("unexpected warnings:\n%s", got)
+	}
+
+	// The sanitizer keeps raster data URIs; SVG ones are not offered to it
+	resp = get("/files/safe/guide/intro.md?inline_images=1")
+	if !strings.Contains(resp.HTML, `src="data:image/png;base64,iVBORyBmYWtl"`) || strings.Contains(resp.HTML, "svg+xml") {
+		t.Errorf("unexpected sanitized HTML %s", resp.HTML)
+	}
+}
+
+func TestGetFileSections(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n\nText.\n\n## Setup\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/files/*path", NewFileHandler(cfg).GetFile)
+
+	// Both variants are cached, each under its own key
+	for _, sections := range []bool{false, true, false, true} {
+		w := httptest.NewRecorder()
+		target := "/files/docs/guide.md?sections=" + strconv.FormatBool(sections)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp FileResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(resp.HTML, `<section data-anchor="setup">`); got != sections {
+			t.Errorf("sections=%v: unexpected HTML %s", sections, resp.HTML)
+		}
+	}
+}
+
+func TestInlineImagesBudget(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("x", maxInlineImages/2+1)
+	writeDoc(t, filepath.Join(dir, "a.png"), big)
+	writeDoc(t, filepath.Join(dir, "b.png"), big)
+	inline := imageInliner(mfs.NewLocalFS(dir), "doc.md", true)
+	if uri, err := inline("a.png"); err != nil || !strings.HasPrefix(uri, "data:image/png;base64,") {
+		t.Fatalf("expected the first image inlined, got %v", err)
+	}
+	if _, err := inline("b.png"); err == nil {
+		t.Error("expected the second image to exceed the budget")
+	}
+}
+
+func TestGetRawJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/raw/*path", NewFileHandler(cfg).GetRaw)
+
+	tests := []struct {
+		name, target, accept string
+		wantJSON             bool
+	}{
+		{"default", "/raw/docs/guide.md", "", false},
+		{"browser", "/raw/docs/guide.md", "text/html,*/*;q=0.8", false},
+		{"accept json", "/raw/docs/guide.md", "application/json", true},
+		{"meta param", "/raw/docs/guide.md?meta=1", "", true},
+		{"meta off", "/raw/docs/guide.md?meta=0", "application/json", false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d (%s)", tt.name, w.Code, w.Body.String())
+		}
+		if !tt.wantJSON {
+			if w.Body.String() != "# Guide\n" {
+				t.Errorf("%s: expected the bare source, got %q", tt.name, w.Body.String())
+			}
+			continue
+		}
+		var resp RawResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.Path != "docs/guide.md" || resp.Content != "# Guide\n" || resp.Size != 8 || resp.ModTime.IsZero() {
+			t.Errorf("%s: unexpected response %+v", tt.name, resp)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/raw/docs?meta=1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a directory to be rejected, got %d", w.Code)
+	}
+}
+
+func TestGetPlain(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "---\ntitle: Guide\n---\n# Guide\n\nRead *this*.\n\n```sh\nmake\n```\n")
+	writeDoc(t, filepath.Join(dir, "notes.txt"), "text\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/plain/*path", NewFileHandler(cfg).GetPlain)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/plain/docs/guide.md", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "Guide\n\nRead this.\n\nmake\n" ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") || w.Header().Get("ETag") == "" {
+		t.Errorf("unexpected response %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+	for path, want := range map[string]int{
+		"/plain/docs/missing.md": http.StatusNotFound,
+		"/plain/docs/notes.txt":  http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestContentAddressedURLs(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	gin.SetMode(gin.TestMode)
+	h := NewFileHandler(cfg)
+	r := gin.New()
+	r.GET("/api/files/*path", h.GetFile)
+	r.GET("/api/raw/*path", h.GetRaw)
+	current := contentHash([]byte("# Guide\n"))
+	stale := strings.Repeat("0", contentHashLen)
+
+	for _, endpoint := range []string{"/api/files/", "/api/raw/"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpoint+current+"/docs/guide.md", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != immutableCacheControl ||
+			w.Header().Get("ETag") != `"`+current+`"` {
+			t.Errorf("%s: expected an immutable response, got %d %v", endpoint, w.Code, w.Header())
+		}
+
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpoint+stale+"/docs/guide.md?sections=1", nil))
+		if want := endpoint + current + "/docs/guide.md?sections=1"; w.Code != http.StatusFound ||
+			w.Header().Get("Location") != want || w.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s: expected a redirect to %s, got %d %v", endpoint, want, w.Code, w.Header())
+		}
+
+		// Plain paths get the cache.html and cache.raw defaults: rendered documents revalidate,
+		// raw files carry no header
+		want := map[string]string{"/api/files/": "no-cache", "/api/raw/": ""}[endpoint]
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, endpoint+"docs/guide.md", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != want {
+			t.Errorf("%s: unexpected plain response %d %v", endpoint, w.Code, w.Header())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/files/"+current+"/docs/missing.md", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing file, got %d", w.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/fuzzy"
+	"github.com/gin-gonic/gin"
+)
+
+// Result limits for the quick-open endpoint
+const (
+	defaultFindLimit = 20
+	maxFindLimit     = 100
+)
+
+// FindResult is a single fuzzy filename match
+type FindResult struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Title     string `json:"title,omitempty"`
+	Score     int    `json:"score"`
+	Positions []int  `json:"positions"`
+}
+
+// titleEntry is a cached document title keyed by the file's mod time
+type titleEntry struct {
+	modTime time.Time
+	title   string
+}
+
+// titleCache remembers sniffed document titles so quick-open never re-reads unchanged files.
+// It is cleared whenever the trees are invalidated, so it never outgrows the visible files.
+type titleCache struct {
+	mu      sync.RWMutex
+	entries map[string]titleEntry
+}
+
+func newTitleCache() *titleCache {
+	return &titleCache{entries: make(map[string]titleEntry)}
+}
+
+// clear drops every remembered title
+func (tc *titleCache) clear() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.entries = make(map[string]titleEntry)
+}
+
+// get returns the title for the file node, reading it only when missing or modified
+func (tc *titleCache) get(fs mfs.FileSystem, relPath string, node *TreeNode) string {
+	var modTime time.Time
+	if node.ModTime != nil {
+		modTime = node.ModTime.Time
+	}
+
+	tc.mu.RLock()
+	entry, ok := tc.entries[node.Path]
+	tc.mu.RUnlock()
+	if ok && entry.modTime.Equal(modTime) {
+		return entry.title
+	}
+
+	content, err := fs.ReadFile(relPath)
+	if err != nil {
+		return ""
+	}
+	title := sniffTitle(content)
+
+	tc.mu.Lock()
+	tc.entries[node.Path] = titleEntry{modTime: modTime, title: title}
+	tc.mu.Unlock()
+	return title
+}
+
+// peek returns the remembered title of the file node when it is still current, without reading
+// the file
+func (tc *titleCache) peek(node *TreeNode) string {
+	var modTime time.Time
+	if node.ModTime != nil {
+		modTime = node.ModTime.Time
+	}
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	if entry, ok := tc.entries[node.Path]; ok && entry.modTime.Equal(modTime) {
+		return entry.title
+	}
+	return ""
+}
+
+// Find fuzzy-matches the query against every visible file path across folders
+func (h *TreeHandler) Find(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		writeError(c, CodeInvalidRequest, "q is required")
+		return
+	}
+	limit := defaultFindLimit
+	if n, err := strconv.Atoi(c.Query("limit")); err == nil && n > 0 {
+		limit = n
+	}
+	if limit > maxFindLimit {
+		limit = maxFindLimit
+	}
+
+	type candidate struct {
+		result FindResult
+		folder config.Folder
+		node   *TreeNode
+	}
+	var matches []candidate
+
+	ctx := c.Request.Context()
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		tree, err := h.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		for _, file := range collectFiles(tree, nil) {
+			score, positions, ok := fuzzy.Match(query, file.Path)
+			if !ok {
+				continue
+			}
+			matches = append(matches, candidate{
+				result: FindResult{
+					Path:      file.Path,
+					Name:      file.Name,
+					Score:     score,
+					Positions: positions,
+				},
+				folder: folder,
+				node:   file,
+			})
+		}
+	}
+
+	if requestDone(c) {
+		return
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].result.Score != matches[j].result.Score {
+			return matches[i].result.Score > matches[j].result.Score
+		}
+		return matches[i].result.Path < matches[j].result.Path
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	// Titles are only looked up for the results actually returned
+	results := make([]FindResult, len(matches))
+	for i, m := range matches {
+		relPath := strings.TrimPrefix(m.node.Path, m.folder.Alias+"/")
+		m.result.Title = h.titles.get(fsForFolder(ctx, m.folder), relPath, m.node)
+		results[i] = m.result
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"query":   query,
+		"results": results,
+	})
+}
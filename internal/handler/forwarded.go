@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gin context keys holding what ForwardedMiddleware resolved
+const (
+	clientIPKey = "clientIP"
+	schemeKey   = "scheme"
+	hostKey     = "host"
+)
+
+// ForwardedMiddleware resolves the client's IP, the scheme and the host the client used. When the
+// TCP peer is one of trusted (see config.TrustedProxyNets), X-Forwarded-For, X-Forwarded-Proto and
+// X-Forwarded-Host are honoured; from any other peer they are ignored. The client IP comes from
+// gin's ClientIP, so the engine must be given the same list with SetTrustedProxies.
+func ForwardedMiddleware(trusted []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, host := directScheme(c), c.Request.Host
+		if isTrustedPeer(c.RemoteIP(), trusted) {
+			if proto := firstForwarded(c.GetHeader("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+				scheme = proto
+			}
+			if fwdHost := firstForwarded(c.GetHeader("X-Forwarded-Host")); validForwardedHost(fwdHost) {
+				host = fwdHost
+			}
+		}
+		c.Set(clientIPKey, c.ClientIP())
+		c.Set(schemeKey, scheme)
+		c.Set(hostKey, host)
+		c.Next()
+	}
+}
+
+// ClientIP returns the effective client IP: the forwarded one behind a trusted proxy, otherwise the TCP peer
+func ClientIP(c *gin.Context) string {
+	if ip := c.GetString(clientIPKey); ip != "" {
+		return ip
+	}
+	return c.RemoteIP()
+}
+
+// RequestScheme returns "https" or "http" as seen by the client
+func RequestScheme(c *gin.Context) string {
+	if scheme := c.GetString(schemeKey); scheme != "" {
+		return scheme
+	}
+	return directScheme(c)
+}
+
+// RequestHost returns the host (and port) the client addressed
+func RequestHost(c *gin.Context) string {
+	if host := c.GetString(hostKey); host != "" {
+		return host
+	}
+	return c.Request.Host
+}
+
+// BaseURL returns the scheme and host the client used, for building absolute URLs
+func BaseURL(c *gin.Context) string {
+	return RequestScheme(c) + "://" + RequestHost(c)
+}
+
+func directScheme(c *gin.Context) string {
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func isTrustedPeer(remoteIP string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstForwarded returns the first entry of a comma-separated forwarding header, the one set by
+// the proxy closest to the client
+func firstForwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.ToLower(strings.TrimSpace(first))
+}
+
+// validForwardedHost accepts a bare host[:port], never anything that would change a URL's path or userinfo
+func validForwardedHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, "/\\@?# \t")
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newForwardedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.RemoteIPHeaders = []string{"X-Forwarded-For"}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	var trusted []*net.IPNet
+	for _, p := range trustedProxies {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trusted = append(trusted, n)
+	}
+	r.Use(ForwardedMiddleware(trusted))
+	r.GET("/whoami", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ip": ClientIP(c), "base": BaseURL(c)})
+	})
+	return r
+}
+
+func whoami(t *testing.T, r http.Handler, remoteAddr string, headers map[string]string) map[string]string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://markhub.internal:8080/whoami", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var got map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestForwardedMiddleware(t *testing.T) {
+	r := newForwardedRouter(t, []string{"10.0.0.0/8"})
+	forwarded := map[string]string{
+		"X-Forwarded-For":   "203.0.113.7",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "docs.example.com",
+	}
+
+	tests := []struct {
+		name     string
+		remote   string
+		headers  map[string]string
+		wantIP   string
+		wantBase string
+	}{
+		{"direct", "192.0.2.10:5000", nil, "192.0.2.10", "http://markhub.internal:8080"},
+		{"untrusted peer", "192.0.2.10:5000", forwarded, "192.0.2.10", "http://markhub.internal:8080"},
+		{"trusted proxy", "10.1.2.3:5000", forwarded, "203.0.113.7", "https://docs.example.com"},
+		{"spoofed hop behind trusted proxy", "10.1.2.3:5000", map[string]string{
+			"X-Forwarded-For": "127.0.0.1, 203.0.113.7",
+		}, "203.0.113.7", "http://markhub.internal:8080"},
+		{"chain of trusted proxies", "10.1.2.3:5000", map[string]string{
+			"X-Forwarded-For":   "203.0.113.7, 10.9.9.9",
+			"X-Forwarded-Proto": "https, http",
+		}, "203.0.113.7", "https://markhub.internal:8080"},
+		{"invalid forwarded values", "10.1.2.3:5000", map[string]string{
+			"X-Forwarded-Proto": "javascript",
+			"X-Forwarded-Host":  "evil.example/path",
+		}, "10.1.2.3", "http://markhub.internal:8080"},
+	}
+	for _, tt := range tests {
+		got := whoami(t, r, tt.remote, tt.headers)
+		if got["ip"] != tt.wantIP || got["base"] != tt.wantBase {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.name, tt.wantIP, tt.wantBase, got["ip"], got["base"])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// FrontMatterResponse is the document after a front matter edit, with the front matter decoded
+type FrontMatterResponse struct {
+	RawResponse
+	FrontMatter map[string]any `json:"frontMatter"`
+}
+
+// PatchFrontMatter sets the top-level front matter keys of a markdown file from a JSON object,
+// removing those set to null, without touching the rest of the document. A file without front
+// matter gets a block. If-Match and ?baseModTime= are checked like PutRaw's.
+func (h *FileHandler) PatchFrontMatter(c *gin.Context) {
+	filePath, baseModTime, ok := h.saveTarget(c)
+	if !ok {
+		return
+	}
+	var changes map[string]any
+	if err := c.ShouldBindJSON(&changes); err != nil || len(changes) == 0 {
+		writeError(c, CodeInvalidRequest, "body must be a JSON object of front matter keys to set, null to remove")
+		return
+	}
+
+	var frontMatter map[string]any
+	edit := func(current []byte, _ config.Folder) ([]byte, bool) {
+		updated, values, err := markdown.UpdateFrontMatter(current, changes)
+		if err != nil {
+			if errors.Is(err, markdown.ErrInvalidFrontMatter) {
+				writeError(c, CodeInvalidFrontMatter, err.Error())
+			} else {
+				writeError(c, CodeInvalidRequest, err.Error())
+			}
+			return nil, false
+		}
+		frontMatter = values
+		return updated, true
+	}
+	content, modTime, ok := h.replaceFile(c, filePath, false, c.GetHeader("If-Match"), baseModTime, edit)
+	if !ok {
+		return
+	}
+	resp := FrontMatterResponse{RawResponse: rawResponse(filePath, content, modTime), FrontMatter: frontMatter}
+	resp.LockConflict = h.heldByOther(c, filePath)
+	c.Header("ETag", ETag(content))
+	writeJSON(c, http.StatusOK, resp)
+}
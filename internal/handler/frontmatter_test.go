@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// frontMatterRoutes registers the route of the front matter tests
+func frontMatterRoutes(r *gin.Engine, h *FileHandler) {
+	r.PATCH("/frontmatter/*path", h.PatchFrontMatter)
+}
+
+func patchFrontMatter(r http.Handler, target, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, target, strings.NewReader(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPatchFrontMatter(t *testing.T) {
+	original := "---\ntitle: Guide\ndraft: true\n---\n# Guide\n"
+	r, _, dir := newFileRouter(t, map[string]string{"guide.md": original}, frontMatterRoutes)
+	path := filepath.Join(dir, "guide.md")
+
+	w := patchFrontMatter(r, "/frontmatter/docs/guide.md", ETag([]byte(original)), `{"draft":null,"tags":["go"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+	want := "---\ntitle: Guide\ntags:\n  - go\n---\n# Guide\n"
+	if got := readDoc(t, path); got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+	var resp FrontMatterResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ETag != ETag([]byte(want)) || w.Header().Get("ETag") != resp.ETag {
+		t.Errorf("etag = %q (header %q), want the new content's", resp.ETag, w.Header().Get("ETag"))
+	}
+	if resp.FrontMatter["title"] != "Guide" || len(resp.FrontMatter) != 2 {
+		t.Errorf("frontMatter = %v", resp.FrontMatter)
+	}
+
+	// The original ETag is stale now
+	w = patchFrontMatter(r, "/frontmatter/docs/guide.md", ETag([]byte(original)), `{"title":"Other"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("stale If-Match: %d %s", w.Code, w.Body.String())
+	}
+	if got := readDoc(t, path); got != want {
+		t.Errorf("file after a conflict = %q", got)
+	}
+}
+
+func TestPatchFrontMatterRejects(t *testing.T) {
+	r, _, _ := newFileRouter(t, map[string]string{"guide.md": "---\n- not\n- a mapping\n---\n"}, frontMatterRoutes)
+	tests := []struct {
+		name, target, body string
+		want               int
+	}{
+		{"empty object", "/frontmatter/docs/guide.md", `{}`, http.StatusBadRequest},
+		{"not an object", "/frontmatter/docs/guide.md", `["title"]`, http.StatusBadRequest},
+		{"not markdown", "/frontmatter/docs/guide.txt", `{"title":"x"}`, http.StatusBadRequest},
+		{"missing file", "/frontmatter/docs/missing.md", `{"title":"x"}`, http.StatusNotFound},
+		{"invalid front matter", "/frontmatter/docs/guide.md", `{"title":"x"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := patchFrontMatter(r, tt.target, "", tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of GET /graph
+const (
+	maxGraphNodes     = 2000
+	maxGraphEdges     = 10000
+	defaultGraphDepth = 2
+	maxGraphDepth     = 5
+)
+
+// linkEntry is a document's outbound links and wikilinks, keyed by the file's mod time and size
+type linkEntry struct {
+	modTime time.Time
+	size    int64
+	links   []markdown.Link
+	wiki    []markdown.WikiLink
+}
+
+// linkCache remembers the outbound links of documents by alias-prefixed path. Like tagCache it
+// survives tree invalidations: entries are checked against the file's mod time and size, and
+// watcher events update them one file at a time.
+type linkCache struct {
+	mu      sync.RWMutex
+	entries map[string]linkEntry
+}
+
+func newLinkCache() *linkCache {
+	return &linkCache{entries: make(map[string]linkEntry)}
+}
+
+// entry returns the links of the file node, reading it only when missing or modified
+func (lc *linkCache) entry(fs mfs.FileSystem, relPath string, node *TreeNode) linkEntry {
+	var modTime time.Time
+	if node.ModTime != nil {
+		modTime = node.ModTime.Time
+	}
+
+	lc.mu.RLock()
+	entry, ok := lc.entries[node.Path]
+	lc.mu.RUnlock()
+	if ok && entry.modTime.Equal(modTime) && entry.size == node.Size {
+		return entry
+	}
+	return lc.load(fs, relPath, node.Path, modTime, node.Size)
+}
+
+// load reads the links of the file at relPath and stores them under path
+func (lc *linkCache) load(fs mfs.FileSystem, relPath, path string, modTime time.Time, size int64) linkEntry {
+	content, err := fs.ReadFile(relPath)
+	if err != nil {
+		return linkEntry{}
+	}
+	entry := linkEntry{modTime: modTime, size: size}
+	entry.links, entry.wiki = markdown.Links(content)
+	lc.mu.Lock()
+	lc.entries[path] = entry
+	lc.mu.Unlock()
+	return entry
+}
+
+// remove drops the entry of path and of every file below it
+func (lc *linkCache) remove(path string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	delete(lc.entries, path)
+	prefix := path + "/"
+	for p := range lc.entries {
+		if strings.HasPrefix(p, prefix) {
+			delete(lc.entries, p)
+		}
+	}
+}
+
+// GraphNode is a document of the link graph, with the links it has that are not edges: to other
+// sites, and to files or notes that do not exist
+type GraphNode struct {
+	Path     string   `json:"path"`
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	External int      `json:"external"`
+	Broken   int      `json:"broken"`
+}
+
+// GraphEdge is a link, or several, from one document to another
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// GraphResponse is the response of GET /graph. Truncated is set when nodes or edges were left out
+// to stay within the caps.
+type GraphResponse struct {
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+	Truncated bool        `json:"truncated"`
+}
+
+// GetGraph returns the documents the tree shows, across all folders or the one named by ?folder=
+// or ?folderId=, and the relative links and [[wikilinks]] between them (see wikiTarget). With
+// ?center=<path>, only the documents within ?depth=2 links of it, in either direction, are
+// returned. At most 2000 nodes and 10000 edges are returned.
+func (h *TreeHandler) GetGraph(c *gin.Context) {
+	center := strings.Trim(c.Query("center"), "/")
+	depth := 0
+	if center != "" {
+		depth = defaultGraphDepth
+	}
+	if v := c.Query("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxGraphDepth || center == "" {
+			writeError(c, CodeInvalidRequest, "depth must be between 1 and 5, with center")
+			return
+		}
+		depth = n
+	}
+	folders, ok := h.tagFolders(c)
+	if !ok {
+		return
+	}
+
+	g := h.buildGraph(c.Request.Context(), folders)
+	if requestDone(c) {
+		return
+	}
+	order := make([]int, len(g.nodes))
+	for i := range order {
+		order[i] = i
+	}
+	if center != "" {
+		start, found := g.index[center]
+		if !found {
+			writeError(c, CodeNotFound, "center document not found")
+			return
+		}
+		order = graphNeighborhood(start, len(g.nodes), g.edges, g.index, depth)
+	}
+	resp := GraphResponse{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	if len(order) > maxGraphNodes {
+		order, resp.Truncated = order[:maxGraphNodes], true
+	}
+	kept := map[string]bool{}
+	for _, i := range order {
+		resp.Nodes = append(resp.Nodes, g.nodes[i])
+		kept[g.nodes[i].Path] = true
+	}
+	for _, edge := range g.edges {
+		if !kept[edge.Source] || !kept[edge.Target] {
+			continue
+		}
+		if len(resp.Edges) == maxGraphEdges {
+			resp.Truncated = true
+			break
+		}
+		resp.Edges = append(resp.Edges, edge)
+	}
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// linkGraph is the link graph of some folders: nodes and files in tree order, and edges sorted by
+// source, then target, in the same order
+type linkGraph struct {
+	nodes []GraphNode
+	files []*TreeNode
+	edges []GraphEdge
+	index map[string]int // node of each document path
+}
+
+// buildGraph builds the link graph of the documents the trees of folders show, from the cached
+// link lists of their files (see GetGraph)
+func (h *TreeHandler) buildGraph(ctx context.Context, folders []config.Folder) *linkGraph {
+	g := &linkGraph{index: map[string]int{}}
+	for _, folder := range folders {
+		tree, err := h.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		fs := fsForFolder(ctx, folder)
+		files := collectFiles(tree, nil)
+		// Wikilink targets, lowercased: folder-relative paths and file names, without extension
+		byPath, byName := map[string]string{}, map[string][]string{}
+		for _, file := range files {
+			relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+			tags := h.tags.get(fs, relPath, file)
+			if tags == nil {
+				tags = []string{}
+			}
+			g.index[file.Path] = len(g.nodes)
+			g.nodes = append(g.nodes, GraphNode{Path: file.Path, Title: h.titles.get(fs, relPath, file), Tags: tags})
+			g.files = append(g.files, file)
+			stem := strings.ToLower(strings.TrimSuffix(relPath, path.Ext(relPath)))
+			byPath[stem] = file.Path
+			byName[path.Base(stem)] = append(byName[path.Base(stem)], file.Path)
+		}
+		for _, file := range files {
+			relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+			node := &g.nodes[g.index[file.Path]]
+			entry := h.links.entry(fs, relPath, file)
+			targets := map[string]bool{}
+			for _, link := range entry.links {
+				if link.Image {
+					continue
+				}
+				dest, relative := markdown.RelativeTarget(link.Dest)
+				if !relative {
+					if u, err := url.Parse(link.Dest); err == nil && (u.Scheme != "" || u.Host != "") {
+						node.External++
+					}
+					continue
+				}
+				target, inside := linkTarget(relPath, dest)
+				if _, isNode := g.index[folder.Alias+"/"+target]; inside && isNode {
+					targets[folder.Alias+"/"+target] = true
+				} else if _, err := fs.Stat(target); !inside || err != nil {
+					node.Broken++
+				}
+			}
+			for _, link := range entry.wiki {
+				if target := h.wikiTarget(link.Target, file.Path, byPath, byName); target != "" {
+					targets[target] = true
+				} else {
+					node.Broken++
+				}
+			}
+			delete(targets, file.Path)
+			for target := range targets {
+				g.edges = append(g.edges, GraphEdge{Source: file.Path, Target: target})
+			}
+		}
+	}
+	sort.Slice(g.edges, func(i, j int) bool {
+		a, b := g.edges[i], g.edges[j]
+		if a.Source != b.Source {
+			return g.index[a.Source] < g.index[b.Source]
+		}
+		return g.index[a.Target] < g.index[b.Target]
+	})
+	return g
+}
+
+// wikiTarget resolves a wikilink target of the document at from to a document path: a target with a
+// slash by its path in the folder, others by file name, the one in from's directory first, then the
+// first in tree order. A markdown extension on the target is optional. It returns "" when no
+// document matches.
+func (h *TreeHandler) wikiTarget(target, from string, byPath map[string]string, byName map[string][]string) string {
+	stem := strings.ToLower(strings.Trim(target, "/"))
+	if ext := path.Ext(stem); ext != "" && h.cfg.IsMarkdownFile(stem) {
+		stem = strings.TrimSuffix(stem, ext)
+	}
+	if strings.Contains(stem, "/") {
+		return byPath[stem]
+	}
+	candidates := byName[path.Base(stem)]
+	for _, p := range candidates {
+		if path.Dir(p) == path.Dir(from) {
+			return p
+		}
+	}
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+	return ""
+}
+
+// graphNeighborhood returns the indexes of the nodes within depth edges of start, in either
+// direction, nearest first
+func graphNeighborhood(start, count int, edges []GraphEdge, index map[string]int, depth int) []int {
+	adjacent := make([][]int, count)
+	for _, e := range edges {
+		s, t := index[e.Source], index[e.Target]
+		adjacent[s] = append(adjacent[s], t)
+		adjacent[t] = append(adjacent[t], s)
+	}
+	distance := map[int]int{start: 0}
+	queue := []int{start}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if distance[n] == depth {
+			continue
+		}
+		for _, next := range adjacent[n] {
+			if _, seen := distance[next]; !seen {
+				distance[next] = distance[n] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+	order := make([]int, 0, len(distance))
+	for n := range distance {
+		order = append(order, n)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if distance[order[i]] != distance[order[j]] {
+			return distance[order[i]] < distance[order[j]]
+		}
+		return order[i] < order[j]
+	})
+	return order
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetGraph(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "index.md"), "---\ntags: [Home]\n---\n# Index\n\n"+
+		"[Setup](guide/setup.md), [again](guide/setup.md#run), [[Notes]], [site](https://example.com), "+
+		"[gone](gone.md), [[Missing]] and [self](index.md).\n")
+	writeDoc(t, filepath.Join(dir, "guide", "setup.md"), "# Setup\n\n[[notes]] [up](../index.md) [pdf](manual.pdf)\n")
+	writeDoc(t, filepath.Join(dir, "guide", "manual.pdf"), "%PDF")
+	writeDoc(t, filepath.Join(dir, "guide", "notes.md"), "# Guide notes\n\n[[far]]\n")
+	writeDoc(t, filepath.Join(dir, "notes.md"), "# Notes\n")
+	writeDoc(t, filepath.Join(dir, "far.md"), "# Far\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	h := NewTreeHandler(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/graph", h.GetGraph)
+	graph := func(target string) (int, GraphResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp GraphResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp
+	}
+	paths := func(resp GraphResponse) []string {
+		var out []string
+		for _, n := range resp.Nodes {
+			out = append(out, n.Path)
+		}
+		return out
+	}
+
+	code, resp := graph("/graph?folderId=docs")
+	if code != http.StatusOK || resp.Truncated || len(resp.Nodes) != 5 {
+		t.Fatalf("unexpected response %d %+v", code, resp)
+	}
+	byPath := map[string]GraphNode{}
+	for _, n := range resp.Nodes {
+		byPath[n.Path] = n
+	}
+	if index := byPath["docs/index.md"]; index.Title != "Index" || !slices.Equal(index.Tags, []string{"home"}) ||
+		index.External != 1 || index.Broken != 2 {
+		t.Errorf("unexpected index node %+v", index)
+	}
+	if setup := byPath["docs/guide/setup.md"]; setup.Broken != 0 || setup.Tags == nil {
+		t.Errorf("unexpected setup node %+v", setup)
+	}
+	// Wikilinks prefer a note in the linking document's directory
+	want := []GraphEdge{
+		{"docs/index.md", "docs/guide/setup.md"}, {"docs/index.md", "docs/notes.md"},
+		{"docs/guide/setup.md", "docs/index.md"}, {"docs/guide/setup.md", "docs/guide/notes.md"},
+		{"docs/guide/notes.md", "docs/far.md"},
+	}
+	for _, edge := range want {
+		if !slices.Contains(resp.Edges, edge) {
+			t.Errorf("missing edge %+v in %+v", edge, resp.Edges)
+		}
+	}
+	if len(resp.Edges) != len(want) {
+		t.Errorf("expected %d edges, got %+v", len(want), resp.Edges)
+	}
+
+	_, resp = graph("/graph?center=docs/notes.md&depth=1")
+	if got := paths(resp); !slices.Equal(got, []string{"docs/notes.md", "docs/index.md"}) ||
+		len(resp.Edges) != 1 {
+		t.Errorf("unexpected neighborhood %v %+v", got, resp.Edges)
+	}
+	if _, resp = graph("/graph?center=docs/notes.md"); len(resp.Nodes) != 3 {
+		t.Errorf("expected the documents within two links, got %v", paths(resp))
+	}
+
+	// A watcher event updates the links of the changed file
+	notes := filepath.Join(dir, "notes.md")
+	writeDoc(t, notes, "# Notes\n\n[[far]]\n")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(notes, future, future); err != nil {
+		t.Fatal(err)
+	}
+	h.OnFileChange(watcher.Event{Path: notes, Type: watcher.EventWrite})
+	if entry, ok := h.links.entries["docs/notes.md"]; !ok || len(entry.wiki) != 1 {
+		t.Errorf("expected the watcher event to reload the links, got %+v", entry)
+	}
+	if _, resp = graph("/graph?center=docs/notes.md&depth=1"); len(resp.Nodes) != 3 {
+		t.Errorf("expected the new link in the graph, got %v", paths(resp))
+	}
+
+	for target, code := range map[string]int{
+		"/graph?folderId=nope":                http.StatusNotFound,
+		"/graph?center=docs/missing.md":       http.StatusNotFound,
+		"/graph?depth=2":                      http.StatusBadRequest,
+		"/graph?center=docs/index.md&depth=9": http.StatusBadRequest,
+	} {
+		if got, _ := graph(target); got != code {
+			t.Errorf("%s: expected %d, got %d", target, code, got)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// LintReport lists the documents of one or more folders that have lint issues, in tree order
+type LintReport struct {
+	// Checked counts the documents checked, with or without issues
+	Checked   int            `json:"checked"`
+	Documents []LintResponse `json:"documents"`
+}
+
+// GetHeadingReport serves GET /lint-report/headings: the heading issues (markdown.HeadingLintRules, less
+// lint.disabled_rules) of every document the tree shows, across all folders or the one named by
+// ?folder= or ?folderId=. Documents without issues are only counted.
+func (h *ExportHandler) GetHeadingReport(c *gin.Context) {
+	folders, ok := h.tree.tagFolders(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	report := LintReport{Documents: []LintResponse{}}
+	for _, folder := range folders {
+		tree, err := h.tree.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		fs := fsForFolder(ctx, folder)
+		parser := h.files.parserFor(folder)
+		for _, file := range collectFiles(tree, nil) {
+			if ctx.Err() != nil {
+				break
+			}
+			relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+			content, err := fs.ReadFile(relPath)
+			if err != nil {
+				continue
+			}
+			report.Checked++
+			issues := parser.Lint(content, h.files.lintOptions(fs, relPath, markdown.HeadingLintRules))
+			if len(issues) > 0 {
+				report.Documents = append(report.Documents, LintResponse{Path: file.Path, Issues: issues})
+			}
+		}
+	}
+	if requestDone(c) {
+		return
+	}
+	writeJSON(c, http.StatusOK, report)
+}
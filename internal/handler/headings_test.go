@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLintHeadings(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide \n\n## Setup\n\n## Setup\n\n[Run](#run) [gone](gone.md)\n")
+	writeDoc(t, filepath.Join(dir, "clean.md"), "# Clean\n\n## Run\n\n[Run](#run)\n")
+	writeDoc(t, filepath.Join(dir, "drafts", "wip.md"), "# A\n\n# B\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs", Exclude: []string{"drafts"}}}
+	tree := NewTreeHandler(cfg)
+	files := NewFileHandler(cfg)
+	export := NewExportHandler(cfg, tree, files)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/lint-report/headings", export.GetHeadingReport)
+	r.GET("/lint-headings/*path", files.GetLintHeadings)
+	get := func(target string, v any) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code
+	}
+	rules := func(issues []markdown.LintIssue) []string {
+		var out []string
+		for _, issue := range issues {
+			out = append(out, issue.Rule)
+		}
+		return out
+	}
+
+	// Trailing whitespace and the broken file link are not heading issues
+	var doc LintResponse
+	if code := get("/lint-headings/docs/guide.md", &doc); code != http.StatusOK || doc.Path != "docs/guide.md" {
+		t.Fatalf("unexpected response %d %+v", code, doc)
+	}
+	if got := rules(doc.Issues); !slices.Equal(got, []string{markdown.LintDuplicateAnchor, markdown.LintBrokenAnchor}) {
+		t.Errorf("unexpected issues %+v", doc.Issues)
+	}
+	if code := get("/lint-headings/docs/missing.md", &doc); code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing document, got %d", code)
+	}
+
+	var report LintReport
+	if code := get("/lint-report/headings?folderId=docs", &report); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if report.Checked != 2 || len(report.Documents) != 1 || report.Documents[0].Path != "docs/guide.md" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	cfg.Lint.DisabledRules = []string{markdown.LintBrokenAnchor, markdown.LintDuplicateAnchor}
+	report = LintReport{}
+	if get("/lint-report/headings", &report); report.Checked != 2 || len(report.Documents) != 0 {
+		t.Errorf("expected the disabled rules skipped, got %+v", report)
+	}
+	if code := get("/lint-report/headings?folder=nope", &report); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown folder, got %d", code)
+	}
+}
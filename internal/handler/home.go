@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// maxHomeDescription caps the length of a description taken from a README, in runes
+const maxHomeDescription = 300
+
+// Where a HomeFolder's description comes from
+const (
+	DescriptionSourceConfig = "config"
+	DescriptionSourceReadme = "readme"
+)
+
+// HomeFolder summarizes one folder for the home page
+type HomeFolder struct {
+	FolderID string `json:"folderId"`
+	Alias    string `json:"alias"`
+	GitRef   string `json:"gitRef,omitempty"`
+	// Description is the folder's description setting, or else the first paragraph of its root README
+	Description       string `json:"description,omitempty"`
+	DescriptionSource string `json:"descriptionSource,omitempty"`
+	// Readme is the alias-prefixed path of the folder's root README
+	Readme string `json:"readme,omitempty"`
+	// Files counts the documents the tree shows
+	Files int `json:"files"`
+	// UpdatedAt is the latest modification time of those documents
+	UpdatedAt *timestamp.Time `json:"updatedAt,omitempty"`
+	// Error is set, and the counts left empty, when the folder cannot be read
+	Error string `json:"error,omitempty"`
+}
+
+// Home is the landing page payload: the site title and a summary of every folder
+type Home struct {
+	Title   string       `json:"title"`
+	Folders []HomeFolder `json:"folders"`
+}
+
+// GetHome returns a summary of every folder for the home page, in configuration order
+func (h *TreeHandler) GetHome(c *gin.Context) {
+	ctx := c.Request.Context()
+	home := Home{Title: siteTitle(h.cfg), Folders: []HomeFolder{}}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		home.Folders = append(home.Folders, h.homeFolder(ctx, folder))
+		if requestDone(c) {
+			return
+		}
+	}
+	writeJSON(c, http.StatusOK, home)
+}
+
+// GetHomeDoc returns the rendered home_document, a page written to introduce the folders, or
+// 204 No Content when none is configured and clients show the folder list instead
+func (h *FileHandler) GetHomeDoc(c *gin.Context) {
+	docPath := h.cfg.HomeDocument
+	if docPath == "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if strings.Contains(docPath, "..") {
+		writeError(c, CodePathTraversal, "invalid home_document path")
+		return
+	}
+	resp, err := h.RenderWithOptions(c.Request.Context(), docPath, RenderOptions{})
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, "home_document: "+msg)
+		return
+	}
+	c.Header("ETag", resp.ETag)
+	writeJSON(c, http.StatusOK, resp)
+}
+
+func (h *TreeHandler) homeFolder(ctx context.Context, folder config.Folder) HomeFolder {
+	summary := HomeFolder{FolderID: folder.ID, Alias: folder.Alias, GitRef: folder.GitRef}
+	if folder.Description != "" {
+		summary.Description = folder.Description
+		summary.DescriptionSource = DescriptionSourceConfig
+	}
+	tree, err := h.folderTree(ctx, folder)
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	for _, file := range collectFiles(tree, nil) {
+		summary.Files++
+		if file.ModTime != nil && (summary.UpdatedAt == nil || file.ModTime.After(summary.UpdatedAt.Time)) {
+			summary.UpdatedAt = file.ModTime
+		}
+	}
+	readme := rootReadme(tree)
+	if readme == nil {
+		return summary
+	}
+	summary.Readme = readme.Path
+	if summary.Description == "" {
+		content, err := fsForFolder(ctx, folder).ReadFile(strings.TrimPrefix(readme.Path, folder.Alias+"/"))
+		if err == nil {
+			summary.Description = firstParagraph(content)
+		}
+		if summary.Description != "" {
+			summary.DescriptionSource = DescriptionSourceReadme
+		}
+	}
+	return summary
+}
+
+// rootReadme returns the README among the files at the root of a folder tree, matched case-insensitively
+func rootReadme(tree *TreeNode) *TreeNode {
+	for _, child := range tree.Children {
+		name := strings.ToLower(child.Name)
+		if child.Type == "file" && strings.TrimSuffix(name, path.Ext(name)) == "readme" {
+			return child
+		}
+	}
+	return nil
+}
+
+// firstParagraph returns the text of the first paragraph of a markdown document, without a full
+// parse: front matter, headings, HTML lines (such as badges), images and thematic breaks are
+// skipped, and the paragraph's lines are joined with spaces
+func firstParagraph(content []byte) string {
+	_, content, _ = markdown.SplitFrontMatter(content)
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		// An underline turns the lines above into a setext heading; alone, a dash line is a break
+		if line != "" && (strings.Trim(line, "=") == "" || strings.Trim(line, "-") == "") {
+			lines = nil
+			continue
+		}
+		skip := strings.HasPrefix(line, "#") || strings.HasPrefix(line, "<") ||
+			strings.HasPrefix(line, "![") || strings.HasPrefix(line, "[![")
+		if line == "" || skip {
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	paragraph := strings.Join(lines, " ")
+	if runes := []rune(paragraph); len(runes) > maxHomeDescription {
+		paragraph = strings.TrimSpace(string(runes[:maxHomeDescription])) + "…"
+	}
+	return paragraph
+}
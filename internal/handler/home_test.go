@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetHome(t *testing.T) {
+	docs := t.TempDir()
+	writeDoc(t, filepath.Join(docs, "README.md"),
+		"---\ntitle: Docs\n---\n# Docs\n\n[![ci](badge.svg)](ci)\n\nThe product\nhandbook.\n\nMore.\n")
+	writeDoc(t, filepath.Join(docs, "guide", "intro.md"), "# Intro\n")
+	latest := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(docs, "guide", "intro.md"), latest, latest); err != nil {
+		t.Fatal(err)
+	}
+	old := latest.AddDate(-1, 0, 0)
+	if err := os.Chtimes(filepath.Join(docs, "README.md"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	notes := t.TempDir()
+	writeDoc(t, filepath.Join(notes, "readme.markdown"), "Ignored.\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: docs, Alias: "docs"},
+		{ID: "notes", Path: notes, Alias: "notes", Description: "Scratch notes"},
+		{ID: "gone", Path: filepath.Join(notes, "missing"), Alias: "gone"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/home", NewTreeHandler(cfg).GetHome)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/home", nil))
+	var home Home
+	if err := json.Unmarshal(w.Body.Bytes(), &home); err != nil {
+		t.Fatal(err)
+	}
+	if len(home.Folders) != 3 || home.Title == "" {
+		t.Fatalf("unexpected home %s", w.Body.String())
+	}
+
+	d := home.Folders[0]
+	if d.Description != "The product handbook." || d.DescriptionSource != DescriptionSourceReadme ||
+		d.Readme != "docs/README.md" || d.Files != 2 || d.UpdatedAt == nil || !d.UpdatedAt.Equal(latest) {
+		t.Errorf("unexpected docs summary %+v", d)
+	}
+	if n := home.Folders[1]; n.Description != "Scratch notes" || n.DescriptionSource != DescriptionSourceConfig ||
+		n.Readme != "notes/readme.markdown" {
+		t.Errorf("unexpected notes summary %+v", n)
+	}
+	if g := home.Folders[2]; g.Error == "" || g.Files != 0 {
+		t.Errorf("expected an error for the missing folder, got %+v", g)
+	}
+}
+
+func TestGetHomeDoc(t *testing.T) {
+	docs := t.TempDir()
+	writeDoc(t, filepath.Join(docs, "portal.md"), "# Portal\n\nStart with the [guide](guide/intro.md).\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: docs, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/home-doc", NewFileHandler(cfg).GetHomeDoc)
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/home-doc", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expected 204 without a home document, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.HomeDocument = "docs/portal.md"
+	w := get()
+	var resp FileResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected the rendered document, got %d: %s", w.Code, w.Body.String())
+	}
+	if resp.Title != "Portal" || resp.Path != "docs/portal.md" || w.Header().Get("ETag") != resp.ETag {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	cfg.HomeDocument = "docs/missing.md"
+	if w := get(); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing home document, got %d", w.Code)
+	}
+}
+
+func TestFirstParagraph(t *testing.T) {
+	for source, want := range map[string]string{
+		"Title\n=====\n\nBody text.\n":  "Body text.",
+		"# Only a heading\n":            "",
+		"<p align=center>\n\n---\n\nHi": "Hi",
+	} {
+		if got := firstParagraph([]byte(source)); got != want {
+			t.Errorf("firstParagraph(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the PNG chunks dropped by stripImageMetadata: EXIF, text (which holds
+// XMP) and the modification time
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripImageMetadata removes EXIF and XMP metadata from JPEG and PNG images. Other types, and
+// files it cannot follow, are returned unchanged.
+func stripImageMetadata(mimeType string, data []byte) []byte {
+	var out []byte
+	var ok bool
+	switch mimeType {
+	case "image/jpeg":
+		out, ok = stripJPEGMetadata(data)
+	case "image/png":
+		out, ok = stripPNGMetadata(data)
+	}
+	if !ok {
+		return data
+	}
+	return out
+}
+
+// stripJPEGMetadata drops the APP1 segments (EXIF and XMP) before the image data
+func stripJPEGMetadata(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, false
+	}
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return nil, false
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// Fill byte before a marker
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			// Start of scan: entropy-coded data up to the end follows
+			return append(out, data[pos:]...), true
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) || end < pos+4 {
+			return nil, false
+		}
+		if marker != 0xE1 {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return nil, false
+}
+
+// stripPNGMetadata drops the chunks in pngMetadataChunks
+func stripPNGMetadata(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, false
+	}
+	out := append(make([]byte, 0, len(data)), pngSignature...)
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, false
+		}
+		// Length, type, data and CRC
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos+12 {
+			return nil, false
+		}
+		if !pngMetadataChunks[string(data[pos+4:pos+8])] {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return out, true
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultImageProxyMaxSize caps proxied images when render.image_proxy_max_size is unset
+const defaultImageProxyMaxSize = 10 << 20
+
+// maxImageProxyRedirects is how many redirects the proxy follows for one image
+const maxImageProxyRedirects = 5
+
+// proxiedImageTypes are the content types the proxy passes on. SVG is left out: it can carry
+// script, and the proxy serves it from the server's own origin.
+var proxiedImageTypes = map[string]bool{
+	"image/png":                true,
+	"image/jpeg":               true,
+	"image/gif":                true,
+	"image/webp":               true,
+	"image/avif":               true,
+	"image/bmp":                true,
+	"image/x-icon":             true,
+	"image/vnd.microsoft.icon": true,
+}
+
+var (
+	errHostNotAllowed = errors.New("host not allowed")
+	errAddrNotAllowed = errors.New("address not allowed")
+)
+
+// ImageProxyHandler fetches external images on behalf of documents rendered with
+// render.external_images "proxy", so readers' browsers only ever contact this server
+type ImageProxyHandler struct {
+	cfg    *config.Config
+	client *http.Client
+	// allowAddr decides which resolved addresses may be dialled; tests replace it
+	allowAddr func(net.IP) bool
+}
+
+// NewImageProxyHandler creates an image proxy that refuses to connect to loopback, private and
+// link-local addresses
+func NewImageProxyHandler(cfg *config.Config) *ImageProxyHandler {
+	h := &ImageProxyHandler{cfg: cfg, allowAddr: publicAddr}
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		// Checked after name resolution, so a public name pointing at an internal address fails too
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !h.allowAddr(ip) {
+				return errAddrNotAllowed
+			}
+			return nil
+		},
+	}
+	h.client = &http.Client{
+		Transport: &http.Transport{
+			// Never through HTTP_PROXY: the proxy's own checks must see the real destination
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          16,
+		},
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxImageProxyRedirects {
+				return errors.New("too many redirects")
+			}
+			return h.checkURL(req.URL)
+		},
+	}
+	return h
+}
+
+// publicAddr reports whether ip is a publicly routable unicast address
+func publicAddr(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsMulticast() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// Proxy fetches the image at ?url= and serves it. Only http(s) URLs on render.image_hosts (any
+// host when unset) are fetched, and only raster images up to render.image_proxy_max_size.
+func (h *ImageProxyHandler) Proxy(c *gin.Context) {
+	if h.cfg.Render.ExternalImages != config.ExternalImagesProxy {
+		writeError(c, CodeNotFound, "image proxy is disabled")
+		return
+	}
+	target, err := url.Parse(c.Query("url"))
+	if err != nil {
+		writeError(c, CodeInvalidRequest, "invalid url")
+		return
+	}
+	if err := h.checkURL(target); err != nil {
+		writeProxyError(c, err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		writeError(c, CodeInvalidRequest, "invalid url")
+		return
+	}
+	req.Header.Set("Accept", "image/*")
+	resp, err := h.client.Do(req)
+	if requestDone(c) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
+	}
+	if err != nil {
+		writeProxyError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		writeError(c, CodeUpstreamFailed, fmt.Sprintf("upstream returned %s", resp.Status))
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !proxiedImageTypes[mediaType] {
+		writeError(c, CodeUpstreamFailed, "upstream did not return a supported image type")
+		return
+	}
+	maxSize := h.maxSize()
+	if resp.ContentLength > maxSize {
+		writeError(c, CodeTooLarge, fmt.Sprintf("image is larger than %d bytes", maxSize))
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		writeError(c, CodeUpstreamFailed, "failed to read image: "+err.Error())
+		return
+	}
+	if int64(len(data)) > maxSize {
+		writeError(c, CodeTooLarge, fmt.Sprintf("image is larger than %d bytes", maxSize))
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Data(http.StatusOK, mediaType, data)
+}
+
+// checkURL checks that u is an http(s) URL the proxy may fetch
+func (h *ImageProxyHandler) checkURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("only absolute http and https URLs are proxied")
+	}
+	if hosts := h.cfg.Render.ImageHosts; len(hosts) > 0 && !imageHostAllowed(hosts, u.Hostname()) {
+		return errHostNotAllowed
+	}
+	return nil
+}
+
+func (h *ImageProxyHandler) maxSize() int64 {
+	if h.cfg.Render.ImageProxyMaxSize > 0 {
+		return h.cfg.Render.ImageProxyMaxSize
+	}
+	return defaultImageProxyMaxSize
+}
+
+// writeProxyError maps a URL check or fetch error to a response
+func writeProxyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errHostNotAllowed):
+		writeError(c, CodeHostNotAllowed, "image host is not allowed")
+	case errors.Is(err, errAddrNotAllowed):
+		writeError(c, CodeHostNotAllowed, "image host resolves to a private address")
+	case errors.As(err, new(*url.Error)):
+		writeError(c, CodeUpstreamFailed, "failed to fetch image: "+err.Error())
+	default:
+		writeError(c, CodeInvalidRequest, err.Error())
+	}
+}
+
+// imageHostAllowed reports whether host matches one of hosts: a name matches itself, and
+// "*.example.com" matches any subdomain of example.com
+func imageHostAllowed(hosts []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// externalImagePolicy returns the markdown.ParseOptions.ExternalImage applying
+// render.external_images, or nil when external images load as written
+func externalImagePolicy(render config.RenderConfig) func(string) (string, bool) {
+	allowed := func(dest string) bool {
+		u, err := url.Parse(dest)
+		return err == nil && imageHostAllowed(render.ImageHosts, u.Hostname())
+	}
+	switch render.ExternalImages {
+	case config.ExternalImagesBlock:
+		return func(dest string) (string, bool) {
+			return dest, allowed(dest)
+		}
+	case config.ExternalImagesProxy:
+		return func(dest string) (string, bool) {
+			if strings.HasPrefix(dest, "//") {
+				dest = "https:" + dest
+			}
+			if len(render.ImageHosts) > 0 && !allowed(dest) {
+				return "", false
+			}
+			return "/api/" + APIVersion + "/img-proxy?url=" + url.QueryEscape(dest), true
+		}
+	}
+	return nil
+}
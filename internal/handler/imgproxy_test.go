@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// newImageProxyRouter serves an image proxy in proxy mode next to an upstream serving /logo.png,
+// /icon.svg and /big.png; the proxy may dial the upstream's loopback address
+func newImageProxyRouter(t *testing.T) (*gin.Engine, *config.Config, *httptest.Server) {
+	t.Helper()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG fake"))
+		case "/icon.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			_, _ = w.Write([]byte("<svg/>"))
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(make([]byte, 64))
+		case "/elsewhere":
+			http.Redirect(w, r, "http://other.example/x.png", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := config.DefaultConfig()
+	cfg.Render.ExternalImages = config.ExternalImagesProxy
+	cfg.Render.ImageProxyMaxSize = 32
+	h := NewImageProxyHandler(cfg)
+	h.allowAddr = func(net.IP) bool { return true }
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/img-proxy", h.Proxy)
+	return r, cfg, upstream
+}
+
+func proxyImage(r http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/img-proxy?url="+url.QueryEscape(target), nil))
+	return w
+}
+
+func TestImageProxy(t *testing.T) {
+	r, cfg, upstream := newImageProxyRouter(t)
+
+	w := proxyImage(r, upstream.URL+"/logo.png")
+	if w.Code != http.StatusOK || w.Body.String() != "\x89PNG fake" {
+		t.Fatalf("expected the image, got %d: %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "image/png" || w.Header().Get("Cache-Control") == "" {
+		t.Errorf("unexpected headers: %v", w.Header())
+	}
+
+	cases := []struct {
+		target string
+		status int
+		code   ErrorCode
+	}{
+		{upstream.URL + "/icon.svg", http.StatusBadGateway, CodeUpstreamFailed},
+		{upstream.URL + "/big.png", http.StatusRequestEntityTooLarge, CodeTooLarge},
+		{upstream.URL + "/missing.png", http.StatusBadGateway, CodeUpstreamFailed},
+		{"ftp://example.com/a.png", http.StatusBadRequest, CodeInvalidRequest},
+		{"/api/v1/files/x.png", http.StatusBadRequest, CodeInvalidRequest},
+	}
+	for _, tc := range cases {
+		w := proxyImage(r, tc.target)
+		if w.Code != tc.status || !strings.Contains(w.Body.String(), string(tc.code)) {
+			t.Errorf("%s: expected %d %s, got %d: %s", tc.target, tc.status, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	// With an allowlist, other hosts are refused, also when redirected to
+	cfg.Render.ImageHosts = []string{"127.0.0.1"}
+	if w := proxyImage(r, upstream.URL+"/logo.png"); w.Code != http.StatusOK {
+		t.Errorf("expected the allowed host proxied, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, target := range []string{"https://other.example/x.png", upstream.URL + "/elsewhere"} {
+		if w := proxyImage(r, target); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d: %s", target, w.Code, w.Body.String())
+		}
+	}
+
+	cfg.Render.ExternalImages = config.ExternalImagesBlock
+	if w := proxyImage(r, upstream.URL+"/logo.png"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with the proxy disabled, got %d", w.Code)
+	}
+}
+
+func TestImageProxyRefusesPrivateAddresses(t *testing.T) {
+	_, _, upstream := newImageProxyRouter(t)
+	cfg := config.DefaultConfig()
+	cfg.Render.ExternalImages = config.ExternalImagesProxy
+	r := gin.New()
+	r.GET("/img-proxy", NewImageProxyHandler(cfg).Proxy)
+
+	w := proxyImage(r, upstream.URL+"/logo.png")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(CodeHostNotAllowed)) {
+		t.Errorf("expected a loopback upstream refused, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExternalImagePolicy(t *testing.T) {
+	render := config.RenderConfig{ImageHosts: []string{"ok.example", "*.cdn.example"}}
+	if externalImagePolicy(render) != nil {
+		t.Error("expected no policy when external images are allowed")
+	}
+
+	render.ExternalImages = config.ExternalImagesBlock
+	block := externalImagePolicy(render)
+	for dest, want := range map[string]bool{
+		"https://ok.example/a.png":      true,
+		"https://img.cdn.example/a.png": true,
+		"https://cdn.example/a.png":     false,
+		"//evil.example/a.png":          false,
+	} {
+		if got, keep := block(dest); keep != want || (keep && got != dest) {
+			t.Errorf("block %s: got %q, %v", dest, got, keep)
+		}
+	}
+
+	render.ExternalImages = config.ExternalImagesProxy
+	proxy := externalImagePolicy(render)
+	if got, keep := proxy("//ok.example/a b.png"); !keep ||
+		got != "/api/v1/img-proxy?url=https%3A%2F%2Fok.example%2Fa+b.png" {
+		t.Errorf("unexpected proxied destination %q", got)
+	}
+	if _, keep := proxy("https://evil.example/a.png"); keep {
+		t.Error("expected hosts off the allowlist dropped")
+	}
+	render.ImageHosts = nil
+	if _, keep := externalImagePolicy(render)("https://any.example/a.png"); !keep {
+		t.Error("expected any host proxied without an allowlist")
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// LintResponse lists the problems found in a document, by line; an empty list means none. Tool
+// names the lint.commands entry that found them, if any.
+type LintResponse struct {
+	Path   string               `json:"path"`
+	Tool   string               `json:"tool,omitempty"`
+	Issues []markdown.LintIssue `json:"issues"`
+}
+
+// GetLint checks the document at path for common authoring problems (see markdown.Lint), skipping
+// the rules in lint.disabled_rules. Relative links are resolved as the rendered page resolves
+// them. The issues are advisory: rendering never depends on them.
+func (h *FileHandler) GetLint(c *gin.Context) {
+	h.lint(c, strings.TrimPrefix(c.Param("path"), "/"), markdown.LintRules)
+}
+
+// GetLintHeadings serves GET /lint-headings/{path}: GetLint restricted to the headings of the
+// document and the #fragment links to them (markdown.HeadingLintRules)
+func (h *FileHandler) GetLintHeadings(c *gin.Context) {
+	h.lint(c, strings.TrimPrefix(c.Param("path"), "/"), markdown.HeadingLintRules)
+}
+
+// lint answers with the issues of the document at filePath under rules, less lint.disabled_rules
+func (h *FileHandler) lint(c *gin.Context, filePath string, rules []string) {
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.CheckFile(ctx, filePath); err != nil {
+		if errors.Is(err, ErrNotMarkdown) {
+			writeError(c, CodeNotMarkdown, err.Error())
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	fs, relativePath, folder, err := h.resolvePath(ctx, filePath)
+	var content []byte
+	if err == nil {
+		content, err = fs.ReadFile(relativePath)
+	}
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+
+	issues := h.parserFor(folder).Lint(content, h.lintOptions(fs, relativePath, rules))
+	writeJSON(c, http.StatusOK, LintResponse{Path: filePath, Issues: issues})
+}
+
+// lintOptions checks the rules, less lint.disabled_rules, of the document at relPath of fs
+func (h *FileHandler) lintOptions(fs mfs.FileSystem, relPath string, rules []string) markdown.LintOptions {
+	disabled := slices.Clone(h.cfg.Lint.DisabledRules)
+	for _, rule := range markdown.LintRules {
+		if !slices.Contains(rules, rule) {
+			disabled = append(disabled, rule)
+		}
+	}
+	resolve := linkResolver(fs, relPath)
+	return markdown.LintOptions{
+		Disabled: disabled,
+		Resolve: func(dest string) bool {
+			_, ok := resolve(dest)
+			return ok
+		},
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetLint(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide", "index.md"),
+		"# Guide \n\nSee [setup](setup.md), [home](../README.md) and [gone](gone.md).\n\n### Deep\n")
+	writeDoc(t, filepath.Join(dir, "guide", "setup.md"), "# Setup\n")
+	writeDoc(t, filepath.Join(dir, "README.md"), "# Home\n")
+	writeDoc(t, filepath.Join(dir, "notes.txt"), "text\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/lint/*path", NewFileHandler(cfg).GetLint)
+	lint := func(target string) (int, LintResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp LintResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	code, resp := lint("/lint/docs/guide/index.md")
+	want := []markdown.LintIssue{
+		{Rule: markdown.LintTrailingWhitespace, Line: 1, Message: "trailing whitespace"},
+		{Rule: markdown.LintBrokenLink, Line: 3, Message: `broken link "gone.md"`},
+		{Rule: markdown.LintHeadingIncrement, Line: 5, Message: `heading "Deep" skips from level 1 to level 3`},
+	}
+	if code != http.StatusOK || resp.Path != "docs/guide/index.md" || len(resp.Issues) != len(want) {
+		t.Fatalf("unexpected response %d %+v", code, resp)
+	}
+	for i := range want {
+		if resp.Issues[i] != want[i] {
+			t.Errorf("issue %d: expected %+v, got %+v", i, want[i], resp.Issues[i])
+		}
+	}
+
+	cfg.Lint.DisabledRules = []string{markdown.LintTrailingWhitespace, markdown.LintBrokenLink}
+	if _, resp := lint("/lint/docs/guide/index.md"); len(resp.Issues) != 1 {
+		t.Errorf("expected the disabled rules skipped, got %+v", resp.Issues)
+	}
+	if _, resp := lint("/lint/docs/README.md"); resp.Issues == nil || len(resp.Issues) != 0 {
+		t.Errorf("expected an empty list, got %#v", resp.Issues)
+	}
+	for target, want := range map[string]int{
+		"/lint/docs/missing.md":   http.StatusNotFound,
+		"/lint/docs/notes.txt":    http.StatusBadRequest,
+		"/lint/docs/../secret.md": http.StatusForbidden,
+	} {
+		if code, _ := lint(target); code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, code)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of the external linters of lint.commands
+const (
+	defaultLintCommandTimeout = 20 * time.Second
+	maxLintCommandOutput      = 1 << 20
+	maxLintRunCache           = 1000
+)
+
+// lintOutputLineRe matches a "file:line[:column][:] message" line of a linter's text output
+var lintOutputLineRe = regexp.MustCompile(`^[^:\s][^:]*:(\d+)(?::(\d+))?:?\s+(.*\S)\s*$`)
+
+// Keys, lowercased, under which the JSON output of common linters (vale, markdownlint, ...) holds
+// the fields of an issue, in order of preference
+var (
+	lintLineKeys     = []string{"line", "linenumber", "line_number", "startline", "row"}
+	lintColumnKeys   = []string{"column", "col", "startcolumn", "span", "errorrange"}
+	lintRuleKeys     = []string{"rule", "check", "rulenames", "ruleid", "code"}
+	lintSeverityKeys = []string{"severity", "level"}
+	lintMessageKeys  = []string{"message", "ruledescription", "description"}
+	lintDetailKeys   = []string{"errordetail", "detail"}
+)
+
+// errLintOutputTooLarge is returned by runLintCommand for output over maxLintCommandOutput
+var errLintOutputTooLarge = errors.New("linter output too large")
+
+// GetLintRun serves GET /lint-run/{path}?tool=<name>: it runs the lint.commands entry named tool on
+// a temporary copy of the document, read through the folder's file system so that git-backed
+// folders work too, and reports what the linter found in the shape of GetLint. JSON output is
+// searched for objects with a line number; other output is read as "file:line:column: message"
+// lines. A run that times out, or fails without reporting issues, answers with the linter's
+// stderr. Results are cached by tool and content.
+func (h *FileHandler) GetLintRun(c *gin.Context) {
+	filePath := strings.TrimPrefix(c.Param("path"), "/")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	tool := c.Query("tool")
+	if tool == "" {
+		writeError(c, CodeInvalidRequest, "tool is required")
+		return
+	}
+	command, ok := h.cfg.Lint.Commands[tool]
+	if !ok {
+		writeError(c, CodeNotFound, fmt.Sprintf("no lint command named %q", tool))
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.CheckFile(ctx, filePath); err != nil {
+		if errors.Is(err, ErrNotMarkdown) {
+			writeError(c, CodeNotMarkdown, err.Error())
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	fs, relativePath, _, err := h.resolvePath(ctx, filePath)
+	var content []byte
+	if err == nil {
+		content, err = fs.ReadFile(relativePath)
+	}
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+
+	name := path.Base(relativePath)
+	key := strings.Join([]string{tool, command, name, ETag(content)}, "\x00")
+	issues, cached := h.cachedLintRun(key)
+	if !cached {
+		issues, err = runLintCommand(ctx, command, name, content,
+			cmp.Or(h.cfg.Lint.CommandTimeout, defaultLintCommandTimeout))
+		if requestDone(c) {
+			return
+		}
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			writeError(c, CodeUpstreamFailed, tool+" timed out")
+			return
+		case errors.Is(err, errLintOutputTooLarge):
+			writeError(c, CodeTooLarge, err.Error())
+			return
+		case err != nil:
+			writeError(c, CodeUpstreamFailed, err.Error())
+			return
+		}
+		h.cacheLintRun(key, issues)
+	}
+	writeJSON(c, http.StatusOK, LintResponse{Path: filePath, Tool: tool, Issues: issues})
+}
+
+// cachedLintRun returns the issues a linter reported for key, made of the tool, its command, the
+// document's name and its content hash
+func (h *FileHandler) cachedLintRun(key string) ([]markdown.LintIssue, bool) {
+	h.lintRunsMu.Lock()
+	defer h.lintRunsMu.Unlock()
+	issues, ok := h.lintRuns[key]
+	return issues, ok
+}
+
+// cacheLintRun keeps the issues of key, making room by dropping an arbitrary entry when the cache
+// is full
+func (h *FileHandler) cacheLintRun(key string, issues []markdown.LintIssue) {
+	h.lintRunsMu.Lock()
+	defer h.lintRunsMu.Unlock()
+	if _, ok := h.lintRuns[key]; !ok && len(h.lintRuns) >= maxLintRunCache {
+		for k := range h.lintRuns {
+			delete(h.lintRuns, k)
+			break
+		}
+	}
+	h.lintRuns[key] = issues
+}
+
+// runLintCommand writes content to a temporary file called name, runs command on it from the
+// file's directory and returns the issues of its output, sorted by line and column. The command
+// is killed after timeout or once its output passes maxLintCommandOutput bytes.
+func runLintCommand(ctx context.Context, command, name string, content []byte,
+	timeout time.Duration) ([]markdown.LintIssue, error) {
+	dir, err := os.MkdirTemp("", "markhub-lint-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write the document: %w", err)
+	}
+	words := strings.Fields(command)
+	for i := range words {
+		words[i] = strings.ReplaceAll(words[i], "{file}", file)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+	cmd.Dir = dir
+	// Children of a killed command, such as those of a wrapper script, may hold its output open
+	cmd.WaitDelay = time.Second
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout, max: maxLintCommandOutput, cancel: cancel}
+	cmd.Stderr = &limitedBuffer{buf: &stderr, max: maxLintCommandOutput, cancel: cancel}
+	runErr := cmd.Run()
+	if stdout.Len() > maxLintCommandOutput || stderr.Len() > maxLintCommandOutput {
+		return nil, fmt.Errorf("%w (more than %d MiB)", errLintOutputTooLarge, maxLintCommandOutput>>20)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return nil, fmt.Errorf("failed to start %s: %w", words[0], runErr)
+	}
+
+	// Some linters, markdownlint among them, report on stderr
+	output := stdout.Bytes()
+	if len(bytes.TrimSpace(output)) == 0 {
+		output = stderr.Bytes()
+	}
+	issues := parseLintOutput(output)
+	if runErr != nil && len(issues) == 0 {
+		msg := strings.TrimSpace(strings.ReplaceAll(stderr.String(), file, name))
+		return nil, fmt.Errorf("%s failed: %v %s", words[0], runErr, msg)
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues, nil
+}
+
+// limitedBuffer collects output up to max bytes, then one more to mark the overflow, and calls
+// cancel to stop the writer
+type limitedBuffer struct {
+	buf    *bytes.Buffer
+	max    int
+	cancel func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max + 1 - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:max(room, 0)])
+		b.cancel()
+		return 0, io.ErrShortWrite
+	}
+	return b.buf.Write(p)
+}
+
+// parseLintOutput reads the issues of a linter's output, as JSON when it parses as such and as
+// "file:line:column: message" lines otherwise
+func parseLintOutput(output []byte) []markdown.LintIssue {
+	issues := []markdown.LintIssue{}
+	var doc any
+	if trimmed := bytes.TrimSpace(output); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') &&
+		json.Unmarshal(trimmed, &doc) == nil {
+		collectJSONLintIssues(doc, &issues)
+		return issues
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		m := lintOutputLineRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		issue := markdown.LintIssue{Message: m[3]}
+		issue.Line, _ = strconv.Atoi(m[1])
+		issue.Column, _ = strconv.Atoi(m[2])
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// collectJSONLintIssues appends the objects of v that have a line number, at any depth, as issues
+func collectJSONLintIssues(v any, issues *[]markdown.LintIssue) {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			collectJSONLintIssues(item, issues)
+		}
+	case map[string]any:
+		fields := make(map[string]any, len(v))
+		for k, value := range v {
+			fields[strings.ToLower(k)] = value
+		}
+		if line := jsonLintNumber(fields, lintLineKeys); line > 0 {
+			issue := markdown.LintIssue{
+				Line:     line,
+				Column:   jsonLintNumber(fields, lintColumnKeys),
+				Rule:     jsonLintString(fields, lintRuleKeys, "/"),
+				Severity: strings.ToLower(jsonLintString(fields, lintSeverityKeys, "")),
+				Message:  jsonLintString(fields, lintMessageKeys, ""),
+			}
+			if detail := jsonLintString(fields, lintDetailKeys, ""); detail != "" {
+				issue.Message = strings.TrimPrefix(issue.Message+": "+detail, ": ")
+			}
+			*issues = append(*issues, issue)
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			collectJSONLintIssues(v[k], issues)
+		}
+	}
+}
+
+// jsonLintNumber returns the first of keys in fields holding a number, or an array starting with
+// one (such as vale's column span), or 0
+func jsonLintNumber(fields map[string]any, keys []string) int {
+	for _, k := range keys {
+		value := fields[k]
+		if list, ok := value.([]any); ok && len(list) > 0 {
+			value = list[0]
+		}
+		if n, ok := value.(float64); ok {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// jsonLintString returns the first of keys in fields holding a string, or strings joined by sep,
+// or ""
+func jsonLintString(fields map[string]any, keys []string, sep string) string {
+	for _, k := range keys {
+		switch value := fields[k].(type) {
+		case string:
+			if value != "" {
+				return value
+			}
+		case []any:
+			var parts []string
+			for _, item := range value {
+				if s, ok := item.(string); ok {
+					parts = append(parts, s)
+				}
+			}
+			if len(parts) > 0 && sep != "" {
+				return strings.Join(parts, sep)
+			}
+		}
+	}
+	return ""
+}
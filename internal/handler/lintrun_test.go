@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLintOutput(t *testing.T) {
+	vale := `{"/tmp/markhub-lint-1/guide.md": [
+		{"Action": {"Name": "replace"}, "Span": [5, 7], "Check": "Vale.Spelling",
+		 "Message": "Did you really mean 'teh'?", "Severity": "error", "Line": 3}]}`
+	markdownlint := `[{"fileName": "guide.md", "lineNumber": 2, "ruleNames": ["MD013", "line-length"],
+		"ruleDescription": "Line length", "errorDetail": "Expected: 80; Actual: 96", "errorRange": [81, 16]}]`
+	text := "guide.md:4:1 MD022/blanks-around-headings Headings should be surrounded by blank lines\n" +
+		"guide.md:7: trailing space\n" +
+		"summary: 2 problems\n"
+
+	tests := []struct {
+		name   string
+		output string
+		want   []markdown.LintIssue
+	}{
+		{"vale", vale, []markdown.LintIssue{{Rule: "Vale.Spelling", Line: 3, Column: 5, Severity: "error",
+			Message: "Did you really mean 'teh'?"}}},
+		{"markdownlint", markdownlint, []markdown.LintIssue{{Rule: "MD013/line-length", Line: 2, Column: 81,
+			Message: "Line length: Expected: 80; Actual: 96"}}},
+		{"text", text, []markdown.LintIssue{
+			{Line: 4, Column: 1, Message: "MD022/blanks-around-headings Headings should be surrounded by blank lines"},
+			{Line: 7, Message: "trailing space"},
+		}},
+		{"nothing", "", []markdown.LintIssue{}},
+	}
+	for _, tt := range tests {
+		if got := parseLintOutput([]byte(tt.output)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestGetLintRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lint commands are shell scripts")
+	}
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n\nteh text\n")
+	scripts := t.TempDir()
+	script := func(name, body string) string {
+		p := filepath.Join(scripts, name)
+		if err := os.WriteFile(p, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	runs := filepath.Join(scripts, "runs")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Lint.Commands = map[string]string{
+		// Like most linters, it exits 1 when it finds something
+		"spell": script("spell.sh", `echo run >> `+runs+`
+grep -n teh "$1" | sed "s|^\([0-9]*\):.*|$(basename "$1"):\1:1: did you mean 'the'?|"
+exit 1
+`) + " {file}",
+		"broken": script("broken.sh", "echo 'no config found' >&2\nexit 2\n") + " {file}",
+		"slow":   script("slow.sh", "exec sleep 5\n") + " {file}",
+	}
+	cfg.Lint.CommandTimeout = 200 * time.Millisecond
+	h := NewFileHandler(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/lint-run/*path", h.GetLintRun)
+	run := func(target string) (*httptest.ResponseRecorder, LintResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp LintResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, resp
+	}
+
+	for range 2 {
+		w, resp := run("/lint-run/docs/guide.md?tool=spell")
+		want := []markdown.LintIssue{{Line: 3, Column: 1, Message: "did you mean 'the'?"}}
+		if w.Code != http.StatusOK || resp.Tool != "spell" || resp.Path != "docs/guide.md" ||
+			!slices.Equal(resp.Issues, want) {
+			t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+		}
+	}
+	// The second view is served from the cache
+	if data, err := os.ReadFile(runs); err != nil || strings.Count(string(data), "run") != 1 {
+		t.Errorf("expected one run, got %q %v", data, err)
+	}
+
+	w, _ := run("/lint-run/docs/guide.md?tool=broken")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "no config found") {
+		t.Errorf("expected the tool's stderr with 502, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := run("/lint-run/docs/guide.md?tool=slow"); w.Code != http.StatusBadGateway ||
+		!strings.Contains(w.Body.String(), "timed out") {
+		t.Errorf("expected a timeout, got %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := run("/lint-run/docs/guide.md?tool=vale"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown tool, got %d", w.Code)
+	}
+	if w, _ := run("/lint-run/docs/guide.md"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a tool, got %d", w.Code)
+	}
+	if w, _ := run("/lint-run/docs/missing.md?tool=spell"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing document, got %d", w.Code)
+	}
+}
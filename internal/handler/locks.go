@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/crash"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// lockTTL is how long an edit lock lasts without a heartbeat (another POST from its holder)
+const lockTTL = 60 * time.Second
+
+// lockReapInterval is how often expired locks are dropped and announced
+const lockReapInterval = 10 * time.Second
+
+// maxLockNameLength bounds the display name of a lock holder
+const maxLockNameLength = 100
+
+// EditLock is an advisory lock on a document: someone has it open in edit mode
+type EditLock struct {
+	Path       string         `json:"path"` // alias-prefixed
+	Holder     string         `json:"holder"`
+	AcquiredAt timestamp.Time `json:"acquiredAt"`
+	ExpiresAt  timestamp.Time `json:"expiresAt"`
+	// clientID is the ClientIDHeader of the tab holding the lock
+	clientID string
+}
+
+// LockRequest names the holder of a lock, as shown to other clients
+type LockRequest struct {
+	Name string `json:"name"`
+}
+
+// LockStatus is the lock on a path, nil when nobody holds it. It is also the payload of the
+// lockChanged WebSocket message.
+type LockStatus struct {
+	Path string    `json:"path"`
+	Lock *EditLock `json:"lock"`
+}
+
+// LockHandler keeps advisory edit locks in memory, so they are all gone after a restart. They
+// do not stop anyone from saving; saves report a lock held by another client as lock_conflict.
+type LockHandler struct {
+	files *FileHandler
+	ws    *WSHandler
+	mu    sync.Mutex
+	locks map[string]*EditLock
+	stop  chan struct{}
+}
+
+// NewLockHandler creates a lock handler checking paths with files. Lock changes are broadcast via
+// ws when non-nil.
+func NewLockHandler(files *FileHandler, ws *WSHandler) *LockHandler {
+	return &LockHandler{files: files, ws: ws, locks: map[string]*EditLock{}, stop: make(chan struct{})}
+}
+
+// Start begins dropping expired locks in the background until Stop is called
+func (h *LockHandler) Start() {
+	go func() {
+		defer crash.Recover("lock reaper")
+		ticker := time.NewTicker(lockReapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case now := <-ticker.C:
+				h.reap(now)
+			}
+		}
+	}()
+}
+
+// Stop ends the background reaping started by Start
+func (h *LockHandler) Stop() {
+	close(h.stop)
+}
+
+// GetLock reports who holds the lock on a document
+func (h *LockHandler) GetLock(c *gin.Context) {
+	p, ok := h.lockPath(c)
+	if !ok {
+		return
+	}
+	status := LockStatus{Path: p}
+	h.mu.Lock()
+	if lock := h.current(p, time.Now()); lock != nil {
+		held := *lock
+		status.Lock = &held
+	}
+	h.mu.Unlock()
+	writeJSON(c, http.StatusOK, status)
+}
+
+// AcquireLock takes the lock on a document for the tab sending ClientIDHeader, or extends it when
+// the tab already holds it (the heartbeat); it fails with 409 lock_conflict while another tab does
+func (h *LockHandler) AcquireLock(c *gin.Context) {
+	p, ok := h.lockPath(c)
+	if !ok {
+		return
+	}
+	clientID, ok := lockClientID(c)
+	if !ok {
+		return
+	}
+	var req LockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, CodeInvalidRequest, "invalid request body")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxLockNameLength {
+		writeError(c, CodeInvalidRequest, "name is required (at most 100 bytes)")
+		return
+	}
+	if err := h.files.CheckFile(c.Request.Context(), p); err != nil {
+		if errors.Is(err, ErrNotMarkdown) {
+			writeError(c, CodeNotMarkdown, err.Error())
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	lock := h.current(p, now)
+	if lock != nil && lock.clientID != clientID {
+		held := *lock
+		h.mu.Unlock()
+		writeErrorDetails(c, CodeLockConflict, "being edited by "+held.Holder, held)
+		return
+	}
+	acquired := lock == nil || lock.Holder != name
+	if lock == nil {
+		lock = &EditLock{Path: p, AcquiredAt: timestamp.New(now), clientID: clientID}
+		h.locks[p] = lock
+	}
+	lock.Holder = name
+	lock.ExpiresAt = timestamp.New(now.Add(lockTTL))
+	resp := *lock
+	h.mu.Unlock()
+
+	// Heartbeats change nothing other clients show
+	if acquired {
+		h.announce(p, &resp)
+	}
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// ReleaseLock gives up the lock the tab sending ClientIDHeader holds on a document. Releasing a
+// lock nobody holds succeeds; releasing another tab's fails with 409 lock_conflict.
+func (h *LockHandler) ReleaseLock(c *gin.Context) {
+	p, ok := h.lockPath(c)
+	if !ok {
+		return
+	}
+	clientID, ok := lockClientID(c)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	lock := h.current(p, time.Now())
+	if lock != nil && lock.clientID != clientID {
+		held := *lock
+		h.mu.Unlock()
+		writeErrorDetails(c, CodeLockConflict, "being edited by "+held.Holder, held)
+		return
+	}
+	delete(h.locks, p)
+	h.mu.Unlock()
+
+	if lock != nil {
+		h.announce(p, nil)
+	}
+	writeJSON(c, http.StatusOK, LockStatus{Path: p})
+}
+
+// Conflict returns the lock another tab than clientID holds on an alias-prefixed path, or nil
+func (h *LockHandler) Conflict(filePath, clientID string) *EditLock {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lock := h.current(strings.Trim(filePath, "/"), time.Now())
+	if lock == nil || lock.clientID == clientID {
+		return nil
+	}
+	held := *lock
+	return &held
+}
+
+// current returns the unexpired lock on p; h.mu must be held
+func (h *LockHandler) current(p string, now time.Time) *EditLock {
+	lock, ok := h.locks[p]
+	if !ok || !now.Before(lock.ExpiresAt.Time) {
+		return nil
+	}
+	return lock
+}
+
+// reap drops the locks expired at now and tells clients they are gone
+func (h *LockHandler) reap(now time.Time) {
+	var expired []string
+	h.mu.Lock()
+	for p, lock := range h.locks {
+		if !now.Before(lock.ExpiresAt.Time) {
+			delete(h.locks, p)
+			expired = append(expired, p)
+		}
+	}
+	h.mu.Unlock()
+	for _, p := range expired {
+		h.announce(p, nil)
+	}
+}
+
+// announce broadcasts the new state of the lock on p
+func (h *LockHandler) announce(p string, lock *EditLock) {
+	if h.ws != nil {
+		h.ws.broadcast(WSMessage{Type: "lockChanged", Payload: LockStatus{Path: p, Lock: lock}})
+	}
+}
+
+// lockPath returns the alias-prefixed document path of a lock request. On failure it has already
+// sent the error response and returns false.
+func (h *LockHandler) lockPath(c *gin.Context) (string, bool) {
+	p := strings.Trim(c.Param("path"), "/")
+	if strings.Contains(p, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return "", false
+	}
+	if p == "" {
+		writeError(c, CodeInvalidPath, "a document path is required")
+		return "", false
+	}
+	return p, true
+}
+
+// lockClientID returns the ClientIDHeader identifying the tab that holds a lock. On failure it
+// has already sent the error response and returns false.
+func lockClientID(c *gin.Context) (string, bool) {
+	id := c.GetHeader(ClientIDHeader)
+	if id == "" {
+		writeError(c, CodeInvalidRequest, ClientIDHeader+" header is required")
+		return "", false
+	}
+	return id, true
+}
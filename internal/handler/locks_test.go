@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lockRoutes registers the routes of the lock tests, returning the LockHandler that guards h's saves
+func lockRoutes(r *gin.Engine, h *FileHandler) *LockHandler {
+	locks := NewLockHandler(h, nil)
+	h.SetLockConflict(locks.Conflict)
+	r.PUT("/raw/*path", h.PutRaw)
+	r.GET("/locks/*path", locks.GetLock)
+	r.POST("/locks/*path", locks.AcquireLock)
+	r.DELETE("/locks/*path", locks.ReleaseLock)
+	return locks
+}
+
+// lockDocs are the documents of the lock tests
+var lockDocs = map[string]string{"guide.md": "# Guide\n"}
+
+// serveLock sends a lock request from the tab clientID
+func serveLock(r http.Handler, method, target, clientID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if clientID != "" {
+		req.Header.Set(ClientIDHeader, clientID)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func lockHolder(t *testing.T, r http.Handler) string {
+	t.Helper()
+	w := serveLock(r, http.MethodGet, "/locks/docs/guide.md", "", "")
+	var status LockStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Lock == nil {
+		return ""
+	}
+	return status.Lock.Holder
+}
+
+func TestEditLocks(t *testing.T) {
+	r, _, _ := newFileRouter(t, lockDocs, func(r *gin.Engine, h *FileHandler) { lockRoutes(r, h) })
+
+	if w := serveLock(r, http.MethodPost, "/locks/docs/guide.md", "tab1", `{"name":"Alice"}`); w.Code != http.StatusOK {
+		t.Fatalf("acquire: %d %s", w.Code, w.Body.String())
+	}
+	if got := lockHolder(t, r); got != "Alice" {
+		t.Errorf("holder = %q, want Alice", got)
+	}
+	// The heartbeat from the holder keeps it
+	if w := serveLock(r, http.MethodPost, "/locks/docs/guide.md", "tab1", `{"name":"Alice"}`); w.Code != http.StatusOK {
+		t.Fatalf("refresh: %d %s", w.Code, w.Body.String())
+	}
+
+	w := serveLock(r, http.MethodPost, "/locks/docs/guide.md", "tab2", `{"name":"Bob"}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), string(CodeLockConflict)) ||
+		!strings.Contains(w.Body.String(), "Alice") {
+		t.Errorf("acquire held lock: %d %s", w.Code, w.Body.String())
+	}
+
+	// Saves go through, warning everyone but the holder
+	req := httptest.NewRequest(http.MethodPut, "/raw/docs/guide.md", strings.NewReader("# Bob's\n"))
+	req.Header.Set(ClientIDHeader, "tab2")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var saved RawResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || saved.LockConflict == nil || saved.LockConflict.Holder != "Alice" {
+		t.Errorf("save by another tab: %d %s", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPut, "/raw/docs/guide.md", strings.NewReader("# Alice's\n"))
+	req.Header.Set(ClientIDHeader, "tab1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "lock_conflict") {
+		t.Errorf("save by the holder: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serveLock(r, http.MethodDelete, "/locks/docs/guide.md", "tab2", ""); w.Code != http.StatusConflict {
+		t.Errorf("release by another tab: %d %s", w.Code, w.Body.String())
+	}
+	if w := serveLock(r, http.MethodDelete, "/locks/docs/guide.md", "tab1", ""); w.Code != http.StatusOK {
+		t.Errorf("release: %d %s", w.Code, w.Body.String())
+	}
+	if got := lockHolder(t, r); got != "" {
+		t.Errorf("holder after release = %q", got)
+	}
+}
+
+func TestEditLockExpires(t *testing.T) {
+	var locks *LockHandler
+	r, _, _ := newFileRouter(t, lockDocs, func(r *gin.Engine, h *FileHandler) { locks = lockRoutes(r, h) })
+	if w := serveLock(r, http.MethodPost, "/locks/docs/guide.md", "tab1", `{"name":"Alice"}`); w.Code != http.StatusOK {
+		t.Fatalf("acquire: %d %s", w.Code, w.Body.String())
+	}
+	locks.reap(time.Now().Add(lockTTL))
+	if got := lockHolder(t, r); got != "" {
+		t.Errorf("holder after expiry = %q", got)
+	}
+	if w := serveLock(r, http.MethodPost, "/locks/docs/guide.md", "tab2", `{"name":"Bob"}`); w.Code != http.StatusOK {
+		t.Errorf("acquire expired lock: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEditLockRejects(t *testing.T) {
+	r, _, _ := newFileRouter(t, lockDocs, func(r *gin.Engine, h *FileHandler) { lockRoutes(r, h) })
+	tests := []struct {
+		name, method, target, clientID, body string
+		want                                 int
+	}{
+		{"no client id", http.MethodPost, "/locks/docs/guide.md", "", `{"name":"Alice"}`, http.StatusBadRequest},
+		{"no name", http.MethodPost, "/locks/docs/guide.md", "tab1", `{"name":" "}`, http.StatusBadRequest},
+		{"missing document", http.MethodPost, "/locks/docs/missing.md", "tab1", `{"name":"Alice"}`, http.StatusNotFound},
+		{"not markdown", http.MethodPost, "/locks/docs/guide.txt", "tab1", `{"name":"Alice"}`, http.StatusBadRequest},
+		{"release without client id", http.MethodDelete, "/locks/docs/guide.md", "", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveLock(r, tt.method, tt.target, tt.clientID, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
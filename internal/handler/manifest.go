@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// Formats of GET /manifest
+const (
+	ManifestFormatJSON  = "json"  // one JSON array
+	ManifestFormatJSONL = "jsonl" // one JSON object per line, streamed
+)
+
+// ManifestEntry describes a document for external tooling such as indexing pipelines
+type ManifestEntry struct {
+	Path     string         `json:"path"`
+	Alias    string         `json:"alias"`
+	FolderID string         `json:"folderId"`
+	Size     int64          `json:"size"`
+	ModTime  timestamp.Time `json:"modTime"`
+	// Hash is the hex SHA-256 of the document's content
+	Hash  string   `json:"hash"`
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags"`
+}
+
+// GetDocumentManifest lists every document the tree shows, across all folders or the one named by
+// ?folderId=, flattened with the metadata external tooling needs to sync them. ?since= (RFC 3339)
+// keeps the documents modified at or after it; ?format=jsonl streams one entry per line.
+func (h *ExportHandler) GetDocumentManifest(c *gin.Context) {
+	folders := h.cfg.FoldersSnapshot()
+	if id := c.Query("folderId"); id != "" {
+		folder, ok := h.cfg.FolderByID(id)
+		if !ok {
+			writeError(c, CodeFolderNotFound, "folder not found")
+			return
+		}
+		folders = []config.Folder{folder}
+	}
+	var since time.Time
+	if v := c.Query("since"); v != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(c, CodeInvalidRequest, "since must be an RFC 3339 time")
+			return
+		}
+	}
+	format := c.DefaultQuery("format", ManifestFormatJSON)
+	if format != ManifestFormatJSON && format != ManifestFormatJSONL {
+		writeError(c, CodeInvalidRequest, "format must be json or jsonl")
+		return
+	}
+
+	ctx := c.Request.Context()
+	entries := []ManifestEntry{}
+	var stream *json.Encoder
+	if format == ManifestFormatJSONL {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		stream = json.NewEncoder(c.Writer)
+	}
+	for _, folder := range folders {
+		tree, err := h.tree.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		fs := fsForFolder(ctx, folder)
+		for _, node := range collectFiles(tree, nil) {
+			if ctx.Err() != nil {
+				break
+			}
+			var modTime time.Time
+			if node.ModTime != nil {
+				modTime = node.ModTime.Time
+			}
+			if modTime.Before(since) {
+				continue
+			}
+			relPath := strings.TrimPrefix(node.Path, folder.Alias+"/")
+			content, err := fs.ReadFile(relPath)
+			if err != nil {
+				continue
+			}
+			sum := sha256.Sum256(content)
+			entry := ManifestEntry{
+				Path:     node.Path,
+				Alias:    folder.Alias,
+				FolderID: folder.ID,
+				Size:     int64(len(content)),
+				ModTime:  timestamp.New(modTime),
+				Hash:     hex.EncodeToString(sum[:]),
+				Title:    h.tree.titles.get(fs, relPath, node),
+				Tags:     h.tree.tags.get(fs, relPath, node),
+			}
+			if entry.Tags == nil {
+				entry.Tags = []string{}
+			}
+			if stream == nil {
+				entries = append(entries, entry)
+				continue
+			}
+			if err := stream.Encode(entry); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	if stream == nil && !requestDone(c) {
+		writeJSON(c, http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetDocumentManifest(t *testing.T) {
+	docs := t.TempDir()
+	writeDoc(t, filepath.Join(docs, "old.md"), "# Old\n")
+	writeDoc(t, filepath.Join(docs, "new.md"), "---\ntags: [Go]\n---\n# New\n")
+	writeDoc(t, filepath.Join(docs, "drafts", "wip.md"), "# WIP\n")
+	notes := t.TempDir()
+	writeDoc(t, filepath.Join(notes, "n.md"), "# Note\n")
+	stamp := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(docs, "old.md"), stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: docs, Alias: "docs", Exclude: []string{"drafts/**"}},
+		{ID: "notes", Path: notes, Alias: "notes"},
+	}
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	r := gin.New()
+	r.GET("/manifest", NewExportHandler(cfg, tree, NewFileHandler(cfg)).GetDocumentManifest)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/manifest?"+query, nil))
+		return w
+	}
+
+	var entries []ManifestEntry
+	if err := json.Unmarshal(get("").Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected the three visible documents, got %+v", entries)
+	}
+	byPath := map[string]ManifestEntry{}
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	fresh := byPath["docs/new.md"]
+	if fresh.Alias != "docs" || fresh.FolderID != "docs" || fresh.Title != "New" || fresh.Size != 25 ||
+		len(fresh.Hash) != 64 || len(fresh.Tags) != 1 || fresh.Tags[0] != "go" {
+		t.Errorf("unexpected entry %+v", fresh)
+	}
+	if old := byPath["docs/old.md"]; !old.ModTime.Equal(stamp) || old.Tags == nil {
+		t.Errorf("unexpected entry %+v", old)
+	}
+
+	// Streamed, for one folder and since a time
+	w := get("folderId=docs&format=jsonl&since=2026-06-01T00:00:00Z")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected a stream, got %d %v", w.Code, w.Header())
+	}
+	var lines []string
+	for scanner := bufio.NewScanner(w.Body); scanner.Scan(); {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], `"path":"docs/new.md"`) {
+		t.Errorf("expected new.md alone, got %q", lines)
+	}
+
+	for query, want := range map[string]int{
+		"folderId=missing": http.StatusNotFound,
+		"since=yesterday":  http.StatusBadRequest,
+		"format=xml":       http.StatusBadRequest,
+	} {
+		if w := get(query); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", query, want, w.Code)
+		}
+	}
+}
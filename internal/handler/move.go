@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMoveScan bounds how many documents a move searches for links to rewrite
+const maxMoveScan = 5000
+
+// MoveRequest names a document or directory and its new location, both alias-prefixed
+type MoveRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LinkUpdate reports the links rewritten in one document
+type LinkUpdate struct {
+	Path  string `json:"path"` // alias-prefixed, after the move
+	Links int    `json:"links"`
+	// Error is set when the rewritten document could not be saved
+	Error string `json:"error,omitempty"`
+}
+
+// MoveReport is the result of a move, or with dry_run the move that would happen
+type MoveReport struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	DryRun  bool         `json:"dryRun"`
+	Updated []LinkUpdate `json:"updated"`
+	// Truncated is set when the folder has more than maxMoveScan documents and some were not searched
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// PostFile serves POST /files/*path: /files/move moves documents, any other path creates a file.
+// Gin cannot register the static route next to the catch-all, and "move" is no markdown file name.
+func (h *FileHandler) PostFile(c *gin.Context) {
+	if c.Param("path") == "/move" {
+		// The route is exempt from the request body limit for file creation; a move is small JSON
+		limitBody(c, maxRequestBody(h.cfg.MaxRequestBody))
+		h.Move(c)
+		return
+	}
+	h.CreateFile(c)
+}
+
+// Move renames or moves a markdown file or directory within its folder and rewrites relative links
+// to it in the folder's other documents, and the moved documents' own links. With ?dry_run=true it
+// only reports the documents that would change. Missing parents of the target need ?mkdirs=true.
+func (h *FileHandler) Move(c *gin.Context) {
+	var req MoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, CodeInvalidRequest, "invalid request body")
+		return
+	}
+	from := strings.Trim(req.From, "/")
+	to := strings.Trim(req.To, "/")
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	mkdirs, _ := strconv.ParseBool(c.Query("mkdirs"))
+
+	fromAlias, _, _ := strings.Cut(from, "/")
+	toAlias, _, _ := strings.Cut(to, "/")
+	if fromAlias != toAlias {
+		writeError(c, CodeInvalidRequest, "moving between folders is not supported")
+		return
+	}
+	wfs, oldRel, folder, ok := h.prepareTarget(c, from)
+	if !ok {
+		return
+	}
+	_, newRel, _, ok := h.prepareTarget(c, to)
+	if !ok {
+		return
+	}
+
+	info, err := wfs.Stat(oldRel)
+	if err != nil {
+		writeDeleteError(c, err)
+		return
+	}
+	if info.IsDir {
+		if newRel == oldRel || strings.HasPrefix(newRel, oldRel+"/") {
+			writeError(c, CodeInvalidPath, "cannot move a directory into itself")
+			return
+		}
+	} else if !h.cfg.IsMarkdownFile(oldRel) || !h.cfg.IsMarkdownFile(newRel) {
+		writeError(c, CodeNotMarkdown, ErrNotMarkdown.Error())
+		return
+	}
+	if _, err := wfs.Stat(newRel); err == nil {
+		writeError(c, CodeAlreadyExists, "target already exists")
+		return
+	}
+
+	if !dryRun {
+		h.writeMu.Lock()
+		defer h.writeMu.Unlock()
+	}
+	docs, truncated := h.folderDocuments(c.Request.Context(), wfs, folder)
+	rewrites := rewriteLinksForMove(wfs, docs, oldRel, newRel)
+
+	report := MoveReport{From: from, To: to, DryRun: dryRun, Updated: []LinkUpdate{}, Truncated: truncated}
+	if !dryRun {
+		if parent := path.Dir(newRel); mkdirs && parent != "." {
+			if err := wfs.Mkdir(parent, true); err != nil && !os.IsExist(err) {
+				writeCreateError(c, err, "directory")
+				return
+			}
+		}
+		if err := wfs.Rename(oldRel, newRel, false); err != nil {
+			writeCreateError(c, err, "target")
+			return
+		}
+	}
+	for _, rw := range rewrites {
+		update := LinkUpdate{Path: folder.Alias + "/" + rw.path, Links: rw.links}
+		if !dryRun {
+			if err := wfs.WriteFile(rw.path, rw.content, mfs.WriteOptions{}); err != nil {
+				update.Error = err.Error()
+			}
+		}
+		report.Updated = append(report.Updated, update)
+	}
+	if !dryRun {
+		h.notifyTreeChange(from)
+		h.notifyTreeChange(to)
+		// One commit for the move and the link rewrites it caused
+		changed := []string{oldRel, newRel}
+		for _, rw := range rewrites {
+			changed = append(changed, rw.path)
+		}
+		h.autoCommit(c, folder, "move", changed...)
+		recordAudit(h.audit, c, "file.move", gin.H{"path": from}, gin.H{"path": to, "linksUpdated": len(rewrites)})
+	}
+	writeJSON(c, http.StatusOK, report)
+}
+
+// linkRewrite is a document whose links a move changes, at its path after the move
+type linkRewrite struct {
+	path    string
+	content []byte
+	links   int
+}
+
+// rewriteLinksForMove computes the new content of every document in docs (folder-relative paths)
+// with links affected by moving oldRel to newRel. Unreadable documents are skipped.
+func rewriteLinksForMove(fs mfs.FileSystem, docs []string, oldRel, newRel string) []linkRewrite {
+	var rewrites []linkRewrite
+	for _, doc := range docs {
+		content, err := fs.ReadFile(doc)
+		if err != nil {
+			continue
+		}
+		newDoc, _ := movedPath(doc, oldRel, newRel)
+		out, n := markdown.RewriteLinks(content, moveRewriter(doc, newDoc, oldRel, newRel))
+		if n > 0 {
+			rewrites = append(rewrites, linkRewrite{path: newDoc, content: out, links: n})
+		}
+	}
+	return rewrites
+}
+
+// moveRewriter returns the link rewrite for a document moving from oldDoc to newDoc (the same path
+// when it stays) while oldRel moves to newRel: relative links are re-pointed when their target
+// moves, or when the document itself moves to another directory
+func moveRewriter(oldDoc, newDoc, oldRel, newRel string) func(string) (string, bool) {
+	return func(dest string) (string, bool) {
+		target, ok := markdown.RelativeTarget(dest)
+		if !ok {
+			return "", false
+		}
+		resolved, inside := linkTarget(oldDoc, target)
+		if !inside {
+			return "", false
+		}
+		newTarget, moved := movedPath(resolved, oldRel, newRel)
+		if !moved && path.Dir(oldDoc) == path.Dir(newDoc) {
+			return "", false
+		}
+		u, err := url.Parse(dest)
+		if err != nil {
+			return "", false
+		}
+		newDir := filepath.FromSlash(path.Dir(newDoc))
+		rel, err := filepath.Rel(newDir, filepath.FromSlash(path.Join(".", newTarget)))
+		if err != nil {
+			return "", false
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == path.Clean(target) {
+			// Still correct, e.g. between two documents that move together
+			return "", false
+		}
+		if strings.HasSuffix(target, "/") && rel != "." {
+			rel += "/"
+		}
+		u.Path, u.RawPath = rel, ""
+		return u.String(), true
+	}
+}
+
+// movedPath maps p to its location after oldRel moves to newRel, reporting whether it moves
+func movedPath(p, oldRel, newRel string) (string, bool) {
+	if p == oldRel {
+		return newRel, true
+	}
+	if strings.HasPrefix(p, oldRel+"/") {
+		return newRel + strings.TrimPrefix(p, oldRel), true
+	}
+	return p, false
+}
+
+// folderDocuments lists the folder-relative paths of the markdown files the tree shows for folder,
+// stopping after maxMoveScan; it reports whether it stopped early
+func (h *FileHandler) folderDocuments(ctx context.Context, fs mfs.FileSystem, folder config.Folder) ([]string, bool) {
+	var docs []string
+	truncated := false
+	var walk func(dir string)
+	walk = func(dir string) {
+		entries, err := fs.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, e := range entries {
+			if truncated || ctx.Err() != nil {
+				return
+			}
+			rel := path.Join(dir, e.Name)
+			if !h.visibleInTree(folder, rel) {
+				continue
+			}
+			switch {
+			case e.IsDir:
+				walk(rel)
+			case h.cfg.IsMarkdownFile(e.Name):
+				if len(docs) == maxMoveScan {
+					truncated = true
+					return
+				}
+				docs = append(docs, rel)
+			}
+		}
+	}
+	walk(strings.Trim(folder.SubPath, "/"))
+	return docs, truncated
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// moveDocs are the documents of the move tests, linking to one another
+var moveDocs = map[string]string{
+	"README.md":      "# Home\n\n[Guide](guide/setup.md#install) and [API](api.md)\n",
+	"guide/setup.md": "# Setup\n\nBack [home](../README.md), see [next](next.md).\n",
+	"guide/next.md":  "# Next\n\n[Setup](./setup.md)\n\n[api]: ../api.md\n",
+	"api.md":         "# API\n\n`[not a link](guide/setup.md)`\n",
+}
+
+// moveRoutes registers the routes of the move tests
+func moveRoutes(r *gin.Engine, h *FileHandler) {
+	r.POST("/files/*path", h.PostFile)
+}
+
+func postMove(t *testing.T, r http.Handler, query, from, to string) (*httptest.ResponseRecorder, MoveReport) {
+	t.Helper()
+	body, _ := json.Marshal(MoveRequest{From: from, To: to})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/files/move"+query, strings.NewReader(string(body))))
+	var report MoveReport
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+	return w, report
+}
+
+func readDoc(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func updatedPaths(report MoveReport) string {
+	var paths []string
+	for _, u := range report.Updated {
+		paths = append(paths, u.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestMoveFileRewritesLinks(t *testing.T) {
+	r, h, dir := newFileRouter(t, moveDocs, moveRoutes)
+	changed := recordTreeChanges(h)
+
+	w, report := postMove(t, r, "?dry_run=true", "docs/guide/setup.md", "docs/manual/install.md")
+	if w.Code != http.StatusOK || !report.DryRun {
+		t.Fatalf("expected a 200 dry run, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := updatedPaths(report); got != "docs/README.md,docs/guide/next.md,docs/manual/install.md" {
+		t.Errorf("unexpected dry run report %s", w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "guide", "setup.md")); err != nil || len(*changed) != 0 {
+		t.Fatalf("expected a dry run to change nothing, stat err = %v", err)
+	}
+
+	if w, _ := postMove(t, r, "", "docs/guide/setup.md", "docs/manual/install.md"); w.Code != http.StatusNotFound {
+		t.Errorf("expected a missing target directory to need mkdirs, got %d", w.Code)
+	}
+	w, report = postMove(t, r, "?mkdirs=true", "docs/guide/setup.md", "docs/manual/install.md")
+	if w.Code != http.StatusOK || len(report.Updated) != 3 {
+		t.Fatalf("expected 200 with 3 updates, got %d: %s", w.Code, w.Body.String())
+	}
+	for path, want := range map[string]string{
+		"README.md":         "# Home\n\n[Guide](manual/install.md#install) and [API](api.md)\n",
+		"guide/next.md":     "# Next\n\n[Setup](../manual/install.md)\n\n[api]: ../api.md\n",
+		"manual/install.md": "# Setup\n\nBack [home](../README.md), see [next](../guide/next.md).\n",
+		"api.md":            "# API\n\n`[not a link](guide/setup.md)`\n",
+	} {
+		if got := readDoc(t, filepath.Join(dir, path)); got != want {
+			t.Errorf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+	if strings.Join(*changed, ",") != "docs/guide/setup.md,docs/manual/install.md" {
+		t.Errorf("unexpected tree change notifications %v", *changed)
+	}
+}
+
+func TestMoveDirectoryRewritesLinks(t *testing.T) {
+	r, _, dir := newFileRouter(t, moveDocs, moveRoutes)
+
+	if w, _ := postMove(t, r, "", "docs/guide", "docs/handbook/guide"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing parent to be a 404, got %d", w.Code)
+	}
+	w, report := postMove(t, r, "?mkdirs=true", "docs/guide", "docs/handbook/guide")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := updatedPaths(report); got != "docs/README.md,docs/handbook/guide/next.md,docs/handbook/guide/setup.md" {
+		t.Errorf("unexpected report %s", w.Body.String())
+	}
+	want := "# Next\n\n[Setup](./setup.md)\n\n[api]: ../../api.md\n"
+	if got := readDoc(t, filepath.Join(dir, "handbook", "guide", "next.md")); got != want {
+		t.Errorf("expected links within the moved directory to stay, got %q", got)
+	}
+	want = "# Home\n\n[Guide](handbook/guide/setup.md#install) and [API](api.md)\n"
+	if got := readDoc(t, filepath.Join(dir, "README.md")); got != want {
+		t.Errorf("unexpected README %q", got)
+	}
+}
+
+func TestMoveRejects(t *testing.T) {
+	r, h, _ := newFileRouter(t, moveDocs, moveRoutes)
+	h.cfg.Folders = append(h.cfg.Folders, config.Folder{ID: "other", Path: t.TempDir(), Alias: "other", Writable: true})
+	changed := recordTreeChanges(h)
+
+	tests := []struct {
+		name, from, to string
+		want           int
+		code           ErrorCode
+	}{
+		{"other folder", "docs/api.md", "other/api.md", http.StatusBadRequest, CodeInvalidRequest},
+		{"existing target", "docs/api.md", "docs/README.md", http.StatusConflict, CodeAlreadyExists},
+		{"missing source", "docs/nope.md", "docs/new.md", http.StatusNotFound, CodeNotFound},
+		{"not markdown", "docs/api.md", "docs/api.txt", http.StatusBadRequest, CodeNotMarkdown},
+		{"into itself", "docs/guide", "docs/guide/sub", http.StatusBadRequest, CodeInvalidPath},
+		{"traversal", "docs/api.md", "docs/../api.md", http.StatusForbidden, CodePathTraversal},
+		{"excluded target", "docs/api.md", "docs/node_modules/api.md", http.StatusForbidden, CodePathExcluded},
+	}
+	for _, tt := range tests {
+		w, _ := postMove(t, r, "", tt.from, tt.to)
+		var body APIError
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != tt.want || body.Code != tt.code {
+			t.Errorf("%s: expected %d %s, got %d %s", tt.name, tt.want, tt.code, w.Code, w.Body.String())
+		}
+	}
+	if len(*changed) != 0 {
+		t.Errorf("expected no tree change notifications, got %v", *changed)
+	}
+}
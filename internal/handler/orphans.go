@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultEntryPoints are the documents the orphan report expects no links to when
+// lint.entry_points is unset
+var defaultEntryPoints = []string{"README.*", "index.*"}
+
+// ReportDocument is a document listed by the orphan report
+type ReportDocument struct {
+	Path    string          `json:"path"`
+	Title   string          `json:"title"`
+	Size    int64           `json:"size"`
+	ModTime *timestamp.Time `json:"modTime"`
+}
+
+// OrphanReport is the response of GET /lint-report/orphans
+type OrphanReport struct {
+	// Orphans are the documents no other document links to, entry points aside
+	Orphans []ReportDocument `json:"orphans"`
+	// DeadEnds are the documents linking to no other document
+	DeadEnds []ReportDocument `json:"deadEnds"`
+}
+
+// GetOrphans lists, from the link graph of all folders or of the one named by ?folder= or
+// ?folderId=, the documents no other document links to and those linking to none. Entry points
+// (lint.entry_points, and the home_document) are never orphans. Only links between documents the
+// tree shows count. ?sort=stale (the default) lists the least recently modified first, ?sort=path
+// in tree order.
+func (h *TreeHandler) GetOrphans(c *gin.Context) {
+	order := c.DefaultQuery("sort", "stale")
+	if order != "stale" && order != "path" {
+		writeError(c, CodeInvalidRequest, "sort must be stale or path")
+		return
+	}
+	folders, ok := h.tagFolders(c)
+	if !ok {
+		return
+	}
+	g := h.buildGraph(c.Request.Context(), folders)
+	if requestDone(c) {
+		return
+	}
+
+	inbound, outbound := make([]int, len(g.nodes)), make([]int, len(g.nodes))
+	for _, edge := range g.edges {
+		outbound[g.index[edge.Source]]++
+		inbound[g.index[edge.Target]]++
+	}
+	report := OrphanReport{Orphans: []ReportDocument{}, DeadEnds: []ReportDocument{}}
+	for i, node := range g.nodes {
+		doc := ReportDocument{Path: node.Path, Title: node.Title, Size: g.files[i].Size, ModTime: g.files[i].ModTime}
+		if inbound[i] == 0 && !h.entryPoint(node.Path) {
+			report.Orphans = append(report.Orphans, doc)
+		}
+		if outbound[i] == 0 {
+			report.DeadEnds = append(report.DeadEnds, doc)
+		}
+	}
+	if order == "stale" {
+		sortByStaleness(report.Orphans)
+		sortByStaleness(report.DeadEnds)
+	}
+	writeJSON(c, http.StatusOK, report)
+}
+
+// entryPoint reports whether the document at the alias-prefixed path is the home_document or
+// matches lint.entry_points
+func (h *TreeHandler) entryPoint(docPath string) bool {
+	if h.cfg.HomeDocument != "" && strings.Trim(h.cfg.HomeDocument, "/") == docPath {
+		return true
+	}
+	patterns := h.cfg.Lint.EntryPoints
+	if len(patterns) == 0 {
+		patterns = defaultEntryPoints
+	}
+	name := strings.ToLower(path.Base(docPath))
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByStaleness orders docs by modification time, oldest first; documents without one go last
+func sortByStaleness(docs []ReportDocument) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, b := docs[i].ModTime, docs[j].ModTime
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Before(b.Time)
+	})
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetOrphans(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "README.md"), "# Home\n\n[Guide](guide.md)\n")
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n\n[Home](README.md) [Old](old.md) [pdf](manual.pdf)\n")
+	writeDoc(t, filepath.Join(dir, "manual.pdf"), "%PDF")
+	writeDoc(t, filepath.Join(dir, "old.md"), "# Old\n")
+	writeDoc(t, filepath.Join(dir, "older.md"), "# Older\n\n[Guide](guide.md)\n")
+	writeDoc(t, filepath.Join(dir, "new.md"), "# New\n")
+	// Links from excluded files do not count as inbound links
+	writeDoc(t, filepath.Join(dir, "drafts", "plan.md"), "# Plan\n\n[New](../new.md) [Older](../older.md)\n")
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"older.md": 48 * time.Hour, "new.md": time.Hour} {
+		if err := os.Chtimes(filepath.Join(dir, name), now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs", Exclude: []string{"drafts"}}}
+	h := NewTreeHandler(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/lint-report/orphans", h.GetOrphans)
+	report := func(target string) (int, OrphanReport) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp OrphanReport
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp
+	}
+	paths := func(docs []ReportDocument) []string {
+		out := []string{}
+		for _, d := range docs {
+			out = append(out, d.Path)
+		}
+		return out
+	}
+
+	code, resp := report("/lint-report/orphans?folderId=docs")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	// README.md is an entry point; the oldest orphan comes first
+	if got := paths(resp.Orphans); !slices.Equal(got, []string{"docs/older.md", "docs/new.md"}) {
+		t.Errorf("unexpected orphans %v", got)
+	}
+	if got := paths(resp.DeadEnds); !slices.Equal(got, []string{"docs/new.md", "docs/old.md"}) {
+		t.Errorf("unexpected dead ends %v", got)
+	}
+	if first := resp.Orphans[0]; first.Title != "Older" || first.Size == 0 || first.ModTime == nil {
+		t.Errorf("unexpected orphan %+v", first)
+	}
+
+	_, resp = report("/lint-report/orphans?folderId=docs&sort=path")
+	if got := paths(resp.Orphans); !slices.Equal(got, []string{"docs/new.md", "docs/older.md"}) {
+		t.Errorf("unexpected orphans in tree order %v", got)
+	}
+
+	h.cfg.Lint.EntryPoints = []string{"OLDER.*"}
+	_, resp = report("/lint-report/orphans?folderId=docs")
+	if got := paths(resp.Orphans); !slices.Equal(got, []string{"docs/new.md"}) {
+		t.Errorf("unexpected orphans with configured entry points %v", got)
+	}
+
+	if code, _ := report("/lint-report/orphans?sort=size"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown sort, got %d", code)
+	}
+	if code, _ := report("/lint-report/orphans?folderId=nope"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown folder, got %d", code)
+	}
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// Formats of GET /export/outline
+const (
+	OutlineFormatJSON = "json"
+	OutlineFormatOPML = "opml"
+)
+
+// Types of outline nodes
+const (
+	OutlineTypeFolder    = "folder"
+	OutlineTypeDirectory = "directory"
+	OutlineTypeFile      = "file"
+)
+
+// OutlineNode is a folder, directory or document of the exported outline
+type OutlineNode struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+	// Title and URL (the document in the viewer) are set on files
+	Title    string         `json:"title,omitempty"`
+	URL      string         `json:"url,omitempty"`
+	Children []*OutlineNode `json:"children,omitempty"`
+}
+
+// Outline is the tree of one or every folder, for tools importing the documentation's structure
+type Outline struct {
+	Title   string         `json:"title"`
+	Folders []*OutlineNode `json:"folders"`
+}
+
+// opmlDocument is an outline in OPML 2.0
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title"`
+		DateCreated string `xml:"dateCreated"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// opmlOutline is an outline element; files are links to the viewer
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Type     string        `xml:"type,attr,omitempty"`
+	URL      string        `xml:"url,attr,omitempty"`
+	Children []opmlOutline `xml:"outline"`
+}
+
+// outlineOptions are the query options of GET /export/outline
+type outlineOptions struct {
+	base   string // start of the viewer URLs
+	titles bool
+	files  bool
+}
+
+// GetOutline exports the tree of every folder, or of the one named by ?folderId=, as OPML
+// (?format=opml) or a JSON outline. Files carry their title and viewer URL; ?titles=false skips
+// the titles for an instant answer on huge trees and ?files=false keeps only the directories.
+func (h *ExportHandler) GetOutline(c *gin.Context) {
+	folders := h.cfg.FoldersSnapshot()
+	if id := c.Query("folderId"); id != "" {
+		folder, ok := h.cfg.FolderByID(id)
+		if !ok {
+			writeError(c, CodeFolderNotFound, "folder not found")
+			return
+		}
+		folders = []config.Folder{folder}
+	}
+	format := c.DefaultQuery("format", OutlineFormatJSON)
+	if format != OutlineFormatJSON && format != OutlineFormatOPML {
+		writeError(c, CodeInvalidRequest, "format must be json or opml")
+		return
+	}
+	opts := outlineOptions{
+		base:   BaseURL(c) + "/#",
+		titles: c.Query("titles") != "false",
+		files:  c.Query("files") != "false",
+	}
+
+	ctx := c.Request.Context()
+	outline := Outline{Title: h.cfg.GetBranding().Title, Folders: []*OutlineNode{}}
+	if outline.Title == "" {
+		outline.Title = "MarkHub"
+	}
+	for _, folder := range folders {
+		tree, err := h.tree.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		root := h.outlineNode(fsForFolder(ctx, folder), folder, tree, opts)
+		root.Type = OutlineTypeFolder
+		outline.Folders = append(outline.Folders, root)
+	}
+	if requestDone(c) {
+		return
+	}
+
+	if format == OutlineFormatJSON {
+		writeJSON(c, http.StatusOK, outline)
+		return
+	}
+	var doc opmlDocument
+	doc.Version = "2.0"
+	doc.Head.Title = outline.Title
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+	for _, folder := range outline.Folders {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlNode(folder))
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		writeError(c, CodeInternal, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/x-opml; charset=utf-8", append([]byte(xml.Header), append(out, '\n')...))
+}
+
+// outlineNode converts the tree node of folder, read through fs, and the nodes below it
+func (h *ExportHandler) outlineNode(fs mfs.FileSystem, folder config.Folder, node *TreeNode,
+	opts outlineOptions) *OutlineNode {
+	out := &OutlineNode{Name: node.Name, Type: OutlineTypeDirectory, Path: node.Path}
+	if node.Type == "file" {
+		out.Type = OutlineTypeFile
+		out.URL = opts.base + node.Path
+		if opts.titles {
+			out.Title = h.tree.titles.get(fs, strings.TrimPrefix(node.Path, folder.Alias+"/"), node)
+		}
+		return out
+	}
+	for _, child := range node.Children {
+		if child.Type == "file" && !opts.files {
+			continue
+		}
+		out.Children = append(out.Children, h.outlineNode(fs, folder, child, opts))
+	}
+	return out
+}
+
+// opmlNode converts an outline node; files become links titled by their title, or else their name
+func opmlNode(node *OutlineNode) opmlOutline {
+	out := opmlOutline{Text: node.Name}
+	if node.Type == OutlineTypeFile {
+		out.Type, out.URL = "link", node.URL
+		if node.Title != "" {
+			out.Text = node.Title
+		}
+	}
+	for _, child := range node.Children {
+		out.Children = append(out.Children, opmlNode(child))
+	}
+	return out
+}
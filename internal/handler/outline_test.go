@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetOutline(t *testing.T) {
+	dir, notes := t.TempDir(), t.TempDir()
+	writeDoc(t, filepath.Join(dir, "README.md"), "# Home & away\n")
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"), "---\ntitle: x\n---\n# Intro\n")
+	writeDoc(t, filepath.Join(dir, "drafts", "wip.md"), "# WIP\n")
+	writeDoc(t, filepath.Join(notes, "todo.md"), "# Todo\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: dir, Alias: "docs", Exclude: []string{"drafts/**"}},
+		{ID: "notes", Path: notes, Alias: "notes"},
+	}
+	cfg.Branding.Title = "Handbook"
+
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(cfg, NewTreeHandler(cfg), NewFileHandler(cfg))
+	r := gin.New()
+	r.GET("/export/outline", h.GetOutline)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://docs.test/export/outline?"+query, nil))
+		return w
+	}
+	outline := func(query string) Outline {
+		t.Helper()
+		w := get(query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, w.Code, w.Body)
+		}
+		var o Outline
+		if err := json.Unmarshal(w.Body.Bytes(), &o); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	o := outline("")
+	if o.Title != "Handbook" || len(o.Folders) != 2 || o.Folders[1].Name != "notes" {
+		t.Fatalf("unexpected outline %+v", o)
+	}
+	docs := o.Folders[0]
+	if docs.Type != OutlineTypeFolder || len(docs.Children) != 2 {
+		t.Fatalf("expected guide and README without the excluded drafts, got %+v", docs)
+	}
+	guide, readme := docs.Children[0], docs.Children[1]
+	if guide.Type != OutlineTypeDirectory || guide.Children[0].Title != "Intro" {
+		t.Errorf("unexpected directory %+v", guide)
+	}
+	if readme.Type != OutlineTypeFile || readme.Title != "Home & away" ||
+		readme.URL != "http://docs.test/#docs/README.md" {
+		t.Errorf("unexpected file %+v", readme)
+	}
+	if strings.Contains(get("").Body.String(), "folderId") {
+		t.Error("expected no internal fields in the outline")
+	}
+
+	o = outline("folderId=docs&titles=false")
+	if len(o.Folders) != 1 || o.Folders[0].Children[1].Title != "" || o.Folders[0].Children[1].URL == "" {
+		t.Errorf("expected one folder without titles, got %+v", o.Folders)
+	}
+	o = outline("folderId=docs&files=false")
+	if children := o.Folders[0].Children; len(children) != 1 || children[0].Name != "guide" ||
+		len(children[0].Children) != 0 {
+		t.Errorf("expected only the guide directory, got %+v", children)
+	}
+
+	w := get("folderId=docs&format=opml")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/x-opml") {
+		t.Fatalf("expected OPML, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var doc opmlDocument
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != "2.0" || doc.Head.Title != "Handbook" || len(doc.Body.Outlines) != 1 {
+		t.Fatalf("unexpected OPML %s", w.Body)
+	}
+	file := doc.Body.Outlines[0].Children[1]
+	if file.Text != "Home & away" || file.Type != "link" || file.URL != "http://docs.test/#docs/README.md" {
+		t.Errorf("unexpected OPML file %+v", file)
+	}
+
+	if w := get("folderId=missing"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown folder, got %d", w.Code)
+	}
+	if w := get("format=csv"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of the pandoc section of the configuration
+const (
+	defaultPandocPath          = "pandoc"
+	defaultPandocTimeout       = time.Minute
+	defaultPandocMaxOutputSize = 50 << 20
+)
+
+// defaultPandocFormats are the formats offered when pandoc.formats is unset
+var defaultPandocFormats = []string{"docx", "odt"}
+
+// pandocInstallHint tells the user how to get pandoc when it is missing
+const pandocInstallHint = "pandoc is not available: install it (https://pandoc.org/installing.html) " +
+	"or set pandoc.path in the configuration"
+
+// GetPandoc converts the document at path with pandoc into the format ?to= names, one of
+// pandoc.formats, and returns it as an attachment. The markdown goes to pandoc as GFM without
+// its front matter; relative images are copied from the folder into a temporary directory and
+// referenced there, so git-backed folders work too. Conversions are capped by pandoc.timeout
+// and pandoc.max_output_size.
+func (h *ExportHandler) GetPandoc(c *gin.Context) {
+	filePath := c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	conf := h.cfg.Pandoc
+	formats := conf.Formats
+	if len(formats) == 0 {
+		formats = defaultPandocFormats
+	}
+	to := c.Query("to")
+	if !slices.Contains(formats, to) {
+		writeError(c, CodeInvalidRequest,
+			fmt.Sprintf("unsupported format %q (expected one of %s)", to, strings.Join(formats, ", ")))
+		return
+	}
+	binary, err := exec.LookPath(cmp.Or(conf.Path, defaultPandocPath))
+	if err != nil {
+		writeError(c, CodePandocUnavailable, pandocInstallHint)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.files.CheckFile(ctx, filePath); err != nil {
+		if errors.Is(err, ErrNotMarkdown) {
+			writeError(c, CodeNotMarkdown, err.Error())
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	fs, relativePath, _, err := h.files.resolvePath(ctx, filePath)
+	var content []byte
+	if err == nil {
+		content, err = fs.ReadFile(relativePath)
+	}
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	_, body, _ := markdown.SplitFrontMatter(content)
+
+	dir, err := os.MkdirTemp("", "markhub-pandoc-")
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to create a temporary directory: %v", err))
+		return
+	}
+	defer os.RemoveAll(dir)
+	body, err = pandocImages(body, fs, relativePath, dir)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to copy images: %v", err))
+		return
+	}
+
+	out, err := runPandoc(ctx, binary, to, dir, body, cmp.Or(conf.Timeout, defaultPandocTimeout),
+		cmp.Or(conf.MaxOutputSize, defaultPandocMaxOutputSize))
+	if requestDone(c) {
+		return
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(c, CodeUpstreamFailed, "pandoc timed out")
+		return
+	case errors.Is(err, errPandocOutputTooLarge):
+		writeError(c, CodeTooLarge, err.Error())
+		return
+	case err != nil:
+		writeError(c, CodeUpstreamFailed, err.Error())
+		return
+	}
+
+	format := config.PandocFormats[to]
+	name := strings.TrimSuffix(path.Base(relativePath), path.Ext(relativePath)) + format.Extension
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Data(http.StatusOK, format.ContentType, out)
+}
+
+// errPandocOutputTooLarge is returned by runPandoc for output over the size cap
+var errPandocOutputTooLarge = errors.New("converted document too large")
+
+// runPandoc converts the GFM source with binary, run in dir, into format to and returns the
+// result. The conversion is killed after timeout or once its output passes maxSize bytes.
+func runPandoc(ctx context.Context, binary, to, dir string, source []byte, timeout time.Duration,
+	maxSize int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, binary, "--from", "gfm", "--to", to, "--output", "-")
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(source)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start pandoc: %w", err)
+	}
+	out, readErr := io.ReadAll(io.LimitReader(stdout, maxSize+1))
+	if int64(len(out)) > maxSize {
+		cancel()
+		_ = cmd.Wait()
+		return nil, fmt.Errorf("%w (more than %d MiB)", errPandocOutputTooLarge, maxSize>>20)
+	}
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		return nil, fmt.Errorf("pandoc failed: %v %s", err, msg)
+	}
+	return out, nil
+}
+
+// pandocImages copies the images relative destinations in source point to, for the document at
+// docPath, from fs to the same paths under dir, and returns source referencing the copies by
+// their absolute paths. Images outside the folder or missing are left alone.
+func pandocImages(source []byte, fs mfs.FileSystem, docPath, dir string) ([]byte, error) {
+	copied := map[string]string{}
+	var copyErr error
+	source, _ = markdown.RewriteLinks(source, func(dest string) (string, bool) {
+		rel, ok := markdown.RelativeTarget(dest)
+		if !ok || copyErr != nil {
+			return "", false
+		}
+		if _, image := inlineImageTypes[strings.ToLower(path.Ext(rel))]; !image {
+			return "", false
+		}
+		target, inside := linkTarget(docPath, rel)
+		if !inside || target == "" {
+			return "", false
+		}
+		if abs, ok := copied[target]; ok {
+			return abs, true
+		}
+		data, err := fs.ReadFile(target)
+		if err != nil {
+			return "", false
+		}
+		abs := filepath.Join(dir, filepath.FromSlash(target))
+		if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+			copyErr = err
+			return "", false
+		}
+		if err := os.WriteFile(abs, data, 0644); err != nil {
+			copyErr = err
+			return "", false
+		}
+		copied[target] = abs
+		return abs, true
+	})
+	return source, copyErr
+}
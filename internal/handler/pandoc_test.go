@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// writePandocStub writes a shell script standing in for pandoc and returns its path
+func writePandocStub(t *testing.T, script string) string {
+	t.Helper()
+	stub := filepath.Join(t.TempDir(), "pandoc")
+	if err := os.WriteFile(stub, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+func TestGetPandoc(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the pandoc stub is a shell script")
+	}
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide", "setup.md"),
+		"---\ntitle: Setup\n---\n# Setup\n\n![Flow](img/flow.png) and [home](../README.md)\n")
+	writeDoc(t, filepath.Join(dir, "guide", "img", "flow.png"), "PNGDATA")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(cfg, NewTreeHandler(cfg), NewFileHandler(cfg))
+	r := gin.New()
+	r.GET("/api/v1/export/pandoc/*path", h.GetPandoc)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// The stub echoes its arguments and input, then the images the input references
+	cfg.Pandoc.Path = writePandocStub(t, "echo \"$@\"\ntee input.md\n"+
+		"sed -n 's/.*](\\(\\/[^)]*\\)).*/\\1/p' input.md | xargs cat\n")
+	w := get("/api/v1/export/pandoc/docs/guide/setup.md?to=docx")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != config.PandocFormats["docx"].ContentType {
+		t.Errorf("unexpected Content-Type %q", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != "attachment; filename=setup.docx" {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+	out := w.Body.String()
+	for _, want := range []string{"--from gfm --to docx --output -", "# Setup", "[home](../README.md)", "PNGDATA"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "title:") || strings.Contains(out, "](img/flow.png)") {
+		t.Errorf("expected no front matter and an absolute image path:\n%s", out)
+	}
+
+	if w := get("/api/v1/export/pandoc/docs/guide/setup.md?to=pdf"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a format not configured, got %d", w.Code)
+	}
+	if w := get("/api/v1/export/pandoc/docs/guide/missing.md?to=docx"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing document, got %d", w.Code)
+	}
+
+	cfg.Pandoc.MaxOutputSize = 10
+	if w := get("/api/v1/export/pandoc/docs/guide/setup.md?to=docx"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for output over the cap, got %d", w.Code)
+	}
+	cfg.Pandoc.MaxOutputSize = 0
+
+	cfg.Pandoc.Path = writePandocStub(t, "echo 'unknown writer' >&2\nexit 1\n")
+	w = get("/api/v1/export/pandoc/docs/guide/setup.md?to=odt")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "unknown writer") {
+		t.Errorf("expected 502 with pandoc's error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.Pandoc.Path = writePandocStub(t, "exec sleep 5\n")
+	cfg.Pandoc.Timeout = 100 * time.Millisecond
+	w = get("/api/v1/export/pandoc/docs/guide/setup.md?to=docx")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "timed out") {
+		t.Errorf("expected 502 for a conversion over the timeout, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.Pandoc.Path = filepath.Join(t.TempDir(), "pandoc")
+	w = get("/api/v1/export/pandoc/docs/guide/setup.md?to=docx")
+	if w.Code != http.StatusNotImplemented || !strings.Contains(w.Body.String(), "pandoc.org") {
+		t.Errorf("expected 501 with install guidance, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"log"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content encodings offered for precompressed assets, in order of preference
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// brotliLevel trades a little ratio for startup time; level 11 takes seconds on mermaid.min.js
+const brotliLevel = 6
+
+// compressibleExts lists asset types worth compressing; images and fonts are already compressed
+var compressibleExts = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+	".map":  true,
+}
+
+// encodedAsset holds the compressed variants of one embedded file
+type encodedAsset struct {
+	contentType string
+	variants    map[string][]byte
+}
+
+// precompressAssets compresses every compressible file in assets once, so serving costs no CPU.
+// Variants that are not smaller than the original are dropped.
+func precompressAssets(assets fs.FS) map[string]*encodedAsset {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = make(map[string]*encodedAsset)
+	)
+
+	err := fs.WalkDir(assets, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !compressibleExts[path.Ext(name)] {
+			return err
+		}
+		data, err := fs.ReadFile(assets, name)
+		if err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			asset := &encodedAsset{
+				contentType: mime.TypeByExtension(path.Ext(name)),
+				variants:    make(map[string][]byte),
+			}
+			if gz := compressGzip(data); len(gz) < len(data) {
+				asset.variants[encodingGzip] = gz
+			}
+			if br := compressBrotli(data); len(br) < len(data) {
+				asset.variants[encodingBrotli] = br
+			}
+			if len(asset.variants) == 0 {
+				return
+			}
+			mu.Lock()
+			result[name] = asset
+			mu.Unlock()
+		}()
+		return nil
+	})
+	wg.Wait()
+	if err != nil {
+		log.Printf("Warning: failed to precompress web assets: %v", err)
+	}
+	return result
+}
+
+func compressGzip(data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func compressBrotli(data []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriterLevel(&buf, brotliLevel)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// negotiateEncoding picks the preferred encoding the client accepts from the available variants.
+// It returns "" when identity should be served.
+func negotiateEncoding(acceptEncoding string, variants map[string][]byte) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	accepted := make(map[string]bool)
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if qualityZero(params) {
+			accepted[name] = false
+			continue
+		}
+		if name == "*" {
+			wildcard = true
+			continue
+		}
+		accepted[name] = true
+	}
+
+	for _, enc := range []string{encodingBrotli, encodingGzip} {
+		if _, ok := variants[enc]; !ok {
+			continue
+		}
+		ok, listed := accepted[enc]
+		if ok || (!listed && wildcard) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// qualityZero reports whether Accept-Encoding parameters carry q=0
+func qualityZero(params string) bool {
+	for _, p := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return err == nil && q == 0
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CageChen/markhub/internal/markdown"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gin-gonic/gin"
+)
+
+// printCodeStyle is the chroma style of code blocks on print pages: light, to spare toner
+const printCodeStyle = "github"
+
+var (
+	// srcRe matches the src attributes of rendered markdown; group 1 is the value
+	srcRe = regexp.MustCompile(`src="([^"]*)"`)
+	// detailsRe matches the opening tags of details blocks
+	detailsRe = regexp.MustCompile(`<details\b[^>]*>`)
+	// externalLinkRe matches links to absolute http(s) URLs; group 1 is the URL and group 2 the text
+	externalLinkRe = regexp.MustCompile(`(?s)<a\s[^>]*?href="(https?://[^"]*)"[^>]*>(.*?)</a>`)
+)
+
+// printStyles returns the stylesheet of print pages, generated once
+var printStyles = sync.OnceValue(func() template.CSS {
+	var buf bytes.Buffer
+	buf.WriteString(printCSS)
+	_ = chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, styles.Get(printCodeStyle))
+	return template.CSS(buf.String())
+})
+
+const printCSS = `
+@page { margin: 2cm 1.8cm; }
+body { margin: 0 auto; max-width: 48em; padding: 1em; color: #000; background: #fff;
+  font: 11pt/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+h1, h2 { break-before: page; break-after: avoid; }
+.markdown-body > :first-child, .print-toc h2, .print-links h2 { break-before: auto; }
+h3, h4, h5, h6 { break-after: avoid; }
+pre, table, img, figure, blockquote { break-inside: avoid; }
+pre { padding: 0.8em; border: 1px solid #ddd; white-space: pre-wrap; overflow-wrap: anywhere; }
+code { font: 0.9em ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+img { max-width: 100%; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.3em 0.6em; }
+a { color: inherit; }
+sup.print-link-ref { font-size: 0.7em; }
+.print-toc { break-after: page; }
+.print-toc ol { list-style: none; padding-left: 1.2em; }
+.print-links { break-before: page; font-size: 0.85em; overflow-wrap: anywhere; }
+`
+
+var printPage = template.Must(template.New("print").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>{{.Styles}}</style>
+</head>
+<body>
+{{if .TOC}}<nav class="print-toc">
+<h1>{{.Title}}</h1>
+<h2>Contents</h2>
+<ol>
+{{range .TOC}}<li style="margin-left: {{.Indent}}em"><a href="#{{.Anchor}}">{{.Title}}</a></li>
+{{end}}</ol>
+</nav>
+{{end}}<main class="markdown-body">{{.HTML}}</main>
+{{if .Links}}<section class="print-links">
+<h2>Links</h2>
+<ol>
+{{range .Links}}<li>{{.}}</li>
+{{end}}</ol>
+</section>
+{{end}}</body>
+</html>
+`))
+
+// printPageData fills printPage
+type printPageData struct {
+	Title  string
+	Styles template.CSS
+	TOC    []printTOCItem
+	HTML   template.HTML
+	Links  []string
+}
+
+type printTOCItem struct {
+	markdown.TOCItem
+	Indent int
+}
+
+// GetPrint renders the document at path as a complete HTML page for printing: light code
+// blocks, page breaks before h1 and h2, details blocks expanded and the URLs of external links
+// listed as numbered footnotes. ?toc=1 puts a table of contents on the first page. Relative
+// images point at their raw URLs unless ?inline_images=1 embeds them.
+func (h *ExportHandler) GetPrint(c *gin.Context) {
+	filePath := c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	var opts RenderOptions
+	opts.InlineImages, _ = strconv.ParseBool(c.Query("inline_images"))
+	withTOC, _ := strconv.ParseBool(c.Query("toc"))
+	doc, err := h.files.parse(c.Request.Context(), filePath, opts)
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+
+	data := printPageData{Title: doc.result.Title, Styles: printStyles()}
+	if data.Title == "" {
+		data.Title = path.Base(filePath)
+	}
+	if withTOC && len(doc.result.TOC) > 0 {
+		top := doc.result.TOC[0].Level
+		for _, item := range doc.result.TOC {
+			top = min(top, item.Level)
+		}
+		for _, item := range doc.result.TOC {
+			data.TOC = append(data.TOC, printTOCItem{TOCItem: item, Indent: item.Level - top})
+		}
+	}
+	// The page is served from /print/..., so relative images are pointed at the raw route instead
+	raw := strings.TrimSuffix(c.FullPath(), "/print/*path") + "/raw/"
+	body := printImageSources(doc.result.HTML, raw+doc.folder.Alias, doc.relativePath)
+	body = detailsRe.ReplaceAllStringFunc(body, func(tag string) string {
+		if strings.Contains(tag, " open") {
+			return tag
+		}
+		return strings.TrimSuffix(tag, ">") + " open>"
+	})
+	body, data.Links = printLinkFootnotes(body)
+	data.HTML = template.HTML(body)
+
+	var buf bytes.Buffer
+	if err := printPage.Execute(&buf, data); err != nil {
+		writeError(c, CodeInternal, err.Error())
+		return
+	}
+	c.Header("ETag", doc.etag)
+	setCacheControl(c, h.cfg.Cache.HTMLControl())
+	c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// printImageSources points the relative src attributes of rendered HTML, for the document at
+// docPath, at the same files under base
+func printImageSources(body, base, docPath string) string {
+	return srcRe.ReplaceAllStringFunc(body, func(attr string) string {
+		dest, ok := markdown.RelativeTarget(html.UnescapeString(srcRe.FindStringSubmatch(attr)[1]))
+		if !ok {
+			return attr
+		}
+		rel, inside := linkTarget(docPath, dest)
+		if !inside || rel == "" {
+			return attr
+		}
+		return `src="` + html.EscapeString(base+(&url.URL{Path: "/" + rel}).EscapedPath()) + `"`
+	})
+}
+
+// printLinkFootnotes numbers the links of rendered HTML to absolute URLs, a URL keeping its
+// number, and returns the URLs in order. Links showing their URL as text are left alone.
+func printLinkFootnotes(body string) (string, []string) {
+	var links []string
+	numbers := map[string]int{}
+	body = externalLinkRe.ReplaceAllStringFunc(body, func(link string) string {
+		m := externalLinkRe.FindStringSubmatch(link)
+		href := html.UnescapeString(m[1])
+		if html.UnescapeString(m[2]) == href {
+			return link
+		}
+		n, ok := numbers[href]
+		if !ok {
+			links = append(links, href)
+			n = len(links)
+			numbers[href] = n
+		}
+		return link + `<sup class="print-link-ref">[` + strconv.Itoa(n) + `]</sup>`
+	})
+	return body, links
+}
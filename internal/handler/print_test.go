@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetPrint(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide", "setup.md"), "# Setup\n\n"+
+		"See [Go](https://go.dev/doc), [again](https://go.dev/doc), [home](../README.md) and <https://example.com>.\n\n"+
+		"![Diagram](img/flow.png)\n\n"+
+		"## Install\n\n<details><summary>More</summary>\n\nHidden\n\n</details>\n\n"+
+		"```go\nfunc main() {}\n```\n")
+	writeDoc(t, filepath.Join(dir, "guide", "img", "flow.png"), "\x89PNG\r\n\x1a\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	h := NewExportHandler(cfg, NewTreeHandler(cfg), NewFileHandler(cfg))
+	r := gin.New()
+	r.GET("/api/v1/print/*path", h.GetPrint)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/api/v1/print/docs/guide/setup.md")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		w.Header().Get("ETag") == "" {
+		t.Fatalf("expected an HTML page, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	page := w.Body.String()
+	for _, want := range []string{
+		"<title>Setup</title>",
+		"break-before: page",
+		// Light code highlighting
+		".chroma { background-color: #ffffff; }",
+		`src="/api/v1/raw/docs/guide/img/flow.png"`,
+		// One footnote per URL; links showing their URL need none
+		`Go</a><sup class="print-link-ref">[1]</sup>`,
+		`again</a><sup class="print-link-ref">[1]</sup>`,
+		"<li>https://go.dev/doc</li>",
+		"<details open>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %q in the page:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "<li>https://example.com</li>") || strings.Contains(page, "<nav") {
+		t.Errorf("expected no footnote for an autolink and no table of contents:\n%s", page)
+	}
+
+	page = get("/api/v1/print/docs/guide/setup.md?toc=1").Body.String()
+	if !strings.Contains(page, `<nav class="print-toc">`) || !strings.Contains(page, `href="#install"`) {
+		t.Errorf("expected a table of contents:\n%s", page)
+	}
+	if page := get("/api/v1/print/docs/guide/setup.md?inline_images=1").Body.String(); strings.Contains(page, "/raw/") {
+		t.Error("expected no raw URLs with inlined images")
+	}
+
+	for target, want := range map[string]int{
+		"/api/v1/print/docs/missing.md":       http.StatusNotFound,
+		"/api/v1/print/docs/guide":            http.StatusBadRequest,
+		"/api/v1/print/docs/../etc/passwd.md": http.StatusForbidden,
+	} {
+		if w := get(target); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CageChen/markhub/internal/fuzzy"
+	"github.com/CageChen/markhub/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+// quickOpenLimit is how many results the quick-open endpoint returns
+const quickOpenLimit = 15
+
+// What a QuickOpenResult matched, reported in QuickOpenResult.MatchType
+const (
+	QuickOpenMatchPath    = "path"
+	QuickOpenMatchTitle   = "title"
+	QuickOpenMatchContent = "content"
+)
+
+// Quick-open scores are a tier plus a score within it below quickOpenTierSize, so that a
+// filename hit always ranks above a title hit, and a title hit above a body-only hit
+const (
+	quickOpenTierSize = 1000
+	// The file's name starts with the query
+	quickOpenTierPrefix = 4 * quickOpenTierSize
+	// Every matched character of the path lies in the file's name
+	quickOpenTierBasename = 3 * quickOpenTierSize
+	quickOpenTierTitle    = 2 * quickOpenTierSize
+	// The matched characters are spread over the directories
+	quickOpenTierPath    = quickOpenTierSize
+	quickOpenTierContent = 0
+)
+
+// QuickOpenResult is a file matching a quick-open query by its path, its title or its text
+type QuickOpenResult struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	Title string `json:"title,omitempty"`
+	// MatchType is QuickOpenMatchPath, QuickOpenMatchTitle or QuickOpenMatchContent
+	MatchType string `json:"matchType"`
+	Score     int    `json:"score"`
+	// Positions are the byte offsets of the matched characters in Path for path matches, in
+	// Title for title matches; content matches have none
+	Positions []int `json:"positions,omitempty"`
+}
+
+// QuickOpen ranks the files matching q by their path, title and text in one list, for a command
+// palette. It only consults what is held in memory, the cached trees and the search indexes, so
+// title and content matches need search.index and cover the files indexed so far.
+func (h *SearchHandler) QuickOpen(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		writeError(c, CodeInvalidRequest, "q is required")
+		return
+	}
+	query := parseSearchQuery(q, h.cfg.Search.CJKNgram)
+
+	best := map[string]QuickOpenResult{}
+	keep := func(result QuickOpenResult) {
+		if prev, ok := best[result.Path]; !ok || result.Score > prev.Score {
+			best[result.Path] = result
+		}
+	}
+	ctx := c.Request.Context()
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		tree, err := h.tree.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		files := collectFiles(tree, nil)
+		var index *search.Index
+		if h.index != nil {
+			index = h.folderIndex(ctx, folder)
+		}
+		var contentHits map[string]bool
+		if index != nil {
+			contentHits = quickOpenContent(index, query)
+		}
+		for _, file := range files {
+			relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+			title, headings, indexed := h.quickOpenTitle(index, relPath, file)
+			if result, ok := quickOpenPath(q, file); ok {
+				result.Title = title
+				keep(result)
+			}
+			if result, ok := quickOpenTitleMatch(query, file, title); ok {
+				keep(result)
+			}
+			// A file changed since it was indexed may no longer hold the query
+			if indexed && contentHits[relPath] {
+				keep(quickOpenContentMatch(query, file, title, headings))
+			}
+		}
+	}
+
+	if requestDone(c) {
+		return
+	}
+
+	results := make([]QuickOpenResult, 0, len(best))
+	for _, result := range best {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if len(results) > quickOpenLimit {
+		results = results[:quickOpenLimit]
+	}
+	writeJSON(c, http.StatusOK, gin.H{
+		"query":   q,
+		"results": results,
+	})
+}
+
+// quickOpenTitle returns the title and headings of the file from the index, reporting true, when
+// its entry is current, or else the title quick find remembered for it
+func (h *SearchHandler) quickOpenTitle(
+	index *search.Index, relPath string, file *TreeNode,
+) (string, []search.Heading, bool) {
+	if index != nil {
+		if doc, ok := index.Lookup(relPath); ok && indexCurrent(doc, file) {
+			return doc.Title, doc.Headings, true
+		}
+	}
+	return h.tree.titles.peek(file), nil, false
+}
+
+// quickOpenPath fuzzy-matches q against the file's path, in the prefix, basename or path tier
+func quickOpenPath(q string, file *TreeNode) (QuickOpenResult, bool) {
+	score, positions, ok := fuzzy.Match(q, file.Path)
+	if !ok {
+		return QuickOpenResult{}, false
+	}
+	tier := quickOpenTierPath
+	base := strings.LastIndexByte(file.Path, '/') + 1
+	if strings.HasPrefix(strings.ToLower(path.Base(file.Path)), strings.ToLower(q)) {
+		tier = quickOpenTierPrefix
+	} else if positions[0] >= base {
+		tier = quickOpenTierBasename
+	}
+	return QuickOpenResult{
+		Path:      file.Path,
+		Name:      file.Name,
+		MatchType: QuickOpenMatchPath,
+		Score:     tier + min(max(score, 0), quickOpenTierSize-1),
+		Positions: positions,
+	}, true
+}
+
+// quickOpenTitleMatch matches the file's title when it contains every term of query; shorter
+// titles, closer to the query, score higher
+func quickOpenTitleMatch(query searchQuery, file *TreeNode, title string) (QuickOpenResult, bool) {
+	lower := strings.ToLower(title)
+	if title == "" || query.empty() || !query.matches(lower) {
+		return QuickOpenResult{}, false
+	}
+	var positions []int
+	for _, span := range keySpans([]byte(title), []byte(lower), query) {
+		for i := span.Start; i < span.End; {
+			positions = append(positions, i)
+			_, size := utf8.DecodeRuneInString(title[i:])
+			i += size
+		}
+	}
+	score := quickOpenTierSize - 1 - min(max(len(title)-len(query.text), 0), quickOpenTierSize-1)
+	return QuickOpenResult{
+		Path:      file.Path,
+		Name:      file.Name,
+		Title:     title,
+		MatchType: QuickOpenMatchTitle,
+		Score:     quickOpenTierTitle + score,
+		Positions: positions,
+	}, true
+}
+
+// quickOpenContent returns the documents of index whose text holds every term of query, and the
+// whole query, as far as the trigrams tell. Terms shorter than three bytes cannot be told, so a
+// query made only of them matches no text.
+func quickOpenContent(index *search.Index, query searchQuery) map[string]bool {
+	candidates, ok := termCandidates(index, query.required())
+	if !ok {
+		return nil
+	}
+	if whole, ok := index.Candidates(query.text); ok {
+		for doc := range candidates {
+			if !whole[doc] {
+				delete(candidates, doc)
+			}
+		}
+	}
+	return candidates
+}
+
+// quickOpenContentMatch scores a text match: documents with a heading holding every term first
+func quickOpenContentMatch(
+	query searchQuery, file *TreeNode, title string, headings []search.Heading,
+) QuickOpenResult {
+	score := 0
+	for _, heading := range headings {
+		if query.matches(strings.ToLower(heading.Text)) {
+			score = quickOpenTierSize / 2
+			break
+		}
+	}
+	return QuickOpenResult{
+		Path:      file.Path,
+		Name:      file.Name,
+		Title:     title,
+		MatchType: QuickOpenMatchContent,
+		Score:     quickOpenTierContent + score,
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func getQuickOpen(t *testing.T, r http.Handler, q string) []QuickOpenResult {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/quickopen?q="+q, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []QuickOpenResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Results
+}
+
+func TestQuickOpen(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guides", "deploy.md"), "# Shipping\n\nHow to deploy.\n")
+	writeDoc(t, filepath.Join(dir, "ops", "runbook.md"), "# Deploy runbook\n\nSteps.\n")
+	writeDoc(t, filepath.Join(dir, "deploy", "readme.md"), "# Readme\n\nNothing here.\n")
+	writeDoc(t, filepath.Join(dir, "misc", "notes.md"), "# Notes\n\nWe deploy on fridays.\n")
+	writeDoc(t, filepath.Join(dir, "misc", "other.md"), "# Other\n\nUnrelated.\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Search.Index = true
+	h := NewSearchHandler(cfg, NewTreeHandler(cfg))
+	h.index = newSearchIndexes(t.TempDir())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/quickopen", h.QuickOpen)
+
+	// Until the index is built only paths match
+	if results := getQuickOpen(t, r, "deploy"); len(results) != 2 {
+		t.Errorf("expected two path matches before indexing, got %+v", results)
+	}
+	waitIndexed(t, h)
+
+	results := getQuickOpen(t, r, "deploy")
+	want := []struct{ path, matchType string }{
+		{"docs/guides/deploy.md", QuickOpenMatchPath},
+		{"docs/ops/runbook.md", QuickOpenMatchTitle},
+		{"docs/deploy/readme.md", QuickOpenMatchPath},
+		{"docs/misc/notes.md", QuickOpenMatchContent},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), results)
+	}
+	for i, w := range want {
+		if results[i].Path != w.path || results[i].MatchType != w.matchType {
+			t.Errorf("result %d: expected %s by %s, got %+v", i, w.path, w.matchType, results[i])
+		}
+	}
+	if results[0].Title != "Shipping" || len(results[0].Positions) != 6 {
+		t.Errorf("expected the title and six path positions, got %+v", results[0])
+	}
+	if p := results[1].Positions; len(p) != 6 || p[0] != 0 || p[5] != 5 {
+		t.Errorf("expected title positions 0-5, got %v", p)
+	}
+	if results[3].Positions != nil {
+		t.Errorf("expected no positions on a content match, got %v", results[3].Positions)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/quickopen?q=", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without q, got %d", w.Code)
+	}
+}
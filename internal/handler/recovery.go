@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/CageChen/markhub/internal/crash"
+	"github.com/gin-gonic/gin"
+)
+
+// stackPanic carries a panic recovered on another goroutine together with the stack where it
+// happened, so re-panicking on the request goroutine does not lose it
+type stackPanic struct {
+	value any
+	stack []byte
+}
+
+// Recovery replaces gin.Recovery: a panicking handler is reported to the crash sink with its
+// request ID and the client gets a 500 internal_panic error. Mount it first: the ID set by
+// RequestIDMiddleware further down the chain is still readable while the panic unwinds.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// net/http aborts the connection silently for this sentinel
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+			stack := debug.Stack()
+			if sp, ok := v.(stackPanic); ok {
+				v, stack = sp.value, sp.stack
+			}
+			crash.Record("HTTP "+c.Request.Method+" "+c.Request.URL.Path, RequestID(c), v, stack)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			abortError(c, CodeInternalPanic, "internal server error")
+		}()
+		c.Next()
+	}
+}
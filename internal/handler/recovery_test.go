@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/crash"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecoveryReportsPanics(t *testing.T) {
+	prev := crash.Default()
+	sink := crash.New(filepath.Join(t.TempDir(), "crash.log"), 5)
+	crash.SetDefault(sink)
+	defer crash.SetDefault(prev)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Recovery(), RequestIDMiddleware())
+	r.GET("/panic", func(*gin.Context) { panic("boom") })
+	r.GET("/timed", TimeoutMiddleware(time.Second), func(*gin.Context) { panic("timed boom") })
+
+	for _, path := range []string{"/panic", "/timed"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(RequestIDHeader, "req"+strings.TrimPrefix(path, "/"))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("%s: expected 500, got %d", path, w.Code)
+		}
+		var body APIError
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != CodeInternalPanic || body.RequestID != req.Header.Get(RequestIDHeader) {
+			t.Errorf("%s: unexpected body %+v", path, body)
+		}
+	}
+
+	if sink.Count() != 2 {
+		t.Errorf("expected 2 panics counted, got %d", sink.Count())
+	}
+	reports, err := sink.Reports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 || reports[1].RequestID != "reqtimed" || reports[1].Value != "timed boom" {
+		t.Fatalf("unexpected crash log %+v", reports)
+	}
+	// The stack is the handler's, not the re-panic in TimeoutMiddleware
+	if !strings.Contains(reports[1].Stack, "TestRecoveryReportsPanics") {
+		t.Errorf("expected the handler frame in the stack, got:\n%s", reports[1].Stack)
+	}
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// allRefsWorkers bounds the folders GetAllRefs lists the refs of at once
+	allRefsWorkers = 4
+	// allRefsTimeout bounds the listing of one folder's refs
+	allRefsTimeout = 5 * time.Second
+)
+
+// FolderRefs are the branches and tags of the repository a folder is read from
+type FolderRefs struct {
+	FolderID string `json:"folderId"`
+	Alias    string `json:"alias"`
+	// GitRef is the folder's git_ref; folders without one are read from the working tree
+	GitRef string `json:"gitRef,omitempty"`
+	// Current is the ref the folder shows: its git_ref, or else the branch checked out
+	Current string `json:"current"`
+	mfs.Refs
+	// Error is set, and the lists empty, when the refs could not be listed in time
+	Error string `json:"error,omitempty"`
+}
+
+// GetAllRefs lists the branches, tags and current ref of every git-backed folder (with a git_ref or
+// in a git working tree) in one response, for switching refs across repositories. Folders are
+// listed concurrently; one that fails or takes too long carries an error instead of its refs.
+func (h *TreeHandler) GetAllRefs(c *gin.Context) {
+	ctx := c.Request.Context()
+	folders := h.cfg.FoldersSnapshot()
+	results := make([]*FolderRefs, len(folders))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(allRefsWorkers, len(folders)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = folderRefs(ctx, folders[i])
+			}
+		}()
+	}
+	for i := range folders {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if requestDone(c) {
+		return
+	}
+
+	refs := []*FolderRefs{}
+	for _, r := range results {
+		if r != nil {
+			refs = append(refs, r)
+		}
+	}
+	writeJSON(c, http.StatusOK, gin.H{"folders": refs})
+}
+
+// folderRefs lists the refs of folder's repository, or returns nil for a folder outside one
+func folderRefs(ctx context.Context, folder config.Folder) *FolderRefs {
+	ctx, cancel := context.WithTimeout(ctx, allRefsTimeout)
+	defer cancel()
+	if folder.GitRef == "" && !mfs.NewWorkTree(folder.Path).WithContext(ctx).IsRepo() && ctx.Err() == nil {
+		return nil
+	}
+	out := &FolderRefs{FolderID: folder.ID, Alias: folder.Alias, GitRef: folder.GitRef}
+	refs, err := mfs.NewGitFS(folder.Path, "HEAD").WithContext(ctx).Refs()
+	if err != nil {
+		out.Error = err.Error()
+		if ctx.Err() != nil {
+			out.Error = "timed out listing refs"
+		}
+		out.Refs = mfs.Refs{Branches: []string{}, Tags: []string{}}
+		return out
+	}
+	out.Refs, out.Current = refs, folder.GitRef
+	if out.Current == "" {
+		out.Current = refs.Head
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetAllRefs(t *testing.T) {
+	repo, plain := t.TempDir(), t.TempDir()
+	writeDoc(t, filepath.Join(repo, "docs", "README.md"), "# Home\n")
+	writeDoc(t, filepath.Join(plain, "notes.md"), "# Notes\n")
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "initial")
+	runGit(t, repo, "tag", "v1.0")
+	runGit(t, repo, "checkout", "-q", "-b", "feature")
+
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "work", Path: filepath.Join(repo, "docs"), Alias: "work"},
+		{ID: "notes", Path: plain, Alias: "notes"},
+		{ID: "release", Path: repo, Alias: "release", GitRef: "v1.0"},
+		{ID: "broken", Path: plain, Alias: "broken", GitRef: "main"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/all-refs", NewTreeHandler(cfg).GetAllRefs)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/all-refs", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Folders []FolderRefs `json:"folders"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The folder outside a repository is left out, and the others keep their order
+	if len(resp.Folders) != 3 {
+		t.Fatalf("expected three git-backed folders, got %+v", resp.Folders)
+	}
+	work, release, broken := resp.Folders[0], resp.Folders[1], resp.Folders[2]
+	if work.FolderID != "work" || work.Current != "feature" || work.GitRef != "" || len(work.Branches) != 2 ||
+		len(work.Tags) != 1 || work.Tags[0] != "v1.0" || work.Error != "" {
+		t.Errorf("unexpected working tree refs %+v", work)
+	}
+	if release.Current != "v1.0" || release.GitRef != "v1.0" || release.Head != "feature" {
+		t.Errorf("expected the git_ref as current ref, got %+v", release)
+	}
+	if broken.FolderID != "broken" || broken.Error == "" || broken.Branches == nil {
+		t.Errorf("expected an error for a git_ref folder outside a repository, got %+v", broken)
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder with image.Decode
+)
+
+// Bounds of image resizing (GET /assets/...?w=)
+const (
+	maxResizeWidth     = 4096
+	maxResizePixels    = 50_000_000 // of the source; larger images are served as they are
+	defaultJPEGQuality = 85
+)
+
+// svgAssetCSP keeps script in an SVG served from this origin from running
+const svgAssetCSP = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
+
+// variantTypes are the content types of the variants, by extension
+var variantTypes = map[string]string{"png": "image/png", "jpg": "image/jpeg"}
+
+// GetAsset serves an image of a folder: PNG, JPEG, GIF, WebP or SVG. ?w= scales PNG, JPEG, WebP
+// and still GIF images down to that width, keeping the aspect ratio, and ?q= sets the quality of
+// JPEG output (85 by default). Images no wider than ?w=, animated GIFs and SVGs are served as they
+// are. Variants are kept on disk by content and parameters; see variantCache.
+func (h *FileHandler) GetAsset(c *gin.Context) {
+	filePath := c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	width, quality := 0, 0
+	if v := c.Query("w"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxResizeWidth {
+			writeError(c, CodeInvalidRequest, fmt.Sprintf("w must be between 1 and %d", maxResizeWidth))
+			return
+		}
+		width = n
+	}
+	if v := c.Query("q"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(c, CodeInvalidRequest, "q must be between 1 and 100")
+			return
+		}
+		quality = n
+	}
+
+	fs, relativePath, _, err := h.resolvePath(c.Request.Context(), filePath)
+	var content []byte
+	if err == nil {
+		content, err = fs.ReadFile(relativePath)
+	}
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(c, CodeNotFound, "file not found")
+			return
+		}
+		code, msg := renderErrorCode(err)
+		writeError(c, code, msg)
+		return
+	}
+	mimeType := http.DetectContentType(content)
+	if strings.ToLower(path.Ext(relativePath)) == ".svg" {
+		mimeType = "image/svg+xml"
+		c.Header("Content-Security-Policy", svgAssetCSP)
+	} else if _, ok := assetTypes[mimeType]; !ok {
+		writeError(c, CodeUnsupportedType, "not a PNG, JPEG, GIF, WebP or SVG image")
+		return
+	}
+
+	setCacheControl(c, h.cfg.Cache.RawControl())
+	if width == 0 && quality == 0 || mimeType == "image/svg+xml" {
+		serveImage(c, mimeType, content)
+		return
+	}
+	key := variantKey(ETag(content), width, quality)
+	if data, ext, ok := h.variants.get(key); ok {
+		serveImage(c, variantTypes[ext], data)
+		return
+	}
+	data, ext, ok := resizeImage(content, width, quality)
+	if !ok {
+		serveImage(c, mimeType, content)
+		return
+	}
+	h.variants.put(key, ext, data)
+	serveImage(c, variantTypes[ext], data)
+}
+
+// serveImage answers with data, tagged by its content hash
+func serveImage(c *gin.Context, mimeType string, data []byte) {
+	c.Header("ETag", ETag(data))
+	c.Data(http.StatusOK, mimeType, data)
+}
+
+// variantKey names the variant of the image with the given ETag at width and quality
+func variantKey(etag string, width, quality int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s w=%d q=%d", etag, width, quality)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// resizeImage scales content down to width, when given and narrower than the image, with a
+// Catmull-Rom filter. JPEG images are encoded as JPEG at quality, others as PNG, or as JPEG when
+// they are opaque WebP photos. It returns false for images it leaves alone: animated GIFs, images
+// it cannot decode or larger than maxResizePixels, and those a width would enlarge.
+func resizeImage(content []byte, width, quality int) ([]byte, string, bool) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 || cfg.Width*cfg.Height > maxResizePixels {
+		return nil, "", false
+	}
+	if width >= cfg.Width || width == 0 && format != "jpeg" {
+		// No upscaling; quality alone only applies to JPEG
+		return nil, "", false
+	}
+	if format == "gif" {
+		if all, err := gif.DecodeAll(bytes.NewReader(content)); err != nil || len(all.Image) > 1 {
+			return nil, "", false
+		}
+	}
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", false
+	}
+	dst := src
+	if width > 0 {
+		height := max(1, (cfg.Height*width+cfg.Width/2)/cfg.Width)
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, src.Bounds(), draw.Src, nil)
+		dst = scaled
+	}
+
+	opaque, _ := src.(interface{ Opaque() bool })
+	var buf bytes.Buffer
+	if format == "jpeg" || format == "webp" && opaque != nil && opaque.Opaque() {
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", false
+		}
+		return buf.Bytes(), "jpg", true
+	}
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, "", false
+	}
+	return buf.Bytes(), "png", true
+}
+
+// PurgeAssetCache removes every resized image kept on disk and records cache.purge in the audit log
+func (h *FileHandler) PurgeAssetCache(c *gin.Context) {
+	count, size, err := h.variants.purge()
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to delete the resized images: %v", err))
+		return
+	}
+	recordAudit(h.audit, c, "cache.purge", gin.H{"variants": count, "bytes": size}, nil)
+	c.Status(http.StatusNoContent)
+}
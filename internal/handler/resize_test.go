@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// encodeTestImage returns a width x height image with a gradient, encoded by encode
+func encodeTestImage(t *testing.T, width, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := range width {
+		for y := range height {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetAsset(t *testing.T) {
+	dir := t.TempDir()
+	pngData := encodeTestImage(t, 200, 100, func(b *bytes.Buffer, img image.Image) error { return png.Encode(b, img) })
+	jpegData := encodeTestImage(t, 200, 100, func(b *bytes.Buffer, img image.Image) error {
+		return jpeg.Encode(b, img, nil)
+	})
+	frame := image.NewPaletted(image.Rect(0, 0, 200, 100), color.Palette{color.Black, color.White})
+	var animated bytes.Buffer
+	err := gif.EncodeAll(&animated, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="100"></svg>`
+	for name, data := range map[string][]byte{
+		"shot.png": pngData, "photo.jpg": jpegData, "spin.gif": animated.Bytes(), "logo.svg": []byte(svg),
+		"guide.md": []byte("# Guide\n"),
+	} {
+		writeDoc(t, filepath.Join(dir, "assets", name), string(data))
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	h := NewFileHandler(cfg)
+	h.variants = newVariantCache(filepath.Join(t.TempDir(), "variants"), 0)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/assets/*path", h.GetAsset)
+	r.DELETE("/cache/assets", h.PurgeAssetCache)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	size := func(w *httptest.ResponseRecorder) image.Point {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("undecodable response %d %q: %v", w.Code, w.Body.String(), err)
+		}
+		return image.Pt(cfg.Width, cfg.Height)
+	}
+
+	w := get("/assets/docs/assets/shot.png?w=50")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || size(w) != image.Pt(50, 25) {
+		t.Fatalf("unexpected resized PNG %d %s %v", w.Code, w.Header().Get("Content-Type"), size(w))
+	}
+	w = get("/assets/docs/assets/photo.jpg?w=100&q=50")
+	if w.Header().Get("Content-Type") != "image/jpeg" || size(w) != image.Pt(100, 50) {
+		t.Errorf("unexpected resized JPEG %s %v", w.Header().Get("Content-Type"), size(w))
+	}
+	// A second request is served from the cache
+	if entries, _ := os.ReadDir(h.variants.dir); len(entries) != 2 {
+		t.Fatalf("expected two cached variants, got %d", len(entries))
+	}
+	again := get("/assets/docs/assets/shot.png?w=50")
+	if again.Header().Get("ETag") != get("/assets/docs/assets/shot.png?w=50").Header().Get("ETag") {
+		t.Error("expected the cached variant to be served")
+	}
+
+	// Upscaling, animated GIFs and SVGs return the original
+	for _, tt := range []struct {
+		target string
+		want   []byte
+	}{
+		{"/assets/docs/assets/shot.png?w=400", pngData},
+		{"/assets/docs/assets/shot.png", pngData},
+		{"/assets/docs/assets/spin.gif?w=50", animated.Bytes()},
+		{"/assets/docs/assets/logo.svg?w=50", []byte(svg)},
+	} {
+		if w := get(tt.target); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), tt.want) {
+			t.Errorf("%s: expected the original, got %d", tt.target, w.Code)
+		}
+	}
+	if csp := get("/assets/docs/assets/logo.svg").Header().Get("Content-Security-Policy"); csp != svgAssetCSP {
+		t.Errorf("expected a sandboxing CSP on SVG, got %q", csp)
+	}
+
+	for target, want := range map[string]int{
+		"/assets/docs/assets/shot.png?w=0":     http.StatusBadRequest,
+		"/assets/docs/assets/shot.png?w=5000":  http.StatusBadRequest,
+		"/assets/docs/assets/photo.jpg?q=101":  http.StatusBadRequest,
+		"/assets/docs/assets/guide.md?w=50":    http.StatusUnsupportedMediaType,
+		"/assets/docs/assets/missing.png?w=50": http.StatusNotFound,
+	} {
+		if w := get(target); w.Code != want {
+			t.Errorf("%s: expected %d, got %d", target, want, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/cache/assets", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if _, err := os.Stat(h.variants.dir); !os.IsNotExist(err) {
+		t.Errorf("expected the variants removed, got %v", err)
+	}
+}
+
+func TestVariantCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	vc := newVariantCache(dir, 10)
+	vc.put("a", "png", []byte("aaaa"))
+	vc.put("b", "png", []byte("bbbb"))
+	if _, _, ok := vc.get("a"); !ok {
+		t.Fatal("expected a cached")
+	}
+	// b is now the least recently used
+	vc.put("c", "jpg", []byte("cccc"))
+	if _, _, ok := vc.get("b"); ok {
+		t.Error("expected b evicted")
+	}
+	if data, ext, ok := vc.get("c"); !ok || ext != "jpg" || string(data) != "cccc" {
+		t.Errorf("unexpected entry c %q %q %v", data, ext, ok)
+	}
+	vc.put("big", "png", []byte("more than ten bytes"))
+	if _, _, ok := vc.get("big"); ok {
+		t.Error("expected a variant larger than the cache not to be kept")
+	}
+
+	// A new cache finds the variants on disk
+	reloaded := newVariantCache(dir, 10)
+	if _, _, ok := reloaded.get("a"); !ok {
+		t.Error("expected a found after a restart")
+	}
+	if count, size, err := reloaded.purge(); err != nil || count != 2 || size != 8 {
+		t.Errorf("unexpected purge %d %d %v", count, size, err)
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// humanizeSuffix names the companion of a timestamp field added for ?humanize=1
+const humanizeSuffix = "Relative"
+
+// writeJSON answers with v as JSON. Every handler responds through it, so that with ?humanize=1
+// each timestamp of any response gets a companion field, modTime a modTimeRelative, describing
+// it relative to now ("3 days ago").
+func writeJSON(c *gin.Context, status int, v any) {
+	if humanize, _ := strconv.ParseBool(c.Query("humanize")); !humanize {
+		c.JSON(status, v)
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.JSON(status, v)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		c.JSON(status, v)
+		return
+	}
+	humanizeTimes(doc, time.Now())
+	c.JSON(status, doc)
+}
+
+// humanizeTimes adds the humanized companion of every timestamp in the decoded JSON doc: string
+// values in the UTC form timestamp.Time encodes
+func humanizeTimes(doc any, now time.Time) {
+	switch v := doc.(type) {
+	case map[string]any:
+		companions := map[string]string{}
+		for key, value := range v {
+			s, ok := value.(string)
+			if !ok {
+				humanizeTimes(value, now)
+				continue
+			}
+			if !strings.HasSuffix(s, "Z") {
+				continue
+			}
+			if t, err := timestamp.Parse(s); err == nil {
+				companions[key+humanizeSuffix] = timestamp.Humanize(t, now)
+			}
+		}
+		for key, value := range companions {
+			if _, taken := v[key]; !taken {
+				v[key] = value
+			}
+		}
+	case []any:
+		for _, value := range v {
+			humanizeTimes(value, now)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+func TestWriteJSON(t *testing.T) {
+	type item struct {
+		Name    string          `json:"name"`
+		ModTime timestamp.Time  `json:"modTime"`
+		Seen    *timestamp.Time `json:"seen,omitempty"`
+	}
+	now := time.Now()
+	body := gin.H{
+		"items": []item{
+			{Name: "a", ModTime: timestamp.New(now.Add(-3 * 24 * time.Hour))},
+			{Name: "2026-01-01T00:00:00Z"},
+		},
+		"builtAt":         timestamp.New(now.Add(-2 * time.Hour)),
+		"builtAtRelative": "kept",
+		"count":           3,
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { writeJSON(c, http.StatusOK, body) })
+	get := func(target string) map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		var got map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	plain := get("/")
+	items := plain["items"].([]any)
+	if _, ok := items[0].(map[string]any)["modTimeRelative"]; ok {
+		t.Errorf("expected no humanized fields without ?humanize=1: %v", plain)
+	}
+	if items[1].(map[string]any)["modTime"] != nil {
+		t.Errorf("expected null for a zero time, got %v", items[1])
+	}
+
+	humanized := get("/?humanize=1")
+	items = humanized["items"].([]any)
+	first, second := items[0].(map[string]any), items[1].(map[string]any)
+	if first["modTimeRelative"] != "3 days ago" || first["name"] != "a" {
+		t.Errorf("unexpected first item %v", first)
+	}
+	if _, ok := second["modTimeRelative"]; ok {
+		t.Errorf("expected no companion for a null time, got %v", second)
+	}
+	// A field of the response keeps its name, and only timestamps get companions
+	if humanized["builtAtRelative"] != "kept" || humanized["count"] != 3.0 || len(humanized) != 4 {
+		t.Errorf("unexpected response %v", humanized)
+	}
+}
+
+// TestTimestampContract pins how documents' modification times are serialized
+func TestTimestampContract(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	mtime := time.Date(2026, 3, 1, 13, 4, 5, 500_000_000, time.FixedZone("CET", 3600))
+	if err := os.Chtimes(filepath.Join(dir, "guide.md"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/files/*path", NewFileHandler(cfg).GetFile)
+	r.GET("/tree", NewTreeHandler(cfg).GetTree)
+	for target, want := range map[string]string{
+		"/files/docs/guide.md":            `"modTime":"2026-03-01T12:04:05.5Z"`,
+		"/tree":                           `"modTime":"2026-03-01T12:04:05.5Z"`,
+		"/files/docs/guide.md?humanize=1": `"modTimeRelative":"[^"]+ ago"`,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if !regexp.MustCompile(want).MatchString(w.Body.String()) {
+			t.Errorf("%s: expected %s in %s", target, want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/CageChen/markhub/internal/search"
+	"github.com/gin-gonic/gin"
+)
+
+// Fallbacks used when the search config leaves a limit unset
+const (
+	defaultSearchMaxResults = 100
+	defaultSearchTimeBudget = 2 * time.Second
+	defaultSearchWorkers    = 8
+	searchSnippetRadius     = 60
+)
+
+// Search scopes, chosen with ?scope=
+const (
+	SearchScopeContent  = "content"  // the document's text (default)
+	SearchScopeHeadings = "headings" // each heading, linking to its anchor
+	SearchScopeTitle    = "title"    // the document's title, its first heading
+	SearchScopeAll      = "all"      // the title, the headings and the text
+)
+
+// What a SearchResult matched, reported in SearchResult.Match
+const (
+	SearchMatchContent = "content"
+	SearchMatchHeading = "heading"
+	SearchMatchTitle   = "title"
+)
+
+// SearchResult is a single match: a document whose text, title or heading contains the query.
+// A document may yield several heading results.
+type SearchResult struct {
+	Path    string `json:"path"`
+	Title   string `json:"title"`
+	Line    int    `json:"line"`
+	Snippet string `json:"snippet"`
+	// Highlights are the byte ranges of Snippet matching the query's terms and phrases
+	Highlights []TextRange `json:"highlights,omitempty"`
+	Matches    int         `json:"matches"`
+	// Match is SearchMatchContent, SearchMatchHeading or SearchMatchTitle
+	Match string `json:"match"`
+	// Heading, Level and Anchor are set on heading matches, whose Line is 0
+	Heading string `json:"heading,omitempty"`
+	Level   int    `json:"level,omitempty"`
+	Anchor  string `json:"anchor,omitempty"`
+	// Link is Path, followed by #Anchor for heading matches
+	Link string `json:"link"`
+	// Score ranks the results: title and heading matches score higher for exact matches and
+	// higher-level headings, text matches by BM25
+	Score float64 `json:"score,omitempty"`
+
+	// freqs and length are what the score of a text match is computed from
+	freqs  []float64
+	length int
+}
+
+// SearchResponse is the response for a search request
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Scope   string         `json:"scope"`
+	Results []SearchResult `json:"results"`
+	// Total counts the results found, of which Results is the page starting at Offset
+	Total     int   `json:"total"`
+	Offset    int   `json:"offset"`
+	Truncated bool  `json:"truncated"`
+	TookMs    int64 `json:"tookMs"`
+	// Source is SearchSourceIndex or SearchSourceScan
+	Source string `json:"source"`
+}
+
+// searchTarget is a file queued for scanning
+type searchTarget struct {
+	fs      mfs.FileSystem
+	relPath string
+	path    string
+	// doc is the file's current index entry, whose title and headings spare reading the file
+	doc *search.Doc
+	// skipContent is set when the index rules out a match in the file's text
+	skipContent bool
+}
+
+// SearchHandler handles full-text search requests
+type SearchHandler struct {
+	cfg   *config.Config
+	tree  *TreeHandler
+	index *searchIndexes // nil unless search.index is set
+	// outliner extracts headings with the anchors the renderer gives them
+	outliner *markdown.Parser
+}
+
+// NewSearchHandler creates a new search handler
+func NewSearchHandler(cfg *config.Config, tree *TreeHandler) *SearchHandler {
+	h := &SearchHandler{
+		cfg:      cfg,
+		tree:     tree,
+		outliner: markdown.New(markdown.Options{Normalize: cfg.Render.NormalizeWhitespace}),
+	}
+	if cfg.Search.Index {
+		h.index = newSearchIndexes(config.GetSearchIndexDir())
+		if tree != nil {
+			tree.onExcludeChange(func() { go h.pruneIndexes() })
+		}
+	}
+	return h
+}
+
+// limits returns the effective result cap, time budget and worker count
+func (h *SearchHandler) limits() (int, time.Duration, int) {
+	maxResults := h.cfg.Search.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSearchMaxResults
+	}
+	budget := h.cfg.Search.TimeBudget
+	if budget <= 0 {
+		budget = defaultSearchTimeBudget
+	}
+	workers := h.cfg.Search.Workers
+	if workers <= 0 {
+		workers = defaultSearchWorkers
+	}
+	return maxResults, budget, workers
+}
+
+// Search scans all visible markdown files for the terms of a case-insensitive query, in their
+// text, titles or headings as ?scope= asks, and ranks the matches. ?tags= keeps the files carrying
+// all of the given tags, ?any_tags= those carrying at least one. Results are paged with ?offset=
+// and ?limit=, up to the result cap; scanning stops when the time budget elapses, in which case
+// the response is marked truncated, as it is when matches remain past the page.
+func (h *SearchHandler) Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	query := parseSearchQuery(q, h.cfg.Search.CJKNgram)
+	if query.empty() {
+		writeError(c, CodeInvalidRequest, "q is required")
+		return
+	}
+	scope := c.DefaultQuery("scope", SearchScopeContent)
+	switch scope {
+	case SearchScopeContent, SearchScopeHeadings, SearchScopeTitle, SearchScopeAll:
+	default:
+		writeError(c, CodeInvalidRequest, "scope must be content, headings, title or all")
+		return
+	}
+	tags := parseTagFilter(c.Query("tags"), c.Query("any_tags"))
+
+	maxResults, budget, workers := h.limits()
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit < maxResults {
+		maxResults = limit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		writeError(c, CodeInvalidRequest, "offset must be a non-negative integer")
+		return
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), budget)
+	defer cancel()
+
+	stats := newCorpusStats()
+	targets, source := h.targets(ctx, query, scope, tags)
+	results, truncated := h.scan(ctx, targets, query, scope, stats, workers)
+	// The search budget yields partial results; an expired request deadline or a gone client does not
+	if requestDone(c) {
+		return
+	}
+
+	rankResults(results, stats, query)
+	total := len(results)
+	results = results[min(offset, total):min(offset+maxResults, total)]
+
+	writeJSON(c, http.StatusOK, SearchResponse{
+		Query:     q,
+		Scope:     scope,
+		Results:   results,
+		Total:     total,
+		Offset:    offset,
+		Truncated: truncated || offset+maxResults < total,
+		TookMs:    time.Since(start).Milliseconds(),
+		Source:    source,
+	})
+}
+
+// targets lists the files the tree would show, across all folders, that may match query in scope.
+// Folders with a search index skip the files it rules out and carry the titles and headings it
+// holds; files it has not seen in their current version are always kept, and queued for
+// indexing. Files whose front matter tags do not pass the tag filter are left out.
+func (h *SearchHandler) targets(
+	ctx context.Context, query searchQuery, scope string, tags tagFilter,
+) ([]searchTarget, string) {
+	var targets []searchTarget
+	source := SearchSourceScan
+	folders := h.cfg.FoldersSnapshot()
+	if h.index != nil && len(folders) > 0 {
+		source = SearchSourceIndex
+	}
+	for _, folder := range folders {
+		tree, err := h.tree.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		var index *search.Index
+		var candidates map[string]bool
+		narrowed := false
+		if h.index != nil {
+			if index = h.folderIndex(ctx, folder); index != nil {
+				candidates, narrowed = termCandidates(index, query.required())
+			}
+		}
+		// Titles and headings come from the index whatever the query's length
+		if index == nil || (!narrowed && searchesContent(scope)) {
+			source = SearchSourceScan
+		}
+		fs := fsForFolder(ctx, folder)
+		var stale []*TreeNode
+		for _, file := range collectFiles(tree, nil) {
+			relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+			target := searchTarget{fs: fs, relPath: relPath, path: file.Path}
+			if index != nil {
+				if doc, ok := index.Lookup(relPath); !ok || !indexCurrent(doc, file) {
+					stale = append(stale, file)
+				} else {
+					target.doc = &doc
+					target.skipContent = narrowed && !candidates[relPath]
+				}
+			}
+			if target.skipContent && scope == SearchScopeContent {
+				continue
+			}
+			if !tags.empty() && !tags.matches(h.tree.tags.get(fs, relPath, file)) {
+				continue
+			}
+			targets = append(targets, target)
+		}
+		if len(stale) > 0 {
+			h.refreshIndex(folder, index, stale)
+		}
+	}
+	return targets, source
+}
+
+// searchesContent reports whether scope matches the documents' text
+func searchesContent(scope string) bool {
+	return scope == SearchScopeContent || scope == SearchScopeAll
+}
+
+// scan searches targets with a bounded worker pool, counting the documents it reads into stats,
+// and reports whether ctx expired before every target was searched
+func (h *SearchHandler) scan(
+	ctx context.Context, targets []searchTarget, query searchQuery, scope string, stats *corpusStats, workers int,
+) ([]SearchResult, bool) {
+	jobs := make(chan searchTarget)
+	var (
+		mu      sync.Mutex
+		results = []SearchResult{}
+		wg      sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				matched := h.match(t, query, scope, stats)
+				if len(matched) == 0 {
+					continue
+				}
+				mu.Lock()
+				results = append(results, matched...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, t := range targets {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- t:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return results, ctx.Err() != nil
+}
+
+// match returns the results of target for query in scope: its title or heading matches, then its
+// text match, whose score rankResults sets
+func (h *SearchHandler) match(t searchTarget, query searchQuery, scope string, stats *corpusStats) []SearchResult {
+	var content []byte
+	if t.doc == nil || (searchesContent(scope) && !t.skipContent) {
+		var err error
+		if content, err = t.fs.ReadFile(t.relPath); err != nil {
+			return nil
+		}
+	}
+	doc := t.doc
+	outline := func() *search.Doc {
+		if doc == nil {
+			doc = &search.Doc{}
+			h.outline(doc, content)
+		}
+		return doc
+	}
+	var results []SearchResult
+	if scope != SearchScopeContent {
+		results = matchHeadings(t.path, outline(), query, scope, h.cfg.Render.AnchorPrefix)
+	}
+	if searchesContent(scope) && !t.skipContent {
+		lower := bytes.ToLower(content)
+		stats.add(lower, query)
+		if result, ok := matchContent(t.path, content, lower, query); ok {
+			addFieldFreqs(result.freqs, outline(), query)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// outline sets doc's title and headings from content
+func (h *SearchHandler) outline(doc *search.Doc, content []byte) {
+	toc := h.outliner.Outline(content)
+	doc.Title = ""
+	doc.Headings = make([]search.Heading, len(toc))
+	for i, item := range toc {
+		doc.Headings[i] = search.Heading{Level: item.Level, Text: item.Title, Anchor: item.Anchor}
+	}
+	if len(toc) > 0 {
+		doc.Title = toc[0].Title
+	}
+}
+
+// Scores of title and heading matches, by how closely the text matches the query; a heading adds
+// headingLevelScore for each level above 7 (h1: 60, h6: 10), a title titleScore
+const (
+	exactMatchScore   = 100
+	prefixMatchScore  = 50
+	partialMatchScore = 20
+	headingLevelScore = 10
+	titleScore        = 80
+)
+
+// matchHeadings returns the title match (scope title) or the heading matches (headings, all) of
+// doc for query, scored for ranking. Heading anchors get render.anchor_prefix here rather than in
+// the outline, so the search index does not depend on it.
+func matchHeadings(path string, doc *search.Doc, query searchQuery, scope, anchorPrefix string) []SearchResult {
+	if scope == SearchScopeTitle {
+		score := textScore(doc.Title, query)
+		if score == 0 {
+			return nil
+		}
+		return []SearchResult{{
+			Path: path, Title: doc.Title, Snippet: doc.Title, Matches: 1, Match: SearchMatchTitle,
+			Link: path, Score: float64(score + titleScore), Highlights: textHighlights(doc.Title, query),
+		}}
+	}
+	var results []SearchResult
+	for _, heading := range doc.Headings {
+		score := textScore(heading.Text, query)
+		if score == 0 {
+			continue
+		}
+		anchor := anchorPrefix + heading.Anchor
+		results = append(results, SearchResult{
+			Path: path, Title: doc.Title, Snippet: heading.Text, Matches: 1, Highlights: textHighlights(heading.Text, query),
+			Match: SearchMatchHeading, Heading: heading.Text, Level: heading.Level, Anchor: anchor,
+			Link: path + "#" + anchor, Score: float64(score + (7-heading.Level)*headingLevelScore),
+		})
+	}
+	return results
+}
+
+// textScore scores how closely text matches query, or returns 0 when it does not match
+func textScore(text string, query searchQuery) int {
+	lower := strings.ToLower(text)
+	switch {
+	case lower == query.text:
+		return exactMatchScore
+	case strings.HasPrefix(lower, query.text):
+		return prefixMatchScore
+	case query.matches(lower):
+		return partialMatchScore
+	}
+	return 0
+}
+
+// textHighlights returns the ranges of text holding the keys of query
+func textHighlights(text string, query searchQuery) []TextRange {
+	return keySpans([]byte(text), bytes.ToLower([]byte(text)), query)
+}
+
+// matchContent reports whether content, whose lowercase form is lower, contains every term of
+// query and covers its CJK runs. The snippet is taken where the matches are densest; the result
+// carries the frequencies of the query's keys in the text, for scoring.
+func matchContent(path string, content, lower []byte, query searchQuery) (SearchResult, bool) {
+	keys := query.keys()
+	freqs := make([]float64, len(keys))
+	count := 0
+	for i, key := range keys {
+		n := bytes.Count(lower, []byte(key))
+		if n == 0 && i < len(query.terms) {
+			return SearchResult{}, false
+		}
+		freqs[i] = float64(n)
+		if i < len(query.terms) {
+			count += n
+		}
+	}
+	// A run counts as often as its rarest n-gram
+	offset := len(query.terms)
+	for _, grams := range query.runs {
+		found := make([]bool, len(grams))
+		least := -1
+		for i := range grams {
+			n := int(freqs[offset+i])
+			found[i] = n > 0
+			if n > 0 && (least < 0 || n < least) {
+				least = n
+			}
+		}
+		if !runCovered(found, utf8.RuneCountInString(grams[0])) {
+			return SearchResult{}, false
+		}
+		count += least
+		offset += len(grams)
+	}
+
+	snippet, line, highlights := bestSnippet(content, keySpans(content, lower, query))
+	return SearchResult{
+		Path:       path,
+		Title:      sniffTitle(content),
+		Line:       line,
+		Snippet:    snippet,
+		Highlights: highlights,
+		Matches:    count,
+		Match:      SearchMatchContent,
+		Link:       path,
+		freqs:      freqs,
+		length:     len(lower),
+	}, true
+}
+
+// sniffTitle returns the text of the first ATX H1 heading, without a full markdown parse
+func sniffTitle(content []byte) string {
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		}
+	}
+	return ""
+}
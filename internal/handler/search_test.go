@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+func newSearchRouter(t *testing.T, files int, search config.SearchConfig) *gin.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	for i := 0; i < files; i++ {
+		content := fmt.Sprintf("# Doc %d\n\nThe needle is here.\n", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("doc%d.md", i)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Search = search
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/search", NewSearchHandler(cfg, NewTreeHandler(cfg)).Search)
+	return r
+}
+
+func getSearch(t *testing.T, r http.Handler, query string) SearchResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestSearchResultCap(t *testing.T) {
+	r := newSearchRouter(t, 6, config.SearchConfig{MaxResults: 3, Workers: 2})
+
+	resp := getSearch(t, r, "q=NEEDLE")
+	if len(resp.Results) != 3 || !resp.Truncated {
+		t.Errorf("expected 3 truncated results, got %d (truncated=%v)", len(resp.Results), resp.Truncated)
+	}
+
+	resp = getSearch(t, r, "q=needle&limit=2")
+	if len(resp.Results) != 2 || !resp.Truncated {
+		t.Errorf("expected ?limit=2 to cap results, got %d (truncated=%v)", len(resp.Results), resp.Truncated)
+	}
+
+	resp = getSearch(t, r, "q=needle&limit=50")
+	if len(resp.Results) != 3 {
+		t.Errorf("expected ?limit not to raise the configured cap, got %d", len(resp.Results))
+	}
+}
+
+func TestSearchWithinCapIsComplete(t *testing.T) {
+	r := newSearchRouter(t, 4, config.SearchConfig{MaxResults: 10})
+
+	resp := getSearch(t, r, "q=needle")
+	if len(resp.Results) != 4 || resp.Truncated {
+		t.Errorf("expected 4 complete results, got %d (truncated=%v)", len(resp.Results), resp.Truncated)
+	}
+	if resp.Results[0].Path != "docs/doc0.md" || resp.Results[0].Line != 3 || resp.Results[0].Title != "Doc 0" {
+		t.Errorf("unexpected first result %+v", resp.Results[0])
+	}
+}
+
+// slowFS serves every file after a delay, except fast.md
+type slowFS struct {
+	delay time.Duration
+}
+
+func (s slowFS) ReadFile(path string) ([]byte, error) {
+	if path != "fast.md" {
+		time.Sleep(s.delay)
+	}
+	return []byte("# " + path + "\nneedle\n"), nil
+}
+
+func (slowFS) Stat(string) (mfs.FileInfo, error)      { return mfs.FileInfo{}, nil }
+func (slowFS) ReadDir(string) ([]mfs.DirEntry, error) { return nil, nil }
+
+func TestSearchTimeBudgetReturnsPartialResults(t *testing.T) {
+	fs := slowFS{delay: 50 * time.Millisecond}
+	targets := []searchTarget{{fs: fs, relPath: "fast.md", path: "docs/fast.md"}}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("slow%d.md", i)
+		targets = append(targets, searchTarget{fs: fs, relPath: name, path: "docs/" + name})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	h := &SearchHandler{outliner: markdown.New(markdown.Options{})}
+	results, truncated := h.scan(ctx, targets, parseSearchQuery("needle", 0), SearchScopeContent, newCorpusStats(), 1)
+
+	if !truncated {
+		t.Error("expected an expired budget to mark the results truncated")
+	}
+	if len(results) == 0 || len(results) >= len(targets) {
+		t.Errorf("expected partial results, got %d of %d", len(results), len(targets))
+	}
+	if results[0].Path != "docs/fast.md" {
+		t.Errorf("expected the fast file to be found before the budget expired, got %+v", results)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("scan kept running after the budget expired (%v)", elapsed)
+	}
+}
+
+func TestMatchContentKeepsOriginalCase(t *testing.T) {
+	// U+0130 lowers to a shorter encoding, so offsets in the lowered text do not match the original
+	content := []byte("# İstanbul Guide\n\nSee the Quick Start section.\n")
+
+	result, ok := matchContent("docs/guide.md", content, bytes.ToLower(content), parseSearchQuery("quick", 0))
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if result.Snippet != "See the Quick Start section." {
+		t.Errorf("expected the original snippet, got %q", result.Snippet)
+	}
+	if len(result.Highlights) != 1 || result.Snippet[result.Highlights[0].Start:result.Highlights[0].End] != "Quick" {
+		t.Errorf("unexpected highlights %+v", result.Highlights)
+	}
+	if result.Line != 3 || result.Title != "İstanbul Guide" {
+		t.Errorf("unexpected line/title: %d %q", result.Line, result.Title)
+	}
+}
+
+func TestSearchScopes(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "install.md"), "# Install\n\n## Quick start\n\nRun the installer.\n")
+	writeDoc(t, filepath.Join(dir, "guide.md"),
+		"# User guide\n\n## Setup\n\n### Install on *Linux*\n\nRead install.md first.\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/search", NewSearchHandler(cfg, NewTreeHandler(cfg)).Search)
+
+	// The exact h1 ranks above the h3 that merely contains the query
+	resp := getSearch(t, r, "q=install&scope=headings")
+	if len(resp.Results) != 2 || resp.Scope != SearchScopeHeadings {
+		t.Fatalf("expected two heading matches, got %+v", resp)
+	}
+	if first := resp.Results[0]; first.Path != "docs/install.md" || first.Link != "docs/install.md#install" ||
+		first.Level != 1 || first.Match != SearchMatchHeading {
+		t.Errorf("unexpected first result %+v", first)
+	}
+	if second := resp.Results[1]; second.Heading != "Install on Linux" ||
+		second.Link != "docs/guide.md#install-on-linux" || second.Score >= resp.Results[0].Score {
+		t.Errorf("unexpected second result %+v", second)
+	}
+
+	resp = getSearch(t, r, "q=guide&scope=title")
+	if len(resp.Results) != 1 || resp.Results[0].Match != SearchMatchTitle || resp.Results[0].Title != "User guide" {
+		t.Errorf("expected the title match, got %+v", resp.Results)
+	}
+	if resp = getSearch(t, r, "q=setup&scope=title"); len(resp.Results) != 0 {
+		t.Errorf("expected a lower heading not to match the title, got %+v", resp.Results)
+	}
+
+	// All: the heading matches first, then the text matches of both documents
+	resp = getSearch(t, r, "q=install&scope=all")
+	if len(resp.Results) != 4 || resp.Results[2].Match != SearchMatchContent {
+		t.Errorf("expected two heading and two content matches, got %+v", resp.Results)
+	}
+
+	// Heading links carry render.anchor_prefix like the rendered ids
+	cfg.Render.AnchorPrefix = "mh-"
+	resp = getSearch(t, r, "q=install&scope=headings")
+	if first := resp.Results[0]; first.Anchor != "mh-install" || first.Link != "docs/install.md#mh-install" {
+		t.Errorf("expected a prefixed anchor, got %+v", first)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=install&scope=body", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown scope, got %d", w.Code)
+	}
+}
@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/crash"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/search"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+// Where the files a search read were chosen from, reported in SearchResponse.Source
+const (
+	// SearchSourceIndex: every folder's index narrowed the search down
+	SearchSourceIndex = "index"
+	// SearchSourceScan: at least one folder was scanned file by file, as it has no index yet or
+	// the query is shorter than three bytes
+	SearchSourceScan = "scan"
+)
+
+// searchIndexSaveDelay batches the saves of an index kept current from watcher events
+const searchIndexSaveDelay = 10 * time.Second
+
+// folderIndex is the search index of one folder
+type folderIndex struct {
+	index *search.Index // nil until the first build finishes
+	// building is set while the index is built from scratch, refreshing while stale files are re-read
+	building   bool
+	refreshing bool
+	saveTimer  *time.Timer
+}
+
+// searchIndexes keeps the search index of each folder (search.index), saved under dir. Indexes
+// are keyed by the folder's path, git_ref and sub_path, so editing any of them starts a new one.
+type searchIndexes struct {
+	dir  string
+	mu   sync.Mutex
+	byID map[string]*folderIndex
+}
+
+func newSearchIndexes(dir string) *searchIndexes {
+	return &searchIndexes{dir: dir, byID: map[string]*folderIndex{}}
+}
+
+// entry returns the state of folder's index, creating it; the caller holds mu
+func (x *searchIndexes) entry(folder config.Folder) *folderIndex {
+	key := indexKey(folder)
+	fi, ok := x.byID[key]
+	if !ok {
+		fi = &folderIndex{}
+		x.byID[key] = fi
+	}
+	return fi
+}
+
+// file returns the path folder's index is saved to
+func (x *searchIndexes) file(folder config.Folder) string {
+	return filepath.Join(x.dir, indexKey(folder)+".idx")
+}
+
+func indexKey(folder config.Folder) string {
+	return config.NewFolderID(folder.Path, folder.GitRef, folder.SubPath)
+}
+
+// scheduleSave saves folder's index once searchIndexSaveDelay has passed without another save
+// being scheduled first
+func (x *searchIndexes) scheduleSave(folder config.Folder) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	fi := x.entry(folder)
+	if fi.saveTimer != nil {
+		return
+	}
+	fi.saveTimer = time.AfterFunc(searchIndexSaveDelay, func() {
+		x.mu.Lock()
+		fi.saveTimer = nil
+		index := fi.index
+		x.mu.Unlock()
+		if index != nil {
+			if err := index.Save(x.file(folder)); err != nil {
+				log.Printf("Warning: failed to save the search index of %s: %v", folder.Alias, err)
+			}
+		}
+	})
+}
+
+// folderIndex returns folder's index when it is built and current. Otherwise it starts building it
+// and returns nil, so the search scans the folder meanwhile. The index of a git_ref folder is
+// rebuilt whenever the ref moves to another commit.
+func (h *SearchHandler) folderIndex(ctx context.Context, folder config.Folder) *search.Index {
+	ref, ok := indexRef(ctx, folder)
+	if !ok {
+		return nil
+	}
+	h.index.mu.Lock()
+	defer h.index.mu.Unlock()
+	fi := h.index.entry(folder)
+	if fi.index != nil && fi.index.Ref() == ref {
+		return fi.index
+	}
+	if !fi.building {
+		fi.building = true
+		go h.buildIndex(folder, ref, false)
+	}
+	return nil
+}
+
+// indexRef returns what folder's index is built from: the commit of a git_ref folder's ref, or ""
+func indexRef(ctx context.Context, folder config.Folder) (string, bool) {
+	if folder.GitRef == "" {
+		return "", true
+	}
+	commit, err := mfs.NewGitFS(folder.Path, folder.GitRef).WithContext(ctx).Commit()
+	return commit, err == nil
+}
+
+// buildIndex builds folder's index for ref. Unless full is set, it starts from the saved index
+// when that was built for the same ref, re-reading only the files that changed since.
+func (h *SearchHandler) buildIndex(folder config.Folder, ref string, full bool) {
+	defer crash.Recover("search index build")
+	start := time.Now()
+	ctx := context.Background()
+	var index *search.Index
+	if !full {
+		if saved, err := search.Load(h.index.file(folder)); err == nil && saved.Ref() == ref {
+			index = saved
+		}
+	}
+	if index == nil {
+		index = search.New(ref)
+	}
+
+	tree, err := h.tree.folderTree(ctx, folder)
+	if err == nil {
+		files := collectFiles(tree, nil)
+		h.indexFiles(ctx, folder, index, files)
+		pruneIndex(folder, index, files)
+		if err := index.Save(h.index.file(folder)); err != nil {
+			log.Printf("Warning: failed to save the search index of %s: %v", folder.Alias, err)
+		}
+		log.Printf("Search index of %s: %d files in %v",
+			folder.Alias, index.Len(), time.Since(start).Round(time.Millisecond))
+	} else {
+		log.Printf("Warning: failed to build the search index of %s: %v", folder.Alias, err)
+	}
+
+	h.index.mu.Lock()
+	defer h.index.mu.Unlock()
+	fi := h.index.entry(folder)
+	fi.building = false
+	if err == nil {
+		fi.index = index
+	}
+}
+
+// pruneIndex drops the documents of index that are not among the files folder's tree shows, and
+// returns how many it dropped
+func pruneIndex(folder config.Folder, index *search.Index, files []*TreeNode) int {
+	shown := make(map[string]bool, len(files))
+	for _, file := range files {
+		shown[strings.TrimPrefix(file.Path, folder.Alias+"/")] = true
+	}
+	dropped := 0
+	for _, path := range index.Paths() {
+		if !shown[path] {
+			index.Remove(path)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// pruneIndexes drops from the built indexes the documents the trees no longer show, so that
+// newly excluded files stop being held in the index; it runs after excludes change
+func (h *SearchHandler) pruneIndexes() {
+	defer crash.Recover("search index prune")
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		h.index.mu.Lock()
+		index := h.index.entry(folder).index
+		h.index.mu.Unlock()
+		if index == nil {
+			continue
+		}
+		tree, err := h.tree.folderTree(context.Background(), folder)
+		if err != nil {
+			continue
+		}
+		if pruneIndex(folder, index, collectFiles(tree, nil)) > 0 {
+			h.index.scheduleSave(folder)
+		}
+	}
+}
+
+// indexFiles (re-)indexes the files whose modification time or size differ from the index's
+func (h *SearchHandler) indexFiles(
+	ctx context.Context, folder config.Folder, index *search.Index, files []*TreeNode,
+) {
+	fs := fsForFolder(ctx, folder)
+	for _, file := range files {
+		relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+		if doc, ok := index.Lookup(relPath); ok && indexCurrent(doc, file) {
+			continue
+		}
+		content, err := fs.ReadFile(relPath)
+		if err != nil {
+			continue
+		}
+		doc := search.Doc{Path: relPath, Size: file.Size}
+		if file.ModTime != nil {
+			doc.ModTime = file.ModTime.Time
+		}
+		h.outline(&doc, content)
+		index.Add(doc, content)
+	}
+}
+
+// indexCurrent reports whether doc still describes the tree's file
+func indexCurrent(doc search.Doc, file *TreeNode) bool {
+	return file.ModTime != nil && doc.ModTime.Equal(file.ModTime.Time) && doc.Size == file.Size
+}
+
+// refreshIndex re-reads the files a search found out of date in folder's index, in the background.
+// Watcher events keep indexes current; this catches changes made while the server was down or
+// without a watcher.
+func (h *SearchHandler) refreshIndex(folder config.Folder, index *search.Index, files []*TreeNode) {
+	h.index.mu.Lock()
+	fi := h.index.entry(folder)
+	if fi.building || fi.refreshing || fi.index != index {
+		h.index.mu.Unlock()
+		return
+	}
+	fi.refreshing = true
+	h.index.mu.Unlock()
+
+	go func() {
+		defer crash.Recover("search index refresh")
+		h.indexFiles(context.Background(), folder, index, files)
+		h.index.mu.Lock()
+		fi.refreshing = false
+		h.index.mu.Unlock()
+		h.index.scheduleSave(folder)
+	}()
+}
+
+// OnFileChange keeps the indexes of local folders current; it is called by the file watcher
+func (h *SearchHandler) OnFileChange(e watcher.Event) {
+	if h.index == nil {
+		return
+	}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		if folder.GitRef != "" {
+			continue
+		}
+		relPath, err := filepath.Rel(folder.Path, e.Path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+		h.index.mu.Lock()
+		index := h.index.entry(folder).index
+		h.index.mu.Unlock()
+		if index == nil {
+			continue
+		}
+		switch e.Type {
+		case watcher.EventRemove, watcher.EventRename:
+			index.Remove(relPath)
+		default:
+			fs := fsForFolder(context.Background(), folder)
+			info, err := fs.Stat(relPath)
+			// New directories are picked up by the next search, which finds their files unindexed
+			if err != nil || info.IsDir {
+				continue
+			}
+			// Only what the tree shows is indexed: excluded and non-markdown files are not read
+			if !h.tree.fileVisible(folder, relPath, info) {
+				index.Remove(relPath)
+				continue
+			}
+			content, err := fs.ReadFile(relPath)
+			if err != nil {
+				continue
+			}
+			doc := search.Doc{Path: relPath, ModTime: info.ModTime, Size: info.Size}
+			h.outline(&doc, content)
+			index.Add(doc, content)
+		}
+		h.index.scheduleSave(folder)
+	}
+}
+
+// StartIndexing loads or builds the index of every folder in the background (search.index_on_start)
+func (h *SearchHandler) StartIndexing() {
+	if h.index == nil {
+		return
+	}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		h.folderIndex(context.Background(), folder)
+	}
+}
+
+// SearchIndexStatus reports the search index of every folder
+type SearchIndexStatus struct {
+	// Enabled is false when search.index is off and every search scans
+	Enabled bool                `json:"enabled"`
+	Folders []FolderIndexStatus `json:"folders"`
+}
+
+// FolderIndexStatus is the state of one folder's search index
+type FolderIndexStatus struct {
+	FolderID  string `json:"folderId"`
+	Alias     string `json:"alias"`
+	Indexed   bool   `json:"indexed"`
+	Building  bool   `json:"building"`
+	Documents int    `json:"documents"`
+	// SizeBytes is the size of the saved index on disk
+	SizeBytes int64           `json:"sizeBytes"`
+	BuiltAt   *timestamp.Time `json:"builtAt,omitempty"`
+	// Ref is the commit a git_ref folder was indexed at
+	Ref string `json:"ref,omitempty"`
+}
+
+func (h *SearchHandler) indexStatus() SearchIndexStatus {
+	status := SearchIndexStatus{Enabled: h.index != nil, Folders: []FolderIndexStatus{}}
+	if h.index == nil {
+		return status
+	}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		st := FolderIndexStatus{FolderID: folder.ID, Alias: folder.Alias}
+		h.index.mu.Lock()
+		fi := h.index.entry(folder)
+		index := fi.index
+		st.Building = fi.building
+		h.index.mu.Unlock()
+		if index != nil {
+			st.Indexed = true
+			st.Documents = index.Len()
+			st.BuiltAt = timestamp.Ptr(index.BuiltAt())
+			st.Ref = index.Ref()
+		}
+		if info, err := os.Stat(h.index.file(folder)); err == nil {
+			st.SizeBytes = info.Size()
+		}
+		status.Folders = append(status.Folders, st)
+	}
+	return status
+}
+
+// GetIndexStatus reports the search index of every folder
+func (h *SearchHandler) GetIndexStatus(c *gin.Context) {
+	writeJSON(c, http.StatusOK, h.indexStatus())
+}
+
+// Reindex rebuilds every folder's search index from scratch in the background
+func (h *SearchHandler) Reindex(c *gin.Context) {
+	if h.index == nil {
+		writeError(c, CodeSearchIndexDisabled, "the search index is disabled (search.index)")
+		return
+	}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		ref, ok := indexRef(c.Request.Context(), folder)
+		if !ok {
+			continue
+		}
+		h.index.mu.Lock()
+		fi := h.index.entry(folder)
+		if !fi.building {
+			fi.building = true
+			go h.buildIndex(folder, ref, true)
+		}
+		h.index.mu.Unlock()
+	}
+	writeJSON(c, http.StatusAccepted, h.indexStatus())
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+func newIndexedSearch(t *testing.T) (*SearchHandler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "a.md"), "# A\n\nalpha needle\n")
+	writeDoc(t, filepath.Join(dir, "b.md"), "# B\n\nbeta\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Search.Index = true
+	h := NewSearchHandler(cfg, NewTreeHandler(cfg))
+	h.index = newSearchIndexes(t.TempDir())
+	return h, dir
+}
+
+// waitIndexed waits for every folder's index to be built
+func waitIndexed(t *testing.T, h *SearchHandler) SearchIndexStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := h.indexStatus()
+		ready := true
+		for _, folder := range status.Folders {
+			ready = ready && folder.Indexed && !folder.Building
+		}
+		if ready {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index not built: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func targetPaths(h *SearchHandler, query string) ([]string, string) {
+	targets, source := h.targets(context.Background(), parseSearchQuery(query, 0), SearchScopeContent, tagFilter{})
+	paths := make([]string, len(targets))
+	for i, target := range targets {
+		paths[i] = target.path
+	}
+	return paths, source
+}
+
+func TestSearchIndexNarrowsTargets(t *testing.T) {
+	h, dir := newIndexedSearch(t)
+
+	paths, source := targetPaths(h, "needle")
+	if source != SearchSourceScan || len(paths) != 2 {
+		t.Fatalf("expected the first search to scan both files, got %v from %s", paths, source)
+	}
+	status := waitIndexed(t, h)
+	if status.Folders[0].Documents != 2 || status.Folders[0].SizeBytes == 0 || status.Folders[0].BuiltAt == nil {
+		t.Errorf("unexpected status %+v", status.Folders[0])
+	}
+
+	paths, source = targetPaths(h, "needle")
+	if source != SearchSourceIndex || len(paths) != 1 || paths[0] != "docs/a.md" {
+		t.Errorf("expected the index to narrow the search to docs/a.md, got %v from %s", paths, source)
+	}
+	// Titles and headings are indexed, so heading searches need no file reads even for short queries
+	index := h.folderIndex(context.Background(), h.cfg.Folders[0])
+	doc, ok := index.Lookup("a.md")
+	if !ok || doc.Title != "A" || len(doc.Headings) != 1 || doc.Headings[0].Anchor != "a" {
+		t.Errorf("expected the title and headings to be indexed, got %+v", doc)
+	}
+	targets, source := h.targets(context.Background(), parseSearchQuery("b", 0), SearchScopeHeadings, tagFilter{})
+	if source != SearchSourceIndex || len(targets) != 2 || targets[0].doc == nil {
+		t.Errorf("expected heading targets from the index, got %d from %s", len(targets), source)
+	}
+	if _, source = targetPaths(h, "ne"); source != SearchSourceScan {
+		t.Errorf("expected a two-byte query to scan, got %s", source)
+	}
+
+	// Watcher events update the index
+	writeDoc(t, filepath.Join(dir, "c.md"), "another needle\n")
+	h.OnFileChange(watcher.Event{Type: watcher.EventCreate, Path: filepath.Join(dir, "c.md")})
+	if err := os.Remove(filepath.Join(dir, "a.md")); err != nil {
+		t.Fatal(err)
+	}
+	h.OnFileChange(watcher.Event{Type: watcher.EventRemove, Path: filepath.Join(dir, "a.md")})
+	h.tree.Invalidate()
+	if paths, _ = targetPaths(h, "needle"); len(paths) != 1 || paths[0] != "docs/c.md" {
+		t.Errorf("expected the index to follow the watcher events, got %v", paths)
+	}
+
+	// A file changed behind the index's back is read until it is indexed again
+	writeDoc(t, filepath.Join(dir, "b.md"), "# B\n\nbeta needle\n")
+	h.tree.Invalidate()
+	if paths, _ = targetPaths(h, "needle"); len(paths) != 2 {
+		t.Errorf("expected the changed file to be searched, got %v", paths)
+	}
+}
+
+func TestSearchIndexEndpoints(t *testing.T) {
+	h, _ := newIndexedSearch(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/search", h.Search)
+	r.GET("/search/status", h.GetIndexStatus)
+	r.POST("/search/reindex", h.Reindex)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/search/reindex", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	waitIndexed(t, h)
+	if resp := getSearch(t, r, "q=Needle"); resp.Source != SearchSourceIndex || len(resp.Results) != 1 {
+		t.Errorf("expected one result from the index, got %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search/status", nil))
+	var status SearchIndexStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Enabled || len(status.Folders) != 1 || status.Folders[0].Documents != 2 {
+		t.Errorf("unexpected status %s", w.Body.String())
+	}
+
+	// Without search.index there is nothing to rebuild
+	disabled := gin.New()
+	disabled.POST("/search/reindex", NewSearchHandler(config.DefaultConfig(), nil).Reindex)
+	w = httptest.NewRecorder()
+	disabled.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/search/reindex", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 with the index disabled, got %d", w.Code)
+	}
+}
+
+func TestSearchFollowsExcludeUpdates(t *testing.T) {
+	h, dir := newIndexedSearch(t)
+	h.cfg.Ephemeral = true
+	writeDoc(t, filepath.Join(dir, "drafts", "wip.md"), "# WIP\n\nhidden needle\n")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/search", h.Search)
+	r.PUT("/exclude/global", h.tree.UpdateGlobalExclude)
+
+	targetPaths(h, "needle")
+	waitIndexed(t, h)
+	if resp := getSearch(t, r, "q=needle"); len(resp.Results) != 2 {
+		t.Fatalf("expected both needles before the exclude, got %+v", resp.Results)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/exclude/global",
+		strings.NewReader(`{"exclude":["drafts"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := getSearch(t, r, "q=needle")
+	if len(resp.Results) != 1 || resp.Results[0].Path != "docs/a.md" {
+		t.Errorf("expected the excluded draft to leave the results, got %+v", resp.Results)
+	}
+	// The update prunes the index in the background
+	index := h.folderIndex(context.Background(), h.cfg.Folders[0])
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := index.Lookup("drafts/wip.md"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the excluded draft to be pruned from the index")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Watcher events for excluded files do not index them again
+	writeDoc(t, filepath.Join(dir, "drafts", "wip.md"), "# WIP\n\nstill a needle\n")
+	h.OnFileChange(watcher.Event{Type: watcher.EventWrite, Path: filepath.Join(dir, "drafts", "wip.md")})
+	if _, ok := index.Lookup("drafts/wip.md"); ok {
+		t.Error("expected the watcher to skip the excluded draft")
+	}
+}
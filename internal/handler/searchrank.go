@@ -0,0 +1,428 @@
+package handler
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/CageChen/markhub/internal/search"
+)
+
+// BM25 parameters and field boosts for ranking text matches
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// An occurrence in the title or in another heading counts as this many occurrences in the text
+	titleBoost   = 3
+	headingBoost = 2
+	// A quoted phrase found verbatim weighs this many times as much as a single term
+	phraseBoost = 2
+)
+
+// defaultCJKNgram is the length in characters of the n-grams CJK runs of a query are split into
+// when search.cjk_ngram is unset
+const defaultCJKNgram = 2
+
+// searchQuery is a parsed query. A document's text matches when it contains every term and covers
+// every CJK run; the quoted phrases of the query, whose words are terms too, raise the score of the
+// documents holding them verbatim.
+type searchQuery struct {
+	// text is the lowercase query without quotes, its runs of spaces collapsed
+	text  string
+	terms []string
+	// runs holds the n-grams of each run of CJK characters longer than an n-gram. CJK text has no
+	// spaces between words, so a run is matched by its n-grams rather than as written: a text
+	// covers the run when each of its characters is in an n-gram the text contains.
+	runs    [][]string
+	phrases []string
+}
+
+// parseSearchQuery splits q into lowercase terms, keeping the words between double quotes as a
+// phrase as well. Runs of CJK characters within a word are split off; those longer than ngram
+// characters (defaultCJKNgram when not positive) are split into overlapping n-grams, and kept as a
+// phrase too.
+func parseSearchQuery(q string, ngram int) searchQuery {
+	if ngram <= 0 {
+		ngram = defaultCJKNgram
+	}
+	lower := strings.ToLower(q)
+	query := searchQuery{text: strings.Join(strings.Fields(strings.ReplaceAll(lower, `"`, " ")), " ")}
+	seen := map[string]bool{}
+	addPhrase := func(phrase string) {
+		if !seen["\x00"+phrase] {
+			seen["\x00"+phrase] = true
+			query.phrases = append(query.phrases, phrase)
+		}
+	}
+	for i, part := range strings.Split(lower, `"`) {
+		words := strings.Fields(part)
+		if i%2 == 1 && len(words) > 1 {
+			addPhrase(strings.Join(words, " "))
+		}
+		for _, word := range words {
+			for _, segment := range splitCJK(word) {
+				if grams := cjkNgrams(segment, ngram); grams != nil {
+					if !seen["\x00"+segment] {
+						query.runs = append(query.runs, grams)
+					}
+					addPhrase(segment)
+				} else if !seen[segment] {
+					seen[segment] = true
+					query.terms = append(query.terms, segment)
+				}
+			}
+		}
+	}
+	return query
+}
+
+// isCJK reports whether r is written without spaces between words: Han, kana and Hangul, and the
+// katakana length mark, which belongs to no script
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー'
+}
+
+// splitCJK splits word where it switches between CJK and other characters, so that `配置port`
+// yields `配置` and `port`
+func splitCJK(word string) []string {
+	var segments []string
+	start := 0
+	for i, r := range word {
+		if i > start {
+			prev, _ := utf8.DecodeLastRuneInString(word[:i])
+			if isCJK(prev) != isCJK(r) {
+				segments = append(segments, word[start:i])
+				start = i
+			}
+		}
+	}
+	return append(segments, word[start:])
+}
+
+// cjkNgrams returns the overlapping n-grams of a CJK run longer than n characters, or nil for other
+// segments, which are matched as written
+func cjkNgrams(segment string, n int) []string {
+	r, _ := utf8.DecodeRuneInString(segment)
+	runes := []rune(segment)
+	if !isCJK(r) || len(runes) <= n {
+		return nil
+	}
+	grams := make([]string, 0, len(runes)-n+1)
+	for i := 0; i+n <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+n]))
+	}
+	return grams
+}
+
+// empty reports whether the query has nothing to match
+func (q searchQuery) empty() bool {
+	return len(q.terms) == 0 && len(q.runs) == 0
+}
+
+// keys returns the terms, the n-grams of the runs, then the phrases: what a document's frequencies
+// are counted for
+func (q searchQuery) keys() []string {
+	keys := append([]string{}, q.terms...)
+	for _, grams := range q.runs {
+		keys = append(keys, grams...)
+	}
+	return append(keys, q.phrases...)
+}
+
+// weight returns how much the key at index i of keys counts
+func (q searchQuery) weight(i int) float64 {
+	if i >= len(q.keys())-len(q.phrases) {
+		return phraseBoost
+	}
+	return 1
+}
+
+// required returns keys every matching text contains: the terms, and the first and last n-gram of
+// each run, as only they cover the run's first and last characters. The index narrows searches
+// down with them; its byte trigrams need no CJK tokenization, as every CJK character takes at
+// least three bytes.
+func (q searchQuery) required() []string {
+	required := append([]string{}, q.terms...)
+	for _, grams := range q.runs {
+		required = append(required, grams[0], grams[len(grams)-1])
+	}
+	return required
+}
+
+// matches reports whether the lowercase text contains every term and covers every run
+func (q searchQuery) matches(lower string) bool {
+	for _, term := range q.terms {
+		if !strings.Contains(lower, term) {
+			return false
+		}
+	}
+	for _, grams := range q.runs {
+		found := make([]bool, len(grams))
+		for i, gram := range grams {
+			found[i] = strings.Contains(lower, gram)
+		}
+		if !runCovered(found, utf8.RuneCountInString(grams[0])) {
+			return false
+		}
+	}
+	return true
+}
+
+// runCovered reports whether the n-grams of a run found in a text, each n characters long, cover
+// every character of the run
+func runCovered(found []bool, n int) bool {
+	covered := 0
+	for i, ok := range found {
+		if i > covered {
+			return false
+		}
+		if ok {
+			covered = i + n
+		}
+	}
+	return covered == len(found)+n-1
+}
+
+// termCandidates returns the documents of index that may contain every term. Only the terms long
+// enough for the index to narrow down are checked; when there is none it returns false.
+func termCandidates(index *search.Index, terms []string) (map[string]bool, bool) {
+	var candidates map[string]bool
+	narrowed := false
+	for _, term := range terms {
+		paths, ok := index.Candidates(term)
+		if !ok {
+			continue
+		}
+		if !narrowed {
+			candidates, narrowed = paths, true
+			continue
+		}
+		for path := range candidates {
+			if !paths[path] {
+				delete(candidates, path)
+			}
+		}
+	}
+	return candidates, narrowed
+}
+
+// corpusStats holds the document count, average length and document frequencies BM25 weighs a
+// query with. They are gathered over the documents a search reads: every visible document, or the
+// index's candidates when it narrows the search down.
+type corpusStats struct {
+	mu     sync.Mutex
+	docs   int
+	length int
+	df     map[string]int
+}
+
+func newCorpusStats() *corpusStats {
+	return &corpusStats{df: map[string]int{}}
+}
+
+// add counts a document, given as its lowercase text, for the keys of query
+func (s *corpusStats) add(lower []byte, query searchQuery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs++
+	s.length += len(lower)
+	for _, key := range query.keys() {
+		if bytes.Contains(lower, []byte(key)) {
+			s.df[key]++
+		}
+	}
+}
+
+// score returns the BM25 score of a document of length bytes with the given frequencies of the
+// keys of query, rounded to three decimals
+func (s *corpusStats) score(query searchQuery, freqs []float64, length int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	avgLength := 1.0
+	if s.docs > 0 && s.length > 0 {
+		avgLength = float64(s.length) / float64(s.docs)
+	}
+	norm := bm25K1 * (1 - bm25B + bm25B*float64(length)/avgLength)
+	var score float64
+	for i, key := range query.keys() {
+		tf := freqs[i]
+		if tf == 0 {
+			continue
+		}
+		df := float64(s.df[key])
+		idf := math.Log(1 + (float64(s.docs)-df+0.5)/(df+0.5))
+		score += query.weight(i) * idf * tf * (bm25K1 + 1) / (tf + norm)
+	}
+	return math.Round(score*1000) / 1000
+}
+
+// addFieldFreqs adds the occurrences of the keys of query in doc's title and other headings to
+// freqs, boosted
+func addFieldFreqs(freqs []float64, doc *search.Doc, query searchQuery) {
+	title := strings.ToLower(doc.Title)
+	for i, key := range query.keys() {
+		freqs[i] += titleBoost * float64(strings.Count(title, key))
+		for j, heading := range doc.Headings {
+			// The title is the first heading
+			if j == 0 && heading.Text == doc.Title {
+				continue
+			}
+			freqs[i] += headingBoost * float64(strings.Count(strings.ToLower(heading.Text), key))
+		}
+	}
+}
+
+// rankResults scores the text matches and sorts results: title and heading matches first, which
+// only scope all mixes with text matches, then by score, path and link, so that pages of results
+// are stable
+func rankResults(results []SearchResult, stats *corpusStats, query searchQuery) {
+	for i := range results {
+		if results[i].Match == SearchMatchContent {
+			results[i].Score = stats.score(query, results[i].freqs, results[i].length)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Match == SearchMatchContent) != (b.Match == SearchMatchContent) {
+			return b.Match == SearchMatchContent
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Link < b.Link
+	})
+}
+
+// TextRange is a byte range of a snippet, such as a match to highlight
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// keySpans returns the ranges of content holding the keys of query, found in its lowercase form
+// lower, sorted and with overlapping ranges merged
+func keySpans(content, lower []byte, query searchQuery) []TextRange {
+	var spans []TextRange
+	for _, key := range query.keys() {
+		k := []byte(key)
+		for offset := 0; ; {
+			idx := bytes.Index(lower[offset:], k)
+			if idx < 0 {
+				break
+			}
+			spans = append(spans, TextRange{Start: offset + idx, End: offset + idx + len(k)})
+			offset += idx + len(k)
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	// Case folding can change byte lengths for some scripts; map the ranges back onto the original text
+	if len(lower) != len(content) {
+		offsets := make([]int, 0, 2*len(spans))
+		for _, span := range spans {
+			offsets = append(offsets, span.Start, span.End)
+		}
+		original := originalOffsets(content, offsets)
+		for i := range spans {
+			spans[i] = TextRange{Start: original[spans[i].Start], End: original[spans[i].End]}
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if span.Start <= last.End {
+			last.End = max(last.End, span.End)
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// originalOffsets maps byte offsets in bytes.ToLower(content) back to content. Lowering maps rune
+// for rune (invalid bytes become U+FFFD), so only the encoded lengths differ.
+func originalOffsets(content []byte, lowerOffsets []int) map[int]int {
+	sorted := append([]int{}, lowerOffsets...)
+	sort.Ints(sorted)
+	original := make(map[int]int, len(sorted))
+	lowered, i := 0, 0
+	for _, offset := range sorted {
+		for i < len(content) && lowered < offset {
+			r, size := utf8.DecodeRune(content[i:])
+			lowered += utf8.RuneLen(unicode.ToLower(r))
+			i += size
+		}
+		original[offset] = i
+	}
+	return original
+}
+
+// bestSnippet returns the text around the densest cluster of spans: the one-line window of
+// 2*searchSnippetRadius bytes holding the most of them, the earliest on a tie, padded evenly with
+// its surroundings. It also returns the window's line and the spans it holds, relative to the
+// snippet.
+func bestSnippet(content []byte, spans []TextRange) (string, int, []TextRange) {
+	first, last := 0, 0
+	for i := range spans {
+		limit := spans[i].Start + 2*searchSnippetRadius
+		if nl := bytes.IndexByte(content[spans[i].Start:], '\n'); nl >= 0 {
+			limit = min(limit, spans[i].Start+nl)
+		}
+		j := i
+		for j+1 < len(spans) && spans[j+1].End <= limit {
+			j++
+		}
+		if j-i > last-first {
+			first, last = i, j
+		}
+	}
+
+	lineStart := bytes.LastIndexByte(content[:spans[first].Start], '\n') + 1
+	lineEnd := len(content)
+	if nl := bytes.IndexByte(content[spans[last].End:], '\n'); nl >= 0 {
+		lineEnd = spans[last].End + nl
+	}
+	pad := max(0, 2*searchSnippetRadius-(spans[last].End-spans[first].Start)) / 2
+	start := max(lineStart, spans[first].Start-pad)
+	end := min(lineEnd, spans[last].End+pad)
+	for start > lineStart && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < lineEnd && !utf8.RuneStart(content[end]) {
+		end++
+	}
+	for start < end && isSpaceByte(content[start]) {
+		start++
+	}
+	for end > start && isSpaceByte(content[end-1]) {
+		end--
+	}
+
+	line := bytes.Count(content[:start], []byte("\n")) + 1
+	snippet := content[start:end]
+	if !utf8.Valid(snippet) {
+		// Dropping invalid bytes would shift the ranges
+		return strings.ToValidUTF8(string(snippet), ""), line, nil
+	}
+	var highlights []TextRange
+	for _, span := range spans {
+		if span.Start >= start && span.End <= end {
+			highlights = append(highlights, TextRange{Start: span.Start - start, End: span.End - start})
+		}
+	}
+	return string(snippet), line, highlights
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r'
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	q := parseSearchQuery(`Rolling  "Blue  green" deploy "rolling"`, 0)
+	if q.text != "rolling blue green deploy rolling" {
+		t.Errorf("unexpected text %q", q.text)
+	}
+	if !slices.Equal(q.terms, []string{"rolling", "blue", "green", "deploy"}) ||
+		!slices.Equal(q.phrases, []string{"blue green"}) {
+		t.Errorf("unexpected terms %v and phrases %v", q.terms, q.phrases)
+	}
+}
+
+func TestParseSearchQueryCJK(t *testing.T) {
+	q := parseSearchQuery("服务器部署 配置port 中文", 0)
+	if !slices.Equal(q.terms, []string{"配置", "port", "中文"}) || len(q.runs) != 1 ||
+		!slices.Equal(q.runs[0], []string{"服务", "务器", "器部", "部署"}) ||
+		!slices.Equal(q.phrases, []string{"服务器部署"}) {
+		t.Errorf("unexpected terms %v, runs %v and phrases %v", q.terms, q.runs, q.phrases)
+	}
+	q = parseSearchQuery("設定ファイル", 3)
+	if !slices.Equal(q.runs[0], []string{"設定フ", "定ファ", "ファイ", "ァイル"}) {
+		t.Errorf("unexpected trigrams %v", q.runs)
+	}
+	if !slices.Equal(q.required(), []string{"設定フ", "ァイル"}) {
+		t.Errorf("expected the first and last n-grams to be required, got %v", q.required())
+	}
+}
+
+func TestSearchCJK(t *testing.T) {
+	corpus := map[string]string{
+		"zh.md":    "# 运维\n\n本文介绍服务器的部署流程。\n",
+		"zh-no.md": "# 其他\n\n服务和部署是两回事。\n",
+		"ja.md":    "# 手順\n\n設定のファイルを編集します。\n",
+		"mixed.md": "# Mixed\n\n修改配置中的 port 字段。\n",
+	}
+	dir := t.TempDir()
+	for name, content := range corpus {
+		writeDoc(t, filepath.Join(dir, name), content)
+	}
+	for _, indexed := range []bool{false, true} {
+		cfg := config.DefaultConfig()
+		cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+		cfg.Search.Index = indexed
+		h := NewSearchHandler(cfg, NewTreeHandler(cfg))
+		if indexed {
+			h.index = newSearchIndexes(t.TempDir())
+			targetPaths(h, "build")
+			waitIndexed(t, h)
+		}
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.GET("/search", h.Search)
+
+		// None of these queries occurs verbatim in the documents
+		for query, want := range map[string][]string{
+			"服务器部署":   {"zh.md"},
+			"設定ファイル":  {"ja.md"},
+			"配置 port": {"mixed.md"},
+			"配置port":  {"mixed.md"},
+		} {
+			resp := getSearch(t, r, "q="+url.QueryEscape(query))
+			got := []string{}
+			for _, result := range resp.Results {
+				got = append(got, strings.TrimPrefix(result.Path, "docs/"))
+				// Highlights are byte ranges of the snippet, on character boundaries
+				for _, hl := range result.Highlights {
+					if text := result.Snippet[hl.Start:hl.End]; !utf8.ValidString(text) || text == "" {
+						t.Errorf("%s: highlight %v of %q splits a character", query, hl, result.Snippet)
+					}
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("indexed=%v %s: expected %v, got %v", indexed, query, want, got)
+			}
+		}
+		resp := getSearch(t, r, "q="+url.QueryEscape("服务器部署"))
+		snippet, hl := resp.Results[0].Snippet, resp.Results[0].Highlights
+		if len(hl) != 2 || snippet[hl[0].Start:hl[0].End] != "服务器" || snippet[hl[1].Start:hl[1].End] != "部署" {
+			t.Errorf("unexpected highlights %v of %q", hl, snippet)
+		}
+	}
+}
+
+// TestSearchRelevance checks the ranking of a small corpus for a handful of queries
+func TestSearchRelevance(t *testing.T) {
+	filler := strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 20)
+	corpus := map[string]string{
+		// Title, text and length
+		"k8s.md":     "# Kubernetes\n\nKubernetes schedules containers.\n",
+		"tips.md":    "# Notes\n\n## Kubernetes tips\n\nKeep pods small.\n",
+		"ops.md":     "# Operations\n\n" + filler + "\n\nWe also run kubernetes.\n\n" + filler + "\n",
+		"short.md":   "# Short\n\nIt mentions kubernetes once.\n",
+		"lengthy.md": "# Lengthy\n\nIt mentions kubernetes once.\n\n" + filler + "\n",
+		// Phrases
+		"phrase.md": "# Upgrades\n\nA rolling update replaces pods one by one.\n",
+		"apart.md":  "# Upgrades\n\nA rolling restart, then an update of the pods.\n",
+		// Rare terms weigh more
+		"deploy1.md": "# Shipping\n\nDeploy, deploy, deploy with a canary.\n",
+		"deploy2.md": "# Release\n\nDeploy a canary, check the canary, promote the canary.\n",
+		"deploy3.md": "# Rollout\n\nWe deploy often.\n",
+		"deploy4.md": "# Pipeline\n\nEvery merge is a deploy.\n",
+		// Identical documents
+		"same-b.md": "# Same\n\nA duplicate page.\n",
+		"same-a.md": "# Same\n\nA duplicate page.\n",
+	}
+	dir := t.TempDir()
+	for name, content := range corpus {
+		writeDoc(t, filepath.Join(dir, name), content)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/search", NewSearchHandler(cfg, NewTreeHandler(cfg)).Search)
+
+	for query, want := range map[string][]string{
+		"kubernetes":          {"k8s.md", "tips.md", "short.md", "lengthy.md", "ops.md"},
+		"rolling update":      {"phrase.md", "apart.md"},
+		`"rolling update"`:    {"phrase.md", "apart.md"},
+		"deploy canary":       {"deploy2.md", "deploy1.md"},
+		"duplicate":           {"same-a.md", "same-b.md"},
+		"kubernetes mentions": {"short.md", "lengthy.md"},
+	} {
+		resp := getSearch(t, r, "q="+url.QueryEscape(query))
+		got := []string{}
+		for _, result := range resp.Results {
+			got = append(got, strings.TrimPrefix(result.Path, "docs/"))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", query, want, got)
+		}
+	}
+
+	// Phrases raise the score of verbatim matches
+	plain := getSearch(t, r, "q=rolling+update").Results[0].Score
+	if quoted := getSearch(t, r, "q="+url.QueryEscape(`"rolling update"`)).Results[0].Score; quoted <= plain {
+		t.Errorf("expected the quoted phrase to score higher, got %v <= %v", quoted, plain)
+	}
+
+	// Pages follow the ranking
+	page := getSearch(t, r, "q=kubernetes&offset=1&limit=2")
+	if page.Total != 5 || page.Offset != 1 || !page.Truncated || len(page.Results) != 2 ||
+		page.Results[0].Path != "docs/tips.md" || page.Results[1].Path != "docs/short.md" {
+		t.Errorf("unexpected page %+v", page)
+	}
+}
+
+func TestBestSnippet(t *testing.T) {
+	content := []byte("# Title\n\nOne cache here.\n\n" + strings.Repeat("x", 200) +
+		" the cache misses and the cache fills the cache again\n")
+	query := parseSearchQuery("cache", 0)
+	lower := []byte(strings.ToLower(string(content)))
+	snippet, line, highlights := bestSnippet(content, keySpans(content, lower, query))
+	if line != 5 || !strings.HasSuffix(snippet, "the cache misses and the cache fills the cache again") {
+		t.Errorf("expected the densest window, got line %d: %q", line, snippet)
+	}
+	if len(highlights) != 3 {
+		t.Fatalf("expected three highlights, got %+v", highlights)
+	}
+	for _, h := range highlights {
+		if snippet[h.Start:h.End] != "cache" {
+			t.Errorf("unexpected highlight %+v in %q", h, snippet)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// Google Fonts origins used by the SPA stylesheet link
+const (
+	googleFontsCSS   = "https://fonts.googleapis.com"
+	googleFontsFiles = "https://fonts.gstatic.com"
+)
+
+// SecurityHeaders sets the Content-Security-Policy, X-Content-Type-Options and Referrer-Policy
+// headers on every response, API and SPA alike
+func SecurityHeaders(cfg *config.Config) gin.HandlerFunc {
+	csp := ContentSecurityPolicy(cfg)
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("Content-Security-Policy", csp)
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+		c.Next()
+	}
+}
+
+// ContentSecurityPolicy returns security.csp when set, otherwise a policy allowing only the
+// SPA's own assets plus what the enabled render features need. Scripts never run inline, so
+// raw HTML in a document cannot execute even in html_mode "unsafe".
+func ContentSecurityPolicy(cfg *config.Config) string {
+	if cfg.Security.CSP != "" {
+		return cfg.Security.CSP
+	}
+
+	styles := []string{"'self'", googleFontsCSS}
+	if cfg.Render.Mermaid || cfg.Render.Diagrams == config.DiagramsServer {
+		// Mermaid styles each diagram through a <style> element inside its SVG, and so may the
+		// drawings of render.diagram_commands
+		styles = append(styles, "'unsafe-inline'")
+	}
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'self'",
+		"style-src " + strings.Join(styles, " "),
+		// The SPA and authored HTML set colours and visibility through style attributes
+		"style-src-attr 'unsafe-inline'",
+		"font-src 'self' " + googleFontsFiles,
+		"img-src " + imageSources(cfg.Render),
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'self'",
+	}
+	return strings.Join(directives, "; ")
+}
+
+// imageSources returns the img-src sources: any http or https image, as before the policy existed,
+// unless render.external_images restricts them to the allowed hosts, or to the server itself when
+// they are proxied
+func imageSources(render config.RenderConfig) string {
+	sources := []string{"'self'", "data:"}
+	switch render.ExternalImages {
+	case config.ExternalImagesBlock:
+		for _, host := range render.ImageHosts {
+			sources = append(sources, host)
+		}
+	case config.ExternalImagesProxy:
+	default:
+		sources = append(sources, "https:", "http:")
+	}
+	return strings.Join(sources, " ")
+}
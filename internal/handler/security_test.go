@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// styleSrc returns the style-src directive of a policy
+func styleSrc(csp string) string {
+	for _, d := range strings.Split(csp, "; ") {
+		if strings.HasPrefix(d, "style-src ") {
+			return d
+		}
+	}
+	return ""
+}
+
+func TestContentSecurityPolicyFollowsMermaid(t *testing.T) {
+	cfg := config.DefaultConfig()
+	withMermaid := ContentSecurityPolicy(cfg)
+	cfg.Render.Mermaid = false
+	withoutMermaid := ContentSecurityPolicy(cfg)
+
+	if withMermaid == withoutMermaid {
+		t.Fatal("expected toggling mermaid to change the policy")
+	}
+	if !strings.Contains(styleSrc(withMermaid), "'unsafe-inline'") {
+		t.Errorf("expected mermaid to allow inline style elements, got %q", styleSrc(withMermaid))
+	}
+	if strings.Contains(styleSrc(withoutMermaid), "'unsafe-inline'") {
+		t.Errorf("expected no inline style elements without mermaid, got %q", styleSrc(withoutMermaid))
+	}
+	for _, csp := range []string{withMermaid, withoutMermaid} {
+		if !strings.Contains(csp, "script-src 'self';") || !strings.Contains(csp, "object-src 'none'") {
+			t.Errorf("expected scripts restricted to the SPA's own assets, got %q", csp)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Security.CSP = "default-src 'none'"
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(SecurityHeaders(cfg))
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	if got := w.Header().Get("Content-Security-Policy"); got != "default-src 'none'" {
+		t.Errorf("expected security.csp to replace the policy, got %q", got)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Referrer-Policy") == "" {
+		t.Errorf("expected nosniff and a referrer policy, got %v", w.Header())
+	}
+}
+
+func TestSecurityHeadersAllowHTTPImagesByDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(SecurityHeaders(config.DefaultConfig()))
+	r.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	// Without external_images, plain http:// images render as they did before the policy
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "img-src 'self' data: https: http:;") {
+		t.Errorf("expected http and https images to be allowed, got %q", csp)
+	}
+}
+
+func TestIndexOmitsMermaidWhenDisabled(t *testing.T) {
+	index := "<html><title>x</title>\n" +
+		"    <script src=\"js/mermaid.min.js\"></script>\n" +
+		"    <script src=\"js/app.js\"></script></html>"
+	assets := fstest.MapFS{"index.html": {Data: []byte(index)}}
+	cfg := config.DefaultConfig()
+	h := NewStaticHandler(cfg, assets)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.NoRoute(h.Serve)
+
+	if body := getAsset(r, "/", "").Body.String(); !strings.Contains(body, "mermaid.min.js") {
+		t.Errorf("expected the mermaid script by default, got %s", body)
+	}
+	cfg.Render.Mermaid = false
+	body := getAsset(r, "/", "").Body.String()
+	if strings.Contains(body, "mermaid") || !strings.Contains(body, "js/app.js") {
+		t.Errorf("expected only the mermaid script to be dropped, got %s", body)
+	}
+}
+
+func TestContentSecurityPolicyFollowsExternalImages(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Render.ImageHosts = []string{"*.cdn.example"}
+	for mode, want := range map[string]string{
+		"":                         "img-src 'self' data: https: http:;",
+		config.ExternalImagesAllow: "img-src 'self' data: https: http:;",
+		config.ExternalImagesBlock: "img-src 'self' data: *.cdn.example;",
+		config.ExternalImagesProxy: "img-src 'self' data:;",
+	} {
+		cfg.Render.ExternalImages = mode
+		if csp := ContentSecurityPolicy(cfg); !strings.Contains(csp, want) {
+			t.Errorf("external_images %q: expected %q in %q", mode, want, csp)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/audit"
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSiteTitle is used when no branding title is configured
+const defaultSiteTitle = "MarkHub - Markdown Renderer"
+
+// accentColorPattern restricts accent colors to CSS hex notation so they are safe to inject
+var accentColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// faviconURL is where a local favicon is served, outside the API so browsers find it unprompted
+const faviconURL = "/favicon.ico"
+
+// logoContentTypes lists the image types a local logo or favicon may have; anything else is never served
+var logoContentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+	".ico":  "image/x-icon",
+}
+
+// BrandingResponse is the public branding payload consumed by the frontend
+type BrandingResponse struct {
+	Title       string `json:"title"`
+	AccentColor string `json:"accentColor,omitempty"`
+	LogoURL     string `json:"logoUrl,omitempty"`
+	FaviconURL  string `json:"faviconUrl,omitempty"`
+}
+
+// SettingsHandler handles instance-wide settings such as branding
+type SettingsHandler struct {
+	cfg   *config.Config
+	ws    *WSHandler
+	audit *audit.Logger
+}
+
+// NewSettingsHandler creates a new settings handler. Changes are broadcast via ws when non-nil.
+func NewSettingsHandler(cfg *config.Config, ws *WSHandler) *SettingsHandler {
+	return &SettingsHandler{cfg: cfg, ws: ws, audit: audit.New(cfg.GetAuditLogPath())}
+}
+
+// siteTitle returns the configured branding title or the default
+func siteTitle(cfg *config.Config) string {
+	if title := cfg.GetBranding().Title; title != "" {
+		return title
+	}
+	return defaultSiteTitle
+}
+
+// siteFavicon returns the URL of the configured favicon, or "" when there is none
+func siteFavicon(cfg *config.Config) string {
+	favicon := cfg.GetBranding().FaviconPath
+	if favicon == "" || isRemoteLogo(favicon) {
+		return favicon
+	}
+	return faviconURL
+}
+
+// isRemoteLogo reports whether the logo path is an absolute URL rather than a local file
+func isRemoteLogo(logoPath string) bool {
+	return strings.HasPrefix(logoPath, "http://") || strings.HasPrefix(logoPath, "https://")
+}
+
+func (h *SettingsHandler) branding() BrandingResponse {
+	branding := h.cfg.GetBranding()
+	resp := BrandingResponse{
+		Title:       siteTitle(h.cfg),
+		AccentColor: branding.AccentColor,
+		FaviconURL:  siteFavicon(h.cfg),
+	}
+	switch {
+	case branding.LogoPath == "":
+	case isRemoteLogo(branding.LogoPath):
+		resp.LogoURL = branding.LogoPath
+	default:
+		resp.LogoURL = "/api/" + APIVersion + "/branding/logo"
+	}
+	return resp
+}
+
+// GetBranding returns the public branding settings (no auth required)
+func (h *SettingsHandler) GetBranding(c *gin.Context) {
+	writeJSON(c, http.StatusOK, h.branding())
+}
+
+// GetLogo serves the configured local logo file with caching headers
+func (h *SettingsHandler) GetLogo(c *gin.Context) {
+	serveBrandingImage(c, "logo", h.cfg.GetBranding().LogoPath)
+}
+
+// GetFavicon serves the configured local favicon at /favicon.ico, or redirects to a remote one
+func (h *SettingsHandler) GetFavicon(c *gin.Context) {
+	favicon := h.cfg.GetBranding().FaviconPath
+	if isRemoteLogo(favicon) {
+		c.Redirect(http.StatusFound, favicon)
+		return
+	}
+	serveBrandingImage(c, "favicon", favicon)
+}
+
+// serveBrandingImage serves the local image file configured as the named branding setting
+func serveBrandingImage(c *gin.Context, name, imagePath string) {
+	if imagePath == "" || isRemoteLogo(imagePath) {
+		writeError(c, CodeNotFound, "no local "+name+" configured")
+		return
+	}
+	contentType, ok := logoContentTypes[strings.ToLower(filepath.Ext(imagePath))]
+	if !ok {
+		writeError(c, CodeNotFound, name+" must be an image file")
+		return
+	}
+	content, err := os.ReadFile(imagePath)
+	if err != nil {
+		writeError(c, CodeNotFound, name+" file not found")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// GetSettings returns the instance settings
+func (h *SettingsHandler) GetSettings(c *gin.Context) {
+	writeJSON(c, http.StatusOK, gin.H{
+		"theme":    h.cfg.Theme,
+		"branding": h.cfg.GetBranding(),
+	})
+}
+
+// UpdateSettingsRequest represents a request to update instance settings
+type UpdateSettingsRequest struct {
+	Branding *config.Branding `json:"branding"`
+}
+
+// UpdateSettings updates the instance settings and broadcasts settingsChanged
+func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, CodeInvalidRequest, "invalid request")
+		return
+	}
+
+	before := h.cfg.GetBranding()
+	if req.Branding != nil {
+		if req.Branding.AccentColor != "" && !accentColorPattern.MatchString(req.Branding.AccentColor) {
+			writeError(c, CodeInvalidRequest, "accent_color must be a hex color like #3b82f6")
+			return
+		}
+		// A local logo or favicon is served without auth, so only the config file may point it at a file
+		logoPath := req.Branding.LogoPath
+		if logoPath != "" && logoPath != before.LogoPath && !isRemoteLogo(logoPath) {
+			writeError(c, CodeInvalidRequest,
+				"logo_path must be an http(s) URL; local logo files can only be set in the config file")
+			return
+		}
+		favicon := req.Branding.FaviconPath
+		if favicon != "" && favicon != before.FaviconPath && !isRemoteLogo(favicon) {
+			writeError(c, CodeInvalidRequest,
+				"favicon must be an http(s) URL; local favicon files can only be set in the config file")
+			return
+		}
+		h.cfg.SetBranding(*req.Branding)
+	}
+
+	if err := h.cfg.Save(); err != nil {
+		writeError(c, CodeConfigSaveFailed, "failed to save config: "+err.Error())
+		return
+	}
+
+	recordAudit(h.audit, c, "settings.update", gin.H{"branding": before}, gin.H{"branding": h.cfg.GetBranding()})
+
+	if h.ws != nil {
+		h.ws.broadcast(WSMessage{
+			Type:    "settingsChanged",
+			Payload: h.branding(),
+		})
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"message":  "settings updated",
+		"branding": h.cfg.GetBranding(),
+	})
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func newSettingsRouter(t *testing.T, branding config.Branding) (*gin.Engine, *config.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := config.DefaultConfig()
+	cfg.Ephemeral = true
+	cfg.Branding = branding
+
+	h := NewSettingsHandler(cfg, nil)
+	r := gin.New()
+	r.GET("/branding", h.GetBranding)
+	r.GET("/branding/logo", h.GetLogo)
+	r.GET("/favicon.ico", h.GetFavicon)
+	r.PUT("/settings", h.UpdateSettings)
+	return r, cfg
+}
+
+func putSettings(r http.Handler, branding config.Branding) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(UpdateSettingsRequest{Branding: &branding})
+	req := httptest.NewRequest(http.MethodPut, "/settings", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetBranding(t *testing.T) {
+	r, _ := newSettingsRouter(t,
+		config.Branding{AccentColor: "#123456", LogoPath: "/srv/logo.png", FaviconPath: "/srv/favicon.ico"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/branding", nil))
+	var got BrandingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := BrandingResponse{
+		Title:       defaultSiteTitle,
+		AccentColor: "#123456",
+		LogoURL:     "/api/" + APIVersion + "/branding/logo",
+		FaviconURL:  "/favicon.ico",
+	}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestGetLogoServesOnlyImages(t *testing.T) {
+	dir := t.TempDir()
+	logo := filepath.Join(dir, "logo.png")
+	secret := filepath.Join(dir, "id_rsa")
+	for _, path := range []string{logo, secret} {
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, _ := newSettingsRouter(t, config.Branding{LogoPath: logo})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/branding/logo", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected the png logo, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	r, _ = newSettingsRouter(t, config.Branding{LogoPath: secret})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/branding/logo", nil))
+	if w.Code != http.StatusNotFound || w.Body.String() == "data" {
+		t.Errorf("expected a non-image logo_path to be refused, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestGetFavicon(t *testing.T) {
+	favicon := filepath.Join(t.TempDir(), "favicon.ico")
+	if err := os.WriteFile(favicon, []byte("icon"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := newSettingsRouter(t, config.Branding{FaviconPath: favicon})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/x-icon" || w.Body.String() != "icon" {
+		t.Errorf("expected the local favicon, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	r, _ = newSettingsRouter(t, config.Branding{FaviconPath: "https://example.com/icon.png"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/icon.png" {
+		t.Errorf("expected a redirect to the remote favicon, got %d %v", w.Code, w.Header())
+	}
+
+	r, _ = newSettingsRouter(t, config.Branding{})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a favicon, got %d", w.Code)
+	}
+}
+
+func TestUpdateSettingsBranding(t *testing.T) {
+	r, cfg := newSettingsRouter(t, config.Branding{LogoPath: "/srv/logo.png"})
+
+	tests := []struct {
+		name     string
+		branding config.Branding
+		want     int
+	}{
+		{"local logo path", config.Branding{LogoPath: "/root/.ssh/id_rsa"}, http.StatusBadRequest},
+		{"relative logo path", config.Branding{LogoPath: "logo.png"}, http.StatusBadRequest},
+		{"bad accent color", config.Branding{AccentColor: "red"}, http.StatusBadRequest},
+		{"local favicon", config.Branding{FaviconPath: "/etc/passwd.ico"}, http.StatusBadRequest},
+		{"unchanged local logo", config.Branding{Title: "Docs", LogoPath: "/srv/logo.png"}, http.StatusOK},
+		{
+			"remote logo",
+			config.Branding{
+				Title: "Docs", AccentColor: "#abc", LogoPath: "https://example.com/logo.svg",
+				FaviconPath: "https://example.com/favicon.png",
+			},
+			http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		if w := putSettings(r, tt.branding); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+	if cfg.Branding.LogoPath != "https://example.com/logo.svg" || cfg.Branding.Title != "Docs" {
+		t.Errorf("unexpected branding after updates: %+v", cfg.Branding)
+	}
+}
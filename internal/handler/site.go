@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+)
+
+// WarmProgress reports a document rendered by Warm or WriteSite
+type WarmProgress struct {
+	Done  int
+	Total int
+	Path  string
+	// Err is set when the document (or, with Total 0, the folder at Path) could not be rendered
+	Err error
+}
+
+// WarmReport counts the documents Warm or WriteSite rendered and failed to render
+type WarmReport struct {
+	Rendered int
+	Failed   int
+}
+
+// siteAssetsDir is the directory of a static site holding the stylesheets
+const siteAssetsDir = "assets"
+
+// hrefRe matches the href attributes of rendered markdown; group 1 is the value
+var hrefRe = regexp.MustCompile(`href="([^"]*)"`)
+
+var sitePage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{range .Styles}}<link rel="stylesheet" href="{{$.Root}}{{.}}">
+{{end}}</head>
+<body>
+<header class="content-header"><a href="{{.Root}}index.html">{{.SiteTitle}}</a></header>
+<main class="content"><div class="markdown-body">{{.HTML}}</div></main>
+</body>
+</html>
+`))
+
+var siteIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.SiteTitle}}</title>
+{{range .Styles}}<link rel="stylesheet" href="{{.}}">
+{{end}}</head>
+<body>
+<main class="content"><div class="markdown-body">
+<h1>{{.SiteTitle}}</h1>
+{{range .Folders}}<h2>{{.Alias}}</h2>
+<ul>
+{{range .Pages}}<li><a href="{{.Href}}">{{.Title}}</a></li>
+{{end}}</ul>
+{{end}}</div></main>
+</body>
+</html>
+`))
+
+// sitePageData fills sitePage
+type sitePageData struct {
+	Title     string
+	SiteTitle string
+	Root      string
+	Styles    []string
+	HTML      template.HTML
+}
+
+// siteFolder lists the pages of one folder on the index page
+type siteFolder struct {
+	Alias string
+	Pages []sitePageLink
+}
+
+type sitePageLink struct {
+	Href  string
+	Title string
+}
+
+// documents returns the alias-prefixed path of every document the tree shows, by folder in tree
+// order. Folders that cannot be read are reported to progress and skipped.
+func (h *ExportHandler) documents(ctx context.Context, progress func(WarmProgress)) map[string][]string {
+	docs := map[string][]string{}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		tree, err := h.tree.folderTree(ctx, folder)
+		if err != nil {
+			progress(WarmProgress{Path: folder.Alias, Err: err})
+			continue
+		}
+		for _, node := range collectFiles(tree, nil) {
+			docs[folder.Alias] = append(docs[folder.Alias], node.Path)
+		}
+	}
+	return docs
+}
+
+// Warm renders every document the tree shows, so the parse cache holds them before the first
+// request, reporting each one to progress. It stops early when ctx is done.
+func (h *ExportHandler) Warm(ctx context.Context, progress func(WarmProgress)) WarmReport {
+	var report WarmReport
+	docs := h.documents(ctx, progress)
+	total := 0
+	for _, paths := range docs {
+		total += len(paths)
+	}
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		for _, p := range docs[folder.Alias] {
+			if ctx.Err() != nil {
+				return report
+			}
+			_, err := h.files.Render(ctx, p)
+			if err != nil {
+				report.Failed++
+			} else {
+				report.Rendered++
+			}
+			progress(WarmProgress{Done: report.Rendered + report.Failed, Total: total, Path: p, Err: err})
+		}
+	}
+	return report
+}
+
+// WriteSite renders every document the tree shows into a static HTML site in dir: one page per
+// document at its alias-prefixed path with an .html extension, an index.html listing them, the
+// files they link to, and the stylesheets of styles under assets/. Links between documents point at
+// their pages. It reports each document to progress and stops early when ctx is done.
+func (h *ExportHandler) WriteSite(
+	ctx context.Context, dir string, styles fs.FS, progress func(WarmProgress),
+) (WarmReport, error) {
+	var report WarmReport
+	stylesheets, err := copyAssets(styles, filepath.Join(dir, siteAssetsDir))
+	if err != nil {
+		return report, err
+	}
+	siteTitle := siteTitle(h.cfg)
+
+	docs := h.documents(ctx, progress)
+	total := 0
+	for _, paths := range docs {
+		total += len(paths)
+	}
+	copied := map[string]bool{}
+	var folders []siteFolder
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		paths, ok := docs[folder.Alias]
+		if !ok {
+			continue
+		}
+		index := siteFolder{Alias: folder.Alias}
+		for _, p := range paths {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			title, _, err := h.writePage(ctx, dir, p, siteTitle, stylesheets, copied)
+			if err != nil {
+				report.Failed++
+			} else {
+				report.Rendered++
+				index.Pages = append(index.Pages, sitePageLink{Href: pagePath(p), Title: title})
+			}
+			progress(WarmProgress{Done: report.Rendered + report.Failed, Total: total, Path: p, Err: err})
+		}
+		folders = append(folders, index)
+	}
+
+	return report, writeIndex(dir, siteTitle, stylesheets, folders)
+}
+
+// writeIndex writes the index.html of the site in dir, listing the pages of folders
+func writeIndex(dir, siteTitle string, stylesheets []string, folders []siteFolder) error {
+	var buf bytes.Buffer
+	err := siteIndex.Execute(&buf, map[string]any{
+		"SiteTitle": siteTitle,
+		"Styles":    prefixAll(siteAssetsDir+"/", stylesheets),
+		"Folders":   folders,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), buf.Bytes(), 0644)
+}
+
+// writePage renders the document at filePath into its page under dir, copying the local files it
+// links to, and returns its title and table of contents
+func (h *ExportHandler) writePage(
+	ctx context.Context, dir, filePath, siteTitle string, stylesheets []string, copied map[string]bool,
+) (string, []markdown.TOCItem, error) {
+	doc, err := h.files.parse(ctx, filePath, RenderOptions{})
+	if err != nil {
+		return "", nil, err
+	}
+	page := pagePath(filePath)
+	target, ok := siteFile(dir, page)
+	if !ok {
+		return "", nil, ErrInvalidPath
+	}
+	title := doc.result.Title
+	if title == "" {
+		title = path.Base(filePath)
+	}
+	root := strings.Repeat("../", strings.Count(page, "/"))
+
+	var buf bytes.Buffer
+	err = sitePage.Execute(&buf, sitePageData{
+		Title:     title,
+		SiteTitle: siteTitle,
+		Root:      root,
+		Styles:    prefixAll(siteAssetsDir+"/", stylesheets),
+		HTML:      template.HTML(h.rewriteDocumentLinks(doc.result.HTML)),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(target, buf.Bytes(), 0644); err != nil {
+		return "", nil, err
+	}
+
+	// Images and other linked files are copied next to the pages, keeping relative links working
+	for _, link := range doc.result.Links {
+		dest, ok := markdown.RelativeTarget(link.Dest)
+		if !ok || h.cfg.IsMarkdownFile(dest) {
+			continue
+		}
+		rel, inside := linkTarget(doc.relativePath, dest)
+		linked := doc.folder.Alias + "/" + rel
+		if !inside || rel == "" || copied[linked] {
+			continue
+		}
+		copied[linked] = true
+		if err := copyLinkedFile(doc.fs, rel, dir, linked); err != nil {
+			return "", nil, fmt.Errorf("copying %s: %w", dest, err)
+		}
+	}
+	return title, doc.result.TOC, nil
+}
+
+// copyLinkedFile copies the file at rel in fsys to sitePath under dir. Missing files and
+// directories are left out, as the document's links to them are broken anyway.
+func copyLinkedFile(fsys mfs.FileSystem, rel, dir, sitePath string) error {
+	data, err := fsys.ReadFile(rel)
+	if err != nil {
+		return nil
+	}
+	target, ok := siteFile(dir, sitePath)
+	if !ok {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
+
+// rewriteDocumentLinks points the relative links of rendered HTML at the pages of the markdown
+// files they name, keeping any fragment
+func (h *ExportHandler) rewriteDocumentLinks(html string) string {
+	return hrefRe.ReplaceAllStringFunc(html, func(attr string) string {
+		href := hrefRe.FindStringSubmatch(attr)[1]
+		dest, fragment, _ := strings.Cut(href, "#")
+		target, ok := markdown.RelativeTarget(dest)
+		if !ok || strings.Contains(dest, "?") || !h.cfg.IsMarkdownFile(target) {
+			return attr
+		}
+		dest = strings.TrimSuffix(dest, path.Ext(target)) + ".html"
+		if fragment != "" {
+			dest += "#" + fragment
+		}
+		return `href="` + dest + `"`
+	})
+}
+
+// pagePath returns the site path of the page of the document at an alias-prefixed path
+func pagePath(filePath string) string {
+	return strings.TrimSuffix(filePath, path.Ext(filePath)) + ".html"
+}
+
+// siteFile returns where the slash-separated site path rel is written under dir, or false when
+// it would leave dir
+func siteFile(dir, rel string) (string, bool) {
+	rel = path.Clean(rel)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return "", false
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), true
+}
+
+// copyAssets copies the stylesheets of styles into dir and returns their paths relative to it
+func copyAssets(styles fs.FS, dir string) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(styles, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".css" {
+			return err
+		}
+		data, err := fs.ReadFile(styles, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return os.WriteFile(target, data, 0644)
+	})
+	return names, err
+}
+
+// prefixAll returns paths with prefix prepended to each
+func prefixAll(prefix string, paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[i] = prefix + p
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CageChen/markhub/internal/config"
+)
+
+func newSiteExport(t *testing.T) (*ExportHandler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "README.md"),
+		"# Home\n\nSee [guide](guide/intro.md#start), ![logo](logo.png) and [abs](https://example.com/a.md).\n")
+	writeDoc(t, filepath.Join(dir, "guide", "intro.md"), "# Intro\n\n[up](../README.md)\n")
+	writeDoc(t, filepath.Join(dir, "logo.png"), "png")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	return NewExportHandler(cfg, NewTreeHandler(cfg), NewFileHandler(cfg)), dir
+}
+
+func TestWarmFillsParseCache(t *testing.T) {
+	h, dir := newSiteExport(t)
+	var seen []string
+	report := h.Warm(context.Background(), func(p WarmProgress) { seen = append(seen, p.Path) })
+	if report.Rendered != 2 || report.Failed != 0 || len(seen) != 2 {
+		t.Fatalf("unexpected report %+v for %v", report, seen)
+	}
+	key := "docs\x00" + h.cfg.Folders[0].HTMLMode + "\x00false\x00README.md"
+	content, err := os.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.files.cachedParse(key, ETag(content)); !ok {
+		t.Error("expected README.md to be cached")
+	}
+
+	// A changed file misses the cache
+	writeDoc(t, filepath.Join(dir, "README.md"), "# Changed\n")
+	resp, err := h.files.Render(context.Background(), "docs/README.md")
+	if err != nil || resp.Title != "Changed" {
+		t.Errorf("expected the changed document to be rendered again, got %+v, %v", resp, err)
+	}
+}
+
+func TestWriteSite(t *testing.T) {
+	h, _ := newSiteExport(t)
+	out := t.TempDir()
+	styles := fstest.MapFS{"style.css": {Data: []byte("body{}")}}
+	report, err := h.WriteSite(context.Background(), out, styles, func(WarmProgress) {})
+	if err != nil || report.Rendered != 2 {
+		t.Fatalf("unexpected report %+v, %v", report, err)
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	home := read("docs/README.html")
+	for _, want := range []string{
+		`href="guide/intro.html#start"`, `href="https://example.com/a.md"`, `href="../assets/style.css"`,
+		`<title>Home</title>`,
+	} {
+		if !strings.Contains(home, want) {
+			t.Errorf("expected README.html to contain %s:\n%s", want, home)
+		}
+	}
+	if intro := read("docs/guide/intro.html"); !strings.Contains(intro, `href="../../assets/style.css"`) ||
+		!strings.Contains(intro, `href="../README.html"`) {
+		t.Errorf("unexpected intro.html:\n%s", intro)
+	}
+	if index := read("index.html"); !strings.Contains(index, `<a href="docs/guide/intro.html">Intro</a>`) {
+		t.Errorf("expected index.html to list the documents:\n%s", index)
+	}
+	if read("docs/logo.png") != "png" || read("assets/style.css") != "body{}" {
+		t.Error("expected the linked image and the stylesheet to be copied")
+	}
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// titlePattern matches the <title> element of the SPA index page
+var titlePattern = regexp.MustCompile(`<title>[^<]*</title>`)
+
+// mermaidScriptPattern matches the index page's mermaid script tag, dropped when render.mermaid is off
+var mermaidScriptPattern = regexp.MustCompile(`\s*<script src="js/mermaid\.min\.js"></script>`)
+
+// fallbackPage is served instead of index.html when the web assets lack it, so that a server
+// built without its frontend explains itself rather than showing a blank page
+var fallbackPage = template.Must(template.New("fallback").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>body{font-family:sans-serif;max-width:40em;margin:3em auto;padding:0 1em;line-height:1.5}</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>The web interface is missing from this build: no <code>index.html</code> was embedded from
+<code>cmd/markhub/web</code>. Rebuild from a checkout where that directory is populated, for example with
+<code>make build</code>.</p>
+<p>The API is available:</p>
+<ul>
+{{range .Links}}<li><a href="{{.}}">{{.}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// fallbackLinks are the API endpoints the fallback page points to
+var fallbackLinks = []string{"health", "version", "capabilities", "openapi.json", "tree"}
+
+// WebAssetsMissing reports whether assets lack the frontend's index.html, as when the server is
+// built from a source tree whose web directory was not populated
+func WebAssetsMissing(assets fs.FS) bool {
+	_, err := fs.Stat(assets, "index.html")
+	return err != nil
+}
+
+// StaticHandler serves the embedded frontend, injecting branding into index.html
+type StaticHandler struct {
+	cfg        *config.Config
+	assets     fs.FS
+	fileServer http.Handler
+	encoded    map[string]*encodedAsset
+}
+
+// NewStaticHandler creates a handler serving the given web assets.
+// Compressible assets are gzip/brotli-encoded once here rather than per request.
+func NewStaticHandler(cfg *config.Config, assets fs.FS) *StaticHandler {
+	return &StaticHandler{
+		cfg:        cfg,
+		assets:     assets,
+		fileServer: http.FileServer(http.FS(assets)),
+		encoded:    precompressAssets(assets),
+	}
+}
+
+// Serve serves a static asset, rendering index.html with the configured site title, favicon and render features
+func (h *StaticHandler) Serve(c *gin.Context) {
+	p := c.Request.URL.Path
+	if p != "/" && p != "/index.html" {
+		h.serveAsset(c, p)
+		return
+	}
+
+	data, err := fs.ReadFile(h.assets, "index.html")
+	if err != nil {
+		h.serveFallback(c)
+		return
+	}
+	title := "<title>" + html.EscapeString(siteTitle(h.cfg)) + "</title>"
+	if favicon := siteFavicon(h.cfg); favicon != "" {
+		title += `<link rel="icon" href="` + html.EscapeString(favicon) + `">`
+	}
+	data = titlePattern.ReplaceAllLiteral(data, []byte(title))
+	if !h.cfg.Render.Mermaid {
+		data = mermaidScriptPattern.ReplaceAll(data, nil)
+	}
+
+	setCacheControl(c, h.cfg.Cache.HTMLControl())
+	c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+}
+
+// serveAsset serves a precompressed variant when the client accepts one, otherwise the original file.
+// Stylesheets get the cache.css header and other existing assets the cache.asset one.
+func (h *StaticHandler) serveAsset(c *gin.Context, urlPath string) {
+	name := strings.TrimPrefix(path.Clean(urlPath), "/")
+	if info, err := fs.Stat(h.assets, name); err == nil && !info.IsDir() {
+		if path.Ext(name) == ".css" {
+			setCacheControl(c, h.cfg.Cache.CSSControl())
+		} else {
+			setCacheControl(c, h.cfg.Cache.AssetControl())
+		}
+	}
+	asset, ok := h.encoded[name]
+	if !ok {
+		h.fileServer.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	c.Header("Vary", "Accept-Encoding")
+	enc := negotiateEncoding(c.GetHeader("Accept-Encoding"), asset.variants)
+	if enc == "" {
+		h.fileServer.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	contentType := asset.contentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	data := asset.variants[enc]
+	c.Header("Content-Encoding", enc)
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// serveFallback answers for a missing index.html with a page explaining it and linking to the API
+func (h *StaticHandler) serveFallback(c *gin.Context) {
+	links := make([]string, len(fallbackLinks))
+	for i, link := range fallbackLinks {
+		links[i] = "/api/" + APIVersion + "/" + link
+	}
+	var buf bytes.Buffer
+	data := struct {
+		Title string
+		Links []string
+	}{siteTitle(h.cfg), links}
+	if err := fallbackPage.Execute(&buf, data); err != nil {
+		c.String(http.StatusServiceUnavailable, "web interface missing from this build")
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusServiceUnavailable, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+var testScript = []byte(strings.Repeat("function render() { return document.body.innerHTML; }\n", 200))
+
+func newStaticRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	assets := fstest.MapFS{
+		"index.html": {Data: []byte("<html><title>x</title></html>")},
+		"js/app.js":  {Data: testScript},
+		"logo.png":   {Data: []byte("\x89PNG not really")},
+	}
+	r := gin.New()
+	r.NoRoute(NewStaticHandler(config.DefaultConfig(), assets).Serve)
+	return r
+}
+
+func getAsset(r http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestStaticServesPrecompressedVariants(t *testing.T) {
+	r := newStaticRouter(t)
+
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip, deflate, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"br;q=0, gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"*", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	}
+
+	for _, tt := range tests {
+		w := getAsset(r, "/js/app.js", tt.acceptEncoding)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d", tt.acceptEncoding, w.Code)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("%q: expected Content-Encoding %q, got %q", tt.acceptEncoding, tt.wantEncoding, got)
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("%q: Content-Length %s does not match body length %d", tt.acceptEncoding, got, w.Body.Len())
+		}
+		if w.Body.Len() >= len(testScript) {
+			t.Errorf("%q: body was not compressed (%d bytes)", tt.acceptEncoding, w.Body.Len())
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/javascript") {
+			t.Errorf("%q: unexpected Content-Type %q", tt.acceptEncoding, w.Header().Get("Content-Type"))
+		}
+
+		reader, err := tt.decode(w.Body)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.acceptEncoding, err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.acceptEncoding, err)
+		}
+		if !bytes.Equal(decoded, testScript) {
+			t.Errorf("%q: decoded body does not match the original asset", tt.acceptEncoding)
+		}
+	}
+}
+
+func TestStaticFallsBackToIdentity(t *testing.T) {
+	r := newStaticRouter(t)
+
+	for _, acceptEncoding := range []string{"", "identity", "deflate", "gzip;q=0, br;q=0"} {
+		w := getAsset(r, "/js/app.js", acceptEncoding)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: expected 200, got %d", acceptEncoding, w.Code)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%q: expected no Content-Encoding, got %q", acceptEncoding, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%q: expected Vary: Accept-Encoding, got %q", acceptEncoding, got)
+		}
+		if !bytes.Equal(w.Body.Bytes(), testScript) {
+			t.Errorf("%q: expected the original asset", acceptEncoding)
+		}
+	}
+}
+
+func TestStaticSkipsIncompressibleAssets(t *testing.T) {
+	r := newStaticRouter(t)
+
+	w := getAsset(r, "/logo.png", "gzip, br")
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("expected no Content-Encoding for png, got %q", got)
+	}
+	if w.Body.String() != "\x89PNG not really" {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestStaticInjectsBranding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.DefaultConfig()
+	cfg.Branding = config.Branding{Title: "Team <Docs>", FaviconPath: "/srv/favicon.ico"}
+	assets := fstest.MapFS{"index.html": {Data: []byte("<html><title>x</title></html>")}}
+	r := gin.New()
+	r.NoRoute(NewStaticHandler(cfg, assets).Serve)
+
+	w := getAsset(r, "/", "")
+	want := `<html><title>Team &lt;Docs&gt;</title><link rel="icon" href="/favicon.ico"></html>`
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("index = %d %q, want %q", w.Code, w.Body.String(), want)
+	}
+}
+
+func TestStaticFallbackWithoutIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assets := fstest.MapFS{"js/app.js": {Data: testScript}}
+	if !WebAssetsMissing(assets) {
+		t.Fatal("expected assets without index.html to be reported missing")
+	}
+	r := gin.New()
+	r.NoRoute(NewStaticHandler(config.DefaultConfig(), assets).Serve)
+
+	for _, path := range []string{"/", "/index.html"} {
+		w := getAsset(r, path, "")
+		if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "web interface is missing") ||
+			!strings.Contains(w.Body.String(), `href="/api/v1/openapi.json"`) {
+			t.Errorf("%s: unexpected fallback %d %s", path, w.Code, w.Body.String())
+		}
+	}
+	if w := getAsset(r, "/js/app.js", ""); w.Code != http.StatusOK {
+		t.Errorf("expected the other assets to be served, got %d", w.Code)
+	}
+	if WebAssetsMissing(fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}) {
+		t.Error("expected assets with index.html not to be reported missing")
+	}
+}
+
+func TestStaticCacheControl(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assets := fstest.MapFS{
+		"index.html":    {Data: []byte("<html><title>x</title></html>")},
+		"js/app.js":     {Data: testScript},
+		"css/style.css": {Data: []byte(strings.Repeat("body { margin: 0; }\n", 100))},
+	}
+	serve := func(cfg *config.Config, path string) string {
+		r := gin.New()
+		r.NoRoute(NewStaticHandler(cfg, assets).Serve)
+		return getAsset(r, path, "gzip").Header().Get("Cache-Control")
+	}
+
+	defaults := config.DefaultConfig()
+	for path, want := range map[string]string{"/": "no-cache", "/js/app.js": "", "/css/style.css": ""} {
+		if got := serve(defaults, path); got != want {
+			t.Errorf("default %s: Cache-Control = %q, want %q", path, got, want)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Cache = config.CacheConfig{HTML: "none", Asset: "public, max-age=86400", CSS: "public, max-age=3600"}
+	for path, want := range map[string]string{
+		"/":              "",
+		"/js/app.js":     "public, max-age=86400",
+		"/css/style.css": "public, max-age=3600",
+		"/js/missing.js": "",
+	} {
+		if got := serve(cfg, path); got != want {
+			t.Errorf("configured %s: Cache-Control = %q, want %q", path, got, want)
+		}
+	}
+}
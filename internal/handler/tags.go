@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+// tagEntry is a document's front matter tags, keyed by the file's mod time and size. labels holds
+// each tag as the document writes it.
+type tagEntry struct {
+	modTime time.Time
+	size    int64
+	tags    []string
+	labels  []string
+}
+
+// tagCache remembers the front matter tags of documents by alias-prefixed path. Unlike titleCache
+// it survives tree invalidations: entries are checked against the file's mod time and size, and
+// watcher events update them one file at a time.
+type tagCache struct {
+	mu      sync.RWMutex
+	entries map[string]tagEntry
+}
+
+func newTagCache() *tagCache {
+	return &tagCache{entries: make(map[string]tagEntry)}
+}
+
+// get returns the tags of the file node, reading it only when missing or modified
+func (tc *tagCache) get(fs mfs.FileSystem, relPath string, node *TreeNode) []string {
+	return tc.entry(fs, relPath, node).tags
+}
+
+// entry returns the tags of the file node with their labels, reading it only when missing or
+// modified. Files of git_ref folders are checked the same way, so a moved ref is picked up when the
+// tree is next built.
+func (tc *tagCache) entry(fs mfs.FileSystem, relPath string, node *TreeNode) tagEntry {
+	var modTime time.Time
+	if node.ModTime != nil {
+		modTime = node.ModTime.Time
+	}
+
+	tc.mu.RLock()
+	entry, ok := tc.entries[node.Path]
+	tc.mu.RUnlock()
+	if ok && entry.modTime.Equal(modTime) && entry.size == node.Size {
+		return entry
+	}
+	return tc.load(fs, relPath, node.Path, modTime, node.Size)
+}
+
+// load reads the tags of the file at relPath and stores them under path
+func (tc *tagCache) load(fs mfs.FileSystem, relPath, path string, modTime time.Time, size int64) tagEntry {
+	content, err := fs.ReadFile(relPath)
+	if err != nil {
+		return tagEntry{}
+	}
+	entry := tagEntry{modTime: modTime, size: size}
+	entry.tags, entry.labels = markdown.LabeledTags(content)
+	tc.mu.Lock()
+	tc.entries[path] = entry
+	tc.mu.Unlock()
+	return entry
+}
+
+// remove drops the entry of path and of every file below it
+func (tc *tagCache) remove(path string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	delete(tc.entries, path)
+	prefix := path + "/"
+	for p := range tc.entries {
+		if strings.HasPrefix(p, prefix) {
+			delete(tc.entries, p)
+		}
+	}
+}
+
+// updateFileCaches re-reads the tags and links of a changed file of a local folder, or forgets a
+// removed one
+func (h *TreeHandler) updateFileCaches(e watcher.Event) {
+	for _, folder := range h.cfg.FoldersSnapshot() {
+		if folder.GitRef != "" {
+			continue
+		}
+		relPath, err := filepath.Rel(folder.Path, e.Path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			continue
+		}
+		relPath = filepath.ToSlash(relPath)
+		aliasPath := folder.Alias + "/" + relPath
+		if e.Type == watcher.EventRemove || e.Type == watcher.EventRename {
+			h.tags.remove(aliasPath)
+			h.links.remove(aliasPath)
+			continue
+		}
+		fs := fsForFolder(context.Background(), folder)
+		info, err := fs.Stat(relPath)
+		if err != nil || !h.fileVisible(folder, relPath, info) {
+			continue
+		}
+		h.tags.load(fs, relPath, aliasPath, info.ModTime, info.Size)
+		h.links.load(fs, relPath, aliasPath, info.ModTime, info.Size)
+	}
+}
+
+// tagFilter selects documents by tag: they must carry every tag of all and, when any is set, at
+// least one of any
+type tagFilter struct {
+	all []string
+	any []string
+}
+
+// parseTagFilter reads a tagFilter from comma-separated lists of tags
+func parseTagFilter(all, any string) tagFilter {
+	return tagFilter{all: splitTags(all), any: splitTags(any)}
+}
+
+func splitTags(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return markdown.NormalizeTags(strings.Split(list, ","))
+}
+
+func (f tagFilter) empty() bool {
+	return len(f.all) == 0 && len(f.any) == 0
+}
+
+// matches reports whether a document with the sorted tags passes the filter
+func (f tagFilter) matches(tags []string) bool {
+	for _, tag := range f.all {
+		if _, found := slices.BinarySearch(tags, tag); !found {
+			return false
+		}
+	}
+	if len(f.any) == 0 {
+		return true
+	}
+	for _, tag := range f.any {
+		if _, found := slices.BinarySearch(tags, tag); found {
+			return true
+		}
+	}
+	return false
+}
+
+// TagCount is a tag and the number of documents carrying it. Tag is lowercased; Label is the
+// spelling most documents use, for display.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// FolderTags lists the tags used in one folder
+type FolderTags struct {
+	FolderID string     `json:"folderId"`
+	Alias    string     `json:"alias"`
+	Tags     []TagCount `json:"tags"`
+}
+
+// TagsResponse lists the tags used across all folders and in each of them, most used first
+type TagsResponse struct {
+	Tags    []TagCount   `json:"tags"`
+	Folders []FolderTags `json:"folders"`
+}
+
+// GetTags counts the front matter tags of every document the tree shows, across all folders or the
+// one named by ?folder= or ?folderId=
+func (h *TreeHandler) GetTags(c *gin.Context) {
+	folders, ok := h.tagFolders(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	resp := TagsResponse{Folders: []FolderTags{}}
+	total := newTagTally()
+	for _, folder := range folders {
+		tree, err := h.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		fs := fsForFolder(ctx, folder)
+		counts := newTagTally()
+		for _, file := range collectFiles(tree, nil) {
+			entry := h.tags.entry(fs, strings.TrimPrefix(file.Path, folder.Alias+"/"), file)
+			counts.add(entry)
+			total.add(entry)
+		}
+		resp.Folders = append(resp.Folders, FolderTags{
+			FolderID: folder.ID, Alias: folder.Alias, Tags: counts.list(),
+		})
+	}
+	if requestDone(c) {
+		return
+	}
+	resp.Tags = total.list()
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// TaggedDocument is a document carrying a tag
+type TaggedDocument struct {
+	Path    string          `json:"path"`
+	Title   string          `json:"title,omitempty"`
+	ModTime *timestamp.Time `json:"modTime,omitempty"`
+}
+
+// TagDocumentsResponse lists the documents carrying a tag, most recently modified first
+type TagDocumentsResponse struct {
+	Tag       string           `json:"tag"`
+	Label     string           `json:"label"`
+	Documents []TaggedDocument `json:"documents"`
+}
+
+// GetTagDocuments lists the documents the tree shows that carry the tag, across all folders or the
+// one named by ?folder= or ?folderId=. The tag matches in any casing.
+func (h *TreeHandler) GetTagDocuments(c *gin.Context) {
+	normalized := markdown.NormalizeTags([]string{c.Param("tag")})
+	if len(normalized) == 0 {
+		writeError(c, CodeInvalidRequest, "tag is required")
+		return
+	}
+	tag := normalized[0]
+	folders, ok := h.tagFolders(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	resp := TagDocumentsResponse{Tag: tag, Documents: []TaggedDocument{}}
+	tally := newTagTally()
+	for _, folder := range folders {
+		tree, err := h.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		fs := fsForFolder(ctx, folder)
+		for _, file := range collectFiles(tree, nil) {
+			relPath := strings.TrimPrefix(file.Path, folder.Alias+"/")
+			entry := h.tags.entry(fs, relPath, file)
+			if _, found := slices.BinarySearch(entry.tags, tag); !found {
+				continue
+			}
+			tally.add(entry)
+			resp.Documents = append(resp.Documents, TaggedDocument{
+				Path: file.Path, Title: h.titles.get(fs, relPath, file), ModTime: file.ModTime,
+			})
+		}
+	}
+	if requestDone(c) {
+		return
+	}
+	resp.Label = tally.label(tag)
+	sort.SliceStable(resp.Documents, func(i, j int) bool {
+		a, b := resp.Documents[i].ModTime, resp.Documents[j].ModTime
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.After(b.Time)
+	})
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// tagFolders returns the folder named by ?folder= or ?folderId=, or every folder when neither is
+// set. It writes CodeFolderNotFound and returns false for an unknown folder.
+func (h *TreeHandler) tagFolders(c *gin.Context) ([]config.Folder, bool) {
+	if c.Query("folder") == "" && c.Query("folderId") == "" {
+		return h.cfg.FoldersSnapshot(), true
+	}
+	folder, ok := h.findFolder(c)
+	if !ok {
+		writeError(c, CodeFolderNotFound, "folder not found")
+		return nil, false
+	}
+	return []config.Folder{folder}, true
+}
+
+// tagTally counts the documents carrying each tag, and how many of them spell it each way
+type tagTally struct {
+	counts    map[string]int
+	spellings map[string]map[string]int
+}
+
+func newTagTally() *tagTally {
+	return &tagTally{counts: map[string]int{}, spellings: map[string]map[string]int{}}
+}
+
+// add counts the tags of a document
+func (t *tagTally) add(entry tagEntry) {
+	for i, tag := range entry.tags {
+		t.counts[tag]++
+		if t.spellings[tag] == nil {
+			t.spellings[tag] = map[string]int{}
+		}
+		t.spellings[tag][entry.labels[i]]++
+	}
+}
+
+// label returns the spelling of tag most documents use, the first in sort order on a tie, or the
+// tag itself when no document carries it
+func (t *tagTally) label(tag string) string {
+	label, best := tag, 0
+	for spelling, n := range t.spellings[tag] {
+		if n > best || n == best && spelling < label {
+			label, best = spelling, n
+		}
+	}
+	return label
+}
+
+// list sorts the tags by count, most used first, then by tag
+func (t *tagTally) list() []TagCount {
+	list := make([]TagCount, 0, len(t.counts))
+	for tag, count := range t.counts {
+		list = append(list, TagCount{Tag: tag, Label: t.label(tag), Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Tag < list[j].Tag
+	})
+	return list
+}
+
+// taggedFiles returns the files of folder's tree passing filter, in tree order
+func (h *TreeHandler) taggedFiles(ctx context.Context, folder config.Folder, filter tagFilter) ([]*TreeNode, error) {
+	tree, err := h.folderTree(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+	fs := fsForFolder(ctx, folder)
+	files := []*TreeNode{}
+	for _, file := range collectFiles(tree, nil) {
+		if filter.matches(h.tags.get(fs, strings.TrimPrefix(file.Path, folder.Alias+"/"), file)) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// getTaggedFiles answers GET /tree?tag=: a flat list of the files carrying every given tag, across
+// all folders or the one named by ?folder= or ?folderId=
+func (h *TreeHandler) getTaggedFiles(c *gin.Context) {
+	filter := parseTagFilter(c.Query("tag"), "")
+	folders, ok := h.tagFolders(c)
+	if !ok {
+		return
+	}
+	files := []*TreeNode{}
+	for _, folder := range folders {
+		matched, err := h.taggedFiles(c.Request.Context(), folder, filter)
+		if err != nil {
+			continue
+		}
+		files = append(files, matched...)
+	}
+	if requestDone(c) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{
+		"type":     "root",
+		"children": files,
+	})
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+func newTagsRouter(t *testing.T) (*gin.Engine, *TreeHandler, string) {
+	t.Helper()
+	docs := t.TempDir()
+	writeDoc(t, filepath.Join(docs, "a.md"), "---\ntags: [Go, API]\n---\n# A\n\nneedle\n")
+	writeDoc(t, filepath.Join(docs, "b.md"), "---\ntags: go, cli\n---\n# B\n\nneedle\n")
+	writeDoc(t, filepath.Join(docs, "c.md"), "# C\n\nneedle\n")
+	notes := t.TempDir()
+	writeDoc(t, filepath.Join(notes, "n.md"), "---\ntags: \"#go\"\n---\n# N\n\nneedle\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: docs, Alias: "docs"},
+		{ID: "notes", Path: notes, Alias: "notes"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	r := gin.New()
+	r.GET("/tags", tree.GetTags)
+	r.GET("/tags/:tag", tree.GetTagDocuments)
+	r.GET("/tree", tree.GetTree)
+	r.GET("/search", NewSearchHandler(cfg, tree).Search)
+	return r, tree, docs
+}
+
+func getTags(t *testing.T, r http.Handler) TagsResponse {
+	t.Helper()
+	var resp TagsResponse
+	getJSON(t, r, "/tags", &resp)
+	return resp
+}
+
+func getJSON(t *testing.T, r http.Handler, target string, resp any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200, got %d: %s", target, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetTags(t *testing.T) {
+	r, _, _ := newTagsRouter(t)
+	resp := getTags(t, r)
+	want := []TagCount{{"go", "go", 3}, {"api", "API", 1}, {"cli", "cli", 1}}
+	if !slices.Equal(resp.Tags, want) {
+		t.Errorf("expected %v, got %v", want, resp.Tags)
+	}
+	if len(resp.Folders) != 2 || len(resp.Folders[0].Tags) != 3 ||
+		!slices.Equal(resp.Folders[1].Tags, []TagCount{{"go", "go", 1}}) {
+		t.Errorf("unexpected folder tags %+v", resp.Folders)
+	}
+}
+
+func TestGetTagDocuments(t *testing.T) {
+	r, tree, docs := newTagsRouter(t)
+	writeDoc(t, filepath.Join(docs, "draft.md"), "---\ntags: [go]\n---\n# Draft\n")
+	for i, name := range []string{"a.md", "b.md"} {
+		stamp := time.Date(2026, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(filepath.Join(docs, name), stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var resp TagDocumentsResponse
+	getJSON(t, r, "/tags/GO?folder=docs", &resp)
+	got := []string{}
+	for _, doc := range resp.Documents {
+		got = append(got, doc.Path+" "+doc.Title)
+	}
+	if want := []string{"docs/draft.md Draft", "docs/b.md B", "docs/a.md A"}; resp.Tag != "go" ||
+		resp.Label != "go" || !slices.Equal(got, want) {
+		t.Errorf("expected %v, newest first, got %+v", want, resp)
+	}
+	getJSON(t, r, "/tags/api", &resp)
+	if resp.Label != "API" || len(resp.Documents) != 1 || resp.Documents[0].ModTime == nil {
+		t.Errorf("expected a.md with its mod time, got %+v", resp)
+	}
+
+	// Excluded documents leave both endpoints
+	tree.cfg.Ephemeral = true
+	r.PUT("/exclude/global", tree.UpdateGlobalExclude)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/exclude/global", strings.NewReader(`{"exclude":["draft.md"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	getJSON(t, r, "/tags/go", &resp)
+	if len(resp.Documents) != 3 || getTags(t, r).Tags[0].Count != 3 {
+		t.Errorf("expected the excluded draft to be left out, got %+v", resp.Documents)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tags/go?folder=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown folder, got %d", w.Code)
+	}
+}
+
+func TestTagsFollowFileChanges(t *testing.T) {
+	r, tree, docs := newTagsRouter(t)
+	getTags(t, r)
+
+	path := filepath.Join(docs, "c.md")
+	writeDoc(t, path, "---\ntags: [new]\n---\n# C\n")
+	tree.OnFileChange(watcher.Event{Type: watcher.EventWrite, Path: path})
+	if tags := tree.tags.entries["docs/c.md"].tags; !slices.Equal(tags, []string{"new"}) {
+		t.Errorf("expected the write to update the tags, got %v", tags)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	tree.OnFileChange(watcher.Event{Type: watcher.EventRemove, Path: path})
+	if _, ok := tree.tags.entries["docs/c.md"]; ok {
+		t.Error("expected the removal to drop the entry")
+	}
+	if resp := getTags(t, r); resp.Tags[0] != (TagCount{"go", "go", 3}) || len(resp.Tags) != 3 {
+		t.Errorf("unexpected tags after changes %v", resp.Tags)
+	}
+}
+
+func TestSearchTagFilter(t *testing.T) {
+	r, _, _ := newTagsRouter(t)
+	for query, want := range map[string][]string{
+		"q=needle&tags=go":               {"docs/a.md", "docs/b.md", "notes/n.md"},
+		"q=needle&tags=GO,api":           {"docs/a.md"},
+		"q=needle&any_tags=api,cli":      {"docs/a.md", "docs/b.md"},
+		"q=needle&tags=go&any_tags=x":    {},
+		"q=needle&tags=go&any_tags=#cli": {"docs/b.md"},
+	} {
+		got := []string{}
+		for _, result := range getSearch(t, r, query).Results {
+			got = append(got, result.Path)
+		}
+		// Results are ranked; only the set matters here
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", query, want, got)
+		}
+	}
+}
+
+func TestTreeTagFilter(t *testing.T) {
+	r, _, _ := newTagsRouter(t)
+	for query, want := range map[string][]string{
+		"tag=go":              {"docs/a.md", "docs/b.md", "notes/n.md"},
+		"tag=go,cli":          {"docs/b.md"},
+		"tag=go&folder=notes": {"notes/n.md"},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tree?"+query, nil))
+		var root TreeNode
+		if err := json.Unmarshal(w.Body.Bytes(), &root); err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, child := range root.Children {
+			got = append(got, child.Path)
+		}
+		if root.Type != "root" || !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %s", query, want, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tree?tag=go&folder=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown folder, got %d", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// TaskToggle checks or unchecks a task list item, named by its index or source offset as listed in
+// the tasks of FileResponse
+type TaskToggle struct {
+	Index        *int  `json:"index,omitempty"`
+	SourceOffset *int  `json:"sourceOffset,omitempty"`
+	Checked      *bool `json:"checked"`
+	// IfMatch is the etag of the content the client rendered; the If-Match header may carry it instead
+	IfMatch string `json:"ifMatch,omitempty"`
+}
+
+// PatchTask flips the "[ ]"/"[x]" marker of one task list item and returns the re-rendered file.
+// Only the marker byte changes, and only once the file has been parsed again to check a task is
+// still there; writes are serialized like every save, so concurrent toggles cannot undo each other.
+func (h *FileHandler) PatchTask(c *gin.Context) {
+	filePath, baseModTime, ok := h.saveTarget(c)
+	if !ok {
+		return
+	}
+	var req TaskToggle
+	err := c.ShouldBindJSON(&req)
+	if err != nil || req.Checked == nil || (req.Index == nil) == (req.SourceOffset == nil) {
+		writeError(c, CodeInvalidRequest, "body must hold checked and either index or sourceOffset")
+		return
+	}
+	ifMatch := req.IfMatch
+	if ifMatch == "" {
+		ifMatch = c.GetHeader("If-Match")
+	}
+
+	edit := func(current []byte, folder config.Folder) ([]byte, bool) {
+		result, err := h.parserFor(folder).Parse(current)
+		if err != nil {
+			writeError(c, CodeInternal, fmt.Sprintf("failed to parse file: %v", err))
+			return nil, false
+		}
+		for _, task := range result.Tasks {
+			if req.Index != nil && task.Index == *req.Index ||
+				req.SourceOffset != nil && task.Offset == *req.SourceOffset {
+				updated, err := markdown.ToggleTask(current, task.Offset, *req.Checked)
+				if err != nil {
+					writeError(c, CodeInternal, fmt.Sprintf("failed to toggle task: %v", err))
+					return nil, false
+				}
+				return updated, true
+			}
+		}
+		writeError(c, CodeConflict, "no such task in the file; it may have changed since it was read")
+		return nil, false
+	}
+	content, _, ok := h.replaceFile(c, filePath, false, ifMatch, baseModTime, edit)
+	if !ok {
+		return
+	}
+	resp, err := h.Render(c.Request.Context(), filePath)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("file saved but failed to render: %v", err))
+		return
+	}
+	resp.LockConflict = h.heldByOther(c, filePath)
+	c.Header("ETag", ETag(content))
+	writeJSON(c, http.StatusOK, resp)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// taskRoutes registers the route of the task tests
+func taskRoutes(r *gin.Engine, h *FileHandler) {
+	r.PATCH("/tasks/*path", h.PatchTask)
+}
+
+func patchTask(r http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/tasks/docs/todo.md", strings.NewReader(body)))
+	return w
+}
+
+func TestPatchTask(t *testing.T) {
+	original := "# Todo\n\n- [ ] write\n- [x] review\n"
+	r, _, dir := newFileRouter(t, map[string]string{"todo.md": original}, taskRoutes)
+	path := filepath.Join(dir, "todo.md")
+
+	w := patchTask(r, `{"index":0,"checked":true,"ifMatch":`+strconv.Quote(ETag([]byte(original)))+`}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("toggle by index: %d %s", w.Code, w.Body.String())
+	}
+	want := "# Todo\n\n- [x] write\n- [x] review\n"
+	if got := readDoc(t, path); got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+	var resp FileResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ETag != ETag([]byte(want)) || len(resp.Tasks) != 2 || !resp.Tasks[0].Checked {
+		t.Errorf("response etag %q, tasks %+v", resp.ETag, resp.Tasks)
+	}
+	if !strings.Contains(resp.HTML, "checkbox") {
+		t.Errorf("response html = %s", resp.HTML)
+	}
+
+	// The original etag is stale now
+	w = patchTask(r, `{"index":1,"checked":false,"ifMatch":`+strconv.Quote(ETag([]byte(original)))+`}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("stale ifMatch: %d %s", w.Code, w.Body.String())
+	}
+
+	w = patchTask(r, `{"sourceOffset":`+strconv.Itoa(resp.Tasks[1].Offset)+`,"checked":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("toggle by offset: %d %s", w.Code, w.Body.String())
+	}
+	if got := readDoc(t, path); got != "# Todo\n\n- [x] write\n- [ ] review\n" {
+		t.Errorf("file = %q", got)
+	}
+}
+
+func TestPatchTaskRejects(t *testing.T) {
+	r, _, dir := newFileRouter(t, map[string]string{"todo.md": "# Todo\n\n- [ ] write\n"}, taskRoutes)
+	path := filepath.Join(dir, "todo.md")
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"no checked", `{"index":0}`, http.StatusBadRequest},
+		{"no task named", `{"checked":true}`, http.StatusBadRequest},
+		{"index and offset", `{"index":0,"sourceOffset":10,"checked":true}`, http.StatusBadRequest},
+		{"missing index", `{"index":3,"checked":true}`, http.StatusConflict},
+		{"offset off the marker", `{"sourceOffset":11,"checked":true}`, http.StatusConflict},
+		{"offset in the heading", `{"sourceOffset":0,"checked":true}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := patchTask(r, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+	if got := readDoc(t, path); got != "# Todo\n\n- [ ] write\n" {
+		t.Errorf("file after rejected toggles = %q", got)
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutMiddleware bounds each request with a context deadline. Like http.TimeoutHandler,
+// the rest of the chain runs in its own goroutine against a buffered writer: if it has not
+// finished when the deadline fires, the client gets a 504 carrying the request ID right away,
+// even from handlers that ignore c.Request.Context(), and their later writes are discarded.
+// Gin reuses its contexts, so the middleware still waits for the handler before returning.
+// A non-positive timeout disables the deadline.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		w := c.Writer
+		tw := &timeoutWriter{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+		c.Writer = tw
+
+		done := make(chan struct{})
+		var panicked any
+		go func() {
+			defer close(done)
+			defer func() {
+				if v := recover(); v != nil {
+					panicked = stackPanic{value: v, stack: debug.Stack()}
+				}
+			}()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		tw.timedOut = errors.Is(ctx.Err(), context.DeadlineExceeded) && !tw.wroteHeader
+		if tw.timedOut {
+			writeTimeout(w, RequestID(c))
+		}
+		tw.mu.Unlock()
+
+		<-done
+		c.Writer = w
+		if panicked != nil {
+			panic(panicked)
+		}
+		if !tw.timedOut {
+			tw.flushTo(w)
+		}
+	}
+}
+
+// writeTimeout sends the 504 response. The connection is closed afterwards because the
+// handler may still be running.
+func writeTimeout(w gin.ResponseWriter, requestID string) {
+	body, _ := json.Marshal(gin.H{
+		"code":      CodeTimeout,
+		"error":     "request timed out",
+		"requestId": requestID,
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	_, _ = w.Write(body)
+	w.Flush()
+}
+
+// timeoutWriter buffers a response until the handler finishes. Writes after the timeout
+// response was sent fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu          sync.Mutex
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wroteHeader && code > 0 {
+		tw.status = code
+	}
+}
+
+func (tw *timeoutWriter) WriteHeaderNow() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.body.Write(p)
+}
+
+func (tw *timeoutWriter) WriteString(s string) (int, error) {
+	return tw.Write([]byte(s))
+}
+
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.status
+}
+
+func (tw *timeoutWriter) Size() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wroteHeader {
+		return -1
+	}
+	return tw.body.Len()
+}
+
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.wroteHeader
+}
+
+// Flush is a no-op: the response is only sent once the handler has finished
+func (tw *timeoutWriter) Flush() {}
+
+// flushTo copies the buffered response to w
+func (tw *timeoutWriter) flushTo(w gin.ResponseWriter) {
+	for key, values := range tw.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(tw.status)
+	if tw.wroteHeader {
+		w.WriteHeaderNow()
+	}
+	_, _ = w.Write(tw.body.Bytes())
+}
+
+// requestDone reports whether the request was cancelled or timed out, in which case the
+// handler should return without writing so TimeoutMiddleware can answer (or the client is gone)
+func requestDone(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func newTimeoutRouter(timeout time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), TimeoutMiddleware(timeout))
+	r.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		if requestDone(c) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "unreachable"})
+	})
+	r.GET("/fast", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	return r
+}
+
+func TestTimeoutMiddlewareReturns504(t *testing.T) {
+	r := newTimeoutRouter(20 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["requestId"] != "req-123" || body["error"] == "" {
+		t.Errorf("unexpected timeout body: %v", body)
+	}
+}
+
+func TestTimeoutMiddlewarePassesFastRequests(t *testing.T) {
+	r := newTimeoutRouter(time.Second)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestTimeoutMiddlewareDoesNotWaitForHandlerIgnoringContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), TimeoutMiddleware(20*time.Millisecond))
+	r.GET("/stuck", func(c *gin.Context) {
+		defer close(finished)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"status": "late"})
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	type result struct {
+		code int
+		body map[string]string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/stuck")
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		var body map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		got <- result{code: resp.StatusCode, body: body, err: err}
+	}()
+
+	select {
+	case res := <-got:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if res.code != http.StatusGatewayTimeout || res.body["requestId"] == "" {
+			t.Errorf("expected a 504 with a request ID, got %d %v", res.code, res.body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("the 504 waited for a handler that ignores its context")
+	}
+	close(release)
+	<-finished
+}
+
+func TestTimeoutMiddlewareKeepsHandlerResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(TimeoutMiddleware(time.Second))
+	r.GET("/created", func(c *gin.Context) {
+		c.Header("X-Test", "kept")
+		c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+	})
+	r.GET("/empty", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/created", nil))
+	if w.Code != http.StatusCreated || w.Header().Get("X-Test") != "kept" || w.Body.String() != `{"status":"ok"}` {
+		t.Errorf("unexpected buffered response: %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/empty", nil))
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expected 204 without a body, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestFolderTreeCancelledBuildIsNotCached(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "a.md"), []byte("# A\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	h := NewTreeHandler(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h.folderTree(ctx, cfg.Folders[0]); err == nil {
+		t.Fatal("expected a cancelled build to fail")
+	}
+
+	tree, err := h.folderTree(context.Background(), cfg.Folders[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := collectFiles(tree, nil); len(files) != 1 {
+		t.Errorf("expected the full tree after a cancelled build, got %d files", len(files))
+	}
+}
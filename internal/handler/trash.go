@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/gin-gonic/gin"
+)
+
+// TrashItem is an entry of a folder's trash
+type TrashItem struct {
+	ID        string         `json:"id"`
+	Path      string         `json:"path"` // alias-prefixed path it was deleted from
+	IsDir     bool           `json:"isDir"`
+	DeletedAt timestamp.Time `json:"deletedAt"`
+}
+
+// RestoreRequest names the trash entry to put back
+type RestoreRequest struct {
+	FolderID string `json:"folderId"`
+	ID       string `json:"id"`
+}
+
+// DeleteFile moves a markdown file, or with ?recursive=1 a directory, into the folder's trash, or
+// deletes it outright with ?permanent=1
+func (h *FileHandler) DeleteFile(c *gin.Context) {
+	target := strings.TrimSuffix(strings.TrimPrefix(c.Param("path"), "/"), "/")
+	recursive, _ := strconv.ParseBool(c.Query("recursive"))
+	permanent, _ := strconv.ParseBool(c.Query("permanent"))
+
+	wfs, relativePath, folder, ok := h.prepareTarget(c, target)
+	if !ok {
+		return
+	}
+	info, err := wfs.Stat(relativePath)
+	if err != nil {
+		writeDeleteError(c, err)
+		return
+	}
+	if info.IsDir && !recursive {
+		writeError(c, CodeIsDirectory, "pass recursive=1 to delete a directory and everything in it")
+		return
+	}
+	if !info.IsDir && !h.cfg.IsMarkdownFile(relativePath) {
+		writeError(c, CodeNotMarkdown, ErrNotMarkdown.Error())
+		return
+	}
+
+	h.writeMu.Lock()
+	id, err := wfs.Remove(relativePath, !permanent)
+	h.writeMu.Unlock()
+	if err != nil {
+		writeDeleteError(c, err)
+		return
+	}
+	h.notifyTreeChange(target)
+	h.autoCommit(c, folder, "delete", relativePath)
+	recordWrite(h.audit, c, "file.delete", target, 0)
+
+	resp := gin.H{"path": target}
+	if id != "" {
+		resp["trashId"] = id
+	}
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// ListTrash returns the trash of the folder named by ?folderId=, most recently deleted first
+func (h *FileHandler) ListTrash(c *gin.Context) {
+	folder, ok := h.trashFolder(c, c.Query("folderId"))
+	if !ok {
+		return
+	}
+	items := []TrashItem{}
+	if folder.GitRef != "" {
+		// git refs have no trash
+		writeJSON(c, http.StatusOK, gin.H{"items": items})
+		return
+	}
+	fs := fsForFolder(c.Request.Context(), folder)
+	entries, err := fs.ReadDir(mfs.TrashInfoDir)
+	if err != nil && !os.IsNotExist(err) {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to read trash: %v", err))
+		return
+	}
+	for _, e := range entries {
+		id, isInfo := strings.CutSuffix(e.Name, ".json")
+		if !isInfo || e.IsDir {
+			continue
+		}
+		info, err := mfs.ReadTrashInfo(fs, id)
+		if err != nil {
+			continue
+		}
+		items = append(items, TrashItem{
+			ID:        id,
+			Path:      folder.Alias + "/" + info.Path,
+			IsDir:     info.IsDir,
+			DeletedAt: timestamp.New(info.DeletedAt),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt.Time) })
+	writeJSON(c, http.StatusOK, gin.H{"items": items})
+}
+
+// RestoreTrash moves a trash entry back to where it was deleted from, recreating missing parent
+// directories; it fails with 409 if something new exists there
+func (h *FileHandler) RestoreTrash(c *gin.Context) {
+	var req RestoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, CodeInvalidRequest, "invalid request body")
+		return
+	}
+	if req.ID == "" || strings.ContainsAny(req.ID, `/\`) || strings.Contains(req.ID, "..") {
+		writeError(c, CodeInvalidRequest, "invalid trash id")
+		return
+	}
+	folder, ok := h.trashFolder(c, req.FolderID)
+	if !ok {
+		return
+	}
+	wfs, _, _, ok := h.resolveWritable(c, folder.Alias)
+	if !ok {
+		return
+	}
+
+	h.writeMu.Lock()
+	info, err := mfs.ReadTrashInfo(wfs, req.ID)
+	if err == nil {
+		err = wfs.Rename(path.Join(mfs.TrashFilesDir, req.ID), info.Path, true)
+	}
+	if err == nil {
+		_, _ = wfs.Remove(path.Join(mfs.TrashInfoDir, req.ID+".json"), false)
+	}
+	h.writeMu.Unlock()
+	switch {
+	case os.IsNotExist(err):
+		writeError(c, CodeNotFound, "trash entry not found")
+		return
+	case os.IsExist(err):
+		writeError(c, CodeAlreadyExists, "a file or directory already exists at "+info.Path)
+		return
+	case os.IsPermission(err):
+		writeError(c, CodeAccessDenied, "access denied")
+		return
+	case err != nil:
+		writeError(c, CodeInternal, fmt.Sprintf("failed to restore: %v", err))
+		return
+	}
+
+	restored := folder.Alias + "/" + info.Path
+	h.notifyTreeChange(restored)
+	h.autoCommit(c, folder, "restore", info.Path)
+	recordWrite(h.audit, c, "file.restore", restored, 0)
+	writeJSON(c, http.StatusOK, gin.H{"path": restored})
+}
+
+// trashFolder looks up the folder a trash request names. On failure it has already sent the
+// error response and returns false.
+func (h *FileHandler) trashFolder(c *gin.Context, id string) (config.Folder, bool) {
+	if id == "" {
+		writeError(c, CodeInvalidRequest, "folderId is required")
+		return config.Folder{}, false
+	}
+	folder, ok := h.cfg.FolderByID(id)
+	if !ok {
+		writeError(c, CodeFolderNotFound, "folder not found")
+		return config.Folder{}, false
+	}
+	return folder, true
+}
+
+// writeDeleteError maps a trash or Remove error to a response
+func writeDeleteError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		writeError(c, CodeNotFound, "file not found")
+	case os.IsPermission(err):
+		writeError(c, CodeAccessDenied, "access denied")
+	default:
+		writeError(c, CodeInternal, fmt.Sprintf("failed to delete: %v", err))
+	}
+}
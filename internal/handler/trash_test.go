@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// trashRoutes registers the routes of the trash tests
+func trashRoutes(r *gin.Engine, h *FileHandler) {
+	r.DELETE("/files/*path", h.DeleteFile)
+	r.GET("/trash", h.ListTrash)
+	r.POST("/trash/restore", h.RestoreTrash)
+}
+
+// trashDocs are the documents of the trash tests
+var trashDocs = map[string]string{"guide.md": "# Guide\n", "notes/a.md": "# A\n"}
+
+func serveTrash(r http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func listTrash(t *testing.T, r http.Handler) []TrashItem {
+	t.Helper()
+	w := serveTrash(r, http.MethodGet, "/trash?folderId=docs", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 listing the trash, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Items []TrashItem `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Items
+}
+
+func TestDeleteToTrashAndRestore(t *testing.T) {
+	r, h, dir := newFileRouter(t, trashDocs, trashRoutes)
+	changed := recordTreeChanges(h)
+
+	w := serveTrash(r, http.MethodDelete, "/files/docs/guide.md", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var deleted struct {
+		Path    string `json:"path"`
+		TrashID string `json:"trashId"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &deleted)
+	if _, err := os.Stat(filepath.Join(dir, "guide.md")); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be gone, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, config.TrashDir, "files", deleted.TrashID)); err != nil {
+		t.Errorf("expected the file in the trash: %v", err)
+	}
+
+	// The trash never shows up in the tree
+	tree, err := NewTreeHandler(h.cfg).folderTree(context.Background(), h.cfg.Folders[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, child := range tree.Children {
+		if child.Name == config.TrashDir {
+			t.Error("expected the trash directory to be excluded from the tree")
+		}
+	}
+
+	items := listTrash(t, r)
+	if len(items) != 1 || items[0].ID != deleted.TrashID || items[0].Path != "docs/guide.md" || items[0].IsDir {
+		t.Fatalf("unexpected trash %+v", items)
+	}
+
+	restore := `{"folderId":"docs","id":"` + deleted.TrashID + `"}`
+	if w := serveTrash(r, http.MethodPost, "/trash/restore", restore); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 restoring, got %d: %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "guide.md")); string(data) != "# Guide\n" {
+		t.Errorf("unexpected restored content %q", data)
+	}
+	if items := listTrash(t, r); len(items) != 0 {
+		t.Errorf("expected an empty trash after restoring, got %+v", items)
+	}
+	if w := serveTrash(r, http.MethodPost, "/trash/restore", restore); w.Code != http.StatusNotFound {
+		t.Errorf("expected a second restore to be a 404, got %d", w.Code)
+	}
+	if strings.Join(*changed, ",") != "docs/guide.md,docs/guide.md" {
+		t.Errorf("unexpected tree change notifications %v", *changed)
+	}
+}
+
+func TestDeleteDirectoryAndPermanent(t *testing.T) {
+	r, _, dir := newFileRouter(t, trashDocs, trashRoutes)
+
+	if w := serveTrash(r, http.MethodDelete, "/files/docs/notes", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a directory to need recursive=1, got %d", w.Code)
+	}
+	if w := serveTrash(r, http.MethodDelete, "/files/docs/notes?recursive=1", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	items := listTrash(t, r)
+	if len(items) != 1 || items[0].Path != "docs/notes" || !items[0].IsDir {
+		t.Fatalf("unexpected trash %+v", items)
+	}
+
+	// Restoring over something created since is refused
+	writeDoc(t, filepath.Join(dir, "notes", "b.md"), "# B\n")
+	w := serveTrash(r, http.MethodPost, "/trash/restore", `{"folderId":"docs","id":"`+items[0].ID+`"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := serveTrash(r, http.MethodDelete, "/files/docs/guide.md?permanent=1", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "guide.md")); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be gone, stat err = %v", err)
+	}
+	if items := listTrash(t, r); len(items) != 1 {
+		t.Errorf("expected a permanent delete to skip the trash, got %+v", items)
+	}
+}
+
+func TestDeleteRejects(t *testing.T) {
+	r, h, dir := newFileRouter(t, trashDocs, trashRoutes)
+	changed := recordTreeChanges(h)
+	writeDoc(t, filepath.Join(dir, "notes.txt"), "x")
+	writeDoc(t, filepath.Join(dir, config.TrashDir, "files", "old.md"), "# Old\n")
+
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+		code                       ErrorCode
+	}{
+		{"missing", http.MethodDelete, "/files/docs/nope.md", "", http.StatusNotFound, CodeNotFound},
+		{"not markdown", http.MethodDelete, "/files/docs/notes.txt", "", http.StatusBadRequest, CodeNotMarkdown},
+		{"read-only folder", http.MethodDelete, "/files/frozen/guide.md", "",
+			http.StatusMethodNotAllowed, CodeFolderReadOnly},
+		{"trash", http.MethodDelete, "/files/docs/" + config.TrashDir + "/files/old.md", "",
+			http.StatusForbidden, CodePathExcluded},
+		{"traversal", http.MethodDelete, "/files/docs/../escape.md", "", http.StatusForbidden, CodePathTraversal},
+		{"folder root", http.MethodDelete, "/files/docs?recursive=1", "", http.StatusBadRequest, CodeInvalidPath},
+		{"bad trash id", http.MethodPost, "/trash/restore", `{"folderId":"docs","id":"../guide.md"}`,
+			http.StatusBadRequest, CodeInvalidRequest},
+		{"read-only restore", http.MethodPost, "/trash/restore", `{"folderId":"frozen","id":"x"}`,
+			http.StatusMethodNotAllowed, CodeFolderReadOnly},
+		{"unknown folder", http.MethodGet, "/trash?folderId=nope", "", http.StatusNotFound, CodeFolderNotFound},
+	}
+	for _, tt := range tests {
+		w := serveTrash(r, tt.method, tt.target, tt.body)
+		var body APIError
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != tt.want || body.Code != tt.code {
+			t.Errorf("%s: expected %d %s, got %d %s", tt.name, tt.want, tt.code, w.Code, w.Body.String())
+		}
+	}
+	if len(*changed) != 0 {
+		t.Errorf("expected no tree change notifications, got %v", *changed)
+	}
+}
@@ -1,109 +1,331 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/CageChen/markhub/internal/audit"
 	"github.com/CageChen/markhub/internal/config"
 	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/CageChen/markhub/internal/watcher"
 	"github.com/gin-gonic/gin"
 )
 
+// treeCacheTTL bounds how stale a cached folder tree may get when no watcher
+// event invalidates it (git_ref folders, or watching disabled).
+const treeCacheTTL = 10 * time.Second
+
 // TreeNode represents a file or directory in the tree
 type TreeNode struct {
-	Name        string      `json:"name"`
-	Type        string      `json:"type"`
-	Path        string      `json:"path,omitempty"`
-	Alias       string      `json:"alias,omitempty"`
-	FolderID    int         `json:"folderId,omitempty"`
-	Children    []*TreeNode `json:"children,omitempty"`
-	ModTime     *time.Time  `json:"modTime,omitempty"`
-	Size        int64       `json:"size,omitempty"`
-	IsRepoGroup bool        `json:"isRepoGroup,omitempty"`
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Path        string          `json:"path,omitempty"`
+	Alias       string          `json:"alias,omitempty"`
+	FolderID    string          `json:"folderId,omitempty"`
+	Children    []*TreeNode     `json:"children,omitempty"`
+	ModTime     *timestamp.Time `json:"modTime,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	IsRepoGroup bool            `json:"isRepoGroup,omitempty"`
+	EmptyReason string          `json:"emptyReason,omitempty"`
+	// Truncated marks a directory with more entries than max_dir_entries, of which only some are shown
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Reasons a folder root has no children, reported in TreeNode.EmptyReason
+const (
+	EmptyReasonEmpty       = "empty"        // nothing but (empty) directories
+	EmptyReasonAllExcluded = "all_excluded" // entries were hidden by exclude patterns
+	EmptyReasonNoMarkdown  = "no_markdown"  // files exist but none has a markdown extension
+)
+
+// skippedEntries counts the entries a tree build filtered out
+type skippedEntries struct {
+	excludedMarkdown int
+	excludedDirs     int
+	nonMarkdown      int
+}
+
+// exclude records an entry hidden by an exclude pattern
+func (s *skippedEntries) exclude(entry mfs.DirEntry, cfg *config.Config) {
+	if entry.IsDir {
+		s.excludedDirs++
+	} else if cfg.IsMarkdownFile(entry.Name) {
+		s.excludedMarkdown++
+	}
+}
+
+// emptyReason explains why a build that skipped s produced no children. Excluded directories
+// only count when nothing else was found, so a repository whose only hidden entry is .git
+// reports no_markdown rather than blaming the default excludes.
+func (s skippedEntries) emptyReason() string {
+	switch {
+	case s.excludedMarkdown > 0:
+		return EmptyReasonAllExcluded
+	case s.nonMarkdown > 0:
+		return EmptyReasonNoMarkdown
+	case s.excludedDirs > 0:
+		return EmptyReasonAllExcluded
+	default:
+		return EmptyReasonEmpty
+	}
+}
+
+// cachedTree is a built folder tree and when it was built
+type cachedTree struct {
+	node  *TreeNode
+	built time.Time
 }
 
 // TreeHandler handles directory tree API requests
 type TreeHandler struct {
-	cfg *config.Config
+	cfg    *config.Config
+	mu     sync.Mutex
+	cache  map[string]cachedTree // keyed by folder ID
+	titles *titleCache
+	tags   *tagCache
+	links  *linkCache
+	audit  *audit.Logger
+
+	// generation is bumped by Invalidate; a build that started under an older generation is not cached
+	generation uint64
+
+	// writeMu serializes folder/exclude mutations so lookup, change and save happen atomically
+	writeMu sync.Mutex
+
+	// excludeListeners are called, under writeMu, after the excludes of some folder may have changed
+	excludeListeners []func()
 }
 
 // NewTreeHandler creates a new tree handler
 func NewTreeHandler(cfg *config.Config) *TreeHandler {
-	return &TreeHandler{cfg: cfg}
+	return &TreeHandler{
+		cfg:    cfg,
+		cache:  make(map[string]cachedTree),
+		titles: newTitleCache(),
+		tags:   newTagCache(),
+		links:  newLinkCache(),
+		audit:  audit.New(cfg.GetAuditLogPath()),
+	}
+}
+
+// Invalidate drops all cached folder trees and titles so the next request rebuilds them
+func (h *TreeHandler) Invalidate() {
+	h.mu.Lock()
+	h.cache = make(map[string]cachedTree)
+	h.generation++
+	h.mu.Unlock()
+	h.titles.clear()
+}
+
+// onExcludeChange registers fn to be called after excludes or folder settings are updated
+func (h *TreeHandler) onExcludeChange(fn func()) {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+	h.excludeListeners = append(h.excludeListeners, fn)
 }
 
-// fsForFolder returns the appropriate FileSystem for a folder config.
-func fsForFolder(folder config.Folder) mfs.FileSystem {
+// excludesChanged drops the cached trees and tells the listeners that excludes may have changed;
+// the caller holds writeMu
+func (h *TreeHandler) excludesChanged() {
+	h.Invalidate()
+	for _, fn := range h.excludeListeners {
+		fn()
+	}
+}
+
+// OnFileChange is called when a file change is detected: it drops the cached trees and brings the
+// changed file's tags and links up to date
+func (h *TreeHandler) OnFileChange(e watcher.Event) {
+	h.Invalidate()
+	h.updateFileCaches(e)
+}
+
+// fsForFolder returns the appropriate FileSystem for a folder config: it implements mfs.WritableFS
+// only when the folder may be changed. Git commands are killed when ctx is done.
+func fsForFolder(ctx context.Context, folder config.Folder) mfs.FileSystem {
 	if folder.GitRef != "" {
-		return mfs.NewGitFS(folder.Path, folder.GitRef)
+		return mfs.NewGitFS(folder.Path, folder.GitRef).WithContext(ctx)
+	}
+	if !folder.Writable {
+		return mfs.NewReadOnlyFS(mfs.NewLocalFS(folder.Path))
 	}
 	return mfs.NewLocalFS(folder.Path)
 }
 
-// GetTree returns the directory tree structure for all configured folders
+// GetTree returns the directory tree structure for all configured folders,
+// or for a single folder when ?folder=<alias> or ?folderId=<id> is given.
+// With ?tag= it returns a flat list of the matching files instead.
 func (h *TreeHandler) GetTree(c *gin.Context) {
+	if c.Query("tag") != "" {
+		h.getTaggedFiles(c)
+		return
+	}
+	if c.Query("folder") != "" || c.Query("folderId") != "" {
+		h.getFolderTree(c)
+		return
+	}
+
 	var rawRoots []*TreeNode
 
-	for i, folder := range h.cfg.Folders {
-		fs := fsForFolder(folder)
-		// Merge repo-level excludes with folder-level excludes
-		mergedExcludes := append([]string{}, h.cfg.GetRepoExclude(folder.Path)...)
-		mergedExcludes = append(mergedExcludes, folder.Exclude...)
-		tree, err := h.buildTree(fs, folder.SubPath, i, folder.Alias, mergedExcludes)
+	ctx := c.Request.Context()
+	folders := h.cfg.FoldersSnapshot()
+	for _, folder := range folders {
+		if h.cfg.FolderHidden(folder.ID) {
+			continue
+		}
+		tree, err := h.folderTree(ctx, folder)
 		if err != nil {
 			continue
 		}
-		tree.Name = folder.Alias
-		tree.Alias = folder.Alias
-		tree.FolderID = i
 		rawRoots = append(rawRoots, tree)
 	}
+	if requestDone(c) {
+		return
+	}
 
 	// Group folders that share the same path and have git_ref set
-	roots := h.groupByRepo(rawRoots)
+	roots := groupByRepo(folders, rawRoots)
 
 	if len(roots) == 1 {
-		c.JSON(http.StatusOK, roots[0])
+		writeJSON(c, http.StatusOK, roots[0])
 	} else {
-		c.JSON(http.StatusOK, gin.H{
+		writeJSON(c, http.StatusOK, gin.H{
 			"type":     "root",
 			"children": roots,
 		})
 	}
 }
 
+// findFolder resolves the ?folder=<alias> or ?folderId=<id> query to a folder
+func (h *TreeHandler) findFolder(c *gin.Context) (config.Folder, bool) {
+	if alias := c.Query("folder"); alias != "" {
+		for _, f := range h.cfg.FoldersSnapshot() {
+			if f.Alias == alias {
+				return f, true
+			}
+		}
+		return config.Folder{}, false
+	}
+	return h.cfg.FolderByID(c.Query("folderId"))
+}
+
+// getFolderTree returns the subtree of a single folder
+func (h *TreeHandler) getFolderTree(c *gin.Context) {
+	folder, ok := h.findFolder(c)
+	if !ok {
+		writeError(c, CodeFolderNotFound, "folder not found")
+		return
+	}
+	tree, err := h.folderTree(c.Request.Context(), folder)
+	if requestDone(c) {
+		return
+	}
+	if err != nil {
+		writeError(c, CodeFolderUnreadable, "folder not readable: "+err.Error())
+		return
+	}
+	writeJSON(c, http.StatusOK, tree)
+}
+
+// folderTree builds the filtered tree for folder, applying global, repo-level and
+// folder-level excludes.
+// Trees are cached by folder ID until invalidated or treeCacheTTL elapses; callers must not mutate them.
+// A build interrupted by ctx returns ctx.Err() and is not cached, nor is one that raced with Invalidate.
+func (h *TreeHandler) folderTree(ctx context.Context, folder config.Folder) (*TreeNode, error) {
+	h.mu.Lock()
+	cached, ok := h.cache[folder.ID]
+	generation := h.generation
+	h.mu.Unlock()
+	if ok && time.Since(cached.built) < treeCacheTTL {
+		return cached.node, nil
+	}
+
+	fs := fsForFolder(ctx, folder)
+	var skipped skippedEntries
+	tree, err := h.buildTree(ctx, fs, folder.SubPath, folder.ID, folder.Alias, h.effectiveExcludes(folder), &skipped)
+	if err != nil {
+		return nil, err
+	}
+	tree.Name = folder.Alias
+	tree.Alias = folder.Alias
+	tree.FolderID = folder.ID
+	if tree.Type == "directory" && len(tree.Children) == 0 {
+		tree.EmptyReason = skipped.emptyReason()
+	}
+
+	h.mu.Lock()
+	if h.generation == generation {
+		h.cache[folder.ID] = cachedTree{node: tree, built: time.Now()}
+	}
+	h.mu.Unlock()
+	return tree, nil
+}
+
+// effectiveExcludes returns the excludes of folder applied on top of the global ones: the
+// repo-level excludes of its path, then its own
+func (h *TreeHandler) effectiveExcludes(folder config.Folder) []string {
+	merged := append([]string{}, h.cfg.GetRepoExclude(folder.Path)...)
+	return append(merged, folder.Exclude...)
+}
+
+// entryExcluded reports whether the global excludes, or the given folder-level ones, hide the
+// entry at the folder-relative childPath
+func (h *TreeHandler) entryExcluded(childPath string, folderExcludes []string) bool {
+	return h.cfg.IsExcluded(path.Base(childPath)) || h.cfg.IsFolderExcluded(childPath, folderExcludes)
+}
+
+// fileVisible reports whether folder's tree shows the file at the folder-relative relPath, by
+// the rules buildTree applies (see traceExclude). Search and tag updates check files with it
+// before reading them.
+func (h *TreeHandler) fileVisible(folder config.Folder, relPath string, info mfs.FileInfo) bool {
+	return !info.IsDir && !h.traceExclude(folder, relPath, &info).Excluded
+}
+
+// collectFiles appends every file node below n (depth-first, in tree order) to files.
+func collectFiles(n *TreeNode, files []*TreeNode) []*TreeNode {
+	if n.Type == "file" {
+		return append(files, n)
+	}
+	for _, child := range n.Children {
+		files = collectFiles(child, files)
+	}
+	return files
+}
+
 // groupByRepo groups folder roots that share the same filesystem path (i.e.
 // multiple git refs of the same repo) under a single parent node named after
 // the repository directory.  Folders without a GitRef are kept as-is.
-func (h *TreeHandler) groupByRepo(roots []*TreeNode) []*TreeNode {
-	// Build a map: repoPath -> []folderIndex for folders that have GitRef
-	type entry struct {
-		folderIdx int
-		node      *TreeNode
+func groupByRepo(folders []config.Folder, roots []*TreeNode) []*TreeNode {
+	byID := make(map[string]config.Folder, len(folders))
+	for _, f := range folders {
+		byID[f.ID] = f
 	}
-	repoMap := make(map[string][]entry)
+
+	// Build a map: repoPath -> []node for folders that have GitRef
+	repoMap := make(map[string][]*TreeNode)
 	var order []string // preserve first-seen order of repo paths
 	var standalone []*TreeNode
 
 	for _, node := range roots {
-		if node.FolderID >= len(h.cfg.Folders) {
-			standalone = append(standalone, node)
-			continue
-		}
-		folder := h.cfg.Folders[node.FolderID]
-		if folder.GitRef == "" {
+		folder, ok := byID[node.FolderID]
+		if !ok || folder.GitRef == "" {
 			standalone = append(standalone, node)
 			continue
 		}
 		if _, seen := repoMap[folder.Path]; !seen {
 			order = append(order, folder.Path)
 		}
-		repoMap[folder.Path] = append(repoMap[folder.Path], entry{folderIdx: node.FolderID, node: node})
+		repoMap[folder.Path] = append(repoMap[folder.Path], node)
 	}
 
 	var result []*TreeNode
@@ -113,7 +335,7 @@ func (h *TreeHandler) groupByRepo(roots []*TreeNode) []*TreeNode {
 		entries := repoMap[repoPath]
 		if len(entries) == 1 {
 			// Single ref for this repo — no grouping needed
-			result = append(result, entries[0].node)
+			result = append(result, entries[0])
 			continue
 		}
 		// Create a virtual parent node for the repo
@@ -122,9 +344,7 @@ func (h *TreeHandler) groupByRepo(roots []*TreeNode) []*TreeNode {
 			Type:        "directory",
 			IsRepoGroup: true,
 		}
-		for _, e := range entries {
-			groupNode.Children = append(groupNode.Children, e.node)
-		}
+		groupNode.Children = append(groupNode.Children, entries...)
 		result = append(result, groupNode)
 	}
 
@@ -136,20 +356,23 @@ func (h *TreeHandler) groupByRepo(roots []*TreeNode) []*TreeNode {
 type folderResponse struct {
 	config.Folder
 	EffectiveExcludes []string `json:"effective_excludes"`
+	CanWrite          bool     `json:"can_write"`
 }
 
 // GetFolders returns the list of configured folders, global excludes, and repo excludes
 func (h *TreeHandler) GetFolders(c *gin.Context) {
-	resp := make([]folderResponse, len(h.cfg.Folders))
-	for i, f := range h.cfg.Folders {
-		merged := append([]string{}, h.cfg.GetRepoExclude(f.Path)...)
-		merged = append(merged, f.Exclude...)
-		resp[i] = folderResponse{Folder: f, EffectiveExcludes: merged}
+	folders := h.cfg.FoldersSnapshot()
+	resp := make([]folderResponse, len(folders))
+	for i, f := range folders {
+		resp[i] = folderResponse{
+			Folder: f, EffectiveExcludes: h.effectiveExcludes(f), CanWrite: f.CanWrite() && !h.cfg.ReadOnly,
+		}
 	}
-	c.JSON(http.StatusOK, gin.H{
+	writeJSON(c, http.StatusOK, gin.H{
 		"folders":       resp,
-		"globalExclude": h.cfg.Exclude,
-		"repoExclude":   h.cfg.RepoExclude,
+		"globalExclude": h.cfg.GlobalExclude(),
+		"repoExclude":   h.cfg.RepoExcludeSnapshot(),
+		"ephemeral":     h.cfg.Ephemeral,
 	})
 }
 
@@ -160,143 +383,239 @@ type AddFolderRequest struct {
 	GitRef  string   `json:"git_ref"`
 	SubPath string   `json:"sub_path"`
 	Exclude []string `json:"exclude"`
+	// Writable lets files in the folder be saved through the API
+	Writable bool `json:"writable"`
+	// Description is shown for the folder on the home page
+	Description string `json:"description"`
 }
 
 // AddFolder adds a new folder to the configuration
 func (h *TreeHandler) AddFolder(c *gin.Context) {
 	var req AddFolderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "path is required",
-		})
+		writeError(c, CodeInvalidRequest, "path is required")
 		return
 	}
 
 	// Validate path exists (it must be a directory on disk even for git_ref folders)
 	info, err := os.Stat(req.Path)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "path does not exist: " + req.Path,
-		})
+		writeError(c, CodeInvalidRequest, "path does not exist: "+req.Path)
 		return
 	}
 	if !info.IsDir() {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "path is not a directory",
-		})
+		writeError(c, CodeInvalidRequest, "path is not a directory")
 		return
 	}
 
+	if req.GitRef != "" {
+		fs := fsForFolder(c.Request.Context(), config.Folder{Path: req.Path, GitRef: req.GitRef})
+		if _, err := fs.Stat(""); err != nil {
+			writeError(c, CodeGitRefNotFound, "git_ref not found: "+req.GitRef)
+			return
+		}
+	}
+
 	// Validate SubPath if provided
 	if req.SubPath != "" {
-		fs := fsForFolder(config.Folder{Path: req.Path, GitRef: req.GitRef})
+		fs := fsForFolder(c.Request.Context(), config.Folder{Path: req.Path, GitRef: req.GitRef})
 		if _, err := fs.Stat(req.SubPath); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "sub_path does not exist: " + req.SubPath,
-			})
+			writeError(c, CodeInvalidRequest, "sub_path does not exist: "+req.SubPath)
 			return
 		}
 	}
 
 	// Add folder
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	countBefore := len(h.cfg.FoldersSnapshot())
 	if err := h.cfg.AddFolder(req.Path, req.Alias, req.GitRef, req.SubPath, req.Exclude); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		if errors.Is(err, config.ErrFolderExists) {
+			writeError(c, CodeFolderExists, err.Error())
+			return
+		}
+		if errors.Is(err, config.ErrTooManyFolders) {
+			writeError(c, CodeTooManyFolders, err.Error())
+			return
+		}
+		if errors.Is(err, config.ErrFolderOverlap) {
+			writeError(c, CodeFolderOverlap, err.Error())
+			return
+		}
+		writeError(c, CodeInternal, err.Error())
 		return
 	}
+	folders := h.cfg.FoldersSnapshot()
+	added := len(folders) > countBefore
+	if added && req.Writable {
+		h.cfg.SetFolderWritable(folders[len(folders)-1].ID, true)
+	}
+	if added && req.Description != "" {
+		h.cfg.SetFolderDescription(folders[len(folders)-1].ID, req.Description)
+	}
+
+	h.Invalidate()
 
 	// Save configuration
 	if err := h.cfg.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to save config: " + err.Error(),
-		})
+		writeError(c, CodeConfigSaveFailed, "failed to save config: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	folders = h.cfg.FoldersSnapshot()
+	resp := gin.H{
 		"message": "folder added",
-		"folders": h.cfg.Folders,
-	})
+		"folders": folders,
+	}
+	if added {
+		folder := folders[len(folders)-1]
+		recordAudit(h.audit, c, "folder.add", nil, folder)
+		var warnings []string
+		for _, overlap := range h.cfg.FolderOverlaps() {
+			if overlap.Inner.ID == folder.ID || overlap.Outer.ID == folder.ID {
+				warnings = append(warnings, overlap.Error())
+			}
+		}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+	}
+
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// legacyFolderIndexKey marks requests whose route still accepts positional folder indexes
+const legacyFolderIndexKey = "legacyFolderIndex"
+
+// AllowLegacyFolderIndex lets update/remove requests name a folder by its positional index instead
+// of its ID. The router applies it to the deprecated /api alias only.
+func AllowLegacyFolderIndex() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(legacyFolderIndexKey, true)
+		c.Next()
+	}
+}
+
+// resolveFolderID returns the folder ID a management request refers to: id when set, otherwise the
+// legacy index where the route allows it. An index out of range yields an unknown (empty) ID; ok is
+// false when the request names no folder at all. Callers hold writeMu.
+func (h *TreeHandler) resolveFolderID(c *gin.Context, id string, index *int) (string, bool) {
+	if id != "" {
+		return id, true
+	}
+	if index == nil || !c.GetBool(legacyFolderIndexKey) {
+		return "", false
+	}
+	folders := h.cfg.FoldersSnapshot()
+	if *index < 0 || *index >= len(folders) {
+		return "", true
+	}
+	return folders[*index].ID, true
 }
 
-// UpdateFolderRequest represents a request to update a folder (identified by index)
+// UpdateFolderRequest represents a request to update a folder, identified by its stable ID.
+// Index is only honoured on the deprecated /api alias.
 type UpdateFolderRequest struct {
-	Index   int      `json:"index"`
+	ID      string   `json:"id"`
+	Index   *int     `json:"index"`
 	Alias   string   `json:"alias" binding:"required"`
 	GitRef  string   `json:"git_ref"`
 	SubPath string   `json:"sub_path"`
 	Exclude []string `json:"exclude"`
+	// Writable sets the folder's writable flag; omitted, the flag is left as it is
+	Writable *bool `json:"writable"`
+	// Description sets the folder's home page description; omitted, it is left as it is
+	Description *string `json:"description"`
 }
 
-// UpdateFolder updates a folder's settings by index
+// UpdateFolder updates a folder's settings by ID
 func (h *TreeHandler) UpdateFolder(c *gin.Context) {
 	var req UpdateFolderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "alias is required",
-		})
+		writeError(c, CodeInvalidRequest, "id and alias are required")
 		return
 	}
 
-	if req.Index < 0 || req.Index >= len(h.cfg.Folders) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid folder index",
-		})
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	id, ok := h.resolveFolderID(c, req.ID, req.Index)
+	if !ok {
+		writeError(c, CodeInvalidRequest, "id and alias are required")
+		return
+	}
+	before, ok := h.cfg.UpdateFolderByID(id, req.Alias, req.GitRef, req.SubPath, req.Exclude)
+	if !ok {
+		writeError(c, CodeFolderNotFound, "folder not found")
 		return
 	}
+	if req.Writable != nil {
+		h.cfg.SetFolderWritable(id, *req.Writable)
+	}
+	if req.Description != nil {
+		h.cfg.SetFolderDescription(id, *req.Description)
+	}
 
-	h.cfg.UpdateFolderByIndex(req.Index, req.Alias, req.GitRef, req.SubPath, req.Exclude)
+	h.excludesChanged()
 
 	// Save configuration
 	if err := h.cfg.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to save config: " + err.Error(),
-		})
+		writeError(c, CodeConfigSaveFailed, "failed to save config: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	after, _ := h.cfg.FolderByID(id)
+	recordAudit(h.audit, c, "folder.update", before, after)
+
+	writeJSON(c, http.StatusOK, gin.H{
 		"message": "folder updated",
-		"folders": h.cfg.Folders,
+		"folders": h.cfg.FoldersSnapshot(),
 	})
 }
 
-// RemoveFolderRequest represents a request to remove a folder (by index)
+// RemoveFolderRequest represents a request to remove a folder, identified by its stable ID.
+// Index is only honoured on the deprecated /api alias.
 type RemoveFolderRequest struct {
-	Index int `json:"index"`
+	ID    string `json:"id"`
+	Index *int   `json:"index"`
 }
 
-// RemoveFolder removes a folder from the configuration by index
+// RemoveFolder removes a folder from the configuration by ID
 func (h *TreeHandler) RemoveFolder(c *gin.Context) {
 	var req RemoveFolderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "index is required",
-		})
+		writeError(c, CodeInvalidRequest, "invalid request")
 		return
 	}
 
-	if req.Index < 0 || req.Index >= len(h.cfg.Folders) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid folder index",
-		})
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	id, ok := h.resolveFolderID(c, req.ID, req.Index)
+	if !ok {
+		writeError(c, CodeInvalidRequest, "id is required")
+		return
+	}
+	before, ok := h.cfg.RemoveFolderByID(id)
+	if !ok {
+		writeError(c, CodeFolderNotFound, "folder not found")
 		return
 	}
 
-	h.cfg.RemoveFolderByIndex(req.Index)
+	h.Invalidate()
 
 	// Save configuration
 	if err := h.cfg.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to save config: " + err.Error(),
-		})
+		writeError(c, CodeConfigSaveFailed, "failed to save config: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	recordAudit(h.audit, c, "folder.remove", before, nil)
+
+	writeJSON(c, http.StatusOK, gin.H{
 		"message": "folder removed",
-		"folders": h.cfg.Folders,
+		"folders": h.cfg.FoldersSnapshot(),
 	})
 }
 
@@ -310,24 +629,29 @@ type UpdateRepoExcludeRequest struct {
 func (h *TreeHandler) UpdateRepoExclude(c *gin.Context) {
 	var req UpdateRepoExcludeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "path is required",
-		})
+		writeError(c, CodeInvalidRequest, "path is required")
 		return
 	}
 
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	before := h.cfg.GetRepoExclude(req.Path)
 	h.cfg.SetRepoExclude(req.Path, req.Exclude)
+	h.excludesChanged()
 
 	if err := h.cfg.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to save config: " + err.Error(),
-		})
+		writeError(c, CodeConfigSaveFailed, "failed to save config: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	recordAudit(h.audit, c, "exclude.repo",
+		gin.H{"path": req.Path, "exclude": before},
+		gin.H{"path": req.Path, "exclude": req.Exclude})
+
+	writeJSON(c, http.StatusOK, gin.H{
 		"message":     "repo excludes updated",
-		"repoExclude": h.cfg.RepoExclude,
+		"repoExclude": h.cfg.RepoExcludeSnapshot(),
 	})
 }
 
@@ -340,30 +664,37 @@ type UpdateGlobalExcludeRequest struct {
 func (h *TreeHandler) UpdateGlobalExclude(c *gin.Context) {
 	var req UpdateGlobalExcludeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid request",
-		})
+		writeError(c, CodeInvalidRequest, "invalid request")
 		return
 	}
 
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	before := h.cfg.GlobalExclude()
 	h.cfg.SetGlobalExclude(req.Exclude)
+	h.excludesChanged()
 
 	if err := h.cfg.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to save config: " + err.Error(),
-		})
+		writeError(c, CodeConfigSaveFailed, "failed to save config: "+err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	recordAudit(h.audit, c, "exclude.global", before, req.Exclude)
+
+	writeJSON(c, http.StatusOK, gin.H{
 		"message":       "global excludes updated",
-		"globalExclude": h.cfg.Exclude,
+		"globalExclude": h.cfg.GlobalExclude(),
 	})
 }
 
 func (h *TreeHandler) buildTree(
-	fs mfs.FileSystem, relativePath string, folderID int, folderAlias string, folderExcludes []string,
+	ctx context.Context, fs mfs.FileSystem, relativePath string, folderID string, folderAlias string,
+	folderExcludes []string, skipped *skippedEntries,
 ) (*TreeNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	info, err := fs.Stat(relativePath)
 	if err != nil {
 		return nil, err
@@ -383,7 +714,12 @@ func (h *TreeHandler) buildTree(
 
 	if info.IsDir {
 		node.Type = "directory"
-		entries, err := fs.ReadDir(relativePath)
+		var entries []mfs.DirEntry
+		if limit := h.cfg.GetMaxDirEntries(); limit > 0 {
+			entries, node.Truncated, err = mfs.ReadDirLimit(fs, relativePath, limit)
+		} else {
+			entries, err = fs.ReadDir(relativePath)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -405,28 +741,34 @@ func (h *TreeHandler) buildTree(
 				childPath = childPath + "/" + name
 			}
 
-			// Skip globally excluded paths
-			if h.cfg.IsExcluded(name) {
-				continue
-			}
-
-			// Skip folder-level excluded paths
-			if h.cfg.IsFolderExcluded(childPath, folderExcludes) {
+			// Skip globally and folder-level excluded paths
+			if h.entryExcluded(childPath, folderExcludes) {
+				skipped.exclude(entry, h.cfg)
 				continue
 			}
 
 			// Skip non-markdown files (but include directories)
 			if !entry.IsDir && !h.cfg.IsMarkdownFile(name) {
+				skipped.nonMarkdown++
 				continue
 			}
 
-			child, err := h.buildTree(fs, childPath, folderID, folderAlias, folderExcludes)
+			child, err := h.buildTree(ctx, fs, childPath, folderID, folderAlias, folderExcludes, skipped)
 			if err != nil {
+				// Unreadable entries are skipped, but a cancelled build must not look complete
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
 				continue
 			}
 
-			// Skip empty directories
-			if child.Type == "directory" && len(child.Children) == 0 {
+			// Skip empty directories, keeping truncated ones to show where entries are missing
+			if child.Type == "directory" && len(child.Children) == 0 && !child.Truncated {
+				continue
+			}
+			// Skip files hidden by size or age
+			if child.Type == "file" && h.cfg.IsExcludedByRule(childPath, child.Size, child.ModTime.Time) {
+				skipped.exclude(entry, h.cfg)
 				continue
 			}
 
@@ -434,8 +776,7 @@ func (h *TreeHandler) buildTree(
 		}
 	} else {
 		node.Type = "file"
-		modTime := info.ModTime
-		node.ModTime = &modTime
+		node.ModTime = timestamp.Ptr(info.ModTime)
 		node.Size = info.Size
 	}
 
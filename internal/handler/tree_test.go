@@ -0,0 +1,487 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+func writeDoc(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newFileRouter serves a temporary directory holding docs, by path, as two folders: "docs",
+// writable, and "frozen", read-only. routes registers the FileHandler routes under test. The
+// handler's config may still be changed before the first request.
+func newFileRouter(
+	t *testing.T, docs map[string]string, routes func(r *gin.Engine, h *FileHandler),
+) (*gin.Engine, *FileHandler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range docs {
+		writeDoc(t, filepath.Join(dir, name), content)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: dir, Alias: "docs", Writable: true},
+		{ID: "frozen", Path: dir, Alias: "frozen"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	h := NewFileHandler(cfg)
+	r := gin.New()
+	routes(r, h)
+	return r, h, dir
+}
+
+// recordTreeChanges collects the paths h reports to OnTreeChange
+func recordTreeChanges(h *FileHandler) *[]string {
+	var changed []string
+	h.OnTreeChange(func(path string) { changed = append(changed, path) })
+	return &changed
+}
+
+func TestFolderTreeCacheFollowsFolderID(t *testing.T) {
+	root := t.TempDir()
+	writeDoc(t, filepath.Join(root, "a", "a.md"), "# A\n")
+	writeDoc(t, filepath.Join(root, "b", "b.md"), "# B\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "a", Path: filepath.Join(root, "a"), Alias: "a"},
+		{ID: "b", Path: filepath.Join(root, "b"), Alias: "b"},
+	}
+	h := NewTreeHandler(cfg)
+	ctx := context.Background()
+	for _, f := range cfg.Folders {
+		if _, err := h.folderTree(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Removing "a" shifts "b" to index 0; its cached tree must still be its own
+	if _, ok := cfg.RemoveFolderByID("a"); !ok {
+		t.Fatal("expected folder a to be removed")
+	}
+	tree, err := h.folderTree(ctx, cfg.FoldersSnapshot()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.FolderID != "b" || len(tree.Children) != 1 || tree.Children[0].Path != "b/b.md" {
+		t.Errorf("expected the tree of folder b, got %s", tree.ToJSON())
+	}
+}
+
+func TestInvalidateClearsTitles(t *testing.T) {
+	cfg := config.DefaultConfig()
+	h := NewTreeHandler(cfg)
+	h.titles.entries["docs/a.md"] = titleEntry{title: "A"}
+
+	h.Invalidate()
+	if len(h.titles.entries) != 0 {
+		t.Errorf("expected titles to be cleared, got %v", h.titles.entries)
+	}
+}
+
+// Run with -race: removing and adding folders must not race with requests reading them
+func TestFolderMutationsDuringReads(t *testing.T) {
+	root := t.TempDir()
+	names := []string{"a", "b", "c"}
+	for _, name := range names {
+		writeDoc(t, filepath.Join(root, name, "doc.md"), "# "+name+"\n\nneedle\n")
+	}
+	cfg := config.DefaultConfig()
+	cfg.Ephemeral = true
+	for _, name := range names {
+		if err := cfg.AddFolder(filepath.Join(root, name), name, "", "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	r := gin.New()
+	r.GET("/tree", tree.GetTree)
+	r.GET("/folders", tree.GetFolders)
+	r.GET("/search", NewSearchHandler(cfg, tree).Search)
+	r.POST("/folders", tree.AddFolder)
+	r.DELETE("/folders", tree.RemoveFolder)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, path := range []string{"/tree", "/folders", "/search?q=needle"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("GET %s: expected 200, got %d", path, w.Code)
+					return
+				}
+			}
+		}(path)
+	}
+
+	send := func(method, body string) {
+		req := httptest.NewRequest(method, "/folders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s /folders: expected 200, got %d: %s", method, w.Code, w.Body.String())
+		}
+	}
+	for i := 0; i < 200; i++ {
+		folder := cfg.FoldersSnapshot()[0]
+		send(http.MethodDelete, `{"id":"`+folder.ID+`"}`)
+		send(http.MethodPost, `{"path":"`+folder.Path+`","alias":"`+folder.Alias+`"}`)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestFolderTreeEmptyReason(t *testing.T) {
+	root := t.TempDir()
+	writeDoc(t, filepath.Join(root, "docs", "guide.md"), "# Guide\n")
+	writeDoc(t, filepath.Join(root, "excluded", "drafts", "a.md"), "# A\n")
+	writeDoc(t, filepath.Join(root, "code", "main.go"), "package main\n")
+	writeDoc(t, filepath.Join(root, "code", ".git", "HEAD"), "ref: refs/heads/main\n")
+	if err := os.MkdirAll(filepath.Join(root, "empty", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	h := NewTreeHandler(cfg)
+	tests := []struct {
+		folder config.Folder
+		want   string
+	}{
+		{config.Folder{ID: "docs", Path: filepath.Join(root, "docs"), Alias: "docs"}, ""},
+		{
+			config.Folder{ID: "excluded", Path: filepath.Join(root, "excluded"), Alias: "excluded", Exclude: []string{"drafts"}},
+			EmptyReasonAllExcluded,
+		},
+		{config.Folder{ID: "code", Path: filepath.Join(root, "code"), Alias: "code"}, EmptyReasonNoMarkdown},
+		{config.Folder{ID: "empty", Path: filepath.Join(root, "empty"), Alias: "empty"}, EmptyReasonEmpty},
+	}
+	for _, tt := range tests {
+		tree, err := h.folderTree(context.Background(), tt.folder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tree.EmptyReason != tt.want {
+			t.Errorf("%s: expected emptyReason %q, got %q", tt.folder.Alias, tt.want, tree.EmptyReason)
+		}
+	}
+}
+
+func TestAddFolderErrorCodes(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Ephemeral = true
+	cfg.MaxFolders = 1
+	if err := cfg.AddFolder(dir, "docs", "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/folders", NewTreeHandler(cfg).AddFolder)
+
+	tests := []struct {
+		body string
+		want ErrorCode
+	}{
+		{`{}`, CodeInvalidRequest},
+		{`{"path":"` + dir + `"}`, CodeFolderExists},
+		{`{"path":"` + dir + `","git_ref":"no-such-branch"}`, CodeGitRefNotFound},
+		{`{"path":"` + other + `"}`, CodeTooManyFolders},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/folders", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body APIError
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != tt.want || w.Code != tt.want.Status() {
+			t.Errorf("%s: expected %s (%d), got %s (%d)", tt.body, tt.want, tt.want.Status(), body.Code, w.Code)
+		}
+	}
+}
+
+func TestOverlappingFolders(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(docs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Ephemeral = true
+	cfg.Folders = []config.Folder{{ID: "repo", Path: dir, Alias: "repo"}}
+
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	r := gin.New()
+	r.POST("/folders", tree.AddFolder)
+	r.GET("/tree", tree.GetTree)
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	cfg.OverlappingFolders = config.OverlappingFoldersReject
+	w := send(http.MethodPost, "/folders", `{"path":"`+docs+`","alias":"docs"}`)
+	var apiErr APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil || apiErr.Code != CodeFolderOverlap {
+		t.Fatalf("expected folder_overlap, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.OverlappingFolders = ""
+	w = send(http.MethodPost, "/folders", `{"path":"`+docs+`","alias":"docs"}`)
+	var resp struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || len(resp.Warnings) != 1 {
+		t.Fatalf("expected the folder added with a warning, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.OverlappingFolders = config.OverlappingFoldersHide
+	tree.Invalidate()
+	var root TreeNode
+	if err := json.Unmarshal(send(http.MethodGet, "/tree", "").Body.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.FolderID != "repo" {
+		t.Errorf("expected the nested folder hidden from the tree, got %+v", root)
+	}
+}
+
+func TestFolderWritableFlag(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Ephemeral = true
+
+	gin.SetMode(gin.TestMode)
+	tree := NewTreeHandler(cfg)
+	r := gin.New()
+	r.GET("/folders", tree.GetFolders)
+	r.POST("/folders", tree.AddFolder)
+	r.PUT("/folders", tree.UpdateFolder)
+	send := func(method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/folders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s /folders: expected 200, got %d: %s", method, w.Code, w.Body.String())
+		}
+		return w
+	}
+	listed := func() map[string]folderResponse {
+		t.Helper()
+		var resp struct {
+			Folders []folderResponse `json:"folders"`
+		}
+		if err := json.Unmarshal(send(http.MethodGet, "").Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		byAlias := map[string]folderResponse{}
+		for _, f := range resp.Folders {
+			byAlias[f.Alias] = f
+		}
+		return byAlias
+	}
+
+	send(http.MethodPost, `{"path":"`+other+`","alias":"plain"}`)
+	send(http.MethodPost, `{"path":"`+dir+`","alias":"docs","writable":true}`)
+	folders := listed()
+	if f := folders["plain"]; f.Writable || f.CanWrite {
+		t.Errorf("expected a folder added without writable to be read-only, got %+v", f)
+	}
+	if f := folders["docs"]; !f.Writable || !f.CanWrite {
+		t.Fatalf("expected the folder to be added writable, got %+v", f)
+	}
+	if _, ok := fsForFolder(context.Background(), folders["plain"].Folder).(mfs.WritableFS); ok {
+		t.Error("expected a folder without writable to have a read-only file system")
+	}
+
+	id := folders["docs"].ID
+	send(http.MethodPut, `{"id":"`+id+`","alias":"renamed"}`)
+	if !listed()["renamed"].Writable {
+		t.Error("expected an update without writable to keep the flag")
+	}
+	cfg.ReadOnly = true
+	if f := listed()["renamed"]; !f.Writable || f.CanWrite {
+		t.Errorf("expected the server's read_only to override the folder's writable, got %+v", f)
+	}
+	cfg.ReadOnly = false
+	send(http.MethodPut, `{"id":"`+id+`","alias":"renamed","writable":false}`)
+	if listed()["renamed"].Writable {
+		t.Error("expected writable: false to make the folder read-only")
+	}
+}
+
+func TestGetTreeSingleFolder(t *testing.T) {
+	docs, notes := t.TempDir(), t.TempDir()
+	writeDoc(t, filepath.Join(docs, "a.md"), "---\ntags: [go]\n---\n# A\n")
+	writeDoc(t, filepath.Join(docs, "b.md"), "# B\n")
+	writeDoc(t, filepath.Join(notes, "n.md"), "---\ntags: [go]\n---\n# N\n")
+	cfg := config.DefaultConfig()
+	// IDs differ from aliases, so that each query is seen to match its own field
+	cfg.Folders = []config.Folder{
+		{ID: "f-docs", Path: docs, Alias: "docs"},
+		{ID: "f-notes", Path: notes, Alias: "notes"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/tree", NewTreeHandler(cfg).GetTree)
+	get := func(query string) (int, TreeNode) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tree?"+query, nil))
+		var root TreeNode
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &root); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, root
+	}
+	names := func(node TreeNode) []string {
+		var names []string
+		for _, child := range node.Children {
+			names = append(names, child.Name)
+		}
+		return names
+	}
+
+	for query, want := range map[string]string{
+		"folder=notes":                 "f-notes",
+		"folderId=f-docs":              "f-docs",
+		"folder=notes&folderId=f-docs": "f-notes", // the alias wins
+	} {
+		code, root := get(query)
+		if code != http.StatusOK || root.FolderID != want || root.Type != "directory" {
+			t.Errorf("%s: expected the tree of %s, got %d %+v", query, want, code, root)
+		}
+	}
+	if _, root := get("folderId=f-docs"); !slices.Equal(names(root), []string{"a.md", "b.md"}) {
+		t.Errorf("expected the folder's documents, got %v", names(root))
+	}
+
+	for _, query := range []string{"folder=missing", "folderId=missing", "folder=f-docs", "folderId=docs",
+		"tag=go&folder=missing", "tag=go&folderId=missing"} {
+		if code, _ := get(query); code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", query, code)
+		}
+	}
+
+	// With ?tag= the folder narrows the flat list of tagged files
+	for query, want := range map[string][]string{
+		"tag=go":                   {"a.md", "n.md"},
+		"tag=go&folder=notes":      {"n.md"},
+		"tag=go&folderId=f-docs":   {"a.md"},
+		"tag=none&folderId=f-docs": nil,
+	} {
+		code, root := get(query)
+		if code != http.StatusOK || root.Type != "root" || !slices.Equal(names(root), want) {
+			t.Errorf("%s: expected %v, got %d %+v", query, want, code, root)
+		}
+	}
+}
+
+func TestFolderTreeExcludeRules(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	writeDoc(t, filepath.Join(dir, "generated", "dump.md"), strings.Repeat("x", 2048))
+	writeDoc(t, filepath.Join(dir, "old", "notes.md"), "# Notes\n")
+	old := time.Now().AddDate(-2, 0, 0)
+	if err := os.Chtimes(filepath.Join(dir, "old", "notes.md"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.ExcludeRules = []config.ExcludeRule{{SizeGT: 1024}, {ModifiedBefore: "365d"}}
+	folder := config.Folder{ID: "docs", Path: dir, Alias: "docs"}
+	cfg.Folders = []config.Folder{folder}
+
+	tree, err := NewTreeHandler(cfg).folderTree(context.Background(), folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, node := range collectFiles(tree, nil) {
+		paths = append(paths, node.Path)
+	}
+	// Directories left empty disappear too
+	if len(paths) != 1 || paths[0] != "docs/guide.md" || len(tree.Children) != 1 {
+		t.Errorf("expected only the small, recent file, got %v", paths)
+	}
+}
+
+func TestFolderTreeMaxDirEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	for i := 0; i < 5; i++ {
+		writeDoc(t, filepath.Join(dir, "cache", fmt.Sprintf("entry%d.md", i)), "x")
+	}
+	cfg := config.DefaultConfig()
+	cfg.MaxDirEntries = 3
+	folder := config.Folder{ID: "docs", Path: dir, Alias: "docs"}
+	cfg.Folders = []config.Folder{folder}
+
+	tree, err := NewTreeHandler(cfg).folderTree(context.Background(), folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Truncated || len(tree.Children) != 2 {
+		t.Fatalf("expected the root to be complete, got %+v", tree)
+	}
+	cache := tree.Children[0]
+	if !cache.Truncated || len(cache.Children) != 3 {
+		t.Errorf("expected cache/ to be truncated to 3 entries, got %d (truncated %v)",
+			len(cache.Children), cache.Truncated)
+	}
+
+	cfg.MaxDirEntries = -1
+	tree, err = NewTreeHandler(cfg).folderTree(context.Background(), folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache = tree.Children[0]; cache.Truncated || len(cache.Children) != 5 {
+		t.Errorf("expected no limit with -1, got %d entries", len(cache.Children))
+	}
+}
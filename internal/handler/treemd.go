@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// markdownLinkTextEscaper escapes what would end the text of a markdown link early
+var markdownLinkTextEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+// GetTreeMarkdown renders the tree of every folder, or of the one named by ?folder= or ?folderId=,
+// as a nested markdown list in tree order: directories as items, documents as links to their
+// alias-prefixed paths, such as "- [setup.md](docs/guide/setup.md)". With several folders each is
+// an item of its own. ?titles=1 names documents by their title rather than their file name.
+func (h *TreeHandler) GetTreeMarkdown(c *gin.Context) {
+	folders, ok := h.tagFolders(c)
+	if !ok {
+		return
+	}
+	titles, _ := strconv.ParseBool(c.Query("titles"))
+
+	ctx := c.Request.Context()
+	var b strings.Builder
+	for _, folder := range folders {
+		tree, err := h.folderTree(ctx, folder)
+		if err != nil {
+			continue
+		}
+		fs := fsForFolder(ctx, folder)
+		depth := 0
+		if len(folders) > 1 {
+			b.WriteString("- " + markdownLinkTextEscaper.Replace(folder.Alias) + "\n")
+			depth = 1
+		}
+		for _, child := range tree.Children {
+			h.writeTreeMarkdown(&b, fs, folder.Alias, child, depth, titles)
+		}
+	}
+	if requestDone(c) {
+		return
+	}
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(b.String()))
+}
+
+// writeTreeMarkdown writes node of the folder with alias, read through fs, and the nodes below it
+// as list items indented by depth levels
+func (h *TreeHandler) writeTreeMarkdown(b *strings.Builder, fs mfs.FileSystem, alias string, node *TreeNode,
+	depth int, titles bool) {
+	b.WriteString(strings.Repeat("  ", depth) + "- ")
+	if node.Type != "file" {
+		b.WriteString(markdownLinkTextEscaper.Replace(node.Name) + "\n")
+		for _, child := range node.Children {
+			h.writeTreeMarkdown(b, fs, alias, child, depth+1, titles)
+		}
+		return
+	}
+	text := node.Name
+	if titles {
+		if title := h.titles.get(fs, strings.TrimPrefix(node.Path, alias+"/"), node); title != "" {
+			text = title
+		}
+	}
+	dest := (&url.URL{Path: node.Path}).EscapedPath()
+	b.WriteString("[" + markdownLinkTextEscaper.Replace(text) + "](" + dest + ")\n")
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetTreeMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "index.md"), "# Welcome\n")
+	writeDoc(t, filepath.Join(dir, "guide", "setup notes.md"), "# Setup [beta]\n")
+	writeDoc(t, filepath.Join(dir, "guide", "untitled.md"), "No heading\n")
+	other := t.TempDir()
+	writeDoc(t, filepath.Join(other, "faq.md"), "# FAQ\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "docs", Path: dir, Alias: "docs"},
+		{ID: "help", Path: other, Alias: "help"},
+	}
+	h := NewTreeHandler(cfg)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/tree.md", h.GetTreeMarkdown)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/tree.md?folder=docs")
+	want := "- guide\n" +
+		"  - [setup notes.md](docs/guide/setup%20notes.md)\n" +
+		"  - [untitled.md](docs/guide/untitled.md)\n" +
+		"- [index.md](docs/index.md)\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("unexpected folder list %d:\n%s\nwant:\n%s", w.Code, w.Body.String(), want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/markdown; charset=utf-8" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	// Titles replace file names where a document has one; several folders are items of their own
+	w = get("/tree.md?titles=1")
+	want = "- docs\n" +
+		"  - guide\n" +
+		"    - [Setup \\[beta\\]](docs/guide/setup%20notes.md)\n" +
+		"    - [untitled.md](docs/guide/untitled.md)\n" +
+		"  - [Welcome](docs/index.md)\n" +
+		"- help\n" +
+		"  - [FAQ](help/faq.md)\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("unexpected list with titles %d:\n%s\nwant:\n%s", w.Code, w.Body.String(), want)
+	}
+
+	if w := get("/tree.md?folderId=missing"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown folder, got %d", w.Code)
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// URLsHandler serves the URLs other devices on the network can use to reach the server
+type URLsHandler struct {
+	urls []string
+}
+
+// NewURLsHandler creates a URLs handler for the given LAN URLs; pass none when bound to loopback
+func NewURLsHandler(urls []string) *URLsHandler {
+	return &URLsHandler{urls: urls}
+}
+
+// GetURLs returns the LAN URLs printed at startup (an empty list when bound to loopback)
+func (h *URLsHandler) GetURLs(c *gin.Context) {
+	urls := h.urls
+	if urls == nil {
+		urls = []string{}
+	}
+	writeJSON(c, http.StatusOK, gin.H{
+		"urls": urls,
+	})
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultVariantCacheSize caps the resized images kept on disk when assets.variant_cache_size is unset
+const defaultVariantCacheSize = 256 << 20
+
+// variantCache keeps resized images on disk, as <key>.<ext>, up to maxSize bytes. The least
+// recently used go first; use is recorded in the files' mod times, so it survives restarts. The
+// directory is read on first use.
+type variantCache struct {
+	dir     string
+	maxSize int64 // negative: keep nothing
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]variantEntry // by key
+	size    int64
+}
+
+// variantEntry is a cached variant, by its key
+type variantEntry struct {
+	ext  string
+	size int64
+	used time.Time
+}
+
+func newVariantCache(dir string, maxSize int64) *variantCache {
+	if maxSize == 0 {
+		maxSize = defaultVariantCacheSize
+	}
+	return &variantCache{dir: dir, maxSize: maxSize, entries: map[string]variantEntry{}}
+}
+
+// load lists the variants already on disk; vc.mu must be held
+func (vc *variantCache) load() {
+	if vc.loaded {
+		return
+	}
+	vc.loaded = true
+	files, err := os.ReadDir(vc.dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		info, err := f.Info()
+		ext := filepath.Ext(f.Name())
+		if err != nil || !info.Mode().IsRegular() || ext == "" || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		key := strings.TrimSuffix(f.Name(), ext)
+		vc.entries[key] = variantEntry{ext: ext[1:], size: info.Size(), used: info.ModTime()}
+		vc.size += info.Size()
+	}
+}
+
+// get returns the variant of key and its extension, marking it used
+func (vc *variantCache) get(key string) ([]byte, string, bool) {
+	vc.mu.Lock()
+	vc.load()
+	entry, ok := vc.entries[key]
+	vc.mu.Unlock()
+	if !ok {
+		return nil, "", false
+	}
+	name := filepath.Join(vc.dir, key+"."+entry.ext)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		vc.mu.Lock()
+		if current, ok := vc.entries[key]; ok && current == entry {
+			delete(vc.entries, key)
+			vc.size -= entry.size
+		}
+		vc.mu.Unlock()
+		return nil, "", false
+	}
+	now := time.Now()
+	_ = os.Chtimes(name, now, now)
+	vc.mu.Lock()
+	if current, ok := vc.entries[key]; ok {
+		current.used = now
+		vc.entries[key] = current
+	}
+	vc.mu.Unlock()
+	return data, entry.ext, true
+}
+
+// put stores the variant of key, then removes the least recently used variants past maxSize
+func (vc *variantCache) put(key, ext string, data []byte) {
+	if vc.maxSize < 0 || int64(len(data)) > vc.maxSize {
+		return
+	}
+	if err := os.MkdirAll(vc.dir, 0755); err != nil {
+		return
+	}
+	// Written aside, then renamed, so that readers never see part of a variant
+	tmp, err := os.CreateTemp(vc.dir, ".variant-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(vc.dir, key+"."+ext))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.load()
+	if old, ok := vc.entries[key]; ok {
+		vc.size -= old.size
+	}
+	vc.entries[key] = variantEntry{ext: ext, size: int64(len(data)), used: time.Now()}
+	vc.size += int64(len(data))
+	if vc.size <= vc.maxSize {
+		return
+	}
+	keys := make([]string, 0, len(vc.entries))
+	for k := range vc.entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return vc.entries[keys[i]].used.Before(vc.entries[keys[j]].used) })
+	for _, k := range keys {
+		if vc.size <= vc.maxSize {
+			break
+		}
+		entry := vc.entries[k]
+		if err := os.Remove(filepath.Join(vc.dir, k+"."+entry.ext)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		delete(vc.entries, k)
+		vc.size -= entry.size
+	}
+}
+
+// purge removes every variant, returning how many there were and their size
+func (vc *variantCache) purge() (int, int64, error) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.load()
+	count, size := len(vc.entries), vc.size
+	if err := os.RemoveAll(vc.dir); err != nil {
+		return 0, 0, err
+	}
+	vc.entries, vc.size = map[string]variantEntry{}, 0
+	return count, size, nil
+}
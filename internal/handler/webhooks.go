@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/crash"
+	"github.com/CageChen/markhub/internal/timestamp"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+// Headers of a webhook delivery
+const (
+	// WebhookEventHeader names the event of the delivery
+	WebhookEventHeader = "X-MarkHub-Event"
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body, keyed by the
+	// webhook's secret, on generic deliveries
+	WebhookSignatureHeader = "X-MarkHub-Signature"
+)
+
+const (
+	// webhookDebounce collects the watcher events of a path before it is posted, so an editor's
+	// burst of writes becomes one delivery
+	webhookDebounce = 2 * time.Second
+	// webhookQueueSize bounds the deliveries waiting for one webhook; later ones are dropped
+	webhookQueueSize = 256
+	// webhookAttempts is how often a delivery is tried before it counts as failed
+	webhookAttempts = 5
+	// webhookRetryDelay is the wait before the first retry, doubled before each further one
+	webhookRetryDelay = 2 * time.Second
+	// webhookTimeout bounds a single attempt
+	webhookTimeout = 10 * time.Second
+)
+
+// WebhookPayload is the body of a generic webhook delivery
+type WebhookPayload struct {
+	Event    string         `json:"event"`
+	Path     string         `json:"path"`
+	FolderID string         `json:"folderId"`
+	Title    string         `json:"title,omitempty"`
+	URL      string         `json:"url"`
+	Time     timestamp.Time `json:"time"`
+}
+
+// WebhookStatus reports the deliveries of one webhook
+type WebhookStatus struct {
+	// URL is the webhook's scheme and host; the path often holds a token and is left out
+	URL       string   `json:"url"`
+	Template  string   `json:"template"`
+	Events    []string `json:"events"`
+	FolderIDs []string `json:"folderIds"`
+	// Queued deliveries wait to be sent; Dropped ones found the queue full
+	Queued    int   `json:"queued"`
+	Delivered int64 `json:"delivered"`
+	// Failed deliveries gave up after webhookAttempts tries
+	Failed              int64           `json:"failed"`
+	Dropped             int64           `json:"dropped"`
+	ConsecutiveFailures int64           `json:"consecutiveFailures"`
+	LastError           string          `json:"lastError,omitempty"`
+	LastDelivery        *timestamp.Time `json:"lastDelivery,omitempty"`
+	LastFailure         *timestamp.Time `json:"lastFailure,omitempty"`
+}
+
+// webhookDelivery is a payload waiting to be posted to one webhook
+type webhookDelivery struct {
+	event string
+	body  []byte
+}
+
+// webhookTarget is a configured webhook with its queue and counters
+type webhookTarget struct {
+	hook  config.Webhook
+	queue chan webhookDelivery
+
+	mu     sync.Mutex
+	status WebhookStatus
+}
+
+// pendingChange is the debounced state of a path the watcher reported
+type pendingChange struct {
+	// created is set when the first event seen was a create, so the path did not exist before
+	created bool
+}
+
+// WebhookHandler posts file changes reported by the watcher to the configured webhooks. Every
+// webhook has its own bounded queue and worker, so a slow or dead URL delays and drops only its
+// own deliveries and never blocks the watcher.
+type WebhookHandler struct {
+	cfg     *config.Config
+	targets []*webhookTarget
+	client  *http.Client
+	baseURL string
+	// debounce and retryDelay are webhookDebounce and webhookRetryDelay; tests shorten them
+	debounce   time.Duration
+	retryDelay time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pendingChange // by file system path
+	timer   *time.Timer
+
+	stop chan struct{}
+}
+
+// NewWebhookHandler creates the handler of cfg's webhooks; Start begins delivering
+func NewWebhookHandler(cfg *config.Config) *WebhookHandler {
+	h := &WebhookHandler{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: webhookTimeout},
+		baseURL:    "http://" + cfg.LocalAddr(),
+		debounce:   webhookDebounce,
+		retryDelay: webhookRetryDelay,
+		pending:    map[string]pendingChange{},
+		stop:       make(chan struct{}),
+	}
+	for _, hook := range cfg.Webhooks {
+		if hook.Template == "" {
+			hook.Template = config.WebhookTemplateGeneric
+		}
+		h.targets = append(h.targets, &webhookTarget{
+			hook:  hook,
+			queue: make(chan webhookDelivery, webhookQueueSize),
+			status: WebhookStatus{
+				URL:       redactWebhookURL(hook.URL),
+				Template:  hook.Template,
+				Events:    nonNil(hook.Events),
+				FolderIDs: nonNil(hook.FolderIDs),
+			},
+		})
+	}
+	return h
+}
+
+// Start runs a delivery worker for every webhook
+func (h *WebhookHandler) Start() {
+	for _, target := range h.targets {
+		go h.deliver(target)
+	}
+}
+
+// Stop ends the workers started by Start; queued deliveries are dropped
+func (h *WebhookHandler) Stop() {
+	close(h.stop)
+}
+
+// OnFileChange collects the changes of markdown files; they are posted once the path has been
+// quiet for the debounce delay. It is called by the file watcher.
+func (h *WebhookHandler) OnFileChange(e watcher.Event) {
+	if len(h.targets) == 0 || !h.cfg.IsMarkdownFile(e.Path) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.pending[e.Path]; !ok {
+		h.pending[e.Path] = pendingChange{created: e.Type == watcher.EventCreate}
+	}
+	if h.timer == nil {
+		h.timer = time.AfterFunc(h.debounce, h.flush)
+	} else {
+		h.timer.Reset(h.debounce)
+	}
+}
+
+// flush queues a delivery for every collected change, to each webhook that wants it
+func (h *WebhookHandler) flush() {
+	defer crash.Recover("webhook flush")
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = map[string]pendingChange{}
+	h.timer = nil
+	h.mu.Unlock()
+
+	now := time.Now().UTC()
+	for fsPath, change := range pending {
+		// Whether the file exists now, against the first event, decides what happened to it
+		_, err := os.Stat(fsPath)
+		exists := err == nil
+		event := config.WebhookEventUpdate
+		switch {
+		case change.created && !exists:
+			continue
+		case change.created:
+			event = config.WebhookEventCreate
+		case !exists:
+			event = config.WebhookEventRemove
+		}
+		var title string
+		if exists {
+			if content, err := os.ReadFile(fsPath); err == nil {
+				title = sniffTitle(content)
+			}
+		}
+		for _, folder := range h.cfg.FoldersSnapshot() {
+			relPath, ok := webhookRelPath(folder, fsPath)
+			if !ok {
+				continue
+			}
+			payload := WebhookPayload{
+				Event:    event,
+				Path:     folder.Alias + "/" + relPath,
+				FolderID: folder.ID,
+				Title:    title,
+				Time:     timestamp.New(now),
+			}
+			for _, target := range h.targets {
+				if target.wants(event, folder.ID) {
+					h.enqueue(target, payload)
+				}
+			}
+		}
+	}
+}
+
+// webhookRelPath returns fsPath relative to the local folder when it lies within the folder's
+// sub_path; the watcher has already left out excluded paths
+func webhookRelPath(folder config.Folder, fsPath string) (string, bool) {
+	if folder.GitRef != "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(folder.Path, fsPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if subPath := strings.Trim(filepath.ToSlash(folder.SubPath), "/"); subPath != "" &&
+		!strings.HasPrefix(rel, subPath+"/") {
+		return "", false
+	}
+	return rel, true
+}
+
+// wants reports whether the webhook subscribes to event in the folder
+func (t *webhookTarget) wants(event, folderID string) bool {
+	return (len(t.hook.Events) == 0 || slices.Contains(t.hook.Events, event)) &&
+		(len(t.hook.FolderIDs) == 0 || slices.Contains(t.hook.FolderIDs, folderID))
+}
+
+// enqueue renders payload for the webhook and queues it, counting it dropped when the queue is full
+func (h *WebhookHandler) enqueue(target *webhookTarget, payload WebhookPayload) {
+	payload.URL = strings.TrimSuffix(h.linkBase(target), "/") + "/#" + payload.Path
+	var body []byte
+	var err error
+	if target.hook.Template == config.WebhookTemplateSlack {
+		body, err = json.Marshal(slackMessage(payload))
+	} else {
+		body, err = json.Marshal(payload)
+	}
+	if err != nil {
+		return
+	}
+	select {
+	case target.queue <- webhookDelivery{event: payload.Event, body: body}:
+	default:
+		target.mu.Lock()
+		target.status.Dropped++
+		target.mu.Unlock()
+		log.Printf("Webhook %s: queue full, dropping %s of %s", target.status.URL, payload.Event, payload.Path)
+	}
+}
+
+// linkBase returns the start of the viewer links posted to the webhook
+func (h *WebhookHandler) linkBase(target *webhookTarget) string {
+	if target.hook.BaseURL != "" {
+		return target.hook.BaseURL
+	}
+	return h.baseURL
+}
+
+// slackMessage renders payload for a Slack incoming webhook
+func slackMessage(payload WebhookPayload) map[string]string {
+	verb := map[string]string{
+		config.WebhookEventCreate: "Created",
+		config.WebhookEventUpdate: "Updated",
+		config.WebhookEventRemove: "Removed",
+	}[payload.Event]
+	name := payload.Title
+	if name == "" {
+		name = payload.Path
+	}
+	if payload.Event == config.WebhookEventRemove {
+		return map[string]string{"text": fmt.Sprintf("%s `%s`", verb, payload.Path)}
+	}
+	return map[string]string{
+		"text": fmt.Sprintf("%s <%s|%s> (`%s`)", verb, payload.URL, slackEscape(name), payload.Path),
+	}
+}
+
+// slackEscape escapes the characters Slack's message formatting reserves
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// deliver posts the webhook's queued deliveries one at a time until Stop
+func (h *WebhookHandler) deliver(target *webhookTarget) {
+	defer crash.Recover("webhook delivery")
+	for {
+		select {
+		case <-h.stop:
+			return
+		case d := <-target.queue:
+			h.send(target, d)
+		}
+	}
+}
+
+// send tries a delivery up to webhookAttempts times, doubling the delay between attempts
+func (h *WebhookHandler) send(target *webhookTarget, d webhookDelivery) {
+	delay := h.retryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = h.post(target, d); err == nil {
+			now := time.Now()
+			target.mu.Lock()
+			target.status.Delivered++
+			target.status.ConsecutiveFailures = 0
+			target.status.LastDelivery = timestamp.Ptr(now)
+			target.mu.Unlock()
+			return
+		}
+		if attempt == webhookAttempts {
+			break
+		}
+		select {
+		case <-h.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	now := time.Now()
+	target.mu.Lock()
+	target.status.Failed++
+	target.status.ConsecutiveFailures++
+	target.status.LastError = err.Error()
+	target.status.LastFailure = timestamp.Ptr(now)
+	target.mu.Unlock()
+	log.Printf("Webhook %s: giving up on a %s delivery after %d attempts: %v",
+		target.status.URL, d.event, webhookAttempts, err)
+}
+
+// post makes one attempt at a delivery; any status other than 2xx fails it
+func (h *WebhookHandler) post(target *webhookTarget, d webhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.hook.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, d.event)
+	if target.hook.Template == config.WebhookTemplateGeneric && target.hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(target.hook.Secret))
+		mac.Write(d.body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// redactWebhookURL keeps the scheme and host of rawURL; Slack and similar services put the token in
+// the path
+func redactWebhookURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// GetStatus reports the queue and delivery counters of every configured webhook
+func (h *WebhookHandler) GetStatus(c *gin.Context) {
+	webhooks := make([]WebhookStatus, 0, len(h.targets))
+	for _, target := range h.targets {
+		target.mu.Lock()
+		status := target.status
+		target.mu.Unlock()
+		status.Queued = len(target.queue)
+		webhooks = append(webhooks, status)
+	}
+	writeJSON(c, http.StatusOK, gin.H{"webhooks": webhooks})
+}
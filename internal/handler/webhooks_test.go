@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/watcher"
+	"github.com/gin-gonic/gin"
+)
+
+// webhookReceiver records the deliveries posted to it, failing the first failures of them
+type webhookReceiver struct {
+	mu         sync.Mutex
+	failures   int
+	deliveries []*http.Request
+	bodies     [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if wr.failures > 0 {
+		wr.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	wr.deliveries = append(wr.deliveries, r)
+	wr.bodies = append(wr.bodies, body)
+}
+
+// wait returns the first n deliveries once they arrived
+func (wr *webhookReceiver) wait(t *testing.T, n int) ([]*http.Request, [][]byte) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		wr.mu.Lock()
+		if len(wr.deliveries) >= n {
+			defer wr.mu.Unlock()
+			return wr.deliveries[:n], wr.bodies[:n]
+		}
+		wr.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d deliveries", n)
+	return nil, nil
+}
+
+func getWebhookStatus(t *testing.T, h *WebhookHandler) []WebhookStatus {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/webhooks", h.GetStatus)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks", nil))
+	var resp struct {
+		Webhooks []WebhookStatus `json:"webhooks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Webhooks
+}
+
+// waitWebhookStatus returns the status once done holds for it, as counters move after the receiver answered
+func waitWebhookStatus(t *testing.T, h *WebhookHandler, done func([]WebhookStatus) bool) []WebhookStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	statuses := getWebhookStatus(t, h)
+	for !done(statuses) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		statuses = getWebhookStatus(t, h)
+	}
+	return statuses
+}
+
+func TestWebhooks(t *testing.T) {
+	generic, slack := &webhookReceiver{failures: 2}, &webhookReceiver{}
+	genericServer, slackServer := httptest.NewServer(generic), httptest.NewServer(slack)
+	defer genericServer.Close()
+	defer slackServer.Close()
+
+	dir, other := t.TempDir(), t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{
+		{ID: "runbooks", Path: dir, Alias: "runbooks"},
+		{ID: "other", Path: other, Alias: "other"},
+	}
+	cfg.Webhooks = []config.Webhook{
+		{URL: genericServer.URL + "/hook", Secret: "s3cret", Events: []string{config.WebhookEventCreate}},
+		{URL: slackServer.URL + "/services/token", Template: config.WebhookTemplateSlack,
+			FolderIDs: []string{"runbooks"}, BaseURL: "https://docs.example.com/"},
+	}
+	h := NewWebhookHandler(cfg)
+	h.debounce, h.retryDelay = 20*time.Millisecond, time.Millisecond
+	h.Start()
+	defer h.Stop()
+
+	// A burst of events on one file is posted once, as what happened overall
+	doc := filepath.Join(dir, "db.md")
+	writeDoc(t, doc, "# DB failover\n")
+	h.OnFileChange(watcher.Event{Type: watcher.EventCreate, Path: doc})
+	h.OnFileChange(watcher.Event{Type: watcher.EventWrite, Path: doc})
+	h.OnFileChange(watcher.Event{Type: watcher.EventWrite, Path: filepath.Join(dir, "image.png")})
+
+	reqs, bodies := generic.wait(t, 1)
+	var payload WebhookPayload
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != config.WebhookEventCreate || payload.Path != "runbooks/db.md" ||
+		payload.FolderID != "runbooks" || payload.Title != "DB failover" ||
+		payload.URL != "http://"+cfg.LocalAddr()+"/#runbooks/db.md" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(bodies[0])
+	if got := reqs[0].Header.Get(WebhookSignatureHeader); got != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("unexpected signature %q", got)
+	}
+	if reqs[0].Header.Get(WebhookEventHeader) != config.WebhookEventCreate {
+		t.Errorf("unexpected event header %q", reqs[0].Header.Get(WebhookEventHeader))
+	}
+
+	reqs, bodies = slack.wait(t, 1)
+	var message map[string]string
+	if err := json.Unmarshal(bodies[0], &message); err != nil {
+		t.Fatal(err)
+	}
+	want := "Created <https://docs.example.com/#runbooks/db.md|DB failover> (`runbooks/db.md`)"
+	if message["text"] != want || reqs[0].Header.Get(WebhookSignatureHeader) != "" {
+		t.Errorf("expected %q unsigned, got %q", want, message["text"])
+	}
+
+	// Updates only reach the Slack webhook, and other folders only the generic one, which ignores updates
+	writeDoc(t, filepath.Join(other, "x.md"), "# X\n")
+	h.OnFileChange(watcher.Event{Type: watcher.EventWrite, Path: filepath.Join(other, "x.md")})
+	if err := os.Remove(doc); err != nil {
+		t.Fatal(err)
+	}
+	h.OnFileChange(watcher.Event{Type: watcher.EventRemove, Path: doc})
+	_, bodies = slack.wait(t, 2)
+	if err := json.Unmarshal(bodies[1], &message); err != nil || message["text"] != "Removed `runbooks/db.md`" {
+		t.Errorf("unexpected removal message %q", message["text"])
+	}
+
+	statuses := waitWebhookStatus(t, h, func(s []WebhookStatus) bool { return s[1].Delivered == 2 })
+	if len(statuses) != 2 || statuses[0].URL != genericServer.URL ||
+		statuses[0].Template != config.WebhookTemplateGeneric || statuses[0].Delivered != 1 ||
+		statuses[0].Failed != 0 || statuses[1].Delivered != 2 || strings.Contains(statuses[1].URL, "token") {
+		t.Errorf("unexpected status %+v", statuses)
+	}
+}
+
+func TestWebhookFailures(t *testing.T) {
+	receiver := &webhookReceiver{failures: webhookAttempts}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+	cfg.Webhooks = []config.Webhook{{URL: server.URL}}
+	h := NewWebhookHandler(cfg)
+	h.debounce, h.retryDelay = time.Millisecond, time.Millisecond
+	h.Start()
+	defer h.Stop()
+
+	// Every attempt at the first delivery fails; the next one goes through
+	for i, name := range []string{"a.md", "b.md"} {
+		writeDoc(t, filepath.Join(dir, name), "# "+name+"\n")
+		h.OnFileChange(watcher.Event{Type: watcher.EventCreate, Path: filepath.Join(dir, name)})
+		if i == 0 {
+			waitWebhookStatus(t, h, func(s []WebhookStatus) bool { return s[0].Failed == 1 })
+		}
+	}
+	status := waitWebhookStatus(t, h, func(s []WebhookStatus) bool { return s[0].Delivered == 1 })[0]
+	if status.Failed != 1 || status.Delivered != 1 || status.ConsecutiveFailures != 0 ||
+		!strings.Contains(status.LastError, "503") || status.LastFailure == nil || status.LastDelivery == nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	// A full queue drops deliveries instead of blocking the watcher; this handler has no worker
+	idle := NewWebhookHandler(cfg)
+	for i := 0; i < webhookQueueSize+1; i++ {
+		idle.enqueue(idle.targets[0], WebhookPayload{Event: config.WebhookEventUpdate, Path: "docs/a.md"})
+	}
+	if status := getWebhookStatus(t, idle)[0]; status.Queued != webhookQueueSize || status.Dropped != 1 {
+		t.Errorf("expected a full queue and one dropped delivery, got %+v", status)
+	}
+}
@@ -1,15 +1,33 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/CageChen/markhub/internal/crash"
 	"github.com/CageChen/markhub/internal/watcher"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// APIVersion is the current REST/WebSocket API version, mounted at /api/{APIVersion}
+const APIVersion = "v1"
+
+// wsHeartbeatInterval is how often each connection receives a heartbeat message
+const wsHeartbeatInterval = 30 * time.Second
+
+// wsEchoWindow is how long after an API write the writer is not told about changes to that file
+const wsEchoWindow = 2 * time.Second
+
+// wsMaxMessageSize bounds messages from clients; larger ones close the connection
+const wsMaxMessageSize = 64 << 10
+
+// wsRenderTimeout bounds a render requested over the socket
+const wsRenderTimeout = 30 * time.Second
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins for development
@@ -20,19 +38,84 @@ var upgrader = websocket.Upgrader{
 type WSMessage struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
+	// ID echoes the id of the client request a message answers
+	ID string `json:"id,omitempty"`
+}
+
+// wsRequest is a message from a client: {"type": "render", "path": "alias/doc.md"} asks for the
+// document's FileResponse, answered with a "render" or "renderError" message carrying the same id
+type wsRequest struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	ID   string `json:"id"`
+}
+
+// wsClient serializes writes to a connection; gorilla/websocket allows one concurrent writer
+type wsClient struct {
+	conn *websocket.Conn
+	id   string
+	mu   sync.Mutex
+}
+
+func (cl *wsClient) write(data []byte) error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// wsEcho records a client that just wrote a file and should not be notified of it
+type wsEcho struct {
+	clientID string
+	until    time.Time
 }
 
 // WSHandler handles WebSocket connections for hot reload
 type WSHandler struct {
-	clients map[*websocket.Conn]bool
+	clients map[*websocket.Conn]*wsClient
+	echoes  map[string]wsEcho
 	mu      sync.RWMutex
+	render  func(ctx context.Context, path string) (*FileResponse, error)
 }
 
 // NewWSHandler creates a new WebSocket handler
 func NewWSHandler() *WSHandler {
 	return &WSHandler{
-		clients: make(map[*websocket.Conn]bool),
+		clients: make(map[*websocket.Conn]*wsClient),
+		echoes:  make(map[string]wsEcho),
+	}
+}
+
+// SetRenderer sets how documents requested with a "render" message are rendered, normally
+// FileHandler.Render; without one such requests are answered with an error
+func (h *WSHandler) SetRenderer(render func(ctx context.Context, path string) (*FileResponse, error)) {
+	h.render = render
+}
+
+// SuppressEcho keeps the client that connected with ?clientId=clientID from being notified of
+// changes to path for a short while, because it is writing the file itself
+func (h *WSHandler) SuppressEcho(path, clientID string) {
+	if clientID == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	for p, echo := range h.echoes {
+		if now.After(echo.until) {
+			delete(h.echoes, p)
+		}
+	}
+	h.echoes[path] = wsEcho{clientID: clientID, until: now.Add(wsEchoWindow)}
+}
+
+// echoClient returns the client to skip when broadcasting a change to path
+func (h *WSHandler) echoClient(path string) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if echo, ok := h.echoes[path]; ok && time.Now().Before(echo.until) {
+		return echo.clientID
 	}
+	return ""
 }
 
 // HandleWS handles WebSocket upgrade and connection
@@ -41,20 +124,69 @@ func (h *WSHandler) HandleWS(c *gin.Context) {
 	if err != nil {
 		return
 	}
+	// The hijacked connection inherits the server's read/write deadlines; clear them for this long-lived socket
+	_ = conn.NetConn().SetDeadline(time.Time{})
 	defer func() {
 		h.removeClient(conn)
 		_ = conn.Close()
 	}()
 
-	h.addClient(conn)
+	client := h.addClient(conn, c.Query("clientId"))
+
+	done := make(chan struct{})
+	defer close(done)
+	go h.heartbeat(client, done)
+
+	// Renders stop when the connection goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Keep connection alive and handle incoming messages
+	conn.SetReadLimit(wsMaxMessageSize)
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		out, err := json.Marshal(h.handleMessage(ctx, data))
+		if err == nil && client.write(out) != nil {
+			break
+		}
+	}
+}
+
+// handleMessage returns the answer to a client message
+func (h *WSHandler) handleMessage(ctx context.Context, data []byte) WSMessage {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return wsError("error", "", "", CodeInvalidRequest, "invalid message")
+	}
+	if req.Type != "render" {
+		return wsError("error", req.ID, "", CodeInvalidRequest, "unknown message type: "+req.Type)
+	}
+	if req.Path == "" {
+		return wsError("renderError", req.ID, req.Path, CodeInvalidRequest, "path is required")
+	}
+	if h.render == nil {
+		return wsError("renderError", req.ID, req.Path, CodeInternal, "rendering is not available")
+	}
+	ctx, cancel := context.WithTimeout(ctx, wsRenderTimeout)
+	defer cancel()
+	resp, err := h.render(ctx, req.Path)
+	if err != nil {
+		code, msg := renderErrorCode(err)
+		return wsError("renderError", req.ID, req.Path, code, msg)
+	}
+	return WSMessage{Type: "render", Payload: resp, ID: req.ID}
+}
+
+// wsError builds an error message of the given type; path is omitted when empty
+func wsError(msgType, id, path string, code ErrorCode, message string) WSMessage {
+	payload := map[string]string{"code": string(code), "error": message}
+	if path != "" {
+		payload["path"] = path
 	}
+	return WSMessage{Type: msgType, Payload: payload, ID: id}
 }
 
 // OnFileChange is called when a file change is detected
@@ -81,13 +213,47 @@ func (h *WSHandler) OnFileChange(event watcher.Event) {
 		},
 	}
 
-	h.broadcast(msg)
+	h.broadcastExcept(msg, h.echoClient(event.Path))
+}
+
+// TreeChanged tells every client that path was created, deleted or restored through the API, so
+// sidebars reload the tree even when no watcher reports it (watching disabled, or an empty directory)
+func (h *WSHandler) TreeChanged(path string) {
+	h.broadcast(WSMessage{
+		Type:    "treeChanged",
+		Payload: map[string]string{"path": path},
+	})
 }
 
-func (h *WSHandler) addClient(conn *websocket.Conn) {
+// heartbeat periodically tells the client the server is alive and which API version it speaks
+func (h *WSHandler) heartbeat(client *wsClient, done <-chan struct{}) {
+	defer crash.Recover("websocket heartbeat")
+	ticker := time.NewTicker(wsHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(WSMessage{
+			Type: "heartbeat",
+			Payload: map[string]string{
+				"apiVersion": APIVersion,
+			},
+		})
+		if err == nil && client.write(data) != nil {
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *WSHandler) addClient(conn *websocket.Conn, id string) *wsClient {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.clients[conn] = true
+	client := &wsClient{conn: conn, id: id}
+	h.clients[conn] = client
+	return client
 }
 
 func (h *WSHandler) removeClient(conn *websocket.Conn) {
@@ -97,21 +263,28 @@ func (h *WSHandler) removeClient(conn *websocket.Conn) {
 }
 
 func (h *WSHandler) broadcast(msg WSMessage) {
+	h.broadcastExcept(msg, "")
+}
+
+// broadcastExcept sends msg to every client but the one that connected with skipID
+func (h *WSHandler) broadcastExcept(msg WSMessage, skipID string) {
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return
 	}
 
 	h.mu.RLock()
-	clients := make([]*websocket.Conn, 0, len(h.clients))
-	for client := range h.clients {
-		clients = append(clients, client)
+	clients := make([]*wsClient, 0, len(h.clients))
+	for _, client := range h.clients {
+		if skipID == "" || client.id != skipID {
+			clients = append(clients, client)
+		}
 	}
 	h.mu.RUnlock()
 
 	for _, client := range clients {
-		if err := client.WriteMessage(websocket.TextMessage, data); err != nil {
-			h.removeClient(client)
+		if err := client.write(data); err != nil {
+			h.removeClient(client.conn)
 		}
 	}
 }
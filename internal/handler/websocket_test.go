@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestSuppressEcho(t *testing.T) {
+	h := NewWSHandler()
+	h.SuppressEcho("/docs/a.md", "tab1")
+	h.SuppressEcho("/docs/b.md", "")
+
+	if got := h.echoClient("/docs/a.md"); got != "tab1" {
+		t.Errorf("expected tab1 to be skipped for a.md, got %q", got)
+	}
+	if got := h.echoClient("/docs/b.md"); got != "" {
+		t.Errorf("expected no client to be skipped without an ID, got %q", got)
+	}
+
+	h.echoes["/docs/a.md"] = wsEcho{clientID: "tab1", until: time.Now().Add(-time.Second)}
+	if got := h.echoClient("/docs/a.md"); got != "" {
+		t.Errorf("expected an expired echo to be ignored, got %q", got)
+	}
+}
+
+func TestWSRender(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n\nHello.\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs"}}
+
+	gin.SetMode(gin.TestMode)
+	h := NewWSHandler()
+	h.SetRenderer(NewFileHandler(cfg).Render)
+	r := gin.New()
+	r.GET("/ws", h.HandleWS)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// request sends a message and returns the first answer, skipping heartbeats
+	request := func(msg string) (string, string, json.RawMessage) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var reply struct {
+				Type    string          `json:"type"`
+				ID      string          `json:"id"`
+				Payload json.RawMessage `json:"payload"`
+			}
+			if err := conn.ReadJSON(&reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply.Type != "heartbeat" {
+				return reply.Type, reply.ID, reply.Payload
+			}
+		}
+	}
+
+	msgType, id, payload := request(`{"type":"render","path":"docs/guide.md","id":"1"}`)
+	var file FileResponse
+	if err := json.Unmarshal(payload, &file); err != nil {
+		t.Fatal(err)
+	}
+	if msgType != "render" || id != "1" || file.Title != "Guide" || !strings.Contains(file.HTML, "Hello.") {
+		t.Errorf("expected the rendered file, got %s %s %+v", msgType, id, file)
+	}
+
+	msgType, id, payload = request(`{"type":"render","path":"docs/missing.md","id":"2"}`)
+	if msgType != "renderError" || id != "2" || !strings.Contains(string(payload), string(CodeNotFound)) {
+		t.Errorf("expected a not_found renderError, got %s %s %s", msgType, id, payload)
+	}
+
+	if msgType, _, _ = request(`{"type":"bogus"}`); msgType != "error" {
+		t.Errorf("expected an error for an unknown message type, got %s", msgType)
+	}
+}
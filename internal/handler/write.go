@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	mfs "github.com/CageChen/markhub/internal/fs"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrReadOnlyFolder is returned for writes to folders that cannot be modified (git refs, folders without writable)
+var ErrReadOnlyFolder = errors.New("folder is read-only")
+
+// ETag returns the strong entity tag of file content, as sent by GetRaw and checked by PutRaw
+func ETag(content []byte) string {
+	return `"` + contentHash(content) + `"`
+}
+
+// etagMatches reports whether an If-Match header value matches etag, using strong comparison
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIDHeader identifies the browser tab making a write, which also passes it as ?clientId= when
+// opening the WebSocket, so it is not notified of its own change
+const ClientIDHeader = "X-Client-ID"
+
+// PutRaw replaces a markdown file with the request body. When the client sends If-Match (an ETag
+// from GetRaw) or ?baseModTime= (the modTime it read), the write is refused with 409 and the
+// current content if the file changed in the meantime.
+func (h *FileHandler) PutRaw(c *gin.Context) {
+	filePath, content, modTime, ok := h.saveFile(c, false)
+	if !ok {
+		return
+	}
+	resp := rawResponse(filePath, content, modTime)
+	resp.LockConflict = h.heldByOther(c, filePath)
+	c.Header("ETag", ETag(content))
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// PutFile replaces a markdown file with the request body like PutRaw and returns the re-rendered
+// file. Unlike PutRaw it requires a precondition, normally If-Match with the etag GetFile returned
+// (428 without one); ?force=true overwrites whatever is on disk instead, and is logged.
+func (h *FileHandler) PutFile(c *gin.Context) {
+	filePath, content, _, ok := h.saveFile(c, true)
+	if !ok {
+		return
+	}
+	resp, err := h.Render(c.Request.Context(), filePath)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("file saved but failed to render: %v", err))
+		return
+	}
+	resp.LockConflict = h.heldByOther(c, filePath)
+	c.Header("ETag", ETag(content))
+	writeJSON(c, http.StatusOK, resp)
+}
+
+// OnSave registers a callback run after a file is written through the API, with the file's path on
+// disk and the writer's ClientIDHeader (empty when not sent)
+func (h *FileHandler) OnSave(cb func(path, clientID string)) {
+	h.onSave = append(h.onSave, cb)
+}
+
+// OnTreeChange registers a callback run with the alias-prefixed path of every file or directory
+// created, deleted or restored through the API
+func (h *FileHandler) OnTreeChange(cb func(path string)) {
+	h.onTreeChange = append(h.onTreeChange, cb)
+}
+
+// OnView registers a callback run with the alias-prefixed path of every document GetFile renders
+func (h *FileHandler) OnView(cb func(path string)) {
+	h.onView = append(h.onView, cb)
+}
+
+// SetLockConflict installs the lookup of the edit lock another client than clientID holds on a
+// path, reported with saves as lock_conflict
+func (h *FileHandler) SetLockConflict(conflict func(path, clientID string) *EditLock) {
+	h.lockConflict = conflict
+}
+
+// heldByOther returns the edit lock a client other than the one making request c holds on filePath
+func (h *FileHandler) heldByOther(c *gin.Context, filePath string) *EditLock {
+	if h.lockConflict == nil {
+		return nil
+	}
+	return h.lockConflict(filePath, c.GetHeader(ClientIDHeader))
+}
+
+func (h *FileHandler) notifyTreeChange(p string) {
+	h.InvalidateCache()
+	for _, cb := range h.onTreeChange {
+		cb(p)
+	}
+}
+
+// resolveWritable resolves filePath to a folder whose files may be changed. On failure it has
+// already sent the error response and returns false.
+func (h *FileHandler) resolveWritable(
+	c *gin.Context, filePath string,
+) (mfs.WritableFS, string, config.Folder, bool) {
+	fs, relativePath, folder, err := h.resolvePath(c.Request.Context(), filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(c, CodeNotFound, "folder not found")
+		} else {
+			writeError(c, CodeAccessDenied, "access denied")
+		}
+		return nil, "", config.Folder{}, false
+	}
+	wfs, ok := fs.(mfs.WritableFS)
+	if !ok {
+		// Reading is all the folder allows
+		c.Header("Allow", "GET, HEAD")
+		writeError(c, CodeFolderReadOnly, ErrReadOnlyFolder.Error())
+		return nil, "", config.Folder{}, false
+	}
+	return wfs, relativePath, folder, true
+}
+
+// SaveConflict is the details of a 409 answer to a save: the file as it is now, plus the content
+// the client tried to save, so the two can be merged
+type SaveConflict struct {
+	RawResponse
+	Attempted string `json:"attempted"`
+}
+
+// saveFile validates a write request for the file in the path parameter and replaces the file with
+// the body; requireMatch makes If-Match mandatory unless ?force=true. On failure it has already sent
+// the error response and returns false.
+func (h *FileHandler) saveFile(
+	c *gin.Context, requireMatch bool,
+) (filePath string, content []byte, modTime time.Time, ok bool) {
+	filePath, baseModTime, ok := h.saveTarget(c)
+	if !ok {
+		return
+	}
+	maxSize := maxWriteBody(h.cfg.MaxWriteBody)
+	content, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(c, CodeTooLarge, fmt.Sprintf("file larger than %d bytes", maxSize))
+			return "", nil, time.Time{}, false
+		}
+		writeError(c, CodeInvalidRequest, "failed to read body")
+		return "", nil, time.Time{}, false
+	}
+	content, modTime, ok = h.replaceFile(c, filePath, requireMatch, c.GetHeader("If-Match"), baseModTime,
+		func([]byte, config.Folder) ([]byte, bool) { return content, true })
+	return strings.TrimPrefix(filePath, "/"), content, modTime, ok
+}
+
+// saveTarget validates the path parameter and ?baseModTime= of a write to a markdown file. On
+// failure it has already sent the error response and returns false.
+func (h *FileHandler) saveTarget(c *gin.Context) (filePath string, baseModTime time.Time, ok bool) {
+	filePath = c.Param("path")
+	if strings.Contains(filePath, "..") {
+		writeError(c, CodePathTraversal, "invalid path")
+		return
+	}
+	if !h.cfg.IsMarkdownFile(filePath) {
+		writeError(c, CodeNotMarkdown, ErrNotMarkdown.Error())
+		return
+	}
+	if v := c.Query("baseModTime"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(c, CodeInvalidRequest, "baseModTime must be an RFC 3339 timestamp")
+			return
+		}
+		baseModTime = t
+	}
+	return filePath, baseModTime, true
+}
+
+// replaceFile replaces the markdown file at filePath with what edit makes of its current content,
+// refusing with 409 when ifMatch or baseModTime show the client read an older version;
+// requireMatch makes one of them mandatory unless ?force=true. On failure (edit's included) it has
+// already sent the error response and returns false.
+func (h *FileHandler) replaceFile(
+	c *gin.Context, filePath string, requireMatch bool, ifMatch string, baseModTime time.Time,
+	edit func(current []byte, folder config.Folder) ([]byte, bool),
+) (content []byte, modTime time.Time, ok bool) {
+	wfs, relativePath, folder, writable := h.resolveWritable(c, filePath)
+	if !writable {
+		return
+	}
+	force, _ := strconv.ParseBool(c.Query("force"))
+	if requireMatch && !force && ifMatch == "" && baseModTime.IsZero() {
+		writeError(c, CodeIfMatchRequired,
+			"send If-Match with the etag of the content you edited, or force=true to overwrite")
+		return
+	}
+
+	// Serialize writes so two clients holding the same ETag cannot both pass the check
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	info, err := wfs.Stat(relativePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(c, CodeNotFound, "file not found")
+			return
+		}
+		writeError(c, CodeInternal, fmt.Sprintf("failed to stat file: %v", err))
+		return
+	}
+	if info.IsDir {
+		writeError(c, CodeIsDirectory, ErrIsDirectory.Error())
+		return
+	}
+	current, err := wfs.ReadFile(relativePath)
+	if err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to read file: %v", err))
+		return
+	}
+	content, edited := edit(current, folder)
+	if !edited {
+		return
+	}
+
+	etagChanged := ifMatch != "" && !etagMatches(ifMatch, ETag(current))
+	modTimeChanged := !baseModTime.IsZero() && !baseModTime.Equal(info.ModTime)
+	if force {
+		log.Printf("Forced save of %s by %s (request %s)", filePath, ClientIP(c), RequestID(c))
+		recordAudit(h.audit, c, "file.force_save",
+			gin.H{"path": filePath, "etag": ETag(current)}, gin.H{"path": filePath, "etag": ETag(content)})
+	} else if etagChanged || modTimeChanged {
+		c.Header("ETag", ETag(current))
+		writeErrorDetails(c, CodeConflict, "file changed since it was read", SaveConflict{
+			RawResponse: rawResponse(filePath, current, info.ModTime),
+			Attempted:   string(content),
+		})
+		return
+	}
+
+	// Announce the write before making it, so the watcher event it causes finds the client to skip
+	for _, cb := range h.onSave {
+		cb(filepath.Join(folder.Path, filepath.FromSlash(relativePath)), c.GetHeader(ClientIDHeader))
+	}
+	if err := wfs.WriteFile(relativePath, content, mfs.WriteOptions{}); err != nil {
+		if os.IsPermission(err) {
+			writeError(c, CodeAccessDenied, "access denied")
+			return
+		}
+		writeError(c, CodeInternal, fmt.Sprintf("failed to write file: %v", err))
+		return
+	}
+	if info, err = wfs.Stat(relativePath); err != nil {
+		writeError(c, CodeInternal, fmt.Sprintf("failed to stat file: %v", err))
+		return
+	}
+	h.autoCommit(c, folder, "edit", relativePath)
+	recordWrite(h.audit, c, "file.edit", strings.TrimPrefix(filePath, "/"), len(content))
+	return content, info.ModTime, true
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// rawRoutes registers the routes of the raw write tests
+func rawRoutes(r *gin.Engine, h *FileHandler) {
+	r.GET("/raw/*path", h.GetRaw)
+	r.PUT("/raw/*path", h.PutRaw)
+}
+
+func putRaw(r http.Handler, target, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPutRawWithMatchingETag(t *testing.T) {
+	r, _, dir := newFileRouter(t, map[string]string{"guide.md": "# Guide\n"}, rawRoutes)
+	path := filepath.Join(dir, "guide.md")
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/raw/docs/guide.md", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected GET /raw to send an ETag")
+	}
+
+	w = putRaw(r, "/raw/docs/guide.md", etag, "# Guide\n\nFixed a typo.\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp RawResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ETag == etag || resp.ETag != w.Header().Get("ETag") || resp.Content != "# Guide\n\nFixed a typo.\n" {
+		t.Errorf("expected the new content and ETag, got %+v", resp)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != resp.Content {
+		t.Errorf("expected the file to be written, got %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o640 {
+		t.Errorf("expected the file mode to be kept, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected no leftover temp files, got %d entries", len(entries))
+	}
+}
+
+func TestPutRawConflicts(t *testing.T) {
+	r, _, dir := newFileRouter(t, map[string]string{"guide.md": "# Guide\n"}, rawRoutes)
+	path := filepath.Join(dir, "guide.md")
+	staleETag := ETag([]byte("# Guide\n"))
+	info, _ := os.Stat(path)
+	staleModTime := info.ModTime().Add(-time.Minute).Format(time.RFC3339Nano)
+
+	// Someone else saves first
+	if err := os.WriteFile(path, []byte("# Guide\n\nTheir edit.\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range []*httptest.ResponseRecorder{
+		putRaw(r, "/raw/docs/guide.md", staleETag, "# Guide\n\nMy edit.\n"),
+		putRaw(r, "/raw/docs/guide.md?baseModTime="+url.QueryEscape(staleModTime), "", "# Guide\n\nMy edit.\n"),
+	} {
+		if w.Code != http.StatusConflict {
+			t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Code    ErrorCode   `json:"code"`
+			Details RawResponse `json:"details"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != CodeConflict {
+			t.Errorf("expected code %q, got %q", CodeConflict, resp.Code)
+		}
+		if resp.Details.Content != "# Guide\n\nTheir edit.\n" || resp.Details.ETag != w.Header().Get("ETag") {
+			t.Errorf("expected the current content for merging, got %+v", resp.Details)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "# Guide\n\nTheir edit.\n" {
+		t.Errorf("expected the conflicting write to be refused, got %q", data)
+	}
+}
+
+func TestPutRawRejects(t *testing.T) {
+	r, _, _ := newFileRouter(t, map[string]string{"guide.md": "# Guide\n"}, rawRoutes)
+	tests := []struct {
+		name, target string
+		want         int
+	}{
+		{"not markdown", "/raw/docs/notes.txt", http.StatusBadRequest},
+		{"missing file", "/raw/docs/missing.md", http.StatusNotFound},
+		{"traversal", "/raw/docs/../secret.md", http.StatusForbidden},
+		{"bad baseModTime", "/raw/docs/guide.md?baseModTime=yesterday", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("x"))
+		req.URL, _ = url.Parse(tt.target)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.name, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestPutFileRendersAndNotifies(t *testing.T) {
+	docs := map[string]string{"guide.md": "# Guide\n", "locked.md": "# Locked\n"}
+	r, h, dir := newFileRouter(t, docs, func(r *gin.Engine, h *FileHandler) { r.PUT("/files/*path", h.PutFile) })
+	var saved []string
+	h.OnSave(func(path, clientID string) { saved = append(saved, path+" "+clientID) })
+
+	req := httptest.NewRequest(http.MethodPut, "/files/docs/guide.md", strings.NewReader("# Fixed\n\n- [x] done\n"))
+	req.Header.Set(ClientIDHeader, "tab1")
+	req.Header.Set("If-Match", ETag([]byte("# Guide\n")))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp FileResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Title != "Fixed" || resp.Path != "docs/guide.md" || !strings.Contains(resp.HTML, "checkbox") {
+		t.Errorf("expected the re-rendered file, got %+v", resp)
+	}
+	if w.Header().Get("ETag") != ETag([]byte("# Fixed\n\n- [x] done\n")) {
+		t.Errorf("unexpected ETag %q", w.Header().Get("ETag"))
+	}
+	if len(saved) != 1 || saved[0] != filepath.Join(dir, "guide.md")+" tab1" {
+		t.Errorf("unexpected save notifications %v", saved)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/files/frozen/locked.md", strings.NewReader("# Changed\n"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed || !strings.Contains(w.Body.String(), string(CodeFolderReadOnly)) {
+		t.Errorf("expected a folder without writable to refuse the write, got %d %s", w.Code, w.Body.String())
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD" {
+		t.Errorf("expected Allow: GET, HEAD, got %q", allow)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "locked.md")); string(data) != "# Locked\n" {
+		t.Errorf("folder without writable was written: %q", data)
+	}
+}
+
+func TestPutFileRequiresIfMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Guide\n")
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "docs", Path: dir, Alias: "docs", Writable: true}}
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.log")
+
+	gin.SetMode(gin.TestMode)
+	h := NewFileHandler(cfg)
+	r := gin.New()
+	r.GET("/files/*path", h.GetFile)
+	r.PUT("/files/*path", h.PutFile)
+	put := func(target, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, target, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/docs/guide.md", nil))
+	var file FileResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.ETag == "" || file.ETag != w.Header().Get("ETag") || file.ETag != ETag([]byte("# Guide\n")) {
+		t.Fatalf("expected GetFile to return the content hash, got %q (header %q)", file.ETag, w.Header().Get("ETag"))
+	}
+
+	if w := put("/files/docs/guide.md", "", "# Mine\n"); w.Code != http.StatusPreconditionRequired ||
+		!strings.Contains(w.Body.String(), string(CodeIfMatchRequired)) {
+		t.Errorf("expected 428 without If-Match, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Someone else saves; the stale write gets both versions back
+	writeDoc(t, filepath.Join(dir, "guide.md"), "# Theirs\n")
+	w = put("/files/docs/guide.md", file.ETag, "# Mine\n")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	var conflict struct {
+		Details SaveConflict `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &conflict); err != nil {
+		t.Fatal(err)
+	}
+	if conflict.Details.Content != "# Theirs\n" || conflict.Details.ETag != ETag([]byte("# Theirs\n")) ||
+		conflict.Details.Attempted != "# Mine\n" {
+		t.Errorf("expected the current and attempted content, got %+v", conflict.Details)
+	}
+
+	if w := put("/files/docs/guide.md?force=true", file.ETag, "# Mine\n"); w.Code != http.StatusOK {
+		t.Fatalf("expected force to overwrite, got %d: %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "guide.md")); string(data) != "# Mine\n" {
+		t.Errorf("expected the forced content, got %q", data)
+	}
+	if data, _ := os.ReadFile(cfg.AuditLog); !strings.Contains(string(data), "file.force_save") {
+		t.Errorf("expected the forced save audited, got %q", data)
+	}
+}
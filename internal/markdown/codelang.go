@@ -0,0 +1,85 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Values of Options.CodeLanguage besides a Chroma language name
+const (
+	// CodeLanguagePlaintext leaves code fences without a language unhighlighted
+	CodeLanguagePlaintext = "plaintext"
+	// CodeLanguageAuto lets Chroma guess the language of code fences without one
+	CodeLanguageAuto = "auto"
+)
+
+// ValidateCodeLanguage checks a code block language setting: empty, CodeLanguagePlaintext,
+// CodeLanguageAuto or a language name or alias Chroma knows
+func ValidateCodeLanguage(lang string) error {
+	switch lang {
+	case "", CodeLanguagePlaintext, CodeLanguageAuto:
+		return nil
+	}
+	if lexers.Get(lang) == nil {
+		return fmt.Errorf("unknown code language %q (expected %q, %q or a language Chroma knows)",
+			lang, CodeLanguagePlaintext, CodeLanguageAuto)
+	}
+	return nil
+}
+
+// assignCodeLanguages gives code fences without a language the parser's default or guessed
+// language. The highlighter reads a fence's language from its info string, which must be a
+// segment of the rendered source, so the names are appended to a copy of source and the
+// returned slice must be rendered instead of source.
+func (p *Parser) assignCodeLanguages(doc ast.Node, source []byte) []byte {
+	if p.codeLanguage == "" || p.codeLanguage == CodeLanguagePlaintext {
+		return source
+	}
+	var bare []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok && entering && fenced.Info == nil {
+			bare = append(bare, fenced)
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(bare) == 0 {
+		return source
+	}
+
+	// A fresh copy, so appending never writes into the caller's buffer
+	out := append(make([]byte, 0, len(source)+len(bare)*16), source...)
+	for _, fenced := range bare {
+		lang := p.codeLanguage
+		if lang == CodeLanguageAuto {
+			if lang = guessLanguage(fenced, source); lang == "" {
+				continue
+			}
+		}
+		start := len(out)
+		out = append(out, lang...)
+		fenced.Info = ast.NewTextSegment(text.NewSegment(start, len(out)))
+	}
+	return out
+}
+
+// guessLanguage returns the name of the language Chroma's analysers rate most likely for the
+// block's content, or "" when none recognises it
+func guessLanguage(fenced *ast.FencedCodeBlock, source []byte) string {
+	var code strings.Builder
+	for i := 0; i < fenced.Lines().Len(); i++ {
+		line := fenced.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+	lexer := lexers.Analyse(code.String())
+	if lexer == nil {
+		return ""
+	}
+	if aliases := lexer.Config().Aliases; len(aliases) > 0 {
+		return aliases[0]
+	}
+	return strings.ToLower(lexer.Config().Name)
+}
@@ -0,0 +1,71 @@
+package markdown
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// DiagramFunc draws the content of a special fence as an SVG document
+type DiagramFunc func(source []byte) (svg []byte, err error)
+
+// newDiagramMarker returns the random part of a parser's diagram placeholders, so that a document
+// cannot spell out one of them
+func newDiagramMarker() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "markhub-diagram-" + hex.EncodeToString(b)
+}
+
+// diagramPlaceholder is the text standing for the n-th drawing of a document until it is inlined
+func diagramPlaceholder(marker string, n int) string {
+	return "[[" + marker + ":" + strconv.Itoa(n) + "]]"
+}
+
+// drawDiagrams draws the special fences of doc that have a DiagramFunc, numbering them for the
+// fenceRenderer, and returns the drawings wrapped in the <div> of their fence, in order, with a
+// warning for each fence that could not be drawn. Those are rendered as any other special fence.
+func (p *Parser) drawDiagrams(doc ast.Node, source []byte) (drawings, warnings []string) {
+	if len(p.diagrams) == 0 {
+		return nil, nil
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		fence, ok := n.(*specialFence)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		draw := p.diagrams[fence.lang]
+		if draw == nil {
+			return ast.WalkSkipChildren, nil
+		}
+		svg, err := draw(fence.Lines().Value(source))
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("line %d: %s diagram not drawn: %v", fence.line, fence.lang, err))
+			return ast.WalkSkipChildren, nil
+		}
+		// data-processed keeps the frontend's mermaid from drawing the drawing again
+		drawings = append(drawings, `<div class="`+html.EscapeString(fence.class)+` diagram" data-processed="true">`+
+			strings.TrimSpace(string(svg))+"</div>")
+		fence.diagram = len(drawings)
+		return ast.WalkSkipChildren, nil
+	})
+	return drawings, warnings
+}
+
+// inlineDiagrams replaces the placeholders of drawings in out. Drawings are inlined as the
+// commands made them, so only parsers that render HTML unsafe have any (see Options.Diagrams).
+func (p *Parser) inlineDiagrams(out string, drawings []string) string {
+	if len(drawings) == 0 {
+		return out
+	}
+	pairs := make([]string, 0, 2*len(drawings))
+	for i, drawing := range drawings {
+		pairs = append(pairs, diagramPlaceholder(p.diagramMarker, i+1), drawing)
+	}
+	return strings.NewReplacer(pairs...).Replace(out)
+}
@@ -0,0 +1,80 @@
+package markdown
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDiagrams(t *testing.T) {
+	source := []byte("```mermaid\ngraph TD\n```\n\n- ```math\n  x^2\n  ```\n\n```mermaid\nfail\n```\n")
+	var drawn []string
+	draw := func(source []byte) ([]byte, error) {
+		drawn = append(drawn, string(source))
+		if strings.HasPrefix(string(source), "fail") {
+			return nil, errors.New("syntax error")
+		}
+		return []byte(`<svg><style>.a{}</style><text>` + strings.TrimSpace(string(source)) + "</text></svg>\n"), nil
+	}
+	p := New(Options{
+		HTMLMode: HTMLUnsafe,
+		Fences:   DefaultFences(),
+		Diagrams: map[string]DiagramFunc{FenceMermaid: draw, FenceMath: draw},
+	})
+
+	result, err := p.Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A fence that fails to draw is left to the frontend
+	for _, want := range []string{
+		`<div class="mermaid diagram" data-processed="true"><svg><style>.a{}</style><text>graph TD</text></svg></div>`,
+		"<li>\n" + `<div class="math diagram" data-processed="true"><svg><style>.a{}</style><text>x^2</text></svg></div>`,
+		`<div class="mermaid"><pre>fail` + "\n</pre></div>",
+	} {
+		if !strings.Contains(result.HTML, want) {
+			t.Errorf("expected %q in %s", want, result.HTML)
+		}
+	}
+	if len(drawn) != 3 || drawn[1] != "x^2\n" {
+		t.Errorf("unexpected fences drawn %q", drawn)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0] != "line 9: mermaid diagram not drawn: syntax error" {
+		t.Errorf("unexpected warnings %v", result.Warnings)
+	}
+
+	// A document cannot spell out a placeholder of another parser
+	other := New(Options{Diagrams: map[string]DiagramFunc{FenceMermaid: draw}})
+	spelled := []byte(diagramPlaceholder(other.diagramMarker, 1) + "\n\n```mermaid\ngraph TD\n```\n")
+	if result, _ := p.Parse(spelled); strings.Count(result.HTML, "<svg>") != 1 {
+		t.Errorf("expected one drawing in %s", result.HTML)
+	}
+}
+
+func TestDiagramsUntrustedHTML(t *testing.T) {
+	source := []byte("```mermaid\ngraph TD\n```\n\n```math\nx^2\n```\n")
+	drawn := 0
+	draw := func(source []byte) ([]byte, error) {
+		drawn++
+		// What a command may make of fence text: mermaid keeps labels' HTML, for one
+		return []byte(`<svg onload="alert(1)"><script>alert(2)</script></svg>`), nil
+	}
+	for _, mode := range []HTMLMode{HTMLSanitize, HTMLStrip} {
+		p := New(Options{
+			HTMLMode: mode,
+			Fences:   DefaultFences(),
+			Diagrams: map[string]DiagramFunc{FenceMermaid: draw, FenceMath: draw},
+		})
+		result, err := p.Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if drawn != 0 || strings.Contains(result.HTML, "<script") || strings.Contains(result.HTML, "onload") {
+			t.Errorf("%s: expected no drawing, got %s", mode, result.HTML)
+		}
+		if !strings.Contains(result.HTML, `<div class="mermaid"><pre>graph TD`) ||
+			!strings.Contains(result.HTML, `<code class="language-math">x^2`) {
+			t.Errorf("%s: expected the fences left to the frontend in %s", mode, result.HTML)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package markdown
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// The GitHub Flavored Markdown extensions, each enabled unless named in Options.DisabledExtensions
+const (
+	// ExtensionAutolinks turns bare URLs, www. addresses and email addresses into links
+	ExtensionAutolinks = "autolinks"
+	ExtensionTables    = "tables"
+	// ExtensionStrikethrough renders ~~text~~ struck through
+	ExtensionStrikethrough = "strikethrough"
+	ExtensionTaskLists     = "task_lists"
+)
+
+// gfmExtensions are the goldmark extenders of the GFM extensions, in registration order
+var gfmExtensions = []struct {
+	name     string
+	extender goldmark.Extender
+}{
+	{ExtensionAutolinks, extension.Linkify},
+	{ExtensionTables, extension.Table},
+	{ExtensionStrikethrough, extension.Strikethrough},
+	{ExtensionTaskLists, extension.TaskList},
+}
+
+// ValidateExtensions checks that names only holds GFM extension names
+func ValidateExtensions(names []string) error {
+	known := make([]string, len(gfmExtensions))
+	for i, ext := range gfmExtensions {
+		known[i] = ext.name
+	}
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown markdown extension %q (expected one of %s)", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// extenders returns the goldmark extenders of the GFM extensions not in disabled, then the
+// typographer and highlighting every parser uses
+func extenders(disabled []string, highlight goldmark.Extender) []goldmark.Extender {
+	var out []goldmark.Extender
+	for _, ext := range gfmExtensions {
+		if !slices.Contains(disabled, ext.name) {
+			out = append(out, ext.extender)
+		}
+	}
+	return append(out, extension.Typographer, highlight)
+}
@@ -0,0 +1,56 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtensions(t *testing.T) {
+	source := []byte("See https://example.com and www.example.org.\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\n\n~~old~~\n\n- [x] done\n")
+	for _, tt := range []struct {
+		extension string
+		marker    string
+	}{
+		{ExtensionAutolinks, `<a href="https://example.com">https://example.com</a>`},
+		{ExtensionTables, "<table>"},
+		{ExtensionStrikethrough, "<del>old</del>"},
+		{ExtensionTaskLists, `type="checkbox"`},
+	} {
+		enabled, err := New(Options{}).Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(enabled.HTML, tt.marker) {
+			t.Errorf("%s: expected %q by default in %s", tt.extension, tt.marker, enabled.HTML)
+		}
+		disabled, err := New(Options{DisabledExtensions: []string{tt.extension}}).Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(disabled.HTML, tt.marker) {
+			t.Errorf("%s: expected no %q when disabled in %s", tt.extension, tt.marker, disabled.HTML)
+		}
+	}
+
+	// Only the autolinks extension links bare URLs; explicit links are always links
+	result, err := New(Options{DisabledExtensions: []string{ExtensionAutolinks}}).Parse(
+		[]byte("Bare https://example.com, <https://example.org> and [link](https://example.net)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(result.HTML, `href="https://example.com"`) ||
+		!strings.Contains(result.HTML, `href="https://example.org"`) ||
+		!strings.Contains(result.HTML, `href="https://example.net"`) {
+		t.Errorf("expected only the explicit links to be links, got %s", result.HTML)
+	}
+}
+
+func TestValidateExtensions(t *testing.T) {
+	if err := ValidateExtensions([]string{ExtensionAutolinks, ExtensionTaskLists}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := ValidateExtensions([]string{"footnotes"}); err == nil || !strings.Contains(err.Error(), "task_lists") {
+		t.Errorf("expected an error listing the extensions, got %v", err)
+	}
+}
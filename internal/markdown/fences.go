@@ -0,0 +1,113 @@
+package markdown
+
+import (
+	"html"
+
+	"github.com/yuin/goldmark/ast"
+	gmparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Languages of the special fences the frontend knows how to show, see DefaultFences
+const (
+	// FenceOutput marks the output of the code cell above it, as in notebook exports
+	FenceOutput = "output"
+	// FenceMermaid holds a diagram the frontend draws with mermaid
+	FenceMermaid = "mermaid"
+	// FenceMath holds TeX math, which the frontend does not draw: it is only a special fence when
+	// Options.Diagrams draws it on the server
+	FenceMath = "math"
+)
+
+// DefaultFences returns a new Options.Fences registry of the special fences the frontend knows
+func DefaultFences() map[string]string {
+	return map[string]string{
+		FenceOutput:  "cell-output",
+		FenceMermaid: "mermaid",
+	}
+}
+
+// kindSpecialFence is the node kind of specialFence
+var kindSpecialFence = ast.NewNodeKind("SpecialFence")
+
+// specialFence is a fenced code block whose language is in Options.Fences. It is rendered as is,
+// not highlighted, in a <div> of the fence's class, unless it was drawn (see Parser.drawDiagrams).
+type specialFence struct {
+	ast.BaseBlock
+	lang  string
+	class string
+	line  int // of the opening fence
+	// diagram is the 1-based number of the fence's drawing in its document, 0 when not drawn
+	diagram int
+}
+
+// Kind implements ast.Node
+func (n *specialFence) Kind() ast.NodeKind {
+	return kindSpecialFence
+}
+
+// IsRaw implements ast.Node
+func (n *specialFence) IsRaw() bool {
+	return true
+}
+
+// Dump implements ast.Node
+func (n *specialFence) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Class": n.class}, nil)
+}
+
+// fenceTransformer replaces the fenced code blocks of the languages in classes with specialFences
+type fenceTransformer struct {
+	classes map[string]string
+}
+
+// Transform implements parser.ASTTransformer
+func (t *fenceTransformer) Transform(doc *ast.Document, reader text.Reader, _ gmparser.Context) {
+	source := reader.Source()
+	var fences []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			if _, special := t.classes[string(fenced.Language(source))]; special {
+				fences = append(fences, fenced)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, fenced := range fences {
+		lang := string(fenced.Language(source))
+		node := &specialFence{lang: lang, class: t.classes[lang], line: lineOf(fenced, source)}
+		node.SetLines(fenced.Lines())
+		fenced.Parent().ReplaceChild(fenced.Parent(), fenced, node)
+	}
+}
+
+// fenceRenderer renders specialFences. A drawn fence is rendered as its diagramPlaceholder, for
+// Parser.inlineDiagrams to replace once the document is sanitized.
+type fenceRenderer struct {
+	marker string
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *fenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSpecialFence, r.render)
+}
+
+func (r *fenceRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	fence := n.(*specialFence)
+	if fence.diagram > 0 {
+		_, _ = w.WriteString(diagramPlaceholder(r.marker, fence.diagram) + "\n")
+		return ast.WalkSkipChildren, nil
+	}
+	_, _ = w.WriteString(`<div class="` + html.EscapeString(fence.class) + `"><pre>`)
+	for i := 0; i < fence.Lines().Len(); i++ {
+		line := fence.Lines().At(i)
+		_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+	}
+	_, _ = w.WriteString("</pre></div>\n")
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,36 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpecialFences(t *testing.T) {
+	source := []byte("```python\nprint(1 < 2)\n```\n\n```output\nTrue <b>\n```\n\n> ```mermaid\n> graph TD\n> ```\n")
+
+	result, err := New(Options{HTMLMode: HTMLSanitize, Fences: DefaultFences()}).Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<div class="cell-output"><pre>True &lt;b&gt;` + "\n</pre></div>",
+		`<div class="mermaid"><pre>graph TD` + "\n</pre></div>",
+		`class="chroma"`,
+	} {
+		if !strings.Contains(result.HTML, want) {
+			t.Errorf("expected %q in %s", want, result.HTML)
+		}
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", result.Warnings)
+	}
+
+	// Without a registry they stay code blocks
+	result, err = NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(result.HTML, "cell-output") || !strings.Contains(result.HTML, `class="language-output"`) {
+		t.Errorf("expected a plain output code block in %s", result.HTML)
+	}
+}
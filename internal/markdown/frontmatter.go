@@ -0,0 +1,309 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidFrontMatter is returned for a front matter block that is not a YAML or TOML mapping
+var ErrInvalidFrontMatter = errors.New("front matter is not a mapping")
+
+// Front matter formats, told apart by the delimiter of the block
+const (
+	FrontMatterYAML = "yaml" // between "---" lines; "..." may also close the block
+	FrontMatterTOML = "toml" // between "+++" lines, as Hugo writes it
+)
+
+// SplitFrontMatter splits source into its leading front matter block, YAML or TOML, and the
+// document after the block. ok is false when source has no front matter, body is then source
+// itself.
+func SplitFrontMatter(source []byte) (front, body []byte, ok bool) {
+	front, body, format := splitFrontMatter(source)
+	return front, body, format != ""
+}
+
+// FrontMatterFormat returns FrontMatterYAML or FrontMatterTOML for the format of source's leading
+// front matter block, or "" when it has none
+func FrontMatterFormat(source []byte) string {
+	_, _, format := splitFrontMatter(source)
+	return format
+}
+
+func splitFrontMatter(source []byte) (front, body []byte, format string) {
+	line, rest, found := bytes.Cut(source, []byte("\n"))
+	if !found {
+		return nil, source, ""
+	}
+	switch string(bytes.TrimRight(line, " \t\r")) {
+	case "---":
+		format = FrontMatterYAML
+	case "+++":
+		format = FrontMatterTOML
+	default:
+		return nil, source, ""
+	}
+	start := len(source) - len(rest)
+	for offset := start; offset < len(source); {
+		line, _, _ := bytes.Cut(source[offset:], []byte("\n"))
+		end := min(offset+len(line)+1, len(source))
+		if closesFrontMatter(line, format) {
+			return source[start:offset], source[end:], format
+		}
+		offset = end
+	}
+	return nil, source, ""
+}
+
+// closesFrontMatter reports whether line ends a front matter block in format
+func closesFrontMatter(line []byte, format string) bool {
+	switch string(bytes.TrimRight(line, " \t\r")) {
+	case "---", "...":
+		return format == FrontMatterYAML
+	case "+++":
+		return format == FrontMatterTOML
+	}
+	return false
+}
+
+// ParseFrontMatter decodes the leading front matter block of source, parsing it as YAML or TOML
+// by its delimiter, and returns it with the document after the block. A document without front
+// matter has a nil map.
+func ParseFrontMatter(source []byte) (map[string]any, []byte, error) {
+	front, body, format := splitFrontMatter(bytes.TrimPrefix(source, utf8BOM))
+	if format == "" {
+		return nil, body, nil
+	}
+	values := map[string]any{}
+	var err error
+	if format == FrontMatterTOML {
+		err = toml.Unmarshal(front, &values)
+	} else {
+		var doc yaml.Node
+		if err = yaml.Unmarshal(front, &doc); err == nil && len(doc.Content) > 0 {
+			if doc.Content[0].Kind != yaml.MappingNode {
+				return nil, body, ErrInvalidFrontMatter
+			}
+			err = doc.Content[0].Decode(&values)
+		}
+	}
+	if err != nil {
+		return nil, body, fmt.Errorf("%w: %v", ErrInvalidFrontMatter, err)
+	}
+	return values, body, nil
+}
+
+// UpdateFrontMatter sets the top-level front matter keys in changes, removing those whose value is
+// nil, and returns the updated document with its front matter decoded. Existing keys keep their
+// place and new ones are appended in sorted order; comments survive as far as yaml.v3 keeps them.
+// A document without front matter gets a YAML block, and a block left empty is dropped. TOML
+// front matter is written back with its keys sorted, and without its comments.
+func UpdateFrontMatter(source []byte, changes map[string]any) ([]byte, map[string]any, error) {
+	// A BOM stays in front of the block, where the editor that wrote it expects it
+	bom := bytes.HasPrefix(source, utf8BOM)
+	front, body, format := splitFrontMatter(bytes.TrimPrefix(source, utf8BOM))
+	if format == FrontMatterTOML {
+		return updateTOMLFrontMatter(bom, front, body, changes)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(front, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFrontMatter, err)
+	}
+	var mapping *yaml.Node
+	switch {
+	case len(doc.Content) == 0:
+		// Missing, blank or comment-only front matter
+		mapping = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{mapping}
+	case len(doc.Content) == 1 && doc.Content[0].Kind == yaml.MappingNode:
+		mapping = doc.Content[0]
+	default:
+		return nil, nil, ErrInvalidFrontMatter
+	}
+
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := setFrontMatterKey(mapping, key, changes[key]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	values := map[string]any{}
+	if err := mapping.Decode(&values); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFrontMatter, err)
+	}
+	var out bytes.Buffer
+	if bom {
+		out.Write(utf8BOM)
+	}
+	if len(mapping.Content) > 0 {
+		out.WriteString("---\n")
+		enc := yaml.NewEncoder(&out)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, nil, err
+		}
+		out.WriteString("---\n")
+	}
+	out.Write(body)
+	return out.Bytes(), values, nil
+}
+
+// setFrontMatterKey sets key to value in mapping, or removes it when value is nil
+func setFrontMatterKey(mapping *yaml.Node, key string, value any) error {
+	i := 0
+	for ; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			break
+		}
+	}
+	if value == nil {
+		if i < len(mapping.Content) {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+		}
+		return nil
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("front matter key %q: %w", key, err)
+	}
+	if i == len(mapping.Content) {
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, node)
+		return nil
+	}
+	// The comment after a scalar belongs to its value node
+	old := mapping.Content[i+1]
+	node.LineComment = old.LineComment
+	mapping.Content[i+1] = node
+	return nil
+}
+
+// updateTOMLFrontMatter is UpdateFrontMatter for the TOML block front of a document
+func updateTOMLFrontMatter(bom bool, front, body []byte, changes map[string]any) ([]byte, map[string]any, error) {
+	values := map[string]any{}
+	if err := toml.Unmarshal(front, &values); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFrontMatter, err)
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(values, key)
+		} else {
+			values[key] = tomlValue(value)
+		}
+	}
+
+	var out bytes.Buffer
+	if bom {
+		out.Write(utf8BOM)
+	}
+	if len(values) > 0 {
+		encoded, err := toml.Marshal(values)
+		if err != nil {
+			return nil, nil, err
+		}
+		out.WriteString("+++\n")
+		out.Write(encoded)
+		out.WriteString("+++\n")
+	}
+	out.Write(body)
+	return out.Bytes(), values, nil
+}
+
+// tomlValue converts the whole numbers of a value decoded from JSON, which are all float64, to
+// integers, so that TOML does not write them as floats
+func tomlValue(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	case []any:
+		converted := make([]any, len(v))
+		for i, item := range v {
+			converted[i] = tomlValue(item)
+		}
+		return converted
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, item := range v {
+			converted[key] = tomlValue(item)
+		}
+		return converted
+	}
+	return value
+}
+
+// Tags returns the tags listed under the "tags" key of source's front matter, as a list or a
+// comma-separated string: trimmed, lowercased, without a leading "#", sorted and deduplicated.
+// Documents without front matter, or with front matter that does not parse, have no tags.
+func Tags(source []byte) []string {
+	tags, _ := LabeledTags(source)
+	return tags
+}
+
+// LabeledTags returns the tags of source like Tags, along with each tag as the document first
+// writes it (trimmed and without a leading "#", but in its own casing) for display.
+func LabeledTags(source []byte) (tags, labels []string) {
+	meta, _, err := ParseFrontMatter(source)
+	if err != nil {
+		return nil, nil
+	}
+	var raw []string
+	switch v := meta["tags"].(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []any:
+		for _, item := range v {
+			// Numbers and booleans are tags too, as written
+			if item != nil {
+				raw = append(raw, fmt.Sprint(item))
+			}
+		}
+	}
+	tags = NormalizeTags(raw)
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	labels = make([]string, len(tags))
+	for _, label := range raw {
+		label = strings.TrimPrefix(strings.TrimSpace(label), "#")
+		if i, found := slices.BinarySearch(tags, strings.ToLower(label)); found && labels[i] == "" {
+			labels[i] = label
+		}
+	}
+	return tags, labels
+}
+
+// NormalizeTags trims, lowercases and deduplicates tags, dropping a leading "#" and empty ones,
+// and returns them sorted
+func NormalizeTags(raw []string) []string {
+	seen := make(map[string]bool, len(raw))
+	var tags []string
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
@@ -0,0 +1,161 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		changes map[string]any
+		want    string
+	}{
+		{
+			"keeps order, comments and the body",
+			"---\ntitle: Old # shown in the header\ndraft: true\n# owners\nauthors:\n  - ann\n---\n# Body\n---\n",
+			map[string]any{"title": "New", "draft": nil, "tags": []any{"a", "b"}},
+			"---\ntitle: New # shown in the header\n# owners\nauthors:\n  - ann\ntags:\n  - a\n  - b\n---\n# Body\n---\n",
+		},
+		{
+			"adds a block",
+			"# Body\n",
+			map[string]any{"meta": map[string]any{"count": float64(3), "ok": true}},
+			"---\nmeta:\n  count: 3\n  ok: true\n---\n# Body\n",
+		},
+		{
+			"drops an emptied block",
+			"---\ntitle: Old\n...\n# Body\n",
+			map[string]any{"title": nil},
+			"# Body\n",
+		},
+		{
+			"keeps a BOM in front",
+			"\xef\xbb\xbf---\r\ntitle: Old\r\n---\r\nBody\r\n",
+			map[string]any{"title": "New"},
+			"\xef\xbb\xbf---\ntitle: New\n---\nBody\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := UpdateFrontMatter([]byte(tt.source), tt.changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateFrontMatterValues(t *testing.T) {
+	_, values, err := UpdateFrontMatter([]byte("---\ntitle: Guide\n---\n"), map[string]any{
+		"tags":   []any{"go"},
+		"nested": map[string]any{"level": float64(2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"title": "Guide", "tags": []any{"go"}, "nested": map[string]any{"level": 2}}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %#v, want %#v", values, want)
+	}
+}
+
+func TestUpdateFrontMatterRejectsNonMapping(t *testing.T) {
+	for _, source := range []string{"---\n- a\n- b\n---\n", "---\ntitle: [unclosed\n---\n"} {
+		_, _, err := UpdateFrontMatter([]byte(source), map[string]any{"title": "x"})
+		if !errors.Is(err, ErrInvalidFrontMatter) {
+			t.Errorf("%q: err = %v, want ErrInvalidFrontMatter", source, err)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	for source, want := range map[string][]string{
+		"---\ntags: [Meeting, project-x, meeting]\n---\n# Notes\n": {"meeting", "project-x"},
+		"---\ntags: \"#Ideas, later ,\"\n---\n":                    {"ideas", "later"},
+		"---\ntags:\n  - 2026\n  - draft\n---\n":                   {"2026", "draft"},
+		"---\ntitle: x\n---\n":                                     nil,
+		"---\ntags: [unclosed\n---\n":                              nil,
+		"# tags: [a]\n":                                            nil,
+		"+++\ntags = [\"Hugo\", \"TOML\"]\n+++\n":                  {"hugo", "toml"},
+		"+++\ntags = \"a, b\"\n+++\n":                              {"a", "b"},
+	} {
+		if got := Tags([]byte(source)); !reflect.DeepEqual(got, want) {
+			t.Errorf("Tags(%q) = %v, want %v", source, got, want)
+		}
+	}
+}
+
+func TestLabeledTags(t *testing.T) {
+	tags, labels := LabeledTags([]byte("---\ntags: [\"#DevOps\", Meeting, meeting, 2026]\n---\n"))
+	if !reflect.DeepEqual(tags, []string{"2026", "devops", "meeting"}) ||
+		!reflect.DeepEqual(labels, []string{"2026", "DevOps", "Meeting"}) {
+		t.Errorf("LabeledTags = %v, %v", tags, labels)
+	}
+	if tags, labels = LabeledTags([]byte("# No front matter\n")); tags != nil || labels != nil {
+		t.Errorf("expected no tags, got %v, %v", tags, labels)
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		source string
+		format string
+		want   map[string]any
+		body   string
+	}{
+		{"---\ntitle: Guide\ndraft: true\n---\n# Body\n", FrontMatterYAML,
+			map[string]any{"title": "Guide", "draft": true}, "# Body\n"},
+		{"+++\ntitle = \"Guide\"\nweight = 2\ntags = [\"a\", \"b\"]\n+++\n# Body\n", FrontMatterTOML,
+			map[string]any{"title": "Guide", "weight": int64(2), "tags": []any{"a", "b"}}, "# Body\n"},
+		{"\xef\xbb\xbf+++\r\ntitle = \"BOM\"\r\n+++\r\nBody\n", FrontMatterTOML, map[string]any{"title": "BOM"}, "Body\n"},
+		// A delimiter of the other format does not close the block
+		{"+++\ntitle = \"x\"\n---\n", "", nil, "+++\ntitle = \"x\"\n---\n"},
+		{"# Body\n", "", nil, "# Body\n"},
+	}
+	for _, tt := range tests {
+		if format := FrontMatterFormat(bytes.TrimPrefix([]byte(tt.source), utf8BOM)); format != tt.format {
+			t.Errorf("FrontMatterFormat(%q) = %q, want %q", tt.source, format, tt.format)
+		}
+		got, body, err := ParseFrontMatter([]byte(tt.source))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.source, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) || string(body) != tt.body {
+			t.Errorf("ParseFrontMatter(%q) = %#v, %q, want %#v, %q", tt.source, got, body, tt.want, tt.body)
+		}
+	}
+
+	for _, source := range []string{"+++\ntitle = \n+++\n", "---\n- a\n---\n"} {
+		if _, _, err := ParseFrontMatter([]byte(source)); !errors.Is(err, ErrInvalidFrontMatter) {
+			t.Errorf("%q: err = %v, want ErrInvalidFrontMatter", source, err)
+		}
+	}
+}
+
+func TestUpdateTOMLFrontMatter(t *testing.T) {
+	source := "+++\ntitle = \"Old\"\ndraft = true\n+++\n# Body\n"
+	got, values, err := UpdateFrontMatter([]byte(source), map[string]any{
+		"title": "New", "draft": nil, "weight": float64(3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "+++\ntitle = 'New'\nweight = 3\n+++\n# Body\n"; string(got) != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+	if want := map[string]any{"title": "New", "weight": int64(3)}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %#v, want %#v", values, want)
+	}
+
+	got, _, err = UpdateFrontMatter([]byte("+++\ntitle = \"Old\"\n+++\nBody\n"), map[string]any{"title": nil})
+	if err != nil || string(got) != "Body\n" {
+		t.Errorf("expected the emptied block to be dropped, got %q, %v", got, err)
+	}
+}
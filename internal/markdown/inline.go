@@ -0,0 +1,72 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// inlineImages replaces the destination of every relative image in doc with the data URI inline
+// returns for it and reports the images it failed on. Links were extracted before, so they keep
+// listing the original destinations.
+func inlineImages(doc ast.Node, source []byte, inline func(string) (string, error)) []string {
+	var warnings []string
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		target, ok := RelativeTarget(string(img.Destination))
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		uri, err := inline(target)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("line %d: image %q not inlined: %v",
+				lineOf(img, source), img.Destination, err))
+			return ast.WalkContinue, nil
+		}
+		if uri != "" {
+			img.Destination = []byte(uri)
+		}
+		return ast.WalkContinue, nil
+	})
+	return warnings
+}
+
+// rewriteExternalImages applies rewrite to every image in doc loading from another host, replacing
+// the images it rejects with their alt text
+func rewriteExternalImages(doc ast.Node, rewrite func(string) (string, bool)) {
+	var dropped []*ast.Image
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if !entering || !ok || !isExternalURL(string(img.Destination)) {
+			return ast.WalkContinue, nil
+		}
+		if dest, keep := rewrite(string(img.Destination)); keep {
+			img.Destination = []byte(dest)
+		} else {
+			dropped = append(dropped, img)
+		}
+		return ast.WalkContinue, nil
+	})
+	// Mutating the tree during the walk would skip nodes
+	for _, img := range dropped {
+		parent := img.Parent()
+		for child := img.FirstChild(); child != nil; child = img.FirstChild() {
+			img.RemoveChild(img, child)
+			parent.InsertBefore(parent, img, child)
+		}
+		parent.RemoveChild(parent, img)
+	}
+}
+
+// isExternalURL reports whether dest is an absolute http(s) or protocol-relative URL
+func isExternalURL(dest string) bool {
+	if strings.HasPrefix(dest, "//") {
+		return true
+	}
+	scheme, _, ok := strings.Cut(dest, ":")
+	return ok && (strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https"))
+}
@@ -0,0 +1,48 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/text"
+)
+
+// wikiLinkRe matches [[Target]], [[Target#Heading]], [[Target|label]] and the ![[Target]] embeds;
+// group 1 is the target
+var wikiLinkRe = regexp.MustCompile(`!?\[\[([^\[\]|#\n]+)(?:#[^\[\]|\n]*)?(?:\|[^\[\]\n]*)?\]\]`)
+
+// WikiLink is a [[wikilink]] of a document. Target names the note linked to as written, without
+// the heading or label.
+type WikiLink struct {
+	Target string `json:"target"`
+	Line   int    `json:"line"`
+}
+
+// Links returns the links and images of source, as ParseResult.Links lists them, and its
+// [[wikilinks]], without rendering it. Wikilinks in code and raw HTML are left out. Lines count
+// from the top of the file, front matter included.
+func Links(source []byte) ([]Link, []WikiLink) {
+	source = bytes.TrimPrefix(source, utf8BOM)
+	_, body, _ := SplitFrontMatter(source)
+	offset := bytes.Count(source[:len(source)-len(body)], []byte("\n"))
+	doc := codeParser.Parser().Parse(text.NewReader(body))
+
+	links := extractLinks(doc, body)
+	for i := range links {
+		links[i].Line += offset
+	}
+	var wiki []WikiLink
+	skip := codeRangesIn(doc)
+	for _, m := range wikiLinkRe.FindAllSubmatchIndex(body, -1) {
+		if inRanges(skip, m[0]) {
+			continue
+		}
+		target := strings.TrimSpace(string(body[m[2]:m[3]]))
+		if target == "" {
+			continue
+		}
+		wiki = append(wiki, WikiLink{Target: target, Line: bytes.Count(body[:m[0]], []byte("\n")) + 1 + offset})
+	}
+	return links, wiki
+}
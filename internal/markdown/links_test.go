@@ -0,0 +1,26 @@
+package markdown
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLinks(t *testing.T) {
+	source := "---\ntitle: Notes\n---\n" +
+		"See [setup](setup.md) and ![logo](logo.png).\n" + // 4
+		"Related: [[Daily Notes]], [[guide/intro#Usage|the intro]] and ![[diagram]].\n" + // 5
+		"`[[not a link]]`\n\n" + // 6
+		"```\n[[nor this]]\n```\n" + // 8-10
+		"<https://example.com> [[ ]]\n" // 11
+
+	links, wiki := Links([]byte(source))
+	wantLinks := []Link{{Dest: "setup.md", Line: 4}, {Dest: "logo.png", Image: true, Line: 4},
+		{Dest: "https://example.com", Line: 11}}
+	if !slices.Equal(links, wantLinks) {
+		t.Errorf("expected links %v, got %v", wantLinks, links)
+	}
+	wantWiki := []WikiLink{{"Daily Notes", 5}, {"guide/intro", 5}, {"diagram", 5}}
+	if !slices.Equal(wiki, wantWiki) {
+		t.Errorf("expected wikilinks %v, got %v", wantWiki, wiki)
+	}
+}
@@ -0,0 +1,203 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// Lint rules, reported in LintIssue.Rule and named by LintOptions.Disabled
+const (
+	LintSingleH1           = "single-h1"           // more than one top-level heading
+	LintHeadingIncrement   = "heading-increment"   // a heading more than one level below the previous one
+	LintTrailingWhitespace = "trailing-whitespace" // spaces or tabs at the end of a line
+	LintCodeTabs           = "code-tabs"           // tabs in a fenced code block
+	LintBrokenLink         = "broken-link"         // a relative link or image to a missing file
+	LintEmptyHeading       = "empty-heading"       // a heading without text
+	LintDuplicateAnchor    = "duplicate-anchor"    // a heading whose anchor is taken and gets a -1, -2... suffix
+	LintBrokenAnchor       = "broken-anchor"       // a #fragment link to no anchor of the document
+)
+
+// LintRules are the lint rules, in the order their checks run
+var LintRules = []string{
+	LintSingleH1, LintHeadingIncrement, LintTrailingWhitespace, LintCodeTabs, LintBrokenLink,
+	LintEmptyHeading, LintDuplicateAnchor, LintBrokenAnchor,
+}
+
+// HeadingLintRules are the rules about headings and the in-page links to them
+var HeadingLintRules = []string{
+	LintSingleH1, LintHeadingIncrement, LintEmptyHeading, LintDuplicateAnchor, LintBrokenAnchor,
+}
+
+// emptyHeadingRe matches the lines of ATX headings without text, which leave no position in the AST
+var emptyHeadingRe = regexp.MustCompile(`(?m)^(?:[ \t]*>)*[ \t]{0,3}#{1,6}(?:[ \t]+#*)?[ \t]*$`)
+
+// htmlAnchorRe matches the id and name attributes of raw HTML, anchors #fragment links may target
+var htmlAnchorRe = regexp.MustCompile(`(?i)\s(?:id|name)\s*=\s*["']([^"']+)["']`)
+
+// tabbedLanguages are code fence languages in which tabs are expected, never reported by LintCodeTabs
+var tabbedLanguages = map[string]bool{"go": true, "make": true, "makefile": true, "tsv": true}
+
+// LintIssue is a problem Lint, or an external linter, found on a line of the source. Column and
+// Severity are only set by linters reporting them.
+type LintIssue struct {
+	Rule     string `json:"rule"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintOptions tunes a Lint call
+type LintOptions struct {
+	// Disabled names the rules not checked
+	Disabled []string
+	// Resolve reports whether a relative link or image destination (query and fragment removed,
+	// unescaped) exists. Without it links are not checked.
+	Resolve func(dest string) bool
+}
+
+// ValidateLintRules checks that names only holds lint rule names
+func ValidateLintRules(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(LintRules, name) {
+			return fmt.Errorf("unknown lint rule %q (expected one of %s)", name, strings.Join(LintRules, ", "))
+		}
+	}
+	return nil
+}
+
+// Lint checks source for common authoring problems: several top-level headings, skipped heading
+// levels, trailing whitespace, tabs in code fences, empty headings, headings whose anchor is taken,
+// #fragment links to no heading or raw HTML id and, with opts.Resolve, broken relative links.
+// Anchors are given as the renderer gives them, before any anchor prefix. Two trailing spaces
+// after text are a hard line break and are not reported. The issues are advisory and sorted by
+// line; lines count from the top of the file, front matter included.
+func (p *Parser) Lint(source []byte, opts LintOptions) []LintIssue {
+	source = bytes.TrimPrefix(source, utf8BOM)
+	_, body, _ := SplitFrontMatter(source)
+	offset := bytes.Count(source[:len(source)-len(body)], []byte("\n"))
+	doc := p.md.Parser().Parse(text.NewReader(body))
+	enabled := func(rule string) bool { return !slices.Contains(opts.Disabled, rule) }
+
+	issues := []LintIssue{}
+	report := func(rule string, line int, format string, args ...any) {
+		issues = append(issues, LintIssue{Rule: rule, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// extractTOC gives the headings in document order, and this walk their lines
+	toc := extractTOC(doc, body, "")
+	var headingLines, emptyLines []int
+	skip := codeRangesIn(doc)
+	for _, m := range emptyHeadingRe.FindAllIndex(body, -1) {
+		if !inRanges(skip, m[0]) {
+			emptyLines = append(emptyLines, bytes.Count(body[:m[0]], []byte("\n"))+1)
+		}
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			line := lineOf(n, body)
+			if n.Lines().Len() == 0 && len(emptyLines) > 0 {
+				line, emptyLines = emptyLines[0], emptyLines[1:]
+			}
+			headingLines = append(headingLines, line+offset)
+			return ast.WalkSkipChildren, nil
+		case *ast.FencedCodeBlock:
+			if !enabled(LintCodeTabs) || tabbedLanguages[strings.ToLower(string(n.Language(body)))] {
+				return ast.WalkSkipChildren, nil
+			}
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				if seg := lines.At(i); bytes.ContainsRune(seg.Value(body), '\t') {
+					report(LintCodeTabs, bytes.Count(body[:seg.Start], []byte("\n"))+1+offset,
+						"tab in a code block; indent with spaces so it looks the same everywhere")
+					break
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	firstH1, previous := 0, 0
+	anchorLines := map[string]int{}
+	for i, item := range toc {
+		line := headingLines[i]
+		anchorLines[item.Anchor] = line
+		if strings.TrimSpace(item.Title) == "" {
+			if enabled(LintEmptyHeading) {
+				report(LintEmptyHeading, line, "empty heading")
+			}
+		} else if base := generateAnchor(item.Title); base != "" && item.Anchor != base && enabled(LintDuplicateAnchor) {
+			report(LintDuplicateAnchor, line, "heading %q gets anchor %q: %q is taken by the heading on line %d",
+				item.Title, item.Anchor, base, anchorLines[base])
+		}
+		if item.Level == 1 && enabled(LintSingleH1) {
+			if firstH1 != 0 {
+				report(LintSingleH1, line, "top-level heading %q after the one on line %d", item.Title, firstH1)
+			} else {
+				firstH1 = line
+			}
+		}
+		if previous != 0 && item.Level > previous+1 && enabled(LintHeadingIncrement) {
+			report(LintHeadingIncrement, line, "heading %q skips from level %d to level %d",
+				item.Title, previous, item.Level)
+		}
+		previous = item.Level
+	}
+
+	if enabled(LintTrailingWhitespace) {
+		for i, line := range bytes.Split(source, []byte("\n")) {
+			line = bytes.TrimSuffix(line, []byte("\r"))
+			trimmed := bytes.TrimRight(line, " \t")
+			trailing := string(line[len(trimmed):])
+			if trailing != "" && (trailing != "  " || len(trimmed) == 0) {
+				report(LintTrailingWhitespace, i+1, "trailing whitespace")
+			}
+		}
+	}
+
+	links := extractLinks(doc, body)
+	if enabled(LintBrokenAnchor) {
+		for _, m := range htmlAnchorRe.FindAllSubmatch(body, -1) {
+			anchorLines[string(m[1])] = 0
+		}
+		for _, link := range links {
+			if link.Image || len(link.Dest) < 2 || link.Dest[0] != '#' {
+				continue
+			}
+			fragment, err := url.PathUnescape(link.Dest[1:])
+			if _, ok := anchorLines[fragment]; ok || err != nil {
+				continue
+			}
+			report(LintBrokenAnchor, link.Line+offset, "link to %q matches no heading of the document", link.Dest)
+		}
+	}
+
+	if opts.Resolve != nil && enabled(LintBrokenLink) {
+		for _, link := range links {
+			target, ok := RelativeTarget(link.Dest)
+			if !ok || opts.Resolve(target) {
+				continue
+			}
+			kind := "link"
+			if link.Image {
+				kind = "image"
+			}
+			report(LintBrokenLink, link.Line+offset, "broken %s %q", kind, link.Dest)
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
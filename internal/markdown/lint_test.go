@@ -0,0 +1,88 @@
+package markdown
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	source := "---\ntitle: Guide\n---\n" +
+		"# Guide\n" + // 4
+		"Line with a break  \n" + // 5
+		"Text with trailing space \n" + // 6
+		"#### Deep\n" + // 7
+		"```go\n\tfmt.Println()\n```\n" + // 8-10
+		"```sh\n  echo\n\tls\n```\n" + // 11-14
+		"[Setup](setup.md) [Gone](gone.md#top) ![Logo](img/logo.png) [Web](https://example.com)\n" + // 15
+		"# Another\n" // 16
+	resolve := func(dest string) bool { return dest == "setup.md" }
+
+	type issue struct {
+		rule string
+		line int
+	}
+	collect := func(issues []LintIssue) []issue {
+		var got []issue
+		for _, i := range issues {
+			got = append(got, issue{i.Rule, i.Line})
+		}
+		return got
+	}
+
+	p := NewParser()
+	got := collect(p.Lint([]byte(source), LintOptions{Resolve: resolve}))
+	want := []issue{
+		{LintTrailingWhitespace, 6},
+		{LintHeadingIncrement, 7},
+		{LintCodeTabs, 13},
+		{LintBrokenLink, 15},
+		{LintBrokenLink, 15},
+		{LintSingleH1, 16},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	disabled := LintOptions{Disabled: []string{LintTrailingWhitespace, LintCodeTabs, LintSingleH1}}
+	if got := collect(p.Lint([]byte(source), disabled)); !slices.Equal(got, []issue{{LintHeadingIncrement, 7}}) {
+		t.Errorf("expected only the heading issue without Resolve and the disabled rules, got %v", got)
+	}
+	if issues := p.Lint([]byte("# Clean\n\n## Section\n"), LintOptions{}); issues == nil || len(issues) != 0 {
+		t.Errorf("expected an empty list, got %#v", issues)
+	}
+}
+
+func TestLintHeadings(t *testing.T) {
+	source := "# Guide\n" + // 1
+		"## Setup\n" + // 2
+		"## Setup\n" + // 3
+		"##\n" + // 4
+		"<a id=\"legacy\"></a>\n\n" + // 5-6
+		"[ok](#setup-1) [escaped](#setup%2D1) [html](#legacy) [bad](#install) [case](#Setup) [top](#)\n" // 7
+
+	var got []LintIssue
+	for _, issue := range NewParser().Lint([]byte(source), LintOptions{}) {
+		if slices.Contains(HeadingLintRules, issue.Rule) {
+			got = append(got, issue)
+		}
+	}
+	want := []LintIssue{
+		{Rule: LintDuplicateAnchor, Line: 3,
+			Message: `heading "Setup" gets anchor "setup-1": "setup" is taken by the heading on line 2`},
+		{Rule: LintEmptyHeading, Line: 4, Message: "empty heading"},
+		{Rule: LintBrokenAnchor, Line: 7, Message: `link to "#install" matches no heading of the document`},
+		{Rule: LintBrokenAnchor, Line: 7, Message: `link to "#Setup" matches no heading of the document`},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestValidateLintRules(t *testing.T) {
+	if err := ValidateLintRules([]string{LintCodeTabs, LintBrokenLink}); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateLintRules([]string{"line-length"}); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+}
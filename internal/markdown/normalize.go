@@ -0,0 +1,69 @@
+package markdown
+
+import "unicode/utf8"
+
+// zeroWidth lists the invisible characters Options.Normalize removes. The zero-width joiner and
+// non-joiner stay: emoji sequences and several scripts need them.
+var zeroWidth = map[rune]bool{
+	'\u200b': true, // zero-width space
+	'\u2060': true, // word joiner
+	'\ufeff': true, // zero-width no-break space (a BOM in the middle of the text)
+}
+
+// normalize returns source with "\r\n" and "\r" line endings turned into "\n", zero-width
+// characters removed and no-break spaces replaced by spaces, along with the offset in source of
+// each byte of the result. When there is nothing to change it returns source and nil.
+func normalize(source []byte) ([]byte, []int) {
+	var out []byte
+	var origin []int
+	for i := 0; i < len(source); {
+		c := source[i]
+		if c != '\r' && c < utf8.RuneSelf {
+			if out != nil {
+				out = append(out, c)
+				origin = append(origin, i)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(source[i:])
+		var replacement []byte
+		switch {
+		case c == '\r':
+			replacement = []byte{'\n'}
+			if i+1 < len(source) && source[i+1] == '\n' {
+				size = 2
+			}
+		case zeroWidth[r]:
+			replacement = []byte{}
+		case r == '\u00a0':
+			replacement = []byte{' '}
+		}
+		if replacement == nil {
+			if out != nil {
+				out = append(out, source[i:i+size]...)
+				for j := range size {
+					origin = append(origin, i+j)
+				}
+			}
+			i += size
+			continue
+		}
+		if out == nil {
+			out = append(make([]byte, 0, len(source)), source[:i]...)
+			origin = make([]int, i, len(source))
+			for j := range i {
+				origin[j] = j
+			}
+		}
+		for range replacement {
+			origin = append(origin, i)
+		}
+		out = append(out, replacement...)
+		i += size
+	}
+	if out == nil {
+		return source, nil
+	}
+	return out, origin
+}
@@ -0,0 +1,69 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		source, want string
+	}{
+		{"plain\ntext", "plain\ntext"},
+		{"a\r\nb\rc", "a\nb\nc"},
+		{"a\u00a0b\u200bc", "a bc"},
+		{"\u00e9\u2060\ufeff!", "\u00e9!"},
+		// Emoji sequences keep their joiners
+		{"\U0001f469\u200d\U0001f4bb", "\U0001f469\u200d\U0001f4bb"},
+	}
+	for _, tt := range tests {
+		got, origin := normalize([]byte(tt.source))
+		if string(got) != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+		if origin == nil {
+			if tt.want != tt.source {
+				t.Errorf("normalize(%q) changed the text without mapping it", tt.source)
+			}
+			continue
+		}
+		for i := range got {
+			// Kept bytes map to the same byte of the source
+			if got[i] != ' ' && got[i] != '\n' && got[i] != tt.source[origin[i]] {
+				t.Errorf("normalize(%q): byte %d maps to %d", tt.source, i, origin[i])
+			}
+		}
+	}
+}
+
+func TestParseNormalized(t *testing.T) {
+	source := "# Pasted\u00a0Title\u200b\r\n\r\n-\u00a0[ ] task\r\n"
+	p := New(Options{HTMLMode: HTMLUnsafe, Normalize: true})
+	result, err := p.Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.TOC) != 1 || result.TOC[0].Anchor != "pasted-title" {
+		t.Errorf("toc = %+v, want the pasted-title anchor", result.TOC)
+	}
+	if strings.Contains(result.HTML, "\r") || strings.Contains(result.HTML, "\u200b") {
+		t.Errorf("html kept pasted characters: %q", result.HTML)
+	}
+	want := []Task{{Index: 0, Offset: strings.Index(source, "[ ]"), Line: 3}}
+	if !reflect.DeepEqual(result.Tasks, want) {
+		t.Errorf("tasks = %+v, want %+v", result.Tasks, want)
+	}
+	if _, err := ToggleTask([]byte(source), want[0].Offset, true); err != nil {
+		t.Errorf("toggling the task in the raw source: %v", err)
+	}
+
+	// Off by default
+	result, err = NewParser().Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.HTML, "\u200b") {
+		t.Errorf("expected the unnormalized html to keep the zero-width space: %q", result.HTML)
+	}
+}
@@ -3,17 +3,22 @@ package markdown
 
 import (
 	"bytes"
+	"fmt"
+	"html"
+	"maps"
 	"regexp"
 	"strings"
 
 	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
 	"github.com/yuin/goldmark"
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/ast"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
+	gmparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
 	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 )
 
 // TOCItem represents a table of contents entry
@@ -23,73 +28,291 @@ type TOCItem struct {
 	Anchor string `json:"anchor"`
 }
 
+// Link is an outbound link or image reference of a document
+type Link struct {
+	Dest  string `json:"dest"`
+	Image bool   `json:"image,omitempty"`
+	Line  int    `json:"line"`
+}
+
 // ParseResult contains the parsed markdown result
 type ParseResult struct {
 	HTML  string    `json:"html"`
 	TOC   []TOCItem `json:"toc"`
 	Title string    `json:"title"`
+	Links []Link    `json:"links,omitempty"`
+	Tasks []Task    `json:"tasks,omitempty"`
+	// Non-fatal problems found while rendering, e.g. an unknown code block language
+	Warnings []string `json:"warnings,omitempty"`
 }
 
+// HTMLMode controls how raw HTML embedded in markdown is rendered
+type HTMLMode string
+
+// Supported HTML modes.
+const (
+	// HTMLUnsafe renders embedded HTML as written
+	HTMLUnsafe HTMLMode = "unsafe"
+	// HTMLSanitize renders embedded HTML with scripts, event handlers and other active content removed
+	HTMLSanitize HTMLMode = "sanitize"
+	// HTMLStrip omits embedded HTML
+	HTMLStrip HTMLMode = "strip"
+)
+
 // Parser handles markdown parsing with goldmark
 type Parser struct {
-	md goldmark.Markdown
+	md           goldmark.Markdown
+	sanitize     *bluemonday.Policy
+	codeLanguage string
+	normalize    bool
+	anchorPrefix string
+	// sectionWrappers is set by WithSectionWrappers
+	sectionWrappers bool
+	// diagrams draw special fences by language; see drawDiagrams
+	diagrams      map[string]DiagramFunc
+	diagramMarker string
+}
+
+// Options configures a Parser
+type Options struct {
+	// HTMLMode applies to embedded HTML; an unknown mode is treated as HTMLStrip
+	HTMLMode HTMLMode
+	// CodeLanguage decides how code fences without a language are highlighted: empty or
+	// CodeLanguagePlaintext leaves them plain, CodeLanguageAuto guesses the language, and any
+	// other value is the Chroma language to assume (see ValidateCodeLanguage)
+	CodeLanguage string
+	// Fences maps the languages of special code fences to a class: their content is rendered as
+	// written, not highlighted, in a <div> of that class. Other fences are code blocks.
+	Fences map[string]string
+	// Diagrams maps the languages of special fences to functions drawing them on the server, as
+	// SVG inlined in place of the fence's <div>; a language missing from Fences is added with
+	// itself as the class. A fence that fails to draw is rendered as any other, with a warning.
+	// Only HTMLUnsafe parsers draw: the SVG is made from fence text the document's authors control,
+	// and would have to be inlined as it is, so other modes leave the fences to the frontend.
+	Diagrams map[string]DiagramFunc
+	// Normalize cleans up text pasted from word processors before parsing: line endings become
+	// "\n", zero-width spaces are removed and no-break spaces become spaces
+	Normalize bool
+	// AnchorPrefix is put before the id of every heading of every document, and before the
+	// fragment of links within the document, so that rendered HTML embedded in another page keeps
+	// its ids apart from the page's
+	AnchorPrefix string
+	// DisabledExtensions names the GFM extensions left out (ExtensionAutolinks, ExtensionTables,
+	// ExtensionStrikethrough, ExtensionTaskLists); the others are enabled
+	DisabledExtensions []string
 }
 
-// NewParser creates a new markdown parser with extensions
+// NewParser creates a new markdown parser with extensions that renders embedded HTML as written
 func NewParser() *Parser {
+	return New(Options{HTMLMode: HTMLUnsafe})
+}
+
+// NewParserWithHTMLMode creates a markdown parser applying mode to embedded HTML; an unknown
+// mode is treated as HTMLStrip
+func NewParserWithHTMLMode(mode HTMLMode) *Parser {
+	return New(Options{HTMLMode: mode})
+}
+
+// New creates a markdown parser configured by opts
+func New(opts Options) *Parser {
+	mode := opts.HTMLMode
+	rendererOptions := []renderer.Option{
+		gmhtml.WithHardWraps(),
+		gmhtml.WithXHTML(),
+	}
+	if mode == HTMLUnsafe || mode == HTMLSanitize {
+		rendererOptions = append(rendererOptions, gmhtml.WithUnsafe())
+	}
+	rendererOptions = append(rendererOptions,
+		renderer.WithNodeRenderers(util.Prioritized(&sectionRenderer{}, 100)))
+	var parserOptions []gmparser.Option
+	fences, diagrams := opts.Fences, opts.Diagrams
+	if mode != HTMLUnsafe {
+		diagrams = nil
+	}
+	if len(diagrams) > 0 {
+		fences = make(map[string]string, len(opts.Fences)+len(diagrams))
+		for lang := range diagrams {
+			fences[lang] = lang
+		}
+		maps.Copy(fences, opts.Fences)
+	}
+	marker := newDiagramMarker()
+	if len(fences) > 0 {
+		parserOptions = append(parserOptions,
+			gmparser.WithASTTransformers(util.Prioritized(&fenceTransformer{classes: fences}, 100)))
+		rendererOptions = append(rendererOptions,
+			renderer.WithNodeRenderers(util.Prioritized(&fenceRenderer{marker: marker}, 100)))
+	}
+
 	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Table,
-			extension.Strikethrough,
-			extension.TaskList,
-			extension.Typographer,
+		goldmark.WithExtensions(extenders(opts.DisabledExtensions,
 			highlighting.NewHighlighting(
 				highlighting.WithStyle("monokai"),
 				highlighting.WithFormatOptions(
 					chromahtml.WithClasses(true),
 				),
 			),
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithHardWraps(),
-			html.WithXHTML(),
-			html.WithUnsafe(),
-		),
+		)...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
 
-	return &Parser{md: md}
+	p := &Parser{md: md, codeLanguage: opts.CodeLanguage, normalize: opts.Normalize, anchorPrefix: opts.AnchorPrefix,
+		diagrams: diagrams, diagramMarker: marker}
+	if mode == HTMLSanitize {
+		p.sanitize = sanitizePolicy()
+	}
+	return p
+}
+
+// WithSectionWrappers returns a copy of p that wraps each top-level heading and the content up to
+// the next one in <section data-anchor="..."> keyed by the heading's anchor, for scroll-sync and
+// section navigation, or that does not when on is false, as parsers do by default. The copy shares
+// p's goldmark instance and caches nothing of its own, so it is cheap to make per request.
+func (p *Parser) WithSectionWrappers(on bool) *Parser {
+	wrapped := *p
+	wrapped.sectionWrappers = on
+	return &wrapped
+}
+
+// sanitizePolicy allows the user-generated-content subset of HTML plus what the renderer
+// itself emits: highlighting classes, heading ids, task list checkboxes and section anchors
+func sanitizePolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Globally()
+	policy.AllowAttrs("tabindex").Matching(regexp.MustCompile(`^0$`)).OnElements("pre")
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	policy.AllowAttrs("data-anchor").OnElements("section")
+	// Images inlined with ParseOptions.InlineImage
+	policy.AllowDataURIImages()
+	return policy
 }
 
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
 // Parse converts markdown source to HTML and extracts metadata
 func (p *Parser) Parse(source []byte) (*ParseResult, error) {
+	return p.ParseWithOptions(source, ParseOptions{})
+}
+
+// ParseWithOptions is Parse with link checking and other per-document options
+func (p *Parser) ParseWithOptions(source []byte, opts ParseOptions) (*ParseResult, error) {
+	// A leading BOM would keep goldmark from recognising a heading on the first line
+	trimmed := bytes.TrimPrefix(source, utf8BOM)
+	bomLen := len(source) - len(trimmed)
+	source = trimmed
+	var positions []int
+	if p.normalize {
+		source, positions = normalize(source)
+	}
+	// origin maps an offset in the parsed source back to the caller's
+	origin := func(offset int) int {
+		if positions != nil {
+			offset = positions[offset]
+		}
+		return offset + bomLen
+	}
+	doc := p.md.Parser().Parse(text.NewReader(source))
+
+	// Heading ids are assigned before rendering so the TOC anchors are exactly the rendered ids
+	toc := extractTOC(doc, source, p.anchorPrefix+opts.AnchorPrefix)
+	if p.anchorPrefix != "" {
+		prefixFragments(doc, p.anchorPrefix)
+	}
+	warnings := collectWarnings(doc, source, opts)
+	links := extractLinks(doc, source)
+	tasks := extractTasks(doc, source, origin)
+	if opts.InlineImage != nil {
+		warnings = append(warnings, inlineImages(doc, source, opts.InlineImage)...)
+	}
+	if opts.ExternalImage != nil {
+		rewriteExternalImages(doc, opts.ExternalImage)
+	}
+	if p.sectionWrappers {
+		wrapSections(doc)
+	}
+	drawings, diagramWarnings := p.drawDiagrams(doc, source)
+	warnings = append(warnings, diagramWarnings...)
+	rendered := p.assignCodeLanguages(doc, source)
 	var buf bytes.Buffer
-	if err := p.md.Convert(source, &buf); err != nil {
+	if err := p.md.Renderer().Render(&buf, rendered, doc); err != nil {
 		return nil, err
 	}
+	out := buf.String()
+	if p.sanitize != nil {
+		// Inline HTML is split across several AST nodes, so the whole document is sanitized
+		out = p.sanitize.Sanitize(out)
+	}
+	out = p.inlineDiagrams(out, drawings)
 
-	toc := p.extractTOC(source)
 	title := ""
 	if len(toc) > 0 {
 		title = toc[0].Title
 	}
 
 	return &ParseResult{
-		HTML:  buf.String(),
-		TOC:   toc,
-		Title: title,
+		HTML:     out,
+		TOC:      toc,
+		Title:    title,
+		Links:    links,
+		Tasks:    tasks,
+		Warnings: warnings,
 	}, nil
 }
 
-// extractTOC walks the AST to extract headings
-func (p *Parser) extractTOC(source []byte) []TOCItem {
-	reader := text.NewReader(source)
-	doc := p.md.Parser().Parse(reader)
+// Outline returns the headings of source with the anchors Parse gives them, without rendering it
+func (p *Parser) Outline(source []byte) []TOCItem {
+	source = bytes.TrimPrefix(source, utf8BOM)
+	if p.normalize {
+		source, _ = normalize(source)
+	}
+	return extractTOC(p.md.Parser().Parse(text.NewReader(source)), source, p.anchorPrefix)
+}
+
+// prefixFragments puts prefix before the fragment of the links of doc to an anchor of the same
+// document, to follow the heading ids
+func prefixFragments(doc ast.Node, prefix string) {
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && entering && len(link.Destination) > 1 && link.Destination[0] == '#' {
+			link.Destination = append([]byte("#"+prefix), link.Destination[1:]...)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// extractLinks lists the link and image destinations of doc in document order; autolinks are
+// included, reference definitions only where they are used
+func extractLinks(doc ast.Node, source []byte) []Link {
+	var links []Link
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link:
+			links = append(links, Link{Dest: string(n.Destination), Line: lineOf(n, source)})
+		case *ast.Image:
+			links = append(links, Link{Dest: string(n.Destination), Image: true, Line: lineOf(n, source)})
+		case *ast.AutoLink:
+			dest := string(n.URL(source))
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(strings.ToLower(dest), "mailto:") {
+				dest = "mailto:" + dest
+			}
+			links = append(links, Link{Dest: dest, Line: lineOf(n, source)})
+		}
+		return ast.WalkContinue, nil
+	})
+	return links
+}
 
+// extractTOC walks the AST to extract headings, giving each a unique id derived from its text and
+// put after prefix
+func extractTOC(doc ast.Node, source []byte, prefix string) []TOCItem {
 	var toc []TOCItem
+	used := make(map[string]bool)
 	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if !entering {
 			return ast.WalkContinue, nil
@@ -97,12 +320,14 @@ func (p *Parser) extractTOC(source []byte) []TOCItem {
 
 		if heading, ok := n.(*ast.Heading); ok {
 			title := extractText(heading, source)
-			anchor := generateAnchor(title)
+			anchor := prefix + uniqueAnchor(generateAnchor(title), used)
+			heading.SetAttributeString("id", []byte(anchor))
 			toc = append(toc, TOCItem{
 				Level:  heading.Level,
 				Title:  title,
 				Anchor: anchor,
 			})
+			return ast.WalkSkipChildren, nil
 		}
 		return ast.WalkContinue, nil
 	})
@@ -113,23 +338,45 @@ func (p *Parser) extractTOC(source []byte) []TOCItem {
 	return toc
 }
 
-// extractText extracts text content from a node
+// uniqueAnchor suffixes anchor with -1, -2, ... until it is unused, like goldmark's auto heading ids
+func uniqueAnchor(anchor string, used map[string]bool) string {
+	if anchor == "" {
+		anchor = "heading"
+	}
+	candidate := anchor
+	for i := 1; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", anchor, i)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// extractText extracts the text content of a node, including text nested in emphasis, code spans and links
 func extractText(n ast.Node, source []byte) string {
 	var buf bytes.Buffer
-	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-		if text, ok := child.(*ast.Text); ok {
-			buf.Write(text.Segment.Value(source))
+	_ = ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
 		}
-	}
-	return buf.String()
+		switch child := child.(type) {
+		case *ast.Text:
+			buf.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			// The typographer emits entities such as &ldquo; as strings
+			buf.WriteString(html.UnescapeString(string(child.Value)))
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
 }
 
 // generateAnchor creates a URL-safe anchor from text
 func generateAnchor(text string) string {
-	// Convert to lowercase
-	anchor := strings.ToLower(text)
-	// Replace spaces with hyphens
-	anchor = strings.ReplaceAll(anchor, " ", "-")
+	// Convert to lowercase, joining words on any run of whitespace with a hyphen
+	anchor := strings.ToLower(strings.Join(strings.Fields(text), "-"))
 	// Remove non-alphanumeric characters except hyphens
 	reg := regexp.MustCompile(`[^a-z0-9\-\p{Han}\p{Hiragana}\p{Katakana}]`)
 	anchor = reg.ReplaceAllString(anchor, "")
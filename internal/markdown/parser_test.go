@@ -1,8 +1,11 @@
 package markdown
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/yuin/goldmark/text"
 )
 
 func TestParse(t *testing.T) {
@@ -26,10 +29,9 @@ func TestParse(t *testing.T) {
 }
 
 func TestExtractTOC(t *testing.T) {
-	p := NewParser()
 	source := []byte("# Head 1\n## Head 2\n### Head 3")
 
-	toc := p.extractTOC(source)
+	toc := extractTOC(NewParser().md.Parser().Parse(text.NewReader(source)), source, "")
 	if len(toc) != 3 {
 		t.Fatalf("expected 3 TOC items, got %d", len(toc))
 	}
@@ -55,6 +57,8 @@ func TestGenerateAnchor(t *testing.T) {
 		{"Multiple   Spaces", "multiple-spaces"},
 		{"-Start-and-End-", "start-and-end"},
 		{"中文标题", "中文标题"},
+		{"Tab\tSeparated", "tab-separated"},
+		{"No\u00a0Break", "no-break"},
 	}
 
 	for _, tt := range tests {
@@ -64,3 +68,296 @@ func TestGenerateAnchor(t *testing.T) {
 		}
 	}
 }
+
+func TestTOCAnchorsMatchRenderedIDs(t *testing.T) {
+	source := []byte("# With *em* text\n\n## `code` heading\n\n## [Link](x) here\n\n" +
+		"## Dup\n\n## Dup\n\n## 中文 标题\n\n## \"Smart\" quotes\n")
+
+	result, err := NewParser().Parse(source)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	want := []TOCItem{
+		{1, "With em text", "with-em-text"},
+		{2, "code heading", "code-heading"},
+		{2, "Link here", "link-here"},
+		{2, "Dup", "dup"},
+		{2, "Dup", "dup-1"},
+		{2, "中文 标题", "中文-标题"},
+		{2, "\u201cSmart\u201d quotes", "smart-quotes"},
+	}
+	if len(result.TOC) != len(want) {
+		t.Fatalf("expected %d TOC items, got %+v", len(want), result.TOC)
+	}
+	for i, item := range result.TOC {
+		if item != want[i] {
+			t.Errorf("TOC item %d: expected %+v, got %+v", i, want[i], item)
+		}
+		if !strings.Contains(result.HTML, `id="`+item.Anchor+`"`) {
+			t.Errorf("TOC anchor %q does not match any rendered heading id in %s", item.Anchor, result.HTML)
+		}
+	}
+	if outline := NewParser().Outline(source); !reflect.DeepEqual(outline, result.TOC) {
+		t.Errorf("expected Outline to return the TOC, got %+v", outline)
+	}
+}
+
+func TestAnchorPrefix(t *testing.T) {
+	result, err := NewParser().ParseWithOptions([]byte("# Intro\n\n## Intro\n"), ParseOptions{AnchorPrefix: "ch1-"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(result.TOC) != 2 || result.TOC[0].Anchor != "ch1-intro" || result.TOC[1].Anchor != "ch1-intro-1" {
+		t.Fatalf("expected prefixed anchors, got %+v", result.TOC)
+	}
+	if !strings.Contains(result.HTML, `id="ch1-intro-1"`) {
+		t.Errorf("expected the prefixed ids to be rendered, got %s", result.HTML)
+	}
+}
+
+func TestParserAnchorPrefix(t *testing.T) {
+	p := New(Options{AnchorPrefix: "mh-"})
+	source := []byte("# Introduction\n\nSee [below](#usage), [the guide](guide.md#setup) and [top](#).\n\n## Usage\n")
+	result, err := p.WithSectionWrappers(true).ParseWithOptions(source, ParseOptions{AnchorPrefix: "ch1-"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(result.TOC) != 2 || result.TOC[0].Anchor != "mh-ch1-introduction" || result.TOC[1].Anchor != "mh-ch1-usage" {
+		t.Fatalf("expected both prefixes on the anchors, got %+v", result.TOC)
+	}
+	for _, want := range []string{
+		`id="mh-ch1-usage"`, `data-anchor="mh-ch1-introduction"`,
+		// Links within the document follow the parser's prefix; the caller rewrites them for its own
+		`href="#mh-usage"`, `href="guide.md#setup"`, `href="#"`,
+	} {
+		if !strings.Contains(result.HTML, want) {
+			t.Errorf("expected %s in %s", want, result.HTML)
+		}
+	}
+	if outline := p.Outline(source); outline[1].Anchor != "mh-usage" {
+		t.Errorf("expected the outline to carry the prefix, got %+v", outline)
+	}
+}
+
+func TestParseStripsByteOrderMark(t *testing.T) {
+	result, err := NewParser().Parse([]byte("\ufeff# BOM Title\r\n\r\nBody.\r\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if result.Title != "BOM Title" || len(result.TOC) != 1 || result.TOC[0].Anchor != "bom-title" {
+		t.Errorf("expected the first line to be a heading, got title %q and TOC %+v", result.Title, result.TOC)
+	}
+}
+
+func TestHTMLModes(t *testing.T) {
+	source := []byte("<div onclick=\"steal()\">kept <script>alert(1)</script><b>bold</b></div>\n\n- [x] done\n")
+
+	tests := []struct {
+		mode    HTMLMode
+		want    []string
+		notWant []string
+	}{
+		{HTMLUnsafe, []string{`onclick="steal()"`, "<script>", "<b>bold</b>"}, nil},
+		{HTMLSanitize, []string{"<div>kept ", "<b>bold</b>", `type="checkbox"`}, []string{"onclick", "<script>", "alert"}},
+		{HTMLStrip, []string{"<!-- raw HTML omitted -->", `type="checkbox"`}, []string{"<div", "<b>", "<script>"}},
+	}
+	for _, tt := range tests {
+		result, err := NewParserWithHTMLMode(tt.mode).Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(result.HTML, s) {
+				t.Errorf("%s: expected %q in %s", tt.mode, s, result.HTML)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(result.HTML, s) {
+				t.Errorf("%s: expected no %q in %s", tt.mode, s, result.HTML)
+			}
+		}
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	source := []byte("# Doc\n\n```nosuchlang\nx\n```\n\n```go\nfunc main() {}\n```\n\n```mermaid\ngraph TD\n```\n\n" +
+		"See [guide](guide.md#intro), [missing](missing.md), [site](https://example.com) and [top](#doc).\n\n" +
+		"![big](img/big.png) ![gone](img/gone.png)\n")
+	files := map[string]int64{"guide.md": 10, "img/big.png": 6 << 20}
+	resolve := func(dest string) (int64, bool) {
+		size, ok := files[dest]
+		return size, ok
+	}
+
+	result, err := NewParser().ParseWithOptions(source, ParseOptions{Resolve: resolve, MaxImageSize: 5 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`line 3: unknown code block language "nosuchlang"`,
+		`line 15: broken link "missing.md"`,
+		`line 17: image "img/big.png" is 6.0 MiB, over the 5.0 MiB limit`,
+		`line 17: broken image "img/gone.png"`,
+	}
+	if strings.Join(result.Warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected warnings:\n%s", strings.Join(result.Warnings, "\n"))
+	}
+	if !strings.Contains(result.HTML, "nosuchlang") {
+		t.Error("expected the document to render despite warnings")
+	}
+
+	// Without a resolver links are not checked
+	result, err = NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 1 {
+		t.Errorf("expected only the language warning, got %v", result.Warnings)
+	}
+}
+
+func TestCodeLanguage(t *testing.T) {
+	source := []byte("```\n#!/bin/bash\necho hi\n```\n\n```\nsome words\n```\n\n```mermaid\ngraph TD\n```\n")
+
+	tests := []struct {
+		lang    string
+		want    []string
+		notWant []string
+	}{
+		{"", []string{"<pre><code>#!/bin/bash", "<pre><code>some words"}, []string{"chroma"}},
+		{CodeLanguagePlaintext, []string{"<pre><code>#!/bin/bash"}, []string{"chroma"}},
+		{"python", []string{`<span class="n">echo</span>`, `<span class="n">some</span>`}, nil},
+		{CodeLanguageAuto, []string{`<span class="nb">echo</span>`, "<pre><code>some words"}, nil},
+	}
+	for _, tt := range tests {
+		result, err := New(Options{HTMLMode: HTMLUnsafe, CodeLanguage: tt.lang}).Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(result.HTML, s) {
+				t.Errorf("%q: expected %q in %s", tt.lang, s, result.HTML)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(result.HTML, s) {
+				t.Errorf("%q: expected no %q in %s", tt.lang, s, result.HTML)
+			}
+		}
+		// Blocks naming a language keep it, even one Chroma does not know
+		if !strings.Contains(result.HTML, `<pre><code class="language-mermaid">graph TD`) {
+			t.Errorf("%q: expected the mermaid block untouched in %s", tt.lang, result.HTML)
+		}
+	}
+}
+
+func TestValidateCodeLanguage(t *testing.T) {
+	for _, lang := range []string{"", "plaintext", "auto", "go", "Python", "sh"} {
+		if err := ValidateCodeLanguage(lang); err != nil {
+			t.Errorf("%q: unexpected error %v", lang, err)
+		}
+	}
+	if err := ValidateCodeLanguage("nosuchlang"); err == nil {
+		t.Error("expected an error for an unknown language")
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	source := []byte("# Doc\n\n[a](a.md) ![b](img/b.png)\n\n[ref][r] <me@example.com>\n\n[r]: https://example.com/r\n")
+	result, err := NewParser().Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		{Dest: "a.md", Line: 3},
+		{Dest: "img/b.png", Image: true, Line: 3},
+		{Dest: "https://example.com/r", Line: 5},
+		{Dest: "mailto:me@example.com", Line: 5},
+	}
+	if len(result.Links) != len(want) {
+		t.Fatalf("unexpected links: %+v", result.Links)
+	}
+	for i := range want {
+		if result.Links[i] != want[i] {
+			t.Errorf("link %d: got %+v, want %+v", i, result.Links[i], want[i])
+		}
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	source := "# Doc\n\nSee [a](old.md#intro), ![img](<old.md>) and [other](other.md).\n\n" +
+		"`[code](old.md)`\n\n```\n[fenced](old.md)\n```\n\n[ref]: old.md \"Title\"\n"
+	out, n := RewriteLinks([]byte(source), func(dest string) (string, bool) {
+		if strings.HasPrefix(dest, "old.md") {
+			return "new dir/new.md" + strings.TrimPrefix(dest, "old.md"), true
+		}
+		return "", false
+	})
+	want := "# Doc\n\nSee [a](<new dir/new.md#intro>), ![img](<new dir/new.md>) and [other](other.md).\n\n" +
+		"`[code](old.md)`\n\n```\n[fenced](old.md)\n```\n\n[ref]: <new dir/new.md> \"Title\"\n"
+	if n != 3 || string(out) != want {
+		t.Errorf("got %d rewrites:\n%s", n, out)
+	}
+}
+
+func TestExternalImages(t *testing.T) {
+	source := []byte("![keep](https://ok.example/a.png) ![drop *me*](http://bad.example/b.png)\n\n" +
+		"![proto](//bad.example/c.png) ![local](img/d.png)\n")
+	var asked []string
+	result, err := NewParser().ParseWithOptions(source, ParseOptions{
+		ExternalImage: func(dest string) (string, bool) {
+			asked = append(asked, dest)
+			return "/proxy?u=" + dest, strings.Contains(dest, "ok.example")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(asked) != 3 {
+		t.Errorf("expected only the three external images to be asked about, got %q", asked)
+	}
+	if !strings.Contains(result.HTML, `<img src="/proxy?u=https://ok.example/a.png" alt="keep"`) {
+		t.Errorf("expected the allowed image rewritten, got %s", result.HTML)
+	}
+	if strings.Contains(result.HTML, "bad.example") || !strings.Contains(result.HTML, "drop <em>me</em>") {
+		t.Errorf("expected rejected images replaced by their alt text, got %s", result.HTML)
+	}
+	if !strings.Contains(result.HTML, `src="img/d.png"`) {
+		t.Errorf("expected relative images untouched, got %s", result.HTML)
+	}
+	if len(result.Links) != 4 || result.Links[1].Dest != "http://bad.example/b.png" {
+		t.Errorf("expected links to list the original destinations, got %+v", result.Links)
+	}
+}
+
+func TestSectionWrappers(t *testing.T) {
+	source := []byte("Intro.\n\n# Title\n\nText.\n\n## Part *one*\n\n- ## Not a section\n\n> quote\n")
+
+	for _, mode := range []HTMLMode{HTMLUnsafe, HTMLSanitize} {
+		result, err := NewParserWithHTMLMode(mode).WithSectionWrappers(true).Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "<p>Intro.</p>\n" +
+			"<section data-anchor=\"title\">\n<h1 id=\"title\">Title</h1>\n<p>Text.</p>\n</section>\n" +
+			"<section data-anchor=\"part-one\">\n<h2 id=\"part-one\">Part <em>one</em></h2>\n<ul>\n" +
+			"<li>\n<h2 id=\"not-a-section\">Not a section</h2>\n</li>\n</ul>\n" +
+			"<blockquote>\n<p>quote</p>\n</blockquote>\n</section>\n"
+		if result.HTML != want {
+			t.Errorf("%s: unexpected HTML:\n%s", mode, result.HTML)
+		}
+	}
+
+	// Off by default, and the copy leaves the parser it was made from as it was
+	p := NewParser()
+	for _, parser := range []*Parser{p, p.WithSectionWrappers(true).WithSectionWrappers(false), p} {
+		result, err := parser.Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(result.HTML, "<section") {
+			t.Errorf("expected no sections, got %s", result.HTML)
+		}
+	}
+}
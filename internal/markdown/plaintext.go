@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// blankLinesRe matches the runs of blank lines PlainText collapses into one
+var blankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// PlainText returns the text of source without its markup, for consumers that index or embed
+// documents rather than display them. Blocks are separated by blank lines, table cells by tabs,
+// code blocks are kept verbatim and links and images leave their text. Front matter and raw HTML
+// are left out.
+func PlainText(source []byte) string {
+	_, body, _ := SplitFrontMatter(bytes.TrimPrefix(source, utf8BOM))
+	doc := codeParser.Parser().Parse(text.NewReader(body))
+	var buf bytes.Buffer
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			if entering {
+				lines := n.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					segment := lines.At(i)
+					buf.Write(segment.Value(body))
+				}
+				if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+					buf.WriteByte('\n')
+				}
+				buf.WriteByte('\n')
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.HTMLBlock, *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			if entering {
+				buf.Write(n.Segment.Value(body))
+				if n.SoftLineBreak() || n.HardLineBreak() {
+					buf.WriteByte('\n')
+				}
+			}
+		case *ast.String:
+			if entering {
+				buf.Write(n.Value)
+			}
+		case *ast.AutoLink:
+			if entering {
+				buf.Write(n.URL(body))
+			}
+			return ast.WalkSkipChildren, nil
+		case *east.TableCell:
+			if !entering && n.NextSibling() != nil {
+				buf.WriteByte('\t')
+			}
+		case *east.TableHeader, *east.TableRow, *ast.TextBlock:
+			if !entering {
+				buf.WriteByte('\n')
+			}
+		case *ast.Paragraph, *ast.Heading, *ast.List, *ast.ThematicBreak, *east.Table:
+			if !entering {
+				buf.WriteString("\n\n")
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	plain := strings.TrimSpace(blankLinesRe.ReplaceAllString(buf.String(), "\n\n"))
+	if plain == "" {
+		return ""
+	}
+	return plain + "\n"
+}
@@ -0,0 +1,18 @@
+package markdown
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	source := "---\ntitle: Hidden\n---\n# Title *here*\n\n" +
+		"Some [link](a.md) and ![logo](b.png)\nwrapped `code` <b>bold</b>.\n\n" +
+		"- one\n- two\n\n```go\nfunc main() {\n\tx := 1\n}\n```\nSee <https://example.com>.\n\n" +
+		"| a | b |\n|---|---|\n| 1 | 2 |\n\n<div>\nraw\n</div>\n"
+	want := "Title here\n\nSome link and logo\nwrapped code bold.\n\none\ntwo\n\nfunc main() {\n\tx := 1\n}\n\n" +
+		"See https://example.com.\n\na\tb\n1\t2\n"
+	if got := PlainText([]byte(source)); got != want {
+		t.Errorf("PlainText =\n%q\nwant\n%q", got, want)
+	}
+	if got := PlainText([]byte("---\ntitle: x\n---\n")); got != "" {
+		t.Errorf("expected no text without a body, got %q", got)
+	}
+}
@@ -0,0 +1,117 @@
+package markdown
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// Destinations of inline links and images, and of link reference definitions; group 1 is the
+// destination, possibly in angle brackets
+var (
+	inlineDestRe = regexp.MustCompile(`\]\([ \t]*(<[^<>\n]+>|[^\s()<>]+)`)
+	refDefDestRe = regexp.MustCompile(`(?m)^ {0,3}\[[^\]\n]+\]:[ \t]*(<[^<>\n]+>|\S+)`)
+)
+
+// codeParser only locates code and raw HTML, so it needs no renderer options
+var codeParser = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RewriteLinks replaces the destinations of inline links, images and link reference definitions in
+// source for which rewrite returns a new destination and true. Destinations inside code blocks, code
+// spans and raw HTML are left alone. It returns the new source and the number of replacements.
+func RewriteLinks(source []byte, rewrite func(dest string) (string, bool)) ([]byte, int) {
+	skip := codeRanges(source)
+	type edit struct {
+		start, end int
+		dest       string
+	}
+	var edits []edit
+	for _, re := range []*regexp.Regexp{inlineDestRe, refDefDestRe} {
+		for _, m := range re.FindAllSubmatchIndex(source, -1) {
+			start, end := m[2], m[3]
+			if inRanges(skip, start) {
+				continue
+			}
+			dest := string(source[start:end])
+			bracketed := strings.HasPrefix(dest, "<")
+			if bracketed {
+				dest = dest[1 : len(dest)-1]
+			}
+			replacement, ok := rewrite(dest)
+			if !ok {
+				continue
+			}
+			if bracketed || strings.ContainsAny(replacement, " \t") {
+				replacement = "<" + replacement + ">"
+			}
+			edits = append(edits, edit{start, end, replacement})
+		}
+	}
+	if len(edits) == 0 {
+		return source, 0
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	out := make([]byte, 0, len(source))
+	last := 0
+	for _, e := range edits {
+		out = append(out, source[last:e.start]...)
+		out = append(out, e.dest...)
+		last = e.end
+	}
+	return append(out, source[last:]...), len(edits)
+}
+
+// codeRanges returns the byte ranges of source holding code blocks, code spans and raw HTML
+func codeRanges(source []byte) [][2]int {
+	return codeRangesIn(codeParser.Parser().Parse(text.NewReader(source)))
+}
+
+// codeRangesIn is codeRanges over a document already parsed
+func codeRangesIn(doc ast.Node) [][2]int {
+	var ranges [][2]int
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock, *ast.HTMLBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				ranges = append(ranges, [2]int{lines.At(i).Start, lines.At(i).Stop})
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeSpan:
+			first, last := n.FirstChild(), n.LastChild()
+			if first == nil {
+				return ast.WalkSkipChildren, nil
+			}
+			if start, ok := first.(*ast.Text); ok {
+				if end, ok := last.(*ast.Text); ok {
+					ranges = append(ranges, [2]int{start.Segment.Start, end.Segment.Stop})
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.RawHTML:
+			for i := 0; i < n.Segments.Len(); i++ {
+				ranges = append(ranges, [2]int{n.Segments.At(i).Start, n.Segments.At(i).Stop})
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return ranges
+}
+
+func inRanges(ranges [][2]int, pos int) bool {
+	for _, r := range ranges {
+		if pos >= r[0] && pos < r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package markdown
+
+import (
+	"html"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// kindSection is the node kind of section
+var kindSection = ast.NewNodeKind("Section")
+
+// section groups a top-level heading with the blocks up to the next one, see
+// Parser.WithSectionWrappers. It is rendered as <section data-anchor="...">.
+type section struct {
+	ast.BaseBlock
+	anchor string
+}
+
+// Kind implements ast.Node
+func (n *section) Kind() ast.NodeKind {
+	return kindSection
+}
+
+// Dump implements ast.Node
+func (n *section) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Anchor": n.anchor}, nil)
+}
+
+// wrapSections moves each top-level heading of doc, with the blocks that follow it up to the next
+// top-level heading, into a section keyed by the heading's id. Blocks before the first heading
+// are left in place; headings nested in lists or quotes do not start a section.
+func wrapSections(doc ast.Node) {
+	var current *section
+	for n := doc.FirstChild(); n != nil; {
+		next := n.NextSibling()
+		if heading, ok := n.(*ast.Heading); ok {
+			current = &section{}
+			if id, ok := heading.AttributeString("id"); ok {
+				if anchor, ok := id.([]byte); ok {
+					current.anchor = string(anchor)
+				}
+			}
+			doc.InsertBefore(doc, n, current)
+		}
+		if current != nil {
+			doc.RemoveChild(doc, n)
+			current.AppendChild(current, n)
+		}
+		n = next
+	}
+}
+
+// sectionRenderer renders sections
+type sectionRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *sectionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSection, r.render)
+}
+
+func (r *sectionRenderer) render(w util.BufWriter, _ []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<section data-anchor="` + html.EscapeString(n.(*section).anchor) + "\">\n")
+	} else {
+		_, _ = w.WriteString("</section>\n")
+	}
+	return ast.WalkContinue, nil
+}
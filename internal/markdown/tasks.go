@@ -0,0 +1,85 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// Task is a task list item ("- [ ] ..."), in document order
+type Task struct {
+	Index int `json:"index"`
+	// Offset is the byte offset in the source of the "[" of the item's "[ ]" or "[x]" marker
+	Offset  int  `json:"offset"`
+	Line    int  `json:"line"`
+	Checked bool `json:"checked"`
+}
+
+// ErrNotTaskMarker is returned by ToggleTask when the source at the offset is no task marker
+var ErrNotTaskMarker = errors.New("no task marker at offset")
+
+// taskLinePrefix matches what may precede a task marker on its line: block quote markers,
+// indentation and the list item marker. No-break spaces count as spaces, as Options.Normalize has it.
+var taskLinePrefix = regexp.MustCompile(`^[ \t>\x{00A0}]*(?:[-+*]|[0-9]{1,9}[.)])[ \t\x{00A0}]+$`)
+
+// extractTasks lists the task list items of doc, with origin mapping their offsets in source to the
+// source the caller passed, before a BOM was trimmed and the text normalized
+func extractTasks(doc ast.Node, source []byte, origin func(offset int) int) []Task {
+	var tasks []Task
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		box, ok := n.(*east.TaskCheckBox)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		block := box.Parent()
+		if block == nil || block.Lines().Len() == 0 {
+			return ast.WalkContinue, nil
+		}
+		start := block.Lines().At(0).Start
+		if !isTaskMarker(source, start) {
+			return ast.WalkContinue, nil
+		}
+		tasks = append(tasks, Task{
+			Index:   len(tasks),
+			Offset:  origin(start),
+			Line:    bytes.Count(source[:start], []byte("\n")) + 1,
+			Checked: box.IsChecked,
+		})
+		return ast.WalkContinue, nil
+	})
+	return tasks
+}
+
+// isTaskMarker reports whether source holds a task marker at offset, first on its list item line
+func isTaskMarker(source []byte, offset int) bool {
+	if offset < 0 || offset+3 > len(source) {
+		return false
+	}
+	marker := source[offset : offset+3]
+	if marker[0] != '[' || marker[2] != ']' || !bytes.ContainsRune([]byte(" xX"), rune(marker[1])) {
+		return false
+	}
+	lineStart := bytes.LastIndexByte(source[:offset], '\n') + 1
+	return taskLinePrefix.Match(source[lineStart:offset])
+}
+
+// ToggleTask returns source with the task marker at offset (see Task.Offset) checked or unchecked.
+// It fails with ErrNotTaskMarker unless the bytes there look like a task marker, so a stale offset
+// cannot change anything else.
+func ToggleTask(source []byte, offset int, checked bool) ([]byte, error) {
+	if !isTaskMarker(source, offset) {
+		return nil, ErrNotTaskMarker
+	}
+	out := bytes.Clone(source)
+	// An "[X]" left checked stays as written
+	if checked != (out[offset+1] != ' ') {
+		out[offset+1] = ' '
+		if checked {
+			out[offset+1] = 'x'
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package markdown
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseTasks(t *testing.T) {
+	source := "\xef\xbb\xbf# List\n\n- [ ] one\n- [x] two\n  1. [X] nested\n> - [ ] quoted\n\n- [link] not a task\n"
+	result, err := NewParser().Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Task{
+		{Index: 0, Offset: 13, Line: 3, Checked: false},
+		{Index: 1, Offset: 23, Line: 4, Checked: true},
+		{Index: 2, Offset: 36, Line: 5, Checked: true},
+		{Index: 3, Offset: 51, Line: 6, Checked: false},
+	}
+	if !reflect.DeepEqual(result.Tasks, want) {
+		t.Errorf("tasks = %+v, want %+v", result.Tasks, want)
+	}
+	for _, task := range want {
+		if source[task.Offset] != '[' {
+			t.Errorf("task %d: offset %d is %q, want the marker", task.Index, task.Offset, source[task.Offset])
+		}
+	}
+}
+
+func TestToggleTask(t *testing.T) {
+	source := []byte("- [ ] one\n- [X] two\ntext [ ] here\n")
+	tests := []struct {
+		offset  int
+		checked bool
+		want    string
+		wantErr error
+	}{
+		{2, true, "- [x] one\n- [X] two\ntext [ ] here\n", nil},
+		{12, true, "- [ ] one\n- [X] two\ntext [ ] here\n", nil},
+		{12, false, "- [ ] one\n- [ ] two\ntext [ ] here\n", nil},
+		{25, true, "", ErrNotTaskMarker},
+		{3, true, "", ErrNotTaskMarker},
+		{len(source) - 1, true, "", ErrNotTaskMarker},
+	}
+	for _, tt := range tests {
+		got, err := ToggleTask(source, tt.offset, tt.checked)
+		if !errors.Is(err, tt.wantErr) || err == nil && string(got) != tt.want {
+			t.Errorf("ToggleTask(%d, %v) = %q, %v; want %q, %v", tt.offset, tt.checked, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/yuin/goldmark/ast"
+)
+
+// clientLanguages are code block languages the frontend renders itself, so Chroma not knowing them is fine
+var clientLanguages = map[string]bool{
+	"mermaid": true,
+}
+
+// ParseOptions tunes a single Parse call
+type ParseOptions struct {
+	// Resolve, when set, looks up a relative link or image destination (query and fragment
+	// removed, unescaped) and returns its size; ok=false reports a broken link. Without it links
+	// are not checked.
+	Resolve func(dest string) (size int64, ok bool)
+	// MaxImageSize is the size above which a resolved image is reported; 0 disables the check
+	MaxImageSize int64
+	// InlineImage, when set, is asked for a data URI replacing each relative image destination
+	// (query and fragment removed, unescaped). An empty URI keeps the destination; an error does
+	// too and is reported as a warning.
+	InlineImage func(dest string) (uri string, err error)
+	// ExternalImage, when set, is asked about each image with an absolute http(s) or
+	// protocol-relative destination. It returns the destination to render, or false to drop the
+	// image and keep its alt text.
+	ExternalImage func(dest string) (string, bool)
+	// AnchorPrefix is put before every heading anchor, after the parser's Options.AnchorPrefix, so
+	// that documents rendered into one page keep distinct ids
+	AnchorPrefix string
+}
+
+// collectWarnings reports non-fatal problems in doc: code block languages Chroma cannot highlight,
+// and with opts.Resolve, broken relative links and images larger than opts.MaxImageSize
+func collectWarnings(doc ast.Node, source []byte, opts ParseOptions) []string {
+	var warnings []string
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.FencedCodeBlock:
+			lang := string(n.Language(source))
+			if lang != "" && !clientLanguages[strings.ToLower(lang)] && lexers.Get(lang) == nil {
+				warnings = append(warnings,
+					fmt.Sprintf("line %d: unknown code block language %q", lineOf(n, source), lang))
+			}
+		case *ast.Link:
+			if w := checkDestination("link", string(n.Destination), n, source, opts, false); w != "" {
+				warnings = append(warnings, w)
+			}
+		case *ast.Image:
+			if w := checkDestination("image", string(n.Destination), n, source, opts, true); w != "" {
+				warnings = append(warnings, w)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return warnings
+}
+
+// checkDestination returns a warning for a relative destination that does not resolve, or for an
+// image over the size limit
+func checkDestination(kind, dest string, n ast.Node, source []byte, opts ParseOptions, image bool) string {
+	if opts.Resolve == nil {
+		return ""
+	}
+	target, ok := RelativeTarget(dest)
+	if !ok {
+		return ""
+	}
+	size, found := opts.Resolve(target)
+	switch {
+	case !found:
+		return fmt.Sprintf("line %d: broken %s %q", lineOf(n, source), kind, dest)
+	case image && opts.MaxImageSize > 0 && size > opts.MaxImageSize:
+		return fmt.Sprintf("line %d: image %q is %s, over the %s limit",
+			lineOf(n, source), dest, formatSize(size), formatSize(opts.MaxImageSize))
+	}
+	return ""
+}
+
+// RelativeTarget returns the path a relative link destination points to (query and fragment
+// removed, unescaped), or false for absolute URLs, root-relative paths and in-page anchors
+func RelativeTarget(dest string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// lineOf returns the 1-based source line of n, using the nearest node that records its position
+func lineOf(n ast.Node, source []byte) int {
+	for ; n != nil; n = n.Parent() {
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok && fenced.Info != nil {
+			return bytes.Count(source[:fenced.Info.Segment.Start], []byte("\n")) + 1
+		}
+		if t, ok := n.(*ast.Text); ok {
+			return bytes.Count(source[:t.Segment.Start], []byte("\n")) + 1
+		}
+		if n.Type() == ast.TypeBlock && n.Lines().Len() > 0 {
+			return bytes.Count(source[:n.Lines().At(0).Start], []byte("\n")) + 1
+		}
+		if c := n.FirstChild(); c != nil {
+			if t, ok := c.(*ast.Text); ok {
+				return bytes.Count(source[:t.Segment.Start], []byte("\n")) + 1
+			}
+		}
+	}
+	return 0
+}
+
+func formatSize(n int64) string {
+	const mib = 1 << 20
+	if n >= mib {
+		return fmt.Sprintf("%.1f MiB", float64(n)/mib)
+	}
+	return fmt.Sprintf("%d KiB", (n+1023)/1024)
+}
@@ -0,0 +1,208 @@
+// Package router mounts the MarkHub HTTP API and frontend onto a Gin engine.
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/crash"
+	"github.com/CageChen/markhub/internal/handler"
+	"github.com/gin-gonic/gin"
+)
+
+// Prefix is the canonical mount point of the current API version
+const Prefix = "/api/" + handler.APIVersion
+
+// LegacyPrefix is the unversioned mount kept as a deprecated alias
+const LegacyPrefix = "/api"
+
+// BuildInfo describes the running binary for /api/version and /api/health
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// Handlers bundles the HTTP handlers mounted by the router
+type Handlers struct {
+	Tree       *handler.TreeHandler
+	File       *handler.FileHandler
+	WS         *handler.WSHandler
+	Settings   *handler.SettingsHandler
+	Search     *handler.SearchHandler
+	Static     *handler.StaticHandler
+	Admin      *handler.AdminHandler
+	URLs       *handler.URLsHandler
+	Export     *handler.ExportHandler
+	ImageProxy *handler.ImageProxyHandler
+	Locks      *handler.LockHandler
+	Webhooks   *handler.WebhookHandler
+	Analytics  *handler.AnalyticsHandler
+}
+
+// New creates a Gin engine with every API route mounted under both Prefix and LegacyPrefix
+func New(cfg *config.Config, h Handlers, build BuildInfo) *gin.Engine {
+	r := gin.New()
+	// Only trusted_proxies may set the client IP through X-Forwarded-For; Load validated the list
+	trusted, _ := cfg.TrustedProxyNets()
+	r.RemoteIPHeaders = []string{"X-Forwarded-For"}
+	if len(cfg.TrustedProxies) > 0 {
+		_ = r.SetTrustedProxies(cfg.TrustedProxies)
+	} else {
+		_ = r.SetTrustedProxies(nil)
+	}
+	r.Use(handler.Recovery())
+	r.Use(handler.RequestIDMiddleware())
+	r.Use(handler.ForwardedMiddleware(trusted))
+	r.Use(handler.SecurityHeaders(cfg))
+	r.Use(corsMiddleware())
+
+	authRequired := handler.AuthMiddleware(cfg)
+
+	register(r.Group(Prefix), cfg, h, build, authRequired)
+	// Clients of the unversioned API may still name folders by index in update/remove requests
+	register(r.Group(LegacyPrefix, deprecationMiddleware(), handler.AllowLegacyFolderIndex()), cfg, h, build, authRequired)
+
+	// Browsers request the favicon unprompted and without credentials
+	r.GET("/favicon.ico", h.Settings.GetFavicon)
+
+	// Serve embedded static files
+	r.NoRoute(authRequired, h.Static.Serve)
+
+	return r
+}
+
+// register mounts all API routes on the given group; handlers are prefix-agnostic
+func register(api *gin.RouterGroup, cfg *config.Config, h Handlers, build BuildInfo, authRequired gin.HandlerFunc) {
+	api.Use(handler.BodyLimitMiddleware(cfg.MaxRequestBody))
+
+	// Public endpoints (usable before authenticating)
+	api.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "version": build.Version, "panics": crash.Count()})
+	})
+	api.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"version":    build.Version,
+			"commit":     build.Commit,
+			"date":       build.Date,
+			"apiVersion": handler.APIVersion,
+		})
+	})
+	api.GET("/openapi.json", handler.GetOpenAPI)
+	api.GET("/capabilities", handler.GetCapabilities(cfg))
+	api.GET("/branding", h.Settings.GetBranding)
+	api.GET("/branding/logo", h.Settings.GetLogo)
+
+	authed := api.Group("", authRequired)
+	{
+		// The WebSocket is long-lived and exempt from the per-request deadline, as is the document
+		// manifest and folder archives, which stream whole corpora, and pandoc conversion, which has
+		// its own timeout
+		authed.GET("/ws", h.WS.HandleWS)
+		authed.GET("/manifest", h.Export.GetDocumentManifest)
+		authed.GET("/export/pandoc/*path", h.Export.GetPandoc)
+		authed.GET("/export/archive/*path", h.Export.GetArchive)
+
+		timed := authed.Group("", handler.TimeoutMiddleware(cfg.RequestTimeout))
+
+		// Tree and file APIs
+		timed.GET("/tree", h.Tree.GetTree)
+		timed.GET("/tree.md", h.Tree.GetTreeMarkdown)
+		timed.GET("/home", h.Tree.GetHome)
+		timed.GET("/home-doc", h.File.GetHomeDoc)
+		timed.GET("/tags", h.Tree.GetTags)
+		timed.GET("/tags/:tag", h.Tree.GetTagDocuments)
+		timed.GET("/graph", h.Tree.GetGraph)
+		timed.GET("/files/*path", h.File.GetFile)
+		timed.GET("/raw/*path", h.File.GetRaw)
+		timed.GET("/assets/*path", h.File.GetAsset)
+		timed.GET("/plain/*path", h.File.GetPlain)
+		timed.GET("/book", h.File.GetBook)
+		timed.GET("/search", h.Search.Search)
+		timed.GET("/search/status", h.Search.GetIndexStatus)
+		timed.GET("/find", h.Tree.Find)
+		timed.GET("/debug/exclude-trace", h.Tree.TraceExclude)
+		timed.GET("/quickopen", h.Search.QuickOpen)
+		timed.GET("/export-manifest", h.Export.GetManifest)
+		timed.GET("/export/outline", h.Export.GetOutline)
+		timed.GET("/print/*path", h.Export.GetPrint)
+		timed.GET("/img-proxy", h.ImageProxy.Proxy)
+
+		// Folder management APIs
+		timed.GET("/folders", h.Tree.GetFolders)
+		timed.GET("/settings", h.Settings.GetSettings)
+		timed.GET("/audit", h.Settings.GetAudit)
+		timed.GET("/urls", h.URLs.GetURLs)
+		timed.GET("/trash", h.File.ListTrash)
+		timed.GET("/git/log/*path", h.File.GetGitLog)
+		timed.GET("/blame/*path", h.File.GetBlame)
+		// The reports live outside /lint/, whose paths all start with a folder alias
+		timed.GET("/lint/*path", h.File.GetLint)
+		timed.GET("/lint-headings/*path", h.File.GetLintHeadings)
+		timed.GET("/lint-run/*path", h.File.GetLintRun)
+		timed.GET("/lint-report/headings", h.Export.GetHeadingReport)
+		timed.GET("/lint-report/orphans", h.Tree.GetOrphans)
+		timed.GET("/all-refs", h.Tree.GetAllRefs)
+		timed.GET("/locks/*path", h.Locks.GetLock)
+		timed.GET("/webhooks", h.Webhooks.GetStatus)
+		timed.GET("/analytics/*path", h.Analytics.GetAnalytics)
+
+		// State-changing APIs reject cross-site browser requests, require auth from non-loopback
+		// clients and are disabled in read-only mode
+		write := timed.Group("",
+			handler.RejectCrossSite(), handler.RequireWriteAuth(cfg), handler.ReadOnlyGuard(cfg.ReadOnly))
+		write.POST("/folders", h.Tree.AddFolder)
+		write.PUT("/folders", h.Tree.UpdateFolder)
+		write.DELETE("/folders", h.Tree.RemoveFolder)
+		write.PUT("/exclude", h.Tree.UpdateGlobalExclude)
+		write.PUT("/repo-exclude", h.Tree.UpdateRepoExclude)
+		write.PUT("/settings", h.Settings.UpdateSettings)
+		write.POST("/search/reindex", h.Search.Reindex)
+		// File writes and image uploads cap their bodies at max_write_body and assets.max_size
+		ownLimit := handler.ExemptBodyLimit()
+		write.POST("/files/*path", ownLimit, h.File.PostFile)
+		write.PUT("/files/*path", ownLimit, h.File.PutFile)
+		write.DELETE("/files/*path", h.File.DeleteFile)
+		write.POST("/dirs/*path", h.File.CreateDir)
+		write.POST("/trash/restore", h.File.RestoreTrash)
+		write.PUT("/raw/*path", ownLimit, h.File.PutRaw)
+		write.PATCH("/frontmatter/*path", h.File.PatchFrontMatter)
+		write.PATCH("/tasks/*path", h.File.PatchTask)
+		write.POST("/assets/*path", ownLimit, h.File.UploadAsset)
+		write.POST("/locks/*path", h.Locks.AcquireLock)
+		write.DELETE("/locks/*path", h.Locks.ReleaseLock)
+		write.DELETE("/analytics", h.Analytics.Purge)
+		write.DELETE("/cache/assets", h.File.PurgeAssetCache)
+		write.POST("/admin/shutdown", h.Admin.Shutdown)
+		write.POST("/admin/restart", h.Admin.Restart)
+	}
+}
+
+// deprecationMiddleware marks responses served under the legacy prefix and points at the successor URL
+func deprecationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := Prefix + strings.TrimPrefix(c.Request.URL.Path, LegacyPrefix)
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
+
+func corsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers",
+			"Content-Type, Authorization, If-Match, "+handler.RequestIDHeader+", "+handler.ClientIDHeader)
+		c.Header("Access-Control-Expose-Headers", "ETag, "+handler.RequestIDHeader+", "+
+			handler.AutoCommitHeader+", "+handler.AutoCommitErrorHeader)
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,402 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/handler"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter serves a temporary folder containing a single markdown document
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newTestRouterWith(t, config.DefaultConfig(), nil)
+}
+
+// newTestRouterWith is newTestRouter with a custom base config and admin stop callback
+func newTestRouterWith(t *testing.T, cfg *config.Config, stop func(restart bool)) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "guide.md"), []byte("# Guide\n\nHello.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Folders = []config.Folder{{Path: dir, Alias: "docs"}}
+
+	tree := handler.NewTreeHandler(cfg)
+	files := handler.NewFileHandler(cfg)
+	ws := handler.NewWSHandler()
+	ws.SetRenderer(files.Render)
+	locks := handler.NewLockHandler(files, ws)
+	files.SetLockConflict(locks.Conflict)
+	assets := fstest.MapFS{"index.html": {Data: []byte("<html><title>x</title></html>")}}
+	return New(cfg, Handlers{
+		Tree:       tree,
+		File:       files,
+		WS:         ws,
+		Settings:   handler.NewSettingsHandler(cfg, ws),
+		Search:     handler.NewSearchHandler(cfg, tree),
+		Static:     handler.NewStaticHandler(cfg, assets),
+		Admin:      handler.NewAdminHandler(stop),
+		URLs:       handler.NewURLsHandler([]string{"http://192.0.2.1:8080"}),
+		Export:     handler.NewExportHandler(cfg, tree, files),
+		ImageProxy: handler.NewImageProxyHandler(cfg),
+		Locks:      locks,
+		Webhooks:   handler.NewWebhookHandler(cfg),
+		Analytics:  handler.NewAnalyticsHandler(cfg),
+	}, BuildInfo{Version: "test"})
+}
+
+func post(r http.Handler, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestVersionedAndLegacyPrefixesMatch(t *testing.T) {
+	r := newTestRouter(t)
+
+	paths := []string{"/tree", "/files/docs/guide.md", "/raw/docs/guide.md", "/folders", "/find?q=gd", "/urls"}
+	for _, path := range paths {
+		v1 := get(r, Prefix+path)
+		legacy := get(r, LegacyPrefix+path)
+
+		if v1.Code != http.StatusOK {
+			t.Errorf("%s%s: expected 200, got %d", Prefix, path, v1.Code)
+		}
+		if v1.Code != legacy.Code || v1.Body.String() != legacy.Body.String() {
+			t.Errorf("%s: versioned and legacy responses differ\nv1: %d %s\nlegacy: %d %s",
+				path, v1.Code, v1.Body.String(), legacy.Code, legacy.Body.String())
+		}
+		if v1.Header().Get("Deprecation") != "" {
+			t.Errorf("%s%s: unexpected Deprecation header", Prefix, path)
+		}
+		if legacy.Header().Get("Deprecation") != "true" {
+			t.Errorf("%s%s: expected Deprecation header", LegacyPrefix, path)
+		}
+	}
+}
+
+func TestLegacyPrefixLinksToSuccessor(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := get(r, "/api/tree")
+	if got, want := w.Header().Get("Link"), `</api/v1/tree>; rel="successor-version"`; got != want {
+		t.Errorf("expected Link %q, got %q", want, got)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	r := newTestRouter(t)
+
+	w := get(r, Prefix+"/version")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["apiVersion"] != handler.APIVersion || body["version"] != "test" {
+		t.Errorf("unexpected version payload: %v", body)
+	}
+}
+
+// ginParam matches gin's :name and *name path parameters
+var ginParam = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+
+// dispatchedOperations maps documented operations that gin cannot register next to a catch-all
+// route to that route, whose handler dispatches them
+var dispatchedOperations = map[string]string{
+	"POST /files/move":   "POST /files/{path}",
+	"GET /analytics/top": "GET /analytics/{path}",
+}
+
+// streamedOperations are authenticated routes that stream their response, or bound their own
+// run time, and so are exempt from TimeoutMiddleware, like WebSocket upgrades
+var streamedOperations = map[string]bool{
+	"GET /manifest":              true,
+	"GET /export/pandoc/{path}":  true,
+	"GET /export/archive/{path}": true,
+}
+
+// specOperation is the part of an OpenAPI operation the coverage tests inspect
+type specOperation struct {
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+// specOperations returns the operations documented in the OpenAPI spec, keyed by "METHOD /path"
+func specOperations(t *testing.T) map[string]specOperation {
+	t.Helper()
+	var spec struct {
+		Paths map[string]map[string]specOperation `json:"paths"`
+	}
+	if err := json.Unmarshal(handler.OpenAPISpec(), &spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	ops := make(map[string]specOperation)
+	for path, item := range spec.Paths {
+		for method, op := range item {
+			ops[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+	return ops
+}
+
+func TestOpenAPICoversAllRoutes(t *testing.T) {
+	r := newTestRouter(t)
+	documented := specOperations(t)
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, Prefix+"/") {
+			continue
+		}
+		path := ginParam.ReplaceAllString(strings.TrimPrefix(route.Path, Prefix), "{$1}")
+		op := route.Method + " " + path
+		registered[op] = true
+		if _, ok := documented[op]; !ok {
+			t.Errorf("route %s is not documented in internal/handler/openapi.json", op)
+		}
+	}
+	for op := range documented {
+		if !registered[op] && !registered[dispatchedOperations[op]] {
+			t.Errorf("OpenAPI operation %s has no registered route", op)
+		}
+	}
+}
+
+// TestOpenAPIDocumentsMiddlewareResponses probes every route as an unauthenticated remote client:
+// routes behind AuthMiddleware must document its 401, and all of them except WebSocket upgrades
+// (documented with 101) and streamedOperations also run under TimeoutMiddleware and must document
+// its 504.
+func TestOpenAPIDocumentsMiddlewareResponses(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AuthToken = "secret"
+	r := newTestRouterWith(t, cfg, nil)
+	documented := specOperations(t)
+
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, Prefix+"/") {
+			continue
+		}
+		name := route.Method + " " + ginParam.ReplaceAllString(strings.TrimPrefix(route.Path, Prefix), "{$1}")
+		op, ok := documented[name]
+		if !ok {
+			continue // reported by TestOpenAPICoversAllRoutes
+		}
+		req := httptest.NewRequest(route.Method, ginParam.ReplaceAllString(route.Path, "x"), nil)
+		req.RemoteAddr = "192.0.2.10:50000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		_, has401 := op.Responses["401"]
+		_, has504 := op.Responses["504"]
+		_, upgrade := op.Responses["101"]
+		authed := w.Code == http.StatusUnauthorized
+		if authed != has401 {
+			t.Errorf("%s %s: authenticated=%v but 401 documented=%v", route.Method, route.Path, authed, has401)
+		}
+		if wantTimeout := authed && !upgrade && !streamedOperations[name]; wantTimeout != has504 {
+			t.Errorf("%s %s: expected 504 documented=%v, got %v", route.Method, route.Path, wantTimeout, has504)
+		}
+	}
+}
+
+func TestOpenAPIServedOnBothPrefixes(t *testing.T) {
+	r := newTestRouter(t)
+
+	for _, path := range []string{Prefix + "/openapi.json", LegacyPrefix + "/openapi.json"} {
+		w := get(r, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, w.Code)
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", path, err)
+		}
+		if doc["openapi"] == nil {
+			t.Errorf("%s: missing openapi version field", path)
+		}
+	}
+}
+
+func TestAdminRestartFromLoopback(t *testing.T) {
+	var calls []bool
+	r := newTestRouterWith(t, config.DefaultConfig(), func(restart bool) { calls = append(calls, restart) })
+
+	w := post(r, Prefix+"/admin/restart", "127.0.0.1:50000")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(calls) != 1 || !calls[0] {
+		t.Fatalf("expected one restart request, got %v", calls)
+	}
+
+	// Only the first lifecycle request takes effect
+	post(r, Prefix+"/admin/shutdown", "[::1]:50000")
+	if len(calls) != 1 {
+		t.Errorf("expected the stop callback to run once, got %v", calls)
+	}
+}
+
+func TestAdminRejectsRemoteAndReadOnly(t *testing.T) {
+	var calls int
+	stop := func(bool) { calls++ }
+
+	r := newTestRouterWith(t, config.DefaultConfig(), stop)
+	if w := post(r, Prefix+"/admin/shutdown", "192.168.1.20:50000"); w.Code != http.StatusForbidden {
+		t.Errorf("remote client: expected 403, got %d", w.Code)
+	}
+
+	// A page on another site posting through a local browser is still a loopback client
+	req := httptest.NewRequest(http.MethodPost, Prefix+"/admin/shutdown", nil)
+	req.RemoteAddr = "127.0.0.1:50000"
+	req.Header.Set("Origin", "https://evil.example")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("cross-site request: expected 403, got %d", w.Code)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.ReadOnly = true
+	r = newTestRouterWith(t, cfg, stop)
+	for _, path := range []string{"/admin/shutdown", "/admin/restart"} {
+		if w := post(r, Prefix+path, "127.0.0.1:50000"); w.Code != http.StatusForbidden {
+			t.Errorf("read-only %s: expected 403, got %d", path, w.Code)
+		}
+	}
+
+	if calls != 0 {
+		t.Errorf("expected no shutdown, got %d calls", calls)
+	}
+}
+
+func TestLegacyPrefixAcceptsFolderIndex(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Ephemeral = true
+	r := newTestRouterWith(t, cfg, nil)
+	cfg.Folders[0].ID = "docs"
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "127.0.0.1:50000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(http.MethodPut, Prefix+"/folders", `{"index":0,"alias":"v1"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("versioned prefix: expected index to be rejected with 400, got %d", w.Code)
+	}
+	if w := send(http.MethodPut, LegacyPrefix+"/folders", `{"index":5,"alias":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("legacy prefix, index out of range: expected 404, got %d", w.Code)
+	}
+	if w := send(http.MethodPut, LegacyPrefix+"/folders", `{"index":0,"alias":"renamed"}`); w.Code != http.StatusOK {
+		t.Fatalf("legacy prefix update by index: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if f, _ := cfg.FolderByID("docs"); f.Alias != "renamed" {
+		t.Errorf("expected folder docs to be renamed, got %+v", f)
+	}
+	if w := send(http.MethodDelete, LegacyPrefix+"/folders", `{"index":0}`); w.Code != http.StatusOK {
+		t.Fatalf("legacy prefix remove by index: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(cfg.FoldersSnapshot()) != 0 {
+		t.Errorf("expected the folder to be removed, got %+v", cfg.FoldersSnapshot())
+	}
+}
+
+func TestLintReportsLeaveAliasesAlone(t *testing.T) {
+	cfg := config.DefaultConfig()
+	r := newTestRouterWith(t, cfg, nil)
+	for _, alias := range []string{"orphans", "headings", "run"} {
+		cfg.Folders[0].Alias = alias
+		w := get(r, Prefix+"/lint/"+alias+"/guide.md")
+		var resp handler.LintResponse
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.Path != alias+"/guide.md" {
+			t.Errorf("folder %q: expected its document linted, got %d %s", alias, w.Code, w.Body.String())
+		}
+	}
+	for path, code := range map[string]int{
+		"/lint-report/orphans":        http.StatusOK,
+		"/lint-report/headings":       http.StatusOK,
+		"/lint-headings/run/guide.md": http.StatusOK,
+		"/lint-run/run/guide.md":      http.StatusBadRequest, // no ?tool=
+	} {
+		if w := get(r, Prefix+path); w.Code != code {
+			t.Errorf("%s: expected %d, got %d %s", path, code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestURLsEndpoint(t *testing.T) {
+	w := get(newTestRouter(t), Prefix+"/urls")
+	if w.Code != http.StatusOK || w.Body.String() != `{"urls":["http://192.0.2.1:8080"]}` {
+		t.Errorf("unexpected /urls response: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r := gin.New()
+	r.GET("/urls", handler.NewURLsHandler(nil).GetURLs)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/urls", nil))
+	if w.Body.String() != `{"urls":[]}` {
+		t.Errorf("expected an empty list when bound to loopback, got %s", w.Body.String())
+	}
+}
+
+func TestSecurityHeadersOnAPIAndSPA(t *testing.T) {
+	r := newTestRouter(t)
+	for _, path := range []string{"/", "/api/v1/health", "/api/v1/tree"} {
+		w := get(r, path)
+		if w.Header().Get("Content-Security-Policy") == "" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: expected security headers, got %v", path, w.Header())
+		}
+	}
+}
+
+func TestTrustedLocalProxyDoesNotMakeClientsLocal(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AuthToken = "secret"
+	cfg.TrustedProxies = []string{"127.0.0.1"}
+	r := newTestRouterWith(t, cfg, nil)
+
+	request := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, Prefix+"/tree", nil)
+		req.RemoteAddr = "127.0.0.1:50000"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := request("203.0.113.7"); code != http.StatusUnauthorized {
+		t.Errorf("expected a proxied remote client to need the token, got %d", code)
+	}
+	if code := request(""); code != http.StatusOK {
+		t.Errorf("expected a direct local client to be let in, got %d", code)
+	}
+}
@@ -0,0 +1,315 @@
+// Package search keeps trigram indexes of markdown folders. An index cannot answer a query on its
+// own: it narrows a case-insensitive substring search down to the documents that may match, which
+// the caller then reads and checks.
+package search
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formatVersion is bumped whenever the saved format or the trigram scheme changes
+const formatVersion = 2
+
+// compactAfter is how many removed documents an index keeps in its postings before compacting
+const compactAfter = 1024
+
+// ErrFormat is returned by Load for files written by another version of the index
+var ErrFormat = errors.New("search index has an unsupported format")
+
+// Doc is an indexed document: its path relative to the folder's root, the modification time and
+// size it had when indexed, which tell whether the index still matches the file, and its title and
+// headings, which title and heading searches match without reading the file
+type Doc struct {
+	Path     string
+	ModTime  time.Time
+	Size     int64
+	Title    string
+	Headings []Heading
+}
+
+// Heading is a heading of an indexed document, with the anchor it is rendered with
+type Heading struct {
+	Level  int
+	Text   string
+	Anchor string
+}
+
+// Index is the trigram index of one folder. It is safe for concurrent use.
+type Index struct {
+	mu      sync.RWMutex
+	ref     string
+	builtAt time.Time
+	// docs is indexed by document ID; removed documents keep their slot with an empty Path
+	docs     []Doc
+	ids      map[string]uint32
+	postings map[uint32][]uint32
+	removed  int
+}
+
+// snapshot is the saved form of an Index
+type snapshot struct {
+	Version  int
+	Ref      string
+	BuiltAt  time.Time
+	Docs     []Doc
+	Postings map[uint32][]uint32
+}
+
+// New returns an empty index, built now. ref names what was indexed, such as the commit of a
+// git_ref folder; it is empty for local folders.
+func New(ref string) *Index {
+	return &Index{
+		ref:      ref,
+		builtAt:  time.Now().UTC(),
+		ids:      map[string]uint32{},
+		postings: map[uint32][]uint32{},
+	}
+}
+
+// Ref returns what the index was built from, as passed to New
+func (x *Index) Ref() string {
+	return x.ref
+}
+
+// BuiltAt returns when the index was created
+func (x *Index) BuiltAt() time.Time {
+	return x.builtAt
+}
+
+// Len returns the number of indexed documents
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ids)
+}
+
+// Lookup returns the indexed document at path
+func (x *Index) Lookup(path string) (Doc, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	id, ok := x.ids[path]
+	if !ok {
+		return Doc{}, false
+	}
+	return x.docs[id], true
+}
+
+// Paths returns the paths of the indexed documents
+func (x *Index) Paths() []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	paths := make([]string, 0, len(x.ids))
+	for path := range x.ids {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// Add indexes content as doc, replacing what was indexed at doc.Path before
+func (x *Index) Add(doc Doc, content []byte) {
+	grams := trigrams(bytes.ToLower(content))
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(doc.Path)
+	id := uint32(len(x.docs))
+	x.docs = append(x.docs, doc)
+	x.ids[doc.Path] = id
+	for g := range grams {
+		// IDs only grow, so posting lists stay sorted
+		x.postings[g] = append(x.postings[g], id)
+	}
+}
+
+// Remove drops the document at path, and every document below it when path is a directory
+func (x *Index) Remove(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(path)
+	prefix := path + "/"
+	for p := range x.ids {
+		if strings.HasPrefix(p, prefix) {
+			x.remove(p)
+		}
+	}
+	if x.removed > compactAfter && x.removed*2 > len(x.docs) {
+		x.compact()
+	}
+}
+
+func (x *Index) remove(path string) {
+	id, ok := x.ids[path]
+	if !ok {
+		return
+	}
+	delete(x.ids, path)
+	x.docs[id] = Doc{}
+	x.removed++
+}
+
+// compact drops removed documents from docs and the postings, renumbering the others in order
+func (x *Index) compact() {
+	newID := make([]uint32, len(x.docs))
+	docs := make([]Doc, 0, len(x.ids))
+	for id, doc := range x.docs {
+		if doc.Path == "" {
+			continue
+		}
+		newID[id] = uint32(len(docs))
+		x.ids[doc.Path] = newID[id]
+		docs = append(docs, doc)
+	}
+	for g, list := range x.postings {
+		kept := list[:0]
+		for _, id := range list {
+			if x.docs[id].Path != "" {
+				kept = append(kept, newID[id])
+			}
+		}
+		if len(kept) == 0 {
+			delete(x.postings, g)
+		} else {
+			x.postings[g] = kept
+		}
+	}
+	x.docs = docs
+	x.removed = 0
+}
+
+// Candidates returns the paths of the documents that may contain query, compared case-insensitively
+// as bytes.ToLower does. A query shorter than three bytes cannot be narrowed down: it returns
+// false, and every document is a candidate.
+func (x *Index) Candidates(query string) (map[string]bool, bool) {
+	grams := trigrams([]byte(strings.ToLower(query)))
+	if len(grams) == 0 {
+		return nil, false
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	lists := make([][]uint32, 0, len(grams))
+	for g := range grams {
+		list, ok := x.postings[g]
+		if !ok {
+			return map[string]bool{}, true
+		}
+		lists = append(lists, list)
+	}
+	// Intersect from the shortest list, so the result only shrinks
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	ids := lists[0]
+	for _, list := range lists[1:] {
+		ids = intersect(ids, list)
+	}
+	candidates := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if path := x.docs[id].Path; path != "" {
+			candidates[path] = true
+		}
+	}
+	return candidates, true
+}
+
+// intersect returns the IDs in both sorted lists
+func intersect(a, b []uint32) []uint32 {
+	var out []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+// trigrams returns the distinct three-byte sequences of text
+func trigrams(text []byte) map[uint32]struct{} {
+	grams := make(map[uint32]struct{})
+	for i := 0; i+3 <= len(text); i++ {
+		grams[uint32(text[i])<<16|uint32(text[i+1])<<8|uint32(text[i+2])] = struct{}{}
+	}
+	return grams
+}
+
+// Save writes the index to path, replacing the file atomically
+func (x *Index) Save(path string) error {
+	x.mu.RLock()
+	snap := snapshot{
+		Version:  formatVersion,
+		Ref:      x.ref,
+		BuiltAt:  x.builtAt,
+		Docs:     x.docs,
+		Postings: x.postings,
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(snap)
+	x.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads an index written by Save
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var snap snapshot
+	if err := gob.NewDecoder(f).Decode(&snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != formatVersion {
+		return nil, ErrFormat
+	}
+	x := &Index{
+		ref:      snap.Ref,
+		builtAt:  snap.BuiltAt,
+		docs:     snap.Docs,
+		ids:      make(map[string]uint32, len(snap.Docs)),
+		postings: snap.Postings,
+	}
+	if x.postings == nil {
+		x.postings = map[uint32][]uint32{}
+	}
+	for id, doc := range x.docs {
+		if doc.Path == "" {
+			x.removed++
+			continue
+		}
+		x.ids[doc.Path] = uint32(id)
+	}
+	return x, nil
+}
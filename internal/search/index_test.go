@@ -0,0 +1,102 @@
+package search
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func candidatePaths(t *testing.T, x *Index, query string) []string {
+	t.Helper()
+	candidates, ok := x.Candidates(query)
+	if !ok {
+		t.Fatalf("expected %q to be narrowed down", query)
+	}
+	paths := []string{}
+	for path := range candidates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestCandidates(t *testing.T) {
+	x := New("")
+	x.Add(Doc{Path: "guide.md"}, []byte("# Guide\n\nInstall the SERVER first.\n"))
+	x.Add(Doc{Path: "notes/a.md"}, []byte("server notes"))
+	x.Add(Doc{Path: "notes/b.md"}, []byte("nothing here"))
+
+	if got, want := candidatePaths(t, x, "Server"), []string{"guide.md", "notes/a.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := candidatePaths(t, x, "absent"); len(got) != 0 {
+		t.Errorf("expected no candidates, got %v", got)
+	}
+	if _, ok := x.Candidates("se"); ok {
+		t.Error("expected a two-byte query not to be narrowed down")
+	}
+
+	// Re-adding replaces the old content
+	x.Add(Doc{Path: "notes/a.md"}, []byte("client notes"))
+	if got, want := candidatePaths(t, x, "server"), []string{"guide.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v after the update, got %v", want, got)
+	}
+
+	x.Remove("notes")
+	if x.Len() != 1 {
+		t.Errorf("expected removing the directory to drop its documents, %d left", x.Len())
+	}
+	if _, ok := x.Lookup("notes/b.md"); ok {
+		t.Error("expected notes/b.md to be removed")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	x := New("")
+	for i := 0; i < compactAfter*2+10; i++ {
+		x.Add(Doc{Path: "doc.md"}, []byte("rewritten again"))
+	}
+	x.Add(Doc{Path: "other.md"}, []byte("another document"))
+	x.Remove("missing.md")
+	if x.removed != 0 || len(x.docs) != 2 {
+		t.Fatalf("expected the removed documents to be compacted, %d docs with %d removed", len(x.docs), x.removed)
+	}
+	if got, want := candidatePaths(t, x, "again"), []string{"doc.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got, want := candidatePaths(t, x, "another"), []string{"other.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search", "docs.idx")
+	modTime := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	x := New("abc123")
+	x.Add(Doc{Path: "guide.md", ModTime: modTime, Size: 30}, []byte("a guide to markhub"))
+	x.Add(Doc{Path: "old.md"}, []byte("a guide from before"))
+	x.Remove("old.md")
+	if err := x.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Ref() != "abc123" || !loaded.BuiltAt().Equal(x.BuiltAt()) || loaded.Len() != 1 {
+		t.Errorf("unexpected loaded index: ref %q, built %v, %d docs", loaded.Ref(), loaded.BuiltAt(), loaded.Len())
+	}
+	if doc, ok := loaded.Lookup("guide.md"); !ok || !doc.ModTime.Equal(modTime) || doc.Size != 30 {
+		t.Errorf("unexpected document %+v", doc)
+	}
+	if got, want := candidatePaths(t, loaded, "guide"), []string{"guide.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.idx")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
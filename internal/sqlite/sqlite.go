@@ -0,0 +1,244 @@
+// Package sqlite writes SQLite database files holding simple tables, for exports read by other
+// tools (e.g. the search index of a Dash docset). It writes whole databases at once and cannot
+// read or update them; indexes, and rows larger than a page, are not supported.
+package sqlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	pageSize = 4096
+	// headerSize is the size of the database header at the start of page 1
+	headerSize = 100
+	// maxLocalPayload is the largest record a table leaf holds without overflow pages
+	maxLocalPayload = pageSize - 35
+	// sqliteVersion is the SQLite version number recorded as having written the file
+	sqliteVersion = 3040001
+
+	pageTableLeaf     = 0x0d
+	pageTableInterior = 0x05
+)
+
+// ErrRowTooLarge is returned for a row whose record does not fit in a page
+var ErrRowTooLarge = errors.New("row too large")
+
+// Table is a table to write, with its CREATE TABLE statement. Rows are numbered from 1 in order;
+// a first column declared INTEGER PRIMARY KEY is that number, and rows hold nil for it. Values
+// are nil, strings, or integers of type int or int64.
+type Table struct {
+	Name string
+	SQL  string
+	Rows [][]any
+}
+
+// Write writes a database holding tables to path, replacing any file there
+func Write(path string, tables ...Table) error {
+	data, err := build(tables)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// build returns the database file holding tables. Page 1 holds the schema; the pages of each
+// table follow, leaves first, so its root is its last page.
+func build(tables []Table) ([]byte, error) {
+	pages := [][]byte{nil}
+	var schema [][]byte
+	for i, table := range tables {
+		var cells [][]byte
+		for j, row := range table.Rows {
+			cell, err := tableCell(int64(j+1), row)
+			if err != nil {
+				return nil, fmt.Errorf("table %s, row %d: %w", table.Name, j+1, err)
+			}
+			cells = append(cells, cell)
+		}
+		var root int
+		pages, root = appendTree(pages, cells)
+		cell, err := tableCell(int64(i+1), []any{"table", table.Name, table.Name, root, table.SQL})
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		schema = append(schema, cell)
+	}
+	first, rest := packLeaves(schema, headerSize)
+	if len(rest) > 0 {
+		return nil, errors.New("too many tables for one schema page")
+	}
+	pages[0] = first
+
+	out := make([]byte, 0, len(pages)*pageSize)
+	for _, page := range pages {
+		out = append(out, page...)
+	}
+	writeHeader(out, len(pages))
+	return out, nil
+}
+
+// writeHeader fills the database header of a file of n pages
+func writeHeader(file []byte, n int) {
+	h := file[:headerSize]
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], pageSize)
+	h[18], h[19] = 1, 1                   // legacy read and write file formats
+	h[21], h[22], h[23] = 64, 32, 32      // payload fractions, fixed by the format
+	binary.BigEndian.PutUint32(h[24:], 1) // file change counter
+	binary.BigEndian.PutUint32(h[28:], uint32(n))
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1) // version-valid-for, the change counter
+	binary.BigEndian.PutUint32(h[96:], sqliteVersion)
+}
+
+// appendTree appends the pages of a table b-tree holding cells, ordered by rowid, to pages and
+// returns them with the root's page number
+func appendTree(pages [][]byte, cells [][]byte) ([][]byte, int) {
+	type child struct {
+		page     int
+		maxRowID int64
+	}
+	// Rows are numbered from 1, so the largest rowid of a leaf is the number of cells packed so far
+	var level []child
+	for done := 0; done < len(cells) || len(level) == 0; {
+		page, rest := packLeaves(cells[done:], 0)
+		done = len(cells) - len(rest)
+		pages = append(pages, page)
+		level = append(level, child{len(pages), int64(done)})
+	}
+	for len(level) > 1 {
+		var next []child
+		for len(level) > 0 {
+			// Each interior cell points at a child and the largest rowid under it; the last child
+			// of a page is its right-most pointer
+			page := make([]byte, pageSize)
+			page[0] = pageTableInterior
+			content, n := pageSize, 0
+			for len(level) > 1 {
+				cell := binary.BigEndian.AppendUint32(nil, uint32(level[0].page))
+				cell = appendVarint(cell, uint64(level[0].maxRowID))
+				if 12+2*(n+1) > content-len(cell) {
+					break
+				}
+				content -= len(cell)
+				copy(page[content:], cell)
+				binary.BigEndian.PutUint16(page[12+2*n:], uint16(content))
+				n++
+				level = level[1:]
+			}
+			binary.BigEndian.PutUint16(page[3:], uint16(n))
+			binary.BigEndian.PutUint16(page[5:], uint16(content))
+			binary.BigEndian.PutUint32(page[8:], uint32(level[0].page))
+			pages = append(pages, page)
+			next = append(next, child{len(pages), level[0].maxRowID})
+			level = level[1:]
+		}
+		level = next
+	}
+	return pages, level[0].page
+}
+
+// packLeaves fills a table leaf page, whose header starts at offset, with the first of cells and
+// returns it with the cells that did not fit
+func packLeaves(cells [][]byte, offset int) ([]byte, [][]byte) {
+	page := make([]byte, pageSize)
+	page[offset] = pageTableLeaf
+	content, n := pageSize, 0
+	for ; n < len(cells); n++ {
+		if offset+8+2*(n+1) > content-len(cells[n]) {
+			break
+		}
+		content -= len(cells[n])
+		copy(page[content:], cells[n])
+		binary.BigEndian.PutUint16(page[offset+8+2*n:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(n))
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+	return page, cells[n:]
+}
+
+// tableCell returns the table leaf cell of a row: its record's size, its rowid and the record
+func tableCell(rowID int64, values []any) ([]byte, error) {
+	var header, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			header = appendVarint(header, 0)
+		case int:
+			header, body = appendInt(header, body, int64(v))
+		case int64:
+			header, body = appendInt(header, body, v)
+		case string:
+			header = appendVarint(header, uint64(2*len(v)+13))
+			body = append(body, v...)
+		default:
+			return nil, fmt.Errorf("unsupported value type %T", v)
+		}
+	}
+	// The header's size counts itself
+	size := len(header) + 1
+	if size > 0x7f {
+		size++
+	}
+	record := append(appendVarint(nil, uint64(size)), header...)
+	record = append(record, body...)
+	if len(record) > maxLocalPayload {
+		return nil, ErrRowTooLarge
+	}
+	cell := appendVarint(nil, uint64(len(record)))
+	cell = appendVarint(cell, uint64(rowID))
+	return append(cell, record...), nil
+}
+
+// appendInt appends the serial type of v to header and its big-endian bytes to body, in the
+// smallest size that holds it
+func appendInt(header, body []byte, v int64) ([]byte, []byte) {
+	switch {
+	case v == 0:
+		return appendVarint(header, 8), body
+	case v == 1:
+		return appendVarint(header, 9), body
+	}
+	for _, s := range []struct {
+		serialType uint64
+		bytes      int
+	}{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 6}, {6, 8}} {
+		limit := int64(1) << (8*s.bytes - 1)
+		if s.bytes == 8 || (v >= -limit && v < limit) {
+			header = appendVarint(header, s.serialType)
+			for i := s.bytes - 1; i >= 0; i-- {
+				body = append(body, byte(v>>(8*i)))
+			}
+			break
+		}
+	}
+	return header, body
+}
+
+// appendVarint appends v as an SQLite varint: big-endian groups of 7 bits, each but the last with
+// the high bit set, where a ninth byte carries 8 bits
+func appendVarint(buf []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var b [9]byte
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(buf, b[:]...)
+	}
+	var b [8]byte
+	i := len(b) - 1
+	b[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		b[i] = byte(v&0x7f) | 0x80
+	}
+	return append(buf, b[i:]...)
+}
@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendVarint(t *testing.T) {
+	for _, tt := range []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x00}},
+		{300, []byte{0x82, 0x2c}},
+		{1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{1 << 63, []byte{0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}},
+	} {
+		if got := appendVarint(nil, tt.v); !bytes.Equal(got, tt.want) {
+			t.Errorf("%d: expected % x, got % x", tt.v, tt.want, got)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	// Enough rows for leaves under more than one level of interior pages
+	var rows [][]any
+	for i := 0; i < 50000; i++ {
+		rows = append(rows, []any{nil, fmt.Sprintf("entry %d", i), strings.Repeat("é", i%200), i - 25000, nil})
+	}
+	path := filepath.Join(t.TempDir(), "test.db")
+	err := Write(path,
+		Table{Name: "entries", SQL: "CREATE TABLE entries(id INTEGER PRIMARY KEY, name TEXT, pad TEXT, n INTEGER, x)",
+			Rows: rows},
+		Table{Name: "empty", SQL: "CREATE TABLE empty(a TEXT)"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := Table{Name: "big", SQL: "CREATE TABLE big(a)", Rows: [][]any{{strings.Repeat("x", pageSize)}}}
+	if err := Write(path, big); !errors.Is(err, ErrRowTooLarge) {
+		t.Errorf("expected ErrRowTooLarge, got %v", err)
+	}
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	out, err := exec.Command("sqlite3", path, "PRAGMA integrity_check",
+		"SELECT count(*), sum(n), max(id) FROM entries",
+		"SELECT name, length(pad), n, x IS NULL FROM entries WHERE id = 40001",
+		"SELECT count(*) FROM empty").CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3 failed: %v\n%s", err, out)
+	}
+	if want := "ok\n50000|-25000|50000\nentry 40000|0|15000|1\n0\n"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
@@ -0,0 +1,87 @@
+// Package timestamp encodes the times of API responses the same way everywhere: RFC 3339 in UTC,
+// null for the zero time (e.g. a git folder whose log could not be read), and as phrases such as
+// "3 days ago" for clients asking for humanized times.
+package timestamp
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Time is a time.Time encoded in JSON as an RFC 3339 string in UTC, with sub-second digits only
+// when it has them, or as null when it is zero
+type Time struct {
+	time.Time
+}
+
+// New wraps t
+func New(t time.Time) Time {
+	return Time{t}
+}
+
+// Ptr wraps t and returns a pointer to it, for optional fields
+func Ptr(t time.Time) *Time {
+	return &Time{t}
+}
+
+// MarshalJSON implements json.Marshaler
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(`"` + t.UTC().Format(time.RFC3339Nano) + `"`), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading null as the zero time
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+	return t.Time.UnmarshalJSON(data)
+}
+
+// Parse reads a time as MarshalJSON writes it, without the quotes
+func Parse(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// Humanize describes t relative to now in English: "just now", "5 minutes ago", "yesterday",
+// "in 2 hours"... Each unit is rounded down.
+func Humanize(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var n int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int(d/(24*time.Hour)), "day"
+		if n == 1 {
+			if future {
+				return "tomorrow"
+			}
+			return "yesterday"
+		}
+	case d < 365*24*time.Hour:
+		n, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %s ago", n, unit)
+}
@@ -0,0 +1,66 @@
+package timestamp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	paris := time.FixedZone("CET", 3600)
+	for _, tt := range []struct {
+		in   any
+		want string
+	}{
+		{New(time.Date(2026, 3, 1, 13, 4, 5, 0, paris)), `"2026-03-01T12:04:05Z"`},
+		{New(time.Date(2026, 3, 1, 12, 4, 5, 250_000_000, time.UTC)), `"2026-03-01T12:04:05.25Z"`},
+		{New(time.Time{}), `null`},
+		{struct {
+			A *Time `json:"a,omitempty"`
+			B Time  `json:"b,omitzero"`
+		}{}, `{}`},
+		{struct {
+			A *Time `json:"a"`
+		}{Ptr(time.Unix(0, 0))}, `{"a":"1970-01-01T00:00:00Z"}`},
+	} {
+		got, err := json.Marshal(tt.in)
+		if err != nil || string(got) != tt.want {
+			t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var v struct {
+		A Time `json:"a"`
+		B Time `json:"b"`
+	}
+	if err := json.Unmarshal([]byte(`{"a":"2026-03-01T13:04:05+01:00","b":null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !v.A.Equal(time.Date(2026, 3, 1, 12, 4, 5, 0, time.UTC)) || !v.B.IsZero() {
+		t.Errorf("unexpected %+v", v)
+	}
+}
+
+func TestHumanize(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for d, want := range map[time.Duration]string{
+		10 * time.Second:     "just now",
+		-10 * time.Second:    "just now",
+		time.Minute:          "1 minute ago",
+		59 * time.Minute:     "59 minutes ago",
+		3 * time.Hour:        "3 hours ago",
+		-3 * time.Hour:       "in 3 hours",
+		30 * time.Hour:       "yesterday",
+		-30 * time.Hour:      "tomorrow",
+		3 * 24 * time.Hour:   "3 days ago",
+		45 * 24 * time.Hour:  "1 month ago",
+		200 * 24 * time.Hour: "6 months ago",
+		800 * 24 * time.Hour: "2 years ago",
+	} {
+		if got := Humanize(now.Add(-d), now); got != want {
+			t.Errorf("%v: expected %q, got %q", d, want, got)
+		}
+	}
+}
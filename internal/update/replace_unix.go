@@ -0,0 +1,10 @@
+//go:build !windows
+
+package update
+
+import "os"
+
+// replaceExecutable renames newPath over path; running processes keep the old inode.
+func replaceExecutable(newPath, path string) error {
+	return os.Rename(newPath, path)
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package update
+
+import "os"
+
+// replaceExecutable swaps newPath in for path. Windows cannot overwrite a running
+// executable but can rename it, so the current binary is moved aside first (and
+// removed by RemoveStale on a later run); if the swap fails it is moved back.
+func replaceExecutable(newPath, path string) error {
+	old := stalePath(path)
+	_ = os.Remove(old)
+	if err := os.Rename(path, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newPath, path); err != nil {
+		_ = os.Rename(old, path)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+// Package update checks a releases endpoint for a newer MarkHub build and replaces the
+// running binary with it.
+package update
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// DefaultReleasesURL is the GitHub API endpoint describing the latest release
+const DefaultReleasesURL = "https://api.github.com/repos/CageChen/markhub/releases/latest"
+
+// checksumsAsset is the goreleaser checksum file published with every release
+const checksumsAsset = "checksums.txt"
+
+// maxDownloadSize bounds any single download (archives are a few MB)
+const maxDownloadSize = 256 << 20
+
+// ErrNoAsset is returned when a release has no archive for this OS/architecture
+var ErrNoAsset = errors.New("no release asset for this platform")
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Release describes a published release in the GitHub releases API format
+type Release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []Asset `json:"assets"`
+}
+
+// Version returns the release version without the leading "v"
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+func (r *Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// Updater fetches releases for one platform
+type Updater struct {
+	Client      *http.Client
+	ReleasesURL string
+	GOOS        string
+	GOARCH      string
+}
+
+// New creates an updater for the running platform; an empty releasesURL uses DefaultReleasesURL
+func New(releasesURL string) *Updater {
+	if releasesURL == "" {
+		releasesURL = DefaultReleasesURL
+	}
+	return &Updater{
+		Client:      http.DefaultClient,
+		ReleasesURL: releasesURL,
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+	}
+}
+
+// Latest fetches the release the releases URL describes
+func (u *Updater) Latest(ctx context.Context) (*Release, error) {
+	body, err := u.get(ctx, u.ReleasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var rel Release
+	if err := json.Unmarshal(body, &rel); err != nil {
+		return nil, fmt.Errorf("invalid release metadata: %w", err)
+	}
+	if rel.Tag == "" {
+		return nil, errors.New("invalid release metadata: missing tag_name")
+	}
+	return &rel, nil
+}
+
+// ArchiveName returns the goreleaser archive name for a version and platform
+func ArchiveName(version, goos, goarch string) string {
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("markhub_%s_%s_%s%s", version, goos, goarch, ext)
+}
+
+// Download fetches this platform's archive of rel, verifies it against the published
+// SHA-256 checksums and returns the markhub binary inside it
+func (u *Updater) Download(ctx context.Context, rel *Release) ([]byte, error) {
+	name := ArchiveName(rel.Version(), u.GOOS, u.GOARCH)
+	archive, ok := rel.asset(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoAsset, name)
+	}
+	sums, ok := rel.asset(checksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s publishes no %s", rel.Tag, checksumsAsset)
+	}
+
+	sumsBody, err := u.get(ctx, sums.URL)
+	if err != nil {
+		return nil, err
+	}
+	want, err := checksumFor(sumsBody, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := u.get(ctx, archive.URL)
+	if err != nil {
+		return nil, err
+	}
+	if got := sha256.Sum256(data); hex.EncodeToString(got[:]) != want {
+		return nil, fmt.Errorf("checksum mismatch for %s", name)
+	}
+
+	if u.GOOS == "windows" {
+		return extractZip(data, "markhub.exe")
+	}
+	return extractTarGz(data, "markhub")
+}
+
+func (u *Updater) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json, application/octet-stream")
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", url, maxDownloadSize)
+	}
+	return body, nil
+}
+
+// checksumFor finds name in a "<sha256>  <file>" checksum list
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+func extractTarGz(data []byte, binName string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive does not contain %s", binName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == binName {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+func extractZip(data []byte, binName string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if f.Mode().IsRegular() && filepath.Base(f.Name) == binName {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer func() { _ = rc.Close() }()
+			return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+		}
+	}
+	return nil, fmt.Errorf("archive does not contain %s", binName)
+}
+
+// IsNewer reports whether version latest is higher than current. Development builds
+// have no comparable version and return an error.
+func IsNewer(current, latest string) (bool, error) {
+	cur, err := parseVersion(current)
+	if err != nil {
+		return false, fmt.Errorf("current version: %w", err)
+	}
+	lat, err := parseVersion(latest)
+	if err != nil {
+		return false, fmt.Errorf("latest version: %w", err)
+	}
+	for i := range cur.parts {
+		if lat.parts[i] != cur.parts[i] {
+			return lat.parts[i] > cur.parts[i], nil
+		}
+	}
+	// A release outranks a pre-release of the same version
+	if (cur.pre == "") != (lat.pre == "") {
+		return lat.pre == "", nil
+	}
+	return lat.pre > cur.pre, nil
+}
+
+type version struct {
+	parts [3]int
+	pre   string
+}
+
+// parseVersion parses "[v]MAJOR.MINOR.PATCH[-PRERELEASE]"
+func parseVersion(s string) (version, error) {
+	var v version
+	core, pre, _ := strings.Cut(strings.TrimPrefix(s, "v"), "-")
+	fields := strings.Split(core, ".")
+	if len(fields) != 3 {
+		return v, fmt.Errorf("%q is not a release version", s)
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%q is not a release version", s)
+		}
+		v.parts[i] = n
+	}
+	v.pre = pre
+	return v, nil
+}
+
+// Install replaces the executable at path with binary. The new file is written next to
+// it and renamed over it, so a failure at any step leaves the existing binary in place.
+func Install(path string, binary []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if err := writeExecutable(tmp, binary, info.Mode().Perm()); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := replaceExecutable(tmpName, path); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+func writeExecutable(f *os.File, binary []byte, perm os.FileMode) error {
+	if _, err := f.Write(binary); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RemoveStale deletes the previous binary a Windows update had to leave behind because
+// it was still running. It is a no-op elsewhere.
+func RemoveStale(path string) {
+	_ = os.Remove(stalePath(path))
+}
+
+// stalePath is where a Windows update moves the binary it replaces
+func stalePath(path string) string {
+	return path + ".old"
+}
@@ -0,0 +1,175 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tarGz(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	hdr := &tar.Header{Name: name, Mode: 0o755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newReleaseServer serves a v1.2.0 release for linux/amd64 whose checksum is sum, or
+// the real checksum of the archive when sum is empty
+func newReleaseServer(t *testing.T, binary []byte, sum string) *Updater {
+	t.Helper()
+	name := ArchiveName("1.2.0", "linux", "amd64")
+	archive := tarGz(t, "markhub", binary)
+	if sum == "" {
+		h := sha256.Sum256(archive)
+		sum = hex.EncodeToString(h[:])
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(Release{Tag: "v1.2.0", Assets: []Asset{
+			{Name: name, URL: srv.URL + "/archive"},
+			{Name: checksumsAsset, URL: srv.URL + "/checksums"},
+		}})
+	})
+	mux.HandleFunc("/archive", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(archive) })
+	mux.HandleFunc("/checksums", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s  other.tar.gz\n%s  %s\n", sum, sum, name)
+	})
+
+	u := New(srv.URL + "/latest")
+	u.GOOS, u.GOARCH = "linux", "amd64"
+	return u
+}
+
+func writeBinary(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "markhub")
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDownloadAndInstall(t *testing.T) {
+	u := newReleaseServer(t, []byte("new binary"), "")
+	rel, err := u.Latest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version() != "1.2.0" {
+		t.Fatalf("expected version 1.2.0, got %q", rel.Version())
+	}
+	binary, err := u.Download(context.Background(), rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeBinary(t, "old binary")
+	if err := Install(path, binary); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(path)
+	if string(got) != "new binary" {
+		t.Errorf("expected the binary to be replaced, got %q", got)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o755 {
+		t.Errorf("expected the mode to be kept, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected no leftover temp files, got %d entries", len(entries))
+	}
+}
+
+func TestDownloadRejectsChecksumMismatch(t *testing.T) {
+	u := newReleaseServer(t, []byte("tampered"), "0000000000000000000000000000000000000000000000000000000000000000")
+	rel, err := u.Latest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Download(context.Background(), rel); err == nil {
+		t.Fatal("expected a checksum mismatch to fail the download")
+	}
+}
+
+func TestDownloadMissingPlatform(t *testing.T) {
+	u := newReleaseServer(t, []byte("new binary"), "")
+	u.GOOS = "plan9"
+	rel, err := u.Latest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Download(context.Background(), rel); !errors.Is(err, ErrNoAsset) {
+		t.Errorf("expected ErrNoAsset, got %v", err)
+	}
+}
+
+func TestInstallFailureKeepsBinary(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	path := writeBinary(t, "old binary")
+	dir := filepath.Dir(path)
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(dir, 0o755) })
+
+	if err := Install(path, []byte("new binary")); err == nil {
+		t.Fatal("expected the install to fail in a read-only directory")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "old binary" {
+		t.Errorf("expected the old binary to survive, got %q", got)
+	}
+}
+
+func TestIsNewer(t *testing.T) {
+	tests := []struct {
+		current, latest string
+		want            bool
+		wantErr         bool
+	}{
+		{"1.2.0", "v1.2.1", true, false},
+		{"v1.2.0", "1.10.0", true, false},
+		{"1.2.0", "1.2.0", false, false},
+		{"2.0.0", "1.9.9", false, false},
+		{"1.2.0-rc.1", "1.2.0", true, false},
+		{"1.2.0", "1.3.0-rc.1", true, false},
+		{"1.2.0", "1.2.0-rc.1", false, false},
+		{"dev", "1.2.0", false, true},
+		{"1.2.0", "latest", false, true},
+	}
+	for _, tt := range tests {
+		got, err := IsNewer(tt.current, tt.latest)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("IsNewer(%q, %q) = %v, %v; want %v (error %v)", tt.current, tt.latest, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/CageChen/markhub/internal/config"
+)
+
+// folderFilter decides which paths of a local folder the tree shows, so both watchers only
+// report changes the tree build would not filter out.
+type folderFilter struct {
+	cfg      *config.Config
+	root     string
+	subPath  string
+	excludes []string
+}
+
+// newFolderFilter merges the repo-level and folder-level excludes of folder, as the tree build does
+func newFolderFilter(cfg *config.Config, folder config.Folder) folderFilter {
+	excludes := append([]string{}, cfg.GetRepoExclude(folder.Path)...)
+	return folderFilter{
+		cfg:      cfg,
+		root:     folder.Path,
+		subPath:  strings.Trim(filepath.ToSlash(folder.SubPath), "/"),
+		excludes: append(excludes, folder.Exclude...),
+	}
+}
+
+// rel returns path relative to the folder root in slash form, or false when it is outside the folder
+func (f folderFilter) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// visible reports whether path lies under the folder's sub_path and no component below it is
+// excluded by the global, repo-level or folder-level patterns
+func (f folderFilter) visible(path string) bool {
+	rel, ok := f.rel(path)
+	if !ok {
+		return false
+	}
+	if rel == "" || rel == f.subPath {
+		return rel == f.subPath
+	}
+	start := 0
+	if f.subPath != "" {
+		if !strings.HasPrefix(rel, f.subPath+"/") {
+			return false
+		}
+		start = strings.Count(f.subPath, "/") + 1
+	}
+	parts := strings.Split(rel, "/")
+	for i := start; i < len(parts); i++ {
+		if f.cfg.IsExcluded(parts[i]) || f.cfg.IsFolderExcluded(strings.Join(parts[:i+1], "/"), f.excludes) {
+			return false
+		}
+	}
+	return true
+}
+
+// leadsToSubPath reports whether dir is an ancestor of the folder's sub_path, which a walk must enter
+// even though nothing directly inside it is shown
+func (f folderFilter) leadsToSubPath(dir string) bool {
+	rel, ok := f.rel(dir)
+	if !ok || f.subPath == "" {
+		return false
+	}
+	return rel == "" || strings.HasPrefix(f.subPath, rel+"/")
+}
+
+// localFilters returns a filter for every folder read from disk (git_ref folders are skipped)
+func localFilters(cfg *config.Config) []folderFilter {
+	var filters []folderFilter
+	for _, folder := range cfg.FoldersSnapshot() {
+		if folder.GitRef == "" {
+			filters = append(filters, newFolderFilter(cfg, folder))
+		}
+	}
+	return filters
+}
+
+// visibleInAny reports whether any of the filters shows path
+func visibleInAny(filters []folderFilter, path string) bool {
+	for _, f := range filters {
+		if f.visible(path) {
+			return true
+		}
+	}
+	return false
+}
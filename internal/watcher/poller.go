@@ -0,0 +1,149 @@
+package watcher
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+)
+
+// DefaultPollInterval is used when watch_mode is "poll" and no interval is configured.
+const DefaultPollInterval = 2 * time.Second
+
+// fileState is the subset of file metadata the poller compares between scans.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+// Poller detects file changes by periodically stat-ing every watched file.
+// It is meant for network filesystems and containers where inotify events never fire.
+type Poller struct {
+	cfg       *config.Config
+	interval  time.Duration
+	callbacks []Callback
+	mu        sync.RWMutex
+	snapshot  map[string]fileState
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewPoller creates a polling watcher that scans all configured folders every interval.
+func NewPoller(cfg *config.Config, interval time.Duration) *Poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &Poller{
+		cfg:      cfg,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// OnChange registers a callback for file change events
+func (p *Poller) OnChange(cb Callback) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.callbacks = append(p.callbacks, cb)
+}
+
+// Start takes an initial snapshot and begins polling in the background
+func (p *Poller) Start() error {
+	p.snapshot = p.scan()
+	go p.loop()
+	return nil
+}
+
+// Stop stops the poller
+func (p *Poller) Stop() error {
+	p.stopOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *Poller) loop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+// poll rescans all folders and emits events for the differences since the last scan.
+func (p *Poller) poll() {
+	current := p.scan()
+	for _, e := range diffSnapshots(p.snapshot, current) {
+		p.emit(e)
+	}
+	p.snapshot = current
+}
+
+// scan walks every local folder and records the state of the directories and markdown files
+// the tree shows.
+func (p *Poller) scan() map[string]fileState {
+	states := make(map[string]fileState)
+	for _, filter := range localFilters(p.cfg) {
+		err := filepath.Walk(filter.root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				// Files can vanish mid-walk; skip them rather than aborting the scan
+				return nil
+			}
+			if !filter.visible(path) {
+				if info.IsDir() && !filter.leadsToSubPath(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() && !p.cfg.IsMarkdownFile(path) {
+				return nil
+			}
+			states[path] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+				isDir:   info.IsDir(),
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Warning: failed to poll folder %s: %v", filter.root, err)
+		}
+	}
+	return states
+}
+
+// diffSnapshots returns create/write/remove events that turn prev into curr.
+func diffSnapshots(prev, curr map[string]fileState) []Event {
+	var events []Event
+	for path, state := range curr {
+		old, ok := prev[path]
+		switch {
+		case !ok:
+			events = append(events, Event{Type: EventCreate, Path: path})
+		case !state.isDir && (!state.modTime.Equal(old.modTime) || state.size != old.size):
+			events = append(events, Event{Type: EventWrite, Path: path})
+		}
+	}
+	for path := range prev {
+		if _, ok := curr[path]; !ok {
+			events = append(events, Event{Type: EventRemove, Path: path})
+		}
+	}
+	return events
+}
+
+func (p *Poller) emit(e Event) {
+	p.mu.RLock()
+	callbacks := make([]Callback, len(p.callbacks))
+	copy(callbacks, p.callbacks)
+	p.mu.RUnlock()
+
+	notifyAll(callbacks, e)
+}
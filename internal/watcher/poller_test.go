@@ -0,0 +1,116 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CageChen/markhub/internal/config"
+)
+
+func TestPoller_DetectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{Path: dir, Alias: "docs"}}
+
+	existing := filepath.Join(dir, "a.md")
+	if err := os.WriteFile(existing, []byte("# A\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPoller(cfg, time.Hour)
+	var events []Event
+	p.OnChange(func(e Event) { events = append(events, e) })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = p.Stop() }()
+
+	created := filepath.Join(dir, "b.md")
+	if err := os.WriteFile(created, []byte("# B\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("# A changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p.poll()
+
+	got := make(map[string]EventType)
+	for _, e := range events {
+		got[e.Path] = e.Type
+	}
+	if got[created] != EventCreate {
+		t.Errorf("expected create event for %s, got %+v", created, events)
+	}
+	if got[existing] != EventWrite {
+		t.Errorf("expected write event for %s, got %+v", existing, events)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected 2 events, got %+v", events)
+	}
+
+	events = nil
+	if err := os.Remove(created); err != nil {
+		t.Fatal(err)
+	}
+	p.poll()
+	if len(events) != 1 || events[0].Type != EventRemove || events[0].Path != created {
+		t.Errorf("expected single remove event, got %+v", events)
+	}
+}
+
+func TestPoller_IgnoresPathsHiddenFromTree(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"docs/drafts", "docs/vendor", "docs/private", "other"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.DefaultConfig()
+	cfg.Exclude = []string{"vendor"}
+	cfg.RepoExclude = map[string][]string{dir: {"docs/private"}}
+	cfg.Folders = []config.Folder{{Path: dir, Alias: "docs", SubPath: "docs", Exclude: []string{"docs/drafts"}}}
+
+	p := NewPoller(cfg, time.Hour)
+	var events []Event
+	p.OnChange(func(e Event) { events = append(events, e) })
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = p.Stop() }()
+
+	visible := filepath.Join(dir, "docs", "guide.md")
+	for _, path := range []string{
+		visible,
+		filepath.Join(dir, "docs", "drafts", "wip.md"),   // folder-level exclude
+		filepath.Join(dir, "docs", "vendor", "lib.md"),   // global exclude
+		filepath.Join(dir, "docs", "private", "keys.md"), // repo-level exclude
+		filepath.Join(dir, "other", "notes.md"),          // outside sub_path
+		filepath.Join(dir, "README.md"),                  // outside sub_path
+	} {
+		if err := os.WriteFile(path, []byte("# x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.poll()
+
+	if len(events) != 1 || events[0].Path != visible || events[0].Type != EventCreate {
+		t.Errorf("expected a single create event for %s, got %+v", visible, events)
+	}
+}
+
+func TestNotifyAll_RecoversPanickingCallback(t *testing.T) {
+	var got []Event
+	callbacks := []Callback{
+		func(Event) { panic("boom") },
+		func(e Event) { got = append(got, e) },
+	}
+	notifyAll(callbacks, Event{Type: EventWrite, Path: "a.md"})
+	if len(got) != 1 {
+		t.Errorf("expected the callback after a panicking one to run, got %+v", got)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/CageChen/markhub/internal/config"
+	"github.com/CageChen/markhub/internal/crash"
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -31,6 +33,21 @@ type Event struct {
 // Callback is a function called when file changes occur
 type Callback func(Event)
 
+// FileWatcher is implemented by both the fsnotify-based Watcher and the polling Poller.
+type FileWatcher interface {
+	OnChange(cb Callback)
+	Start() error
+	Stop() error
+}
+
+// NewFromConfig creates the watcher selected by cfg.WatchMode ("fsnotify" by default, or "poll").
+func NewFromConfig(cfg *config.Config) (FileWatcher, error) {
+	if cfg.WatchMode == config.WatchModePoll {
+		return NewPoller(cfg, cfg.PollInterval), nil
+	}
+	return New(cfg)
+}
+
 // Watcher monitors file system changes in the markdown directory
 type Watcher struct {
 	watcher   *fsnotify.Watcher
@@ -38,6 +55,10 @@ type Watcher struct {
 	callbacks []Callback
 	mu        sync.RWMutex
 	done      chan struct{}
+
+	// Directories added to watcher, so that those of overlapping folders are added once
+	watchedMu sync.Mutex
+	watched   map[string]bool
 }
 
 // New creates a new file system watcher
@@ -51,6 +72,7 @@ func New(cfg *config.Config) (*Watcher, error) {
 		watcher: w,
 		cfg:     cfg,
 		done:    make(chan struct{}),
+		watched: make(map[string]bool),
 	}, nil
 }
 
@@ -64,24 +86,25 @@ func (w *Watcher) OnChange(cb Callback) {
 // Start begins watching all configured directories
 func (w *Watcher) Start() error {
 	// Watch all configured folders (skip git_ref folders — they read from the object database)
-	for _, folder := range w.cfg.Folders {
-		if folder.GitRef != "" {
-			continue
-		}
-		err := filepath.Walk(folder.Path, func(path string, info os.FileInfo, err error) error {
+	for _, filter := range localFilters(w.cfg) {
+		err := filepath.Walk(filter.root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			// Only watch directories
-			if info.IsDir() && !w.cfg.IsExcluded(path) {
-				if err := w.watcher.Add(path); err != nil {
-					log.Printf("Warning: cannot watch %s: %v", path, err)
-				}
+			// Only watch directories the tree shows, plus those leading to a sub_path
+			if !info.IsDir() {
+				return nil
+			}
+			if !filter.visible(path) && !filter.leadsToSubPath(path) {
+				return filepath.SkipDir
+			}
+			if err := w.watch(path); err != nil {
+				log.Printf("Warning: cannot watch %s: %v", path, err)
 			}
 			return nil
 		})
 		if err != nil {
-			log.Printf("Warning: failed to walk folder %s: %v", folder.Path, err)
+			log.Printf("Warning: failed to walk folder %s: %v", filter.root, err)
 		}
 	}
 
@@ -89,6 +112,34 @@ func (w *Watcher) Start() error {
 	return nil
 }
 
+// watch adds the directory at path to the watcher unless it already is, as it may be when one
+// folder lies inside another
+func (w *Watcher) watch(path string) error {
+	w.watchedMu.Lock()
+	defer w.watchedMu.Unlock()
+	if w.watched[path] {
+		return nil
+	}
+	if err := w.watcher.Add(path); err != nil {
+		return err
+	}
+	w.watched[path] = true
+	return nil
+}
+
+// unwatch forgets the directory at path and those below it
+func (w *Watcher) unwatch(path string) {
+	w.watchedMu.Lock()
+	defer w.watchedMu.Unlock()
+	delete(w.watched, path)
+	prefix := path + string(filepath.Separator)
+	for p := range w.watched {
+		if strings.HasPrefix(p, prefix) {
+			delete(w.watched, p)
+		}
+	}
+}
+
 // Stop stops the watcher
 func (w *Watcher) Stop() error {
 	close(w.done)
@@ -115,8 +166,13 @@ func (w *Watcher) eventLoop() {
 }
 
 func (w *Watcher) handleEvent(event fsnotify.Event) {
-	// Skip excluded paths
-	if w.cfg.IsExcluded(event.Name) {
+	// fsnotify drops the watch of a removed directory; forget it so that it is watched again if recreated
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.unwatch(event.Name)
+	}
+
+	// Skip paths the tree does not show (excludes, sub_path); folders may have changed since Start
+	if !visibleInAny(localFilters(w.cfg), event.Name) {
 		return
 	}
 
@@ -131,7 +187,7 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 		eventType = EventCreate
 		// If a new directory is created, watch it
 		if isDir(event.Name) {
-			_ = w.watcher.Add(event.Name)
+			_ = w.watch(event.Name)
 		}
 	case event.Op&fsnotify.Write == fsnotify.Write:
 		eventType = EventWrite
@@ -153,11 +209,22 @@ func (w *Watcher) handleEvent(event fsnotify.Event) {
 	copy(callbacks, w.callbacks)
 	w.mu.RUnlock()
 
+	notifyAll(callbacks, e)
+}
+
+// notifyAll passes e to every callback. A panicking callback is reported to the crash sink and
+// does not stop the others or the event loop.
+func notifyAll(callbacks []Callback, e Event) {
 	for _, cb := range callbacks {
-		cb(e)
+		notify(cb, e)
 	}
 }
 
+func notify(cb Callback, e Event) {
+	defer crash.Recover("watcher callback")
+	cb(e)
+}
+
 func isDir(path string) bool {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -0,0 +1,41 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/CageChen/markhub/internal/config"
+)
+
+func TestWatcher_OverlappingFoldersWatchedOnce(t *testing.T) {
+	dir := t.TempDir()
+	docs := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(filepath.Join(docs, "guide"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Folders = []config.Folder{{ID: "repo", Path: dir, Alias: "repo"}, {ID: "docs", Path: docs, Alias: "docs"}}
+
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Stop() }()
+
+	got := w.watcher.WatchList()
+	slices.Sort(got)
+	want := []string{dir, docs, filepath.Join(docs, "guide")}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected each directory watched once, got %v", got)
+	}
+
+	w.unwatch(docs)
+	if w.watched[docs] || w.watched[filepath.Join(docs, "guide")] || !w.watched[dir] {
+		t.Errorf("unexpected watched directories after removal %v", w.watched)
+	}
+}